@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/config"
+	"github.com/spf13/cobra"
+)
+
+// newDeviceCommand returns the command querying the Bluetooth backend directly, without going
+// through the API
+func newDeviceCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "device",
+		Short: "Query the Bluetooth devices",
+	}
+
+	var adapterAddress string
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the devices of every adapter, or of one",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return deviceList(adapterAddress)
+		},
+	}
+	list.Flags().StringVar(&adapterAddress, "adapter", "", "Only list the devices of the adapter with this MAC address")
+
+	cmd.AddCommand(list)
+	return cmd
+}
+
+func deviceList(adapterAddress string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	// A running broker keeps its pairing agent
+	btManager, err := bluetooth.NewBackend(cfg.BluetoothBackend, bluetooth.Options{NoAgent: true})
+	if err != nil {
+		return err
+	}
+	defer btManager.Close()
+
+	adapters, err := btManager.GetAdapters()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ADAPTER\tADDRESS\tNAME\tPAIRED\tTRUSTED\tCONNECTED")
+	found := false
+	for _, adapter := range adapters {
+		if adapterAddress != "" && !strings.EqualFold(adapter.Address, adapterAddress) {
+			continue
+		}
+		found = true
+
+		devices, err := btManager.GetDevices(adapter.Path)
+		if err != nil {
+			return fmt.Errorf("failed to list devices of adapter %s: %w", adapter.Address, err)
+		}
+		for _, d := range devices {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%v\t%v\n", adapter.Address, d.Address, d.Name, d.Paired, d.Trusted, d.Connected)
+		}
+	}
+	if adapterAddress != "" && !found {
+		return fmt.Errorf("adapter with MAC address %s not found", adapterAddress)
+	}
+	return w.Flush()
+}
@@ -1,107 +1,78 @@
+// home-bt-broker exposes BlueZ and the WirePlumber Bluetooth settings through an HTTP API. Besides
+// running the server, its subcommands manage the database and query Bluetooth devices offline,
+// on a box where the API is not running.
 package main
 
 import (
-	"log"
-	"net/http"
+	"database/sql"
+	"fmt"
 	"os"
 
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/nerzhul/home-bt-broker/internal/automation"
+	"github.com/nerzhul/home-bt-broker/internal/config"
 	"github.com/nerzhul/home-bt-broker/internal/database"
-	"github.com/nerzhul/home-bt-broker/internal/handlers"
-	"github.com/nerzhul/home-bt-broker/internal/wireplumber"
+	"github.com/spf13/cobra"
 )
 
 func main() {
-	// Initialize database
-	db, err := database.InitDB()
+	cmd, err := newRootCommand().ExecuteC()
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
-	}
-	defer db.Close()
-
-	// Run migrations
-	if err := database.RunMigrations(db); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+		fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.CommandPath(), err)
+		os.Exit(1)
 	}
+}
 
-	// Initialize WirePlumber configuration manager
-	wpConfigManager, err := wireplumber.NewConfigManager()
-	if err != nil {
-		log.Fatalf("Failed to initialize WirePlumber config manager: %v", err)
+// newRootCommand returns the command of the binary. Without a subcommand, the server runs as before
+// subcommands existed.
+func newRootCommand() *cobra.Command {
+	var check bool
+	root := &cobra.Command{
+		Use:   "home-bt-broker",
+		Short: "Expose BlueZ and the WirePlumber Bluetooth settings through an HTTP API",
+		Long: "home-bt-broker exposes BlueZ and the WirePlumber Bluetooth settings through an HTTP API.\n\n" +
+			"The configuration is read from the environment variables, by the server as by the other commands.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve(check)
+		},
+		// Errors are printed once by main, without the usage which --help shows
+		SilenceErrors: true,
+		SilenceUsage:  true,
 	}
+	root.Flags().BoolVar(&check, "check", false, checkUsage)
+	root.CompletionOptions.DisableDefaultCmd = true
+	root.AddCommand(newServeCommand(), newMigrateCommand(), newTokenCommand(), newDeviceCommand(), newAutomationSandboxCommand())
+	return root
+}
 
-	// Ensure WirePlumber configuration exists
-	if err := wpConfigManager.EnsureConfig(); err != nil {
-		log.Printf("Warning: Failed to setup WirePlumber configuration: %v", err)
+// newAutomationSandboxCommand returns the command the automation engine runs to evaluate a script in a
+// child process
+func newAutomationSandboxCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:    automation.SandboxCommand,
+		Short:  "Evaluate an automation script, read as JSON on the standard input",
+		Args:   cobra.NoArgs,
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return automation.RunSandbox(os.Stdin, os.Stdout)
+		},
 	}
+}
 
-	// Initialize Bluetooth handler
-	btHandler, err := handlers.NewBluetoothHandler()
+// openDatabase opens the database of the configuration and applies the pending migrations
+func openDatabase() (*sql.DB, *config.Config, error) {
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatalf("Failed to initialize Bluetooth handler: %v", err)
+		return nil, nil, err
 	}
-	defer btHandler.Close()
 
-	// Log Bluetooth adapters at startup
-	adapters, err := btHandler.GetAdaptersRaw()
+	db, err := database.InitDBWithOptions(cfg.DatabasePath, cfg.DatabaseOptions())
 	if err != nil {
-		log.Printf("Could not list Bluetooth adapters: %v", err)
-	} else if len(adapters) == 0 {
-		log.Printf("No Bluetooth adapters found.")
-	} else {
-		log.Printf("Bluetooth adapters detected:")
-		for _, a := range adapters {
-			log.Printf("- Name: %s, Address: %s, Powered: %v, Discoverable: %v, Discovering: %v", a.Name, a.Address, a.Powered, a.Discoverable, a.Discovering)
-		}
+		return nil, nil, err
 	}
-
-	// Create Echo instance
-	e := echo.New()
-
-	e.File("/", "internal/handlers/static/index.html")
-
-	// Middleware
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
-
-	h := handlers.NewHandler(db)
-
-	// Health check endpoints
-	e.GET("/readyz", h.Readiness)
-	e.GET("/livez", h.Liveness)
-
-	// API routes
-	api := e.Group("/api/v1")
-
-	tokenGroup := api.Group("/tokens", handlers.AuthMiddleware(db))
-	tokenGroup.POST("", h.CreateToken)
-	tokenGroup.GET("", h.GetTokens)
-	tokenGroup.GET("/:username", h.GetToken)
-	tokenGroup.DELETE("/:username", h.DeleteToken)
-
-	bluetoothGroup := api.Group("/bluetooth", handlers.AuthMiddleware(db))
-	bluetoothGroup.GET("/adapters", btHandler.GetAdapters)
-	bluetoothGroup.PATCH("/adapters/:adapter/discoverable", btHandler.SetDiscoverable)
-	bluetoothGroup.PATCH("/adapters/:adapter/discovering", btHandler.SetDiscovering)
-	bluetoothGroup.GET("/adapters/:adapter/devices", btHandler.GetDevices)
-	bluetoothGroup.GET("/adapters/:adapter/devices/trusted", btHandler.GetTrustedDevices)
-	bluetoothGroup.GET("/adapters/:adapter/devices/connected", btHandler.GetConnectedDevices)
-	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/pair", btHandler.PairDevice)
-	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/connect", btHandler.ConnectDevice)
-	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/trust", btHandler.TrustDevice)
-	bluetoothGroup.DELETE("/adapters/:adapter/devices/:mac", btHandler.RemoveDevice)
-
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	log.Printf("Starting server on port %s", port)
-	if err := e.Start(":" + port); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Failed to start server: %v", err)
+	if err := database.RunMigrations(db); err != nil {
+		db.Close()
+		return nil, nil, err
 	}
+	return db, cfg, nil
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRootCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{name: "unknown command", args: []string{"remove"}, err: `unknown command "remove" for "home-bt-broker"`},
+		{name: "missing username", args: []string{"token", "delete"}, err: "accepts 1 arg(s), received 0"},
+		{name: "extra argument", args: []string{"migrate", "now"}, err: `unknown command "now" for "home-bt-broker migrate"`},
+		{name: "unknown flag", args: []string{"device", "list", "-adapter", "AA"}, err: "unknown shorthand flag: 'a' in -adapter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newRootCommand()
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(&bytes.Buffer{})
+			cmd.SetErr(&bytes.Buffer{})
+			assert.EqualError(t, cmd.Execute(), tt.err)
+		})
+	}
+
+	// Help lists the subcommands and is not an error
+	var out bytes.Buffer
+	cmd := newRootCommand()
+	cmd.SetArgs([]string{"token", "--help"})
+	cmd.SetOut(&out)
+	assert.NoError(t, cmd.Execute())
+	for _, name := range []string{"create", "list", "delete"} {
+		assert.Contains(t, out.String(), name)
+	}
+}
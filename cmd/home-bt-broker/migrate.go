@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nerzhul/home-bt-broker/internal/config"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/spf13/cobra"
+)
+
+// newMigrateCommand returns the command applying the pending database migrations, which the
+// server otherwise does at startup
+func newMigrateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply the pending database migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return migrate()
+		},
+	}
+}
+
+func migrate() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	db, err := database.InitDBWithOptions(cfg.DatabasePath, cfg.DatabaseOptions())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	before, _, err := database.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if err := database.RunMigrations(db); err != nil {
+		return err
+	}
+	after, _, err := database.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if before == after {
+		fmt.Printf("%s is up to date, schema version %d\n", cfg.DatabasePath, after)
+	} else {
+		fmt.Printf("%s migrated from schema version %d to %d\n", cfg.DatabasePath, before, after)
+	}
+	return nil
+}
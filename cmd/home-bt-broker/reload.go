@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/nerzhul/home-bt-broker/internal/config"
+)
+
+// runReloadable runs a subsystem with the configuration, and runs it again with the new one after
+// a reload changing its settings. The subsystem returns at once when its settings disable it.
+func runReloadable(ctx context.Context, reloader *config.Reloader, cfg *config.Config,
+	settings func(cfg *config.Config) []interface{}, run func(ctx context.Context, cfg *config.Config)) {
+	var mu sync.Mutex
+	var cancel context.CancelFunc
+	var done chan struct{}
+	start := func(cfg *config.Config) {
+		var runCtx context.Context
+		runCtx, cancel = context.WithCancel(ctx)
+		done = make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			run(runCtx, cfg)
+		}(done)
+	}
+
+	current := settings(cfg)
+	start(cfg)
+	reloader.OnReload(func(cfg *config.Config) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		next := settings(cfg)
+		if reflect.DeepEqual(current, next) {
+			return
+		}
+		cancel()
+		<-done
+		current = next
+		start(cfg)
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunReloadable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "broker.env")
+	assert.NoError(t, os.WriteFile(path, []byte("WEBHOOK_URL=https://hooks.example.com/a\n"), 0600))
+	t.Setenv("DATABASE_PATH", filepath.Join(dir, "data.db"))
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	reloader := config.NewReloader(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan string, 4)
+	stopped := make(chan string, 4)
+	runReloadable(ctx, reloader, cfg, func(cfg *config.Config) []interface{} {
+		return []interface{}{cfg.WebhookURL}
+	}, func(ctx context.Context, cfg *config.Config) {
+		started <- cfg.WebhookURL
+		<-ctx.Done()
+		stopped <- cfg.WebhookURL
+	})
+	assert.Equal(t, "https://hooks.example.com/a", <-started)
+
+	// A reload leaving the settings alone keeps the subsystem running
+	assert.NoError(t, os.WriteFile(path, []byte("WEBHOOK_URL=https://hooks.example.com/a\nNTFY_URL=https://ntfy.sh/home\n"), 0600))
+	_, err = reloader.Reload()
+	assert.NoError(t, err)
+	assert.Empty(t, stopped)
+
+	// Changing them runs it again once stopped
+	assert.NoError(t, os.WriteFile(path, []byte("WEBHOOK_URL=https://hooks.example.com/b\n"), 0600))
+	_, err = reloader.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://hooks.example.com/a", <-stopped)
+	select {
+	case url := <-started:
+		assert.Equal(t, "https://hooks.example.com/b", url)
+	case <-time.After(time.Second):
+		t.Fatal("the subsystem was not run again")
+	}
+}
@@ -0,0 +1,721 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nerzhul/home-bt-broker/internal/audio"
+	"github.com/nerzhul/home-bt-broker/internal/audit"
+	"github.com/nerzhul/home-bt-broker/internal/automation"
+	"github.com/nerzhul/home-bt-broker/internal/battery"
+	"github.com/nerzhul/home-bt-broker/internal/beacon"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth/signals"
+	"github.com/nerzhul/home-bt-broker/internal/bluez"
+	"github.com/nerzhul/home-bt-broker/internal/config"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/diagnostics"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/guest"
+	"github.com/nerzhul/home-bt-broker/internal/handlers"
+	"github.com/nerzhul/home-bt-broker/internal/health"
+	"github.com/nerzhul/home-bt-broker/internal/hfp"
+	"github.com/nerzhul/home-bt-broker/internal/hooks"
+	"github.com/nerzhul/home-bt-broker/internal/idle"
+	"github.com/nerzhul/home-bt-broker/internal/lockout"
+	"github.com/nerzhul/home-bt-broker/internal/logging"
+	"github.com/nerzhul/home-bt-broker/internal/mqtt"
+	"github.com/nerzhul/home-bt-broker/internal/notify"
+	"github.com/nerzhul/home-bt-broker/internal/plugin"
+	"github.com/nerzhul/home-bt-broker/internal/presence"
+	"github.com/nerzhul/home-bt-broker/internal/reconnect"
+	"github.com/nerzhul/home-bt-broker/internal/retention"
+	"github.com/nerzhul/home-bt-broker/internal/rssi"
+	"github.com/nerzhul/home-bt-broker/internal/schedule"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+	"github.com/nerzhul/home-bt-broker/internal/selfcheck"
+	"github.com/nerzhul/home-bt-broker/internal/statsd"
+	"github.com/nerzhul/home-bt-broker/internal/telegram"
+	"github.com/nerzhul/home-bt-broker/internal/trustsync"
+	"github.com/nerzhul/home-bt-broker/internal/webpush"
+	"github.com/nerzhul/home-bt-broker/internal/wireplumber"
+	"github.com/spf13/cobra"
+)
+
+// shutdownTimeout bounds the wait for the requests in flight, such as event streams, on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// checkUsage is the help of the check flag of the serve command, also accepted without it
+const checkUsage = "Check the configuration, database, Bluetooth backend and WirePlumber configuration, then exit"
+
+// newServeCommand returns the command running the server
+func newServeCommand() *cobra.Command {
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run the broker server (default)",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve(check)
+		},
+	}
+	cmd.Flags().BoolVar(&check, "check", false, checkUsage)
+	return cmd
+}
+
+// serve runs the broker server until it fails or is stopped by SIGINT or SIGTERM. With check, it
+// only runs the self-test.
+func serve(check bool) error {
+	cfg, err := config.Load()
+	if check {
+		if !selfcheck.Run(os.Stdout, selfcheck.Checks(cfg, err)) {
+			os.Exit(1)
+		}
+		return nil
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration, fix the environment variables below and restart: %v", err)
+	}
+
+	// journald and syslog timestamp entries themselves
+	logOutput, err := logging.NewWriter(cfg.LogOutput, cfg.SyslogAddress, "home-bt-broker")
+	if err != nil {
+		log.Fatalf("Failed to initialize log output: %v", err)
+	}
+	if cfg.LogOutput != logging.OutputStderr {
+		log.SetOutput(logOutput)
+		log.SetFlags(0)
+	}
+
+	// Initialize database
+	db, err := database.InitDBWithOptions(cfg.DatabasePath, cfg.DatabaseOptions())
+	if err != nil {
+		log.Fatalf("Failed to initialize database: %v", err)
+	}
+	defer db.Close()
+
+	// Run migrations
+	if err := database.RunMigrations(db); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	// Create the first admin token on an empty database
+	token, err := database.EnsureBootstrapToken(db, cfg.BootstrapUsername, cfg.BootstrapToken)
+	if err != nil {
+		log.Fatalf("Failed to bootstrap admin token: %v", err)
+	}
+	if token != "" {
+		if cfg.BootstrapToken != "" {
+			log.Printf("Created bootstrap admin token for user %q from BOOTSTRAP_TOKEN", cfg.BootstrapUsername)
+		} else {
+			log.Printf("Created bootstrap admin token for user %q: %s", cfg.BootstrapUsername, token)
+			log.Printf("This token is only shown once, store it and create your own tokens with it")
+		}
+	}
+
+	// Keep the recent logs for the diagnostics, from now on so that they never hold the bootstrap
+	// token printed above
+	logRing := logging.NewRing(1000)
+	if cfg.LogOutput != logging.OutputStderr {
+		logRing.Timestamps = true
+		log.SetOutput(io.MultiWriter(logOutput, logRing))
+	} else {
+		log.SetOutput(io.MultiWriter(os.Stderr, logRing))
+	}
+
+	// Load the optional encryption key for secrets and device metadata stored at rest
+	cipher, err := secrets.Load(cfg.EncryptionKey, cfg.EncryptionKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load encryption key: %v", err)
+	}
+	if cipher.Enabled() {
+		count, err := database.ReencryptSecrets(db, cipher, true)
+		if err != nil {
+			log.Fatalf("Failed to encrypt stored secrets: %v", err)
+		}
+		if count > 0 {
+			log.Printf("Encrypted %d plaintext value(s)", count)
+		}
+	}
+
+	// Seed the device metadata with the pairings bluetoothd made before the broker was installed
+	if imported, count, err := bluez.ImportOnce(db, cipher, cfg.BlueZStorageDir); err != nil {
+		log.Printf("Could not import the BlueZ storage, it is retried on the next start: %v", err)
+	} else if imported {
+		log.Printf("Imported %d device(s) from the BlueZ storage in %s", count, cfg.BlueZStorageDir)
+	}
+
+	// Initialize the configuration manager of the audio stack, WirePlumber or PulseAudio
+	wpConfigManager, err := wireplumber.Detect()
+	if err != nil {
+		log.Fatalf("Failed to initialize audio config manager: %v", err)
+	}
+	log.Printf("Audio stack: %s", wpConfigManager.Stack())
+
+	// Ensure the audio configuration exists
+	if err := wpConfigManager.EnsureConfig(); err != nil {
+		log.Printf("Warning: Failed to setup %s configuration: %v", wpConfigManager.Stack(), err)
+	}
+	if err := audio.SyncWirePlumber(db, wpConfigManager); err != nil {
+		log.Printf("Warning: Failed to setup WirePlumber device policies: %v", err)
+	}
+
+	// Initialize Bluetooth manager and handler
+	btOptions := bluetooth.Options{
+		PairingMode:           cfg.PairingMode,
+		PairingRequestTimeout: cfg.PairingRequestTimeout,
+	}
+	if cfg.BluetoothBackend == bluetooth.BackendMock {
+		log.Printf("Using the simulated Bluetooth backend, adapters and devices are not real")
+	}
+	btManager, err := bluetooth.NewBackend(cfg.BluetoothBackend, btOptions)
+	if err != nil {
+		log.Fatalf("Failed to initialize Bluetooth manager: %v", err)
+	}
+	// Guest mode and the discoverable schedules share the discoverable and pairable states of the adapters
+	visibility := bluetooth.NewVisibility(btManager)
+	guestMode := guest.NewMode(btManager, db, cipher, visibility, cfg.GuestCheckInterval)
+	if cfg.PairingAllowlist {
+		// Only devices of the pairing allowlist may pair, unless a guest pairing window is open. A
+		// database error rejects the request.
+		btManager.SetPairingPolicy(func(address string) bool {
+			if guestMode.Active() {
+				return true
+			}
+			allowed, err := database.IsPairingAllowed(db, address)
+			if err != nil {
+				log.Printf("Failed to check pairing allowlist: %v", err)
+			}
+			return allowed
+		})
+	}
+	btHandler := handlers.NewBluetoothHandlerWithDB(btManager, db, cipher)
+	defer btHandler.Close()
+
+	// Log Bluetooth adapters at startup
+	adapters, err := btHandler.GetAdaptersRaw()
+	if err != nil {
+		log.Printf("Could not list Bluetooth adapters: %v", err)
+	} else if len(adapters) == 0 {
+		log.Printf("No Bluetooth adapters found.")
+	} else {
+		log.Printf("Bluetooth adapters detected:")
+		for _, a := range adapters {
+			log.Printf("- Name: %s, Address: %s, Powered: %v, Discoverable: %v, Discovering: %v", a.Name, a.Address, a.Powered, a.Discoverable, a.Discovering)
+		}
+	}
+
+	// Detect the BlueZ version and the features it supports, to gate the endpoints relying on them
+	systemInfo, err := btManager.GetSystemInfo()
+	if err != nil {
+		log.Printf("Warning: failed to detect BlueZ, its features are not gated: %v", err)
+	} else {
+		version := systemInfo.Version
+		if version == "" {
+			version = "unknown"
+		}
+		log.Printf("BlueZ version: %s", version)
+		for name, feature := range systemInfo.Features {
+			if !feature.Available {
+				log.Printf("- %s unavailable: %s", name, feature.Reason)
+			}
+		}
+	}
+	systemHandler := handlers.NewSystemHandler(systemInfo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The subsystems publish what happens on the event hub, which streams it to API clients,
+	// optionally forwards it to a webhook and MQTT, and feeds the notifiers
+	hub := events.NewHub()
+	btManager.SetPairingNotifier(func(eventType string, req bluetooth.PairingRequest) {
+		hub.Publish(eventType, req)
+	})
+	// The audit trail does not go through the hub, which drops the events of slow subscribers
+	auditLogger := audit.NewLogger(db)
+	auditDone := make(chan struct{})
+	go func() {
+		defer close(auditDone)
+		auditLogger.Run(ctx)
+	}()
+	eventRecorder := events.NewRecorder(500)
+	go eventRecorder.Run(ctx, hub)
+	if cfg.PluginDir != "" {
+		plugins, err := plugin.Discover(cfg.PluginDir)
+		if err != nil {
+			log.Fatalf("Failed to load plugins: %v", err)
+		}
+		log.Printf("Running %d plugin(s) from %s", len(plugins), cfg.PluginDir)
+		go plugin.NewHost(btManager, hub, plugins, cfg.ReadOnly).Run(ctx)
+	}
+	if cfg.HooksDir != "" {
+		go hooks.NewRunner(cfg.HooksDir, cfg.HookTimeout, cfg.HookConcurrency).Run(ctx, hub)
+	}
+
+	// The configuration is reloaded on SIGHUP and through the API, applying the settings which can
+	// change at runtime
+	reloader := config.NewReloader(cfg)
+	go reloader.Run(ctx)
+
+	// The webhook and MQTT forwarders run again with their new settings after a reload
+	runReloadable(ctx, reloader, cfg, func(cfg *config.Config) []interface{} {
+		return []interface{}{cfg.WebhookURL}
+	}, func(ctx context.Context, cfg *config.Config) {
+		if cfg.WebhookURL != "" {
+			events.NewWebhook(cfg.WebhookURL).Run(ctx, hub)
+		}
+	})
+	runReloadable(ctx, reloader, cfg, func(cfg *config.Config) []interface{} {
+		return []interface{}{cfg.MQTTURL, cfg.MQTTTopicPrefix}
+	}, func(ctx context.Context, cfg *config.Config) {
+		if cfg.MQTTURL != "" {
+			mqtt.NewBridge(cfg.MQTTURL, cfg.MQTTTopicPrefix).Run(ctx, hub)
+		}
+	})
+
+	// Push notifications to the browsers running the web UI when a VAPID subject is set
+	var webPushClient *webpush.Client
+	var webPushNotifier *notify.WebPush
+	if cfg.WebPushSubject != "" {
+		vapidKey, err := webpush.LoadOrCreateKey(cfg.WebPushKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load Web Push key: %v", err)
+		}
+		webPushClient = webpush.NewClient(vapidKey, cfg.WebPushSubject)
+		webPushNotifier = notify.NewWebPush(webPushClient, db, cipher)
+	}
+
+	// Push selected events to a phone through ntfy and/or Pushover, and to the subscribed browsers
+	alerter := notify.NewAlerter(alerterSettings(cfg, webPushNotifier))
+	reloader.OnReload(func(cfg *config.Config) {
+		alerter.Update(alerterSettings(cfg, webPushNotifier))
+	})
+	go alerter.Run(ctx, hub)
+
+	// Record battery levels of paired devices
+	go battery.NewRecorder(btManager, db, hub, cfg.BatterySampleInterval, cfg.BatteryLowThreshold).Run(ctx)
+
+	// Record RSSI of tracked devices
+	go rssi.NewRecorder(btManager, db, cfg.RSSISampleInterval).Run(ctx)
+
+	// Prune the battery and RSSI history past their retention and the expired sessions
+	pruner := retention.NewPruner(db, retention.Policy{
+		BatteryRetention:  cfg.BatteryRetention,
+		RSSIRetention:     cfg.RSSIRetention,
+		AuditRetention:    cfg.AuditRetention,
+		IdempotencyWindow: cfg.IdempotencyWindow,
+	}, cfg.PruneInterval)
+	go pruner.Run(ctx)
+
+	// Decode iBeacon and Eddystone advertisements
+	beaconScanner := beacon.NewScanner(btManager, hub, cfg.BeaconScanInterval, cfg.BeaconTimeout)
+	go beaconScanner.Run(ctx)
+
+	// Track home/away state of presence devices
+	presenceTracker := presence.NewTracker(btManager, db, hub, cfg.PresenceInterval, cfg.PresenceAwayTimeout)
+	go presenceTracker.Run(ctx)
+
+	// Replicate the trust of devices to the other adapters, following ADAPTER_SYNC
+	trustSyncer := trustsync.NewSyncer(btManager, db, cfg.AdapterSync)
+	if !cfg.ReadOnly {
+		go trustSyncer.Run(ctx, hub)
+	}
+
+	// Run the Starlark scripts of the automation rules on the events triggering them
+	automationEngine := automation.NewEngine(btManager, db, presenceTracker, cfg.ReadOnly)
+	go automationEngine.Run(ctx, hub)
+
+	// Apply the audio settings of devices when they connect
+	audioRouter := audio.NewRouter(db, audio.CLI{})
+	go audioRouter.Run(ctx, hub)
+
+	// Keep the PipeWire virtual nodes owned by the broker in the graph
+	virtualNodes := audio.NewVirtualNodes(db, audio.CLI{}, cfg.VirtualNodesInterval)
+	go virtualNodes.Run(ctx)
+
+	// Keep the AVRCP volume of the connected devices and the volume of their sink in sync
+	go audio.NewVolumeSync(btManager, audio.CLI{}, cfg.VolumeSyncInterval).Run(ctx, hub)
+
+	// Reconnect the devices having a profile reconnect sequence
+	reconnector := reconnect.NewReconnector(btManager, db, cfg.ReconnectInterval, cfg.ReconnectFailover, cfg.ReconnectResolveTimeout)
+	go reconnector.Run(ctx, hub)
+
+	// Disconnect the audio devices left idle for longer than their policy
+	go idle.NewWatchdog(btManager, db, cfg.IdleCheckInterval).Run(ctx, hub)
+
+	// Trust the devices paired during guest pairing windows and revoke their trust once it expires
+	go guestMode.Run(ctx, hub)
+
+	// Make the adapters discoverable during the windows of the discoverable schedules
+	discoverableScheduler := schedule.NewDiscoverableScheduler(btManager, db, visibility, cfg.ScheduleCheckInterval)
+	if !cfg.ReadOnly {
+		go discoverableScheduler.Run(ctx, hub)
+	}
+
+	// Power off the adapters during the QUIET_HOURS
+	var quietWindow *schedule.Window
+	if cfg.QuietHours != "" {
+		w, err := schedule.ParseQuietHours(cfg.QuietHours, cfg.QuietHoursDays)
+		if err != nil {
+			log.Fatalf("Invalid QUIET_HOURS: %v", err)
+		}
+		quietWindow = &w
+	}
+	quietHours := schedule.NewQuietHours(btManager, quietWindow, cfg.QuietHoursAdapters, cfg.ScheduleCheckInterval)
+	if !cfg.ReadOnly {
+		go quietHours.Run(ctx, hub)
+	}
+
+	// Optionally answer commands and forward pairing requests through a Telegram bot
+	runReloadable(ctx, reloader, cfg, func(cfg *config.Config) []interface{} {
+		return []interface{}{cfg.TelegramToken, cfg.TelegramChatIDs}
+	}, func(ctx context.Context, cfg *config.Config) {
+		if cfg.TelegramToken != "" {
+			telegram.NewBot(telegram.NewClient(cfg.TelegramToken), btManager, cfg.TelegramChatIDs, cfg.ReadOnly).Run(ctx, hub)
+		}
+	})
+
+	// Watch the D-Bus connection and the signal loop so a stalled event loop fails the deep liveness check
+	monitor := health.NewMonitor()
+	go monitor.Watch(ctx, "dbus", btManager, cfg.DBusPingInterval)
+
+	// BlueZ signals are shared by the subsystems reacting to device changes, only the D-Bus backend emits them
+	if dbusManager, ok := btManager.(*bluetooth.BluetoothManager); ok {
+		signalManager := signals.NewManager(dbusManager.Conn())
+		signalManager.SetMonitor(monitor, cfg.DBusPingInterval)
+		presenceChanges, unsubscribe := signalManager.SubscribeProperties()
+		defer unsubscribe()
+		go presenceTracker.Watch(ctx, presenceChanges)
+		go signalManager.PublishDeviceEvents(ctx, hub)
+		go func() {
+			if err := signalManager.Run(ctx); err != nil {
+				log.Printf("Failed to subscribe to BlueZ signals: %v", err)
+			}
+		}()
+	}
+
+	// Optionally export request metrics and Bluetooth gauges to StatsD
+	var statsdClient *statsd.Client
+	if cfg.StatsDHost != "" {
+		statsdClient, err = statsd.NewClient(net.JoinHostPort(cfg.StatsDHost, strconv.Itoa(cfg.StatsDPort)), cfg.StatsDPrefix)
+		if err != nil {
+			log.Fatalf("Failed to initialize StatsD exporter: %v", err)
+		}
+		defer statsdClient.Close()
+		go statsd.NewReporter(btManager, statsdClient, cfg.StatsDInterval).Run(ctx)
+	}
+
+	// Create Echo instance
+	e := echo.New()
+	// Use the TCP peer address as client IP so it cannot be spoofed through headers, unless it is
+	// a trusted reverse proxy
+	if e.IPExtractor, err = handlers.ClientIPExtractor(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	forwardedHeaders, err := handlers.ForwardedHeadersMiddleware(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+	e.Pre(forwardedHeaders)
+	e.Pre(handlers.BasePathMiddleware(cfg.BasePath))
+	// GET responses are served as MessagePack or YAML when the Accept header asks for them
+	e.JSONSerializer = handlers.NegotiatingSerializer{}
+
+	e.FileFS("/", "static/index.html", handlers.StaticFiles)
+	e.FileFS("/sw.js", "static/sw.js", handlers.StaticFiles)
+	e.FileFS("/manifest.webmanifest", "static/manifest.webmanifest", handlers.StaticFiles)
+
+	// Middleware
+	e.Use(middleware.RequestID())
+	e.Use(middleware.Logger())
+	e.Use(middleware.Recover())
+	corsOrigins := handlers.NewCORSOrigins(cfg.CORSAllowedOrigins)
+	reloader.OnReload(func(cfg *config.Config) {
+		corsOrigins.Set(cfg.CORSAllowedOrigins)
+	})
+	e.Use(corsOrigins.Middleware())
+	if statsdClient != nil {
+		e.Use(handlers.StatsDMiddleware(statsdClient))
+	}
+	e.Use(handlers.TokenStatsMiddleware(db))
+	e.Use(handlers.AuditMiddleware(auditLogger, hub))
+
+	allowlist, err := handlers.IPAllowlistMiddleware(cfg.AllowedCIDRs)
+	if err != nil {
+		log.Fatalf("Invalid ALLOWED_CIDRS: %v", err)
+	}
+	e.Use(allowlist)
+
+	var authCache *handlers.AuthCache
+	if cfg.AuthCacheTTL > 0 {
+		authCache = handlers.NewAuthCache(cfg.AuthCacheTTL)
+	}
+
+	// Clients failing to authenticate too many times in a row are locked out for a while
+	lockoutTracker := lockout.NewTracker(cfg.AuthLockoutThreshold, cfg.AuthLockoutDuration, cfg.AuthLockoutMax, hub, auditLogger)
+	reloader.OnReload(func(cfg *config.Config) {
+		lockoutTracker.Configure(cfg.AuthLockoutThreshold, cfg.AuthLockoutDuration, cfg.AuthLockoutMax)
+	})
+
+	h := handlers.NewHandler(db, cipher)
+	h.SetMonitor(monitor)
+	h.SetAuthCache(authCache)
+	h.SetLockout(lockoutTracker)
+
+	// Health check endpoints
+	e.GET("/readyz", h.Readiness)
+	e.GET("/livez", h.Liveness)
+
+	// API routes
+	api := e.Group("/api/v1")
+	if cfg.ReadOnly {
+		log.Printf("Read-only mode enabled, mutating endpoints are disabled")
+		api.Use(handlers.ReadOnlyMiddleware)
+	}
+	authenticate := handlers.AuthMiddlewareWithOptions(db, cipher, handlers.AuthOptions{Cache: authCache, Lockout: lockoutTracker, Events: hub})
+	idempotency := handlers.IdempotencyMiddleware(db, cfg.IdempotencyWindow)
+	quota := handlers.QuotaMiddleware(db)
+	// Authenticated requests count against the quota of their token, except for replayed retries
+	auth := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return authenticate(idempotency(quota(next)))
+	}
+
+	authGroup := api.Group("/auth")
+	authGroup.POST("/login", h.Login)
+	authGroup.POST("/logout", h.Logout)
+	authGroup.GET("/session", h.Session)
+
+	tokenGroup := api.Group("/tokens", auth, handlers.AdminMiddleware)
+	tokenGroup.POST("", h.CreateToken)
+	tokenGroup.GET("", h.GetTokens)
+	tokenGroup.GET("/revoked", h.GetRevokedTokens)
+	tokenGroup.POST("/revoked/:username/restore", h.RestoreToken)
+	tokenGroup.GET("/:username", h.GetToken)
+	tokenGroup.GET("/:username/stats", h.GetTokenStats)
+	tokenGroup.GET("/:username/quota", h.GetTokenQuota)
+	tokenGroup.PUT("/:username/quota", h.SetTokenQuota)
+	tokenGroup.DELETE("/:username", h.DeleteToken)
+
+	adminGroup := api.Group("/admin", auth, handlers.AdminMiddleware)
+	adminGroup.POST("/encryption/rotate", h.RotateEncryptionKey)
+	adminGroup.POST("/config/reload", handlers.NewConfigReloadHandler(reloader).Reload)
+	adminGroup.POST("/prune", handlers.NewPruneHandler(pruner).Prune)
+	adminGroup.GET("/diagnostics", handlers.NewDiagnosticsHandler(diagnostics.NewBundle(btManager, cfg, eventRecorder, logRing)).GetDiagnostics)
+	adminGroup.GET("/bluetoothd/journal", handlers.NewJournalHandler(bluez.Journalctl{Unit: bluez.BluetoothdUnit}).StreamBluetoothd)
+
+	api.GET("/audit", h.GetAuditLog, auth, handlers.AdminMiddleware)
+	api.GET("/system/info", systemHandler.GetInfo, auth)
+	api.GET("/users/:username/export", h.ExportUser, auth)
+
+	// Disconnecting and removing a device may be restricted to the user who paired it
+	var ownerOnly []echo.MiddlewareFunc
+	if cfg.DeviceOwnerOnly {
+		ownerOnly = append(ownerOnly, handlers.DeviceOwnerMiddleware(db, cipher))
+	}
+
+	bluetoothGroup := api.Group("/bluetooth", auth)
+	bluetoothGroup.GET("/adapters", btHandler.GetAdapters, handlers.ETagMiddleware)
+	bluetoothGroup.GET("/adapters/:adapter/uuids", btHandler.GetAdapterUUIDs)
+	bluetoothGroup.GET("/pairing-requests", btHandler.GetPairingRequests)
+	bluetoothGroup.POST("/pairing-requests/:id/accept", btHandler.AcceptPairingRequest)
+	bluetoothGroup.POST("/pairing-requests/:id/reject", btHandler.RejectPairingRequest)
+	bluetoothGroup.GET("/pairing/ws", handlers.NewPairingSocketHandler(btManager, hub).Serve)
+	guestHandler := handlers.NewGuestHandler(guestMode, hub)
+	bluetoothGroup.GET("/guest-mode", guestHandler.GetGuestMode)
+	// Opening a window auto-trusts whatever pairs during it
+	bluetoothGroup.POST("/guest-mode", guestHandler.StartGuestMode, handlers.AdminMiddleware)
+	bluetoothGroup.DELETE("/guest-mode", guestHandler.StopGuestMode, handlers.AdminMiddleware)
+	bluetoothGroup.GET("/pairing-qr", handlers.NewPairingQRHandler(btManager, db, cfg.PublicURL).GetPairingQR)
+	knownDevicesHandler := handlers.NewKnownDevicesHandler(db, cipher, cfg.BlueZStorageDir)
+	bluetoothGroup.GET("/known-devices", knownDevicesHandler.GetKnownDevices)
+	bluetoothGroup.POST("/known-devices/import", knownDevicesHandler.ImportKnownDevices, handlers.AdminMiddleware)
+	pairingAllowlistHandler := handlers.NewPairingAllowlistHandler(db, cipher)
+	pairingAllowlistGroup := bluetoothGroup.Group("/pairing-allowlist", handlers.AdminMiddleware)
+	pairingAllowlistGroup.GET("", pairingAllowlistHandler.GetEntries)
+	pairingAllowlistGroup.POST("", pairingAllowlistHandler.AddEntry)
+	pairingAllowlistGroup.DELETE("/:mac", pairingAllowlistHandler.DeleteEntry)
+	bluetoothGroup.POST("/adapters/:adapter/reset", btHandler.ResetAdapter, handlers.AdminMiddleware)
+	bluetoothGroup.POST("/adapters/:adapter/power-cycle", btHandler.PowerCycleAdapter, handlers.AdminMiddleware)
+	bluetoothGroup.POST("/adapters/:adapter/rfkill/unblock", btHandler.UnblockAdapter, handlers.AdminMiddleware)
+	bluetoothGroup.PATCH("/adapters/:adapter/discoverable", btHandler.SetDiscoverable)
+	bluetoothGroup.PATCH("/adapters/:adapter/discovering", btHandler.SetDiscovering)
+	requireBroadcast := systemHandler.RequireFeature(bluetooth.FeatureLEAudioBroadcast)
+	bluetoothGroup.GET("/adapters/:adapter/broadcasts", btHandler.GetBroadcasts, requireBroadcast)
+	bluetoothGroup.POST("/adapters/:adapter/broadcasts/:mac/join", btHandler.JoinBroadcast, requireBroadcast)
+	bluetoothGroup.POST("/adapters/:adapter/broadcasts/:mac/leave", btHandler.LeaveBroadcast, requireBroadcast)
+	requireLEAudio := systemHandler.RequireFeature(bluetooth.FeatureLEAudio)
+	bluetoothGroup.GET("/adapters/:adapter/sets", btHandler.GetDeviceSets, requireLEAudio)
+	bluetoothGroup.POST("/adapters/:adapter/sets/:set/connect", btHandler.ConnectDeviceSet, requireLEAudio)
+	bluetoothGroup.PATCH("/adapters/:adapter/sets/:set/volume", btHandler.SetDeviceSetVolume, requireLEAudio)
+	bluetoothGroup.GET("/adapters/:adapter/devices", btHandler.GetDevices, handlers.ETagMiddleware)
+	bluetoothGroup.GET("/adapters/:adapter/devices/nearby", btHandler.GetNearbyDevices)
+	bluetoothGroup.GET("/adapters/:adapter/devices/trusted", btHandler.GetTrustedDevices, handlers.ETagMiddleware)
+	bluetoothGroup.GET("/adapters/:adapter/devices/connected", btHandler.GetConnectedDevices, handlers.ETagMiddleware)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/pair", btHandler.PairDevice)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/pair/cancel", btHandler.CancelPairing)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/connect", btHandler.ConnectDevice)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/disconnect", btHandler.DisconnectDevice, ownerOnly...)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/trust", btHandler.TrustDevice)
+	trustSyncHandler := handlers.NewTrustSyncHandler(btManager, trustSyncer)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/sync", trustSyncHandler.Sync)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/migrate", trustSyncHandler.Migrate, ownerOnly...)
+	bluetoothGroup.PATCH("/adapters/:adapter/devices/:mac/wake-allowed", btHandler.SetWakeAllowed)
+	bluetoothGroup.PATCH("/adapters/:adapter/devices/:mac/volume", btHandler.SetVolume)
+	bluetoothGroup.GET("/adapters/:adapter/devices/:mac/media/track", btHandler.GetTrack)
+	bluetoothGroup.GET("/adapters/:adapter/devices/:mac/link", btHandler.GetLinkInfo)
+	bluetoothGroup.GET("/adapters/:adapter/devices/:mac/wait", handlers.NewDeviceWaitHandler(btManager, hub).WaitDevice)
+	bluetoothGroup.DELETE("/adapters/:adapter/devices/:mac", btHandler.RemoveDevice, ownerOnly...)
+	bluetoothGroup.GET("/adapters/:adapter/devices/:mac/battery/history", btHandler.GetBatteryHistory, systemHandler.RequireFeature(bluetooth.FeatureBattery))
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/rssi/tracking", btHandler.TrackRSSI)
+	bluetoothGroup.DELETE("/adapters/:adapter/devices/:mac/rssi/tracking", btHandler.UntrackRSSI)
+	bluetoothGroup.GET("/adapters/:adapter/devices/:mac/rssi/history", btHandler.GetRSSIHistory)
+	audioHandler := handlers.NewAudioHandler(btManager, db, wpConfigManager, audioRouter)
+	bluetoothGroup.GET("/adapters/:adapter/devices/:mac/audio", audioHandler.GetSettings)
+	bluetoothGroup.PUT("/adapters/:adapter/devices/:mac/audio", audioHandler.SetSettings)
+	bluetoothGroup.DELETE("/adapters/:adapter/devices/:mac/audio", audioHandler.DeleteSettings)
+	bluetoothGroup.PATCH("/adapters/:adapter/devices/:mac/audio/latency", audioHandler.SetLatency)
+	bluetoothGroup.GET("/adapters/:adapter/devices/:mac/audio/codec", audioHandler.GetCodec)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/audio/codec/renegotiate", audioHandler.RenegotiateCodec)
+	reconnectHandler := handlers.NewReconnectHandler(btManager, db, reconnector)
+	bluetoothGroup.GET("/adapters/:adapter/devices/:mac/reconnect", reconnectHandler.GetReconnect)
+	bluetoothGroup.PUT("/adapters/:adapter/devices/:mac/reconnect", reconnectHandler.SetReconnect)
+	bluetoothGroup.DELETE("/adapters/:adapter/devices/:mac/reconnect", reconnectHandler.DeleteReconnect)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/reconnect/run", reconnectHandler.RunReconnect)
+	idleHandler := handlers.NewIdleHandler(db)
+	bluetoothGroup.GET("/idle-policies", idleHandler.GetIdlePolicies)
+	bluetoothGroup.PUT("/idle-policies/:target", idleHandler.SetIdlePolicy)
+	bluetoothGroup.DELETE("/idle-policies/:target", idleHandler.DeleteIdlePolicy)
+	callsHandler := handlers.NewCallsHandler(btManager, hfp.NewOfono())
+	bluetoothGroup.GET("/adapters/:adapter/devices/:mac/calls", callsHandler.GetCalls)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/calls", callsHandler.Dial)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/calls/answer", callsHandler.Answer)
+	bluetoothGroup.POST("/adapters/:adapter/devices/:mac/calls/hangup", callsHandler.HangUp)
+	api.GET("/audio/devices", audioHandler.GetAllSettings, auth)
+	api.GET("/audio/config/diff", audioHandler.GetConfigDiff, auth, handlers.AdminMiddleware)
+	virtualNodesHandler := handlers.NewVirtualNodesHandler(virtualNodes, db)
+	virtualNodesGroup := api.Group("/audio/virtual-nodes", auth)
+	virtualNodesGroup.GET("", virtualNodesHandler.GetNodes)
+	virtualNodesGroup.POST("", virtualNodesHandler.CreateNode)
+	virtualNodesGroup.DELETE("/:name", virtualNodesHandler.DeleteNode)
+
+	beaconsHandler := handlers.NewBeaconsHandler(beaconScanner)
+	api.GET("/beacons", beaconsHandler.GetBeacons, auth)
+
+	presenceHandler := handlers.NewPresenceHandler(presenceTracker, db)
+	presenceGroup := api.Group("/presence", auth)
+	presenceGroup.GET("", presenceHandler.GetPresence)
+	presenceGroup.GET("/:mac", presenceHandler.GetDevicePresence)
+	presenceGroup.POST("/devices", presenceHandler.CreateDevice)
+	presenceGroup.DELETE("/devices/:mac", presenceHandler.DeleteDevice)
+
+	homeAssistantHandler := handlers.NewHomeAssistantHandler(btManager, presenceTracker, db)
+	haGroup := api.Group("/ha", auth)
+	haGroup.GET("/state", homeAssistantHandler.GetState)
+	haTokenGroup := haGroup.Group("/tokens", handlers.AdminMiddleware)
+	haTokenGroup.GET("", homeAssistantHandler.GetTokens)
+	haTokenGroup.POST("", homeAssistantHandler.CreateToken)
+	haTokenGroup.DELETE("/:id", homeAssistantHandler.DeleteToken)
+
+	automationsHandler := handlers.NewAutomationsHandler(db, automationEngine)
+	automationsGroup := api.Group("/automations", auth, handlers.AdminMiddleware)
+	automationsGroup.GET("", automationsHandler.GetRules)
+	automationsGroup.POST("", automationsHandler.CreateRule)
+	automationsGroup.GET("/:id", automationsHandler.GetRule)
+	automationsGroup.PUT("/:id", automationsHandler.UpdateRule)
+	automationsGroup.DELETE("/:id", automationsHandler.DeleteRule)
+
+	schedulesHandler := handlers.NewSchedulesHandler(db, discoverableScheduler, quietHours, hub)
+	schedulesGroup := api.Group("/schedules", auth, handlers.AdminMiddleware)
+	schedulesGroup.GET("/discoverable", schedulesHandler.GetDiscoverableSchedules)
+	schedulesGroup.POST("/discoverable", schedulesHandler.CreateDiscoverableSchedule)
+	schedulesGroup.GET("/discoverable/:id", schedulesHandler.GetDiscoverableSchedule)
+	schedulesGroup.PUT("/discoverable/:id", schedulesHandler.UpdateDiscoverableSchedule)
+	schedulesGroup.DELETE("/discoverable/:id", schedulesHandler.DeleteDiscoverableSchedule)
+	schedulesGroup.GET("/quiet-hours", schedulesHandler.GetQuietHours)
+	schedulesGroup.POST("/quiet-hours/override", schedulesHandler.OverrideQuietHours)
+	schedulesGroup.DELETE("/quiet-hours/override", schedulesHandler.ClearQuietHoursOverride)
+
+	webPushHandler := handlers.NewWebPushHandler(db, cipher, webPushClient)
+	pushGroup := api.Group("/push", auth)
+	pushGroup.GET("/vapid-public-key", webPushHandler.GetPublicKey)
+	pushGroup.GET("/subscriptions", webPushHandler.GetSubscriptions)
+	pushGroup.POST("/subscriptions", webPushHandler.Subscribe)
+	pushGroup.DELETE("/subscriptions/:id", webPushHandler.Unsubscribe)
+
+	eventsHandler := handlers.NewEventsHandler(hub)
+	api.GET("/events", eventsHandler.Stream, auth)
+
+	api.POST("/batch", handlers.NewBatchHandler(e, h).Batch, auth)
+
+	// Shut down gracefully on SIGINT and SIGTERM, letting the requests in flight complete
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		<-stop
+		log.Printf("Shutting down")
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancelShutdown()
+		if err := e.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Closing the requests still in flight: %v", err)
+			e.Close()
+		}
+	}()
+
+	// Start server
+	log.Printf("Starting server on port %s", cfg.Port)
+	if cfg.TLSCertFile != "" {
+		err = e.StartTLS(":"+cfg.Port, cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = e.Start(":" + cfg.Port)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+	<-shutdownDone
+
+	// Store the audit entries of the last requests
+	cancel()
+	<-auditDone
+
+	if cfg.AudioConfigCleanup {
+		if err := wpConfigManager.Cleanup(); err != nil {
+			log.Printf("Warning: Failed to remove the %s configuration: %v", wpConfigManager.Stack(), err)
+		}
+	}
+	return nil
+}
+
+// alerterSettings returns the notifiers and the notified events of a configuration, along with the
+// Web Push notifier when it is enabled
+func alerterSettings(cfg *config.Config, webPush *notify.WebPush) ([]notify.Notifier, []string) {
+	var notifiers []notify.Notifier
+	if webPush != nil {
+		notifiers = append(notifiers, webPush)
+	}
+	if cfg.NtfyURL != "" {
+		notifiers = append(notifiers, notify.NewNtfy(cfg.NtfyURL, cfg.NtfyToken))
+	}
+	if cfg.PushoverToken != "" {
+		notifiers = append(notifiers, notify.NewPushover(cfg.PushoverToken, cfg.PushoverUser))
+	}
+
+	notifyEvents := cfg.NotifyEvents
+	if len(notifyEvents) == 0 {
+		notifyEvents = notify.DefaultEvents
+	}
+	return notifiers, notifyEvents
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+	"github.com/spf13/cobra"
+)
+
+// tokenRevokedBy is recorded as the revoker of the tokens deleted from the command line
+const tokenRevokedBy = "cli"
+
+// newTokenCommand returns the command managing the API tokens directly in the database
+func newTokenCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage the API tokens",
+	}
+
+	var isAdmin bool
+	var value string
+	create := &cobra.Command{
+		Use:   "create <username>",
+		Short: "Create a token, random unless given",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return tokenCreate(args[0], value, isAdmin)
+		},
+	}
+	create.Flags().BoolVar(&isAdmin, "admin", false, "Grant the token administration rights")
+	create.Flags().StringVar(&value, "token", "", "Token value (default: randomly generated)")
+
+	cmd.AddCommand(create, &cobra.Command{
+		Use:   "list",
+		Short: "List the tokens which are not revoked",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return tokenList()
+		},
+	}, &cobra.Command{
+		Use:   "delete <username>",
+		Short: "Revoke the token of a username",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return tokenDelete(args[0])
+		},
+	})
+	return cmd
+}
+
+func tokenCreate(username, value string, isAdmin bool) error {
+	db, cfg, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	cipher, err := secrets.Load(cfg.EncryptionKey, cfg.EncryptionKeyFile)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		if value, err = database.GenerateToken(); err != nil {
+			return err
+		}
+	}
+	if err := database.CreateToken(db, cipher, username, value, isAdmin); err != nil {
+		return err
+	}
+
+	fmt.Printf("Created token for %q: %s\n", username, value)
+	return nil
+}
+
+func tokenList() error {
+	db, _, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tokens, err := database.ListTokens(db)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tADMIN\tCREATED\tLAST USED\tLAST IP")
+	for _, t := range tokens {
+		lastUsed, lastIP := "never", "-"
+		if t.LastUsedAt != nil {
+			lastUsed = t.LastUsedAt.Local().Format(time.DateTime)
+		}
+		if t.LastIP != nil {
+			lastIP = *t.LastIP
+		}
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\n", t.Username, t.IsAdmin, t.CreatedAt.Local().Format(time.DateTime), lastUsed, lastIP)
+	}
+	return w.Flush()
+}
+
+func tokenDelete(username string) error {
+	db, _, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := database.RevokeToken(db, username, tokenRevokedBy); err != nil {
+		return err
+	}
+	fmt.Printf("Revoked token of %q\n", username)
+	return nil
+}
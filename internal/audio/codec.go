@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// a2dpProfilePrefix prefixes the A2DP profiles the PipeWire BlueZ monitor creates for every codec a device supports
+const a2dpProfilePrefix = "a2dp-sink-"
+
+var (
+	ErrNoCodecPreference = errors.New("device has no codec preference")
+	ErrCodecUnsupported  = errors.New("device supports none of the preferred codecs")
+)
+
+// CodecStatus reports the codec negotiated with a device and the codecs it supports
+type CodecStatus struct {
+	// Codec is empty while the device has no audio stream, e.g. when its profile is off
+	Codec     string   `json:"codec"`
+	Profile   string   `json:"profile"`
+	Available []string `json:"available"`
+	Preferred []string `json:"preferred"`
+}
+
+// ValidateCodecs checks a codec preference order
+func ValidateCodecs(codecs []string) error {
+	for i, codec := range codecs {
+		if !slices.Contains(Codecs, codec) {
+			return fmt.Errorf("unknown codec %q, expected one of %v", codec, Codecs)
+		}
+		if slices.Contains(codecs[:i], codec) {
+			return fmt.Errorf("codec %q is listed twice", codec)
+		}
+	}
+	return nil
+}
+
+// CodecStatus returns the codec negotiated with a connected device
+func (r *Router) CodecStatus(ctx context.Context, address string) (*CodecStatus, error) {
+	device, err := r.pipewire.Device(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &CodecStatus{
+		Codec:     device.Codec,
+		Profile:   device.Profile,
+		Available: availableCodecs(device.Profiles),
+		Preferred: []string{},
+	}
+
+	settings, err := database.GetDeviceAudioSettings(r.db, address)
+	if err != nil {
+		return nil, err
+	}
+	if settings != nil {
+		status.Preferred = settings.Codecs
+	}
+	return status, nil
+}
+
+// Renegotiate switches a connected device to its most preferred supported codec, cycling through the off
+// profile when it already uses it so the device negotiates the codec again
+func (r *Router) Renegotiate(ctx context.Context, address string) (string, error) {
+	settings, err := database.GetDeviceAudioSettings(r.db, address)
+	if err != nil {
+		return "", err
+	}
+	if settings == nil || len(settings.Codecs) == 0 {
+		return "", ErrNoCodecPreference
+	}
+	return r.applyCodec(ctx, address, settings.Codecs, true)
+}
+
+// applyCodec activates the A2DP profile of the most preferred codec supported by a device and returns the codec
+func (r *Router) applyCodec(ctx context.Context, address string, codecs []string, force bool) (string, error) {
+	device, err := r.pipewire.Device(ctx, address)
+	if err != nil {
+		return "", err
+	}
+
+	codec, target, ok := preferredProfile(codecs, device.Profiles)
+	if !ok {
+		return "", fmt.Errorf("%w: it supports %v", ErrCodecUnsupported, availableCodecs(device.Profiles))
+	}
+
+	if device.Profile == target.Name {
+		if !force {
+			return codec, nil
+		}
+		if off, ok := findProfile(device.Profiles, "off"); ok {
+			if err := r.pipewire.SetProfile(ctx, device.ID, off.Index); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	if err := r.pipewire.SetProfile(ctx, device.ID, target.Index); err != nil {
+		return "", err
+	}
+	log.Printf("Audio: %s switched to the %s codec", address, codec)
+	return codec, nil
+}
+
+// preferredProfile returns the A2DP profile of the first preferred codec a device supports
+func preferredProfile(codecs []string, profiles []Profile) (string, Profile, bool) {
+	for _, codec := range codecs {
+		if profile, ok := findProfile(profiles, a2dpProfilePrefix+codec); ok {
+			return codec, profile, true
+		}
+	}
+	return "", Profile{}, false
+}
+
+func findProfile(profiles []Profile, name string) (Profile, bool) {
+	for _, profile := range profiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return Profile{}, false
+}
+
+// availableCodecs returns the codecs a device supports from its A2DP profiles
+func availableCodecs(profiles []Profile) []string {
+	codecs := []string{}
+	for _, profile := range profiles {
+		if codec, ok := strings.CutPrefix(profile.Name, a2dpProfilePrefix); ok {
+			codecs = append(codecs, codec)
+		}
+	}
+	return codecs
+}
@@ -0,0 +1,115 @@
+package audio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+var headphonesProfiles = []Profile{
+	{Index: 0, Name: "off"},
+	{Index: 1, Name: "a2dp-sink-sbc"},
+	{Index: 2, Name: "a2dp-sink-sbc_xq"},
+	{Index: 3, Name: "a2dp-sink-aac"},
+	{Index: 4, Name: "a2dp-sink-ldac"},
+	{Index: 5, Name: "headset-head-unit"},
+}
+
+func TestRouter_Renegotiate(t *testing.T) {
+	tests := []struct {
+		name             string
+		codecs           string
+		current          string
+		expectedCodec    string
+		expectedProfiles []int
+		expectedError    error
+	}{
+		{
+			name:             "first supported codec is selected",
+			codecs:           "aptx_hd,ldac,aac",
+			current:          "a2dp-sink-sbc",
+			expectedCodec:    "ldac",
+			expectedProfiles: []int{4},
+		},
+		{
+			name:             "current codec cycles through the off profile",
+			codecs:           "aac",
+			current:          "a2dp-sink-aac",
+			expectedCodec:    "aac",
+			expectedProfiles: []int{0, 3},
+		},
+		{
+			name:          "no supported codec",
+			codecs:        "aptx,aptx_hd",
+			current:       "a2dp-sink-sbc",
+			expectedError: ErrCodecUnsupported,
+		},
+		{
+			name:          "no codec preference",
+			codecs:        "",
+			expectedError: ErrNoCodecPreference,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			dbMock.ExpectQuery("FROM device_audio_settings WHERE address = ?").
+				WithArgs("AA:BB:CC:DD:EE:FF").
+				WillReturnRows(sqlmock.NewRows(settingsColumns).AddRow("AA:BB:CC:DD:EE:FF", tt.codecs, 0, "", false, true, "", "", 0, 0, time.Now()))
+
+			pipewire := &fakePipeWire{device: &Device{ID: 55, Profile: tt.current, Profiles: headphonesProfiles}}
+			codec, err := NewRouter(db, pipewire).Renegotiate(context.Background(), "AA:BB:CC:DD:EE:FF")
+
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedCodec, codec)
+			assert.Equal(t, tt.expectedProfiles, pipewire.profiles)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRouter_Apply_KeepsForcedHeadsetProfile(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	dbMock.ExpectQuery("FROM device_audio_settings WHERE address = ?").
+		WithArgs("AA:BB:CC:DD:EE:FF").
+		WillReturnRows(sqlmock.NewRows(settingsColumns).AddRow("AA:BB:CC:DD:EE:FF", "ldac", 0, "", false, true, ProfileHeadsetHeadUnit, "", 0, 0, time.Now()))
+
+	pipewire := &fakePipeWire{device: &Device{ID: 55, Profile: ProfileHeadsetHeadUnit, Profiles: headphonesProfiles}}
+	assert.NoError(t, NewRouter(db, pipewire).Apply(context.Background(), "AA:BB:CC:DD:EE:FF"))
+	assert.Empty(t, pipewire.profiles)
+}
+
+func TestFindBluetoothDevice(t *testing.T) {
+	dump := []byte(`[
+		{"id": 55, "type": "PipeWire:Interface:Device", "info": {
+			"props": {"api.bluez5.address": "AA:BB:CC:DD:EE:FF", "device.name": "bluez_card.AA_BB_CC_DD_EE_FF"},
+			"params": {
+				"EnumProfile": [{"index": 0, "name": "off"}, {"index": 1, "name": "a2dp-sink-sbc"}, {"index": 4, "name": "a2dp-sink-ldac"}],
+				"Profile": [{"index": 4, "name": "a2dp-sink-ldac"}]
+			}
+		}},
+		{"id": 60, "type": "PipeWire:Interface:Node", "info": {"props": {"api.bluez5.address": "AA:BB:CC:DD:EE:FF", "api.bluez5.codec": "ldac"}}}
+	]`)
+
+	device, err := findBluetoothDevice(dump, "aa:bb:cc:dd:ee:ff")
+	assert.NoError(t, err)
+	assert.Equal(t, 55, device.ID)
+	assert.Equal(t, "a2dp-sink-ldac", device.Profile)
+	assert.Equal(t, "ldac", device.Codec)
+	assert.Equal(t, []string{"sbc", "ldac"}, availableCodecs(device.Profiles))
+
+	_, err = findBluetoothDevice(dump, "11:22:33:44:55:66")
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+}
@@ -0,0 +1,291 @@
+package audio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// ErrNodeNotFound is returned when PipeWire has no node for a device, e.g. while its profile is being set up
+var ErrNodeNotFound = errors.New("no PipeWire node for the device")
+
+// PipeWire controls the PipeWire graph of the session the broker runs in
+type PipeWire interface {
+	// SetDefaultSink makes the sink of a Bluetooth device the default audio output
+	SetDefaultSink(ctx context.Context, address string) error
+	// Nodes returns the IDs of the nodes by name
+	Nodes(ctx context.Context) (map[string]int, error)
+	// CreateNullSink creates a sink discarding its input which outlives the command creating it
+	CreateNullSink(ctx context.Context, node database.VirtualNode) error
+	// DestroyNode destroys a node
+	DestroyNode(ctx context.Context, id int) error
+	// RunLoopback runs a loopback sink playing to its target until the context is cancelled or PipeWire stops
+	RunLoopback(ctx context.Context, node database.VirtualNode) error
+	// Device returns the PipeWire device of a Bluetooth device
+	Device(ctx context.Context, address string) (*Device, error)
+	// SetProfile activates a profile of a PipeWire device
+	SetProfile(ctx context.Context, deviceID, index int) error
+	// SinkVolume returns the volume of the sink of a Bluetooth device, in percent
+	SinkVolume(ctx context.Context, address string) (uint8, error)
+	// SetSinkVolume sets the volume of the sink of a Bluetooth device, in percent
+	SetSinkVolume(ctx context.Context, address string, percent uint8) error
+}
+
+// Device is the PipeWire device created by the BlueZ monitor for a Bluetooth device
+type Device struct {
+	ID       int
+	Profile  string
+	Profiles []Profile
+	// Codec is the codec negotiated by the nodes of the device, empty while it has none
+	Codec string
+}
+
+// Profile is a profile of a PipeWire device
+type Profile struct {
+	Index int    `json:"index"`
+	Name  string `json:"name"`
+}
+
+// CLI drives PipeWire through the pw-dump and wpctl commands
+type CLI struct{}
+
+// SetDefaultSink makes the sink of a Bluetooth device the default audio output
+func (CLI) SetDefaultSink(ctx context.Context, address string) error {
+	dump, err := exec.CommandContext(ctx, "pw-dump").Output()
+	if err != nil {
+		return fmt.Errorf("pw-dump failed: %w", err)
+	}
+
+	id, err := findBluetoothNode(dump, address, "Audio/Sink")
+	if err != nil {
+		return err
+	}
+
+	if out, err := exec.CommandContext(ctx, "wpctl", "set-default", strconv.Itoa(id)).CombinedOutput(); err != nil {
+		return fmt.Errorf("wpctl set-default failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Nodes returns the IDs of the nodes by name
+func (CLI) Nodes(ctx context.Context) (map[string]int, error) {
+	dump, err := exec.CommandContext(ctx, "pw-dump").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pw-dump failed: %w", err)
+	}
+	return nodeIDs(dump)
+}
+
+// CreateNullSink creates a sink discarding its input, object.linger keeps it after pw-cli exits
+func (CLI) CreateNullSink(ctx context.Context, node database.VirtualNode) error {
+	props := fmt.Sprintf("{ factory.name = support.null-audio-sink node.name = %q node.description = %q "+
+		"media.class = Audio/Sink object.linger = true audio.channels = %d audio.position = %s }",
+		node.Name, description(node), node.Channels, channelPositions(node.Channels))
+	if out, err := exec.CommandContext(ctx, "pw-cli", "create-node", "adapter", props).CombinedOutput(); err != nil {
+		return fmt.Errorf("pw-cli create-node failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// DestroyNode destroys a node
+func (CLI) DestroyNode(ctx context.Context, id int) error {
+	if out, err := exec.CommandContext(ctx, "pw-cli", "destroy", strconv.Itoa(id)).CombinedOutput(); err != nil {
+		return fmt.Errorf("pw-cli destroy failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// RunLoopback runs pw-loopback, whose sink side is named after the node. Loopback modules only live as
+// long as the client which loaded them, so the process must keep running.
+func (CLI) RunLoopback(ctx context.Context, node database.VirtualNode) error {
+	args := []string{
+		"--channels", strconv.Itoa(node.Channels),
+		"--capture-props", fmt.Sprintf("node.name=%q node.description=%q media.class=Audio/Sink audio.position=%s",
+			node.Name, description(node), channelPositions(node.Channels)),
+		"--playback-props", fmt.Sprintf("node.name=%q node.passive=true", node.Name+".output"),
+	}
+	if node.Target != "" {
+		args = append(args, "--playback", node.Target)
+	}
+
+	if out, err := exec.CommandContext(ctx, "pw-loopback", args...).CombinedOutput(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("pw-loopback failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Device returns the PipeWire device of a Bluetooth device
+func (CLI) Device(ctx context.Context, address string) (*Device, error) {
+	dump, err := exec.CommandContext(ctx, "pw-dump").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pw-dump failed: %w", err)
+	}
+	return findBluetoothDevice(dump, address)
+}
+
+// SetProfile activates a profile of a PipeWire device
+func (CLI) SetProfile(ctx context.Context, deviceID, index int) error {
+	if out, err := exec.CommandContext(ctx, "wpctl", "set-profile", strconv.Itoa(deviceID), strconv.Itoa(index)).CombinedOutput(); err != nil {
+		return fmt.Errorf("wpctl set-profile failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// SinkVolume returns the volume of the sink of a Bluetooth device, in percent
+func (CLI) SinkVolume(ctx context.Context, address string) (uint8, error) {
+	id, err := bluetoothSink(ctx, address)
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := exec.CommandContext(ctx, "wpctl", "get-volume", strconv.Itoa(id)).Output()
+	if err != nil {
+		return 0, fmt.Errorf("wpctl get-volume failed: %w", err)
+	}
+	return parseVolume(string(out))
+}
+
+// SetSinkVolume sets the volume of the sink of a Bluetooth device, in percent
+func (CLI) SetSinkVolume(ctx context.Context, address string, percent uint8) error {
+	id, err := bluetoothSink(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	volume := strconv.FormatFloat(float64(min(percent, 100))/100, 'f', 2, 64)
+	if out, err := exec.CommandContext(ctx, "wpctl", "set-volume", strconv.Itoa(id), volume).CombinedOutput(); err != nil {
+		return fmt.Errorf("wpctl set-volume failed: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// bluetoothSink returns the ID of the sink node of a Bluetooth device
+func bluetoothSink(ctx context.Context, address string) (int, error) {
+	dump, err := exec.CommandContext(ctx, "pw-dump").Output()
+	if err != nil {
+		return 0, fmt.Errorf("pw-dump failed: %w", err)
+	}
+	return findBluetoothNode(dump, address, "Audio/Sink")
+}
+
+// parseVolume parses the output of wpctl get-volume, e.g. "Volume: 0.40 [MUTED]", into a percentage
+func parseVolume(out string) (uint8, error) {
+	fields := strings.Fields(out)
+	if len(fields) < 2 || fields[0] != "Volume:" {
+		return 0, fmt.Errorf("unexpected wpctl get-volume output %q", strings.TrimSpace(out))
+	}
+	volume, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected wpctl get-volume output %q: %w", strings.TrimSpace(out), err)
+	}
+	// Software volume may be raised above 100%, which the AVRCP volume cannot represent
+	return uint8(math.Round(math.Min(math.Max(volume, 0), 1) * 100)), nil
+}
+
+func description(node database.VirtualNode) string {
+	if node.Description != "" {
+		return node.Description
+	}
+	return node.Name
+}
+
+func channelPositions(channels int) string {
+	if channels == 1 {
+		return "[ MONO ]"
+	}
+	return "[ FL FR ]"
+}
+
+// pwObject is the part of a pw-dump object used to find the nodes of a device
+type pwObject struct {
+	ID   int    `json:"id"`
+	Type string `json:"type"`
+	Info struct {
+		Props  map[string]interface{} `json:"props"`
+		Params struct {
+			EnumProfile []Profile `json:"EnumProfile"`
+			Profile     []Profile `json:"Profile"`
+		} `json:"params"`
+	} `json:"info"`
+}
+
+// nodeIDs returns the IDs of the nodes of a pw-dump output by name
+func nodeIDs(dump []byte) (map[string]int, error) {
+	var objects []pwObject
+	if err := json.Unmarshal(dump, &objects); err != nil {
+		return nil, fmt.Errorf("failed to decode pw-dump output: %w", err)
+	}
+
+	ids := make(map[string]int)
+	for _, object := range objects {
+		if object.Type != "PipeWire:Interface:Node" {
+			continue
+		}
+		if name, ok := object.Info.Props["node.name"].(string); ok {
+			ids[name] = object.ID
+		}
+	}
+	return ids, nil
+}
+
+// findBluetoothNode returns the ID of the node of a media class created by the BlueZ monitor for a device
+func findBluetoothNode(dump []byte, address, mediaClass string) (int, error) {
+	var objects []pwObject
+	if err := json.Unmarshal(dump, &objects); err != nil {
+		return 0, fmt.Errorf("failed to decode pw-dump output: %w", err)
+	}
+
+	for _, object := range objects {
+		if object.Type != "PipeWire:Interface:Node" {
+			continue
+		}
+		nodeAddress, _ := object.Info.Props["api.bluez5.address"].(string)
+		class, _ := object.Info.Props["media.class"].(string)
+		if strings.EqualFold(nodeAddress, address) && class == mediaClass {
+			return object.ID, nil
+		}
+	}
+	return 0, ErrNodeNotFound
+}
+
+// findBluetoothDevice returns the device created by the BlueZ monitor for a Bluetooth device, along with
+// the codec of its nodes
+func findBluetoothDevice(dump []byte, address string) (*Device, error) {
+	var objects []pwObject
+	if err := json.Unmarshal(dump, &objects); err != nil {
+		return nil, fmt.Errorf("failed to decode pw-dump output: %w", err)
+	}
+
+	var device *Device
+	codec := ""
+	for _, object := range objects {
+		objectAddress, _ := object.Info.Props["api.bluez5.address"].(string)
+		if !strings.EqualFold(objectAddress, address) {
+			continue
+		}
+		switch object.Type {
+		case "PipeWire:Interface:Device":
+			device = &Device{ID: object.ID, Profiles: object.Info.Params.EnumProfile}
+			if len(object.Info.Params.Profile) > 0 {
+				device.Profile = object.Info.Params.Profile[0].Name
+			}
+		case "PipeWire:Interface:Node":
+			if nodeCodec, ok := object.Info.Props["api.bluez5.codec"].(string); ok {
+				codec = nodeCodec
+			}
+		}
+	}
+
+	if device == nil {
+		return nil, ErrNodeNotFound
+	}
+	device.Codec = codec
+	return device, nil
+}
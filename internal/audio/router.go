@@ -0,0 +1,191 @@
+// Package audio routes the audio of Bluetooth devices through PipeWire according to their stored settings
+package audio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth/signals"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/wireplumber"
+)
+
+// Codecs are the A2DP codec names understood by the PipeWire BlueZ monitor
+var Codecs = []string{"sbc", "sbc_xq", "aac", "aptx", "aptx_hd", "aptx_ll", "aptx_ll_duplex", "ldac", "faststream", "lc3", "lc3plus_h3", "opus_05"}
+
+// SampleRates are the sample rates accepted in the device settings
+var SampleRates = []int{16000, 32000, 44100, 48000, 96000}
+
+// Channel configurations accepted in the device settings
+const (
+	ChannelsMono   = "mono"
+	ChannelsStereo = "stereo"
+)
+
+// Device profiles which can be forced in the device settings
+const (
+	ProfileA2DPSink        = "a2dp-sink"
+	ProfileHeadsetHeadUnit = "headset-head-unit"
+)
+
+// Bounds of the latency overrides
+const (
+	minQuantum         = 32
+	maxQuantum         = 8192
+	maxLatencyOffsetMs = 5000
+)
+
+const (
+	// nodeRetries bounds the wait for PipeWire to create the nodes of a device after it connects
+	nodeRetries       = 10
+	nodeRetryInterval = time.Second
+)
+
+// ValidateSettings checks the audio settings of a device, zero values are always valid
+func ValidateSettings(settings database.DeviceAudioSettings) error {
+	if err := ValidateCodecs(settings.Codecs); err != nil {
+		return err
+	}
+	if settings.SampleRate != 0 && !slices.Contains(SampleRates, settings.SampleRate) {
+		return fmt.Errorf("unsupported sample rate %d, expected one of %v", settings.SampleRate, SampleRates)
+	}
+	switch settings.Channels {
+	case "", ChannelsMono, ChannelsStereo:
+	default:
+		return fmt.Errorf("unknown channel configuration %q, expected %q or %q", settings.Channels, ChannelsMono, ChannelsStereo)
+	}
+	switch settings.Profile {
+	case "", ProfileA2DPSink, ProfileHeadsetHeadUnit:
+	default:
+		return fmt.Errorf("unknown profile %q, expected %q or %q", settings.Profile, ProfileA2DPSink, ProfileHeadsetHeadUnit)
+	}
+	return nil
+}
+
+// ValidateLatency checks the latency overrides of a device, zero values are always valid
+func ValidateLatency(latency database.AudioLatency) error {
+	if latency.NodeLatency != "" {
+		num, denom, ok := strings.Cut(latency.NodeLatency, "/")
+		n, errNum := strconv.Atoi(num)
+		d, errDenom := strconv.Atoi(denom)
+		if !ok || errNum != nil || errDenom != nil || n <= 0 || d <= 0 {
+			return fmt.Errorf("invalid node latency %q, expected a fraction such as 512/48000", latency.NodeLatency)
+		}
+	}
+	if q := latency.Quantum; q != 0 && (q < minQuantum || q > maxQuantum || q&(q-1) != 0) {
+		return fmt.Errorf("invalid quantum %d: must be a power of two between %d and %d", q, minQuantum, maxQuantum)
+	}
+	if latency.OffsetMs < -maxLatencyOffsetMs || latency.OffsetMs > maxLatencyOffsetMs {
+		return fmt.Errorf("invalid latency offset %dms: must be between -%d and %d", latency.OffsetMs, maxLatencyOffsetMs, maxLatencyOffsetMs)
+	}
+	return nil
+}
+
+// SyncWirePlumber renders the WirePlumber fragments of every device from its stored settings
+func SyncWirePlumber(db database.DatabaseInterface, wpConfig *wireplumber.ConfigManager) error {
+	all, err := database.GetAllDeviceAudioSettings(db)
+	if err != nil {
+		return err
+	}
+
+	changed, err := wpConfig.SyncDevices(all)
+	if err != nil {
+		return err
+	}
+	if changed {
+		log.Printf("Audio: device policies changed, restart PipeWire and WirePlumber to apply them")
+	}
+	return nil
+}
+
+// Router applies the audio settings of devices when they connect
+type Router struct {
+	db            database.DatabaseInterface
+	pipewire      PipeWire
+	retryInterval time.Duration
+}
+
+// NewRouter creates a new audio router
+func NewRouter(db database.DatabaseInterface, pipewire PipeWire) *Router {
+	return &Router{
+		db:            db,
+		pipewire:      pipewire,
+		retryInterval: nodeRetryInterval,
+	}
+}
+
+// Run applies the settings of every device connecting until the context is cancelled
+func (r *Router) Run(ctx context.Context, hub *events.Hub) {
+	ch, unsubscribe := hub.SubscribeTypes(signals.EventDeviceConnected)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			device, isDevice := event.Data.(signals.DeviceEvent)
+			if event.Type != signals.EventDeviceConnected || !isDevice {
+				continue
+			}
+			go func() {
+				if err := r.Apply(ctx, device.Address); err != nil {
+					log.Printf("Audio: failed to apply the settings of %s: %v", device.Address, err)
+				}
+			}()
+		}
+	}
+}
+
+// Apply applies the audio settings of a connected device, if it has any
+func (r *Router) Apply(ctx context.Context, address string) error {
+	settings, err := database.GetDeviceAudioSettings(r.db, address)
+	if err != nil || settings == nil {
+		return err
+	}
+
+	// Codecs are A2DP profiles, a forced headset profile takes precedence
+	if len(settings.Codecs) > 0 && (settings.Profile == "" || settings.Profile == ProfileA2DPSink) {
+		err := r.retry(ctx, func() error {
+			_, err := r.applyCodec(ctx, address, settings.Codecs, false)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to select the preferred codec: %w", err)
+		}
+	}
+
+	if settings.AutoSwitchDefaultSink {
+		if err := r.retry(ctx, func() error { return r.pipewire.SetDefaultSink(ctx, address) }); err != nil {
+			return fmt.Errorf("failed to switch the default sink: %w", err)
+		}
+		log.Printf("Audio: %s is now the default sink", address)
+	}
+
+	return nil
+}
+
+// retry calls fn until PipeWire has created the objects of the device, up to nodeRetries times
+func (r *Router) retry(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if !errors.Is(err, ErrNodeNotFound) || attempt == nodeRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.retryInterval):
+		}
+	}
+}
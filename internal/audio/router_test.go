@@ -0,0 +1,184 @@
+package audio
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePipeWire reports no sink for the first calls, like PipeWire while a device profile is set up
+type fakePipeWire struct {
+	missing int
+	calls   int
+
+	mu        sync.Mutex
+	nodes     map[string]int
+	created   []string
+	destroyed []int
+	loopbacks chan string
+	device    *Device
+	profiles  []int
+	volume    uint8
+	volumes   []uint8
+}
+
+func (f *fakePipeWire) SetDefaultSink(ctx context.Context, address string) error {
+	f.calls++
+	if f.calls <= f.missing {
+		return ErrNodeNotFound
+	}
+	return nil
+}
+
+func (f *fakePipeWire) Nodes(ctx context.Context) (map[string]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	nodes := make(map[string]int)
+	for name, id := range f.nodes {
+		nodes[name] = id
+	}
+	return nodes, nil
+}
+
+func (f *fakePipeWire) CreateNullSink(ctx context.Context, node database.VirtualNode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created = append(f.created, node.Name)
+	return nil
+}
+
+func (f *fakePipeWire) DestroyNode(ctx context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.destroyed = append(f.destroyed, id)
+	return nil
+}
+
+func (f *fakePipeWire) Device(ctx context.Context, address string) (*Device, error) {
+	if f.device == nil {
+		return nil, ErrNodeNotFound
+	}
+	return f.device, nil
+}
+
+func (f *fakePipeWire) SetProfile(ctx context.Context, deviceID, index int) error {
+	f.profiles = append(f.profiles, index)
+	return nil
+}
+
+func (f *fakePipeWire) SinkVolume(ctx context.Context, address string) (uint8, error) {
+	return f.volume, nil
+}
+
+func (f *fakePipeWire) SetSinkVolume(ctx context.Context, address string, percent uint8) error {
+	f.volume = percent
+	f.volumes = append(f.volumes, percent)
+	return nil
+}
+
+func (f *fakePipeWire) RunLoopback(ctx context.Context, node database.VirtualNode) error {
+	f.loopbacks <- node.Name
+	<-ctx.Done()
+	return nil
+}
+
+var settingsColumns = []string{"address", "codecs", "sample_rate", "channels", "auto_switch_default_sink", "auto_connect", "profile", "node_latency", "quantum", "latency_offset_ms", "updated_at"}
+
+func TestRouter_Apply(t *testing.T) {
+	tests := []struct {
+		name          string
+		rows          *sqlmock.Rows
+		missing       int
+		expectedCalls int
+		expectError   bool
+	}{
+		{
+			name:          "switches the default sink once the node exists",
+			rows:          sqlmock.NewRows(settingsColumns).AddRow("AA:BB:CC:DD:EE:FF", "", 96000, "stereo", true, true, "", "", 0, 0, time.Now()),
+			missing:       2,
+			expectedCalls: 3,
+		},
+		{
+			name:          "gives up when the node never appears",
+			rows:          sqlmock.NewRows(settingsColumns).AddRow("AA:BB:CC:DD:EE:FF", "", 0, "", true, true, "", "", 0, 0, time.Now()),
+			missing:       nodeRetries,
+			expectedCalls: nodeRetries,
+			expectError:   true,
+		},
+		{
+			name:          "keeps the default sink without auto switch",
+			rows:          sqlmock.NewRows(settingsColumns).AddRow("AA:BB:CC:DD:EE:FF", "", 0, "", false, true, "", "", 0, 0, time.Now()),
+			expectedCalls: 0,
+		},
+		{
+			name:          "device without settings",
+			rows:          sqlmock.NewRows(settingsColumns),
+			expectedCalls: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			dbMock.ExpectQuery("FROM device_audio_settings WHERE address = ?").
+				WithArgs("AA:BB:CC:DD:EE:FF").
+				WillReturnRows(tt.rows)
+
+			pipewire := &fakePipeWire{missing: tt.missing}
+			router := NewRouter(db, pipewire)
+			router.retryInterval = time.Millisecond
+
+			err = router.Apply(context.Background(), "AA:BB:CC:DD:EE:FF")
+			if tt.expectError {
+				assert.ErrorIs(t, err, ErrNodeNotFound)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.expectedCalls, pipewire.calls)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	assert.NoError(t, ValidateSettings(database.DeviceAudioSettings{}))
+	assert.NoError(t, ValidateSettings(database.DeviceAudioSettings{Codecs: []string{"aptx_hd", "aac"}, SampleRate: 48000, Channels: ChannelsStereo}))
+	assert.Error(t, ValidateSettings(database.DeviceAudioSettings{Codecs: []string{"mp3"}}))
+	assert.Error(t, ValidateSettings(database.DeviceAudioSettings{Codecs: []string{"aac", "aac"}}))
+	assert.Error(t, ValidateSettings(database.DeviceAudioSettings{SampleRate: 22050}))
+	assert.Error(t, ValidateSettings(database.DeviceAudioSettings{Channels: "5.1"}))
+	assert.Error(t, ValidateSettings(database.DeviceAudioSettings{Profile: "off"}))
+}
+
+func TestValidateLatency(t *testing.T) {
+	assert.NoError(t, ValidateLatency(database.AudioLatency{}))
+	assert.NoError(t, ValidateLatency(database.AudioLatency{NodeLatency: "512/48000", Quantum: 1024, OffsetMs: -200}))
+	assert.Error(t, ValidateLatency(database.AudioLatency{NodeLatency: "512"}))
+	assert.Error(t, ValidateLatency(database.AudioLatency{NodeLatency: "0/48000"}))
+	assert.Error(t, ValidateLatency(database.AudioLatency{Quantum: 1000}))
+	assert.Error(t, ValidateLatency(database.AudioLatency{Quantum: 16384}))
+	assert.Error(t, ValidateLatency(database.AudioLatency{OffsetMs: 6000}))
+}
+
+func TestFindBluetoothNode(t *testing.T) {
+	dump := []byte(`[
+		{"id": 30, "type": "PipeWire:Interface:Device", "info": {"props": {"api.bluez5.address": "AA:BB:CC:DD:EE:FF"}}},
+		{"id": 41, "type": "PipeWire:Interface:Node", "info": {"props": {"api.bluez5.address": "AA:BB:CC:DD:EE:FF", "media.class": "Audio/Source"}}},
+		{"id": 42, "type": "PipeWire:Interface:Node", "info": {"props": {"api.bluez5.address": "AA:BB:CC:DD:EE:FF", "media.class": "Audio/Sink"}}},
+		{"id": 50, "type": "PipeWire:Interface:Node", "info": {"props": {"media.class": "Audio/Sink", "node.name": "alsa_output.pci"}}}
+	]`)
+
+	id, err := findBluetoothNode(dump, "aa:bb:cc:dd:ee:ff", "Audio/Sink")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, id)
+
+	_, err = findBluetoothNode(dump, "11:22:33:44:55:66", "Audio/Sink")
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+}
@@ -0,0 +1,219 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// Virtual node types
+const (
+	// NodeNullSink is a sink discarding its input, whose monitor can be recorded or linked
+	NodeNullSink = "null-sink"
+	// NodeLoopback is a sink playing its input to a target node, the default sink when none is set
+	NodeLoopback = "loopback"
+)
+
+var (
+	ErrVirtualNodeExists   = errors.New("virtual node already exists")
+	ErrVirtualNodeNotFound = errors.New("virtual node not found")
+
+	virtualNodeName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+)
+
+// ValidateVirtualNode checks a virtual node before it is stored
+func ValidateVirtualNode(node database.VirtualNode) error {
+	if !virtualNodeName.MatchString(node.Name) {
+		return fmt.Errorf("invalid name %q: use up to 64 letters, digits, dots, dashes or underscores", node.Name)
+	}
+	if node.Type != NodeNullSink && node.Type != NodeLoopback {
+		return fmt.Errorf("unknown type %q, expected %q or %q", node.Type, NodeNullSink, NodeLoopback)
+	}
+	if node.Target != "" && node.Type != NodeLoopback {
+		return fmt.Errorf("only %s nodes have a target", NodeLoopback)
+	}
+	if node.Channels != 1 && node.Channels != 2 {
+		return fmt.Errorf("invalid channels %d: must be 1 or 2", node.Channels)
+	}
+	return nil
+}
+
+// VirtualNodes keeps the virtual nodes stored in the database present in the PipeWire graph,
+// recreating them after PipeWire restarts
+type VirtualNodes struct {
+	db       database.DatabaseInterface
+	pipewire PipeWire
+	interval time.Duration
+	wake     chan struct{}
+
+	mu        sync.Mutex
+	loopbacks map[string]*loopback
+}
+
+// loopback is a running loopback process
+type loopback struct {
+	cancel context.CancelFunc
+}
+
+// NewVirtualNodes creates a new virtual node manager
+func NewVirtualNodes(db database.DatabaseInterface, pipewire PipeWire, interval time.Duration) *VirtualNodes {
+	return &VirtualNodes{
+		db:        db,
+		pipewire:  pipewire,
+		interval:  interval,
+		wake:      make(chan struct{}, 1),
+		loopbacks: make(map[string]*loopback),
+	}
+}
+
+// Run creates the missing virtual nodes at every interval, or as soon as a node is added,
+// until the context is cancelled
+func (v *VirtualNodes) Run(ctx context.Context) {
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	v.reconcile(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v.reconcile(ctx)
+		case <-v.wake:
+			v.reconcile(ctx)
+		}
+	}
+}
+
+// Add stores a virtual node, it is created by the next reconciliation which is triggered immediately
+func (v *VirtualNodes) Add(node database.VirtualNode) error {
+	if _, err := v.find(node.Name); err == nil {
+		return ErrVirtualNodeExists
+	} else if !errors.Is(err, ErrVirtualNodeNotFound) {
+		return err
+	}
+
+	if err := database.AddVirtualNode(v.db, node); err != nil {
+		return err
+	}
+
+	select {
+	case v.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Delete removes a virtual node from the database and from the PipeWire graph
+func (v *VirtualNodes) Delete(ctx context.Context, name string) error {
+	node, err := v.find(name)
+	if err != nil {
+		return err
+	}
+	if err := database.DeleteVirtualNode(v.db, name); err != nil {
+		return err
+	}
+
+	if node.Type == NodeLoopback {
+		v.stopLoopback(name)
+		return nil
+	}
+
+	ids, err := v.pipewire.Nodes(ctx)
+	if err != nil {
+		return err
+	}
+	if id, ok := ids[name]; ok {
+		return v.pipewire.DestroyNode(ctx, id)
+	}
+	return nil
+}
+
+func (v *VirtualNodes) find(name string) (*database.VirtualNode, error) {
+	nodes, err := database.GetVirtualNodes(v.db)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if node.Name == name {
+			return &node, nil
+		}
+	}
+	return nil, ErrVirtualNodeNotFound
+}
+
+// reconcile creates the null sinks missing from the graph and starts the loopbacks which are not running
+func (v *VirtualNodes) reconcile(ctx context.Context) {
+	nodes, err := database.GetVirtualNodes(v.db)
+	if err != nil {
+		log.Printf("Audio: failed to get virtual nodes: %v", err)
+		return
+	}
+	if len(nodes) == 0 {
+		return
+	}
+
+	ids, err := v.pipewire.Nodes(ctx)
+	if err != nil {
+		log.Printf("Audio: failed to list PipeWire nodes: %v", err)
+		return
+	}
+
+	for _, node := range nodes {
+		switch node.Type {
+		case NodeNullSink:
+			if _, ok := ids[node.Name]; ok {
+				continue
+			}
+			if err := v.pipewire.CreateNullSink(ctx, node); err != nil {
+				log.Printf("Audio: failed to create null sink %s: %v", node.Name, err)
+				continue
+			}
+			log.Printf("Audio: created null sink %s", node.Name)
+		case NodeLoopback:
+			v.startLoopback(ctx, node)
+		}
+	}
+}
+
+// startLoopback runs a loopback in the background unless it is already running
+func (v *VirtualNodes) startLoopback(ctx context.Context, node database.VirtualNode) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, running := v.loopbacks[node.Name]; running {
+		return
+	}
+
+	loopbackCtx, cancel := context.WithCancel(ctx)
+	lb := &loopback{cancel: cancel}
+	v.loopbacks[node.Name] = lb
+	log.Printf("Audio: starting loopback %s", node.Name)
+
+	go func() {
+		defer cancel()
+		if err := v.pipewire.RunLoopback(loopbackCtx, node); err != nil {
+			log.Printf("Audio: loopback %s stopped: %v", node.Name, err)
+		}
+
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if v.loopbacks[node.Name] == lb {
+			delete(v.loopbacks, node.Name)
+		}
+	}()
+}
+
+func (v *VirtualNodes) stopLoopback(name string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if lb, running := v.loopbacks[name]; running {
+		lb.cancel()
+		delete(v.loopbacks, name)
+	}
+}
@@ -0,0 +1,89 @@
+package audio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+var virtualNodeColumns = []string{"name", "type", "description", "target", "channels", "created_at"}
+
+func TestVirtualNodes_Reconcile(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows(virtualNodeColumns).
+			AddRow("announcements", NodeNullSink, "Announcements", "", 2, time.Now()).
+			AddRow("kitchen", NodeNullSink, "", "", 1, time.Now()).
+			AddRow("tts", NodeLoopback, "Text to speech", "bluez_output.AA_BB_CC_DD_EE_FF.1", 2, time.Now())
+	}
+	dbMock.ExpectQuery("SELECT name, type, description, target, channels, created_at FROM virtual_nodes").WillReturnRows(rows())
+	dbMock.ExpectQuery("SELECT name, type, description, target, channels, created_at FROM virtual_nodes").WillReturnRows(rows())
+
+	pipewire := &fakePipeWire{nodes: map[string]int{"kitchen": 12}, loopbacks: make(chan string, 2)}
+	v := NewVirtualNodes(db, pipewire, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Test - the missing null sink is created and the loopback started
+	v.reconcile(ctx)
+	assert.Equal(t, []string{"announcements"}, pipewire.created)
+	assert.Equal(t, "tts", <-pipewire.loopbacks)
+
+	// Test - a running loopback is not started twice
+	pipewire.nodes["announcements"] = 13
+	v.reconcile(ctx)
+	assert.Equal(t, []string{"announcements"}, pipewire.created)
+	assert.Empty(t, pipewire.loopbacks)
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestVirtualNodes_Delete(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dbMock.ExpectQuery("SELECT name, type, description, target, channels, created_at FROM virtual_nodes").
+		WillReturnRows(sqlmock.NewRows(virtualNodeColumns).AddRow("announcements", NodeNullSink, "", "", 2, time.Now()))
+	dbMock.ExpectExec("DELETE FROM virtual_nodes WHERE name = ?").
+		WithArgs("announcements").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectQuery("SELECT name, type, description, target, channels, created_at FROM virtual_nodes").
+		WillReturnRows(sqlmock.NewRows(virtualNodeColumns))
+
+	pipewire := &fakePipeWire{nodes: map[string]int{"announcements": 13}}
+	v := NewVirtualNodes(db, pipewire, time.Minute)
+
+	// Test - the null sink is destroyed
+	assert.NoError(t, v.Delete(context.Background(), "announcements"))
+	assert.Equal(t, []int{13}, pipewire.destroyed)
+
+	// Test - unknown node
+	assert.ErrorIs(t, v.Delete(context.Background(), "announcements"), ErrVirtualNodeNotFound)
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestValidateVirtualNode(t *testing.T) {
+	assert.NoError(t, ValidateVirtualNode(database.VirtualNode{Name: "tts", Type: NodeLoopback, Target: "alsa_output.pci", Channels: 2}))
+	assert.Error(t, ValidateVirtualNode(database.VirtualNode{Name: "bad name", Type: NodeNullSink, Channels: 2}))
+	assert.Error(t, ValidateVirtualNode(database.VirtualNode{Name: "tts", Type: "source", Channels: 2}))
+	assert.Error(t, ValidateVirtualNode(database.VirtualNode{Name: "tts", Type: NodeNullSink, Target: "alsa_output.pci", Channels: 2}))
+	assert.Error(t, ValidateVirtualNode(database.VirtualNode{Name: "tts", Type: NodeNullSink, Channels: 6}))
+}
+
+func TestNodeIDs(t *testing.T) {
+	ids, err := nodeIDs([]byte(`[
+		{"id": 30, "type": "PipeWire:Interface:Device", "info": {"props": {"device.name": "alsa_card.pci"}}},
+		{"id": 42, "type": "PipeWire:Interface:Node", "info": {"props": {"node.name": "announcements"}}}
+	]`))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"announcements": 42}, ids)
+}
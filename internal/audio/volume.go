@@ -0,0 +1,126 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+// EventVolumeChanged is published when the volume of a device changes on either side
+const EventVolumeChanged = "volume_changed"
+
+// VolumeChange is the payload of a volume change event
+type VolumeChange struct {
+	Address string `json:"address"`
+	Adapter string `json:"adapter"`
+	Volume  uint8  `json:"volume"`
+}
+
+// VolumeSync keeps the AVRCP absolute volume of the connected devices and the volume of their
+// PipeWire sink equal, so that the headset buttons and the desktop mixer move the same value
+type VolumeSync struct {
+	btManager bluetooth.BluetoothManagerInterface
+	pipewire  PipeWire
+	interval  time.Duration
+
+	// synced is the last volume applied on both sides, by device address
+	synced map[string]uint8
+}
+
+// NewVolumeSync creates a new volume synchronizer
+func NewVolumeSync(btManager bluetooth.BluetoothManagerInterface, pipewire PipeWire, interval time.Duration) *VolumeSync {
+	return &VolumeSync{
+		btManager: btManager,
+		pipewire:  pipewire,
+		interval:  interval,
+		synced:    make(map[string]uint8),
+	}
+}
+
+// Run synchronizes the volumes at every interval until the context is cancelled
+func (v *VolumeSync) Run(ctx context.Context, hub *events.Hub) {
+	ticker := time.NewTicker(v.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			v.Sync(ctx, hub)
+		}
+	}
+}
+
+// Sync compares both volumes of every connected device with the last synchronized value. A change
+// on the device wins over a change in PipeWire, and the first time a device is seen its volume is
+// pushed to PipeWire.
+func (v *VolumeSync) Sync(ctx context.Context, hub *events.Hub) {
+	adapters, err := v.btManager.GetAdapters()
+	if err != nil {
+		log.Printf("Volume sync: failed to get adapters: %v", err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, adapter := range adapters {
+		devices, err := v.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			log.Printf("Volume sync: failed to get devices of adapter %s: %v", adapter.Address, err)
+			continue
+		}
+		for _, device := range devices {
+			if !device.Connected || device.Volume == nil {
+				continue
+			}
+			seen[device.Address] = true
+			v.syncDevice(ctx, hub, adapter, device)
+		}
+	}
+
+	for address := range v.synced {
+		if !seen[address] {
+			delete(v.synced, address)
+		}
+	}
+}
+
+func (v *VolumeSync) syncDevice(ctx context.Context, hub *events.Hub, adapter bluetooth.Adapter, device bluetooth.Device) {
+	deviceVolume := *device.Volume
+	sinkVolume, err := v.pipewire.SinkVolume(ctx, device.Address)
+	if errors.Is(err, ErrNodeNotFound) {
+		return
+	} else if err != nil {
+		log.Printf("Volume sync: failed to get the sink volume of %s: %v", device.Address, err)
+		return
+	}
+
+	last, known := v.synced[device.Address]
+	volume := deviceVolume
+	switch {
+	case !known || deviceVolume != last:
+		if sinkVolume != deviceVolume {
+			if err := v.pipewire.SetSinkVolume(ctx, device.Address, deviceVolume); err != nil {
+				log.Printf("Volume sync: failed to set the sink volume of %s: %v", device.Address, err)
+				return
+			}
+		}
+	case sinkVolume != last:
+		if err := v.btManager.SetVolume(adapter.Path, device.Address, sinkVolume); err != nil {
+			log.Printf("Volume sync: %v", err)
+			return
+		}
+		volume = sinkVolume
+	default:
+		return
+	}
+
+	v.synced[device.Address] = volume
+	if known {
+		hub.Publish(EventVolumeChanged, VolumeChange{Address: device.Address, Adapter: adapter.Address, Volume: volume})
+	}
+}
@@ -0,0 +1,82 @@
+package audio
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func headset(volume uint8) []bluetooth.Device {
+	return []bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Connected: true, Volume: &volume}}
+}
+
+func TestVolumeSync_Sync(t *testing.T) {
+	adapters := []bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "00:11:22:33:44:55"}}
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return(adapters, nil)
+	pipewire := &fakePipeWire{volume: 100}
+	hub := events.NewHub()
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	volumeSync := NewVolumeSync(btManager, pipewire, 0)
+
+	// First sight: the device volume is pushed to PipeWire, without event
+	btManager.On("GetDevices", "/org/bluez/hci0").Return(headset(40), nil).Once()
+	volumeSync.Sync(context.Background(), hub)
+	assert.Equal(t, []uint8{40}, pipewire.volumes)
+	assert.Len(t, ch, 0)
+
+	// Volume changed in PipeWire: pushed to the device
+	pipewire.volume = 55
+	btManager.On("GetDevices", "/org/bluez/hci0").Return(headset(40), nil).Once()
+	btManager.On("SetVolume", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", uint8(55)).Return(nil).Once()
+	volumeSync.Sync(context.Background(), hub)
+	event := <-ch
+	assert.Equal(t, EventVolumeChanged, event.Type)
+	assert.Equal(t, uint8(55), event.Data.(VolumeChange).Volume)
+
+	// Volume changed on the headset: pushed to PipeWire
+	btManager.On("GetDevices", "/org/bluez/hci0").Return(headset(20), nil).Once()
+	volumeSync.Sync(context.Background(), hub)
+	assert.Equal(t, []uint8{40, 20}, pipewire.volumes)
+	assert.Equal(t, uint8(20), (<-ch).Data.(VolumeChange).Volume)
+
+	// Nothing changed
+	btManager.On("GetDevices", "/org/bluez/hci0").Return(headset(20), nil).Once()
+	volumeSync.Sync(context.Background(), hub)
+	assert.Equal(t, []uint8{40, 20}, pipewire.volumes)
+	assert.Len(t, ch, 0)
+
+	// Disconnected devices are forgotten
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{}, nil).Once()
+	volumeSync.Sync(context.Background(), hub)
+	assert.Empty(t, volumeSync.synced)
+	btManager.AssertNumberOfCalls(t, "SetVolume", 1)
+}
+
+func TestParseVolume(t *testing.T) {
+	tests := []struct {
+		out       string
+		expected  uint8
+		expectErr bool
+	}{
+		{out: "Volume: 0.40\n", expected: 40},
+		{out: "Volume: 0.67 [MUTED]\n", expected: 67},
+		{out: "Volume: 1.50\n", expected: 100},
+		{out: "Translate ID failed\n", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		volume, err := parseVolume(tt.out)
+		if tt.expectErr {
+			assert.Error(t, err, tt.out)
+			continue
+		}
+		assert.NoError(t, err, tt.out)
+		assert.Equal(t, tt.expected, volume, tt.out)
+	}
+}
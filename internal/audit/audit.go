@@ -0,0 +1,60 @@
+// Package audit stores the audit trail of the audited requests
+package audit
+
+import (
+	"context"
+	"log"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// EventRequestAudited is published as an internal event for every audited request, its data being
+// the database.AuditEntry stored
+const EventRequestAudited = "request_audited"
+
+// queueSize is the number of audited requests waiting to be stored before the next ones wait for
+// the database
+const queueSize = 256
+
+// Logger stores the audited requests in the audit trail. Unlike the event hub, which drops the
+// events of slow subscribers, its queue makes the requests wait, so that no entry is lost.
+type Logger struct {
+	db    database.DatabaseInterface
+	queue chan database.AuditEntry
+}
+
+// NewLogger creates an audit logger storing the entries in the database
+func NewLogger(db database.DatabaseInterface) *Logger {
+	return &Logger{db: db, queue: make(chan database.AuditEntry, queueSize)}
+}
+
+// Record queues an audited request to be stored, waiting for room in the queue when it is full
+func (l *Logger) Record(entry database.AuditEntry) {
+	l.queue <- entry
+}
+
+// Run stores the queued entries until the context is cancelled, then the entries still queued
+func (l *Logger) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case entry := <-l.queue:
+					l.store(entry)
+				default:
+					return
+				}
+			}
+		case entry := <-l.queue:
+			l.store(entry)
+		}
+	}
+}
+
+// store adds an entry to the audit trail
+func (l *Logger) store(entry database.AuditEntry) {
+	if err := database.AddAuditEntry(l.db, entry); err != nil {
+		log.Printf("Audit: request_id=%s %v", entry.RequestID, err)
+	}
+}
@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger_Run(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	logger := NewLogger(db)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go logger.Run(ctx)
+
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(at, "kitchen", "192.0.2.1", "DELETE /api/v1/tokens/:username", "", "success", 200, "abc").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	logger.Record(database.AuditEntry{
+		CreatedAt: at,
+		Actor:     "kitchen",
+		IP:        "192.0.2.1",
+		Action:    "DELETE /api/v1/tokens/:username",
+		Outcome:   database.AuditOutcomeSuccess,
+		Status:    200,
+		RequestID: "abc",
+	})
+
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+}
+
+func TestLogger_NoEntryLost(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// More entries than the queue holds are recorded before the logger runs: the last ones wait
+	// for room instead of being dropped
+	logger := NewLogger(db)
+	total := queueSize + 10
+	for i := 0; i < total; i++ {
+		mock.ExpectExec("INSERT INTO audit_log").WillReturnResult(sqlmock.NewResult(int64(i+1), 1))
+	}
+	recorded := make(chan struct{})
+	go func() {
+		defer close(recorded)
+		for i := 0; i < total; i++ {
+			logger.Record(database.AuditEntry{Actor: "kitchen", Outcome: database.AuditOutcomeSuccess})
+		}
+	}()
+	assert.Eventually(t, func() bool { return len(logger.queue) == queueSize }, time.Second, time.Millisecond)
+
+	// The entries still queued are stored once the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		logger.Run(ctx)
+	}()
+	<-recorded
+	cancel()
+	<-done
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
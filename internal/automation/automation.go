@@ -0,0 +1,299 @@
+// Package automation runs the automation rules: Starlark scripts evaluated on the broker events, in a
+// sandbox only able to read the device and presence state, connect or disconnect devices and log
+package automation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/presence"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+const (
+	// maxExecutionSteps bounds the work of a script, so that a runaway loop cannot hog the broker
+	maxExecutionSteps = 1000000
+	// scriptTimeout bounds the run time of a script, including the actions it waits for
+	scriptTimeout = 30 * time.Second
+	// workers is the number of events whose rules are evaluated at once, each script running in its
+	// own sandbox process
+	workers = 2
+	// queueSize is the number of events waiting for a free worker before new ones are dropped
+	queueSize = 64
+)
+
+// fileOptions allows the top-level if and for statements rules are written with. The while statement
+// stays disallowed, scripts looping only over finite sequences.
+var fileOptions = &syntax.FileOptions{TopLevelControl: true, GlobalReassign: true, Set: true}
+
+// builtins are the names predeclared in scripts, besides the Starlark universe
+var builtins = []string{"event", "device", "presence", "now", "action", "log"}
+
+// PresenceSource returns the state of the presence devices, it is implemented by presence.Tracker
+type PresenceSource interface {
+	Statuses() []presence.Status
+}
+
+// Engine evaluates the enabled rules triggered by each event published on a hub. Scripts run in a
+// sandbox process, the broker binary running SandboxCommand, which bounds their memory.
+type Engine struct {
+	btManager bluetooth.BluetoothManagerInterface
+	db        database.DatabaseInterface
+	presence  PresenceSource
+	readOnly  bool
+	now       func() time.Time
+	// sandbox is the command line of the sandbox process
+	sandbox []string
+	// queue holds the events waiting for one of the workers
+	queue chan evaluation
+
+	mu sync.Mutex
+	// rules caches the enabled rules by trigger, nil until loaded
+	rules map[string][]database.AutomationRule
+}
+
+type evaluation struct {
+	rules []database.AutomationRule
+	event events.Event
+}
+
+// NewEngine creates an automation engine. In read-only mode, the actions of the scripts are refused.
+func NewEngine(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, presence PresenceSource, readOnly bool) *Engine {
+	executable, err := os.Executable()
+	if err != nil {
+		executable = os.Args[0]
+	}
+	return &Engine{
+		btManager: btManager,
+		db:        db,
+		presence:  presence,
+		readOnly:  readOnly,
+		now:       time.Now,
+		sandbox:   []string{executable, SandboxCommand},
+		queue:     make(chan evaluation, queueSize),
+	}
+}
+
+// Check compiles a script, returning its syntax errors, the references to undefined names and the
+// load statements
+func Check(script string) error {
+	f, _, err := starlark.SourceProgramOptions(fileOptions, "rule", script, isBuiltin)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range f.Stmts {
+		if load, ok := stmt.(*syntax.LoadStmt); ok {
+			return fmt.Errorf("%s: load is not allowed", load.Load)
+		}
+	}
+	return nil
+}
+
+func isBuiltin(name string) bool {
+	for _, builtin := range builtins {
+		if name == builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// Run evaluates the rules of the published events until the context is cancelled
+func (e *Engine) Run(ctx context.Context, hub *events.Hub) {
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < workers; i++ {
+		go e.work(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			rules, err := e.enabledRules(event.Type)
+			if err != nil {
+				log.Printf("Automation: %v", err)
+				continue
+			}
+			if len(rules) == 0 {
+				continue
+			}
+			// The queue is bounded so that slow rules cannot pile up events without limit
+			select {
+			case e.queue <- evaluation{rules: rules, event: event}:
+			default:
+				log.Printf("Automation: dropped %s event, %d events already waiting", event.Type, queueSize)
+			}
+		}
+	}
+}
+
+// work runs the rules of the queued events, in order, until the context is cancelled
+func (e *Engine) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-e.queue:
+			for _, rule := range ev.rules {
+				if err := e.Evaluate(ctx, rule, ev.event); err != nil {
+					log.Printf("Automation %s: %v", rule.Name, err)
+				}
+			}
+		}
+	}
+}
+
+// enabledRules returns the enabled rules triggered by an event type, loading the rules on the first
+// event after they changed
+func (e *Engine) enabledRules(trigger string) ([]database.AutomationRule, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.rules == nil {
+		rules, err := database.GetAutomationRules(e.db)
+		if err != nil {
+			return nil, err
+		}
+		e.rules = make(map[string][]database.AutomationRule)
+		for _, rule := range rules {
+			if rule.Enabled {
+				e.rules[rule.Trigger] = append(e.rules[rule.Trigger], rule)
+			}
+		}
+	}
+	return e.rules[trigger], nil
+}
+
+// Invalidate forgets the cached rules, when they change
+func (e *Engine) Invalidate() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = nil
+}
+
+// Evaluate runs the script of a rule for an event in a sandbox process, then the actions it asked for
+func (e *Engine) Evaluate(ctx context.Context, rule database.AutomationRule, event events.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, scriptTimeout)
+	defer cancel()
+
+	req, err := e.snapshot(rule, event)
+	if err != nil {
+		return err
+	}
+	input, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+
+	cmd := exec.CommandContext(ctx, e.sandbox[0], e.sandbox[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	// The sandbox needs no configuration, nor the credentials of the broker environment
+	cmd.Env = []string{}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = time.Second
+	err = cmd.Run()
+
+	var result *sandboxMessage
+	dec := json.NewDecoder(&stdout)
+	for {
+		var msg sandboxMessage
+		if dec.Decode(&msg) != nil {
+			break
+		}
+		if msg.Done {
+			result = &msg
+		} else {
+			log.Printf("Automation %s: %s", rule.Name, msg.Log)
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("script killed after %s", scriptTimeout)
+	}
+	if err != nil {
+		// The runtime of the sandbox exits on a fatal error past the memory limit
+		msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n")
+		return fmt.Errorf("sandbox failed, possibly past its %d MiB memory limit: %w: %s", maxMemory>>20, err, msg)
+	}
+	if result == nil {
+		return errors.New("sandbox returned no result")
+	}
+
+	for _, action := range result.Actions {
+		if action.Name == "connect" {
+			err = e.btManager.ConnectDevice(action.AdapterPath, action.Address)
+		} else {
+			err = e.btManager.DisconnectDevice(action.AdapterPath, action.Address)
+		}
+		if err != nil {
+			return fmt.Errorf("action: failed to %s %s: %w", action.Name, action.Address, err)
+		}
+		log.Printf("Automation %s: %s %s", rule.Name, action.Name, action.Address)
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+	return nil
+}
+
+// snapshot returns the evaluation of a rule, with the state of the devices on every adapter and of
+// the presence devices read by its script
+func (e *Engine) snapshot(rule database.AutomationRule, event events.Event) (sandboxRequest, error) {
+	req := sandboxRequest{
+		Script:   rule.Script,
+		Event:    event,
+		Now:      e.now(),
+		ReadOnly: e.readOnly,
+		Devices:  []deviceState{},
+		Presence: make(map[string]string),
+	}
+
+	adapters, err := e.btManager.GetAdapters()
+	if err != nil {
+		return req, err
+	}
+	for _, adapter := range adapters {
+		devices, err := e.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			return req, err
+		}
+		for _, d := range devices {
+			req.Devices = append(req.Devices, deviceState{
+				Address:     d.Address,
+				Name:        d.Name,
+				Adapter:     d.Adapter,
+				AdapterPath: adapter.Path,
+				Paired:      d.Paired,
+				Trusted:     d.Trusted,
+				Connected:   d.Connected,
+				Battery:     d.Battery,
+			})
+		}
+	}
+
+	if e.presence != nil {
+		for _, status := range e.presence.Statuses() {
+			req.Presence[strings.ToUpper(status.Address)] = status.State
+		}
+	}
+	return req, nil
+}
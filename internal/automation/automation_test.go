@@ -0,0 +1,128 @@
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/presence"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain runs the sandbox when the engine starts the test binary as its sandbox process
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == SandboxCommand {
+		if err := RunSandbox(os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type fakePresence map[string]string
+
+func (f fakePresence) Statuses() []presence.Status {
+	var statuses []presence.Status
+	for address, state := range f {
+		statuses = append(statuses, presence.Status{Address: address, State: state})
+	}
+	return statuses
+}
+
+func TestCheck(t *testing.T) {
+	assert.NoError(t, Check(`
+if presence("AA:BB:CC:DD:EE:FF") == "home" and now().hour >= 18:
+    action("connect", event["data"]["address"])
+`))
+	assert.ErrorContains(t, Check("if True\n    pass\n"), "want ':'")
+	assert.ErrorContains(t, Check("unknown()\n"), "undefined: unknown")
+	assert.ErrorContains(t, Check("while True:\n    pass\n"), "while")
+	assert.ErrorContains(t, Check(`load("module.star", "x")`), "load is not allowed")
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	battery := uint8(15)
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01"}}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "AA:BB:CC:DD:EE:FF", Name: "Phone", Connected: true, Battery: &battery},
+		{Address: "11:22:33:44:55:66", Name: "Speaker"},
+	}, nil)
+	btManager.On("ConnectDevice", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil).Once()
+	btManager.On("DisconnectDevice", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF").Return(errors.New("not connected")).Once()
+
+	e := NewEngine(btManager, nil, fakePresence{"AA:BB:CC:DD:EE:FF": "home"}, false)
+	e.now = func() time.Time { return time.Date(2026, 10, 16, 19, 30, 0, 0, time.Local) }
+	event := events.Event{Type: "device_connected", Data: map[string]string{"address": "aa:bb:cc:dd:ee:ff"}}
+
+	// The speaker is connected when the phone comes home in the evening with a low battery
+	rule := database.AutomationRule{Name: "evening", Script: `
+phone = device(event["data"]["address"])
+t = now()
+if presence(phone.address) == "home" and t.hour >= 18 and t.weekday == "friday" and phone.battery < 20:
+    log("connecting speaker for", phone.name)
+    action("connect", "11:22:33:44:55:66")
+if device("00:00:00:00:00:00") != None:
+    fail("unknown device found")
+`}
+	assert.NoError(t, e.Evaluate(context.Background(), rule, event))
+
+	rule.Script = `action("disconnect", "00:00:00:00:00:00")`
+	assert.ErrorContains(t, e.Evaluate(context.Background(), rule, event), "device 00:00:00:00:00:00 not found")
+	rule.Script = `action("pair", "11:22:33:44:55:66")`
+	assert.ErrorContains(t, e.Evaluate(context.Background(), rule, event), `unknown action "pair"`)
+
+	// The actions run once the script is done
+	rule.Script = `action("disconnect", event["data"]["address"])`
+	assert.ErrorContains(t, e.Evaluate(context.Background(), rule, event), "action: failed to disconnect AA:BB:CC:DD:EE:FF: not connected")
+
+	// A runaway script is stopped, as one allocating without bounds
+	rule.Script = "for i in range(100000000):\n    pass\n"
+	assert.ErrorContains(t, e.Evaluate(context.Background(), rule, event), "too many steps")
+	rule.Script = `s = "x" * (1 << 29)`
+	assert.ErrorContains(t, e.Evaluate(context.Background(), rule, event), "sandbox failed, possibly past its 64 MiB memory limit: exit status 2")
+
+	// Read-only brokers refuse the actions
+	e.readOnly = true
+	rule.Script = `action("connect", "11:22:33:44:55:66")`
+	assert.ErrorContains(t, e.Evaluate(context.Background(), rule, event), "read-only")
+}
+
+func TestEngine_EnabledRules(t *testing.T) {
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "data.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, database.RunMigrations(db))
+
+	_, err = database.AddAutomationRule(db, database.AutomationRule{Name: "first", Trigger: "device_connected", Script: "pass", Enabled: true})
+	assert.NoError(t, err)
+	_, err = database.AddAutomationRule(db, database.AutomationRule{Name: "disabled", Trigger: "device_connected", Script: "pass"})
+	assert.NoError(t, err)
+
+	e := NewEngine(nil, db, nil, false)
+	rules, err := e.enabledRules("device_connected")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+	assert.Equal(t, "first", rules[0].Name)
+
+	// The rules are cached until invalidated
+	_, err = database.AddAutomationRule(db, database.AutomationRule{Name: "second", Trigger: "device_connected", Script: "pass", Enabled: true})
+	assert.NoError(t, err)
+	rules, _ = e.enabledRules("device_connected")
+	assert.Len(t, rules, 1)
+
+	e.Invalidate()
+	rules, err = e.enabledRules("device_connected")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+	assert.Equal(t, "second", rules[1].Name)
+}
@@ -0,0 +1,291 @@
+package automation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkjson"
+	"go.starlark.net/starlarkstruct"
+)
+
+const (
+	// SandboxCommand is the hidden command of the broker binary evaluating a script, run by the engine
+	// in a child process
+	SandboxCommand = "automation-sandbox"
+	// maxMemory bounds the memory the sandbox process allocates past its start, Starlark having no
+	// allocation limit: a script such as "x" * (1 << 29) makes the sandbox fail instead of the broker
+	maxMemory = 64 << 20
+	// maxLogs and maxLogLength bound the log lines of a script, and maxActions its actions
+	maxLogs      = 100
+	maxLogLength = 1024
+	maxActions   = 32
+)
+
+// sandboxRequest is the script evaluation sent to the sandbox, with the state its builtins read
+type sandboxRequest struct {
+	Script   string        `json:"script"`
+	Event    events.Event  `json:"event"`
+	Now      time.Time     `json:"now"`
+	ReadOnly bool          `json:"read_only"`
+	Devices  []deviceState `json:"devices"`
+	// Presence maps the upper-case address of the presence devices to their state
+	Presence map[string]string `json:"presence"`
+}
+
+// deviceState is a device of the snapshot read by the scripts
+type deviceState struct {
+	Address     string `json:"address"`
+	Name        string `json:"name"`
+	Adapter     string `json:"adapter"`
+	AdapterPath string `json:"adapter_path"`
+	Paired      bool   `json:"paired"`
+	Trusted     bool   `json:"trusted"`
+	Connected   bool   `json:"connected"`
+	Battery     *uint8 `json:"battery,omitempty"`
+}
+
+// sandboxMessage is a line written by the sandbox: a log line of the script as it runs, then its
+// result, with the actions the engine runs in order and the error stopping it
+type sandboxMessage struct {
+	Log     string          `json:"log,omitempty"`
+	Done    bool            `json:"done,omitempty"`
+	Actions []sandboxAction `json:"actions,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type sandboxAction struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	AdapterPath string `json:"adapter_path"`
+}
+
+// RunSandbox evaluates the script read from in and writes its log lines and result to out, under the
+// memory limit of the sandbox. It is run by the SandboxCommand process.
+func RunSandbox(in io.Reader, out io.Writer) error {
+	// The Go runtime alone maps tens of megabytes, such as its heap arena index
+	used, err := dataSize()
+	if err != nil {
+		return err
+	}
+	limit := used + maxMemory
+	if err := syscall.Setrlimit(syscall.RLIMIT_DATA, &syscall.Rlimit{Cur: limit, Max: limit}); err != nil {
+		return fmt.Errorf("failed to limit the sandbox memory: %w", err)
+	}
+	// Collect the garbage before reaching the limit
+	debug.SetMemoryLimit(maxMemory / 2)
+
+	var req sandboxRequest
+	if err := json.NewDecoder(in).Decode(&req); err != nil {
+		return fmt.Errorf("failed to decode the sandbox request: %w", err)
+	}
+
+	s := &sandbox{req: req, out: json.NewEncoder(out)}
+	result := sandboxMessage{Done: true}
+	if err := s.evaluate(); err != nil {
+		result.Error = err.Error()
+	}
+	result.Actions = s.actions
+	return s.out.Encode(result)
+}
+
+// dataSize returns the size of the data segment of the process, counted by RLIMIT_DATA
+func dataSize() (uint64, error) {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if value, ok := strings.CutPrefix(line, "VmData:"); ok {
+			kb, err := strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(value, "kB")), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid VmData %q: %w", value, err)
+			}
+			return kb << 10, nil
+		}
+	}
+	return 0, errors.New("VmData not found in /proc/self/status")
+}
+
+// sandbox holds the state of a script evaluation
+type sandbox struct {
+	req     sandboxRequest
+	out     *json.Encoder
+	logs    int
+	actions []sandboxAction
+}
+
+func (s *sandbox) evaluate() error {
+	thread := &starlark.Thread{
+		Name: "rule",
+		Print: func(_ *starlark.Thread, msg string) {
+			s.log(msg)
+		},
+		// Scripts may not load modules
+		Load: func(_ *starlark.Thread, module string) (starlark.StringDict, error) {
+			return nil, fmt.Errorf("load is not allowed")
+		},
+	}
+	thread.SetMaxExecutionSteps(maxExecutionSteps)
+
+	eventValue, err := toStarlark(thread, s.req.Event)
+	if err != nil {
+		return fmt.Errorf("failed to convert %s event: %w", s.req.Event.Type, err)
+	}
+
+	predeclared := starlark.StringDict{
+		"event":    eventValue,
+		"device":   starlark.NewBuiltin("device", s.device),
+		"presence": starlark.NewBuiltin("presence", s.presenceState),
+		"now":      starlark.NewBuiltin("now", s.clock),
+		"action":   starlark.NewBuiltin("action", s.action),
+		"log":      starlark.NewBuiltin("log", s.logArgs),
+	}
+	_, err = starlark.ExecFileOptions(fileOptions, thread, "rule", s.req.Script, predeclared)
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return errors.New(evalErr.Backtrace())
+	}
+	return err
+}
+
+// toStarlark converts a value to Starlark through its JSON encoding, events holding Go structures
+func toStarlark(thread *starlark.Thread, v interface{}) (starlark.Value, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.Call(thread, starlarkjson.Module.Members["decode"], starlark.Tuple{starlark.String(data)}, nil)
+}
+
+// findDevice looks a device up in the snapshot
+func (s *sandbox) findDevice(address string) *deviceState {
+	for i := range s.req.Devices {
+		if strings.EqualFold(s.req.Devices[i].Address, address) {
+			return &s.req.Devices[i]
+		}
+	}
+	return nil
+}
+
+// device returns the state of a device, or None when no adapter knows it
+func (s *sandbox) device(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var address string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &address); err != nil {
+		return nil, err
+	}
+
+	device := s.findDevice(address)
+	if device == nil {
+		return starlark.None, nil
+	}
+
+	var battery starlark.Value = starlark.None
+	if device.Battery != nil {
+		battery = starlark.MakeInt(int(*device.Battery))
+	}
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"address":   starlark.String(device.Address),
+		"name":      starlark.String(device.Name),
+		"adapter":   starlark.String(device.Adapter),
+		"paired":    starlark.Bool(device.Paired),
+		"trusted":   starlark.Bool(device.Trusted),
+		"connected": starlark.Bool(device.Connected),
+		"battery":   battery,
+	}), nil
+}
+
+// presenceState returns the presence state of a device, home or away, or None when it is not tracked
+func (s *sandbox) presenceState(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var address string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 1, &address); err != nil {
+		return nil, err
+	}
+
+	state, ok := s.req.Presence[strings.ToUpper(address)]
+	if !ok {
+		return starlark.None, nil
+	}
+	return starlark.String(state), nil
+}
+
+// clock returns the local time of the event, for the time-of-day conditions
+func (s *sandbox) clock(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+
+	now := s.req.Now
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"hour":    starlark.MakeInt(now.Hour()),
+		"minute":  starlark.MakeInt(now.Minute()),
+		"weekday": starlark.String(strings.ToLower(now.Weekday().String())),
+		"unix":    starlark.MakeInt64(now.Unix()),
+	}), nil
+}
+
+// action connects or disconnects a device, on the adapter knowing it. The engine runs the actions
+// once the script is done.
+func (s *sandbox) action(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, address string
+	if err := starlark.UnpackPositionalArgs(fn.Name(), args, kwargs, 2, &name, &address); err != nil {
+		return nil, err
+	}
+	if name != "connect" && name != "disconnect" {
+		return nil, fmt.Errorf("%s: unknown action %q", fn.Name(), name)
+	}
+	if s.req.ReadOnly {
+		return nil, fmt.Errorf("%s: the broker is read-only", fn.Name())
+	}
+
+	device := s.findDevice(address)
+	if device == nil {
+		return nil, fmt.Errorf("%s: device %s not found", fn.Name(), address)
+	}
+
+	if len(s.actions) == maxActions {
+		return nil, fmt.Errorf("%s: more than %d actions", fn.Name(), maxActions)
+	}
+	s.actions = append(s.actions, sandboxAction{Name: name, Address: device.Address, AdapterPath: device.AdapterPath})
+	return starlark.None, nil
+}
+
+// logArgs logs its arguments separated by spaces, strings unquoted
+func (s *sandbox) logArgs(thread *starlark.Thread, fn *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if len(kwargs) > 0 {
+		return nil, fmt.Errorf("%s: unexpected keyword arguments", fn.Name())
+	}
+
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		if str, ok := starlark.AsString(arg); ok {
+			parts[i] = str
+		} else {
+			parts[i] = arg.String()
+		}
+	}
+	s.log(strings.Join(parts, " "))
+	return starlark.None, nil
+}
+
+// log writes a log line of the script, the lines past maxLogs being dropped. The lines are written
+// as they come so that they are not lost when the sandbox fails.
+func (s *sandbox) log(msg string) {
+	if s.logs == maxLogs {
+		return
+	}
+	s.logs++
+	if len(msg) > maxLogLength {
+		msg = msg[:maxLogLength] + "..."
+	}
+	s.out.Encode(sandboxMessage{Log: msg})
+}
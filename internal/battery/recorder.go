@@ -0,0 +1,121 @@
+package battery
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+const (
+	// EventBatteryLow is published when a device battery drops to or below the threshold
+	EventBatteryLow = "battery_low"
+)
+
+type LowBatteryEvent struct {
+	Adapter    string `json:"adapter"`
+	Address    string `json:"address"`
+	Name       string `json:"name"`
+	Percentage int    `json:"percentage"`
+	Threshold  int    `json:"threshold"`
+}
+
+// Recorder periodically samples the battery level of paired devices
+type Recorder struct {
+	btManager bluetooth.BluetoothManagerInterface
+	db        database.DatabaseInterface
+	hub       *events.Hub
+	interval  time.Duration
+	threshold int
+	low       map[string]bool
+}
+
+// NewRecorder creates a new battery recorder
+func NewRecorder(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, hub *events.Hub, interval time.Duration, threshold int) *Recorder {
+	return &Recorder{
+		btManager: btManager,
+		db:        db,
+		hub:       hub,
+		interval:  interval,
+		threshold: threshold,
+		low:       make(map[string]bool),
+	}
+}
+
+// Run samples battery levels every interval until the context is cancelled
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.Sample()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample records the current battery level of every paired device exposing one
+func (r *Recorder) Sample() {
+	adapters, err := r.btManager.GetAdapters()
+	if err != nil {
+		log.Printf("Battery Recorder: failed to list adapters: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, adapter := range adapters {
+		devices, err := r.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			log.Printf("Battery Recorder: failed to list devices of %s: %v", adapter.Address, err)
+			continue
+		}
+
+		for _, device := range devices {
+			if !device.Paired || device.Battery == nil {
+				continue
+			}
+
+			percentage := int(*device.Battery)
+			err := database.InsertBatterySample(r.db, database.BatterySample{
+				Adapter:    adapter.Address,
+				Address:    device.Address,
+				Percentage: percentage,
+				RecordedAt: now,
+			})
+			if err != nil {
+				log.Printf("Battery Recorder: %v", err)
+			}
+
+			r.checkThreshold(adapter, device, percentage)
+		}
+	}
+}
+
+// checkThreshold publishes an event when a device battery crosses the low threshold
+func (r *Recorder) checkThreshold(adapter bluetooth.Adapter, device bluetooth.Device, percentage int) {
+	if percentage > r.threshold {
+		delete(r.low, device.Address)
+		return
+	}
+
+	if r.low[device.Address] {
+		return
+	}
+	r.low[device.Address] = true
+
+	log.Printf("Battery Recorder: device %s (%s) battery is low: %d%%", device.Name, device.Address, percentage)
+	r.hub.Publish(EventBatteryLow, LowBatteryEvent{
+		Adapter:    adapter.Address,
+		Address:    device.Address,
+		Name:       device.Name,
+		Percentage: percentage,
+		Threshold:  r.threshold,
+	})
+}
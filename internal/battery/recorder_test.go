@@ -0,0 +1,52 @@
+package battery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder_Sample(t *testing.T) {
+	// Setup
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	level := uint8(15)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00"}}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66", Name: "Headset", Paired: true, Battery: &level},
+		{Address: "22:33:44:55:66:77", Name: "Unpaired", Paired: false, Battery: &level},
+		{Address: "33:44:55:66:77:88", Name: "Keyboard", Paired: true},
+	}, nil)
+
+	dbMock.ExpectExec("INSERT INTO battery_history").
+		WithArgs("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66", 15, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectExec("INSERT INTO battery_history").
+		WithArgs("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66", 15, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	hub := events.NewHub()
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	r := NewRecorder(btMock, db, hub, time.Minute, 20)
+
+	// Test - two samples below the threshold only emit one event
+	r.Sample()
+	r.Sample()
+
+	// Assert
+	assert.Len(t, ch, 1)
+	event := <-ch
+	assert.Equal(t, EventBatteryLow, event.Type)
+	assert.Equal(t, "11:22:33:44:55:66", event.Data.(LowBatteryEvent).Address)
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
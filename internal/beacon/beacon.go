@@ -0,0 +1,165 @@
+package beacon
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+)
+
+const (
+	TypeIBeacon      = "ibeacon"
+	TypeEddystoneUID = "eddystone_uid"
+	TypeEddystoneURL = "eddystone_url"
+	TypeEddystoneTLM = "eddystone_tlm"
+
+	// appleCompanyID is the Bluetooth SIG company identifier carrying iBeacon frames
+	appleCompanyID = 0x004c
+	// EddystoneServiceUUID is the service data UUID carrying Eddystone frames
+	EddystoneServiceUUID = "0000feaa-0000-1000-8000-00805f9b34fb"
+)
+
+// Beacon is a decoded iBeacon or Eddystone advertisement
+type Beacon struct {
+	Type      string     `json:"type"`
+	Adapter   string     `json:"adapter"`
+	Address   string     `json:"address"`
+	Name      string     `json:"name,omitempty"`
+	UUID      string     `json:"uuid,omitempty"`
+	Major     *uint16    `json:"major,omitempty"`
+	Minor     *uint16    `json:"minor,omitempty"`
+	Namespace string     `json:"namespace,omitempty"`
+	Instance  string     `json:"instance,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	Telemetry *Telemetry `json:"telemetry,omitempty"`
+	TxPower   int8       `json:"tx_power"`
+	RSSI      *int16     `json:"rssi,omitempty"`
+	LastSeen  time.Time  `json:"last_seen"`
+}
+
+// Telemetry is the content of an unencrypted Eddystone-TLM frame
+type Telemetry struct {
+	BatteryMillivolts uint16  `json:"battery_mv"`
+	Temperature       float64 `json:"temperature"`
+	AdvertisingCount  uint32  `json:"advertising_count"`
+	UptimeSeconds     float64 `json:"uptime_seconds"`
+}
+
+// Decode returns the beacon frames advertised by a device
+func Decode(device bluetooth.Device) []Beacon {
+	var beacons []Beacon
+
+	if data, ok := device.ManufacturerData[appleCompanyID]; ok {
+		if beacon, err := ParseIBeacon(data); err == nil {
+			beacons = append(beacons, *beacon)
+		}
+	}
+	if data, ok := device.ServiceData[EddystoneServiceUUID]; ok {
+		if beacon, err := ParseEddystone(data); err == nil {
+			beacons = append(beacons, *beacon)
+		}
+	}
+
+	for i := range beacons {
+		beacons[i].Address = device.Address
+		beacons[i].Name = device.Name
+		beacons[i].RSSI = device.RSSI
+	}
+	return beacons
+}
+
+// ParseIBeacon decodes the Apple manufacturer data of an iBeacon advertisement
+func ParseIBeacon(data []byte) (*Beacon, error) {
+	if len(data) != 23 || data[0] != 0x02 || data[1] != 0x15 {
+		return nil, fmt.Errorf("not an iBeacon frame")
+	}
+
+	major := binary.BigEndian.Uint16(data[18:20])
+	minor := binary.BigEndian.Uint16(data[20:22])
+	return &Beacon{
+		Type:    TypeIBeacon,
+		UUID:    formatUUID(data[2:18]),
+		Major:   &major,
+		Minor:   &minor,
+		TxPower: int8(data[22]),
+	}, nil
+}
+
+// ParseEddystone decodes the service data of an Eddystone UID, URL or TLM frame
+func ParseEddystone(data []byte) (*Beacon, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("eddystone frame too short")
+	}
+
+	switch data[0] {
+	case 0x00:
+		if len(data) < 18 {
+			return nil, fmt.Errorf("eddystone UID frame too short")
+		}
+		return &Beacon{
+			Type:      TypeEddystoneUID,
+			TxPower:   int8(data[1]),
+			Namespace: hex.EncodeToString(data[2:12]),
+			Instance:  hex.EncodeToString(data[12:18]),
+		}, nil
+	case 0x10:
+		url, err := decodeEddystoneURL(data[2:])
+		if err != nil {
+			return nil, err
+		}
+		return &Beacon{
+			Type:    TypeEddystoneURL,
+			TxPower: int8(data[1]),
+			URL:     url,
+		}, nil
+	case 0x20:
+		// Only version 0 (unencrypted) telemetry can be decoded
+		if len(data) < 14 || data[1] != 0x00 {
+			return nil, fmt.Errorf("unsupported eddystone TLM frame")
+		}
+		return &Beacon{
+			Type: TypeEddystoneTLM,
+			Telemetry: &Telemetry{
+				BatteryMillivolts: binary.BigEndian.Uint16(data[2:4]),
+				Temperature:       float64(int16(binary.BigEndian.Uint16(data[4:6]))) / 256,
+				AdvertisingCount:  binary.BigEndian.Uint32(data[6:10]),
+				UptimeSeconds:     float64(binary.BigEndian.Uint32(data[10:14])) / 10,
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported eddystone frame type 0x%02x", data[0])
+	}
+}
+
+var eddystoneURLSchemes = []string{"http://www.", "https://www.", "http://", "https://"}
+
+var eddystoneURLExpansions = []string{
+	".com/", ".org/", ".edu/", ".net/", ".info/", ".biz/", ".gov/",
+	".com", ".org", ".edu", ".net", ".info", ".biz", ".gov",
+}
+
+// decodeEddystoneURL expands the compressed URL of an Eddystone-URL frame
+func decodeEddystoneURL(data []byte) (string, error) {
+	if len(data) < 1 || int(data[0]) >= len(eddystoneURLSchemes) {
+		return "", fmt.Errorf("invalid eddystone URL scheme")
+	}
+
+	url := eddystoneURLSchemes[data[0]]
+	for _, b := range data[1:] {
+		if int(b) < len(eddystoneURLExpansions) {
+			url += eddystoneURLExpansions[b]
+		} else if b > 0x20 && b < 0x7f {
+			url += string(rune(b))
+		} else {
+			return "", fmt.Errorf("invalid eddystone URL character 0x%02x", b)
+		}
+	}
+	return url, nil
+}
+
+func formatUUID(b []byte) string {
+	s := hex.EncodeToString(b)
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:32]
+}
@@ -0,0 +1,136 @@
+package beacon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	iBeaconFrame = []byte{
+		0x02, 0x15,
+		0xf7, 0x82, 0x6d, 0xa6, 0x4f, 0xa2, 0x4e, 0x98, 0x80, 0x24, 0xbc, 0x5b, 0x71, 0xe0, 0x89, 0x3e,
+		0x00, 0x01, 0x00, 0x2a,
+		0xc5,
+	}
+	eddystoneUIDFrame = []byte{
+		0x00, 0xee,
+		0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a,
+		0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff,
+	}
+)
+
+func TestParseIBeacon(t *testing.T) {
+	beacon, err := ParseIBeacon(iBeaconFrame)
+	assert.NoError(t, err)
+	assert.Equal(t, TypeIBeacon, beacon.Type)
+	assert.Equal(t, "f7826da6-4fa2-4e98-8024-bc5b71e0893e", beacon.UUID)
+	assert.Equal(t, uint16(1), *beacon.Major)
+	assert.Equal(t, uint16(42), *beacon.Minor)
+	assert.Equal(t, int8(-59), beacon.TxPower)
+
+	_, err = ParseIBeacon([]byte{0x10, 0x05, 0x01})
+	assert.Error(t, err)
+}
+
+func TestParseEddystone(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected Beacon
+		wantErr  bool
+	}{
+		{
+			name:     "UID",
+			data:     eddystoneUIDFrame,
+			expected: Beacon{Type: TypeEddystoneUID, TxPower: -18, Namespace: "0102030405060708090a", Instance: "aabbccddeeff"},
+		},
+		{
+			name:     "URL",
+			data:     []byte{0x10, 0xf4, 0x03, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x07},
+			expected: Beacon{Type: TypeEddystoneURL, TxPower: -12, URL: "https://example.com"},
+		},
+		{
+			name: "TLM",
+			data: []byte{0x20, 0x00, 0x0b, 0xb8, 0x15, 0x80, 0x00, 0x00, 0x00, 0x64, 0x00, 0x00, 0x00, 0x32},
+			expected: Beacon{Type: TypeEddystoneTLM, Telemetry: &Telemetry{
+				BatteryMillivolts: 3000,
+				Temperature:       21.5,
+				AdvertisingCount:  100,
+				UptimeSeconds:     5,
+			}},
+		},
+		{name: "encrypted TLM", data: []byte{0x20, 0x01, 0x00}, wantErr: true},
+		{name: "unknown frame", data: []byte{0x30, 0x00}, wantErr: true},
+		{name: "truncated UID", data: []byte{0x00, 0xee, 0x01}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			beacon, err := ParseEddystone(tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, *beacon)
+		})
+	}
+}
+
+func TestScanner_Scan(t *testing.T) {
+	// Setup
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	rssi := int16(-70)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00"}}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66", RSSI: &rssi, ManufacturerData: map[uint16][]byte{0x004c: iBeaconFrame}},
+		{Address: "22:33:44:55:66:77", ServiceData: map[string][]byte{EddystoneServiceUUID: eddystoneUIDFrame}},
+		{Address: "33:44:55:66:77:88", Name: "Headset"},
+	}, nil)
+
+	hub := events.NewHub()
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	s := NewScanner(btMock, hub, time.Second, time.Minute)
+
+	// Test - a second scan does not report the same beacons again
+	s.Scan()
+	s.Scan()
+
+	// Assert
+	beacons := s.Beacons()
+	assert.Len(t, beacons, 2)
+	assert.Equal(t, TypeIBeacon, beacons[0].Type)
+	assert.Equal(t, "AA:BB:CC:DD:EE:00", beacons[0].Adapter)
+	assert.Equal(t, int16(-70), *beacons[0].RSSI)
+	assert.Equal(t, TypeEddystoneUID, beacons[1].Type)
+
+	assert.Len(t, ch, 2)
+	event := <-ch
+	assert.Equal(t, EventBeaconFound, event.Type)
+}
+
+func TestScanner_Lost(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00"}}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{}, nil)
+
+	hub := events.NewHub()
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	s := NewScanner(btMock, hub, time.Second, time.Minute)
+	s.beacons["11:22:33:44:55:66/ibeacon"] = Beacon{Type: TypeIBeacon, Address: "11:22:33:44:55:66", LastSeen: time.Now().Add(-2 * time.Minute)}
+
+	s.Scan()
+
+	assert.Empty(t, s.Beacons())
+	assert.Len(t, ch, 1)
+	event := <-ch
+	assert.Equal(t, EventBeaconLost, event.Type)
+}
@@ -0,0 +1,126 @@
+package beacon
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+const (
+	// EventBeaconFound is published when a beacon is seen for the first time
+	EventBeaconFound = "beacon_found"
+	// EventBeaconLost is published when a beacon has not been seen for the configured timeout
+	EventBeaconLost = "beacon_lost"
+)
+
+// Scanner periodically decodes the beacon advertisements seen by the adapters.
+// It does not start discovery itself, so it only sees beacons while an adapter is discovering.
+type Scanner struct {
+	btManager bluetooth.BluetoothManagerInterface
+	hub       *events.Hub
+	interval  time.Duration
+	timeout   time.Duration
+
+	mu      sync.RWMutex
+	beacons map[string]Beacon
+}
+
+// NewScanner creates a new beacon scanner
+func NewScanner(btManager bluetooth.BluetoothManagerInterface, hub *events.Hub, interval, timeout time.Duration) *Scanner {
+	return &Scanner{
+		btManager: btManager,
+		hub:       hub,
+		interval:  interval,
+		timeout:   timeout,
+		beacons:   make(map[string]Beacon),
+	}
+}
+
+// Run scans for beacons every interval until the context is cancelled
+func (s *Scanner) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Scan()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan updates the known beacons from the devices currently seen by the adapters
+func (s *Scanner) Scan() {
+	adapters, err := s.btManager.GetAdapters()
+	if err != nil {
+		log.Printf("Beacon Scanner: failed to list adapters: %v", err)
+		return
+	}
+
+	now := time.Now()
+	var found []Beacon
+
+	s.mu.Lock()
+	for _, adapter := range adapters {
+		devices, err := s.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			log.Printf("Beacon Scanner: failed to list devices of %s: %v", adapter.Address, err)
+			continue
+		}
+
+		for _, device := range devices {
+			for _, beacon := range Decode(device) {
+				beacon.Adapter = adapter.Address
+				beacon.LastSeen = now
+
+				key := beacon.Address + "/" + beacon.Type
+				if _, known := s.beacons[key]; !known {
+					found = append(found, beacon)
+				}
+				s.beacons[key] = beacon
+			}
+		}
+	}
+
+	var lost []Beacon
+	for key, beacon := range s.beacons {
+		if now.Sub(beacon.LastSeen) > s.timeout {
+			lost = append(lost, beacon)
+			delete(s.beacons, key)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, beacon := range found {
+		s.hub.Publish(EventBeaconFound, beacon)
+	}
+	for _, beacon := range lost {
+		s.hub.Publish(EventBeaconLost, beacon)
+	}
+}
+
+// Beacons returns the beacons currently in range, sorted by address
+func (s *Scanner) Beacons() []Beacon {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	beacons := make([]Beacon, 0, len(s.beacons))
+	for _, beacon := range s.beacons {
+		beacons = append(beacons, beacon)
+	}
+	sort.Slice(beacons, func(i, j int) bool {
+		if beacons[i].Address != beacons[j].Address {
+			return beacons[i].Address < beacons[j].Address
+		}
+		return beacons[i].Type < beacons[j].Type
+	})
+	return beacons
+}
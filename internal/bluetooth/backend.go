@@ -0,0 +1,93 @@
+package bluetooth
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bluezStartGrace is how long the dbus backend waits for bluetoothd before falling back to the
+// kernel backend
+const bluezStartGrace = 15 * time.Second
+
+// Factory creates a Bluetooth backend from the manager options
+type Factory func(opts Options) (BluetoothManagerInterface, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Factory)
+)
+
+func init() {
+	RegisterBackend(BackendDBus, func(opts Options) (BluetoothManagerInterface, error) {
+		// Without bluetoothd, the kernel backend keeps the adapters monitored. bluetoothd may just be
+		// starting along with the broker, so it is given some time before falling back.
+		if !waitForBluez(bluezRunning, bluezStartGrace, time.Second) {
+			log.Printf("Warning: org.bluez is not on the system bus after %s, falling back to the %s backend: only adapters are available", bluezStartGrace, BackendKernel)
+			return NewKernelManager(), nil
+		}
+		bm, err := NewBluetoothManagerWithOptions(opts)
+		if err != nil {
+			return nil, err
+		}
+		return bm, nil
+	})
+	RegisterBackend(BackendKernel, func(opts Options) (BluetoothManagerInterface, error) {
+		return NewKernelManager(), nil
+	})
+	RegisterBackend(BackendMock, func(opts Options) (BluetoothManagerInterface, error) {
+		return NewSimulatedManager(opts), nil
+	})
+}
+
+// waitForBluez reports whether bluetoothd is running, checking again at every interval until the
+// grace period is over
+func waitForBluez(running func() bool, grace, interval time.Duration) bool {
+	deadline := time.Now().Add(grace)
+	for !running() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(interval)
+	}
+	return true
+}
+
+// RegisterBackend makes a backend available under a name, it panics if the name is already registered
+func RegisterBackend(name string, factory Factory) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+
+	if _, exists := backends[name]; exists {
+		panic("bluetooth: backend " + name + " registered twice")
+	}
+	backends[name] = factory
+}
+
+// Backends returns the names of the registered backends, sorted
+func Backends() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewBackend creates the backend registered under a name
+func NewBackend(name string, opts Options) (BluetoothManagerInterface, error) {
+	backendsMu.RLock()
+	factory, ok := backends[name]
+	backendsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown Bluetooth backend %q, available backends: %s", name, strings.Join(Backends(), ", "))
+	}
+
+	return factory(opts)
+}
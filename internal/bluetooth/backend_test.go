@@ -0,0 +1,38 @@
+package bluetooth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBackend(t *testing.T) {
+	assert.Equal(t, []string{BackendDBus, BackendKernel, BackendMock}, Backends())
+
+	btManager, err := NewBackend(BackendMock, Options{})
+	assert.NoError(t, err)
+	assert.IsType(t, &SimulatedManager{}, btManager)
+
+	btManager, err = NewBackend(BackendKernel, Options{})
+	assert.NoError(t, err)
+	assert.IsType(t, &KernelManager{}, btManager)
+
+	_, err = NewBackend("hci", Options{})
+	assert.EqualError(t, err, `unknown Bluetooth backend "hci", available backends: dbus, kernel, mock`)
+
+	assert.Panics(t, func() { RegisterBackend(BackendMock, nil) })
+}
+
+func TestWaitForBluez(t *testing.T) {
+	// bluetoothd shows up on the third check
+	checks := 0
+	running := func() bool {
+		checks++
+		return checks >= 3
+	}
+	assert.True(t, waitForBluez(running, time.Second, time.Millisecond))
+	assert.Equal(t, 3, checks)
+
+	assert.False(t, waitForBluez(func() bool { return false }, 10*time.Millisecond, time.Millisecond))
+}
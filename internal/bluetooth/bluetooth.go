@@ -3,9 +3,14 @@ package bluetooth
 import (
 	"fmt"
 	"log"
+	"path"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/godbus/dbus/v5"
+	"github.com/nerzhul/home-bt-broker/internal/rfkill"
 )
 
 const (
@@ -13,6 +18,7 @@ const (
 	BluezObjectPath     = "/"
 	AdapterInterface    = "org.bluez.Adapter1"
 	DeviceInterface     = "org.bluez.Device1"
+	BatteryInterface    = "org.bluez.Battery1"
 	AgentManagerIface   = "org.bluez.AgentManager1"
 	AgentInterface      = "org.bluez.Agent1"
 	ObjectManagerIface  = "org.freedesktop.DBus.ObjectManager"
@@ -21,6 +27,36 @@ const (
 type BluetoothManager struct {
 	conn      *dbus.Conn
 	agentPath dbus.ObjectPath
+	// agent is set once the pairing agent is registered with BlueZ
+	agent bool
+
+	// pairingMu protects pairingOptions, read by the agent while a pairing is in progress,
+	// and the pairingAllowed policy
+	pairingMu      sync.Mutex
+	pairingOptions map[dbus.ObjectPath]PairOptions
+	pairingAllowed func(address string) bool
+
+	pairingMode     string
+	pairingRequests *pairingQueue
+}
+
+// Options configures the Bluetooth manager
+type Options struct {
+	// PairingMode is PairingModeAuto (default) or PairingModeManual
+	PairingMode string
+	// PairingRequestTimeout is how long a manual pairing request waits for a decision
+	PairingRequestTimeout time.Duration
+	// NoAgent skips the registration of the pairing agent, for short-lived clients such as the
+	// command line that must not take the default agent over from a running broker
+	NoAgent bool
+}
+
+// PairOptions holds the credentials returned by the agent when BlueZ asks for them during a pairing
+type PairOptions struct {
+	// PIN is returned on RequestPinCode, for legacy devices with a fixed PIN
+	PIN string
+	// Passkey is returned on RequestPasskey
+	Passkey *uint32
 }
 
 type Adapter struct {
@@ -29,35 +65,119 @@ type Adapter struct {
 	Address      string `json:"address"`
 	Powered      bool   `json:"powered"`
 	Discoverable bool   `json:"discoverable"`
+	Pairable     bool   `json:"pairable"`
 	Discovering  bool   `json:"discovering"`
+	// Rfkill is the block state of the adapter radio, when it can be read from /dev/rfkill
+	Rfkill *rfkill.State `json:"rfkill,omitempty"`
+	// Experimental lists the experimental BlueZ interfaces available on the adapter
+	Experimental Experimental `json:"experimental"`
+	// Roles are the LE roles of the adapter, such as central and peripheral
+	Roles []string `json:"roles"`
+	// Transports are the radios of the adapter, TransportBREDR and TransportLE
+	Transports []string `json:"transports"`
+	// UUIDs are the services registered on the adapter by bluetoothd and its clients
+	UUIDs []string `json:"uuids,omitempty"`
 }
 
+
 type Device struct {
-	Path      string `json:"path"`
-	Name      string `json:"name"`
-	Address   string `json:"address"`
-	Paired    bool   `json:"paired"`
-	Trusted   bool   `json:"trusted"`
-	Connected bool   `json:"connected"`
-	Adapter   string `json:"adapter"`
+	Path         string   `json:"path"`
+	Name         string   `json:"name"`
+	Address      string   `json:"address"`
+	Paired       bool     `json:"paired"`
+	Trusted      bool     `json:"trusted"`
+	Connected    bool     `json:"connected"`
+	// ServicesResolved is set once BlueZ has resolved the services of the connected device
+	ServicesResolved bool `json:"services_resolved"`
+	Adapter      string   `json:"adapter"`
+	// WakeAllowed is only reported by devices able to wake the host from suspend
+	WakeAllowed  *bool    `json:"wake_allowed,omitempty"`
+	Battery      *uint8   `json:"battery,omitempty"`
+	// Volume is the AVRCP absolute volume in percent, only reported while an audio transport is open
+	Volume       *uint8   `json:"volume,omitempty"`
+	// AudioState is the state of the audio stream of the device: idle, pending or active
+	AudioState   string   `json:"audio_state,omitempty"`
+	// Broadcast is only reported by LE Audio broadcast (Auracast) sources
+	Broadcast    *Broadcast `json:"broadcast,omitempty"`
+	// Set is only reported by members of a coordinated set, such as LE Audio earbuds
+	Set          *SetMembership `json:"set,omitempty"`
+	RSSI         *int16   `json:"rssi,omitempty"`
+	Class        uint32   `json:"class,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	Subtype      string   `json:"subtype,omitempty"`
+	Icon         string   `json:"icon,omitempty"`
+	UUIDs        []string `json:"uuids,omitempty"`
+	Capabilities []string `json:"capabilities"`
+	// ConnectedProfiles are the UUIDs of the profiles currently connected, empty for a device connected
+	// with no profile attached
+	ConnectedProfiles []string `json:"connected_profiles"`
+	// Owner is the broker user who paired the device through the API, filled in by the API handlers
+	Owner        string   `json:"owner,omitempty"`
+
+	// Raw advertisement payloads, decoded by the beacon scanner
+	ManufacturerData map[uint16][]byte `json:"-"`
+	ServiceData      map[string][]byte `json:"-"`
+}
+
+// Discovery transports accepted by SetDiscoveryFilter
+const (
+	TransportAuto  = "auto"
+	TransportLE    = "le"
+	TransportBREDR = "bredr"
+)
+
+// DiscoveryFilter restricts the devices reported during discovery
+type DiscoveryFilter struct {
+	// Transport limits discovery to LE or BR/EDR devices, or both with "auto"
+	Transport string
+	// DuplicateData reports repeated advertisements of a device, keeping its RSSI up to date.
+	// BlueZ's default is used when nil.
+	DuplicateData *bool
+}
+
+// ValidTransport reports whether a discovery transport is supported by BlueZ
+func ValidTransport(transport string) bool {
+	switch transport {
+	case TransportAuto, TransportLE, TransportBREDR:
+		return true
+	}
+	return false
 }
 
 // NewBluetoothManager creates a new Bluetooth manager instance
 func NewBluetoothManager() (*BluetoothManager, error) {
+	return NewBluetoothManagerWithOptions(Options{})
+}
+
+// NewBluetoothManagerWithOptions creates a new Bluetooth manager instance with custom options
+func NewBluetoothManagerWithOptions(opts Options) (*BluetoothManager, error) {
+	if opts.PairingMode == "" {
+		opts.PairingMode = PairingModeAuto
+	}
+	if opts.PairingRequestTimeout == 0 {
+		opts.PairingRequestTimeout = 30 * time.Second
+	}
+
 	conn, err := dbus.SystemBus()
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to D-Bus: %w", err)
 	}
 
 	bm := &BluetoothManager{
-		conn:      conn,
-		agentPath: "/org/bluez/AutoPairAgent",
+		conn:            conn,
+		agentPath:       "/org/bluez/AutoPairAgent",
+		pairingOptions:  make(map[dbus.ObjectPath]PairOptions),
+		pairingMode:     opts.PairingMode,
+		pairingRequests: newPairingQueue(opts.PairingRequestTimeout),
 	}
 
 	// Register the agent
-	if err := bm.registerAgent(); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to register agent: %w", err)
+	if !opts.NoAgent {
+		if err := bm.registerAgent(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to register agent: %w", err)
+		}
+		bm.agent = true
 	}
 
 	return bm, nil
@@ -67,11 +187,23 @@ func NewBluetoothManager() (*BluetoothManager, error) {
 func (bm *BluetoothManager) Close() {
 	if bm.conn != nil {
 		// Unregister agent before closing
-		bm.unregisterAgent()
+		if bm.agent {
+			bm.unregisterAgent()
+		}
 		bm.conn.Close()
 	}
 }
 
+// Conn returns the D-Bus system bus connection, to subscribe to BlueZ signals
+func (bm *BluetoothManager) Conn() *dbus.Conn {
+	return bm.conn
+}
+
+// Ping checks the D-Bus connection answers with a round trip to the bus daemon
+func (bm *BluetoothManager) Ping() error {
+	return bm.conn.BusObject().Call("org.freedesktop.DBus.Peer.Ping", 0).Err
+}
+
 // GetAdapters returns a list of all Bluetooth adapters
 func (bm *BluetoothManager) GetAdapters() ([]Adapter, error) {
 	obj := bm.conn.Object(BluezService, BluezObjectPath)
@@ -86,11 +218,19 @@ func (bm *BluetoothManager) GetAdapters() ([]Adapter, error) {
 		return nil, fmt.Errorf("failed to parse managed objects: %w", err)
 	}
 
+	// A soft-blocked adapter is only reported as powered off by BlueZ, the state is omitted if unreadable
+	rfkillStates, _ := rfkill.States()
+
 	var adapters []Adapter
-	for path, interfaces := range objects {
+	for objectPath, interfaces := range objects {
 		if adapterProps, exists := interfaces[AdapterInterface]; exists {
 			adapter := Adapter{
-				Path: string(path),
+				Path: string(objectPath),
+			}
+			if index, err := rfkill.AdapterIndex(path.Base(adapter.Path)); err == nil {
+				if state, ok := rfkillStates[index]; ok {
+					adapter.Rfkill = &state
+				}
 			}
 			
 			if name, ok := adapterProps["Name"]; ok {
@@ -105,9 +245,18 @@ func (bm *BluetoothManager) GetAdapters() ([]Adapter, error) {
 			if discoverable, ok := adapterProps["Discoverable"]; ok {
 				adapter.Discoverable = discoverable.Value().(bool)
 			}
+			if pairable, ok := adapterProps["Pairable"]; ok {
+				adapter.Pairable = pairable.Value().(bool)
+			}
 			if discovering, ok := adapterProps["Discovering"]; ok {
 				adapter.Discovering = discovering.Value().(bool)
 			}
+			adapter.Experimental = decodeExperimental(interfaces)
+			adapter.Roles, adapter.Transports = decodeCapabilities(adapterProps)
+			if _, ok := adapterProps["Roles"]; !ok {
+				adapter.Transports = legacyTransports(adapter.Path, adapter.Transports)
+			}
+			adapter.UUIDs, _ = adapterProps["UUIDs"].Value().([]string)
 			
 			adapters = append(adapters, adapter)
 		}
@@ -130,6 +279,11 @@ func (bm *BluetoothManager) GetDevices(adapterPath string) ([]Device, error) {
 		return nil, fmt.Errorf("failed to parse managed objects: %w", err)
 	}
 
+	volumes := transportVolumes(objects)
+	transports := transportStates(objects)
+	profiles := connectedProfiles(objects)
+	gattBatteries := gattBatteryLevels(objects)
+
 	var devices []Device
 	for path, interfaces := range objects {
 		if deviceProps, exists := interfaces[DeviceInterface]; exists {
@@ -159,6 +313,76 @@ func (bm *BluetoothManager) GetDevices(adapterPath string) ([]Device, error) {
 			if connected, ok := deviceProps["Connected"]; ok {
 				device.Connected = connected.Value().(bool)
 			}
+			if resolved, ok := deviceProps["ServicesResolved"]; ok {
+				device.ServicesResolved = resolved.Value().(bool)
+			}
+			if wakeAllowed, ok := deviceProps["WakeAllowed"]; ok {
+				value := wakeAllowed.Value().(bool)
+				device.WakeAllowed = &value
+			}
+			if class, ok := deviceProps["Class"]; ok {
+				device.Class = class.Value().(uint32)
+				device.Type, device.Subtype = DecodeClass(device.Class)
+			}
+			if icon, ok := deviceProps["Icon"]; ok {
+				device.Icon = icon.Value().(string)
+			}
+			if uuids, ok := deviceProps["UUIDs"]; ok {
+				device.UUIDs = uuids.Value().([]string)
+			}
+			device.Capabilities = Capabilities(device.UUIDs)
+			if data, ok := deviceProps["ManufacturerData"]; ok {
+				if values, ok := data.Value().(map[uint16]dbus.Variant); ok {
+					device.ManufacturerData = make(map[uint16][]byte, len(values))
+					for id, value := range values {
+						if b, ok := value.Value().([]byte); ok {
+							device.ManufacturerData[id] = b
+						}
+					}
+				}
+			}
+			if data, ok := deviceProps["ServiceData"]; ok {
+				if values, ok := data.Value().(map[string]dbus.Variant); ok {
+					device.ServiceData = make(map[string][]byte, len(values))
+					for uuid, value := range values {
+						if b, ok := value.Value().([]byte); ok {
+							device.ServiceData[strings.ToLower(uuid)] = b
+						}
+					}
+				}
+			}
+			if sets, ok := deviceProps["Sets"]; ok {
+				device.Set = decodeSetMembership(sets)
+			}
+			if rssi, ok := deviceProps["RSSI"]; ok {
+				value := rssi.Value().(int16)
+				device.RSSI = &value
+			}
+			if batteryProps, ok := interfaces[BatteryInterface]; ok {
+				if percentage, ok := batteryProps["Percentage"]; ok {
+					battery := percentage.Value().(byte)
+					device.Battery = &battery
+				}
+				if !containsString(device.Capabilities, "battery") {
+					device.Capabilities = append(device.Capabilities, "battery")
+					sort.Strings(device.Capabilities)
+				}
+			} else if level, ok := gattBatteries[path]; ok {
+				device.Battery = &level
+				if !containsString(device.Capabilities, "battery") {
+					device.Capabilities = append(device.Capabilities, "battery")
+					sort.Strings(device.Capabilities)
+				}
+			}
+			if volume, ok := volumes[path]; ok {
+				device.Volume = &volume
+			}
+			device.AudioState = transports[path]
+			device.ConnectedProfiles = profiles[path]
+			if device.ConnectedProfiles == nil {
+				device.ConnectedProfiles = []string{}
+			}
+			device.Broadcast = decodeBroadcast(device.ServiceData, transports[path])
 			
 			devices = append(devices, device)
 		}
@@ -214,6 +438,32 @@ func (bm *BluetoothManager) ConnectDevice(adapterPath, macAddress string) error
 	return nil
 }
 
+// DisconnectDevice disconnects every profile of a device
+func (bm *BluetoothManager) DisconnectDevice(adapterPath, macAddress string) error {
+	devicePath := fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_"))
+
+	obj := bm.conn.Object(BluezService, dbus.ObjectPath(devicePath))
+	call := obj.Call(DeviceInterface+".Disconnect", 0)
+	if call.Err != nil {
+		return fmt.Errorf("failed to disconnect device %s: %w", macAddress, call.Err)
+	}
+
+	return nil
+}
+
+// ConnectProfile connects a single profile of a device, identified by its UUID
+func (bm *BluetoothManager) ConnectProfile(adapterPath, macAddress, uuid string) error {
+	devicePath := fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_"))
+
+	obj := bm.conn.Object(BluezService, dbus.ObjectPath(devicePath))
+	call := obj.Call(DeviceInterface+".ConnectProfile", 0, uuid)
+	if call.Err != nil {
+		return fmt.Errorf("failed to connect profile %s of device %s: %w", uuid, macAddress, call.Err)
+	}
+
+	return nil
+}
+
 // TrustDevice sets a device as trusted by MAC address
 func (bm *BluetoothManager) TrustDevice(adapterPath, macAddress string) error {
 	devicePath := fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_"))
@@ -227,6 +477,35 @@ func (bm *BluetoothManager) TrustDevice(adapterPath, macAddress string) error {
 	return nil
 }
 
+// UntrustDevice removes the trust of a device by MAC address
+func (bm *BluetoothManager) UntrustDevice(adapterPath, macAddress string) error {
+	devicePath := fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_"))
+
+	obj := bm.conn.Object(BluezService, dbus.ObjectPath(devicePath))
+	call := obj.Call("org.freedesktop.DBus.Properties.Set", 0, DeviceInterface, "Trusted", dbus.MakeVariant(false))
+	if call.Err != nil {
+		return fmt.Errorf("failed to untrust device %s: %w", macAddress, call.Err)
+	}
+
+	return nil
+}
+
+// SetWakeAllowed allows or forbids a device to wake the host from suspend
+func (bm *BluetoothManager) SetWakeAllowed(adapterPath, macAddress string, allow bool) error {
+	devicePath := fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_"))
+
+	obj := bm.conn.Object(BluezService, dbus.ObjectPath(devicePath))
+	call := obj.Call("org.freedesktop.DBus.Properties.Set", 0, DeviceInterface, "WakeAllowed", dbus.MakeVariant(allow))
+	if isUnknownToBlueZ(call.Err) {
+		return unsupported("wake allowed", "5.51")
+	}
+	if call.Err != nil {
+		return fmt.Errorf("failed to set wake allowed on device %s: %w", macAddress, call.Err)
+	}
+
+	return nil
+}
+
 // GetAdapterPathByMAC resolves an adapter MAC address to its D-Bus path
 func (bm *BluetoothManager) GetAdapterPathByMAC(macAddress string) (string, error) {
 	adapters, err := bm.GetAdapters()
@@ -245,8 +524,22 @@ func (bm *BluetoothManager) GetAdapterPathByMAC(macAddress string) (string, erro
 
 // PairDevice pairs with a device by MAC address and auto-accepts PIN/passkey
 func (bm *BluetoothManager) PairDevice(adapterPath, macAddress string) error {
+	return bm.PairDeviceWithOptions(adapterPath, macAddress, PairOptions{})
+}
+
+// PairDeviceWithOptions pairs with a device by MAC address, answering agent requests with the given credentials
+func (bm *BluetoothManager) PairDeviceWithOptions(adapterPath, macAddress string, opts PairOptions) error {
 	devicePath := fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_"))
-	
+
+	bm.pairingMu.Lock()
+	bm.pairingOptions[dbus.ObjectPath(devicePath)] = opts
+	bm.pairingMu.Unlock()
+	defer func() {
+		bm.pairingMu.Lock()
+		delete(bm.pairingOptions, dbus.ObjectPath(devicePath))
+		bm.pairingMu.Unlock()
+	}()
+
 	obj := bm.conn.Object(BluezService, dbus.ObjectPath(devicePath))
 	call := obj.Call(DeviceInterface+".Pair", 0)
 	if call.Err != nil {
@@ -256,6 +549,19 @@ func (bm *BluetoothManager) PairDevice(adapterPath, macAddress string) error {
 	return nil
 }
 
+// CancelPairing aborts an ongoing pairing with a device by MAC address
+func (bm *BluetoothManager) CancelPairing(adapterPath, macAddress string) error {
+	devicePath := fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_"))
+
+	obj := bm.conn.Object(BluezService, dbus.ObjectPath(devicePath))
+	call := obj.Call(DeviceInterface+".CancelPairing", 0)
+	if call.Err != nil {
+		return fmt.Errorf("failed to cancel pairing with device %s: %w", macAddress, call.Err)
+	}
+
+	return nil
+}
+
 // RemoveDevice removes a device by MAC address
 func (bm *BluetoothManager) RemoveDevice(adapterPath, macAddress string) error {
 	devicePath := fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_"))
@@ -269,6 +575,16 @@ func (bm *BluetoothManager) RemoveDevice(adapterPath, macAddress string) error {
 	return nil
 }
 
+// SetPowered powers an adapter on or off
+func (bm *BluetoothManager) SetPowered(adapterPath string, enable bool) error {
+	obj := bm.conn.Object(BluezService, dbus.ObjectPath(adapterPath))
+	call := obj.Call("org.freedesktop.DBus.Properties.Set", 0, AdapterInterface, "Powered", dbus.MakeVariant(enable))
+	if call.Err != nil {
+		return fmt.Errorf("failed to set powered: %w", call.Err)
+	}
+	return nil
+}
+
 // SetDiscoverable enables or disables discoverable mode on an adapter
 func (bm *BluetoothManager) SetDiscoverable(adapterPath string, enable bool) error {
        obj := bm.conn.Object(BluezService, dbus.ObjectPath(adapterPath))
@@ -279,6 +595,16 @@ func (bm *BluetoothManager) SetDiscoverable(adapterPath string, enable bool) err
        return nil
 }
 
+// SetPairable allows or forbids new devices to pair with an adapter
+func (bm *BluetoothManager) SetPairable(adapterPath string, enable bool) error {
+	obj := bm.conn.Object(BluezService, dbus.ObjectPath(adapterPath))
+	call := obj.Call("org.freedesktop.DBus.Properties.Set", 0, AdapterInterface, "Pairable", dbus.MakeVariant(enable))
+	if call.Err != nil {
+		return fmt.Errorf("failed to set pairable: %w", call.Err)
+	}
+	return nil
+}
+
 // SetDiscovering enables or disables device scanning (discovery) on an adapter
 func (bm *BluetoothManager) SetDiscovering(adapterPath string, enable bool) error {
        obj := bm.conn.Object(BluezService, dbus.ObjectPath(adapterPath))
@@ -294,6 +620,27 @@ func (bm *BluetoothManager) SetDiscovering(adapterPath string, enable bool) erro
        return nil
 }
 
+// SetDiscoveryFilter sets the filter applied to the next discovery sessions of this client on an adapter.
+// An empty filter resets it so every device is reported.
+func (bm *BluetoothManager) SetDiscoveryFilter(adapterPath string, filter DiscoveryFilter) error {
+	props := map[string]dbus.Variant{}
+	if filter.Transport != "" {
+		props["Transport"] = dbus.MakeVariant(filter.Transport)
+	}
+	if filter.DuplicateData != nil {
+		props["DuplicateData"] = dbus.MakeVariant(*filter.DuplicateData)
+	}
+
+	obj := bm.conn.Object(BluezService, dbus.ObjectPath(adapterPath))
+	call := obj.Call(AdapterInterface+".SetDiscoveryFilter", 0, props)
+	if call.Err != nil {
+		if err := bm.setDiscoveryFilterCompat(adapterPath, props, call.Err); err != nil {
+			return fmt.Errorf("failed to set discovery filter: %w", err)
+		}
+	}
+	return nil
+}
+
 // Agent methods for automatic pairing authentication
 //
 // How the agent works:
@@ -319,7 +666,12 @@ func (bm *BluetoothManager) registerAgent() error {
 
 	// Register with agent manager
 	obj := bm.conn.Object(BluezService, "/org/bluez")
-	call := obj.Call(AgentManagerIface+".RegisterAgent", 0, bm.agentPath, "NoInputNoOutput")
+	// A manual agent displays passkeys and asks for confirmation, enabling numeric comparison pairing
+	capability := "NoInputNoOutput"
+	if bm.pairingMode == PairingModeManual {
+		capability = "DisplayYesNo"
+	}
+	call := obj.Call(AgentManagerIface+".RegisterAgent", 0, bm.agentPath, capability)
 	if call.Err != nil {
 		return fmt.Errorf("failed to register agent: %w", call.Err)
 	}
@@ -344,44 +696,129 @@ func (bm *BluetoothManager) unregisterAgent() error {
 
 // Agent interface implementations - automatically accept all authentication
 
-// RequestPinCode automatically provides a default PIN
+// pairOptions returns the credentials supplied for the pairing in progress with a device
+func (bm *BluetoothManager) pairOptions(device dbus.ObjectPath) PairOptions {
+	bm.pairingMu.Lock()
+	defer bm.pairingMu.Unlock()
+	return bm.pairingOptions[device]
+}
+
+// SetPairingPolicy registers a function deciding which devices may pair. Agent requests from other
+// devices are rejected, unless the pairing was started through PairDevice. A nil policy allows every device.
+func (bm *BluetoothManager) SetPairingPolicy(allowed func(address string) bool) {
+	bm.pairingMu.Lock()
+	defer bm.pairingMu.Unlock()
+	bm.pairingAllowed = allowed
+}
+
+// checkPairingPolicy rejects an agent request from a device refused by the pairing policy
+func (bm *BluetoothManager) checkPairingPolicy(method string, device dbus.ObjectPath) *dbus.Error {
+	bm.pairingMu.Lock()
+	allowed := bm.pairingAllowed
+	_, requested := bm.pairingOptions[device]
+	bm.pairingMu.Unlock()
+
+	if allowed == nil || requested || allowed(addressFromPath(device)) {
+		return nil
+	}
+	log.Printf("Bluetooth Agent: %s for device %s - rejected by the pairing allowlist", method, device)
+	return dbus.NewError("org.bluez.Error.Rejected", nil)
+}
+
+// RequestPinCode provides the PIN supplied with the pair request, or a default PIN
 func (bm *BluetoothManager) RequestPinCode(device dbus.ObjectPath) (string, *dbus.Error) {
+	if err := bm.checkPairingPolicy("RequestPinCode", device); err != nil {
+		return "", err
+	}
+	if opts := bm.pairOptions(device); opts.PIN != "" {
+		log.Printf("Bluetooth Agent: RequestPinCode for device %s - providing requested PIN", device)
+		return opts.PIN, nil
+	}
 	log.Printf("Bluetooth Agent: RequestPinCode for device %s - providing default PIN: 0000", device)
 	return "0000", nil
 }
 
 // DisplayPinCode accepts the displayed PIN
 func (bm *BluetoothManager) DisplayPinCode(device dbus.ObjectPath, pincode string) *dbus.Error {
+	if err := bm.checkPairingPolicy("DisplayPinCode", device); err != nil {
+		return err
+	}
 	log.Printf("Bluetooth Agent: DisplayPinCode for device %s - PIN: %s", device, pincode)
+	req, err := newPairingRequest(PairingDisplayPinCode, device)
+	if err != nil {
+		log.Printf("Bluetooth Agent: DisplayPinCode for device %s: %v", device, err)
+		return dbus.MakeFailedError(err)
+	}
+	req.PinCode = pincode
+	bm.pairingRequests.publish(EventPairingDisplay, req)
 	return nil
 }
 
-// RequestPasskey automatically provides a default passkey
+// RequestPasskey provides the passkey supplied with the pair request, or a default passkey
 func (bm *BluetoothManager) RequestPasskey(device dbus.ObjectPath) (uint32, *dbus.Error) {
+	if err := bm.checkPairingPolicy("RequestPasskey", device); err != nil {
+		return 0, err
+	}
+	if opts := bm.pairOptions(device); opts.Passkey != nil {
+		log.Printf("Bluetooth Agent: RequestPasskey for device %s - providing requested passkey", device)
+		return *opts.Passkey, nil
+	}
 	log.Printf("Bluetooth Agent: RequestPasskey for device %s - providing default passkey: 0", device)
 	return 0, nil
 }
 
 // DisplayPasskey accepts the displayed passkey
 func (bm *BluetoothManager) DisplayPasskey(device dbus.ObjectPath, passkey uint32, entered uint16) *dbus.Error {
+	if err := bm.checkPairingPolicy("DisplayPasskey", device); err != nil {
+		return err
+	}
 	log.Printf("Bluetooth Agent: DisplayPasskey for device %s - passkey: %d, entered: %d", device, passkey, entered)
+	req, err := newPairingRequest(PairingDisplayPasskey, device)
+	if err != nil {
+		log.Printf("Bluetooth Agent: DisplayPasskey for device %s: %v", device, err)
+		return dbus.MakeFailedError(err)
+	}
+	req.Passkey = &passkey
+	req.Entered = &entered
+	bm.pairingRequests.publish(EventPairingDisplay, req)
 	return nil
 }
 
-// RequestConfirmation automatically confirms pairing
+// RequestConfirmation confirms pairing, automatically or once accepted in manual mode
 func (bm *BluetoothManager) RequestConfirmation(device dbus.ObjectPath, passkey uint32) *dbus.Error {
+	if err := bm.checkPairingPolicy("RequestConfirmation", device); err != nil {
+		return err
+	}
+	if bm.pairingMode == PairingModeManual {
+		log.Printf("Bluetooth Agent: RequestConfirmation for device %s - passkey: %d - waiting for a decision", device, passkey)
+		return bm.waitPairingDecision(PairingRequestConfirmation, device, &passkey, "")
+	}
 	log.Printf("Bluetooth Agent: RequestConfirmation for device %s - passkey: %d - auto-confirming", device, passkey)
 	return nil
 }
 
-// RequestAuthorization automatically authorizes pairing
+// RequestAuthorization authorizes pairing, automatically or once accepted in manual mode
 func (bm *BluetoothManager) RequestAuthorization(device dbus.ObjectPath) *dbus.Error {
+	if err := bm.checkPairingPolicy("RequestAuthorization", device); err != nil {
+		return err
+	}
+	if bm.pairingMode == PairingModeManual {
+		log.Printf("Bluetooth Agent: RequestAuthorization for device %s - waiting for a decision", device)
+		return bm.waitPairingDecision(PairingRequestAuthorization, device, nil, "")
+	}
 	log.Printf("Bluetooth Agent: RequestAuthorization for device %s - auto-authorizing", device)
 	return nil
 }
 
-// AuthorizeService automatically authorizes service usage
+// AuthorizeService authorizes service usage, automatically or once accepted in manual mode
 func (bm *BluetoothManager) AuthorizeService(device dbus.ObjectPath, uuid string) *dbus.Error {
+	if err := bm.checkPairingPolicy("AuthorizeService", device); err != nil {
+		return err
+	}
+	if bm.pairingMode == PairingModeManual {
+		log.Printf("Bluetooth Agent: AuthorizeService for device %s, service UUID: %s - waiting for a decision", device, uuid)
+		return bm.waitPairingDecision(PairingRequestService, device, nil, uuid)
+	}
 	log.Printf("Bluetooth Agent: AuthorizeService for device %s, service UUID: %s - auto-authorizing", device, uuid)
 	return nil
 }
@@ -389,9 +826,45 @@ func (bm *BluetoothManager) AuthorizeService(device dbus.ObjectPath, uuid string
 // Cancel handles cancellation of pairing process
 func (bm *BluetoothManager) Cancel() *dbus.Error {
 	log.Printf("Bluetooth Agent: Cancel called - pairing process cancelled")
+	bm.pairingRequests.cancelAll()
 	return nil
 }
 
+// waitPairingDecision parks an agent request in the pairing queue and rejects it unless it is accepted
+func (bm *BluetoothManager) waitPairingDecision(requestType string, device dbus.ObjectPath, passkey *uint32, uuid string) *dbus.Error {
+	req, err := newPairingRequest(requestType, device)
+	if err != nil {
+		log.Printf("Bluetooth Agent: %s request for device %s: %v", requestType, device, err)
+		return dbus.MakeFailedError(err)
+	}
+	req.Passkey = passkey
+	req.UUID = uuid
+	if !bm.pairingRequests.wait(req) {
+		log.Printf("Bluetooth Agent: %s request for device %s rejected", requestType, device)
+		return dbus.NewError("org.bluez.Error.Rejected", nil)
+	}
+	log.Printf("Bluetooth Agent: %s request for device %s accepted", requestType, device)
+	return nil
+}
+
+// GetPairingRequests returns the agent requests waiting for a decision in manual pairing mode
+func (bm *BluetoothManager) GetPairingRequests() []PairingRequest {
+	return bm.pairingRequests.list()
+}
+
+// RespondPairingRequest accepts or rejects a pending agent request
+func (bm *BluetoothManager) RespondPairingRequest(id string, accept bool) error {
+	return bm.pairingRequests.respond(id, accept)
+}
+
+// SetPairingNotifier registers a function called with the pairing events: a request waits for a decision
+// or is resolved, or a passkey or PIN must be displayed
+func (bm *BluetoothManager) SetPairingNotifier(notify func(eventType string, req PairingRequest)) {
+	bm.pairingRequests.mu.Lock()
+	defer bm.pairingRequests.mu.Unlock()
+	bm.pairingRequests.notify = notify
+}
+
 // Release handles agent release
 func (bm *BluetoothManager) Release() *dbus.Error {
 	log.Printf("Bluetooth Agent: Release called - agent being released")
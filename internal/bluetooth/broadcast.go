@@ -0,0 +1,103 @@
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// BroadcastAudioAnnouncementUUID is the service data UUID advertised by LE Audio broadcast (Auracast) sources
+const BroadcastAudioAnnouncementUUID = "00001852" + bluetoothBaseUUIDSuffix
+
+// BroadcastDiscovered is the state of a broadcast source BlueZ did not synchronize to yet. The other states
+// are the ones of its BlueZ transports: idle, pending, broadcasting or active.
+const BroadcastDiscovered = "discovered"
+
+// ErrNoBroadcastTransport is returned when joining a broadcast BlueZ exposes no stream of, e.g. because
+// bluetoothd runs without the ISO socket experimental feature or the source is not a broadcast
+var ErrNoBroadcastTransport = errors.New("no broadcast stream exposed for the device")
+
+// Broadcast is the LE Audio broadcast announced by a device
+type Broadcast struct {
+	// ID is the 24-bit broadcast ID of the announcement
+	ID    uint32 `json:"id"`
+	State string `json:"state"`
+}
+
+// decodeBroadcast reads the broadcast announcement of a device, it returns nil for other devices
+func decodeBroadcast(serviceData map[string][]byte, transportState string) *Broadcast {
+	data, ok := serviceData[BroadcastAudioAnnouncementUUID]
+	if !ok || len(data) < 3 {
+		return nil
+	}
+
+	broadcast := &Broadcast{
+		ID:    uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16,
+		State: transportState,
+	}
+	if broadcast.State == "" {
+		broadcast.State = BroadcastDiscovered
+	}
+	return broadcast
+}
+
+// transportStates maps the device paths to the state of their first media transport
+func transportStates(objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant) map[dbus.ObjectPath]string {
+	states := make(map[dbus.ObjectPath]string)
+	for _, interfaces := range objects {
+		props, ok := interfaces[MediaTransportInterface]
+		if !ok {
+			continue
+		}
+		device, _ := props["Device"].Value().(dbus.ObjectPath)
+		if state, ok := props["State"].Value().(string); ok && states[device] == "" {
+			states[device] = state
+		}
+	}
+	return states
+}
+
+// JoinBroadcast selects the streams of a broadcast source so that the audio server of the adapter
+// acquires them and plays the broadcast
+func (bm *BluetoothManager) JoinBroadcast(adapterPath, macAddress string) error {
+	return bm.callBroadcastTransports(adapterPath, macAddress, "Select", "join")
+}
+
+// LeaveBroadcast releases the streams of a broadcast source
+func (bm *BluetoothManager) LeaveBroadcast(adapterPath, macAddress string) error {
+	return bm.callBroadcastTransports(adapterPath, macAddress, "Unselect", "leave")
+}
+
+// callBroadcastTransports calls a method of every transport of a broadcast source
+func (bm *BluetoothManager) callBroadcastTransports(adapterPath, macAddress, method, action string) error {
+	devicePath := dbus.ObjectPath(fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_")))
+
+	objects, err := bm.managedObjects()
+	if err != nil {
+		return err
+	}
+
+	called := 0
+	for path, interfaces := range objects {
+		props, ok := interfaces[MediaTransportInterface]
+		if !ok {
+			continue
+		}
+		if device, _ := props["Device"].Value().(dbus.ObjectPath); device != devicePath {
+			continue
+		}
+
+		call := bm.conn.Object(BluezService, path).Call(MediaTransportInterface+"."+method, 0)
+		if call.Err != nil {
+			return fmt.Errorf("failed to %s broadcast of device %s: %w", action, macAddress, call.Err)
+		}
+		called++
+	}
+
+	if called == 0 {
+		return fmt.Errorf("failed to %s broadcast of device %s: %w", action, macAddress, ErrNoBroadcastTransport)
+	}
+	return nil
+}
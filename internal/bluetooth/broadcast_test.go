@@ -0,0 +1,44 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeBroadcast(t *testing.T) {
+	serviceData := map[string][]byte{BroadcastAudioAnnouncementUUID: {0x56, 0x34, 0x12}}
+
+	assert.Equal(t, &Broadcast{ID: 0x123456, State: BroadcastDiscovered}, decodeBroadcast(serviceData, ""))
+	assert.Equal(t, &Broadcast{ID: 0x123456, State: "active"}, decodeBroadcast(serviceData, "active"))
+	assert.Nil(t, decodeBroadcast(map[string][]byte{BroadcastAudioAnnouncementUUID: {0x01}}, ""))
+	assert.Nil(t, decodeBroadcast(nil, "active"))
+}
+
+func TestTransportStates(t *testing.T) {
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{
+		"/org/bluez/hci0/dev_C8_7A_12_34_56_01/bis1/fd0": {MediaTransportInterface: {
+			"Device": dbus.MakeVariant(dbus.ObjectPath("/org/bluez/hci0/dev_C8_7A_12_34_56_01")),
+			"State":  dbus.MakeVariant("broadcasting"),
+		}},
+	}
+
+	assert.Equal(t, map[dbus.ObjectPath]string{"/org/bluez/hci0/dev_C8_7A_12_34_56_01": "broadcasting"}, transportStates(objects))
+}
+
+func TestSimulatedManager_Broadcast(t *testing.T) {
+	sm := NewSimulatedManager(Options{})
+	adapterPath, _ := sm.GetAdapterPathByMAC("00:1A:7D:DA:71:01")
+
+	assert.NoError(t, sm.JoinBroadcast(adapterPath, "C8:7A:12:34:56:01"))
+	devices, _ := sm.GetDevices(adapterPath)
+	for _, device := range devices {
+		if device.Address == "C8:7A:12:34:56:01" {
+			assert.Equal(t, &Broadcast{ID: 0x123456, State: "active"}, device.Broadcast)
+			assert.Contains(t, device.Capabilities, "le_audio_broadcast")
+		}
+	}
+
+	assert.ErrorIs(t, sm.JoinBroadcast(adapterPath, "38:18:4C:12:34:56"), ErrNoBroadcastTransport)
+}
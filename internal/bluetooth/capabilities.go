@@ -0,0 +1,34 @@
+package bluetooth
+
+import "github.com/godbus/dbus/v5"
+
+// LE roles an adapter supports, from the Roles property of Adapter1
+const (
+	RoleCentral           = "central"
+	RolePeripheral        = "peripheral"
+	RoleCentralPeripheral = "central-peripheral"
+)
+
+// decodeCapabilities reads the LE roles and the transports of an adapter. BlueZ only lists roles for
+// LE controllers and only reads a class of device from BR/EDR controllers, Adapter1 has no property
+// telling the transports directly.
+func decodeCapabilities(props map[string]dbus.Variant) (roles []string, transports []string) {
+	roles, _ = props["Roles"].Value().([]string)
+	if roles == nil {
+		roles = []string{}
+	}
+
+	transports = []string{}
+	if class, _ := props["Class"].Value().(uint32); class != 0 {
+		transports = append(transports, TransportBREDR)
+	}
+	if len(roles) > 0 {
+		transports = append(transports, TransportLE)
+	}
+	return roles, transports
+}
+
+// Supports reports whether the adapter has a transport, TransportLE or TransportBREDR
+func (a Adapter) Supports(transport string) bool {
+	return containsString(a.Transports, transport)
+}
@@ -0,0 +1,29 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeCapabilities(t *testing.T) {
+	roles, transports := decodeCapabilities(map[string]dbus.Variant{
+		"Class": dbus.MakeVariant(uint32(0x7c010c)),
+		"Roles": dbus.MakeVariant([]string{RoleCentral, RolePeripheral}),
+	})
+	assert.Equal(t, []string{RoleCentral, RolePeripheral}, roles)
+	assert.Equal(t, []string{TransportBREDR, TransportLE}, transports)
+
+	// An old dongle without LE support
+	roles, transports = decodeCapabilities(map[string]dbus.Variant{
+		"Class": dbus.MakeVariant(uint32(0x7c010c)),
+	})
+	assert.Empty(t, roles)
+	assert.NotNil(t, roles)
+	assert.Equal(t, []string{TransportBREDR}, transports)
+
+	adapter := Adapter{Transports: transports}
+	assert.True(t, adapter.Supports(TransportBREDR))
+	assert.False(t, adapter.Supports(TransportLE))
+}
@@ -0,0 +1,124 @@
+package bluetooth
+
+// Major device classes of the Bluetooth Class of Device (bits 8-12)
+var majorClasses = map[uint32]string{
+	0x00: "miscellaneous",
+	0x01: "computer",
+	0x02: "phone",
+	0x03: "network",
+	0x04: "audio_video",
+	0x05: "peripheral",
+	0x06: "imaging",
+	0x07: "wearable",
+	0x08: "toy",
+	0x09: "health",
+	0x1f: "uncategorized",
+}
+
+// Minor device classes (bits 2-7), indexed by major class
+var minorClasses = map[uint32]map[uint32]string{
+	0x01: {
+		0x01: "desktop",
+		0x02: "server",
+		0x03: "laptop",
+		0x04: "handheld",
+		0x05: "palm",
+		0x06: "wearable_computer",
+		0x07: "tablet",
+	},
+	0x02: {
+		0x01: "cellular",
+		0x02: "cordless",
+		0x03: "smartphone",
+		0x04: "modem",
+		0x05: "isdn",
+	},
+	0x04: {
+		0x01: "headset",
+		0x02: "handsfree",
+		0x04: "microphone",
+		0x05: "loudspeaker",
+		0x06: "headphones",
+		0x07: "portable_audio",
+		0x08: "car_audio",
+		0x09: "set_top_box",
+		0x0a: "hifi_audio",
+		0x0b: "vcr",
+		0x0c: "video_camera",
+		0x0d: "camcorder",
+		0x0e: "video_monitor",
+		0x0f: "video_display_loudspeaker",
+		0x10: "video_conferencing",
+		0x12: "gaming_toy",
+	},
+	0x07: {
+		0x01: "wristwatch",
+		0x02: "pager",
+		0x03: "jacket",
+		0x04: "helmet",
+		0x05: "glasses",
+	},
+	0x08: {
+		0x01: "robot",
+		0x02: "vehicle",
+		0x03: "doll",
+		0x04: "controller",
+		0x05: "game",
+	},
+}
+
+// Peripheral minor classes are split between an input kind (bits 6-7) and a device kind (bits 2-5)
+var peripheralKinds = map[uint32]string{
+	0x01: "keyboard",
+	0x02: "pointing_device",
+	0x03: "keyboard_pointing_device",
+}
+
+var peripheralDevices = map[uint32]string{
+	0x01: "joystick",
+	0x02: "gamepad",
+	0x03: "remote_control",
+	0x04: "sensing_device",
+	0x05: "digitizer_tablet",
+	0x06: "card_reader",
+}
+
+// IsClassName reports whether a name is one of the major or minor class names returned by DecodeClass
+func IsClassName(name string) bool {
+	for _, names := range []map[uint32]string{majorClasses, peripheralKinds, peripheralDevices} {
+		for _, known := range names {
+			if known == name {
+				return true
+			}
+		}
+	}
+	for _, minors := range minorClasses {
+		for _, known := range minors {
+			if known == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DecodeClass decodes a Class of Device into its major and minor class names.
+// Unknown values yield an empty minor class.
+func DecodeClass(class uint32) (major string, minor string) {
+	majorValue := (class >> 8) & 0x1f
+	minorValue := (class >> 2) & 0x3f
+
+	major, ok := majorClasses[majorValue]
+	if !ok {
+		major = "unknown"
+	}
+
+	if majorValue == 0x05 {
+		if kind, ok := peripheralDevices[minorValue&0x0f]; ok {
+			return major, kind
+		}
+		return major, peripheralKinds[minorValue>>4]
+	}
+
+	return major, minorClasses[majorValue][minorValue]
+}
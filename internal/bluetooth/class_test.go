@@ -0,0 +1,34 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeClass(t *testing.T) {
+	tests := []struct {
+		name          string
+		class         uint32
+		expectedMajor string
+		expectedMinor string
+	}{
+		{name: "audio headset", class: 0x240404, expectedMajor: "audio_video", expectedMinor: "headset"},
+		{name: "headphones", class: 0x240418, expectedMajor: "audio_video", expectedMinor: "headphones"},
+		{name: "keyboard", class: 0x002540, expectedMajor: "peripheral", expectedMinor: "keyboard"},
+		{name: "mouse", class: 0x002580, expectedMajor: "peripheral", expectedMinor: "pointing_device"},
+		{name: "gamepad", class: 0x002508, expectedMajor: "peripheral", expectedMinor: "gamepad"},
+		{name: "smartphone", class: 0x5a020c, expectedMajor: "phone", expectedMinor: "smartphone"},
+		{name: "wristwatch", class: 0x000704, expectedMajor: "wearable", expectedMinor: "wristwatch"},
+		{name: "laptop", class: 0x10010c, expectedMajor: "computer", expectedMinor: "laptop"},
+		{name: "unknown minor", class: 0x000600, expectedMajor: "imaging", expectedMinor: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			major, minor := DecodeClass(tt.class)
+			assert.Equal(t, tt.expectedMajor, major)
+			assert.Equal(t, tt.expectedMinor, minor)
+		})
+	}
+}
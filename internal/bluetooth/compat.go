@@ -0,0 +1,115 @@
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/nerzhul/home-bt-broker/internal/mgmt"
+)
+
+// ErrUnsupportedBlueZ is returned when the running BlueZ is too old for an operation, such as the
+// BlueZ 5.4x and 5.5x releases of older Debian and Raspbian installs
+var ErrUnsupportedBlueZ = errors.New("not supported by the running BlueZ")
+
+// unsupported reports an operation requiring a later BlueZ release
+func unsupported(what, version string) error {
+	return fmt.Errorf("%s requires BlueZ %s or later: %w", what, version, ErrUnsupportedBlueZ)
+}
+
+// isUnknownToBlueZ reports whether BlueZ rejected a call because it does not know the method, the
+// interface or the property, which older releases answer instead of a BlueZ error
+func isUnknownToBlueZ(err error) bool {
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) {
+		return false
+	}
+	switch dbusErr.Name {
+	case "org.freedesktop.DBus.Error.UnknownMethod", "org.freedesktop.DBus.Error.UnknownInterface",
+		"org.freedesktop.DBus.Error.UnknownProperty", "org.freedesktop.DBus.Error.UnknownObject":
+		return true
+	case "org.freedesktop.DBus.Error.InvalidArgs":
+		// gdbus answers the properties it does not know with "No such property"
+		return strings.Contains(dbusErr.Error(), "No such property")
+	}
+	return false
+}
+
+// isInvalidArguments reports whether BlueZ rejected the arguments of a call, such as the discovery
+// filter keys added after its release
+func isInvalidArguments(err error) bool {
+	var dbusErr dbus.Error
+	return errors.As(err, &dbusErr) && dbusErr.Name == "org.bluez.Error.InvalidArguments"
+}
+
+// setDiscoveryFilterCompat falls back on what an older BlueZ supports: the filter without the
+// DuplicateData key, added in BlueZ 5.48, then no filter at all before BlueZ 5.33
+func (bm *BluetoothManager) setDiscoveryFilterCompat(adapterPath string, props map[string]dbus.Variant, err error) error {
+	obj := bm.conn.Object(BluezService, dbus.ObjectPath(adapterPath))
+	if _, ok := props["DuplicateData"]; ok && isInvalidArguments(err) {
+		log.Printf("BlueZ rejected the DuplicateData discovery filter, BlueZ 5.48 or later is required, discovering without it")
+		delete(props, "DuplicateData")
+		err = obj.Call(AdapterInterface+".SetDiscoveryFilter", 0, props).Err
+	}
+	if isUnknownToBlueZ(err) {
+		log.Printf("BlueZ does not support discovery filters, discovering every transport")
+		return nil
+	}
+	return err
+}
+
+// legacyTransports reads the transports of an adapter from the kernel when BlueZ, before 5.56, does
+// not report its LE roles, and keeps the transports found by BlueZ when the kernel cannot tell
+func legacyTransports(adapterPath string, transports []string) []string {
+	index, err := controllerIndex(adapterPath)
+	if err != nil {
+		return transports
+	}
+	controller, err := mgmt.ReadController(index)
+	if err != nil {
+		return transports
+	}
+	transports = []string{}
+	if controller.BREDR {
+		transports = append(transports, TransportBREDR)
+	}
+	if controller.LE {
+		transports = append(transports, TransportLE)
+	}
+	return transports
+}
+
+const (
+	gattServiceInterface        = "org.bluez.GattService1"
+	gattCharacteristicInterface = "org.bluez.GattCharacteristic1"
+	// batteryLevelUUID is the Battery Level characteristic of the GATT Battery Service
+	batteryLevelUUID = "00002a19-0000-1000-8000-00805f9b34fb"
+)
+
+// gattBatteryLevels returns the battery levels of the LE devices by path, from the last value BlueZ
+// read of their Battery Level characteristic. BlueZ 5.48 and later hide the characteristic behind
+// Battery1, older releases export it as is.
+func gattBatteryLevels(objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant) map[dbus.ObjectPath]uint8 {
+	levels := make(map[dbus.ObjectPath]uint8)
+	for _, interfaces := range objects {
+		props, ok := interfaces[gattCharacteristicInterface]
+		if !ok {
+			continue
+		}
+		if uuid, _ := props["UUID"].Value().(string); !strings.EqualFold(uuid, batteryLevelUUID) {
+			continue
+		}
+		value, _ := props["Value"].Value().([]byte)
+		if len(value) == 0 || value[0] > 100 {
+			continue
+		}
+		service, _ := props["Service"].Value().(dbus.ObjectPath)
+		device, _ := objects[service][gattServiceInterface]["Device"].Value().(dbus.ObjectPath)
+		if device != "" {
+			levels[device] = value[0]
+		}
+	}
+	return levels
+}
@@ -0,0 +1,55 @@
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsUnknownToBlueZ(t *testing.T) {
+	assert.True(t, isUnknownToBlueZ(dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownMethod"}))
+	assert.True(t, isUnknownToBlueZ(fmt.Errorf("set filter: %w", dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownProperty"})))
+	assert.True(t, isUnknownToBlueZ(dbus.Error{
+		Name: "org.freedesktop.DBus.Error.InvalidArgs",
+		Body: []interface{}{"No such property 'WakeAllowed'"},
+	}))
+	assert.False(t, isUnknownToBlueZ(dbus.Error{Name: "org.freedesktop.DBus.Error.InvalidArgs", Body: []interface{}{"Invalid value"}}))
+	assert.False(t, isUnknownToBlueZ(dbus.Error{Name: "org.bluez.Error.Failed"}))
+	assert.False(t, isUnknownToBlueZ(errors.New("UnknownMethod")))
+
+	assert.True(t, isInvalidArguments(dbus.Error{Name: "org.bluez.Error.InvalidArguments"}))
+	assert.False(t, isInvalidArguments(dbus.Error{Name: "org.freedesktop.DBus.Error.InvalidArgs"}))
+
+	assert.ErrorIs(t, unsupported("wake allowed", "5.51"), ErrUnsupportedBlueZ)
+	assert.EqualError(t, unsupported("wake allowed", "5.51"), "wake allowed requires BlueZ 5.51 or later: not supported by the running BlueZ")
+}
+
+func TestGattBatteryLevels(t *testing.T) {
+	device := dbus.ObjectPath("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF")
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{
+		device + "/service0010": {gattServiceInterface: {
+			"Device": dbus.MakeVariant(device),
+		}},
+		device + "/service0010/char0011": {gattCharacteristicInterface: {
+			"UUID":    dbus.MakeVariant("00002A19-0000-1000-8000-00805F9B34FB"),
+			"Service": dbus.MakeVariant(device + "/service0010"),
+			"Value":   dbus.MakeVariant([]byte{87}),
+		}},
+		// Another characteristic of the service
+		device + "/service0010/char0014": {gattCharacteristicInterface: {
+			"UUID":    dbus.MakeVariant("00002a1a-0000-1000-8000-00805f9b34fb"),
+			"Service": dbus.MakeVariant(device + "/service0010"),
+			"Value":   dbus.MakeVariant([]byte{1}),
+		}},
+		// Not read yet
+		"/org/bluez/hci0/dev_11_22_33_44_55_66/service0010/char0011": {gattCharacteristicInterface: {
+			"UUID":    dbus.MakeVariant(batteryLevelUUID),
+			"Service": dbus.MakeVariant(dbus.ObjectPath("/org/bluez/hci0/dev_11_22_33_44_55_66/service0010")),
+		}},
+	}
+
+	assert.Equal(t, map[dbus.ObjectPath]uint8{device: 87}, gattBatteryLevels(objects))
+}
@@ -0,0 +1,70 @@
+package bluetooth
+
+import (
+	"sort"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Experimental interfaces of an adapter, only exported when bluetoothd runs with --experimental
+// or with Experimental = true in the [General] section of main.conf
+const (
+	ExperimentalAdvertisementMonitor = "advertisement_monitor"
+	ExperimentalBatteryProvider      = "battery_provider"
+)
+
+// experimentalInterfaces maps the experimental D-Bus interfaces exported on an adapter object to their name
+var experimentalInterfaces = map[string]string{
+	"org.bluez.AdvertisementMonitorManager1": ExperimentalAdvertisementMonitor,
+	"org.bluez.BatteryProviderManager1":      ExperimentalBatteryProvider,
+}
+
+// experimentalFeatures maps the UUIDs of the experimental kernel features to their name
+var experimentalFeatures = map[string]string{
+	"d4992530-b9ec-469f-ab01-6c481c47da1c": "debug",
+	"671b10b5-42c0-4696-9227-eb28d1b049d6": "le_simultaneous_roles",
+	"15c0a148-c273-11ea-b3de-0242ac130004": "rpa_resolution",
+	"330859bc-7506-492d-9370-9a6f0614037f": "quality_report",
+	"a6695ace-ee7f-4fb9-881a-5fac66c629af": "offload_codecs",
+	"6fbaf188-05e0-496a-9885-d6ddfdb4e03e": "iso_socket",
+}
+
+// Experimental describes the experimental BlueZ features available on an adapter
+type Experimental struct {
+	// Enabled reports whether bluetoothd runs with its experimental features
+	Enabled    bool     `json:"enabled"`
+	Interfaces []string `json:"interfaces"`
+	// Features are the UUIDs of the experimental kernel features enabled by bluetoothd
+	Features []string `json:"features,omitempty"`
+	// FeatureNames are the names of the known features, such as iso_socket required by LE Audio
+	FeatureNames []string `json:"feature_names,omitempty"`
+}
+
+// Has reports whether an experimental interface is available
+func (e Experimental) Has(name string) bool {
+	return containsString(e.Interfaces, name)
+}
+
+// decodeExperimental reads the experimental interfaces and features of an adapter object
+func decodeExperimental(interfaces map[string]map[string]dbus.Variant) Experimental {
+	experimental := Experimental{Interfaces: []string{}}
+	for iface, name := range experimentalInterfaces {
+		if _, ok := interfaces[iface]; ok {
+			experimental.Interfaces = append(experimental.Interfaces, name)
+		}
+	}
+	sort.Strings(experimental.Interfaces)
+
+	if features, ok := interfaces[AdapterInterface]["ExperimentalFeatures"]; ok {
+		experimental.Features, _ = features.Value().([]string)
+	}
+	for _, uuid := range experimental.Features {
+		if name, ok := experimentalFeatures[uuid]; ok {
+			experimental.FeatureNames = append(experimental.FeatureNames, name)
+		}
+	}
+	sort.Strings(experimental.FeatureNames)
+
+	experimental.Enabled = len(experimental.Interfaces) > 0 || len(experimental.Features) > 0
+	return experimental
+}
@@ -0,0 +1,29 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeExperimental(t *testing.T) {
+	experimental := decodeExperimental(map[string]map[string]dbus.Variant{
+		AdapterInterface: {"Address": dbus.MakeVariant("00:1A:7D:DA:71:01")},
+	})
+	assert.False(t, experimental.Enabled)
+	assert.Empty(t, experimental.Interfaces)
+
+	experimental = decodeExperimental(map[string]map[string]dbus.Variant{
+		AdapterInterface: {
+			"ExperimentalFeatures": dbus.MakeVariant([]string{"6fbaf188-05e0-496a-9885-d6ddfdb4e03e"}),
+		},
+		"org.bluez.BatteryProviderManager1":      {},
+		"org.bluez.AdvertisementMonitorManager1": {},
+	})
+	assert.True(t, experimental.Enabled)
+	assert.Equal(t, []string{ExperimentalAdvertisementMonitor, ExperimentalBatteryProvider}, experimental.Interfaces)
+	assert.Equal(t, []string{"6fbaf188-05e0-496a-9885-d6ddfdb4e03e"}, experimental.Features)
+	assert.Equal(t, []string{"iso_socket"}, experimental.FeatureNames)
+	assert.True(t, experimental.Has(ExperimentalBatteryProvider))
+}
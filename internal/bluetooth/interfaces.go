@@ -1,5 +1,17 @@
 package bluetooth
 
+import "github.com/nerzhul/home-bt-broker/internal/mgmt"
+
+// Bluetooth backends selected with BT_BACKEND
+const (
+	// BackendDBus talks to BlueZ over the D-Bus system bus
+	BackendDBus = "dbus"
+	// BackendKernel lists and powers the adapters through the kernel, without BlueZ
+	BackendKernel = "kernel"
+	// BackendMock simulates adapters and devices in memory, without BlueZ
+	BackendMock = "mock"
+)
+
 // BluetoothManagerInterface defines the interface for Bluetooth operations
 type BluetoothManagerInterface interface {
 	GetAdapters() ([]Adapter, error)
@@ -8,13 +20,37 @@ type BluetoothManagerInterface interface {
 	GetTrustedDevices(adapterPath string) ([]Device, error)
 	GetConnectedDevices(adapterPath string) ([]Device, error)
 	ConnectDevice(adapterPath, macAddress string) error
+	ConnectProfile(adapterPath, macAddress, uuid string) error
+	DisconnectDevice(adapterPath, macAddress string) error
 	TrustDevice(adapterPath, macAddress string) error
+	UntrustDevice(adapterPath, macAddress string) error
+	SetWakeAllowed(adapterPath, macAddress string, allow bool) error
+	SetVolume(adapterPath, macAddress string, percent uint8) error
+	GetTrack(adapterPath, macAddress string) (*Track, error)
+	GetLinkInfo(adapterPath, macAddress string) (*mgmt.ConnInfo, error)
+	JoinBroadcast(adapterPath, macAddress string) error
+	LeaveBroadcast(adapterPath, macAddress string) error
+	GetDeviceSets(adapterPath string) ([]DeviceSet, error)
+	ConnectDeviceSet(adapterPath, setID string) error
 	PairDevice(adapterPath, macAddress string) error
+	PairDeviceWithOptions(adapterPath, macAddress string, opts PairOptions) error
+	CancelPairing(adapterPath, macAddress string) error
 	RemoveDevice(adapterPath, macAddress string) error
+	SetPowered(adapterPath string, enable bool) error
 	SetDiscoverable(adapterPath string, enable bool) error
+	SetPairable(adapterPath string, enable bool) error
 	SetDiscovering(adapterPath string, enable bool) error
+	SetDiscoveryFilter(adapterPath string, filter DiscoveryFilter) error
+	GetPairingRequests() []PairingRequest
+	RespondPairingRequest(id string, accept bool) error
+	SetPairingNotifier(notify func(eventType string, req PairingRequest))
+	SetPairingPolicy(allowed func(address string) bool)
+	GetSystemInfo() (*SystemInfo, error)
+	Ping() error
 	Close()
 }
 
 // Ensure BluetoothManager implements the interface
-var _ BluetoothManagerInterface = (*BluetoothManager)(nil)
\ No newline at end of file
+var _ BluetoothManagerInterface = (*BluetoothManager)(nil)
+var _ BluetoothManagerInterface = (*SimulatedManager)(nil)
+var _ BluetoothManagerInterface = (*KernelManager)(nil)
\ No newline at end of file
@@ -0,0 +1,305 @@
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/nerzhul/home-bt-broker/internal/mgmt"
+	"github.com/nerzhul/home-bt-broker/internal/rfkill"
+)
+
+// ErrNotSupported is returned by the kernel backend for the operations which need BlueZ
+var ErrNotSupported = errors.New("not supported without BlueZ")
+
+// KernelManager lists and powers the controllers through the kernel management socket. It keeps
+// monitoring working on stripped-down systems: devices are not tracked and every device operation
+// fails with ErrNotSupported.
+type KernelManager struct {
+	mgmt mgmtInterface
+}
+
+// mgmtInterface is the part of the kernel management interface the kernel backend uses
+type mgmtInterface interface {
+	Controllers() ([]mgmt.Controller, error)
+	SetPowered(index uint16, powered bool) error
+	GetConnInfo(index uint16, address string, addressType uint8) (*mgmt.ConnInfo, error)
+	ReadLinkQuality(index uint16, address string) (uint8, error)
+}
+
+// mgmtSocket sends the commands to the kernel management socket
+type mgmtSocket struct{}
+
+func (mgmtSocket) Controllers() ([]mgmt.Controller, error) {
+	return mgmt.Controllers()
+}
+
+func (mgmtSocket) SetPowered(index uint16, powered bool) error {
+	return mgmt.SetPowered(index, powered)
+}
+
+func (mgmtSocket) GetConnInfo(index uint16, address string, addressType uint8) (*mgmt.ConnInfo, error) {
+	return mgmt.GetConnInfo(index, address, addressType)
+}
+
+func (mgmtSocket) ReadLinkQuality(index uint16, address string) (uint8, error) {
+	return mgmt.ReadLinkQuality(index, address)
+}
+
+// NewKernelManager creates a kernel backend
+func NewKernelManager() *KernelManager {
+	return &KernelManager{mgmt: mgmtSocket{}}
+}
+
+// bluezRunning reports whether bluetoothd owns its name on the system bus. A bus which cannot be
+// reached counts as running, so that the dbus backend reports the connection error.
+func bluezRunning() bool {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return true
+	}
+
+	var hasOwner bool
+	if err := conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, BluezService).Store(&hasOwner); err != nil {
+		return true
+	}
+	return hasOwner
+}
+
+// controllerIndex returns the kernel index of an adapter path such as /org/bluez/hci0
+func controllerIndex(adapterPath string) (uint16, error) {
+	index, err := strconv.ParseUint(strings.TrimPrefix(path.Base(adapterPath), "hci"), 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get controller index of adapter %s: %w", adapterPath, err)
+	}
+	return uint16(index), nil
+}
+
+// GetAdapters returns the controllers registered in the kernel, with the paths BlueZ would give them
+func (km *KernelManager) GetAdapters() ([]Adapter, error) {
+	controllers, err := km.mgmt.Controllers()
+	if err != nil {
+		return nil, err
+	}
+
+	rfkillStates, _ := rfkill.States()
+
+	adapters := make([]Adapter, 0, len(controllers))
+	for _, controller := range controllers {
+		adapter := Adapter{
+			Path:         fmt.Sprintf("/org/bluez/hci%d", controller.Index),
+			Name:         controller.Name,
+			Address:      controller.Address,
+			Powered:      controller.Powered,
+			Discoverable: controller.Discoverable,
+			Pairable:     controller.Bondable,
+			Experimental: Experimental{Interfaces: []string{}},
+			// Roles are managed by bluetoothd
+			Roles:      []string{},
+			Transports: []string{},
+		}
+		if controller.BREDR {
+			adapter.Transports = append(adapter.Transports, TransportBREDR)
+		}
+		if controller.LE {
+			adapter.Transports = append(adapter.Transports, TransportLE)
+		}
+		if index, err := rfkill.AdapterIndex(path.Base(adapter.Path)); err == nil {
+			if state, ok := rfkillStates[index]; ok {
+				adapter.Rfkill = &state
+			}
+		}
+		adapters = append(adapters, adapter)
+	}
+	return adapters, nil
+}
+
+// GetAdapterPathByMAC returns the path of a controller by address
+func (km *KernelManager) GetAdapterPathByMAC(macAddress string) (string, error) {
+	adapters, err := km.GetAdapters()
+	if err != nil {
+		return "", err
+	}
+	for _, adapter := range adapters {
+		if strings.EqualFold(adapter.Address, macAddress) {
+			return adapter.Path, nil
+		}
+	}
+	return "", fmt.Errorf("adapter with MAC address %s not found", macAddress)
+}
+
+// GetDevices returns no device, they are only known to BlueZ
+func (km *KernelManager) GetDevices(adapterPath string) ([]Device, error) {
+	return []Device{}, nil
+}
+
+// GetTrustedDevices returns no device, they are only known to BlueZ
+func (km *KernelManager) GetTrustedDevices(adapterPath string) ([]Device, error) {
+	return []Device{}, nil
+}
+
+// GetConnectedDevices returns no device, they are only known to BlueZ
+func (km *KernelManager) GetConnectedDevices(adapterPath string) ([]Device, error) {
+	return []Device{}, nil
+}
+
+// GetLinkInfo reads the state of the BR/EDR or LE public link to a device
+func (km *KernelManager) GetLinkInfo(adapterPath, macAddress string) (*mgmt.ConnInfo, error) {
+	index, err := controllerIndex(adapterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addressType := range []uint8{mgmt.AddressBREDR, mgmt.AddressLEPublic} {
+		info, err := km.mgmt.GetConnInfo(index, macAddress, addressType)
+		if errors.Is(err, mgmt.ErrNotConnected) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get link info of device %s: %w", macAddress, err)
+		}
+		if addressType == mgmt.AddressBREDR {
+			if quality, err := km.mgmt.ReadLinkQuality(index, macAddress); err == nil {
+				info.LinkQuality = &quality
+			}
+		}
+		return info, nil
+	}
+	return nil, fmt.Errorf("failed to get link info of device %s: %w", macAddress, mgmt.ErrNotConnected)
+}
+
+// SetPowered powers a controller on or off
+func (km *KernelManager) SetPowered(adapterPath string, enable bool) error {
+	index, err := controllerIndex(adapterPath)
+	if err != nil {
+		return err
+	}
+	return km.mgmt.SetPowered(index, enable)
+}
+
+// GetDeviceSets returns no set, they are only known to BlueZ
+func (km *KernelManager) GetDeviceSets(adapterPath string) ([]DeviceSet, error) {
+	return []DeviceSet{}, nil
+}
+
+// ConnectDevice is not supported without BlueZ
+func (km *KernelManager) ConnectDevice(adapterPath, macAddress string) error {
+	return fmt.Errorf("failed to connect to device %s: %w", macAddress, ErrNotSupported)
+}
+
+// ConnectProfile is not supported without BlueZ
+func (km *KernelManager) ConnectProfile(adapterPath, macAddress, uuid string) error {
+	return fmt.Errorf("failed to connect profile %s of device %s: %w", uuid, macAddress, ErrNotSupported)
+}
+
+// DisconnectDevice is not supported without BlueZ
+func (km *KernelManager) DisconnectDevice(adapterPath, macAddress string) error {
+	return fmt.Errorf("failed to disconnect device %s: %w", macAddress, ErrNotSupported)
+}
+
+// TrustDevice is not supported without BlueZ
+func (km *KernelManager) TrustDevice(adapterPath, macAddress string) error {
+	return fmt.Errorf("failed to trust device %s: %w", macAddress, ErrNotSupported)
+}
+
+// UntrustDevice is not supported without BlueZ
+func (km *KernelManager) UntrustDevice(adapterPath, macAddress string) error {
+	return fmt.Errorf("failed to untrust device %s: %w", macAddress, ErrNotSupported)
+}
+
+// SetWakeAllowed is not supported without BlueZ
+func (km *KernelManager) SetWakeAllowed(adapterPath, macAddress string, allow bool) error {
+	return fmt.Errorf("failed to set wake allowed on device %s: %w", macAddress, ErrNotSupported)
+}
+
+// SetVolume is not supported without BlueZ
+func (km *KernelManager) SetVolume(adapterPath, macAddress string, percent uint8) error {
+	return fmt.Errorf("failed to set volume on device %s: %w", macAddress, ErrNotSupported)
+}
+
+// GetTrack is not supported without BlueZ
+func (km *KernelManager) GetTrack(adapterPath, macAddress string) (*Track, error) {
+	return nil, fmt.Errorf("failed to get track of device %s: %w", macAddress, ErrNotSupported)
+}
+
+// JoinBroadcast is not supported without BlueZ
+func (km *KernelManager) JoinBroadcast(adapterPath, macAddress string) error {
+	return fmt.Errorf("failed to join broadcast of device %s: %w", macAddress, ErrNotSupported)
+}
+
+// LeaveBroadcast is not supported without BlueZ
+func (km *KernelManager) LeaveBroadcast(adapterPath, macAddress string) error {
+	return fmt.Errorf("failed to leave broadcast of device %s: %w", macAddress, ErrNotSupported)
+}
+
+// ConnectDeviceSet is not supported without BlueZ
+func (km *KernelManager) ConnectDeviceSet(adapterPath, setID string) error {
+	return fmt.Errorf("failed to connect device set %s: %w", setID, ErrNotSupported)
+}
+
+// PairDevice is not supported without BlueZ
+func (km *KernelManager) PairDevice(adapterPath, macAddress string) error {
+	return km.PairDeviceWithOptions(adapterPath, macAddress, PairOptions{})
+}
+
+// PairDeviceWithOptions is not supported without BlueZ
+func (km *KernelManager) PairDeviceWithOptions(adapterPath, macAddress string, opts PairOptions) error {
+	return fmt.Errorf("failed to pair device %s: %w", macAddress, ErrNotSupported)
+}
+
+// CancelPairing is not supported without BlueZ
+func (km *KernelManager) CancelPairing(adapterPath, macAddress string) error {
+	return fmt.Errorf("failed to cancel pairing of device %s: %w", macAddress, ErrNotSupported)
+}
+
+// RemoveDevice is not supported without BlueZ
+func (km *KernelManager) RemoveDevice(adapterPath, macAddress string) error {
+	return fmt.Errorf("failed to remove device %s: %w", macAddress, ErrNotSupported)
+}
+
+// SetDiscoverable is not supported without BlueZ
+func (km *KernelManager) SetDiscoverable(adapterPath string, enable bool) error {
+	return fmt.Errorf("failed to set discoverable: %w", ErrNotSupported)
+}
+
+// SetPairable is not supported without BlueZ
+func (km *KernelManager) SetPairable(adapterPath string, enable bool) error {
+	return fmt.Errorf("failed to set pairable: %w", ErrNotSupported)
+}
+
+// SetDiscovering is not supported without BlueZ
+func (km *KernelManager) SetDiscovering(adapterPath string, enable bool) error {
+	return fmt.Errorf("failed to set discovering: %w", ErrNotSupported)
+}
+
+// SetDiscoveryFilter is not supported without BlueZ
+func (km *KernelManager) SetDiscoveryFilter(adapterPath string, filter DiscoveryFilter) error {
+	return fmt.Errorf("failed to set discovery filter: %w", ErrNotSupported)
+}
+
+// GetPairingRequests returns no request, there is no pairing agent
+func (km *KernelManager) GetPairingRequests() []PairingRequest {
+	return []PairingRequest{}
+}
+
+// RespondPairingRequest fails, there is no pairing agent
+func (km *KernelManager) RespondPairingRequest(id string, accept bool) error {
+	return ErrPairingRequestNotFound
+}
+
+// SetPairingNotifier does nothing, there is no pairing agent
+func (km *KernelManager) SetPairingNotifier(notify func(eventType string, req PairingRequest)) {}
+
+// SetPairingPolicy does nothing, there is no pairing agent
+func (km *KernelManager) SetPairingPolicy(allowed func(address string) bool) {}
+
+// Ping checks that the kernel management interface answers
+func (km *KernelManager) Ping() error {
+	_, err := km.mgmt.Controllers()
+	return err
+}
+
+// Close does nothing, every command opens its own socket
+func (km *KernelManager) Close() {}
@@ -0,0 +1,158 @@
+package bluetooth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nerzhul/home-bt-broker/internal/mgmt"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMgmt answers the kernel management commands from memory
+type fakeMgmt struct {
+	controllers []mgmt.Controller
+	err         error
+	// links are the connections by address type, then by device address
+	links   map[uint8]map[string]mgmt.ConnInfo
+	quality uint8
+	// powered records the SetPowered commands by controller index
+	powered map[uint16]bool
+}
+
+func (f *fakeMgmt) Controllers() ([]mgmt.Controller, error) {
+	return f.controllers, f.err
+}
+
+func (f *fakeMgmt) SetPowered(index uint16, powered bool) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.powered[index] = powered
+	return nil
+}
+
+func (f *fakeMgmt) GetConnInfo(index uint16, address string, addressType uint8) (*mgmt.ConnInfo, error) {
+	info, ok := f.links[addressType][address]
+	if !ok {
+		return nil, mgmt.ErrNotConnected
+	}
+	return &info, nil
+}
+
+func (f *fakeMgmt) ReadLinkQuality(index uint16, address string) (uint8, error) {
+	return f.quality, nil
+}
+
+func TestControllerIndex(t *testing.T) {
+	index, err := controllerIndex("/org/bluez/hci0")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(0), index)
+	index, err = controllerIndex("/org/bluez/hci12")
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(12), index)
+
+	for _, adapterPath := range []string{"/org/bluez/hci", "/org/bluez/hciX", "/org/bluez/hci70000", "/org/bluez/hci-1"} {
+		_, err = controllerIndex(adapterPath)
+		assert.Error(t, err, adapterPath)
+	}
+}
+
+func TestKernelManager_GetAdapters(t *testing.T) {
+	fake := &fakeMgmt{controllers: []mgmt.Controller{
+		{Index: 0, Address: "00:1A:7D:DA:71:01", Name: "living room", Powered: true, Bondable: true, BREDR: true, LE: true},
+		{Index: 3, Address: "00:1A:7D:DA:71:02", Name: "garage", Discoverable: true, LE: true},
+	}, powered: map[uint16]bool{}}
+	km := &KernelManager{mgmt: fake}
+
+	adapters, err := km.GetAdapters()
+	assert.NoError(t, err)
+	if assert.Len(t, adapters, 2) {
+		assert.Equal(t, "/org/bluez/hci0", adapters[0].Path)
+		assert.Equal(t, "living room", adapters[0].Name)
+		assert.True(t, adapters[0].Powered)
+		assert.True(t, adapters[0].Pairable)
+		assert.Equal(t, []string{TransportBREDR, TransportLE}, adapters[0].Transports)
+		assert.Equal(t, "/org/bluez/hci3", adapters[1].Path)
+		assert.True(t, adapters[1].Discoverable)
+		assert.Equal(t, []string{TransportLE}, adapters[1].Transports)
+		assert.Empty(t, adapters[1].Roles)
+	}
+
+	adapterPath, err := km.GetAdapterPathByMAC("00:1a:7d:da:71:02")
+	assert.NoError(t, err)
+	assert.Equal(t, "/org/bluez/hci3", adapterPath)
+	_, err = km.GetAdapterPathByMAC("00:1A:7D:DA:71:09")
+	assert.Error(t, err)
+
+	assert.NoError(t, km.SetPowered("/org/bluez/hci3", true))
+	assert.Equal(t, map[uint16]bool{3: true}, fake.powered)
+	assert.Error(t, km.SetPowered("/org/bluez/adapter", true))
+
+	// The errors of the management socket are returned
+	fake.err = errors.New("operation not permitted")
+	_, err = km.GetAdapters()
+	assert.EqualError(t, err, "operation not permitted")
+	assert.Error(t, km.Ping())
+}
+
+func TestKernelManager_GetLinkInfo(t *testing.T) {
+	rssi := int8(-60)
+	fake := &fakeMgmt{links: map[uint8]map[string]mgmt.ConnInfo{
+		mgmt.AddressBREDR:    {"AA:BB:CC:DD:EE:01": {RSSI: &rssi}},
+		mgmt.AddressLEPublic: {"AA:BB:CC:DD:EE:02": {RSSI: &rssi}},
+	}, quality: 200}
+	km := &KernelManager{mgmt: fake}
+
+	// The link quality is only read on BR/EDR links
+	info, err := km.GetLinkInfo("/org/bluez/hci0", "AA:BB:CC:DD:EE:01")
+	assert.NoError(t, err)
+	assert.Equal(t, &rssi, info.RSSI)
+	if assert.NotNil(t, info.LinkQuality) {
+		assert.Equal(t, uint8(200), *info.LinkQuality)
+	}
+	info, err = km.GetLinkInfo("/org/bluez/hci0", "AA:BB:CC:DD:EE:02")
+	assert.NoError(t, err)
+	assert.Nil(t, info.LinkQuality)
+
+	_, err = km.GetLinkInfo("/org/bluez/hci0", "AA:BB:CC:DD:EE:03")
+	assert.ErrorIs(t, err, mgmt.ErrNotConnected)
+}
+
+func TestKernelManager_NotSupported(t *testing.T) {
+	km := &KernelManager{mgmt: &fakeMgmt{}}
+	adapterPath, address := "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF"
+
+	for name, err := range map[string]error{
+		"ConnectDevice":      km.ConnectDevice(adapterPath, address),
+		"ConnectProfile":     km.ConnectProfile(adapterPath, address, "110b"),
+		"DisconnectDevice":   km.DisconnectDevice(adapterPath, address),
+		"TrustDevice":        km.TrustDevice(adapterPath, address),
+		"UntrustDevice":      km.UntrustDevice(adapterPath, address),
+		"SetWakeAllowed":     km.SetWakeAllowed(adapterPath, address, true),
+		"SetVolume":          km.SetVolume(adapterPath, address, 50),
+		"JoinBroadcast":      km.JoinBroadcast(adapterPath, address),
+		"LeaveBroadcast":     km.LeaveBroadcast(adapterPath, address),
+		"ConnectDeviceSet":   km.ConnectDeviceSet(adapterPath, "set_0"),
+		"PairDevice":         km.PairDevice(adapterPath, address),
+		"CancelPairing":      km.CancelPairing(adapterPath, address),
+		"RemoveDevice":       km.RemoveDevice(adapterPath, address),
+		"SetDiscoverable":    km.SetDiscoverable(adapterPath, true),
+		"SetPairable":        km.SetPairable(adapterPath, true),
+		"SetDiscovering":     km.SetDiscovering(adapterPath, true),
+		"SetDiscoveryFilter": km.SetDiscoveryFilter(adapterPath, DiscoveryFilter{}),
+	} {
+		assert.ErrorIs(t, err, ErrNotSupported, name)
+	}
+	_, err := km.GetTrack(adapterPath, address)
+	assert.ErrorIs(t, err, ErrNotSupported)
+
+	// Devices and pairing requests are only known to BlueZ
+	devices, err := km.GetDevices(adapterPath)
+	assert.NoError(t, err)
+	assert.Empty(t, devices)
+	sets, err := km.GetDeviceSets(adapterPath)
+	assert.NoError(t, err)
+	assert.Empty(t, sets)
+	assert.Empty(t, km.GetPairingRequests())
+	assert.ErrorIs(t, km.RespondPairingRequest("1", true), ErrPairingRequestNotFound)
+}
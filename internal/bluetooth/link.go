@@ -0,0 +1,49 @@
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/nerzhul/home-bt-broker/internal/mgmt"
+)
+
+// GetLinkInfo reads the RSSI, transmit power and link quality of a connected device from the kernel.
+// BlueZ does not tell whether a public address is connected over BR/EDR or LE, so BR/EDR is tried first.
+func (bm *BluetoothManager) GetLinkInfo(adapterPath, macAddress string) (*mgmt.ConnInfo, error) {
+	index, err := controllerIndex(adapterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	devicePath := fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_"))
+	variant, err := bm.conn.Object(BluezService, dbus.ObjectPath(devicePath)).GetProperty(DeviceInterface + ".AddressType")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get address type of device %s: %w", macAddress, err)
+	}
+
+	addressTypes := []uint8{mgmt.AddressBREDR, mgmt.AddressLEPublic}
+	if addressType, _ := variant.Value().(string); addressType == "random" {
+		addressTypes = []uint8{mgmt.AddressLERandom}
+	}
+
+	for _, addressType := range addressTypes {
+		info, err := mgmt.GetConnInfo(index, macAddress, addressType)
+		if errors.Is(err, mgmt.ErrNotConnected) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get link info of device %s: %w", macAddress, err)
+		}
+
+		// Only BR/EDR controllers report a link quality, failing to read it leaves it out
+		if addressType == mgmt.AddressBREDR {
+			if quality, err := mgmt.ReadLinkQuality(index, macAddress); err == nil {
+				info.LinkQuality = &quality
+			}
+		}
+		return info, nil
+	}
+
+	return nil, fmt.Errorf("failed to get link info of device %s: %w", macAddress, mgmt.ErrNotConnected)
+}
@@ -0,0 +1,83 @@
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// MediaPlayerInterface is the BlueZ interface of the AVRCP player of a device, such as a phone playing music
+const MediaPlayerInterface = "org.bluez.MediaPlayer1"
+
+// ErrNoMediaPlayer is returned when a device exposes no AVRCP player
+var ErrNoMediaPlayer = errors.New("device has no media player")
+
+// Track is the metadata and playback state of the player of a device. Durations are in milliseconds.
+type Track struct {
+	Title       string `json:"title,omitempty"`
+	Artist      string `json:"artist,omitempty"`
+	Album       string `json:"album,omitempty"`
+	Genre       string `json:"genre,omitempty"`
+	TrackNumber uint32 `json:"track_number,omitempty"`
+	Tracks      uint32 `json:"tracks,omitempty"`
+	Duration    uint32 `json:"duration,omitempty"`
+	Position    uint32 `json:"position"`
+	// Status is the playback status reported by the player, e.g. playing, paused or stopped
+	Status string `json:"status,omitempty"`
+}
+
+// DecodeTrack decodes the properties of a MediaPlayer1 object, or the changed ones of a PropertiesChanged signal
+func DecodeTrack(props map[string]dbus.Variant) Track {
+	var track Track
+	if metadata, ok := props["Track"].Value().(map[string]dbus.Variant); ok {
+		track.Title, _ = metadata["Title"].Value().(string)
+		track.Artist, _ = metadata["Artist"].Value().(string)
+		track.Album, _ = metadata["Album"].Value().(string)
+		track.Genre, _ = metadata["Genre"].Value().(string)
+		track.TrackNumber, _ = metadata["TrackNumber"].Value().(uint32)
+		track.Tracks, _ = metadata["NumberOfTracks"].Value().(uint32)
+		track.Duration, _ = metadata["Duration"].Value().(uint32)
+	}
+	track.Position, _ = props["Position"].Value().(uint32)
+	track.Status, _ = props["Status"].Value().(string)
+	return track
+}
+
+// managedObjects returns the objects exported by BlueZ with their interfaces and properties
+func (bm *BluetoothManager) managedObjects() (map[dbus.ObjectPath]map[string]map[string]dbus.Variant, error) {
+	obj := bm.conn.Object(BluezService, BluezObjectPath)
+	call := obj.Call(ObjectManagerIface+".GetManagedObjects", 0)
+	if call.Err != nil {
+		return nil, fmt.Errorf("failed to get managed objects: %w", call.Err)
+	}
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	if err := call.Store(&objects); err != nil {
+		return nil, fmt.Errorf("failed to parse managed objects: %w", err)
+	}
+	return objects, nil
+}
+
+// GetTrack returns the track played by the AVRCP player of a device
+func (bm *BluetoothManager) GetTrack(adapterPath, macAddress string) (*Track, error) {
+	devicePath := dbus.ObjectPath(fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_")))
+
+	objects, err := bm.managedObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, interfaces := range objects {
+		props, ok := interfaces[MediaPlayerInterface]
+		if !ok {
+			continue
+		}
+		if device, _ := props["Device"].Value().(dbus.ObjectPath); device == devicePath {
+			track := DecodeTrack(props)
+			return &track, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to get track of device %s: %w", macAddress, ErrNoMediaPlayer)
+}
@@ -3,6 +3,7 @@
 package bluetooth
 
 import (
+	"github.com/nerzhul/home-bt-broker/internal/mgmt"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -186,6 +187,24 @@ func (_m *MockBluetoothManager) GetTrustedDevices(adapterPath string) ([]Device,
 	return r0, r1
 }
 
+// CancelPairing provides a mock function with given fields: adapterPath, macAddress
+func (_m *MockBluetoothManager) CancelPairing(adapterPath string, macAddress string) error {
+	ret := _m.Called(adapterPath, macAddress)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CancelPairing")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(adapterPath, macAddress)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // PairDevice provides a mock function with given fields: adapterPath, macAddress
 func (_m *MockBluetoothManager) PairDevice(adapterPath string, macAddress string) error {
 	ret := _m.Called(adapterPath, macAddress)
@@ -204,6 +223,24 @@ func (_m *MockBluetoothManager) PairDevice(adapterPath string, macAddress string
 	return r0
 }
 
+// PairDeviceWithOptions provides a mock function with given fields: adapterPath, macAddress, opts
+func (_m *MockBluetoothManager) PairDeviceWithOptions(adapterPath string, macAddress string, opts PairOptions) error {
+	ret := _m.Called(adapterPath, macAddress, opts)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PairDeviceWithOptions")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, PairOptions) error); ok {
+		r0 = rf(adapterPath, macAddress, opts)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // RemoveDevice provides a mock function with given fields: adapterPath, macAddress
 func (_m *MockBluetoothManager) RemoveDevice(adapterPath string, macAddress string) error {
 	ret := _m.Called(adapterPath, macAddress)
@@ -270,6 +307,390 @@ func (_m *MockBluetoothManager) SetDiscovering(adapterPath string, enable bool)
        return r0
 }
 
+// SetDiscoveryFilter provides a mock function with given fields: adapterPath, filter
+func (_m *MockBluetoothManager) SetDiscoveryFilter(adapterPath string, filter DiscoveryFilter) error {
+	ret := _m.Called(adapterPath, filter)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetDiscoveryFilter")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, DiscoveryFilter) error); ok {
+		r0 = rf(adapterPath, filter)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetPairingRequests provides a mock function with no fields
+func (_m *MockBluetoothManager) GetPairingRequests() []PairingRequest {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetPairingRequests")
+	}
+
+	var r0 []PairingRequest
+	if rf, ok := ret.Get(0).(func() []PairingRequest); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]PairingRequest)
+		}
+	}
+
+	return r0
+}
+
+// RespondPairingRequest provides a mock function with given fields: id, accept
+func (_m *MockBluetoothManager) RespondPairingRequest(id string, accept bool) error {
+	ret := _m.Called(id, accept)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RespondPairingRequest")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, bool) error); ok {
+		r0 = rf(id, accept)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetPowered provides a mock function with given fields: adapterPath, enable
+func (_m *MockBluetoothManager) SetPowered(adapterPath string, enable bool) error {
+	ret := _m.Called(adapterPath, enable)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetPowered")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, bool) error); ok {
+		r0 = rf(adapterPath, enable)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetWakeAllowed provides a mock function with given fields: adapterPath, macAddress, allow
+func (_m *MockBluetoothManager) SetWakeAllowed(adapterPath string, macAddress string, allow bool) error {
+	ret := _m.Called(adapterPath, macAddress, allow)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetWakeAllowed")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, bool) error); ok {
+		r0 = rf(adapterPath, macAddress, allow)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// Ping provides a mock function with no fields
+func (_m *MockBluetoothManager) Ping() error {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for Ping")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func() error); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetSystemInfo provides a mock function with no fields
+func (_m *MockBluetoothManager) GetSystemInfo() (*SystemInfo, error) {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetSystemInfo")
+	}
+
+	var r0 *SystemInfo
+	var r1 error
+	if rf, ok := ret.Get(0).(func() (*SystemInfo, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() *SystemInfo); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*SystemInfo)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SetPairingNotifier provides a mock function with given fields: notify
+func (_m *MockBluetoothManager) SetPairingNotifier(notify func(string, PairingRequest)) {
+	_m.Called(notify)
+}
+
+// SetPairingPolicy provides a mock function with given fields: allowed
+func (_m *MockBluetoothManager) SetPairingPolicy(allowed func(string) bool) {
+	_m.Called(allowed)
+}
+
+// SetVolume provides a mock function with given fields: adapterPath, macAddress, percent
+func (_m *MockBluetoothManager) SetVolume(adapterPath string, macAddress string, percent uint8) error {
+	ret := _m.Called(adapterPath, macAddress, percent)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetVolume")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, uint8) error); ok {
+		r0 = rf(adapterPath, macAddress, percent)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetTrack provides a mock function with given fields: adapterPath, macAddress
+func (_m *MockBluetoothManager) GetTrack(adapterPath string, macAddress string) (*Track, error) {
+	ret := _m.Called(adapterPath, macAddress)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTrack")
+	}
+
+	var r0 *Track
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string) (*Track, error)); ok {
+		return rf(adapterPath, macAddress)
+	}
+	if rf, ok := ret.Get(0).(func(string, string) *Track); ok {
+		r0 = rf(adapterPath, macAddress)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*Track)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(adapterPath, macAddress)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// JoinBroadcast provides a mock function with given fields: adapterPath, macAddress
+func (_m *MockBluetoothManager) JoinBroadcast(adapterPath string, macAddress string) error {
+	ret := _m.Called(adapterPath, macAddress)
+
+	if len(ret) == 0 {
+		panic("no return value specified for JoinBroadcast")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(adapterPath, macAddress)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// LeaveBroadcast provides a mock function with given fields: adapterPath, macAddress
+func (_m *MockBluetoothManager) LeaveBroadcast(adapterPath string, macAddress string) error {
+	ret := _m.Called(adapterPath, macAddress)
+
+	if len(ret) == 0 {
+		panic("no return value specified for LeaveBroadcast")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(adapterPath, macAddress)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ConnectDeviceSet provides a mock function with given fields: adapterPath, setID
+func (_m *MockBluetoothManager) ConnectDeviceSet(adapterPath string, setID string) error {
+	ret := _m.Called(adapterPath, setID)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ConnectDeviceSet")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(adapterPath, setID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetDeviceSets provides a mock function with given fields: adapterPath
+func (_m *MockBluetoothManager) GetDeviceSets(adapterPath string) ([]DeviceSet, error) {
+	ret := _m.Called(adapterPath)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetDeviceSets")
+	}
+
+	var r0 []DeviceSet
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string) ([]DeviceSet, error)); ok {
+		return rf(adapterPath)
+	}
+	if rf, ok := ret.Get(0).(func(string) []DeviceSet); ok {
+		r0 = rf(adapterPath)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]DeviceSet)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string) error); ok {
+		r1 = rf(adapterPath)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ConnectProfile provides a mock function with given fields: adapterPath, macAddress, uuid
+func (_m *MockBluetoothManager) ConnectProfile(adapterPath string, macAddress string, uuid string) error {
+	ret := _m.Called(adapterPath, macAddress, uuid)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ConnectProfile")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string, string) error); ok {
+		r0 = rf(adapterPath, macAddress, uuid)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DisconnectDevice provides a mock function with given fields: adapterPath, macAddress
+func (_m *MockBluetoothManager) DisconnectDevice(adapterPath string, macAddress string) error {
+	ret := _m.Called(adapterPath, macAddress)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DisconnectDevice")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(adapterPath, macAddress)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetLinkInfo provides a mock function with given fields: adapterPath, macAddress
+func (_m *MockBluetoothManager) GetLinkInfo(adapterPath string, macAddress string) (*mgmt.ConnInfo, error) {
+	ret := _m.Called(adapterPath, macAddress)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetLinkInfo")
+	}
+
+	var r0 *mgmt.ConnInfo
+	var r1 error
+	if rf, ok := ret.Get(0).(func(string, string) (*mgmt.ConnInfo, error)); ok {
+		return rf(adapterPath, macAddress)
+	}
+	if rf, ok := ret.Get(0).(func(string, string) *mgmt.ConnInfo); ok {
+		r0 = rf(adapterPath, macAddress)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mgmt.ConnInfo)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(string, string) error); ok {
+		r1 = rf(adapterPath, macAddress)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UntrustDevice provides a mock function with given fields: adapterPath, macAddress
+func (_m *MockBluetoothManager) UntrustDevice(adapterPath string, macAddress string) error {
+	ret := _m.Called(adapterPath, macAddress)
+
+	if len(ret) == 0 {
+		panic("no return value specified for UntrustDevice")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, string) error); ok {
+		r0 = rf(adapterPath, macAddress)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetPairable provides a mock function with given fields: adapterPath, enable
+func (_m *MockBluetoothManager) SetPairable(adapterPath string, enable bool) error {
+	ret := _m.Called(adapterPath, enable)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SetPairable")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(string, bool) error); ok {
+		r0 = rf(adapterPath, enable)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewMockBluetoothManager creates a new instance of MockBluetoothManager. It also registers a testing interface on the mock and a cleanup function to assert the mock's expectations.
 // The first argument is typically a *testing.T value.
 func NewMockBluetoothManager(t interface {
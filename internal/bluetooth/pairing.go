@@ -0,0 +1,197 @@
+package bluetooth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Pairing modes of the agent
+const (
+	// PairingModeAuto accepts every confirmation and authorization request
+	PairingModeAuto = "auto"
+	// PairingModeManual parks confirmation and authorization requests until they are accepted or rejected
+	PairingModeManual = "manual"
+)
+
+// Kinds of pairing requests waiting for a decision
+const (
+	PairingRequestConfirmation  = "confirmation"
+	PairingRequestAuthorization = "authorization"
+	PairingRequestService       = "service"
+)
+
+// Kinds of pairing prompts only displayed to the user
+const (
+	PairingDisplayPasskey = "display_passkey"
+	PairingDisplayPinCode = "display_pin_code"
+)
+
+// Pairing event types passed to the pairing notifier
+const (
+	// EventPairingRequested is published when a pairing request waits for a decision
+	EventPairingRequested = "pairing_requested"
+	// EventPairingResolved is published when a pairing request is answered, times out or is cancelled
+	EventPairingResolved = "pairing_resolved"
+	// EventPairingDisplay is published when a passkey or PIN must be shown to the user
+	EventPairingDisplay = "pairing_display"
+)
+
+// ErrPairingRequestNotFound is returned when answering a pairing request that does not exist or expired
+var ErrPairingRequestNotFound = errors.New("pairing request not found")
+
+// PairingRequest is an agent request waiting for a decision, or a prompt to display
+type PairingRequest struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	Device    string     `json:"device"`
+	Address   string     `json:"address"`
+	Passkey   *uint32    `json:"passkey,omitempty"`
+	Entered   *uint16    `json:"entered,omitempty"`
+	PinCode   string     `json:"pin_code,omitempty"`
+	UUID      string     `json:"uuid,omitempty"`
+	Accepted  *bool      `json:"accepted,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// pairingQueue holds pending pairing requests until they are answered or time out
+type pairingQueue struct {
+	timeout time.Duration
+
+	mu       sync.Mutex
+	requests map[string]*pendingPairingRequest
+	notify   func(eventType string, req PairingRequest)
+}
+
+type pendingPairingRequest struct {
+	PairingRequest
+	response chan bool
+}
+
+func newPairingQueue(timeout time.Duration) *pairingQueue {
+	return &pairingQueue{
+		timeout:  timeout,
+		requests: make(map[string]*pendingPairingRequest),
+	}
+}
+
+// newPairingRequest creates a request for a device with a random ID
+func newPairingRequest(requestType string, device dbus.ObjectPath) (PairingRequest, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return PairingRequest{}, fmt.Errorf("failed to generate pairing request ID: %w", err)
+	}
+
+	return PairingRequest{
+		ID:        hex.EncodeToString(id),
+		Type:      requestType,
+		Device:    string(device),
+		Address:   addressFromPath(device),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// publish passes a pairing event to the notifier, if any
+func (q *pairingQueue) publish(eventType string, req PairingRequest) {
+	q.mu.Lock()
+	notify := q.notify
+	q.mu.Unlock()
+
+	if notify != nil {
+		notify(eventType, req)
+	}
+}
+
+// wait parks a request and blocks until it is answered, returning false on rejection or timeout
+func (q *pairingQueue) wait(req PairingRequest) bool {
+	expiresAt := req.CreatedAt.Add(q.timeout)
+	req.ExpiresAt = &expiresAt
+	pending := &pendingPairingRequest{
+		PairingRequest: req,
+		response:       make(chan bool, 1),
+	}
+
+	q.mu.Lock()
+	q.requests[req.ID] = pending
+	q.mu.Unlock()
+
+	q.publish(EventPairingRequested, req)
+
+	var accepted bool
+	select {
+	case accepted = <-pending.response:
+	case <-time.After(q.timeout):
+		// A response sent before the request is removed wins over the timeout, a later one gets
+		// ErrPairingRequestNotFound
+		q.mu.Lock()
+		if _, ok := q.requests[req.ID]; ok {
+			delete(q.requests, req.ID)
+		} else {
+			accepted = <-pending.response
+		}
+		q.mu.Unlock()
+	}
+
+	req.Accepted = &accepted
+	q.publish(EventPairingResolved, req)
+	return accepted
+}
+
+// list returns the pending requests, oldest first
+func (q *pairingQueue) list() []PairingRequest {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	requests := make([]PairingRequest, 0, len(q.requests))
+	for _, pending := range q.requests {
+		requests = append(requests, pending.PairingRequest)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	return requests
+}
+
+// respond answers a pending request. The request is removed before the response is sent, under the
+// lock, so that it is answered only once.
+func (q *pairingQueue) respond(id string, accept bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending, ok := q.requests[id]
+	if !ok {
+		return ErrPairingRequestNotFound
+	}
+	delete(q.requests, id)
+	pending.response <- accept
+	return nil
+}
+
+// cancelAll rejects every pending request, when BlueZ cancels the agent request
+func (q *pairingQueue) cancelAll() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for id, pending := range q.requests {
+		delete(q.requests, id)
+		pending.response <- false
+	}
+}
+
+// addressFromPath extracts the MAC address from a BlueZ device object path
+func addressFromPath(path dbus.ObjectPath) string {
+	p := string(path)
+	i := strings.LastIndex(p, "/dev_")
+	if i < 0 {
+		return ""
+	}
+	return strings.ReplaceAll(p[i+len("/dev_"):], "_", ":")
+}
@@ -0,0 +1,109 @@
+package bluetooth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairingQueue_Accept(t *testing.T) {
+	q := newPairingQueue(time.Second)
+	notified := make(chan PairingRequest, 2)
+	q.notify = func(eventType string, req PairingRequest) { notified <- req }
+
+	passkey := uint32(123456)
+	req, err := newPairingRequest(PairingRequestConfirmation, "/org/bluez/hci0/dev_11_22_33_44_55_66")
+	assert.NoError(t, err)
+	req.Passkey = &passkey
+	result := make(chan bool)
+	go func() {
+		result <- q.wait(req)
+	}()
+
+	req = <-notified
+	assert.Equal(t, "11:22:33:44:55:66", req.Address)
+	assert.Equal(t, uint32(123456), *req.Passkey)
+	assert.Len(t, q.list(), 1)
+
+	assert.NoError(t, q.respond(req.ID, true))
+	assert.True(t, <-result)
+	resolved := <-notified
+	assert.True(t, *resolved.Accepted)
+	assert.Empty(t, q.list())
+
+	assert.ErrorIs(t, q.respond(req.ID, true), ErrPairingRequestNotFound)
+}
+
+func TestPairingQueue_Timeout(t *testing.T) {
+	q := newPairingQueue(10 * time.Millisecond)
+
+	req, err := newPairingRequest(PairingRequestAuthorization, "/org/bluez/hci0/dev_11_22_33_44_55_66")
+	assert.NoError(t, err)
+	assert.False(t, q.wait(req))
+	assert.Empty(t, q.list())
+
+	// A response after the timeout does not find the request
+	assert.ErrorIs(t, q.respond(req.ID, true), ErrPairingRequestNotFound)
+}
+
+func TestPairingQueue_ResponseRacesTimeout(t *testing.T) {
+	q := newPairingQueue(10 * time.Millisecond)
+	notified := make(chan PairingRequest, 2)
+	q.notify = func(eventType string, req PairingRequest) { notified <- req }
+
+	req, err := newPairingRequest(PairingRequestAuthorization, "/org/bluez/hci0/dev_11_22_33_44_55_66")
+	assert.NoError(t, err)
+	result := make(chan bool)
+	go func() {
+		result <- q.wait(req)
+	}()
+
+	// Hold the lock past the timeout: the response accepted meanwhile is not lost
+	req = <-notified
+	q.mu.Lock()
+	time.Sleep(20 * time.Millisecond)
+	pending := q.requests[req.ID]
+	delete(q.requests, req.ID)
+	pending.response <- true
+	q.mu.Unlock()
+
+	assert.True(t, <-result)
+}
+
+func TestPairingQueue_CancelAll(t *testing.T) {
+	q := newPairingQueue(time.Second)
+	notified := make(chan PairingRequest, 2)
+	q.notify = func(eventType string, req PairingRequest) { notified <- req }
+
+	req, err := newPairingRequest(PairingRequestService, "/org/bluez/hci0/dev_11_22_33_44_55_66")
+	assert.NoError(t, err)
+	req.UUID = "0000110b-0000-1000-8000-00805f9b34fb"
+	result := make(chan bool)
+	go func() {
+		result <- q.wait(req)
+	}()
+
+	<-notified
+	q.cancelAll()
+	assert.False(t, <-result)
+}
+
+func TestBluetoothManager_PairingPolicy(t *testing.T) {
+	bm := &BluetoothManager{
+		pairingOptions:  make(map[dbus.ObjectPath]PairOptions),
+		pairingMode:     PairingModeAuto,
+		pairingRequests: newPairingQueue(time.Second),
+	}
+	bm.SetPairingPolicy(func(address string) bool { return address == "11:22:33:44:55:66" })
+
+	assert.Nil(t, bm.RequestAuthorization("/org/bluez/hci0/dev_11_22_33_44_55_66"))
+	assert.NotNil(t, bm.RequestAuthorization("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF"))
+	_, err := bm.RequestPasskey("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF")
+	assert.NotNil(t, err)
+
+	// Pairings started through the API are not restricted
+	bm.pairingOptions["/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF"] = PairOptions{}
+	assert.Nil(t, bm.RequestConfirmation("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF", 123456))
+}
@@ -0,0 +1,90 @@
+package bluetooth
+
+import (
+	"sort"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Interfaces of the profiles BlueZ exposes on a connected device
+const (
+	// InputInterface is registered on the devices served by the HID host profile
+	InputInterface = "org.bluez.Input1"
+	// MediaControlInterface reports whether the AVRCP profile of a device is connected
+	MediaControlInterface = "org.bluez.MediaControl1"
+	// NetworkInterface reports whether the PAN profile of a device is connected
+	NetworkInterface = "org.bluez.Network1"
+)
+
+var (
+	hidUUID   = NormalizeUUID("1124")
+	avrcpUUID = NormalizeUUID("110e")
+)
+
+// connectedProfiles maps the paths of the connected devices to the UUIDs of their connected profiles:
+// the profiles of their media transports, AVRCP, HID and PAN. A connected device with no profile gets
+// an empty list, which tells apart a link up with no audio attached.
+func connectedProfiles(objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant) map[dbus.ObjectPath][]string {
+	profiles := make(map[dbus.ObjectPath][]string)
+	add := func(device dbus.ObjectPath, uuid string) {
+		if uuid = NormalizeUUID(uuid); !containsString(profiles[device], uuid) {
+			profiles[device] = append(profiles[device], uuid)
+		}
+	}
+
+	for path, interfaces := range objects {
+		if props, ok := interfaces[DeviceInterface]; ok {
+			if connected, _ := props["Connected"].Value().(bool); connected && profiles[path] == nil {
+				profiles[path] = []string{}
+			}
+		}
+	}
+	for path, interfaces := range objects {
+		if props, ok := interfaces[MediaTransportInterface]; ok {
+			device, _ := props["Device"].Value().(dbus.ObjectPath)
+			if uuid, ok := props["UUID"].Value().(string); ok && profiles[device] != nil {
+				add(device, uuid)
+			}
+		}
+		if profiles[path] == nil {
+			continue
+		}
+		if _, ok := interfaces[InputInterface]; ok {
+			add(path, hidUUID)
+		}
+		if props, ok := interfaces[MediaControlInterface]; ok {
+			if connected, _ := props["Connected"].Value().(bool); connected {
+				add(path, avrcpUUID)
+			}
+		}
+		if props, ok := interfaces[NetworkInterface]; ok {
+			connected, _ := props["Connected"].Value().(bool)
+			if uuid, ok := props["UUID"].Value().(string); ok && connected {
+				add(path, uuid)
+			}
+		}
+	}
+
+	for _, uuids := range profiles {
+		sort.Strings(uuids)
+	}
+	return profiles
+}
+
+// simulatedProfiles are the profiles connected along with a simulated device advertising them
+var simulatedProfiles = []string{"1108", "110a", "110b", "110e", "111e", "1124", "1812", "184e"}
+
+// simulatedConnectedProfiles returns the connected profiles of a simulated device
+func simulatedConnectedProfiles(device Device) []string {
+	profiles := []string{}
+	if !device.Connected {
+		return profiles
+	}
+	for _, uuid := range simulatedProfiles {
+		if uuid = NormalizeUUID(uuid); containsString(device.UUIDs, uuid) {
+			profiles = append(profiles, uuid)
+		}
+	}
+	sort.Strings(profiles)
+	return profiles
+}
@@ -0,0 +1,46 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectedProfiles(t *testing.T) {
+	headset := dbus.ObjectPath("/org/bluez/hci0/dev_38_18_4C_12_34_56")
+	broken := dbus.ObjectPath("/org/bluez/hci0/dev_DC_2C_26_AB_CD_EF")
+	disconnected := dbus.ObjectPath("/org/bluez/hci0/dev_5C_17_CF_11_22_33")
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{
+		headset: {
+			DeviceInterface:       {"Connected": dbus.MakeVariant(true)},
+			MediaControlInterface: {"Connected": dbus.MakeVariant(true)},
+		},
+		headset + "/sep1/fd0": {MediaTransportInterface: {
+			"Device": dbus.MakeVariant(headset),
+			"UUID":   dbus.MakeVariant("0000110B-0000-1000-8000-00805F9B34FB"),
+		}},
+		headset + "/sep2/fd1": {MediaTransportInterface: {
+			"Device": dbus.MakeVariant(headset),
+			"UUID":   dbus.MakeVariant("0000111e-0000-1000-8000-00805f9b34fb"),
+		}},
+		broken: {
+			DeviceInterface:       {"Connected": dbus.MakeVariant(true)},
+			MediaControlInterface: {"Connected": dbus.MakeVariant(false)},
+		},
+		disconnected: {
+			DeviceInterface: {"Connected": dbus.MakeVariant(false)},
+			InputInterface:  {},
+		},
+	}
+
+	profiles := connectedProfiles(objects)
+	assert.Equal(t, []string{
+		"0000110b-0000-1000-8000-00805f9b34fb",
+		"0000110e-0000-1000-8000-00805f9b34fb",
+		"0000111e-0000-1000-8000-00805f9b34fb",
+	}, profiles[headset])
+	// Connected with no profile attached
+	assert.Equal(t, []string{}, profiles[broken])
+	assert.Nil(t, profiles[disconnected])
+}
@@ -0,0 +1,115 @@
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// DeviceSetInterface is the BlueZ interface of a coordinated set (CSIS), such as a pair of LE Audio earbuds
+const DeviceSetInterface = "org.bluez.DeviceSet1"
+
+// ErrDeviceSetNotFound is returned when an adapter has no coordinated set with the given ID
+var ErrDeviceSetNotFound = errors.New("device set not found")
+
+// SetMembership is the coordinated set a device belongs to
+type SetMembership struct {
+	// ID identifies the set on its adapter, e.g. set_0
+	ID   string `json:"id"`
+	Rank uint8  `json:"rank"`
+}
+
+// DeviceSet is a coordinated set of devices acting as one logical device
+type DeviceSet struct {
+	ID          string `json:"id"`
+	Path        string `json:"path"`
+	Adapter     string `json:"adapter"`
+	Size        uint8  `json:"size"`
+	AutoConnect bool   `json:"auto_connect"`
+	// Members are the addresses of the members known to BlueZ, ordered by rank
+	Members []string `json:"members"`
+}
+
+// decodeSetMembership reads the Sets property of a device, which maps the set paths to the device rank
+func decodeSetMembership(sets dbus.Variant) *SetMembership {
+	values, ok := sets.Value().(map[dbus.ObjectPath]map[string]dbus.Variant)
+	if !ok {
+		return nil
+	}
+	for setPath, props := range values {
+		membership := &SetMembership{ID: path.Base(string(setPath))}
+		membership.Rank, _ = props["Rank"].Value().(uint8)
+		return membership
+	}
+	return nil
+}
+
+// GetDeviceSets returns the coordinated sets of an adapter
+func (bm *BluetoothManager) GetDeviceSets(adapterPath string) ([]DeviceSet, error) {
+	objects, err := bm.managedObjects()
+	if err != nil {
+		return nil, err
+	}
+
+	sets := []DeviceSet{}
+	for setPath, interfaces := range objects {
+		props, ok := interfaces[DeviceSetInterface]
+		if !ok || !strings.HasPrefix(string(setPath), adapterPath+"/") {
+			continue
+		}
+
+		set := DeviceSet{
+			ID:      path.Base(string(setPath)),
+			Path:    string(setPath),
+			Adapter: adapterPath,
+			Members: []string{},
+		}
+		set.Size, _ = props["Size"].Value().(uint8)
+		set.AutoConnect, _ = props["AutoConnect"].Value().(bool)
+
+		devices, _ := props["Devices"].Value().([]dbus.ObjectPath)
+		ranks := make(map[string]uint8, len(devices))
+		for _, devicePath := range devices {
+			deviceProps := objects[devicePath][DeviceInterface]
+			address, ok := deviceProps["Address"].Value().(string)
+			if !ok {
+				continue
+			}
+			if membership := decodeSetMembership(deviceProps["Sets"]); membership != nil {
+				ranks[address] = membership.Rank
+			}
+			set.Members = append(set.Members, address)
+		}
+		sort.Slice(set.Members, func(i, j int) bool { return ranks[set.Members[i]] < ranks[set.Members[j]] })
+
+		sets = append(sets, set)
+	}
+
+	sort.Slice(sets, func(i, j int) bool { return sets[i].ID < sets[j].ID })
+	return sets, nil
+}
+
+// ConnectDeviceSet connects every member of a coordinated set
+func (bm *BluetoothManager) ConnectDeviceSet(adapterPath, setID string) error {
+	sets, err := bm.GetDeviceSets(adapterPath)
+	if err != nil {
+		return err
+	}
+
+	for _, set := range sets {
+		if set.ID != setID {
+			continue
+		}
+		call := bm.conn.Object(BluezService, dbus.ObjectPath(set.Path)).Call(DeviceSetInterface+".Connect", 0)
+		if call.Err != nil {
+			return fmt.Errorf("failed to connect device set %s: %w", setID, call.Err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("failed to connect device set %s: %w", setID, ErrDeviceSetNotFound)
+}
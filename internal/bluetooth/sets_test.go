@@ -0,0 +1,35 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeSetMembership(t *testing.T) {
+	sets := dbus.MakeVariant(map[dbus.ObjectPath]map[string]dbus.Variant{
+		"/org/bluez/hci0/set_1f2e3d": {"Rank": dbus.MakeVariant(uint8(2))},
+	})
+	assert.Equal(t, &SetMembership{ID: "set_1f2e3d", Rank: 2}, decodeSetMembership(sets))
+
+	assert.Nil(t, decodeSetMembership(dbus.MakeVariant(map[dbus.ObjectPath]map[string]dbus.Variant{})))
+	assert.Nil(t, decodeSetMembership(dbus.MakeVariant("invalid")))
+}
+
+func TestSimulatedManager_DeviceSets(t *testing.T) {
+	sm := NewSimulatedManager(Options{})
+	adapterPath, _ := sm.GetAdapterPathByMAC("00:1A:7D:DA:71:01")
+
+	sets, err := sm.GetDeviceSets(adapterPath)
+	assert.NoError(t, err)
+	assert.Len(t, sets, 1)
+	assert.Equal(t, uint8(2), sets[0].Size)
+	assert.Equal(t, []string{"E4:5F:01:AA:00:01", "E4:5F:01:AA:00:02"}, sets[0].Members)
+
+	assert.NoError(t, sm.ConnectDeviceSet(adapterPath, sets[0].ID))
+	connected, _ := sm.GetConnectedDevices(adapterPath)
+	assert.Len(t, connected, 3)
+
+	assert.ErrorIs(t, sm.ConnectDeviceSet(adapterPath, "set_42"), ErrDeviceSetNotFound)
+}
@@ -0,0 +1,131 @@
+package signals
+
+import (
+	"context"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+// Device events published from the BlueZ signals
+const (
+	EventDeviceFound        = "device_found"
+	EventDeviceRemoved      = "device_removed"
+	EventDeviceConnected    = "device_connected"
+	EventDeviceDisconnected = "device_disconnected"
+	// EventDeviceTrusted is published when a device becomes trusted on an adapter
+	EventDeviceTrusted = "device_trusted"
+	// EventTrackChanged is published when the media player of a device moves to another track
+	EventTrackChanged = "track_changed"
+	// EventAdapterAdded and EventAdapterRemoved are published when a controller is plugged or unplugged
+	EventAdapterAdded   = "adapter_added"
+	EventAdapterRemoved = "adapter_removed"
+)
+
+// DeviceEvent is the data of the device events
+type DeviceEvent struct {
+	Address string `json:"address"`
+	Adapter string `json:"adapter"`
+	Name    string `json:"name,omitempty"`
+}
+
+// AdapterEvent is the data of the adapter events
+type AdapterEvent struct {
+	Adapter string `json:"adapter"`
+	// Address is unknown once the adapter is removed
+	Address string `json:"address,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
+
+// TrackEvent is the data of the track change events
+type TrackEvent struct {
+	Address string          `json:"address"`
+	Adapter string          `json:"adapter"`
+	Track   bluetooth.Track `json:"track"`
+}
+
+// PublishDeviceEvents publishes the device events on the hub until the context is cancelled
+func (m *Manager) PublishDeviceEvents(ctx context.Context, hub *events.Hub) {
+	properties, unsubscribeProperties := m.SubscribeProperties()
+	defer unsubscribeProperties()
+	added, unsubscribeAdded := m.SubscribeInterfacesAdded()
+	defer unsubscribeAdded()
+	removed, unsubscribeRemoved := m.SubscribeInterfacesRemoved()
+	defer unsubscribeRemoved()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-properties:
+			if _, ok := change.Changed["Track"]; ok && change.Interface == bluetooth.MediaPlayerInterface {
+				// Players are children of their device, e.g. /org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF/player0
+				if event, ok := deviceEvent(change.Path[:strings.LastIndex(string(change.Path), "/")]); ok {
+					hub.Publish(EventTrackChanged, TrackEvent{Address: event.Address, Adapter: event.Adapter, Track: bluetooth.DecodeTrack(change.Changed)})
+				}
+				continue
+			}
+			if change.Interface != bluetooth.DeviceInterface {
+				continue
+			}
+			event, ok := deviceEvent(change.Path)
+			if !ok {
+				continue
+			}
+			if trusted, ok := change.Changed["Trusted"]; ok {
+				if isTrusted, _ := trusted.Value().(bool); isTrusted {
+					hub.Publish(EventDeviceTrusted, event)
+				}
+			}
+			if connected, ok := change.Changed["Connected"]; ok {
+				if isConnected, _ := connected.Value().(bool); isConnected {
+					hub.Publish(EventDeviceConnected, event)
+				} else {
+					hub.Publish(EventDeviceDisconnected, event)
+				}
+			}
+		case object := <-added:
+			if props, ok := object.Interfaces[bluetooth.AdapterInterface]; ok {
+				event := AdapterEvent{Adapter: string(object.Path)}
+				if address, ok := props["Address"]; ok {
+					event.Address, _ = address.Value().(string)
+				}
+				if name, ok := props["Name"]; ok {
+					event.Name, _ = name.Value().(string)
+				}
+				hub.Publish(EventAdapterAdded, event)
+				continue
+			}
+			props, ok := object.Interfaces[bluetooth.DeviceInterface]
+			if !ok {
+				continue
+			}
+			if event, ok := deviceEvent(object.Path); ok {
+				if name, ok := props["Name"]; ok {
+					event.Name, _ = name.Value().(string)
+				}
+				hub.Publish(EventDeviceFound, event)
+			}
+		case object := <-removed:
+			for _, iface := range object.Interfaces {
+				if iface == bluetooth.AdapterInterface {
+					hub.Publish(EventAdapterRemoved, AdapterEvent{Adapter: string(object.Path)})
+					continue
+				}
+				if iface != bluetooth.DeviceInterface {
+					continue
+				}
+				if event, ok := deviceEvent(object.Path); ok {
+					hub.Publish(EventDeviceRemoved, event)
+				}
+			}
+		}
+	}
+}
+
+func deviceEvent(path dbus.ObjectPath) (DeviceEvent, bool) {
+	address, adapter, ok := DeviceAddress(path)
+	return DeviceEvent{Address: address, Adapter: adapter}, ok
+}
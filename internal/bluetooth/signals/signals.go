@@ -0,0 +1,279 @@
+// Package signals owns the D-Bus match rules of the broker and demultiplexes the BlueZ signals
+// to typed channels, so that subsystems reacting to BlueZ changes share a single subscription
+package signals
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/health"
+)
+
+const (
+	propertiesInterface = "org.freedesktop.DBus.Properties"
+
+	// signalBuffer is the number of signals buffered per subscriber before signals are dropped
+	signalBuffer = 64
+
+	// heartbeatInterface and heartbeatPath identify the signal the manager emits to itself, so that
+	// the signal loop keeps beating while BlueZ is silent
+	heartbeatInterface = "io.github.nerzhul.HomeBtBroker.Signals"
+	heartbeatPath      = dbus.ObjectPath("/io/github/nerzhul/HomeBtBroker/signals")
+
+	// MonitorLoop is the name of the signal loop in the health monitor
+	MonitorLoop = "signals"
+)
+
+// PropertiesChanged is emitted when properties of a BlueZ object change
+type PropertiesChanged struct {
+	Path        dbus.ObjectPath
+	Interface   string
+	Changed     map[string]dbus.Variant
+	Invalidated []string
+}
+
+// InterfacesAdded is emitted when BlueZ exports a new object, such as a device found by discovery
+type InterfacesAdded struct {
+	Path       dbus.ObjectPath
+	Interfaces map[string]map[string]dbus.Variant
+}
+
+// InterfacesRemoved is emitted when BlueZ removes interfaces of an object, such as a forgotten device
+type InterfacesRemoved struct {
+	Path       dbus.ObjectPath
+	Interfaces []string
+}
+
+// Manager subscribes once to the BlueZ signals and fans them out to every subscriber
+type Manager struct {
+	conn    *dbus.Conn
+	signals chan *dbus.Signal
+
+	monitor           *health.Monitor
+	heartbeatInterval time.Duration
+
+	properties subscribers[PropertiesChanged]
+	added      subscribers[InterfacesAdded]
+	removed    subscribers[InterfacesRemoved]
+}
+
+// matchRules are the D-Bus match rules owned by the manager
+var matchRules = [][]dbus.MatchOption{
+	{
+		dbus.WithMatchSender(bluetooth.BluezService),
+		dbus.WithMatchInterface(propertiesInterface),
+		dbus.WithMatchMember("PropertiesChanged"),
+		dbus.WithMatchPathNamespace("/org/bluez"),
+	},
+	{
+		dbus.WithMatchSender(bluetooth.BluezService),
+		dbus.WithMatchInterface(bluetooth.ObjectManagerIface),
+		dbus.WithMatchMember("InterfacesAdded"),
+	},
+	{
+		dbus.WithMatchSender(bluetooth.BluezService),
+		dbus.WithMatchInterface(bluetooth.ObjectManagerIface),
+		dbus.WithMatchMember("InterfacesRemoved"),
+	},
+}
+
+// NewManager creates a signal manager on a D-Bus connection
+func NewManager(conn *dbus.Conn) *Manager {
+	return &Manager{
+		conn:    conn,
+		signals: make(chan *dbus.Signal, signalBuffer),
+	}
+}
+
+// SetMonitor reports the signal loop to the health monitor. Every dispatched signal beats the
+// monitor, and the manager emits a heartbeat signal to itself every interval, so that the loop
+// stalls in the monitor when the signals stop being delivered.
+func (m *Manager) SetMonitor(monitor *health.Monitor, interval time.Duration) {
+	m.monitor = monitor
+	m.heartbeatInterval = interval
+}
+
+// Run adds the match rules and dispatches the signals until the context is cancelled,
+// then removes the match rules
+func (m *Manager) Run(ctx context.Context) error {
+	rules := matchRules
+	if m.monitor != nil {
+		// A failed subscription stalls the loop too, as no signal will ever be delivered
+		m.monitor.Register(MonitorLoop, m.heartbeatInterval)
+		rules = append(rules[:len(rules):len(rules)], []dbus.MatchOption{
+			dbus.WithMatchSender(m.conn.Names()[0]),
+			dbus.WithMatchInterface(heartbeatInterface),
+			dbus.WithMatchMember("Heartbeat"),
+		})
+	}
+
+	for i, rule := range rules {
+		if err := m.conn.AddMatchSignal(rule...); err != nil {
+			for _, added := range rules[:i] {
+				m.conn.RemoveMatchSignal(added...)
+			}
+			return err
+		}
+	}
+	m.conn.Signal(m.signals)
+
+	defer func() {
+		m.conn.RemoveSignal(m.signals)
+		for _, rule := range rules {
+			if err := m.conn.RemoveMatchSignal(rule...); err != nil {
+				log.Printf("Signals: failed to remove match rule: %v", err)
+			}
+		}
+	}()
+
+	var heartbeat <-chan time.Time
+	if m.monitor != nil {
+		ticker := time.NewTicker(m.heartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+		m.emitHeartbeat()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat:
+			m.emitHeartbeat()
+		case signal, ok := <-m.signals:
+			if !ok {
+				return nil
+			}
+			m.dispatch(signal)
+		}
+	}
+}
+
+// emitHeartbeat sends the heartbeat signal through the bus, with its emission time to measure the
+// delivery latency
+func (m *Manager) emitHeartbeat() {
+	if err := m.conn.Emit(heartbeatPath, heartbeatInterface+".Heartbeat", time.Now().UnixNano()); err != nil {
+		log.Printf("Signals: failed to emit the heartbeat: %v", err)
+	}
+}
+
+// dispatch decodes a signal and sends it to the matching subscribers
+func (m *Manager) dispatch(signal *dbus.Signal) {
+	if m.monitor != nil {
+		var latency time.Duration
+		if sent, ok := heartbeatSent(signal); ok {
+			latency = time.Since(sent)
+		}
+		m.monitor.Beat(MonitorLoop, latency)
+	}
+
+	switch signal.Name {
+	case propertiesInterface + ".PropertiesChanged":
+		if len(signal.Body) < 3 {
+			return
+		}
+		iface, _ := signal.Body[0].(string)
+		changed, _ := signal.Body[1].(map[string]dbus.Variant)
+		invalidated, _ := signal.Body[2].([]string)
+		m.properties.publish(PropertiesChanged{
+			Path:        signal.Path,
+			Interface:   iface,
+			Changed:     changed,
+			Invalidated: invalidated,
+		})
+	case bluetooth.ObjectManagerIface + ".InterfacesAdded":
+		if len(signal.Body) < 2 {
+			return
+		}
+		path, _ := signal.Body[0].(dbus.ObjectPath)
+		interfaces, _ := signal.Body[1].(map[string]map[string]dbus.Variant)
+		m.added.publish(InterfacesAdded{Path: path, Interfaces: interfaces})
+	case bluetooth.ObjectManagerIface + ".InterfacesRemoved":
+		if len(signal.Body) < 2 {
+			return
+		}
+		path, _ := signal.Body[0].(dbus.ObjectPath)
+		interfaces, _ := signal.Body[1].([]string)
+		m.removed.publish(InterfacesRemoved{Path: path, Interfaces: interfaces})
+	}
+}
+
+// heartbeatSent returns the emission time of a heartbeat signal
+func heartbeatSent(signal *dbus.Signal) (time.Time, bool) {
+	if signal.Name != heartbeatInterface+".Heartbeat" || len(signal.Body) < 1 {
+		return time.Time{}, false
+	}
+	sent, ok := signal.Body[0].(int64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, sent), true
+}
+
+// SubscribeProperties registers a subscriber to property changes. The returned function must be called to unsubscribe.
+func (m *Manager) SubscribeProperties() (<-chan PropertiesChanged, func()) {
+	return m.properties.subscribe()
+}
+
+// SubscribeInterfacesAdded registers a subscriber to new objects. The returned function must be called to unsubscribe.
+func (m *Manager) SubscribeInterfacesAdded() (<-chan InterfacesAdded, func()) {
+	return m.added.subscribe()
+}
+
+// SubscribeInterfacesRemoved registers a subscriber to removed objects. The returned function must be called to unsubscribe.
+func (m *Manager) SubscribeInterfacesRemoved() (<-chan InterfacesRemoved, func()) {
+	return m.removed.subscribe()
+}
+
+// subscribers fans out values of a signal type, slow subscribers whose buffer is full miss the value
+type subscribers[T any] struct {
+	mu    sync.RWMutex
+	chans map[chan T]struct{}
+}
+
+func (s *subscribers[T]) subscribe() (<-chan T, func()) {
+	ch := make(chan T, signalBuffer)
+
+	s.mu.Lock()
+	if s.chans == nil {
+		s.chans = make(map[chan T]struct{})
+	}
+	s.chans[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.chans[ch]; ok {
+			delete(s.chans, ch)
+			close(ch)
+		}
+	}
+}
+
+func (s *subscribers[T]) publish(value T) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for ch := range s.chans {
+		select {
+		case ch <- value:
+		default:
+		}
+	}
+}
+
+// DeviceAddress extracts the MAC address and the adapter path from a BlueZ device object path,
+// it returns false for other objects
+func DeviceAddress(path dbus.ObjectPath) (address string, adapterPath string, ok bool) {
+	p := string(path)
+	i := strings.LastIndex(p, "/dev_")
+	if i < 0 || strings.Contains(p[i+1:], "/") {
+		return "", "", false
+	}
+	return strings.ReplaceAll(p[i+len("/dev_"):], "_", ":"), p[:i], true
+}
@@ -0,0 +1,168 @@
+package signals
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManager_Dispatch(t *testing.T) {
+	m := NewManager(nil)
+	properties, unsubscribe := m.SubscribeProperties()
+	defer unsubscribe()
+	added, unsubscribeAdded := m.SubscribeInterfacesAdded()
+	defer unsubscribeAdded()
+
+	m.dispatch(&dbus.Signal{
+		Path: "/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF",
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{bluetooth.DeviceInterface, map[string]dbus.Variant{"Connected": dbus.MakeVariant(true)}, []string{}},
+	})
+	change := <-properties
+	assert.Equal(t, bluetooth.DeviceInterface, change.Interface)
+	assert.Equal(t, true, change.Changed["Connected"].Value())
+
+	m.dispatch(&dbus.Signal{
+		Path: "/",
+		Name: "org.freedesktop.DBus.ObjectManager.InterfacesAdded",
+		Body: []interface{}{
+			dbus.ObjectPath("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF"),
+			map[string]map[string]dbus.Variant{bluetooth.DeviceInterface: {}},
+		},
+	})
+	object := <-added
+	assert.Equal(t, dbus.ObjectPath("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF"), object.Path)
+
+	// Malformed signals are ignored
+	m.dispatch(&dbus.Signal{Name: "org.freedesktop.DBus.Properties.PropertiesChanged"})
+	assert.Empty(t, properties)
+}
+
+func TestManager_DispatchBeatsMonitor(t *testing.T) {
+	monitor := health.NewMonitor()
+	m := NewManager(nil)
+	m.SetMonitor(monitor, 10*time.Millisecond)
+	monitor.Register(MonitorLoop, 10*time.Millisecond)
+
+	time.Sleep(40 * time.Millisecond)
+	assert.True(t, monitor.Stalled())
+
+	// The heartbeat reports its delivery latency
+	m.dispatch(&dbus.Signal{
+		Path: heartbeatPath,
+		Name: heartbeatInterface + ".Heartbeat",
+		Body: []interface{}{time.Now().Add(-2 * time.Millisecond).UnixNano()},
+	})
+	assert.False(t, monitor.Stalled())
+	statuses := monitor.Statuses()
+	if assert.Len(t, statuses, 1) {
+		assert.NotNil(t, statuses[0].LastBeat)
+		latency, err := time.ParseDuration(statuses[0].Latency)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, latency, 2*time.Millisecond)
+	}
+
+	// BlueZ signals beat the monitor too
+	time.Sleep(40 * time.Millisecond)
+	assert.True(t, monitor.Stalled())
+	m.dispatch(&dbus.Signal{
+		Path: "/org/bluez/hci0",
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{bluetooth.AdapterInterface, map[string]dbus.Variant{}, []string{}},
+	})
+	assert.False(t, monitor.Stalled())
+}
+
+func TestDeviceAddress(t *testing.T) {
+	address, adapter, ok := DeviceAddress("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF")
+	assert.True(t, ok)
+	assert.Equal(t, "AA:BB:CC:DD:EE:FF", address)
+	assert.Equal(t, "/org/bluez/hci0", adapter)
+
+	_, _, ok = DeviceAddress("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF/sep1")
+	assert.False(t, ok)
+	_, _, ok = DeviceAddress("/org/bluez/hci0")
+	assert.False(t, ok)
+}
+
+func TestManager_PublishDeviceEvents(t *testing.T) {
+	m := NewManager(nil)
+	hub := events.NewHub()
+	received, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.PublishDeviceEvents(ctx, hub)
+
+	// Wait for the subscriptions
+	assert.Eventually(t, func() bool {
+		m.removed.mu.RLock()
+		defer m.removed.mu.RUnlock()
+		return len(m.removed.chans) == 1
+	}, time.Second, time.Millisecond)
+
+	m.dispatch(&dbus.Signal{
+		Path: "/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF",
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{bluetooth.DeviceInterface, map[string]dbus.Variant{"Connected": dbus.MakeVariant(false)}, []string{}},
+	})
+	event := <-received
+	assert.Equal(t, EventDeviceDisconnected, event.Type)
+	assert.Equal(t, DeviceEvent{Address: "AA:BB:CC:DD:EE:FF", Adapter: "/org/bluez/hci0"}, event.Data)
+
+	// Untrusting a device publishes nothing
+	for _, trusted := range []bool{false, true} {
+		m.dispatch(&dbus.Signal{
+			Path: "/org/bluez/hci1/dev_AA_BB_CC_DD_EE_FF",
+			Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+			Body: []interface{}{bluetooth.DeviceInterface, map[string]dbus.Variant{"Trusted": dbus.MakeVariant(trusted)}, []string{}},
+		})
+	}
+	event = <-received
+	assert.Equal(t, EventDeviceTrusted, event.Type)
+	assert.Equal(t, DeviceEvent{Address: "AA:BB:CC:DD:EE:FF", Adapter: "/org/bluez/hci1"}, event.Data)
+
+	m.dispatch(&dbus.Signal{
+		Path: "/",
+		Name: "org.freedesktop.DBus.ObjectManager.InterfacesRemoved",
+		Body: []interface{}{dbus.ObjectPath("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF"), []string{bluetooth.DeviceInterface}},
+	})
+	event = <-received
+	assert.Equal(t, EventDeviceRemoved, event.Type)
+
+	m.dispatch(&dbus.Signal{
+		Path: "/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF/player0",
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []interface{}{bluetooth.MediaPlayerInterface, map[string]dbus.Variant{"Track": dbus.MakeVariant(map[string]dbus.Variant{
+			"Title":    dbus.MakeVariant("Song"),
+			"Artist":   dbus.MakeVariant("Band"),
+			"Duration": dbus.MakeVariant(uint32(180000)),
+		})}, []string{}},
+	})
+	event = <-received
+	assert.Equal(t, EventTrackChanged, event.Type)
+	assert.Equal(t, TrackEvent{
+		Address: "AA:BB:CC:DD:EE:FF",
+		Adapter: "/org/bluez/hci0",
+		Track:   bluetooth.Track{Title: "Song", Artist: "Band", Duration: 180000},
+	}, event.Data)
+
+	// Plugging a controller publishes an adapter event
+	m.dispatch(&dbus.Signal{
+		Path: "/",
+		Name: "org.freedesktop.DBus.ObjectManager.InterfacesAdded",
+		Body: []interface{}{dbus.ObjectPath("/org/bluez/hci1"), map[string]map[string]dbus.Variant{
+			bluetooth.AdapterInterface: {"Address": dbus.MakeVariant("00:1A:7D:DA:71:02"), "Name": dbus.MakeVariant("kitchen")},
+		}},
+	})
+	event = <-received
+	assert.Equal(t, EventAdapterAdded, event.Type)
+	assert.Equal(t, AdapterEvent{Adapter: "/org/bluez/hci1", Address: "00:1A:7D:DA:71:02", Name: "kitchen"}, event.Data)
+}
@@ -0,0 +1,741 @@
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/nerzhul/home-bt-broker/internal/mgmt"
+)
+
+var (
+	errSimulatedDeviceNotFound = errors.New("device not found")
+	errSimulatedNotPowered     = errors.New("adapter is not powered")
+)
+
+// SimulatedManager is an in-memory Bluetooth backend with demo adapters and devices, for frontend development
+// and CI on machines without BlueZ. Devices change state like real ones: pairing goes through the pairing
+// requests in manual mode, powering an adapter off disconnects its devices, discovery finds new devices,
+// a nearby device asks to pair when an adapter becomes discoverable and RSSI values vary between calls.
+type SimulatedManager struct {
+	mu       sync.Mutex
+	adapters []*simulatedAdapter
+
+	pairingMode     string
+	pairingRequests *pairingQueue
+	pairingAllowed  func(address string) bool
+	// started is the time the simulated media players started playing
+	started time.Time
+}
+
+type simulatedAdapter struct {
+	Adapter
+	devices []*Device
+	// discovered is the number of devices found by discovery so far
+	discovered int
+}
+
+// simulatedDiscoveries are the devices appearing, in order, each time discovery starts
+var simulatedDiscoveries = []struct {
+	name  string
+	class uint32
+	uuids []string
+}{
+	{"JBL Flip 6", 0x240414, []string{"110b", "110e"}},
+	{"Galaxy Buds2", 0x240404, []string{"110b", "110e", "111e"}},
+	{"Xbox Wireless Controller", 0x000508, []string{"1124"}},
+}
+
+// NewSimulatedManager creates a simulated Bluetooth backend with two adapters, the first one
+// having a few paired and nearby devices
+func NewSimulatedManager(opts Options) *SimulatedManager {
+	if opts.PairingMode == "" {
+		opts.PairingMode = PairingModeAuto
+	}
+	if opts.PairingRequestTimeout == 0 {
+		opts.PairingRequestTimeout = 30 * time.Second
+	}
+
+	hci0 := &simulatedAdapter{Adapter: Adapter{
+		Path:     "/org/bluez/hci0",
+		Name:     "demo-hci0",
+		Address:  "00:1A:7D:DA:71:01",
+		Powered:  true,
+		Pairable: true,
+		Experimental: Experimental{
+			Enabled:    true,
+			Interfaces: []string{ExperimentalAdvertisementMonitor, ExperimentalBatteryProvider},
+		},
+		Roles:      []string{RoleCentral, RolePeripheral, RoleCentralPeripheral},
+		Transports: []string{TransportBREDR, TransportLE},
+		UUIDs:      simulatedUUIDs([]string{"1800", "1801", "110a", "110b", "110c", "110e", "111f", "1112", "1200"}),
+	}}
+
+	headset := newSimulatedDevice(hci0.Path, "WH-1000XM4", "38:18:4C:12:34:56", 0x240404, []string{"110b", "110e", "111e"})
+	headset.Paired, headset.Trusted, headset.Connected = true, true, true
+	headset.Battery = uint8Ptr(80)
+	headset.Volume = uint8Ptr(40)
+	headset.AudioState = "idle"
+	headset.RSSI = int16Ptr(-52)
+
+	keyboard := newSimulatedDevice(hci0.Path, "MX Keys", "DC:2C:26:AB:CD:EF", 0x000540, []string{"1812", "180f"})
+	keyboard.Paired, keyboard.Trusted = true, true
+	keyboard.Battery = uint8Ptr(64)
+	wakeAllowed := false
+	keyboard.WakeAllowed = &wakeAllowed
+
+	phone := newSimulatedDevice(hci0.Path, "Pixel 8", "5C:17:CF:11:22:33", 0x5a020c, []string{"1105", "110a", "112f"})
+	phone.RSSI = int16Ptr(-71)
+
+	// iBeacon frame: UUID, major 1, minor 42, measured power -59 dBm
+	beacon := newSimulatedDevice(hci0.Path, "Demo iBeacon", "F0:12:34:56:78:9A", 0, nil)
+	beacon.RSSI = int16Ptr(-80)
+	beacon.ManufacturerData = map[uint16][]byte{0x004c: {
+		0x02, 0x15,
+		0xe2, 0xc5, 0x6d, 0xb5, 0xdf, 0xfb, 0x48, 0xd2, 0xb0, 0x60, 0xd0, 0xf5, 0xa7, 0x10, 0x96, 0xe0,
+		0x00, 0x01, 0x00, 0x2a, 0xc5,
+	}}
+
+	// Auracast source announcing broadcast ID 0x123456
+	broadcaster := newSimulatedDevice(hci0.Path, "Living Room TV", "C8:7A:12:34:56:01", 0, []string{"1852"})
+	broadcaster.RSSI = int16Ptr(-58)
+	broadcaster.ServiceData = map[string][]byte{BroadcastAudioAnnouncementUUID: {0x56, 0x34, 0x12}}
+	broadcaster.Broadcast = decodeBroadcast(broadcaster.ServiceData, "idle")
+
+	// LE Audio earbuds, each bud being a member of the same coordinated set
+	var buds []*Device
+	for i, address := range []string{"E4:5F:01:AA:00:01", "E4:5F:01:AA:00:02"} {
+		bud := newSimulatedDevice(hci0.Path, "Galaxy Buds3 Pro", address, 0x240404, []string{"1846", "184e", "1850"})
+		bud.Paired, bud.Trusted = true, true
+		bud.Volume = uint8Ptr(50)
+		bud.Set = &SetMembership{ID: "set_0", Rank: uint8(i + 1)}
+		buds = append(buds, bud)
+	}
+
+	hci0.devices = []*Device{headset, keyboard, phone, beacon, broadcaster, buds[0], buds[1]}
+
+	hci1 := &simulatedAdapter{Adapter: Adapter{
+		Path:         "/org/bluez/hci1",
+		Name:         "demo-hci1",
+		Address:      "00:1A:7D:DA:71:02",
+		Experimental: Experimental{Interfaces: []string{}},
+		// An old BR/EDR only dongle
+		Roles:      []string{},
+		Transports: []string{TransportBREDR},
+	}}
+
+	return &SimulatedManager{
+		adapters:        []*simulatedAdapter{hci0, hci1},
+		pairingMode:     opts.PairingMode,
+		pairingRequests: newPairingQueue(opts.PairingRequestTimeout),
+		started:         time.Now(),
+	}
+}
+
+// newSimulatedDevice creates a device from its class and the 16 bits form of its service UUIDs
+func newSimulatedDevice(adapterPath, name, address string, class uint32, uuids []string) *Device {
+	device := &Device{
+		Path:    fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(address, ":", "_")),
+		Name:    name,
+		Address: address,
+		Adapter: adapterPath,
+		Class:   class,
+	}
+	if class != 0 {
+		device.Type, device.Subtype = DecodeClass(class)
+	}
+	device.UUIDs = simulatedUUIDs(uuids)
+	device.Capabilities = Capabilities(device.UUIDs)
+	return device
+}
+
+// simulatedUUIDs expands the 16 bits form of service UUIDs
+func simulatedUUIDs(uuids []string) []string {
+	expanded := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		expanded = append(expanded, NormalizeUUID(uuid))
+	}
+	return expanded
+}
+
+func uint8Ptr(v uint8) *uint8 { return &v }
+
+func int16Ptr(v int16) *int16 { return &v }
+
+// adapter returns the simulated adapter at a path, the caller must hold the lock
+func (sm *SimulatedManager) adapter(adapterPath string) (*simulatedAdapter, error) {
+	for _, adapter := range sm.adapters {
+		if adapter.Path == adapterPath {
+			return adapter, nil
+		}
+	}
+	return nil, fmt.Errorf("adapter %s not found", adapterPath)
+}
+
+// device returns a device of a simulated adapter, the caller must hold the lock
+func (sm *SimulatedManager) device(adapterPath, macAddress string) (*simulatedAdapter, *Device, error) {
+	adapter, err := sm.adapter(adapterPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, device := range adapter.devices {
+		if strings.EqualFold(device.Address, macAddress) {
+			return adapter, device, nil
+		}
+	}
+	return adapter, nil, errSimulatedDeviceNotFound
+}
+
+// GetAdapters returns the simulated adapters
+func (sm *SimulatedManager) GetAdapters() ([]Adapter, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	adapters := make([]Adapter, 0, len(sm.adapters))
+	for _, adapter := range sm.adapters {
+		adapters = append(adapters, adapter.Adapter)
+	}
+	return adapters, nil
+}
+
+// GetAdapterPathByMAC resolves an adapter MAC address to its path
+func (sm *SimulatedManager) GetAdapterPathByMAC(macAddress string) (string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for _, adapter := range sm.adapters {
+		if adapter.Address == macAddress {
+			return adapter.Path, nil
+		}
+	}
+	return "", fmt.Errorf("adapter with MAC address %s not found", macAddress)
+}
+
+// GetDevices returns the devices of a simulated adapter, with RSSI values varying a little on each call
+func (sm *SimulatedManager) GetDevices(adapterPath string) ([]Device, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	adapter, err := sm.adapter(adapterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]Device, 0, len(adapter.devices))
+	for _, device := range adapter.devices {
+		d := *device
+		if d.RSSI != nil {
+			d.RSSI = int16Ptr(*d.RSSI + int16(rand.IntN(7)-3))
+		}
+		d.ConnectedProfiles = simulatedConnectedProfiles(d)
+		d.ServicesResolved = d.Connected
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// GetTrustedDevices returns the trusted devices of a simulated adapter
+func (sm *SimulatedManager) GetTrustedDevices(adapterPath string) ([]Device, error) {
+	return sm.filterDevices(adapterPath, func(d Device) bool { return d.Trusted })
+}
+
+// GetConnectedDevices returns the connected devices of a simulated adapter
+func (sm *SimulatedManager) GetConnectedDevices(adapterPath string) ([]Device, error) {
+	return sm.filterDevices(adapterPath, func(d Device) bool { return d.Connected })
+}
+
+func (sm *SimulatedManager) filterDevices(adapterPath string, keep func(Device) bool) ([]Device, error) {
+	devices, err := sm.GetDevices(adapterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []Device
+	for _, device := range devices {
+		if keep(device) {
+			filtered = append(filtered, device)
+		}
+	}
+	return filtered, nil
+}
+
+// ConnectDevice connects a paired device
+func (sm *SimulatedManager) ConnectDevice(adapterPath, macAddress string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	adapter, device, err := sm.device(adapterPath, macAddress)
+	if err != nil {
+		return fmt.Errorf("failed to connect to device %s: %w", macAddress, err)
+	}
+	if !adapter.Powered {
+		return fmt.Errorf("failed to connect to device %s: %w", macAddress, errSimulatedNotPowered)
+	}
+	if !device.Paired {
+		return fmt.Errorf("failed to connect to device %s: device is not paired", macAddress)
+	}
+
+	device.Connected = true
+	if device.RSSI == nil {
+		device.RSSI = int16Ptr(-60)
+	}
+	return nil
+}
+
+// DisconnectDevice disconnects a device
+func (sm *SimulatedManager) DisconnectDevice(adapterPath, macAddress string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	_, device, err := sm.device(adapterPath, macAddress)
+	if err != nil {
+		return fmt.Errorf("failed to disconnect device %s: %w", macAddress, err)
+	}
+	device.Connected = false
+	return nil
+}
+
+// ConnectProfile connects a device through one of the profiles it advertises
+func (sm *SimulatedManager) ConnectProfile(adapterPath, macAddress, uuid string) error {
+	sm.mu.Lock()
+	_, device, err := sm.device(adapterPath, macAddress)
+	sm.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to connect profile %s of device %s: %w", uuid, macAddress, err)
+	}
+	if !containsString(device.UUIDs, NormalizeUUID(uuid)) {
+		return fmt.Errorf("failed to connect profile %s of device %s: profile not supported", uuid, macAddress)
+	}
+	return sm.ConnectDevice(adapterPath, macAddress)
+}
+
+// TrustDevice sets a device as trusted
+func (sm *SimulatedManager) TrustDevice(adapterPath, macAddress string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	_, device, err := sm.device(adapterPath, macAddress)
+	if err != nil {
+		return fmt.Errorf("failed to trust device %s: %w", macAddress, err)
+	}
+	device.Trusted = true
+	return nil
+}
+
+// UntrustDevice removes the trust of a simulated device
+func (sm *SimulatedManager) UntrustDevice(adapterPath, macAddress string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	_, device, err := sm.device(adapterPath, macAddress)
+	if err != nil {
+		return fmt.Errorf("failed to untrust device %s: %w", macAddress, err)
+	}
+	device.Trusted = false
+	return nil
+}
+
+// SetWakeAllowed allows or forbids a device to wake the host, only input devices support it
+func (sm *SimulatedManager) SetWakeAllowed(adapterPath, macAddress string, allow bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	_, device, err := sm.device(adapterPath, macAddress)
+	if err != nil {
+		return fmt.Errorf("failed to set wake allowed on device %s: %w", macAddress, err)
+	}
+	if device.WakeAllowed == nil {
+		return fmt.Errorf("failed to set wake allowed on device %s: property not supported", macAddress)
+	}
+	device.WakeAllowed = &allow
+	return nil
+}
+
+// SetVolume sets the absolute volume of a connected device exposing one
+func (sm *SimulatedManager) SetVolume(adapterPath, macAddress string, percent uint8) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	_, device, err := sm.device(adapterPath, macAddress)
+	if err != nil {
+		return fmt.Errorf("failed to set volume on device %s: %w", macAddress, err)
+	}
+	if !device.Connected || device.Volume == nil {
+		return fmt.Errorf("failed to set volume on device %s: %w", macAddress, ErrNoVolumeControl)
+	}
+	device.Volume = uint8Ptr(min(percent, 100))
+	return nil
+}
+
+// JoinBroadcast starts streaming a simulated broadcast
+func (sm *SimulatedManager) JoinBroadcast(adapterPath, macAddress string) error {
+	return sm.setBroadcastState(adapterPath, macAddress, "active", "join")
+}
+
+// LeaveBroadcast stops streaming a simulated broadcast
+func (sm *SimulatedManager) LeaveBroadcast(adapterPath, macAddress string) error {
+	return sm.setBroadcastState(adapterPath, macAddress, "idle", "leave")
+}
+
+func (sm *SimulatedManager) setBroadcastState(adapterPath, macAddress, state, action string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	adapter, device, err := sm.device(adapterPath, macAddress)
+	if err != nil {
+		return fmt.Errorf("failed to %s broadcast of device %s: %w", action, macAddress, err)
+	}
+	if !adapter.Powered {
+		return fmt.Errorf("failed to %s broadcast of device %s: %w", action, macAddress, errSimulatedNotPowered)
+	}
+	if device.Broadcast == nil {
+		return fmt.Errorf("failed to %s broadcast of device %s: %w", action, macAddress, ErrNoBroadcastTransport)
+	}
+	// Devices returned by GetDevices share the pointer, so the broadcast is replaced rather than updated
+	device.Broadcast = &Broadcast{ID: device.Broadcast.ID, State: state}
+	return nil
+}
+
+// GetDeviceSets groups the simulated devices by coordinated set
+func (sm *SimulatedManager) GetDeviceSets(adapterPath string) ([]DeviceSet, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	adapter, err := sm.adapter(adapterPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := []DeviceSet{}
+	index := make(map[string]int)
+	for _, device := range adapter.devices {
+		if device.Set == nil {
+			continue
+		}
+		i, ok := index[device.Set.ID]
+		if !ok {
+			i = len(sets)
+			index[device.Set.ID] = i
+			sets = append(sets, DeviceSet{
+				ID:          device.Set.ID,
+				Path:        adapterPath + "/" + device.Set.ID,
+				Adapter:     adapterPath,
+				AutoConnect: true,
+				Members:     []string{},
+			})
+		}
+		sets[i].Members = append(sets[i].Members, device.Address)
+		sets[i].Size++
+	}
+	return sets, nil
+}
+
+// ConnectDeviceSet connects every member of a simulated coordinated set
+func (sm *SimulatedManager) ConnectDeviceSet(adapterPath, setID string) error {
+	sets, err := sm.GetDeviceSets(adapterPath)
+	if err != nil {
+		return fmt.Errorf("failed to connect device set %s: %w", setID, err)
+	}
+
+	for _, set := range sets {
+		if set.ID != setID {
+			continue
+		}
+		for _, address := range set.Members {
+			if err := sm.ConnectDevice(adapterPath, address); err != nil {
+				return fmt.Errorf("failed to connect device set %s: %w", setID, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to connect device set %s: %w", setID, ErrDeviceSetNotFound)
+}
+
+// simulatedTrack is played by the connected devices having an audio source, such as phones
+var simulatedTrack = Track{
+	Title:       "Bohemian Rhapsody",
+	Artist:      "Queen",
+	Album:       "A Night at the Opera",
+	Genre:       "Rock",
+	TrackNumber: 11,
+	Tracks:      12,
+	Duration:    354000,
+	Status:      "playing",
+}
+
+// GetTrack returns the simulated track, looping since the manager was created
+func (sm *SimulatedManager) GetTrack(adapterPath, macAddress string) (*Track, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	_, device, err := sm.device(adapterPath, macAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get track of device %s: %w", macAddress, err)
+	}
+	if !device.Connected || !containsString(device.Capabilities, "a2dp_source") {
+		return nil, fmt.Errorf("failed to get track of device %s: %w", macAddress, ErrNoMediaPlayer)
+	}
+	track := simulatedTrack
+	track.Position = uint32(time.Since(sm.started).Milliseconds() % int64(track.Duration))
+	return &track, nil
+}
+
+// GetLinkInfo returns the link state of a connected device, derived from its simulated RSSI
+func (sm *SimulatedManager) GetLinkInfo(adapterPath, macAddress string) (*mgmt.ConnInfo, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	_, device, err := sm.device(adapterPath, macAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link info of device %s: %w", macAddress, err)
+	}
+	if !device.Connected {
+		return nil, fmt.Errorf("failed to get link info of device %s: %w", macAddress, mgmt.ErrNotConnected)
+	}
+
+	rssi, txPower, maxTxPower := int8(-60), int8(4), int8(10)
+	if device.RSSI != nil {
+		rssi = int8(*device.RSSI)
+	}
+	quality := uint8(255 + int(rssi))
+	return &mgmt.ConnInfo{RSSI: &rssi, TxPower: &txPower, MaxTxPower: &maxTxPower, LinkQuality: &quality}, nil
+}
+
+// PairDevice pairs with a device
+func (sm *SimulatedManager) PairDevice(adapterPath, macAddress string) error {
+	return sm.PairDeviceWithOptions(adapterPath, macAddress, PairOptions{})
+}
+
+// PairDeviceWithOptions pairs with a device. In manual mode, a passkey confirmation request waits
+// for a decision like with a real agent; the credentials are accepted as is.
+func (sm *SimulatedManager) PairDeviceWithOptions(adapterPath, macAddress string, opts PairOptions) error {
+	return sm.pair(adapterPath, macAddress)
+}
+
+// requestPairing simulates a device starting a pairing on its own. Unlike the pairings started
+// through PairDevice, the pairing policy decides whether the agent accepts it.
+func (sm *SimulatedManager) requestPairing(adapterPath, macAddress string) error {
+	sm.mu.Lock()
+	allowed := sm.pairingAllowed
+	sm.mu.Unlock()
+
+	if allowed != nil && !allowed(macAddress) {
+		return fmt.Errorf("failed to pair with device %s: rejected by the pairing allowlist", macAddress)
+	}
+	return sm.pair(adapterPath, macAddress)
+}
+
+// pair marks a device as paired, once the passkey confirmation is accepted in manual mode
+func (sm *SimulatedManager) pair(adapterPath, macAddress string) error {
+	sm.mu.Lock()
+	adapter, device, err := sm.device(adapterPath, macAddress)
+	if err == nil && !adapter.Powered {
+		err = errSimulatedNotPowered
+	} else if err == nil && device.Paired {
+		err = errors.New("already exists")
+	}
+	var devicePath string
+	if device != nil {
+		devicePath = device.Path
+	}
+	sm.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to pair with device %s: %w", macAddress, err)
+	}
+
+	if sm.pairingMode == PairingModeManual {
+		req, err := newPairingRequest(PairingRequestConfirmation, dbus.ObjectPath(devicePath))
+		if err != nil {
+			return fmt.Errorf("failed to pair with device %s: %w", macAddress, err)
+		}
+		passkey := rand.Uint32N(1000000)
+		req.Passkey = &passkey
+		if !sm.pairingRequests.wait(req) {
+			return fmt.Errorf("failed to pair with device %s: authentication rejected", macAddress)
+		}
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	// The device may have been removed while waiting for a decision
+	if _, device, err = sm.device(adapterPath, macAddress); err != nil {
+		return fmt.Errorf("failed to pair with device %s: %w", macAddress, err)
+	}
+	device.Paired = true
+	return nil
+}
+
+// CancelPairing rejects the pending pairing requests
+func (sm *SimulatedManager) CancelPairing(adapterPath, macAddress string) error {
+	sm.mu.Lock()
+	_, _, err := sm.device(adapterPath, macAddress)
+	sm.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to cancel pairing with device %s: %w", macAddress, err)
+	}
+
+	sm.pairingRequests.cancelAll()
+	return nil
+}
+
+// RemoveDevice forgets a device
+func (sm *SimulatedManager) RemoveDevice(adapterPath, macAddress string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	adapter, device, err := sm.device(adapterPath, macAddress)
+	if err != nil {
+		return fmt.Errorf("failed to remove device %s: %w", macAddress, err)
+	}
+	for i, d := range adapter.devices {
+		if d == device {
+			adapter.devices = append(adapter.devices[:i], adapter.devices[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// SetPowered powers a simulated adapter on or off, powering off disconnects its devices
+func (sm *SimulatedManager) SetPowered(adapterPath string, enable bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	adapter, err := sm.adapter(adapterPath)
+	if err != nil {
+		return err
+	}
+
+	adapter.Powered = enable
+	if !enable {
+		adapter.Discoverable = false
+		adapter.Discovering = false
+		for _, device := range adapter.devices {
+			device.Connected = false
+		}
+	}
+	return nil
+}
+
+// SetDiscoverable makes a powered simulated adapter discoverable or not
+func (sm *SimulatedManager) SetDiscoverable(adapterPath string, enable bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	adapter, err := sm.adapter(adapterPath)
+	if err != nil {
+		return err
+	}
+	if !adapter.Powered {
+		return fmt.Errorf("failed to set discoverable: %w", errSimulatedNotPowered)
+	}
+
+	// The first nearby device with a device class, such as a phone, asks to pair once it sees the adapter
+	if enable && !adapter.Discoverable && adapter.Pairable {
+		for _, device := range adapter.devices {
+			if !device.Paired && device.Class != 0 {
+				go func(address string) {
+					if err := sm.requestPairing(adapterPath, address); err != nil {
+						log.Printf("Simulated Bluetooth: %v", err)
+					}
+				}(device.Address)
+				break
+			}
+		}
+	}
+	adapter.Discoverable = enable
+	return nil
+}
+
+// SetPairable allows or forbids new devices to pair with a simulated adapter
+func (sm *SimulatedManager) SetPairable(adapterPath string, enable bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	adapter, err := sm.adapter(adapterPath)
+	if err != nil {
+		return err
+	}
+	adapter.Pairable = enable
+	return nil
+}
+
+// SetDiscovering starts or stops discovery, each start finds a new device until all the simulated
+// discoveries were found
+func (sm *SimulatedManager) SetDiscovering(adapterPath string, enable bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	adapter, err := sm.adapter(adapterPath)
+	if err != nil {
+		return err
+	}
+	if !adapter.Powered {
+		return fmt.Errorf("failed to set discovering: %w", errSimulatedNotPowered)
+	}
+
+	if enable && !adapter.Discovering && adapter.discovered < len(simulatedDiscoveries) {
+		discovery := simulatedDiscoveries[adapter.discovered]
+		address := fmt.Sprintf("AC:DE:48:00:00:%02X", adapter.discovered+1)
+		device := newSimulatedDevice(adapter.Path, discovery.name, address, discovery.class, discovery.uuids)
+		device.RSSI = int16Ptr(int16(-65 - 5*adapter.discovered))
+		adapter.devices = append(adapter.devices, device)
+		adapter.discovered++
+	}
+	adapter.Discovering = enable
+	return nil
+}
+
+// SetDiscoveryFilter checks the filter transport, the simulated discovery ignores it
+func (sm *SimulatedManager) SetDiscoveryFilter(adapterPath string, filter DiscoveryFilter) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, err := sm.adapter(adapterPath); err != nil {
+		return err
+	}
+	if filter.Transport != "" && !ValidTransport(filter.Transport) {
+		return fmt.Errorf("failed to set discovery filter: invalid transport %q", filter.Transport)
+	}
+	return nil
+}
+
+// GetPairingRequests returns the pairing requests waiting for a decision
+func (sm *SimulatedManager) GetPairingRequests() []PairingRequest {
+	return sm.pairingRequests.list()
+}
+
+// RespondPairingRequest accepts or rejects a pending pairing request
+func (sm *SimulatedManager) RespondPairingRequest(id string, accept bool) error {
+	return sm.pairingRequests.respond(id, accept)
+}
+
+// SetPairingNotifier registers a function called with the pairing events
+func (sm *SimulatedManager) SetPairingNotifier(notify func(eventType string, req PairingRequest)) {
+	sm.pairingRequests.mu.Lock()
+	defer sm.pairingRequests.mu.Unlock()
+	sm.pairingRequests.notify = notify
+}
+
+// SetPairingPolicy registers a function deciding which devices may pair on their own, when an
+// adapter becomes discoverable. Pairings started through PairDevice are not restricted. A nil
+// policy allows every device.
+func (sm *SimulatedManager) SetPairingPolicy(allowed func(address string) bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.pairingAllowed = allowed
+}
+
+// Ping always succeeds, there is no connection to check
+func (sm *SimulatedManager) Ping() error {
+	return nil
+}
+
+// Close does nothing, the simulated backend holds no resource
+func (sm *SimulatedManager) Close() {}
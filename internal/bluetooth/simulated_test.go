@@ -0,0 +1,124 @@
+package bluetooth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSimulatedManager_Devices(t *testing.T) {
+	sm := NewSimulatedManager(Options{})
+
+	adapterPath, err := sm.GetAdapterPathByMAC("00:1A:7D:DA:71:01")
+	assert.NoError(t, err)
+
+	connected, err := sm.GetConnectedDevices(adapterPath)
+	assert.NoError(t, err)
+	assert.Len(t, connected, 1)
+	assert.Equal(t, "audio_video", connected[0].Type)
+	assert.Contains(t, connected[0].Capabilities, "a2dp_sink")
+
+	// Discovery finds a new device on each start
+	devices, _ := sm.GetDevices(adapterPath)
+	assert.NoError(t, sm.SetDiscovering(adapterPath, true))
+	found, _ := sm.GetDevices(adapterPath)
+	assert.Len(t, found, len(devices)+1)
+
+	// Powering off disconnects the devices
+	assert.NoError(t, sm.SetPowered(adapterPath, false))
+	connected, _ = sm.GetConnectedDevices(adapterPath)
+	assert.Empty(t, connected)
+	assert.Error(t, sm.ConnectDevice(adapterPath, "38:18:4C:12:34:56"))
+}
+
+func TestSimulatedManager_ManualPairing(t *testing.T) {
+	sm := NewSimulatedManager(Options{PairingMode: PairingModeManual, PairingRequestTimeout: time.Second})
+	requested := make(chan PairingRequest, 1)
+	sm.SetPairingNotifier(func(eventType string, req PairingRequest) {
+		if eventType == EventPairingRequested {
+			requested <- req
+		}
+	})
+
+	paired := make(chan error, 1)
+	go func() { paired <- sm.PairDevice("/org/bluez/hci0", "5C:17:CF:11:22:33") }()
+
+	req := <-requested
+	assert.Equal(t, "5C:17:CF:11:22:33", req.Address)
+	assert.NotNil(t, req.Passkey)
+	assert.NoError(t, sm.RespondPairingRequest(req.ID, true))
+	assert.NoError(t, <-paired)
+
+	assert.NoError(t, sm.ConnectDevice("/org/bluez/hci0", "5C:17:CF:11:22:33"))
+	assert.Error(t, sm.PairDevice("/org/bluez/hci0", "5C:17:CF:11:22:33"))
+	assert.NoError(t, sm.RemoveDevice("/org/bluez/hci0", "5C:17:CF:11:22:33"))
+	assert.Error(t, sm.RemoveDevice("/org/bluez/hci0", "5C:17:CF:11:22:33"))
+}
+
+func TestSimulatedManager_PairingPolicy(t *testing.T) {
+	sm := NewSimulatedManager(Options{})
+	sm.SetPairingPolicy(func(address string) bool { return address == "AC:DE:48:00:00:01" })
+
+	// Devices pairing on their own are checked against the policy
+	err := sm.requestPairing("/org/bluez/hci0", "5C:17:CF:11:22:33")
+	assert.ErrorContains(t, err, "rejected by the pairing allowlist")
+	devices, _ := sm.GetDevices("/org/bluez/hci0")
+	for _, device := range devices {
+		if device.Address == "5C:17:CF:11:22:33" {
+			assert.False(t, device.Paired)
+		}
+	}
+
+	assert.NoError(t, sm.SetDiscovering("/org/bluez/hci0", true))
+	assert.NoError(t, sm.requestPairing("/org/bluez/hci0", "AC:DE:48:00:00:01"))
+
+	// Pairings started through the API are not restricted
+	assert.NoError(t, sm.PairDevice("/org/bluez/hci0", "5C:17:CF:11:22:33"))
+}
+
+func TestSimulatedManager_PairingOnDiscoverable(t *testing.T) {
+	sm := NewSimulatedManager(Options{PairingMode: PairingModeManual, PairingRequestTimeout: time.Second})
+	requested := make(chan PairingRequest, 1)
+	sm.SetPairingNotifier(func(eventType string, req PairingRequest) {
+		if eventType == EventPairingRequested {
+			requested <- req
+		}
+	})
+	sm.SetPairingPolicy(func(address string) bool { return true })
+
+	// The nearby phone asks to pair once the adapter becomes discoverable
+	assert.NoError(t, sm.SetDiscoverable("/org/bluez/hci0", true))
+	req := <-requested
+	assert.Equal(t, "5C:17:CF:11:22:33", req.Address)
+	assert.NoError(t, sm.RespondPairingRequest(req.ID, true))
+
+	assert.Eventually(t, func() bool {
+		devices, _ := sm.GetDevices("/org/bluez/hci0")
+		for _, device := range devices {
+			if device.Address == "5C:17:CF:11:22:33" {
+				return device.Paired
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSimulatedManager_GetTrack(t *testing.T) {
+	sm := NewSimulatedManager(Options{})
+	adapterPath, _ := sm.GetAdapterPathByMAC("00:1A:7D:DA:71:01")
+
+	// The headset plays audio but has no player
+	_, err := sm.GetTrack(adapterPath, "38:18:4C:12:34:56")
+	assert.ErrorIs(t, err, ErrNoMediaPlayer)
+
+	// The phone only exposes its player once connected
+	_, err = sm.GetTrack(adapterPath, "5C:17:CF:11:22:33")
+	assert.ErrorIs(t, err, ErrNoMediaPlayer)
+	assert.NoError(t, sm.PairDevice(adapterPath, "5C:17:CF:11:22:33"))
+	assert.NoError(t, sm.ConnectDevice(adapterPath, "5C:17:CF:11:22:33"))
+	track, err := sm.GetTrack(adapterPath, "5C:17:CF:11:22:33")
+	assert.NoError(t, err)
+	assert.Equal(t, "Queen", track.Artist)
+	assert.Less(t, track.Position, track.Duration)
+}
@@ -0,0 +1,185 @@
+package bluetooth
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Features gated on the version of BlueZ and on what bluetoothd exports
+const (
+	FeatureAdvertisementMonitor = "advertisement_monitor"
+	FeatureBattery              = "battery"
+	FeatureLEAudio              = "le_audio"
+	FeatureLEAudioBroadcast     = "le_audio_broadcast"
+)
+
+// AdvertisementMonitorManagerInterface is only exported by bluetoothd with its experimental features
+const AdvertisementMonitorManagerInterface = "org.bluez.AdvertisementMonitorManager1"
+
+// requirement is what a feature needs from BlueZ
+type requirement struct {
+	version string
+	// iface is a D-Bus interface bluetoothd must export
+	iface string
+	// kernelFeature is an experimental kernel feature an adapter must have enabled
+	kernelFeature string
+}
+
+var requirements = map[string]requirement{
+	FeatureAdvertisementMonitor: {version: "5.56", iface: AdvertisementMonitorManagerInterface},
+	FeatureBattery:              {version: "5.48"},
+	FeatureLEAudio:              {version: "5.66", kernelFeature: "iso_socket"},
+	FeatureLEAudioBroadcast:     {version: "5.78", kernelFeature: "iso_socket"},
+}
+
+// bluetoothdPaths are where distributions install bluetoothd, out of the PATH
+var bluetoothdPaths = []string{"bluetoothd", "/usr/libexec/bluetooth/bluetoothd", "/usr/lib/bluetooth/bluetoothd", "/usr/sbin/bluetoothd"}
+
+var versionPattern = regexp.MustCompile(`^(\d+)\.(\d+)`)
+
+// Feature tells whether a feature is available with the running BlueZ
+type Feature struct {
+	Available       bool   `json:"available"`
+	RequiredVersion string `json:"required_version"`
+	// Reason explains why the feature is unavailable
+	Reason string `json:"reason,omitempty"`
+}
+
+// SystemInfo describes the BlueZ the broker talks to, detected at startup
+type SystemInfo struct {
+	Backend string `json:"backend"`
+	// Version is the version of bluetoothd, empty when it cannot be found
+	Version string `json:"version"`
+	// Interfaces are the D-Bus interfaces exported by bluetoothd
+	Interfaces []string           `json:"interfaces"`
+	Features   map[string]Feature `json:"features"`
+}
+
+// NewSystemInfo gates the features on the version of bluetoothd, the interfaces it exports and the
+// adapters. An unknown version does not make a feature unavailable on its own.
+func NewSystemInfo(backend, version string, interfaces []string, adapters []Adapter) *SystemInfo {
+	if interfaces == nil {
+		interfaces = []string{}
+	}
+	sort.Strings(interfaces)
+	info := &SystemInfo{Backend: backend, Version: version, Interfaces: interfaces, Features: make(map[string]Feature)}
+
+	for name, req := range requirements {
+		feature := Feature{Available: true, RequiredVersion: req.version}
+		switch {
+		case version != "" && compareVersions(version, req.version) < 0:
+			feature.Available = false
+			feature.Reason = fmt.Sprintf("requires BlueZ %s or later, found %s", req.version, version)
+		case req.iface != "" && !containsString(interfaces, req.iface):
+			feature.Available = false
+			feature.Reason = "bluetoothd must run with --experimental or Experimental = true in main.conf"
+		case req.kernelFeature != "" && len(adapters) > 0 && !hasKernelFeature(adapters, req.kernelFeature):
+			feature.Available = false
+			feature.Reason = "requires the " + req.kernelFeature + " experimental kernel feature, enabled by bluetoothd with --experimental or KernelExperimental in main.conf"
+		}
+		info.Features[name] = feature
+	}
+	return info
+}
+
+// GetSystemInfo detects the version of bluetoothd and the interfaces it exports. BlueZ does not
+// publish its version on D-Bus, so it is asked to the executable of the process owning org.bluez,
+// or else to the bluetoothd installed on the host.
+func (bm *BluetoothManager) GetSystemInfo() (*SystemInfo, error) {
+	var objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant
+	obj := bm.conn.Object(BluezService, BluezObjectPath)
+	if err := obj.Call(ObjectManagerIface+".GetManagedObjects", 0).Store(&objects); err != nil {
+		return nil, fmt.Errorf("failed to get managed objects: %w", err)
+	}
+	seen := make(map[string]bool)
+	interfaces := []string{}
+	for _, ifaces := range objects {
+		for iface := range ifaces {
+			if !seen[iface] {
+				seen[iface] = true
+				interfaces = append(interfaces, iface)
+			}
+		}
+	}
+	adapters, err := bm.GetAdapters()
+	if err != nil {
+		return nil, err
+	}
+
+	paths := bluetoothdPaths
+	var pid uint32
+	if err := bm.conn.BusObject().Call("org.freedesktop.DBus.GetConnectionUnixProcessID", 0, BluezService).Store(&pid); err == nil {
+		paths = append([]string{fmt.Sprintf("/proc/%d/exe", pid)}, paths...)
+	}
+	return NewSystemInfo(BackendDBus, bluetoothdVersion(paths), interfaces, adapters), nil
+}
+
+// GetSystemInfo reports the simulated BlueZ, with every feature available
+func (sm *SimulatedManager) GetSystemInfo() (*SystemInfo, error) {
+	interfaces := []string{AdapterInterface, DeviceInterface, BatteryInterface, AdvertisementMonitorManagerInterface}
+	return NewSystemInfo(BackendMock, "5.79", interfaces, nil), nil
+}
+
+// GetSystemInfo reports that the features relying on BlueZ are unavailable
+func (km *KernelManager) GetSystemInfo() (*SystemInfo, error) {
+	info := &SystemInfo{Backend: BackendKernel, Interfaces: []string{}, Features: make(map[string]Feature)}
+	for name, req := range requirements {
+		info.Features[name] = Feature{RequiredVersion: req.version, Reason: ErrNotSupported.Error()}
+	}
+	return info, nil
+}
+
+// bluetoothdVersion returns the version reported by the first bluetoothd executable which runs
+func bluetoothdVersion(paths []string) string {
+	for _, path := range paths {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		out, err := exec.CommandContext(ctx, path, "--version").Output()
+		cancel()
+		if err != nil {
+			continue
+		}
+		if version := versionPattern.FindString(string(out)); version != "" {
+			return version
+		}
+	}
+	return ""
+}
+
+// compareVersions compares two major.minor versions, returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	aMajor, aMinor := parseVersion(a)
+	bMajor, bMinor := parseVersion(b)
+	switch {
+	case aMajor < bMajor || (aMajor == bMajor && aMinor < bMinor):
+		return -1
+	case aMajor == bMajor && aMinor == bMinor:
+		return 0
+	}
+	return 1
+}
+
+func parseVersion(version string) (major, minor int) {
+	match := versionPattern.FindStringSubmatch(version)
+	if match == nil {
+		return 0, 0
+	}
+	major, _ = strconv.Atoi(match[1])
+	minor, _ = strconv.Atoi(match[2])
+	return major, minor
+}
+
+func hasKernelFeature(adapters []Adapter, name string) bool {
+	for _, adapter := range adapters {
+		if containsString(adapter.Experimental.FeatureNames, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSystemInfo(t *testing.T) {
+	isoSocket := []Adapter{{Experimental: Experimental{FeatureNames: []string{"iso_socket"}}}}
+
+	info := NewSystemInfo(BackendDBus, "5.72", []string{AdapterInterface}, isoSocket)
+	assert.Equal(t, Feature{Available: true, RequiredVersion: "5.48"}, info.Features[FeatureBattery])
+	assert.Equal(t, Feature{Available: true, RequiredVersion: "5.66"}, info.Features[FeatureLEAudio])
+	assert.Equal(t, Feature{RequiredVersion: "5.78", Reason: "requires BlueZ 5.78 or later, found 5.72"}, info.Features[FeatureLEAudioBroadcast])
+	assert.False(t, info.Features[FeatureAdvertisementMonitor].Available)
+	assert.Contains(t, info.Features[FeatureAdvertisementMonitor].Reason, "--experimental")
+
+	// Without the ISO socket, LE Audio is unavailable whatever the version
+	info = NewSystemInfo(BackendDBus, "5.79", []string{AdvertisementMonitorManagerInterface}, []Adapter{{}})
+	assert.True(t, info.Features[FeatureAdvertisementMonitor].Available)
+	assert.False(t, info.Features[FeatureLEAudio].Available)
+
+	// An unknown version does not gate on its own
+	info = NewSystemInfo(BackendDBus, "", nil, nil)
+	assert.True(t, info.Features[FeatureBattery].Available)
+	assert.True(t, info.Features[FeatureLEAudioBroadcast].Available)
+	assert.Equal(t, []string{}, info.Interfaces)
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, -1, compareVersions("5.9", "5.48"))
+	assert.Equal(t, 0, compareVersions("5.66", "5.66"))
+	assert.Equal(t, 1, compareVersions("6.0", "5.78"))
+	assert.Equal(t, 1, compareVersions("5.79.1", "5.78"))
+}
@@ -0,0 +1,117 @@
+package bluetooth
+
+import (
+	"sort"
+	"strings"
+)
+
+// ServiceProfile describes a well-known Bluetooth service UUID
+type ServiceProfile struct {
+	Name       string
+	Capability string
+}
+
+// knownServices maps the 16-bit part of SIG-assigned service UUIDs to their profile
+var knownServices = map[string]ServiceProfile{
+	"1101": {Name: "Serial Port", Capability: "spp"},
+	"1105": {Name: "OBEX Object Push", Capability: "opp"},
+	"1106": {Name: "OBEX File Transfer", Capability: "ftp"},
+	"1108": {Name: "Headset", Capability: "hsp"},
+	"110a": {Name: "Audio Source", Capability: "a2dp_source"},
+	"110b": {Name: "Audio Sink", Capability: "a2dp_sink"},
+	"110c": {Name: "A/V Remote Control Target", Capability: "avrcp"},
+	"110d": {Name: "Advanced Audio Distribution", Capability: ""},
+	"110e": {Name: "A/V Remote Control", Capability: "avrcp"},
+	"110f": {Name: "A/V Remote Control Controller", Capability: "avrcp"},
+	"1112": {Name: "Headset Audio Gateway", Capability: "hsp"},
+	"1115": {Name: "PANU", Capability: "pan"},
+	"1116": {Name: "NAP", Capability: "pan"},
+	"111e": {Name: "Handsfree", Capability: "hfp"},
+	"111f": {Name: "Handsfree Audio Gateway", Capability: "hfp"},
+	"112d": {Name: "SIM Access", Capability: ""},
+	"112e": {Name: "Phonebook Access Client", Capability: "pbap"},
+	"112f": {Name: "Phonebook Access Server", Capability: "pbap"},
+	"1132": {Name: "Message Access Server", Capability: "map"},
+	"1133": {Name: "Message Notification Server", Capability: "map"},
+	"1124": {Name: "Human Interface Device", Capability: "hid"},
+	"1200": {Name: "PnP Information", Capability: ""},
+	"1800": {Name: "Generic Access", Capability: "gatt"},
+	"1801": {Name: "Generic Attribute", Capability: "gatt"},
+	"180a": {Name: "Device Information", Capability: "gatt"},
+	"180f": {Name: "Battery Service", Capability: "battery"},
+	"1812": {Name: "Human Interface Device over GATT", Capability: "hid"},
+	"1846": {Name: "Coordinated Set Identification", Capability: "le_audio"},
+	"184e": {Name: "Audio Stream Control", Capability: "le_audio"},
+	"184f": {Name: "Broadcast Audio Scan", Capability: "le_audio"},
+	"1850": {Name: "Published Audio Capabilities", Capability: "le_audio"},
+	"1852": {Name: "Broadcast Audio Announcement", Capability: "le_audio_broadcast"},
+}
+
+const bluetoothBaseUUIDSuffix = "-0000-1000-8000-00805f9b34fb"
+
+// LookupService returns the profile of a service UUID, if it is a well-known one
+func LookupService(uuid string) (ServiceProfile, bool) {
+	uuid = strings.ToLower(uuid)
+	if !strings.HasPrefix(uuid, "0000") || !strings.HasSuffix(uuid, bluetoothBaseUUIDSuffix) || len(uuid) != 36 {
+		return ServiceProfile{}, false
+	}
+
+	profile, ok := knownServices[uuid[4:8]]
+	return profile, ok
+}
+
+// Service is a service UUID with its profile, Name and Capability are empty for unknown services
+type Service struct {
+	UUID       string `json:"uuid"`
+	Name       string `json:"name,omitempty"`
+	Capability string `json:"capability,omitempty"`
+}
+
+// DescribeServices maps service UUIDs to their profile, sorted by UUID
+func DescribeServices(uuids []string) []Service {
+	services := make([]Service, 0, len(uuids))
+	for _, uuid := range uuids {
+		profile, _ := LookupService(uuid)
+		services = append(services, Service{UUID: strings.ToLower(uuid), Name: profile.Name, Capability: profile.Capability})
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].UUID < services[j].UUID })
+	return services
+}
+
+// NormalizeUUID expands a 16 or 32 bits SIG-assigned UUID such as "110b" to its full lower case form
+func NormalizeUUID(uuid string) string {
+	uuid = strings.ToLower(uuid)
+	switch len(uuid) {
+	case 4:
+		return "0000" + uuid + bluetoothBaseUUIDSuffix
+	case 8:
+		return uuid + bluetoothBaseUUIDSuffix
+	}
+	return uuid
+}
+
+// Capabilities maps service UUIDs to a sorted list of unique capabilities
+func Capabilities(uuids []string) []string {
+	seen := map[string]bool{}
+	capabilities := []string{}
+	for _, uuid := range uuids {
+		profile, ok := LookupService(uuid)
+		if !ok || profile.Capability == "" || seen[profile.Capability] {
+			continue
+		}
+		seen[profile.Capability] = true
+		capabilities = append(capabilities, profile.Capability)
+	}
+
+	sort.Strings(capabilities)
+	return capabilities
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
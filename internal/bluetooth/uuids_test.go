@@ -0,0 +1,49 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupService(t *testing.T) {
+	profile, ok := LookupService("0000110B-0000-1000-8000-00805F9B34FB")
+	assert.True(t, ok)
+	assert.Equal(t, "Audio Sink", profile.Name)
+	assert.Equal(t, "a2dp_sink", profile.Capability)
+
+	_, ok = LookupService("0000feaa-0000-1000-8000-00805f9b34fb")
+	assert.False(t, ok)
+
+	_, ok = LookupService("6e400001-b5a3-f393-e0a9-e50e24dcca9e")
+	assert.False(t, ok)
+}
+
+func TestDescribeServices(t *testing.T) {
+	services := DescribeServices([]string{"0000110B-0000-1000-8000-00805F9B34FB", "0000110a-0000-1000-8000-00805f9b34fb", "e4a2b1a0-0000-1000-8000-00805f9b34fb"})
+	assert.Equal(t, []Service{
+		{UUID: "0000110a-0000-1000-8000-00805f9b34fb", Name: "Audio Source", Capability: "a2dp_source"},
+		{UUID: "0000110b-0000-1000-8000-00805f9b34fb", Name: "Audio Sink", Capability: "a2dp_sink"},
+		{UUID: "e4a2b1a0-0000-1000-8000-00805f9b34fb"},
+	}, services)
+}
+
+func TestCapabilities(t *testing.T) {
+	uuids := []string{
+		"0000110b-0000-1000-8000-00805f9b34fb",
+		"0000110e-0000-1000-8000-00805f9b34fb",
+		"0000110c-0000-1000-8000-00805f9b34fb",
+		"0000111e-0000-1000-8000-00805f9b34fb",
+		"0000180f-0000-1000-8000-00805f9b34fb",
+		"00001200-0000-1000-8000-00805f9b34fb",
+		"6e400001-b5a3-f393-e0a9-e50e24dcca9e",
+	}
+	assert.Equal(t, []string{"a2dp_sink", "avrcp", "battery", "hfp"}, Capabilities(uuids))
+	assert.Equal(t, []string{}, Capabilities(nil))
+}
+
+func TestNormalizeUUID(t *testing.T) {
+	assert.Equal(t, "0000110b-0000-1000-8000-00805f9b34fb", NormalizeUUID("110B"))
+	assert.Equal(t, "0000110b-0000-1000-8000-00805f9b34fb", NormalizeUUID("0000110b"))
+	assert.Equal(t, "6e400001-b5a3-f393-e0a9-e50e24dcca9e", NormalizeUUID("6E400001-B5A3-F393-E0A9-E50E24DCCA9E"))
+}
@@ -0,0 +1,104 @@
+package bluetooth
+
+import (
+	"errors"
+	"sync"
+)
+
+// Holders of the adapter visibility
+const (
+	VisibilityGuest    = "guest"
+	VisibilitySchedule = "schedule"
+)
+
+// Visibility arbitrates the discoverable and pairable states of the adapters between the windows
+// opening them, such as guest mode and the discoverable schedules: the first window opening on an
+// adapter saves its states, which are only restored once the last window closes
+type Visibility struct {
+	btManager BluetoothManagerInterface
+
+	mu       sync.Mutex
+	adapters map[string]*visibilityState
+}
+
+// visibilityState is an adapter kept discoverable by one or more holders, and the states it
+// reverts to once they all closed their window
+type visibilityState struct {
+	wasDiscoverable bool
+	wasPairable     bool
+	// holders tell whether they need the adapter pairable
+	holders map[string]bool
+}
+
+// NewVisibility creates a new visibility arbiter
+func NewVisibility(btManager BluetoothManagerInterface) *Visibility {
+	return &Visibility{btManager: btManager, adapters: make(map[string]*visibilityState)}
+}
+
+// Open makes an adapter discoverable, and pairable when asked, on behalf of a holder. It is called
+// again during the window to turn them back on when bluetoothd turned them off, e.g. once its
+// DiscoverableTimeout elapsed, the adapter giving the current states.
+func (v *Visibility) Open(holder string, adapter Adapter, pairable bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	state := v.adapters[adapter.Path]
+	if state == nil {
+		state = &visibilityState{
+			wasDiscoverable: adapter.Discoverable,
+			wasPairable:     adapter.Pairable,
+			holders:         make(map[string]bool),
+		}
+		v.adapters[adapter.Path] = state
+	}
+	state.holders[holder] = pairable
+
+	if state.pairable() && !adapter.Pairable {
+		if err := v.btManager.SetPairable(adapter.Path, true); err != nil {
+			return err
+		}
+	}
+	if !adapter.Discoverable {
+		return v.btManager.SetDiscoverable(adapter.Path, true)
+	}
+	return nil
+}
+
+// Close ends the window of a holder on an adapter. The states of the adapter are restored when it
+// was the last window, the others keep the adapter discoverable.
+func (v *Visibility) Close(holder, adapterPath string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	state := v.adapters[adapterPath]
+	if state == nil {
+		return nil
+	}
+	pairable := state.pairable()
+	delete(state.holders, holder)
+
+	if len(state.holders) == 0 {
+		delete(v.adapters, adapterPath)
+		return errors.Join(
+			v.btManager.SetDiscoverable(adapterPath, state.wasDiscoverable),
+			v.btManager.SetPairable(adapterPath, state.wasPairable),
+		)
+	}
+	if pairable && !state.pairable() {
+		return v.btManager.SetPairable(adapterPath, false)
+	}
+	return nil
+}
+
+// pairable reports whether the adapter stays pairable during the windows
+func (s *visibilityState) pairable() bool {
+	if s.wasPairable {
+		return true
+	}
+	for _, pairable := range s.holders {
+		if pairable {
+			return true
+		}
+	}
+	return false
+}
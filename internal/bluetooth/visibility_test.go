@@ -0,0 +1,50 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVisibility_OverlappingWindows(t *testing.T) {
+	btManager := NewMockBluetoothManager(t)
+	visibility := NewVisibility(btManager)
+	adapter := Adapter{Path: "/org/bluez/hci0"}
+
+	// Guest mode opens first and saves the adapter states
+	btManager.On("SetPairable", adapter.Path, true).Return(nil).Once()
+	btManager.On("SetDiscoverable", adapter.Path, true).Return(nil).Once()
+	assert.NoError(t, visibility.Open(VisibilityGuest, adapter, true))
+
+	// A schedule opens on the already discoverable adapter
+	assert.NoError(t, visibility.Open(VisibilitySchedule, Adapter{Path: adapter.Path, Discoverable: true, Pairable: true}, false))
+
+	// Guest mode closes: the schedule keeps the adapter discoverable, but no longer pairable
+	btManager.On("SetPairable", adapter.Path, false).Return(nil).Once()
+	assert.NoError(t, visibility.Close(VisibilityGuest, adapter.Path))
+	btManager.AssertNotCalled(t, "SetDiscoverable", adapter.Path, false)
+
+	// The schedule closes last and restores the states saved by guest mode
+	btManager.On("SetDiscoverable", adapter.Path, false).Return(nil).Once()
+	btManager.On("SetPairable", adapter.Path, false).Return(nil).Once()
+	assert.NoError(t, visibility.Close(VisibilitySchedule, adapter.Path))
+
+	// Closing again is a no-op
+	assert.NoError(t, visibility.Close(VisibilitySchedule, adapter.Path))
+}
+
+func TestVisibility_KeepsInitialStates(t *testing.T) {
+	btManager := NewMockBluetoothManager(t)
+	visibility := NewVisibility(btManager)
+	adapter := Adapter{Path: "/org/bluez/hci0", Pairable: true}
+
+	btManager.On("SetDiscoverable", adapter.Path, true).Return(nil).Once()
+	assert.NoError(t, visibility.Open(VisibilitySchedule, adapter, false))
+	// bluetoothd turned discoverable off during the window
+	btManager.On("SetDiscoverable", adapter.Path, true).Return(nil).Once()
+	assert.NoError(t, visibility.Open(VisibilitySchedule, adapter, false))
+
+	btManager.On("SetDiscoverable", adapter.Path, false).Return(nil).Once()
+	btManager.On("SetPairable", adapter.Path, true).Return(nil).Once()
+	assert.NoError(t, visibility.Close(VisibilitySchedule, adapter.Path))
+}
@@ -0,0 +1,86 @@
+package bluetooth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// MediaTransportInterface is the BlueZ interface of an open audio stream, carrying the AVRCP absolute volume
+const MediaTransportInterface = "org.bluez.MediaTransport1"
+
+// maxTransportVolume is the highest AVRCP absolute volume
+const maxTransportVolume = 127
+
+// ErrNoVolumeControl is returned when a device has no audio transport supporting absolute volume
+var ErrNoVolumeControl = errors.New("device has no audio transport with absolute volume")
+
+// VolumeToPercent converts an AVRCP absolute volume (0-127) to a percentage
+func VolumeToPercent(volume uint16) uint8 {
+	if volume > maxTransportVolume {
+		volume = maxTransportVolume
+	}
+	return uint8((uint32(volume)*100 + maxTransportVolume/2) / maxTransportVolume)
+}
+
+// PercentToVolume converts a percentage to an AVRCP absolute volume (0-127)
+func PercentToVolume(percent uint8) uint16 {
+	if percent > 100 {
+		percent = 100
+	}
+	return uint16((uint32(percent)*maxTransportVolume + 50) / 100)
+}
+
+// transportVolumes maps the device paths to the volume of their media transport, in percent.
+// Transports without absolute volume support have no Volume property and are skipped.
+func transportVolumes(objects map[dbus.ObjectPath]map[string]map[string]dbus.Variant) map[dbus.ObjectPath]uint8 {
+	volumes := make(map[dbus.ObjectPath]uint8)
+	for _, interfaces := range objects {
+		props, ok := interfaces[MediaTransportInterface]
+		if !ok {
+			continue
+		}
+		device, ok := props["Device"].Value().(dbus.ObjectPath)
+		if !ok {
+			continue
+		}
+		if volume, ok := props["Volume"].Value().(uint16); ok {
+			volumes[device] = VolumeToPercent(volume)
+		}
+	}
+	return volumes
+}
+
+// SetVolume sets the AVRCP absolute volume of a device, in percent
+func (bm *BluetoothManager) SetVolume(adapterPath, macAddress string, percent uint8) error {
+	devicePath := dbus.ObjectPath(fmt.Sprintf("%s/dev_%s", adapterPath, strings.ReplaceAll(macAddress, ":", "_")))
+
+	objects, err := bm.managedObjects()
+	if err != nil {
+		return err
+	}
+
+	for path, interfaces := range objects {
+		props, ok := interfaces[MediaTransportInterface]
+		if !ok {
+			continue
+		}
+		if device, _ := props["Device"].Value().(dbus.ObjectPath); device != devicePath {
+			continue
+		}
+		if _, ok := props["Volume"]; !ok {
+			continue
+		}
+
+		transport := bm.conn.Object(BluezService, path)
+		call := transport.Call("org.freedesktop.DBus.Properties.Set", 0, MediaTransportInterface, "Volume", dbus.MakeVariant(PercentToVolume(percent)))
+		if call.Err != nil {
+			return fmt.Errorf("failed to set volume on device %s: %w", macAddress, call.Err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("failed to set volume on device %s: %w", macAddress, ErrNoVolumeControl)
+}
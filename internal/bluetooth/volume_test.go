@@ -0,0 +1,36 @@
+package bluetooth
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeConversion(t *testing.T) {
+	assert.Equal(t, uint8(0), VolumeToPercent(0))
+	assert.Equal(t, uint8(100), VolumeToPercent(127))
+	assert.Equal(t, uint8(100), VolumeToPercent(200))
+	assert.Equal(t, uint16(127), PercentToVolume(100))
+	assert.Equal(t, uint16(127), PercentToVolume(150))
+
+	for percent := uint8(0); percent <= 100; percent++ {
+		assert.Equal(t, percent, VolumeToPercent(PercentToVolume(percent)))
+	}
+}
+
+func TestTransportVolumes(t *testing.T) {
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{
+		"/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF/fd0": {MediaTransportInterface: {
+			"Device": dbus.MakeVariant(dbus.ObjectPath("/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF")),
+			"Volume": dbus.MakeVariant(uint16(64)),
+		}},
+		// Without absolute volume support
+		"/org/bluez/hci0/dev_11_22_33_44_55_66/fd1": {MediaTransportInterface: {
+			"Device": dbus.MakeVariant(dbus.ObjectPath("/org/bluez/hci0/dev_11_22_33_44_55_66")),
+		}},
+		"/org/bluez/hci0/dev_11_22_33_44_55_66": {DeviceInterface: {}},
+	}
+
+	assert.Equal(t, map[dbus.ObjectPath]uint8{"/org/bluez/hci0/dev_AA_BB_CC_DD_EE_FF": 50}, transportVolumes(objects))
+}
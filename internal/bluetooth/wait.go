@@ -0,0 +1,98 @@
+package bluetooth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+var (
+	// ErrServicesNotResolved is returned when the services of a device are not resolved in time
+	ErrServicesNotResolved = errors.New("services of the device not resolved in time")
+	// ErrDeviceDisconnected is returned when a device disconnects while its services are resolved
+	ErrDeviceDisconnected = errors.New("device disconnected before its services were resolved")
+	// ErrPairingTimeout is returned when a pairing does not complete in time
+	ErrPairingTimeout = errors.New("pairing not completed in time")
+	// ErrDeviceGone is returned when the adapter forgets a device while waiting for it
+	ErrDeviceGone = errors.New("device no longer known to the adapter")
+)
+
+// waitPollInterval is how often the device is checked while waiting for it
+const waitPollInterval = 100 * time.Millisecond
+
+// WaitServicesResolved waits for BlueZ to resolve the services of a connected device, reported by
+// the ServicesResolved property of Device1. Using the profiles or the GATT attributes of a device
+// before then routinely fails.
+func WaitServicesResolved(ctx context.Context, bm BluetoothManagerInterface, adapterPath, macAddress string, timeout time.Duration) error {
+	_, err := waitDevice(ctx, bm, adapterPath, macAddress, timeout, ErrServicesNotResolved, func(device *Device) (bool, error) {
+		if device != nil && device.ServicesResolved {
+			return true, nil
+		}
+		if device == nil || !device.Connected {
+			return false, ErrDeviceDisconnected
+		}
+		return false, nil
+	})
+	return err
+}
+
+// WaitPaired waits for the Paired property of a device to be set, BlueZ answering a pairing call
+// around the time it sets it, and returns the paired device
+func WaitPaired(ctx context.Context, bm BluetoothManagerInterface, adapterPath, macAddress string, timeout time.Duration) (*Device, error) {
+	return waitDevice(ctx, bm, adapterPath, macAddress, timeout, ErrPairingTimeout, func(device *Device) (bool, error) {
+		if device == nil {
+			return false, ErrDeviceGone
+		}
+		return device.Paired, nil
+	})
+}
+
+// waitDevice checks a device until done reports it reached a state or fails, done getting nil when
+// the adapter does not know the device. It returns timeoutErr when the timeout elapses first.
+func waitDevice(ctx context.Context, bm BluetoothManagerInterface, adapterPath, macAddress string, timeout time.Duration, timeoutErr error, done func(*Device) (bool, error)) (*Device, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		devices, err := bm.GetDevices(adapterPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get devices: %w", err)
+		}
+		var device *Device
+		for i := range devices {
+			if strings.EqualFold(devices[i].Address, macAddress) {
+				device = &devices[i]
+			}
+		}
+		if ok, err := done(device); err != nil {
+			return nil, err
+		} else if ok {
+			return device, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, timeoutErr
+			}
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// BluezError returns the name of the BlueZ error behind err, such as
+// org.bluez.Error.AuthenticationFailed, or an empty string when BlueZ did not report it
+func BluezError(err error) string {
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) && strings.HasPrefix(dbusErr.Name, "org.bluez.Error.") {
+		return dbusErr.Name
+	}
+	return ""
+}
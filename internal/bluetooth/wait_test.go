@@ -0,0 +1,47 @@
+package bluetooth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitServicesResolved(t *testing.T) {
+	btManager := NewMockBluetoothManager(t)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]Device{{Address: "AA:BB:CC:DD:EE:FF", Connected: true}}, nil).Twice()
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]Device{{Address: "AA:BB:CC:DD:EE:FF", Connected: true, ServicesResolved: true}}, nil).Once()
+	assert.NoError(t, WaitServicesResolved(context.Background(), btManager, "/org/bluez/hci0", "aa:bb:cc:dd:ee:ff", time.Second))
+
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]Device{{Address: "AA:BB:CC:DD:EE:FF"}}, nil).Once()
+	err := WaitServicesResolved(context.Background(), btManager, "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", time.Second)
+	assert.ErrorIs(t, err, ErrDeviceDisconnected)
+
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]Device{{Address: "AA:BB:CC:DD:EE:FF", Connected: true}}, nil)
+	err = WaitServicesResolved(context.Background(), btManager, "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", 250*time.Millisecond)
+	assert.ErrorIs(t, err, ErrServicesNotResolved)
+}
+
+func TestWaitPaired(t *testing.T) {
+	btManager := NewMockBluetoothManager(t)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]Device{{Address: "AA:BB:CC:DD:EE:FF"}}, nil).Once()
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true}}, nil).Once()
+	device, err := WaitPaired(context.Background(), btManager, "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", time.Second)
+	assert.NoError(t, err)
+	assert.True(t, device.Paired)
+
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]Device{}, nil).Once()
+	_, err = WaitPaired(context.Background(), btManager, "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", time.Second)
+	assert.ErrorIs(t, err, ErrDeviceGone)
+}
+
+func TestBluezError(t *testing.T) {
+	err := fmt.Errorf("failed to pair with device: %w", dbus.Error{Name: "org.bluez.Error.AuthenticationFailed", Body: []interface{}{"Authentication Failed"}})
+	assert.Equal(t, "org.bluez.Error.AuthenticationFailed", BluezError(err))
+	assert.Empty(t, BluezError(dbus.Error{Name: "org.freedesktop.DBus.Error.NoReply"}))
+	assert.Empty(t, BluezError(errors.New("already exists")))
+}
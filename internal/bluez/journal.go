@@ -0,0 +1,160 @@
+package bluez
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BluetoothdUnit is the systemd unit of bluetoothd
+const BluetoothdUnit = "bluetooth.service"
+
+// JournalPriorities are the syslog priority names, from the most to the least severe
+var JournalPriorities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// JournalEntry is an entry of the journal of bluetoothd
+type JournalEntry struct {
+	Time time.Time `json:"time"`
+	// Priority is the syslog priority, 0 (emerg) to 7 (debug)
+	Priority   int    `json:"priority"`
+	Identifier string `json:"identifier,omitempty"`
+	PID        int    `json:"pid,omitempty"`
+	Message    string `json:"message"`
+}
+
+// JournalOptions select the entries of the journal to follow
+type JournalOptions struct {
+	// Lines is the number of past entries sent before following the new ones
+	Lines int
+	// Priority only keeps the entries of this priority or more severe, given as a name or a number,
+	// every entry when empty
+	Priority string
+}
+
+// ParseJournalPriority parses a syslog priority name, such as err, or number
+func ParseJournalPriority(value string) (int, error) {
+	if i := slices.Index(JournalPriorities, strings.ToLower(value)); i >= 0 {
+		return i, nil
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 && n < len(JournalPriorities) {
+		return n, nil
+	}
+	return 0, fmt.Errorf("invalid priority %q: must be 0 to 7 or one of %s", value, strings.Join(JournalPriorities, ", "))
+}
+
+// JournalReader follows the journal of bluetoothd
+type JournalReader interface {
+	// Follow sends the entries of the journal until the context is cancelled, closing the channel
+	// once done. An error of the journal after it started is sent as a last entry.
+	Follow(ctx context.Context, opts JournalOptions) (<-chan JournalEntry, error)
+}
+
+// Journalctl reads the journal of a systemd unit through journalctl. The sd-journal bindings, such as
+// the sdjournal package of go-systemd, need the libsystemd headers at build time, which the Alpine
+// builder of the image lacks, and the static builds cannot load libsystemd anyway; journalctl only
+// has to be installed on the host running the broker.
+type Journalctl struct {
+	Unit string
+}
+
+// Follow runs journalctl --follow on the unit until the context is cancelled
+func (j Journalctl) Follow(ctx context.Context, opts JournalOptions) (<-chan JournalEntry, error) {
+	args := []string{"--unit", j.Unit, "--follow", "--output", "json", "--lines", strconv.Itoa(opts.Lines)}
+	if opts.Priority != "" {
+		priority, err := ParseJournalPriority(opts.Priority)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--priority", strconv.Itoa(priority))
+	}
+
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run journalctl: %w", err)
+	}
+
+	entries := make(chan JournalEntry)
+	go func() {
+		defer close(entries)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			entry, err := parseJournalEntry(scanner.Bytes())
+			if err != nil {
+				log.Printf("Journal: %v", err)
+				continue
+			}
+			select {
+			case entries <- entry:
+			case <-ctx.Done():
+			}
+		}
+
+		if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+			message := strings.TrimSpace(stderr.String())
+			if message == "" {
+				message = err.Error()
+			}
+			select {
+			case entries <- JournalEntry{Time: time.Now(), Priority: 3, Identifier: "journalctl", Message: message}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return entries, nil
+}
+
+// parseJournalEntry parses an entry of journalctl --output json. Fields are strings, or arrays of
+// bytes when they are not valid UTF-8.
+func parseJournalEntry(line []byte) (JournalEntry, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return JournalEntry{}, fmt.Errorf("invalid journal entry: %w", err)
+	}
+	field := func(name string) string {
+		raw, ok := fields[name]
+		if !ok {
+			return ""
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s
+		}
+		var b []byte
+		var ints []int
+		if err := json.Unmarshal(raw, &ints); err == nil {
+			for _, i := range ints {
+				b = append(b, byte(i))
+			}
+		}
+		return string(b)
+	}
+
+	entry := JournalEntry{
+		Priority:   6,
+		Identifier: field("SYSLOG_IDENTIFIER"),
+		Message:    field("MESSAGE"),
+	}
+	if usec, err := strconv.ParseInt(field("__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+		entry.Time = time.UnixMicro(usec)
+	}
+	if priority, err := strconv.Atoi(field("PRIORITY")); err == nil {
+		entry.Priority = priority
+	}
+	entry.PID, _ = strconv.Atoi(field("_PID"))
+	return entry, nil
+}
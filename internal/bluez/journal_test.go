@@ -0,0 +1,41 @@
+package bluez
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJournalEntry(t *testing.T) {
+	entry, err := parseJournalEntry([]byte(`{"__REALTIME_TIMESTAMP": "1792144800000000", "PRIORITY": "3", "SYSLOG_IDENTIFIER": "bluetoothd", "_PID": "612", "MESSAGE": "src/device.c:device_bonding_complete() status 0x05"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, JournalEntry{
+		Time:       time.UnixMicro(1792144800000000),
+		Priority:   3,
+		Identifier: "bluetoothd",
+		PID:        612,
+		Message:    "src/device.c:device_bonding_complete() status 0x05",
+	}, entry)
+
+	// Messages which are not valid UTF-8 are arrays of bytes
+	entry, err = parseJournalEntry([]byte(`{"MESSAGE": [104, 99, 105, 48]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, JournalEntry{Priority: 6, Message: "hci0"}, entry)
+
+	_, err = parseJournalEntry([]byte(`-- No entries --`))
+	assert.Error(t, err)
+}
+
+func TestParseJournalPriority(t *testing.T) {
+	priority, err := ParseJournalPriority("warning")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, priority)
+	priority, err = ParseJournalPriority("7")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, priority)
+	_, err = ParseJournalPriority("8")
+	assert.Error(t, err)
+	_, err = ParseJournalPriority("loud")
+	assert.Error(t, err)
+}
@@ -0,0 +1,199 @@
+// Package bluez reads the on-disk storage of bluetoothd, /var/lib/bluetooth, to import the pairings
+// made before the broker was installed, and follows its journal
+package bluez
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// ImportedConfigKey is the config key recording when the storage was imported
+const ImportedConfigKey = "bluez_storage_imported_at"
+
+var addressPattern = regexp.MustCompile(`^([0-9A-F]{2}:){5}[0-9A-F]{2}$`)
+
+// keySections are the sections of a device info file holding the keys of a bond, BR/EDR or LE.
+// SlaveLongTermKey is the name used by BlueZ before 5.56.
+var keySections = []string{"LinkKey", "LongTermKey", "PeripheralLongTermKey", "SlaveLongTermKey"}
+
+// StoredDevice is a device known to an adapter in the BlueZ storage
+type StoredDevice struct {
+	Adapter string
+	Address string
+	Name    string
+	Class   uint32
+	Trusted bool
+	Blocked bool
+	// HasLinkKey tells the device is bonded, the keys themselves are never read out
+	HasLinkKey bool
+	// LastSeen is the last time BlueZ wrote about the device, as it does not record when it was last
+	// seen: the modification time of its info or cache file
+	LastSeen time.Time
+}
+
+// ReadStorage returns the devices of every adapter of a BlueZ storage directory, such as
+// /var/lib/bluetooth/<adapter>/<device>/info
+func ReadStorage(dir string) ([]StoredDevice, error) {
+	adapters, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read BlueZ storage: %w", err)
+	}
+
+	var devices []StoredDevice
+	for _, adapter := range adapters {
+		if !adapter.IsDir() || !addressPattern.MatchString(adapter.Name()) {
+			continue
+		}
+		adapterDir := filepath.Join(dir, adapter.Name())
+		entries, err := os.ReadDir(adapterDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read BlueZ storage of adapter %s: %w", adapter.Name(), err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || !addressPattern.MatchString(entry.Name()) {
+				continue
+			}
+			device, err := readDevice(adapterDir, entry.Name())
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			device.Adapter = adapter.Name()
+			devices = append(devices, *device)
+		}
+	}
+	return devices, nil
+}
+
+// readDevice reads the info file of a device, completed by its cache file for its name
+func readDevice(adapterDir, address string) (*StoredDevice, error) {
+	infoPath := filepath.Join(adapterDir, address, "info")
+	info, err := readKeyFile(infoPath)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(infoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	general := info["General"]
+	device := &StoredDevice{
+		Address:  address,
+		Name:     general["Name"],
+		Trusted:  general["Trusted"] == "true",
+		Blocked:  general["Blocked"] == "true",
+		LastSeen: stat.ModTime(),
+	}
+	if class, err := strconv.ParseUint(general["Class"], 0, 32); err == nil {
+		device.Class = uint32(class)
+	}
+	for _, section := range keySections {
+		if _, ok := info[section]; ok {
+			device.HasLinkKey = true
+		}
+	}
+
+	// The name of the devices which are not bonded is only in the cache
+	cachePath := filepath.Join(adapterDir, "cache", address)
+	if cache, err := readKeyFile(cachePath); err == nil {
+		if device.Name == "" {
+			device.Name = cache["General"]["Name"]
+		}
+		if stat, err := os.Stat(cachePath); err == nil && stat.ModTime().After(device.LastSeen) {
+			device.LastSeen = stat.ModTime()
+		}
+	}
+	return device, nil
+}
+
+// readKeyFile parses a GLib key file, the INI-like format of the BlueZ storage, into its sections
+func readKeyFile(path string) (map[string]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sections := map[string]map[string]string{}
+	var section map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = map[string]string{}
+			sections[line[1:len(line)-1]] = section
+		case section != nil:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				section[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return sections, nil
+}
+
+// Import stores the devices of a BlueZ storage directory as known devices and returns their number.
+// Their names are encrypted with the cipher when it is enabled.
+func Import(db database.DatabaseInterface, cipher *secrets.Cipher, dir string) (int, error) {
+	stored, err := ReadStorage(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	devices := make([]database.KnownDevice, len(stored))
+	for i, d := range stored {
+		lastSeen := d.LastSeen
+		devices[i] = database.KnownDevice{
+			Adapter:    d.Adapter,
+			Address:    d.Address,
+			Name:       d.Name,
+			Class:      d.Class,
+			Trusted:    d.Trusted,
+			Blocked:    d.Blocked,
+			HasLinkKey: d.HasLinkKey,
+			LastSeen:   &lastSeen,
+			ImportedAt: now,
+		}
+	}
+	if err := database.SaveKnownDevices(db, cipher, devices); err != nil {
+		return 0, err
+	}
+	return len(devices), nil
+}
+
+// ImportOnce imports a BlueZ storage directory unless it was already imported, so that it only seeds
+// the database on the first start. It returns false when the import was skipped.
+func ImportOnce(db *sql.DB, cipher *secrets.Cipher, dir string) (bool, int, error) {
+	imported, err := database.ConfigExists(db, ImportedConfigKey)
+	if err != nil || imported {
+		return false, 0, err
+	}
+
+	count, err := Import(db, cipher, dir)
+	if err != nil {
+		return false, 0, err
+	}
+	if err := database.SetConfig(db, ImportedConfigKey, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return false, 0, err
+	}
+	return true, count, nil
+}
@@ -0,0 +1,93 @@
+package bluez
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeStorage(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"00:1A:7D:DA:71:01/settings": "[General]\nDiscoverable=false\n",
+		"00:1A:7D:DA:71:01/AA:BB:CC:DD:EE:FF/info": `[General]
+Name=Headphones
+Class=0x240404
+SupportedTechnologies=BR/EDR;
+Trusted=true
+Blocked=false
+
+[LinkKey]
+Key=0123456789ABCDEF0123456789ABCDEF
+Type=4
+PINLength=0
+`,
+		"00:1A:7D:DA:71:01/11:22:33:44:55:66/info":  "[General]\nTrusted=false\nBlocked=true\n\n[PeripheralLongTermKey]\nKey=00\n",
+		"00:1A:7D:DA:71:01/cache/11:22:33:44:55:66": "[General]\nName=Keyboard\n",
+		// A device directory without info file, left behind by bluetoothd, is skipped
+		"00:1A:7D:DA:71:01/22:33:44:55:66:77/attributes": "",
+		"00:1A:7D:DA:71:02/33:44:55:66:77:88/info":       "[General]\nName=Speaker\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestReadStorage(t *testing.T) {
+	dir := writeStorage(t)
+	seen := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "00:1A:7D:DA:71:01/cache/11:22:33:44:55:66"), seen.Add(time.Hour), seen.Add(time.Hour)))
+	assert.NoError(t, os.Chtimes(filepath.Join(dir, "00:1A:7D:DA:71:01/11:22:33:44:55:66/info"), seen, seen))
+
+	devices, err := ReadStorage(dir)
+	assert.NoError(t, err)
+	assert.Len(t, devices, 3)
+
+	assert.Equal(t, "00:1A:7D:DA:71:01", devices[0].Adapter)
+	assert.Equal(t, "11:22:33:44:55:66", devices[0].Address)
+	assert.Equal(t, "Keyboard", devices[0].Name, "the name of a device is read from the cache when missing from its info")
+	assert.True(t, devices[0].Blocked)
+	assert.True(t, devices[0].HasLinkKey)
+	assert.Equal(t, seen.Add(time.Hour), devices[0].LastSeen.UTC())
+
+	assert.Equal(t, StoredDevice{Adapter: "00:1A:7D:DA:71:01", Address: "AA:BB:CC:DD:EE:FF", Name: "Headphones", Class: 0x240404, Trusted: true, HasLinkKey: true, LastSeen: devices[1].LastSeen}, devices[1])
+	assert.Equal(t, "00:1A:7D:DA:71:02", devices[2].Adapter)
+	assert.False(t, devices[2].HasLinkKey)
+
+	_, err = ReadStorage(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestImportOnce(t *testing.T) {
+	dir := writeStorage(t)
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT 1 FROM config").WithArgs(ImportedConfigKey).WillReturnRows(sqlmock.NewRows([]string{"1"}))
+	mock.ExpectBegin()
+	for _, address := range []string{"11:22:33:44:55:66", "AA:BB:CC:DD:EE:FF", "33:44:55:66:77:88"} {
+		mock.ExpectExec("INSERT OR REPLACE INTO known_devices").WithArgs(sqlmock.AnyArg(), address, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+	mock.ExpectExec("INSERT OR REPLACE INTO config").WithArgs(ImportedConfigKey, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	imported, count, err := ImportOnce(db, nil, dir)
+	assert.NoError(t, err)
+	assert.True(t, imported)
+	assert.Equal(t, 3, count)
+
+	// The storage is only imported on the first start
+	mock.ExpectQuery("SELECT 1 FROM config").WithArgs(ImportedConfigKey).WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	imported, _, err = ImportOnce(db, nil, dir)
+	assert.NoError(t, err)
+	assert.False(t, imported)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,464 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/reconnect"
+	"github.com/nerzhul/home-bt-broker/internal/trustsync"
+)
+
+// Config holds the runtime configuration of the broker. The env tag of a field is the variable it is read from.
+type Config struct {
+	Port               string   `env:"PORT"`
+	ReadOnly           bool     `env:"READ_ONLY"`
+	BluetoothBackend   string   `env:"BT_BACKEND"`
+	BlueZStorageDir    string   `env:"BLUEZ_STORAGE_DIR"`
+	DataDir            string   `env:"DATA_DIR"`
+	DatabasePath       string   `env:"DATABASE_PATH"`
+	SQLiteJournalMode  string   `env:"SQLITE_JOURNAL_MODE"`
+	SQLiteForeignKeys  bool     `env:"SQLITE_FOREIGN_KEYS"`
+	DBMaxOpenConns     int      `env:"DB_MAX_OPEN_CONNS"`
+	DBMaxIdleConns     int      `env:"DB_MAX_IDLE_CONNS"`
+	TLSCertFile        string   `env:"TLS_CERT_FILE"`
+	TLSKeyFile         string   `env:"TLS_KEY_FILE"`
+	LogOutput          string   `env:"LOG_OUTPUT"`
+	SyslogAddress      string   `env:"SYSLOG_ADDRESS"`
+	AllowedCIDRs       []string `env:"ALLOWED_CIDRS"`
+	TrustedProxies     []string `env:"TRUSTED_PROXIES"`
+	BasePath           string   `env:"BASE_PATH"`
+	CORSAllowedOrigins []string `env:"CORS_ALLOWED_ORIGINS"`
+	BootstrapUsername  string   `env:"BOOTSTRAP_USERNAME"`
+	BootstrapToken     string   `env:"BOOTSTRAP_TOKEN"`
+	EncryptionKey      string   `env:"ENCRYPTION_KEY"`
+	EncryptionKeyFile  string   `env:"ENCRYPTION_KEY_FILE"`
+	WebhookURL         string   `env:"WEBHOOK_URL"`
+	PublicURL          string   `env:"PUBLIC_URL"`
+	PairingMode        string   `env:"PAIRING_MODE"`
+	AdapterSync        string   `env:"ADAPTER_SYNC"`
+	ReconnectFailover  string   `env:"RECONNECT_FAILOVER"`
+	QuietHours         string   `env:"QUIET_HOURS"`
+	QuietHoursDays     []string `env:"QUIET_HOURS_DAYS"`
+	QuietHoursAdapters []string `env:"QUIET_HOURS_ADAPTERS"`
+	PairingAllowlist   bool     `env:"PAIRING_ALLOWLIST"`
+	DeviceOwnerOnly    bool     `env:"DEVICE_OWNER_ONLY"`
+	AudioConfigCleanup bool     `env:"AUDIO_CONFIG_CLEANUP"`
+	MQTTURL            string   `env:"MQTT_URL"`
+	MQTTTopicPrefix    string   `env:"MQTT_TOPIC_PREFIX"`
+	NtfyURL            string   `env:"NTFY_URL"`
+	NtfyToken          string   `env:"NTFY_TOKEN"`
+	PushoverToken      string   `env:"PUSHOVER_TOKEN"`
+	PushoverUser       string   `env:"PUSHOVER_USER"`
+	NotifyEvents       []string `env:"NOTIFY_EVENTS"`
+	WebPushSubject     string   `env:"WEBPUSH_SUBJECT"`
+	WebPushKeyFile     string   `env:"WEBPUSH_KEY_FILE"`
+	PluginDir          string   `env:"PLUGIN_DIR"`
+	HooksDir           string   `env:"HOOKS_DIR"`
+	TelegramToken      string   `env:"TELEGRAM_TOKEN"`
+	TelegramChatIDs    []int64  `env:"TELEGRAM_CHAT_IDS"`
+	StatsDHost         string   `env:"STATSD_HOST"`
+	StatsDPort         int      `env:"STATSD_PORT"`
+	StatsDPrefix       string   `env:"STATSD_PREFIX"`
+
+	BatterySampleInterval   time.Duration `env:"BATTERY_SAMPLE_INTERVAL"`
+	BatteryLowThreshold     int           `env:"BATTERY_LOW_THRESHOLD"`
+	RSSISampleInterval      time.Duration `env:"RSSI_SAMPLE_INTERVAL"`
+	BeaconScanInterval      time.Duration `env:"BEACON_SCAN_INTERVAL"`
+	BeaconTimeout           time.Duration `env:"BEACON_TIMEOUT"`
+	PresenceInterval        time.Duration `env:"PRESENCE_INTERVAL"`
+	PresenceAwayTimeout     time.Duration `env:"PRESENCE_AWAY_TIMEOUT"`
+	PairingRequestTimeout   time.Duration `env:"PAIRING_REQUEST_TIMEOUT"`
+	StatsDInterval          time.Duration `env:"STATSD_INTERVAL"`
+	DBusPingInterval        time.Duration `env:"DBUS_PING_INTERVAL"`
+	VirtualNodesInterval    time.Duration `env:"VIRTUAL_NODES_INTERVAL"`
+	VolumeSyncInterval      time.Duration `env:"VOLUME_SYNC_INTERVAL"`
+	ReconnectInterval       time.Duration `env:"RECONNECT_INTERVAL"`
+	ReconnectResolveTimeout time.Duration `env:"RECONNECT_RESOLVE_TIMEOUT"`
+	IdleCheckInterval       time.Duration `env:"IDLE_CHECK_INTERVAL"`
+	GuestCheckInterval      time.Duration `env:"GUEST_CHECK_INTERVAL"`
+	ScheduleCheckInterval   time.Duration `env:"SCHEDULE_CHECK_INTERVAL"`
+	IdempotencyWindow       time.Duration `env:"IDEMPOTENCY_WINDOW"`
+	BatteryRetention        time.Duration `env:"BATTERY_RETENTION"`
+	RSSIRetention           time.Duration `env:"RSSI_RETENTION"`
+	AuditRetention          time.Duration `env:"AUDIT_RETENTION"`
+	PruneInterval           time.Duration `env:"PRUNE_INTERVAL"`
+	SQLiteBusyTimeout       time.Duration `env:"SQLITE_BUSY_TIMEOUT"`
+	DBConnMaxLifetime       time.Duration `env:"DB_CONN_MAX_LIFETIME"`
+	DBConnMaxIdleTime       time.Duration `env:"DB_CONN_MAX_IDLE_TIME"`
+	AuthCacheTTL            time.Duration `env:"AUTH_CACHE_TTL"`
+	AuthLockoutThreshold    int           `env:"AUTH_LOCKOUT_THRESHOLD"`
+	AuthLockoutDuration     time.Duration `env:"AUTH_LOCKOUT_DURATION"`
+	AuthLockoutMax          time.Duration `env:"AUTH_LOCKOUT_MAX_DURATION"`
+	HookTimeout             time.Duration `env:"HOOK_TIMEOUT"`
+	HookConcurrency         int           `env:"HOOK_CONCURRENCY"`
+}
+
+// Load reads the configuration from the environment and validates it. When CONFIG_FILE is set, the
+// variables it defines take precedence over the environment, so that it can be reloaded at runtime.
+// Every problem found is reported at once in a *ValidationError.
+func Load() (*Config, error) {
+	getenv := os.Getenv
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		values, err := readEnvFile(path)
+		if err != nil {
+			return nil, &ValidationError{Errors: []error{err}}
+		}
+		getenv = func(name string) string {
+			if value, ok := values[name]; ok {
+				return value
+			}
+			return os.Getenv(name)
+		}
+	}
+	return load(getenv)
+}
+
+// load reads the configuration from a variable lookup function and validates it
+func load(getenv func(string) string) (*Config, error) {
+	var err error
+	var errs []error
+
+	cfg := &Config{
+		Port: getenv("PORT"),
+	}
+	if cfg.Port == "" {
+		cfg.Port = "8080"
+	}
+
+	if cfg.ReadOnly, err = boolEnv(getenv, "READ_ONLY", false); err != nil {
+		errs = append(errs, err)
+	}
+
+	cfg.BlueZStorageDir = getenv("BLUEZ_STORAGE_DIR")
+	if cfg.BlueZStorageDir == "" {
+		cfg.BlueZStorageDir = "/var/lib/bluetooth"
+	}
+
+	// systemd sets STATE_DIRECTORY when the unit declares a StateDirectory
+	cfg.DataDir = getenv("DATA_DIR")
+	if cfg.DataDir == "" {
+		cfg.DataDir = getenv("STATE_DIRECTORY")
+	}
+	if cfg.DataDir == "" {
+		cfg.DataDir = "."
+	}
+	cfg.DatabasePath = getenv("DATABASE_PATH")
+	if cfg.DatabasePath == "" {
+		cfg.DatabasePath = filepath.Join(cfg.DataDir, "data.db")
+	}
+
+	cfg.SQLiteJournalMode = strings.ToUpper(getenv("SQLITE_JOURNAL_MODE"))
+	if cfg.SQLiteJournalMode == "" {
+		cfg.SQLiteJournalMode = database.JournalModeWAL
+	}
+	if cfg.SQLiteForeignKeys, err = boolEnv(getenv, "SQLITE_FOREIGN_KEYS", true); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.DBMaxOpenConns, err = intEnv(getenv, "DB_MAX_OPEN_CONNS", 4); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.DBMaxIdleConns, err = intEnv(getenv, "DB_MAX_IDLE_CONNS", cfg.DBMaxOpenConns); err != nil {
+		errs = append(errs, err)
+	}
+
+	cfg.TLSCertFile = getenv("TLS_CERT_FILE")
+	cfg.TLSKeyFile = getenv("TLS_KEY_FILE")
+
+	cfg.LogOutput = getenv("LOG_OUTPUT")
+	if cfg.LogOutput == "" {
+		cfg.LogOutput = "stderr"
+	}
+	cfg.SyslogAddress = getenv("SYSLOG_ADDRESS")
+
+	cfg.AllowedCIDRs = splitList(getenv("ALLOWED_CIDRS"))
+	cfg.TrustedProxies = splitList(getenv("TRUSTED_PROXIES"))
+	cfg.BasePath = strings.TrimSuffix(getenv("BASE_PATH"), "/")
+	cfg.CORSAllowedOrigins = splitList(getenv("CORS_ALLOWED_ORIGINS"))
+	if len(cfg.CORSAllowedOrigins) == 0 {
+		cfg.CORSAllowedOrigins = []string{"*"}
+	}
+
+	cfg.BootstrapUsername = getenv("BOOTSTRAP_USERNAME")
+	if cfg.BootstrapUsername == "" {
+		cfg.BootstrapUsername = "admin"
+	}
+	cfg.BootstrapToken = getenv("BOOTSTRAP_TOKEN")
+
+	cfg.EncryptionKey = getenv("ENCRYPTION_KEY")
+	cfg.EncryptionKeyFile = getenv("ENCRYPTION_KEY_FILE")
+
+	cfg.WebhookURL = getenv("WEBHOOK_URL")
+	cfg.PublicURL = getenv("PUBLIC_URL")
+
+	cfg.BluetoothBackend = getenv("BT_BACKEND")
+	if cfg.BluetoothBackend == "" {
+		cfg.BluetoothBackend = bluetooth.BackendDBus
+	}
+
+	cfg.PairingMode = getenv("PAIRING_MODE")
+	if cfg.PairingMode == "" {
+		cfg.PairingMode = "auto"
+	}
+	cfg.AdapterSync = getenv("ADAPTER_SYNC")
+	if cfg.AdapterSync == "" {
+		cfg.AdapterSync = trustsync.PolicyOff
+	}
+	cfg.ReconnectFailover = getenv("RECONNECT_FAILOVER")
+	if cfg.ReconnectFailover == "" {
+		cfg.ReconnectFailover = reconnect.FailoverOff
+	}
+	cfg.QuietHours = getenv("QUIET_HOURS")
+	cfg.QuietHoursDays = splitList(getenv("QUIET_HOURS_DAYS"))
+	cfg.QuietHoursAdapters = splitList(getenv("QUIET_HOURS_ADAPTERS"))
+
+	if cfg.PairingAllowlist, err = boolEnv(getenv, "PAIRING_ALLOWLIST", false); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.DeviceOwnerOnly, err = boolEnv(getenv, "DEVICE_OWNER_ONLY", false); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.AudioConfigCleanup, err = boolEnv(getenv, "AUDIO_CONFIG_CLEANUP", false); err != nil {
+		errs = append(errs, err)
+	}
+
+	cfg.MQTTURL = getenv("MQTT_URL")
+	cfg.MQTTTopicPrefix = getenv("MQTT_TOPIC_PREFIX")
+	if cfg.MQTTTopicPrefix == "" {
+		cfg.MQTTTopicPrefix = "home-bt-broker"
+	}
+
+	cfg.NtfyURL = getenv("NTFY_URL")
+	cfg.NtfyToken = getenv("NTFY_TOKEN")
+	cfg.PushoverToken = getenv("PUSHOVER_TOKEN")
+	cfg.PushoverUser = getenv("PUSHOVER_USER")
+	cfg.NotifyEvents = splitList(getenv("NOTIFY_EVENTS"))
+	cfg.WebPushSubject = getenv("WEBPUSH_SUBJECT")
+	cfg.WebPushKeyFile = getenv("WEBPUSH_KEY_FILE")
+	if cfg.WebPushKeyFile == "" {
+		cfg.WebPushKeyFile = filepath.Join(cfg.DataDir, "webpush.key")
+	}
+	cfg.PluginDir = getenv("PLUGIN_DIR")
+	cfg.HooksDir = getenv("HOOKS_DIR")
+
+	cfg.TelegramToken = getenv("TELEGRAM_TOKEN")
+	for _, id := range splitList(getenv("TELEGRAM_CHAT_IDS")) {
+		chatID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid TELEGRAM_CHAT_IDS entry %q: must be a numeric chat ID", id))
+			continue
+		}
+		cfg.TelegramChatIDs = append(cfg.TelegramChatIDs, chatID)
+	}
+
+	cfg.StatsDHost = getenv("STATSD_HOST")
+	if cfg.StatsDPort, err = intEnv(getenv, "STATSD_PORT", 8125); err != nil {
+		errs = append(errs, err)
+	}
+	cfg.StatsDPrefix = getenv("STATSD_PREFIX")
+	if cfg.StatsDPrefix == "" {
+		cfg.StatsDPrefix = "home_bt_broker"
+	}
+
+	if cfg.BatterySampleInterval, err = durationEnv(getenv, "BATTERY_SAMPLE_INTERVAL", 5*time.Minute); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.BatteryLowThreshold, err = intEnv(getenv, "BATTERY_LOW_THRESHOLD", 20); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.RSSISampleInterval, err = durationEnv(getenv, "RSSI_SAMPLE_INTERVAL", 30*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.BeaconScanInterval, err = durationEnv(getenv, "BEACON_SCAN_INTERVAL", 10*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.BeaconTimeout, err = durationEnv(getenv, "BEACON_TIMEOUT", time.Minute); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.PresenceInterval, err = durationEnv(getenv, "PRESENCE_INTERVAL", 30*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.PresenceAwayTimeout, err = durationEnv(getenv, "PRESENCE_AWAY_TIMEOUT", 5*time.Minute); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.PairingRequestTimeout, err = durationEnv(getenv, "PAIRING_REQUEST_TIMEOUT", 30*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.StatsDInterval, err = durationEnv(getenv, "STATSD_INTERVAL", 10*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.DBusPingInterval, err = durationEnv(getenv, "DBUS_PING_INTERVAL", 10*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.VirtualNodesInterval, err = durationEnv(getenv, "VIRTUAL_NODES_INTERVAL", 30*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.VolumeSyncInterval, err = durationEnv(getenv, "VOLUME_SYNC_INTERVAL", 2*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.ReconnectInterval, err = durationEnv(getenv, "RECONNECT_INTERVAL", time.Minute); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.ReconnectResolveTimeout, err = durationEnv(getenv, "RECONNECT_RESOLVE_TIMEOUT", 0); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.IdleCheckInterval, err = durationEnv(getenv, "IDLE_CHECK_INTERVAL", time.Minute); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.GuestCheckInterval, err = durationEnv(getenv, "GUEST_CHECK_INTERVAL", 5*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.ScheduleCheckInterval, err = durationEnv(getenv, "SCHEDULE_CHECK_INTERVAL", 30*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.IdempotencyWindow, err = durationEnv(getenv, "IDEMPOTENCY_WINDOW", 24*time.Hour); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.BatteryRetention, err = durationEnv(getenv, "BATTERY_RETENTION", 30*24*time.Hour); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.RSSIRetention, err = durationEnv(getenv, "RSSI_RETENTION", 30*24*time.Hour); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.AuditRetention, err = durationEnv(getenv, "AUDIT_RETENTION", 90*24*time.Hour); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.PruneInterval, err = durationEnv(getenv, "PRUNE_INTERVAL", time.Hour); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.SQLiteBusyTimeout, err = durationEnv(getenv, "SQLITE_BUSY_TIMEOUT", 5*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.DBConnMaxLifetime, err = durationEnv(getenv, "DB_CONN_MAX_LIFETIME", 0); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.DBConnMaxIdleTime, err = durationEnv(getenv, "DB_CONN_MAX_IDLE_TIME", 0); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.AuthCacheTTL, err = durationEnv(getenv, "AUTH_CACHE_TTL", 30*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.AuthLockoutThreshold, err = intEnv(getenv, "AUTH_LOCKOUT_THRESHOLD", 5); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.AuthLockoutDuration, err = durationEnv(getenv, "AUTH_LOCKOUT_DURATION", time.Minute); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.AuthLockoutMax, err = durationEnv(getenv, "AUTH_LOCKOUT_MAX_DURATION", time.Hour); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.HookTimeout, err = durationEnv(getenv, "HOOK_TIMEOUT", 10*time.Second); err != nil {
+		errs = append(errs, err)
+	}
+	if cfg.HookConcurrency, err = intEnv(getenv, "HOOK_CONCURRENCY", 4); err != nil {
+		errs = append(errs, err)
+	}
+
+	errs = append(errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+
+	return cfg, nil
+}
+
+// DatabaseOptions returns the SQLite options of the configuration
+func (c *Config) DatabaseOptions() database.Options {
+	return database.Options{
+		JournalMode: c.SQLiteJournalMode,
+		BusyTimeout: c.SQLiteBusyTimeout,
+		ForeignKeys: c.SQLiteForeignKeys,
+
+		MaxOpenConns:    c.DBMaxOpenConns,
+		MaxIdleConns:    c.DBMaxIdleConns,
+		ConnMaxLifetime: c.DBConnMaxLifetime,
+		ConnMaxIdleTime: c.DBConnMaxIdleTime,
+	}
+}
+
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// durationEnv reads a duration such as "30s" or "5m" from the environment.
+// The env helpers return the default value with their error so that validation does not report it twice.
+func durationEnv(getenv func(string) string, name string, defaultValue time.Duration) (time.Duration, error) {
+	value := getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return d, nil
+}
+
+// intEnv reads an integer from the environment
+func intEnv(getenv func(string) string, name string, defaultValue int) (int, error) {
+	value := getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return i, nil
+}
+
+// boolEnv reads a boolean such as "true" or "0" from the environment
+func boolEnv(getenv func(string) string, name string, defaultValue bool) (bool, error) {
+	value := getenv(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return defaultValue, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return b, nil
+}
+
+// readEnvFile reads the variables of a file of KEY=VALUE lines, in the format of systemd's
+// EnvironmentFile: blank lines and lines starting with # are ignored and values may be quoted
+func readEnvFile(path string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+	}
+
+	values := make(map[string]string)
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid CONFIG_FILE %s line %d: expected KEY=VALUE", path, i+1)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[name] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+)
+
+// redactedValue replaces the secrets in a redacted configuration
+const redactedValue = "REDACTED"
+
+// public are the text and list variables known not to hold credentials, shown as they are. The
+// others are redacted, so that a new variable holding a credential is not leaked until it is
+// listed here. Durations, numbers and booleans cannot hold one and are always shown.
+var public = map[string]bool{
+	"PORT":                 true,
+	"BT_BACKEND":           true,
+	"BLUEZ_STORAGE_DIR":    true,
+	"DATA_DIR":             true,
+	"DATABASE_PATH":        true,
+	"SQLITE_JOURNAL_MODE":  true,
+	"TLS_CERT_FILE":        true,
+	"TLS_KEY_FILE":         true,
+	"LOG_OUTPUT":           true,
+	"SYSLOG_ADDRESS":       true,
+	"ALLOWED_CIDRS":        true,
+	"TRUSTED_PROXIES":      true,
+	"BASE_PATH":            true,
+	"CORS_ALLOWED_ORIGINS": true,
+	"BOOTSTRAP_USERNAME":   true,
+	"ENCRYPTION_KEY_FILE":  true,
+	"PUBLIC_URL":           true,
+	"PAIRING_MODE":         true,
+	"ADAPTER_SYNC":         true,
+	"RECONNECT_FAILOVER":   true,
+	"QUIET_HOURS":          true,
+	"QUIET_HOURS_DAYS":     true,
+	"QUIET_HOURS_ADAPTERS": true,
+	"MQTT_TOPIC_PREFIX":    true,
+	"NOTIFY_EVENTS":        true,
+	"WEBPUSH_SUBJECT":      true,
+	"WEBPUSH_KEY_FILE":     true,
+	"PLUGIN_DIR":           true,
+	"HOOKS_DIR":            true,
+	"STATSD_HOST":          true,
+	"STATSD_PREFIX":        true,
+}
+
+// secretURLs are the variables holding URLs which may carry credentials. The password of their
+// user info is redacted, and the whole path and query when they are set to true: the path of a
+// webhook is often a secret itself, and a public ntfy topic name is the only credential of the topic.
+var secretURLs = map[string]bool{
+	"MQTT_URL":    false,
+	"NTFY_URL":    true,
+	"WEBHOOK_URL": true,
+}
+
+// Redacted returns the configuration by variable name, with the secrets redacted, to be attached to
+// bug reports
+func (c *Config) Redacted() map[string]interface{} {
+	redacted := make(map[string]interface{})
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		field := v.Field(i)
+		value := field.Interface()
+		secretPath, isURL := secretURLs[name]
+		switch {
+		case public[name]:
+		case isURL:
+			value = redactURL(value.(string), secretPath)
+		case field.Kind() == reflect.String || field.Kind() == reflect.Slice:
+			if field.Len() > 0 {
+				value = redactedValue
+			}
+		}
+		redacted[name] = value
+	}
+	return redacted
+}
+
+// redactURL redacts the credentials of a URL, and its path and query when secretPath is set
+func redactURL(value string, secretPath bool) string {
+	if value == "" {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return redactedValue
+	}
+	if secretPath && (u.Path != "" || u.RawQuery != "") {
+		u.Path, u.RawPath, u.RawQuery = "/"+redactedValue, "", ""
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+)
+
+// reloadable are the variables applied without restarting the broker
+var reloadable = map[string]bool{
+	"CORS_ALLOWED_ORIGINS":      true,
+	"NTFY_URL":                  true,
+	"NTFY_TOKEN":                true,
+	"PUSHOVER_TOKEN":            true,
+	"PUSHOVER_USER":             true,
+	"NOTIFY_EVENTS":             true,
+	"TELEGRAM_TOKEN":            true,
+	"TELEGRAM_CHAT_IDS":         true,
+	"WEBHOOK_URL":               true,
+	"MQTT_URL":                  true,
+	"MQTT_TOPIC_PREFIX":         true,
+	"AUTH_LOCKOUT_THRESHOLD":    true,
+	"AUTH_LOCKOUT_DURATION":     true,
+	"AUTH_LOCKOUT_MAX_DURATION": true,
+}
+
+// ReloadResult lists the variables whose value changed on a reload
+type ReloadResult struct {
+	// Applied are the variables applied to the running broker
+	Applied []string `json:"applied"`
+	// RestartRequired are the variables which only take effect once the broker restarts
+	RestartRequired []string `json:"restart_required"`
+}
+
+// Reloader loads the configuration again on demand and hands the reloadable settings to the
+// subsystems using them, without restarting the server and dropping its clients
+type Reloader struct {
+	mu      sync.Mutex
+	current *Config
+	hooks   []func(*Config)
+}
+
+// NewReloader creates a reloader starting from the configuration the broker was started with
+func NewReloader(cfg *Config) *Reloader {
+	current := *cfg
+	return &Reloader{current: &current}
+}
+
+// OnReload registers a function applying the reloadable settings, it is called after every reload
+// changing one of them
+func (r *Reloader) OnReload(apply func(cfg *Config)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, apply)
+}
+
+// Reload loads the configuration and applies the reloadable settings which changed. An invalid
+// configuration is rejected as a whole and the running one is kept.
+func (r *Reloader) Reload() (ReloadResult, error) {
+	cfg, err := Load()
+	if err != nil {
+		return ReloadResult{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Only the reloadable settings are taken from the new configuration, so that the settings
+	// waiting for a restart are reported again on the next reloads
+	result := ReloadResult{Applied: []string{}, RestartRequired: []string{}}
+	current := reflect.ValueOf(r.current).Elem()
+	next := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		name := current.Type().Field(i).Tag.Get("env")
+		if reflect.DeepEqual(current.Field(i).Interface(), next.Field(i).Interface()) {
+			continue
+		}
+		if reloadable[name] {
+			current.Field(i).Set(next.Field(i))
+			result.Applied = append(result.Applied, name)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, name)
+		}
+	}
+
+	if len(result.Applied) > 0 {
+		applied := *r.current
+		for _, apply := range r.hooks {
+			apply(&applied)
+		}
+	}
+	return result, nil
+}
+
+// Run reloads the configuration on every SIGHUP until the context is cancelled
+func (r *Reloader) Run(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+			result, err := r.Reload()
+			if err != nil {
+				log.Printf("Failed to reload configuration, keeping the running one: %v", err)
+				continue
+			}
+			log.Printf("Configuration reloaded, applied: %v, restart required: %v", result.Applied, result.RestartRequired)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "broker.env")
+	assert.NoError(t, os.WriteFile(path, []byte("NTFY_URL=https://ntfy.sh/home\n"), 0600))
+	t.Setenv("DATABASE_PATH", filepath.Join(dir, "data.db"))
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := Load()
+	assert.NoError(t, err)
+	r := NewReloader(cfg)
+	var applied []*Config
+	r.OnReload(func(cfg *Config) { applied = append(applied, cfg) })
+
+	result, err := r.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, ReloadResult{Applied: []string{}, RestartRequired: []string{}}, result)
+	assert.Empty(t, applied)
+
+	assert.NoError(t, os.WriteFile(path, []byte("NTFY_URL=https://ntfy.sh/away\nCORS_ALLOWED_ORIGINS=https://dashboard.lan\nPORT=9090\n"), 0600))
+	result, err = r.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"PORT", "CORS_ALLOWED_ORIGINS", "NTFY_URL"}, append(result.RestartRequired, result.Applied...))
+	if assert.Len(t, applied, 1) {
+		assert.Equal(t, "https://ntfy.sh/away", applied[0].NtfyURL)
+		assert.Equal(t, []string{"https://dashboard.lan"}, applied[0].CORSAllowedOrigins)
+		assert.Equal(t, "8080", applied[0].Port)
+	}
+
+	// Settings waiting for a restart are reported until then, an invalid file is rejected
+	result, err = r.Reload()
+	assert.NoError(t, err)
+	assert.Equal(t, ReloadResult{Applied: []string{}, RestartRequired: []string{"PORT"}}, result)
+
+	assert.NoError(t, os.WriteFile(path, []byte("NTFY_URL=ntfy\n"), 0600))
+	_, err = r.Reload()
+	assert.ErrorContains(t, err, "invalid NTFY_URL")
+	assert.Len(t, applied, 1)
+}
@@ -0,0 +1,307 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/logging"
+	"github.com/nerzhul/home-bt-broker/internal/mqtt"
+	"github.com/nerzhul/home-bt-broker/internal/reconnect"
+	"github.com/nerzhul/home-bt-broker/internal/schedule"
+	"github.com/nerzhul/home-bt-broker/internal/trustsync"
+	"golang.org/x/sys/unix"
+)
+
+// ValidationError aggregates every problem found in the configuration
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Errors)+1)
+	lines = append(lines, fmt.Sprintf("%d configuration error(s):", len(e.Errors)))
+	for _, err := range e.Errors {
+		lines = append(lines, "  - "+err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validate checks the values read from the environment, so that the broker fails at startup
+// instead of on the first request using them
+func (c *Config) validate() []error {
+	var errs []error
+
+	if err := checkPort(c.Port); err != nil {
+		errs = append(errs, fmt.Errorf("invalid PORT %q: %w", c.Port, err))
+	}
+	if c.StatsDHost != "" {
+		if err := checkPort(strconv.Itoa(c.StatsDPort)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid STATSD_PORT %d: %w", c.StatsDPort, err))
+		}
+	}
+
+	if err := checkWritable(c.DatabasePath); err != nil {
+		errs = append(errs, fmt.Errorf("DATABASE_PATH %q is not writable: %w", c.DatabasePath, err))
+	}
+
+	if !slices.Contains(database.JournalModes, c.SQLiteJournalMode) {
+		errs = append(errs, fmt.Errorf("invalid SQLITE_JOURNAL_MODE %q: must be one of %s", c.SQLiteJournalMode, strings.Join(database.JournalModes, ", ")))
+	}
+	if c.SQLiteBusyTimeout < time.Millisecond {
+		errs = append(errs, fmt.Errorf("invalid SQLITE_BUSY_TIMEOUT %s: must be a duration of at least 1ms such as 5s", c.SQLiteBusyTimeout))
+	}
+
+	if c.DBMaxOpenConns < 1 {
+		errs = append(errs, fmt.Errorf("invalid DB_MAX_OPEN_CONNS %d: must be at least 1", c.DBMaxOpenConns))
+	} else if c.DBMaxIdleConns < 1 || c.DBMaxIdleConns > c.DBMaxOpenConns {
+		errs = append(errs, fmt.Errorf("invalid DB_MAX_IDLE_CONNS %d: must be between 1 and DB_MAX_OPEN_CONNS", c.DBMaxIdleConns))
+	}
+	if c.DBConnMaxLifetime < 0 || c.DBConnMaxIdleTime < 0 {
+		errs = append(errs, errors.New("DB_CONN_MAX_LIFETIME and DB_CONN_MAX_IDLE_TIME must be positive durations, or 0 to keep the connections forever"))
+	}
+	if c.ReconnectResolveTimeout < 0 {
+		errs = append(errs, fmt.Errorf("invalid RECONNECT_RESOLVE_TIMEOUT %s: must be a positive duration such as 10s, or 0 not to wait", c.ReconnectResolveTimeout))
+	}
+	if c.AuthCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("invalid AUTH_CACHE_TTL %s: must be a positive duration such as 30s, or 0 to disable the cache", c.AuthCacheTTL))
+	}
+	if c.AuthLockoutThreshold < 0 {
+		errs = append(errs, fmt.Errorf("invalid AUTH_LOCKOUT_THRESHOLD %d: must be a number of failures, or 0 to disable the lockout", c.AuthLockoutThreshold))
+	}
+	if c.HooksDir != "" {
+		if info, err := os.Stat(c.HooksDir); err != nil || !info.IsDir() {
+			errs = append(errs, fmt.Errorf("invalid HOOKS_DIR %q: must be an existing directory", c.HooksDir))
+		}
+	}
+	if c.HookTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("invalid HOOK_TIMEOUT %s: must be a positive duration such as 10s", c.HookTimeout))
+	}
+	if c.HookConcurrency < 1 {
+		errs = append(errs, fmt.Errorf("invalid HOOK_CONCURRENCY %d: must be at least 1", c.HookConcurrency))
+	}
+	if c.AuthLockoutDuration <= 0 || c.AuthLockoutMax < c.AuthLockoutDuration {
+		errs = append(errs, fmt.Errorf("invalid AUTH_LOCKOUT_DURATION %s and AUTH_LOCKOUT_MAX_DURATION %s: must be positive durations, the maximum at least the first lockout", c.AuthLockoutDuration, c.AuthLockoutMax))
+	}
+
+	errs = append(errs, c.validateTLS()...)
+
+	switch c.LogOutput {
+	case logging.OutputStderr, logging.OutputJournald, logging.OutputSyslog:
+	default:
+		errs = append(errs, fmt.Errorf("invalid LOG_OUTPUT %q: must be stderr, journald or syslog", c.LogOutput))
+	}
+
+	if !slices.Contains(bluetooth.Backends(), c.BluetoothBackend) {
+		errs = append(errs, fmt.Errorf("invalid BT_BACKEND %q: must be one of %s", c.BluetoothBackend, strings.Join(bluetooth.Backends(), ", ")))
+	}
+
+	if c.PairingMode != "auto" && c.PairingMode != "manual" {
+		errs = append(errs, fmt.Errorf("invalid PAIRING_MODE %q: must be auto or manual", c.PairingMode))
+	}
+	if !slices.Contains(trustsync.Policies, c.AdapterSync) {
+		errs = append(errs, fmt.Errorf("invalid ADAPTER_SYNC %q: must be one of %s", c.AdapterSync, strings.Join(trustsync.Policies, ", ")))
+	}
+	if !slices.Contains(reconnect.FailoverPolicies, c.ReconnectFailover) {
+		errs = append(errs, fmt.Errorf("invalid RECONNECT_FAILOVER %q: must be one of %s", c.ReconnectFailover, strings.Join(reconnect.FailoverPolicies, ", ")))
+	}
+	if c.QuietHours != "" {
+		if _, err := schedule.ParseQuietHours(c.QuietHours, c.QuietHoursDays); err != nil {
+			errs = append(errs, fmt.Errorf("invalid QUIET_HOURS %q: %w", c.QuietHours, err))
+		}
+	}
+
+	if c.MQTTURL != "" {
+		if _, err := mqtt.ParseURL(c.MQTTURL); err != nil {
+			errs = append(errs, fmt.Errorf("MQTT_URL: %w, expected mqtt://[user:password@]host[:port] or mqtts://host[:port]", err))
+		}
+	}
+
+	if c.WebhookURL != "" {
+		if u, err := url.Parse(c.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid WEBHOOK_URL %q: must be an http:// or https:// URL", c.WebhookURL))
+		}
+	}
+
+	if c.PublicURL != "" {
+		if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid PUBLIC_URL %q: must be an http:// or https:// URL", c.PublicURL))
+		}
+	}
+
+	if c.NtfyURL != "" {
+		if u, err := url.Parse(c.NtfyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(u.Path) < 2 {
+			errs = append(errs, fmt.Errorf("invalid NTFY_URL %q: must be a topic URL such as https://ntfy.sh/my-topic", c.NtfyURL))
+		}
+	}
+	if (c.PushoverToken == "") != (c.PushoverUser == "") {
+		errs = append(errs, errors.New("PUSHOVER_TOKEN and PUSHOVER_USER must be set together"))
+	}
+	if c.WebPushSubject != "" {
+		if u, err := url.Parse(c.WebPushSubject); err != nil || (u.Scheme != "mailto" && u.Scheme != "https") || (u.Opaque == "" && u.Host == "") {
+			errs = append(errs, fmt.Errorf("invalid WEBPUSH_SUBJECT %q: must be a mailto: or https:// URL", c.WebPushSubject))
+		}
+	}
+
+	if c.TelegramToken != "" && len(c.TelegramChatIDs) == 0 {
+		errs = append(errs, errors.New("TELEGRAM_CHAT_IDS must list the chats allowed to use the bot set with TELEGRAM_TOKEN"))
+	}
+
+	for _, list := range []struct {
+		name  string
+		cidrs []string
+	}{
+		{"ALLOWED_CIDRS", c.AllowedCIDRs},
+		{"TRUSTED_PROXIES", c.TrustedProxies},
+	} {
+		for _, cidr := range list.cidrs {
+			if net.ParseIP(cidr) != nil {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s entry %q: must be an IP address or a CIDR such as 192.168.1.0/24", list.name, cidr))
+			}
+		}
+	}
+
+	if c.BasePath != "" && (!strings.HasPrefix(c.BasePath, "/") || strings.ContainsAny(c.BasePath, "?#")) {
+		errs = append(errs, fmt.Errorf("invalid BASE_PATH %q: must be a path such as /bt", c.BasePath))
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			errs = append(errs, fmt.Errorf("invalid CORS_ALLOWED_ORIGINS entry %q: must be * or an origin such as https://dashboard.lan", origin))
+		}
+	}
+
+	if c.BatteryLowThreshold < 0 || c.BatteryLowThreshold > 100 {
+		errs = append(errs, fmt.Errorf("invalid BATTERY_LOW_THRESHOLD %d: must be a percentage between 0 and 100", c.BatteryLowThreshold))
+	}
+
+	// Intervals drive tickers, which panic on non-positive durations
+	for _, interval := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"BATTERY_SAMPLE_INTERVAL", c.BatterySampleInterval},
+		{"RSSI_SAMPLE_INTERVAL", c.RSSISampleInterval},
+		{"BEACON_SCAN_INTERVAL", c.BeaconScanInterval},
+		{"BEACON_TIMEOUT", c.BeaconTimeout},
+		{"PRESENCE_INTERVAL", c.PresenceInterval},
+		{"PRESENCE_AWAY_TIMEOUT", c.PresenceAwayTimeout},
+		{"PAIRING_REQUEST_TIMEOUT", c.PairingRequestTimeout},
+		{"STATSD_INTERVAL", c.StatsDInterval},
+		{"DBUS_PING_INTERVAL", c.DBusPingInterval},
+		{"VIRTUAL_NODES_INTERVAL", c.VirtualNodesInterval},
+		{"VOLUME_SYNC_INTERVAL", c.VolumeSyncInterval},
+		{"RECONNECT_INTERVAL", c.ReconnectInterval},
+		{"IDLE_CHECK_INTERVAL", c.IdleCheckInterval},
+		{"GUEST_CHECK_INTERVAL", c.GuestCheckInterval},
+		{"SCHEDULE_CHECK_INTERVAL", c.ScheduleCheckInterval},
+		{"IDEMPOTENCY_WINDOW", c.IdempotencyWindow},
+		{"PRUNE_INTERVAL", c.PruneInterval},
+	} {
+		if interval.value <= 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %s: must be a positive duration such as 30s", interval.name, interval.value))
+		}
+	}
+
+	// A zero retention keeps the history forever
+	for _, retention := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"BATTERY_RETENTION", c.BatteryRetention},
+		{"RSSI_RETENTION", c.RSSIRetention},
+		{"AUDIT_RETENTION", c.AuditRetention},
+	} {
+		if retention.value < 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %s: must be a positive duration such as 720h, or 0 to keep the history forever", retention.name, retention.value))
+		}
+	}
+
+	return errs
+}
+
+// validateTLS checks both TLS files are set together, readable and match each other
+func (c *Config) validateTLS() []error {
+	if c.TLSCertFile == "" && c.TLSKeyFile == "" {
+		return nil
+	}
+	if c.TLSCertFile == "" || c.TLSKeyFile == "" {
+		return []error{errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")}
+	}
+
+	var errs []error
+	for name, path := range map[string]string{"TLS_CERT_FILE": c.TLSCertFile, "TLS_KEY_FILE": c.TLSKeyFile} {
+		if _, err := os.Stat(path); err != nil {
+			errs = append(errs, fmt.Errorf("%s %q is not readable: %w", name, path, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	if _, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile); err != nil {
+		return []error{fmt.Errorf("failed to load TLS_CERT_FILE and TLS_KEY_FILE: %w", err)}
+	}
+	return nil
+}
+
+// checkPort checks a port is a number between 1 and 65535
+func checkPort(port string) error {
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return errors.New("must be a number between 1 and 65535")
+	}
+	return nil
+}
+
+// checkWritable checks a file can be written, or created in its nearest existing parent directory.
+// SQLite also writes its journal next to the database, so the directory must be writable as well.
+func checkWritable(path string) error {
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return errors.New("is a directory")
+		}
+		if err := unix.Access(path, unix.W_OK); err != nil {
+			return err
+		}
+	}
+
+	dir := filepath.Dir(path)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			if err := unix.Access(dir, unix.W_OK); err != nil {
+				return fmt.Errorf("directory %s: %w", dir, err)
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+}
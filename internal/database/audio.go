@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DeviceAudioSettings are the audio preferences applied when a device connects.
+// Codecs are ordered by preference and stored comma-separated.
+// Zero values leave the PipeWire defaults untouched, except AutoConnect which must be true
+// to let WirePlumber connect the audio profiles of the device when it appears.
+type DeviceAudioSettings struct {
+	Address               string       `json:"address" db:"address"`
+	Codecs                []string     `json:"codecs" db:"codecs"`
+	SampleRate            int          `json:"sample_rate" db:"sample_rate"`
+	Channels              string       `json:"channels" db:"channels"`
+	AutoSwitchDefaultSink bool         `json:"auto_switch_default_sink" db:"auto_switch_default_sink"`
+	AutoConnect           bool         `json:"auto_connect" db:"auto_connect"`
+	Profile               string       `json:"profile" db:"profile"`
+	Latency               AudioLatency `json:"latency"`
+	UpdatedAt             time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+// AudioLatency overrides the latency of the audio nodes of a device
+type AudioLatency struct {
+	// NodeLatency is the requested latency as a fraction of a second, such as "512/48000"
+	NodeLatency string `json:"node_latency" db:"node_latency"`
+	// Quantum forces the graph quantum while the device plays
+	Quantum int `json:"quantum" db:"quantum"`
+	// OffsetMs is added to the reported latency, which lets players delay the video to keep it in sync
+	OffsetMs int `json:"offset_ms" db:"latency_offset_ms"`
+}
+
+const deviceAudioSettingsColumns = `address, codecs, sample_rate, channels, auto_switch_default_sink, auto_connect, profile,
+	node_latency, quantum, latency_offset_ms, updated_at`
+
+// SetDeviceAudioSettings stores the audio settings of a device, replacing any previous settings
+// except the latency which is set with SetDeviceAudioLatency
+func SetDeviceAudioSettings(db DatabaseInterface, settings DeviceAudioSettings) error {
+	query := `INSERT INTO device_audio_settings
+		(address, codecs, sample_rate, channels, auto_switch_default_sink, auto_connect, profile, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(address) DO UPDATE SET codecs = excluded.codecs, sample_rate = excluded.sample_rate,
+			channels = excluded.channels, auto_switch_default_sink = excluded.auto_switch_default_sink,
+			auto_connect = excluded.auto_connect, profile = excluded.profile, updated_at = excluded.updated_at`
+
+	_, err := db.Exec(query, settings.Address, strings.Join(settings.Codecs, ","), settings.SampleRate, settings.Channels,
+		settings.AutoSwitchDefaultSink, settings.AutoConnect, settings.Profile, settings.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set device audio settings: %w", err)
+	}
+
+	return nil
+}
+
+// SetDeviceAudioLatency stores the latency overrides of a device, keeping its other settings
+func SetDeviceAudioLatency(db DatabaseInterface, address string, latency AudioLatency) error {
+	query := `INSERT INTO device_audio_settings (address, node_latency, quantum, latency_offset_ms, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(address) DO UPDATE SET node_latency = excluded.node_latency, quantum = excluded.quantum,
+			latency_offset_ms = excluded.latency_offset_ms, updated_at = excluded.updated_at`
+
+	_, err := db.Exec(query, address, latency.NodeLatency, latency.Quantum, latency.OffsetMs, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to set device audio latency: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeviceAudioSettings returns the audio settings of a device, or nil if it has none
+func GetDeviceAudioSettings(db DatabaseInterface, address string) (*DeviceAudioSettings, error) {
+	query := `SELECT ` + deviceAudioSettingsColumns + ` FROM device_audio_settings WHERE address = ?`
+
+	settings, err := scanDeviceAudioSettings(db.QueryRow(query, address))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get device audio settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// GetAllDeviceAudioSettings returns the audio settings of every device
+func GetAllDeviceAudioSettings(db DatabaseInterface) ([]DeviceAudioSettings, error) {
+	rows, err := db.Query(`SELECT ` + deviceAudioSettingsColumns + ` FROM device_audio_settings ORDER BY address`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device audio settings: %w", err)
+	}
+	defer rows.Close()
+
+	all := []DeviceAudioSettings{}
+	for rows.Next() {
+		settings, err := scanDeviceAudioSettings(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device audio settings: %w", err)
+		}
+		all = append(all, *settings)
+	}
+
+	return all, rows.Err()
+}
+
+func scanDeviceAudioSettings(row interface{ Scan(...interface{}) error }) (*DeviceAudioSettings, error) {
+	var settings DeviceAudioSettings
+	var codecs string
+	err := row.Scan(&settings.Address, &codecs, &settings.SampleRate, &settings.Channels,
+		&settings.AutoSwitchDefaultSink, &settings.AutoConnect, &settings.Profile,
+		&settings.Latency.NodeLatency, &settings.Latency.Quantum, &settings.Latency.OffsetMs, &settings.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Codecs = []string{}
+	if codecs != "" {
+		settings.Codecs = strings.Split(codecs, ",")
+	}
+	return &settings, nil
+}
+
+// DeleteDeviceAudioSettings removes the audio settings of a device
+func DeleteDeviceAudioSettings(db DatabaseInterface, address string) error {
+	result, err := db.Exec(`DELETE FROM device_audio_settings WHERE address = ?`, address)
+	if err != nil {
+		return fmt.Errorf("failed to delete device audio settings: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("device '%s' has no audio settings", address)
+	}
+
+	return nil
+}
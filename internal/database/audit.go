@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Outcomes of an audited action
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeDenied  = "denied"
+)
+
+// AuditActorAnonymous is the actor of the requests refused before their client authenticated, the
+// username they sent being whatever the client typed, possibly a token
+const AuditActorAnonymous = "anonymous"
+
+// AuditEntry records an action of an API client: who did what, on which device, and how it went
+type AuditEntry struct {
+	ID        int64     `json:"id" db:"id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	Actor     string    `json:"actor" db:"actor"`
+	IP        string    `json:"ip" db:"ip"`
+	// Action is the method and route of the request, e.g. "POST /api/v1/tokens"
+	Action    string `json:"action" db:"action"`
+	Device    string `json:"device,omitempty" db:"device"`
+	Outcome   string `json:"outcome" db:"outcome"`
+	Status    int    `json:"status" db:"status"`
+	RequestID string `json:"request_id,omitempty" db:"request_id"`
+}
+
+// AuditFilter selects audit entries, the zero value of a field matching every entry
+type AuditFilter struct {
+	Actor   string
+	Device  string
+	Action  string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+	// Before only selects the entries older than the one of this ID, to fetch the next page
+	Before int64
+	// Limit is the largest number of entries returned, 0 returning them all
+	Limit int
+}
+
+// AddAuditEntry stores an audit entry
+func AddAuditEntry(db DatabaseInterface, entry AuditEntry) error {
+	query := `INSERT INTO audit_log (created_at, actor, ip, action, device, outcome, status, request_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := db.Exec(query, entry.CreatedAt, entry.Actor, entry.IP, entry.Action, strings.ToUpper(entry.Device),
+		entry.Outcome, entry.Status, entry.RequestID)
+	if err != nil {
+		return fmt.Errorf("failed to add audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// GetAuditEntries returns the audit entries matching a filter, most recent first
+func GetAuditEntries(db DatabaseInterface, filter AuditFilter) ([]AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+	for _, condition := range []struct {
+		clause string
+		value  interface{}
+		set    bool
+	}{
+		{"actor = ?", filter.Actor, filter.Actor != ""},
+		{"device = ?", strings.ToUpper(filter.Device), filter.Device != ""},
+		{"action = ?", filter.Action, filter.Action != ""},
+		{"outcome = ?", filter.Outcome, filter.Outcome != ""},
+		{"created_at >= ?", filter.Since, !filter.Since.IsZero()},
+		{"created_at < ?", filter.Until, !filter.Until.IsZero()},
+		{"id < ?", filter.Before, filter.Before > 0},
+	} {
+		if condition.set {
+			conditions = append(conditions, condition.clause)
+			args = append(args, condition.value)
+		}
+	}
+
+	query := `SELECT id, created_at, actor, ip, action, device, outcome, status, request_id FROM audit_log`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.CreatedAt, &entry.Actor, &entry.IP, &entry.Action, &entry.Device,
+			&entry.Outcome, &entry.Status, &entry.RequestID); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
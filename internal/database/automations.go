@@ -0,0 +1,112 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAutomationRuleExists is returned when adding a rule with the name of an existing rule
+var ErrAutomationRuleExists = errors.New("automation rule already exists")
+
+// AutomationRule is a Starlark script run on each event of its trigger type
+type AutomationRule struct {
+	ID        int64     `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Trigger   string    `json:"trigger" db:"trigger"`
+	Script    string    `json:"script" db:"script"`
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+const automationRuleColumns = `id, name, trigger, script, enabled, created_at, updated_at`
+
+// AddAutomationRule stores a rule and returns its ID
+func AddAutomationRule(db DatabaseInterface, rule AutomationRule) (int64, error) {
+	query := `INSERT INTO automation_rules (name, trigger, script, enabled, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO NOTHING
+		RETURNING id`
+
+	var id int64
+	err := db.QueryRow(query, rule.Name, rule.Trigger, rule.Script, rule.Enabled, rule.CreatedAt, rule.UpdatedAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrAutomationRuleExists
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to add automation rule: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetAutomationRules returns every automation rule
+func GetAutomationRules(db DatabaseInterface) ([]AutomationRule, error) {
+	return queryAutomationRules(db, `SELECT `+automationRuleColumns+` FROM automation_rules ORDER BY id`)
+}
+
+// GetAutomationRule returns a rule, or nil when it does not exist
+func GetAutomationRule(db DatabaseInterface, id int64) (*AutomationRule, error) {
+	var rule AutomationRule
+	err := db.QueryRow(`SELECT `+automationRuleColumns+` FROM automation_rules WHERE id = ?`, id).
+		Scan(&rule.ID, &rule.Name, &rule.Trigger, &rule.Script, &rule.Enabled, &rule.CreatedAt, &rule.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get automation rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+// UpdateAutomationRule replaces the trigger, script and enabled flag of a rule. It returns false when
+// the rule does not exist.
+func UpdateAutomationRule(db DatabaseInterface, rule AutomationRule) (bool, error) {
+	query := `UPDATE automation_rules SET trigger = ?, script = ?, enabled = ?, updated_at = ? WHERE id = ?`
+
+	result, err := db.Exec(query, rule.Trigger, rule.Script, rule.Enabled, rule.UpdatedAt, rule.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update automation rule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// DeleteAutomationRule deletes a rule. It returns false when the rule does not exist.
+func DeleteAutomationRule(db DatabaseInterface, id int64) (bool, error) {
+	result, err := db.Exec(`DELETE FROM automation_rules WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete automation rule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func queryAutomationRules(db DatabaseInterface, query string, args ...interface{}) ([]AutomationRule, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get automation rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []AutomationRule{}
+	for rows.Next() {
+		var rule AutomationRule
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.Trigger, &rule.Script, &rule.Enabled, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan automation rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+type BatterySample struct {
+	Adapter    string    `json:"adapter" db:"adapter"`
+	Address    string    `json:"address" db:"address"`
+	Percentage int       `json:"percentage" db:"percentage"`
+	RecordedAt time.Time `json:"recorded_at" db:"recorded_at"`
+}
+
+// InsertBatterySample stores a battery level sample for a device
+func InsertBatterySample(db DatabaseInterface, sample BatterySample) error {
+	query := `INSERT INTO battery_history (adapter, address, percentage, recorded_at) VALUES (?, ?, ?, ?)`
+
+	_, err := db.Exec(query, sample.Adapter, sample.Address, sample.Percentage, sample.RecordedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert battery sample: %w", err)
+	}
+
+	return nil
+}
+
+// GetBatteryHistory returns the battery samples of a device recorded by an adapter since a given time, oldest first
+func GetBatteryHistory(db DatabaseInterface, adapter, address string, since time.Time, limit int) ([]BatterySample, error) {
+	query := `SELECT adapter, address, percentage, recorded_at FROM battery_history
+		WHERE adapter = ? AND address = ? AND recorded_at >= ? ORDER BY recorded_at ASC LIMIT ?`
+
+	rows, err := db.Query(query, adapter, address, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get battery history: %w", err)
+	}
+	defer rows.Close()
+
+	samples := []BatterySample{}
+	for rows.Next() {
+		var sample BatterySample
+		if err := rows.Scan(&sample.Adapter, &sample.Address, &sample.Percentage, &sample.RecordedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan battery sample: %w", err)
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, rows.Err()
+}
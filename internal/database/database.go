@@ -2,21 +2,75 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
-	"github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/nerzhul/home-bt-broker/migrations"
 )
 
-// InitDB initializes the SQLite database connection
-func InitDB() (*sql.DB, error) {
-	dbPath := os.Getenv("DATABASE_PATH")
-	if dbPath == "" {
-		dbPath = "./data.db"
+// SQLite journal modes
+const (
+	JournalModeDelete   = "DELETE"
+	JournalModeTruncate = "TRUNCATE"
+	JournalModePersist  = "PERSIST"
+	JournalModeMemory   = "MEMORY"
+	JournalModeWAL      = "WAL"
+	JournalModeOff      = "OFF"
+)
+
+// JournalModes are the journal modes supported by SQLite
+var JournalModes = []string{JournalModeDelete, JournalModeTruncate, JournalModePersist, JournalModeMemory, JournalModeWAL, JournalModeOff}
+
+// Options configures the SQLite pragmas, which are applied to every connection of the pool
+type Options struct {
+	// JournalMode is one of JournalModes, WAL (default) letting readers run during a write
+	JournalMode string
+	// BusyTimeout is how long a connection waits for a lock held by another one before failing
+	// with "database is locked" (default: 5s)
+	BusyTimeout time.Duration
+	// ForeignKeys enforces the foreign key constraints
+	ForeignKeys bool
+
+	// MaxOpenConns is the size of the connection pool (default: 4). SQLite serializes the writes,
+	// WAL lets the other connections read meanwhile.
+	MaxOpenConns int
+	// MaxIdleConns is how many connections stay open between queries (default: MaxOpenConns), so
+	// that their pragmas and page cache are not set up again
+	MaxIdleConns int
+	// ConnMaxLifetime closes the connections once they are this old, zero keeping them forever
+	ConnMaxLifetime time.Duration
+	// ConnMaxIdleTime closes the connections unused for this long, zero keeping them forever
+	ConnMaxIdleTime time.Duration
+}
+
+// InitDB initializes the SQLite database connection with the default options
+func InitDB(dbPath string) (*sql.DB, error) {
+	return InitDBWithOptions(dbPath, Options{})
+}
+
+// InitDBWithOptions initializes the SQLite database connection with custom options
+func InitDBWithOptions(dbPath string, opts Options) (*sql.DB, error) {
+	if opts.JournalMode == "" {
+		opts.JournalMode = JournalModeWAL
+	}
+	if opts.BusyTimeout == 0 {
+		opts.BusyTimeout = 5 * time.Second
+	}
+	if opts.MaxOpenConns == 0 {
+		opts.MaxOpenConns = 4
+	}
+	if opts.MaxIdleConns == 0 {
+		opts.MaxIdleConns = opts.MaxOpenConns
 	}
 
 	// Create directory if it doesn't exist
@@ -26,10 +80,22 @@ func InitDB() (*sql.DB, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	// Transactions take the write lock when they begin, instead of failing when a read
+	// transaction is upgraded while another connection writes, which the busy timeout cannot wait for
+	params := url.Values{
+		"_journal_mode": {strings.ToUpper(opts.JournalMode)},
+		"_busy_timeout": {strconv.FormatInt(opts.BusyTimeout.Milliseconds(), 10)},
+		"_foreign_keys": {strconv.FormatBool(opts.ForeignKeys)},
+		"_txlock":       {"immediate"},
+	}
+	db, err := sql.Open("sqlite3", dbPath+"?"+params.Encode())
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
+	db.SetMaxOpenConns(opts.MaxOpenConns)
+	db.SetMaxIdleConns(opts.MaxIdleConns)
+	db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
@@ -46,12 +112,13 @@ func RunMigrations(db *sql.DB) error {
 		return fmt.Errorf("failed to create migration driver: %w", err)
 	}
 
-	source, err := (&file.File{}).Open("file://migrations")
+	// Migrations are embedded in the binary
+	source, err := iofs.New(migrations.FS, ".")
 	if err != nil {
 		return fmt.Errorf("failed to open migration source: %w", err)
 	}
 
-	m, err := migrate.NewWithInstance("file", source, "sqlite3", driver)
+	m, err := migrate.NewWithInstance("iofs", source, "sqlite3", driver)
 	if err != nil {
 		return fmt.Errorf("failed to create migration instance: %w", err)
 	}
@@ -61,4 +128,64 @@ func RunMigrations(db *sql.DB) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// SchemaVersion returns the migration version of the database, 0 when it was never migrated, and
+// whether the last migration failed halfway
+func SchemaVersion(db *sql.DB) (uint, bool, error) {
+	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to create migration driver: %w", err)
+	}
+
+	version, dirty, err := driver.Version()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version < 0 {
+		return 0, false, nil
+	}
+	return uint(version), dirty, nil
+}
+
+// LatestSchemaVersion returns the version of the last migration embedded in the binary
+func LatestSchemaVersion() (uint, error) {
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return 0, fmt.Errorf("failed to open migration source: %w", err)
+	}
+	defer source.Close()
+
+	version, err := source.First()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	for {
+		next, err := source.Next(version)
+		if err != nil {
+			return version, nil
+		}
+		version = next
+	}
+}
+
+// ErrNestedTransaction is returned when beginning a transaction inside a Tx
+var ErrNestedTransaction = errors.New("transactions cannot be nested")
+
+// Tx runs the database functions in a transaction, committed or rolled back by its owner
+type Tx struct {
+	*sql.Tx
+}
+
+// Ensure Tx implements the interface
+var _ DatabaseInterface = Tx{}
+
+// Ping does nothing, the connection of the transaction being in use
+func (tx Tx) Ping() error {
+	return nil
+}
+
+// Begin fails, SQLite having no nested transactions
+func (tx Tx) Begin() (*sql.Tx, error) {
+	return nil, ErrNestedTransaction
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitDBWithOptions(t *testing.T) {
+	db, err := InitDBWithOptions(filepath.Join(t.TempDir(), "data.db"), Options{BusyTimeout: 2 * time.Second, ForeignKeys: true})
+	assert.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 4, db.Stats().MaxOpenConnections)
+
+	// The pragmas apply to every connection of the pool, not only the first one
+	conn, err := db.Conn(t.Context())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	var journalMode string
+	var busyTimeout, foreignKeys int
+	assert.NoError(t, db.QueryRow("PRAGMA journal_mode").Scan(&journalMode))
+	assert.NoError(t, db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout))
+	assert.NoError(t, db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys))
+	assert.Equal(t, "wal", journalMode)
+	assert.Equal(t, 2000, busyTimeout)
+	assert.Equal(t, 1, foreignKeys)
+}
+
+func TestInitDBWithOptions_Pool(t *testing.T) {
+	db, err := InitDBWithOptions(filepath.Join(t.TempDir(), "data.db"), Options{MaxOpenConns: 2, MaxIdleConns: 1, ConnMaxLifetime: time.Hour})
+	assert.NoError(t, err)
+	defer db.Close()
+
+	assert.Equal(t, 2, db.Stats().MaxOpenConnections)
+
+	// Only one of the two released connections stays idle
+	first, err := db.Conn(t.Context())
+	assert.NoError(t, err)
+	second, err := db.Conn(t.Context())
+	assert.NoError(t, err)
+	assert.NoError(t, first.Close())
+	assert.NoError(t, second.Close())
+
+	stats := db.Stats()
+	assert.Equal(t, 1, stats.Idle)
+	assert.Equal(t, int64(1), stats.MaxIdleClosed)
+}
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// DeviceOwner records the user who paired a device through the API
+type DeviceOwner struct {
+	Address  string    `json:"address" db:"address"`
+	Owner    string    `json:"owner" db:"owner"`
+	Adapter  string    `json:"adapter" db:"adapter"`
+	PairedAt time.Time `json:"paired_at" db:"paired_at"`
+}
+
+// SetDeviceOwner stores the owner of a device, replacing the previous one when it is paired again. The
+// owner is encrypted with the cipher when it is enabled.
+func SetDeviceOwner(db DatabaseInterface, cipher *secrets.Cipher, owner DeviceOwner) error {
+	query := `INSERT INTO device_owners (address, owner, adapter, paired_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(address) DO UPDATE SET owner = excluded.owner, adapter = excluded.adapter, paired_at = excluded.paired_at`
+
+	username, err := cipher.Encrypt(owner.Owner)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt device owner: %w", err)
+	}
+
+	_, err = db.Exec(query, strings.ToUpper(owner.Address), username, strings.ToUpper(owner.Adapter), owner.PairedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set device owner: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeviceOwner returns the owner of a device, or nil when it was not paired through the API
+func GetDeviceOwner(db DatabaseInterface, cipher *secrets.Cipher, address string) (*DeviceOwner, error) {
+	var owner DeviceOwner
+	err := db.QueryRow(`SELECT address, owner, adapter, paired_at FROM device_owners WHERE address = ?`, strings.ToUpper(address)).
+		Scan(&owner.Address, &owner.Owner, &owner.Adapter, &owner.PairedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get device owner: %w", err)
+	}
+	if owner.Owner, err = cipher.Decrypt(owner.Owner); err != nil {
+		return nil, fmt.Errorf("failed to decrypt device owner: %w", err)
+	}
+
+	return &owner, nil
+}
+
+// GetDeviceOwners returns the owners of the devices, by address
+func GetDeviceOwners(db DatabaseInterface, cipher *secrets.Cipher) (map[string]string, error) {
+	rows, err := db.Query(`SELECT address, owner FROM device_owners`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device owners: %w", err)
+	}
+	defer rows.Close()
+
+	owners := make(map[string]string)
+	for rows.Next() {
+		var address, owner string
+		if err := rows.Scan(&address, &owner); err != nil {
+			return nil, fmt.Errorf("failed to scan device owner: %w", err)
+		}
+		if owners[address], err = cipher.Decrypt(owner); err != nil {
+			return nil, fmt.Errorf("failed to decrypt owner of %s: %w", address, err)
+		}
+	}
+
+	return owners, rows.Err()
+}
+
+// GetOwnedDevices returns the devices a user paired, most recent first. The owners are compared once
+// decrypted, the encrypted ones differing for the same user.
+func GetOwnedDevices(db DatabaseInterface, cipher *secrets.Cipher, username string) ([]DeviceOwner, error) {
+	rows, err := db.Query(`SELECT address, owner, adapter, paired_at FROM device_owners ORDER BY paired_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get owned devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []DeviceOwner{}
+	for rows.Next() {
+		var device DeviceOwner
+		if err := rows.Scan(&device.Address, &device.Owner, &device.Adapter, &device.PairedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan owned device: %w", err)
+		}
+		if device.Owner, err = cipher.Decrypt(device.Owner); err != nil {
+			return nil, fmt.Errorf("failed to decrypt owner of %s: %w", device.Address, err)
+		}
+		if device.Owner == username {
+			devices = append(devices, device)
+		}
+	}
+
+	return devices, rows.Err()
+}
@@ -0,0 +1,82 @@
+package database
+
+import "fmt"
+
+// DevicePurgeSummary counts the rows deleted for a removed device
+type DevicePurgeSummary struct {
+	BatterySamples  int64 `json:"battery_samples"`
+	RSSISamples     int64 `json:"rssi_samples"`
+	RSSITracking    int64 `json:"rssi_tracking"`
+	PresenceDevices int64 `json:"presence_devices"`
+	AudioSettings   int64 `json:"audio_settings"`
+	Reconnect       int64 `json:"reconnect"`
+	GuestTrust      int64 `json:"guest_trust"`
+	Owner           int64 `json:"owner"`
+	KnownDevice     int64 `json:"known_device"`
+}
+
+// PurgeDeviceData deletes every row stored for a device, in a single transaction.
+// Addresses are compared case-insensitively since they are stored as given by API clients.
+func PurgeDeviceData(db DatabaseInterface, address string) (*DevicePurgeSummary, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	summary := &DevicePurgeSummary{}
+	purges := []struct {
+		table string
+		count *int64
+	}{
+		{"battery_history", &summary.BatterySamples},
+		{"rssi_history", &summary.RSSISamples},
+		{"rssi_tracked_devices", &summary.RSSITracking},
+		{"presence_devices", &summary.PresenceDevices},
+		{"device_audio_settings", &summary.AudioSettings},
+		{"device_reconnect", &summary.Reconnect},
+		{"guest_trusts", &summary.GuestTrust},
+		{"device_owners", &summary.Owner},
+		{"known_devices", &summary.KnownDevice},
+	}
+
+	for _, purge := range purges {
+		result, err := tx.Exec(`DELETE FROM `+purge.table+` WHERE address = ? COLLATE NOCASE`, address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to purge %s: %w", purge.table, err)
+		}
+		if *purge.count, err = result.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("failed to get rows affected: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return summary, nil
+}
+
+// MoveDeviceData moves the rows bound to the adapter of a device to another adapter, in a single
+// transaction. The rows keyed by the device address only follow it as they are, and the history
+// samples keep the adapter they were recorded on.
+func MoveDeviceData(db DatabaseInterface, address, adapter string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// A known device already imported for the target adapter is replaced
+	for _, table := range []string{"device_owners", "guest_trusts", "known_devices", "rssi_tracked_devices"} {
+		if _, err := tx.Exec(`UPDATE OR REPLACE `+table+` SET adapter = ? WHERE address = ? COLLATE NOCASE`, adapter, address); err != nil {
+			return fmt.Errorf("failed to move %s: %w", table, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrDiscoverableScheduleExists is returned when adding a schedule with the name of an existing one
+var ErrDiscoverableScheduleExists = errors.New("discoverable schedule already exists")
+
+// DiscoverableSchedule is a recurring window during which an adapter is discoverable. Days are
+// stored as a comma separated list.
+type DiscoverableSchedule struct {
+	ID   int64  `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	// Adapter is the MAC address of the adapter, the first powered one when empty
+	Adapter string   `json:"adapter" db:"adapter"`
+	Days    []string `json:"days" db:"days"`
+	// Start and End are HH:MM times, in the local time of the host
+	Start string `json:"start" db:"start_time"`
+	End   string `json:"end" db:"end_time"`
+	// Pairable also makes the adapter pairable during the window
+	Pairable  bool      `json:"pairable" db:"pairable"`
+	Enabled   bool      `json:"enabled" db:"enabled"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+const discoverableScheduleColumns = `id, name, adapter, days, start_time, end_time, pairable, enabled, created_at, updated_at`
+
+// AddDiscoverableSchedule stores a schedule and returns its ID
+func AddDiscoverableSchedule(db DatabaseInterface, schedule DiscoverableSchedule) (int64, error) {
+	query := `INSERT INTO discoverable_schedules (name, adapter, days, start_time, end_time, pairable, enabled, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(name) DO NOTHING
+		RETURNING id`
+
+	var id int64
+	err := db.QueryRow(query, schedule.Name, schedule.Adapter, strings.Join(schedule.Days, ","), schedule.Start, schedule.End,
+		schedule.Pairable, schedule.Enabled, schedule.CreatedAt, schedule.UpdatedAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrDiscoverableScheduleExists
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to add discoverable schedule: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetDiscoverableSchedules returns every discoverable schedule
+func GetDiscoverableSchedules(db DatabaseInterface) ([]DiscoverableSchedule, error) {
+	return queryDiscoverableSchedules(db, `SELECT `+discoverableScheduleColumns+` FROM discoverable_schedules ORDER BY id`)
+}
+
+// GetEnabledDiscoverableSchedules returns the enabled discoverable schedules
+func GetEnabledDiscoverableSchedules(db DatabaseInterface) ([]DiscoverableSchedule, error) {
+	return queryDiscoverableSchedules(db, `SELECT `+discoverableScheduleColumns+` FROM discoverable_schedules WHERE enabled = 1 ORDER BY id`)
+}
+
+// GetDiscoverableSchedule returns a schedule, or nil when it does not exist
+func GetDiscoverableSchedule(db DatabaseInterface, id int64) (*DiscoverableSchedule, error) {
+	schedule, err := scanDiscoverableSchedule(db.QueryRow(`SELECT `+discoverableScheduleColumns+` FROM discoverable_schedules WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get discoverable schedule: %w", err)
+	}
+
+	return schedule, nil
+}
+
+// UpdateDiscoverableSchedule replaces everything but the name of a schedule. It returns false when
+// the schedule does not exist.
+func UpdateDiscoverableSchedule(db DatabaseInterface, schedule DiscoverableSchedule) (bool, error) {
+	query := `UPDATE discoverable_schedules SET adapter = ?, days = ?, start_time = ?, end_time = ?, pairable = ?, enabled = ?, updated_at = ?
+		WHERE id = ?`
+
+	result, err := db.Exec(query, schedule.Adapter, strings.Join(schedule.Days, ","), schedule.Start, schedule.End,
+		schedule.Pairable, schedule.Enabled, schedule.UpdatedAt, schedule.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update discoverable schedule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// DeleteDiscoverableSchedule deletes a schedule. It returns false when the schedule does not exist.
+func DeleteDiscoverableSchedule(db DatabaseInterface, id int64) (bool, error) {
+	result, err := db.Exec(`DELETE FROM discoverable_schedules WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete discoverable schedule: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func queryDiscoverableSchedules(db DatabaseInterface, query string, args ...interface{}) ([]DiscoverableSchedule, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get discoverable schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []DiscoverableSchedule{}
+	for rows.Next() {
+		schedule, err := scanDiscoverableSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan discoverable schedule: %w", err)
+		}
+		schedules = append(schedules, *schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+func scanDiscoverableSchedule(row interface{ Scan(...interface{}) error }) (*DiscoverableSchedule, error) {
+	var schedule DiscoverableSchedule
+	var days string
+	err := row.Scan(&schedule.ID, &schedule.Name, &schedule.Adapter, &days, &schedule.Start, &schedule.End,
+		&schedule.Pairable, &schedule.Enabled, &schedule.CreatedAt, &schedule.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule.Days = strings.Split(days, ",")
+	return &schedule, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// encryptedColumns are the columns stored encrypted with the cipher when it is enabled. The
+// addresses stay in plaintext, being the lookup keys of their tables.
+var encryptedColumns = []struct{ table, column string }{
+	{"user_tokens", "token"},
+	{"known_devices", "name"},
+	{"pairing_allowlist", "name"},
+	{"device_owners", "owner"},
+	{"guest_trusts", "adapter"},
+	{"webpush_subscriptions", "p256dh"},
+	{"webpush_subscriptions", "auth"},
+}
+
+// ReencryptSecrets decrypts every encrypted column value, token secrets and device metadata, and
+// encrypts it again with the cipher's current key, in a single transaction. When onlyPlaintext is
+// set, values that are already encrypted are left untouched. It returns the number of updated values.
+func ReencryptSecrets(db DatabaseInterface, cipher *secrets.Cipher, onlyPlaintext bool) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	count := 0
+	for _, c := range encryptedColumns {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT rowid, %s FROM %s`, c.column, c.table))
+		if err != nil {
+			return 0, fmt.Errorf("failed to list %s.%s: %w", c.table, c.column, err)
+		}
+
+		stored := map[int64]string{}
+		for rows.Next() {
+			var rowid int64
+			var value string
+			if err := rows.Scan(&rowid, &value); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("failed to scan %s.%s: %w", c.table, c.column, err)
+			}
+			if onlyPlaintext && secrets.IsEncrypted(value) {
+				continue
+			}
+			stored[rowid] = value
+		}
+		rows.Close()
+
+		for rowid, value := range stored {
+			plaintext, err := cipher.Decrypt(value)
+			if err != nil {
+				return 0, fmt.Errorf("failed to decrypt %s.%s of row %d: %w", c.table, c.column, rowid, err)
+			}
+			encrypted, err := cipher.Encrypt(plaintext)
+			if err != nil {
+				return 0, fmt.Errorf("failed to encrypt %s.%s of row %d: %w", c.table, c.column, rowid, err)
+			}
+			query := fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, c.table, c.column)
+			if _, err := tx.Exec(query, encrypted, rowid); err != nil {
+				return 0, fmt.Errorf("failed to update %s.%s of row %d: %w", c.table, c.column, rowid, err)
+			}
+		}
+		count += len(stored)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReencryptSecrets(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "data.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, RunMigrations(db))
+
+	// The values stored before the key was configured are in plaintext
+	now := time.Now()
+	assert.NoError(t, CreateToken(db, nil, "alice", "secret", false))
+	assert.NoError(t, SaveKnownDevices(db, nil, []KnownDevice{{Adapter: "00:1A:7D:DA:71:01", Address: "AA:BB:CC:DD:EE:FF", Name: "Headphones", ImportedAt: now}}))
+	assert.NoError(t, SetDeviceOwner(db, nil, DeviceOwner{Address: "AA:BB:CC:DD:EE:FF", Owner: "alice", Adapter: "00:1A:7D:DA:71:01", PairedAt: now}))
+	assert.NoError(t, AddGuestTrust(db, nil, GuestTrust{Address: "11:22:33:44:55:66", Adapter: "00:1A:7D:DA:71:01", ExpiresAt: now}))
+
+	key, err := secrets.GenerateKey()
+	assert.NoError(t, err)
+	cipher, err := secrets.NewCipher(key)
+	assert.NoError(t, err)
+	assert.NoError(t, SetDeviceOwner(db, cipher, DeviceOwner{Address: "11:22:33:44:55:66", Owner: "bob", Adapter: "00:1A:7D:DA:71:01", PairedAt: now}))
+
+	// Only the plaintext values are encrypted
+	count, err := ReencryptSecrets(db, cipher, true)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	var name, owner string
+	assert.NoError(t, db.QueryRow(`SELECT name FROM known_devices`).Scan(&name))
+	assert.True(t, secrets.IsEncrypted(name))
+	assert.NoError(t, db.QueryRow(`SELECT owner FROM device_owners WHERE address = 'AA:BB:CC:DD:EE:FF'`).Scan(&owner))
+	assert.True(t, secrets.IsEncrypted(owner))
+
+	// The values are decrypted on read
+	devices, err := GetKnownDevices(db, cipher)
+	assert.NoError(t, err)
+	assert.Equal(t, "Headphones", devices[0].Name)
+	trusts, err := GetExpiredGuestTrusts(db, cipher, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, "00:1A:7D:DA:71:01", trusts[0].Adapter)
+	owners, err := GetDeviceOwners(db, cipher)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"AA:BB:CC:DD:EE:FF": "alice", "11:22:33:44:55:66": "bob"}, owners)
+
+	// The owned devices are matched once decrypted
+	owned, err := GetOwnedDevices(db, cipher, "alice")
+	assert.NoError(t, err)
+	assert.Len(t, owned, 1)
+	assert.Equal(t, "AA:BB:CC:DD:EE:FF", owned[0].Address)
+
+	// Encrypted values cannot be read without the key
+	_, err = GetKnownDevices(db, nil)
+	assert.ErrorIs(t, err, secrets.ErrNoKey)
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// GuestTrust is the trust given to a device paired in guest mode, revoked once it expires
+type GuestTrust struct {
+	Address   string    `json:"address" db:"address"`
+	Adapter   string    `json:"adapter" db:"adapter"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// AddGuestTrust stores the expiry of the trust of a device, replacing the previous one. Its adapter is
+// encrypted with the cipher when it is enabled.
+func AddGuestTrust(db DatabaseInterface, cipher *secrets.Cipher, trust GuestTrust) error {
+	query := `INSERT INTO guest_trusts (address, adapter, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(address) DO UPDATE SET adapter = excluded.adapter, expires_at = excluded.expires_at`
+
+	adapter, err := cipher.Encrypt(trust.Adapter)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt guest trust adapter: %w", err)
+	}
+	if _, err := db.Exec(query, trust.Address, adapter, trust.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to add guest trust: %w", err)
+	}
+
+	return nil
+}
+
+// HasGuestTrust reports whether the trust of a device was given in guest mode and expires
+func HasGuestTrust(db DatabaseInterface, address string) (bool, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM guest_trusts WHERE address = ?`, address).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to get guest trust: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// GetExpiredGuestTrusts returns the guest trusts expired at a time
+func GetExpiredGuestTrusts(db DatabaseInterface, cipher *secrets.Cipher, now time.Time) ([]GuestTrust, error) {
+	rows, err := db.Query(`SELECT address, adapter, expires_at FROM guest_trusts WHERE expires_at <= ? ORDER BY expires_at`, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guest trusts: %w", err)
+	}
+	defer rows.Close()
+
+	trusts := []GuestTrust{}
+	for rows.Next() {
+		var trust GuestTrust
+		if err := rows.Scan(&trust.Address, &trust.Adapter, &trust.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan guest trust: %w", err)
+		}
+		if trust.Adapter, err = cipher.Decrypt(trust.Adapter); err != nil {
+			return nil, fmt.Errorf("failed to decrypt guest trust adapter of %s: %w", trust.Address, err)
+		}
+		trusts = append(trusts, trust)
+	}
+
+	return trusts, rows.Err()
+}
+
+// DeleteGuestTrust forgets the trust expiry of a device
+func DeleteGuestTrust(db DatabaseInterface, address string) error {
+	result, err := db.Exec(`DELETE FROM guest_trusts WHERE address = ?`, address)
+	if err != nil {
+		return fmt.Errorf("failed to delete guest trust: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("guest trust of %s not found", address)
+	}
+
+	return nil
+}
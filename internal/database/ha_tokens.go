@@ -0,0 +1,66 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// HATokenMapping maps a Home Assistant long-lived access token to a broker user.
+// Only the SHA-256 hash of the token is stored.
+type HATokenMapping struct {
+	ID        int64     `json:"id" db:"id"`
+	Username  string    `json:"username" db:"username"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AddHATokenMapping stores a token hash mapped to a user and returns the ID of the mapping
+func AddHATokenMapping(db DatabaseInterface, tokenHash string, mapping HATokenMapping) (int64, error) {
+	query := `INSERT INTO ha_tokens (token_hash, username, name, created_at) VALUES (?, ?, ?, ?)`
+
+	result, err := db.Exec(query, tokenHash, mapping.Username, mapping.Name, mapping.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add Home Assistant token: %w", err)
+	}
+
+	return result.LastInsertId()
+}
+
+// GetHATokenMappings returns the Home Assistant token mappings
+func GetHATokenMappings(db DatabaseInterface) ([]HATokenMapping, error) {
+	rows, err := db.Query(`SELECT id, username, name, created_at FROM ha_tokens ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Home Assistant tokens: %w", err)
+	}
+	defer rows.Close()
+
+	mappings := []HATokenMapping{}
+	for rows.Next() {
+		var mapping HATokenMapping
+		if err := rows.Scan(&mapping.ID, &mapping.Username, &mapping.Name, &mapping.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan Home Assistant token: %w", err)
+		}
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, rows.Err()
+}
+
+// DeleteHATokenMapping revokes a Home Assistant token
+func DeleteHATokenMapping(db DatabaseInterface, id int64) error {
+	result, err := db.Exec(`DELETE FROM ha_tokens WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete Home Assistant token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("Home Assistant token %d not found", id)
+	}
+
+	return nil
+}
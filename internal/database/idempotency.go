@@ -0,0 +1,53 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// IdempotentResponse is the response to a request sent with an idempotency key, replayed when
+// the request is retried with the same key
+type IdempotentResponse struct {
+	// Fingerprint identifies the request, so that a key reused for another request is detected
+	Fingerprint string    `json:"fingerprint" db:"fingerprint"`
+	Status      int       `json:"status" db:"status"`
+	ContentType string    `json:"content_type" db:"content_type"`
+	Body        []byte    `json:"body" db:"body"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// SaveIdempotentResponse stores the response to the request of a user with a key, and purges
+// the responses created before expiredBefore
+func SaveIdempotentResponse(db DatabaseInterface, username, key string, resp IdempotentResponse, expiredBefore time.Time) error {
+	if _, err := db.Exec(`DELETE FROM idempotency_keys WHERE created_at < ?`, expiredBefore); err != nil {
+		return fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+
+	query := `INSERT INTO idempotency_keys (username, key, fingerprint, status, content_type, body, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(username, key) DO UPDATE SET fingerprint = excluded.fingerprint, status = excluded.status,
+			content_type = excluded.content_type, body = excluded.body, created_at = excluded.created_at`
+
+	if _, err := db.Exec(query, username, key, resp.Fingerprint, resp.Status, resp.ContentType, resp.Body, resp.CreatedAt); err != nil {
+		return fmt.Errorf("failed to save idempotent response: %w", err)
+	}
+
+	return nil
+}
+
+// GetIdempotentResponse returns the response stored for the request of a user with a key, or nil
+// when there is none created since notBefore
+func GetIdempotentResponse(db DatabaseInterface, username, key string, notBefore time.Time) (*IdempotentResponse, error) {
+	var resp IdempotentResponse
+	err := db.QueryRow(`SELECT fingerprint, status, content_type, body, created_at FROM idempotency_keys
+		WHERE username = ? AND key = ? AND created_at >= ?`, username, key, notBefore).
+		Scan(&resp.Fingerprint, &resp.Status, &resp.ContentType, &resp.Body, &resp.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get idempotent response: %w", err)
+	}
+
+	return &resp, nil
+}
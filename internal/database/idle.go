@@ -0,0 +1,65 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// IdlePolicy disconnects the devices matching its target once they stayed idle for TimeoutMinutes.
+// The target is a device address, or a device group given by its class name such as headphones.
+type IdlePolicy struct {
+	Target         string    `json:"target" db:"target"`
+	TimeoutMinutes int       `json:"timeout_minutes" db:"timeout_minutes"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// SetIdlePolicy stores an idle policy, replacing the previous policy of the same target
+func SetIdlePolicy(db DatabaseInterface, policy IdlePolicy) error {
+	query := `INSERT INTO idle_policies (target, timeout_minutes, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(target) DO UPDATE SET timeout_minutes = excluded.timeout_minutes, updated_at = excluded.updated_at`
+
+	if _, err := db.Exec(query, policy.Target, policy.TimeoutMinutes, policy.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to set idle policy: %w", err)
+	}
+
+	return nil
+}
+
+// GetIdlePolicies returns the idle policies
+func GetIdlePolicies(db DatabaseInterface) ([]IdlePolicy, error) {
+	rows, err := db.Query(`SELECT target, timeout_minutes, updated_at FROM idle_policies ORDER BY target`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idle policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []IdlePolicy{}
+	for rows.Next() {
+		var policy IdlePolicy
+		if err := rows.Scan(&policy.Target, &policy.TimeoutMinutes, &policy.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan idle policy: %w", err)
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
+
+// DeleteIdlePolicy removes the idle policy of a target
+func DeleteIdlePolicy(db DatabaseInterface, target string) error {
+	result, err := db.Exec(`DELETE FROM idle_policies WHERE target = ?`, target)
+	if err != nil {
+		return fmt.Errorf("failed to delete idle policy: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("idle policy for '%s' not found", target)
+	}
+
+	return nil
+}
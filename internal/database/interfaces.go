@@ -8,6 +8,7 @@ type DatabaseInterface interface {
 	QueryRow(query string, args ...interface{}) *sql.Row
 	Query(query string, args ...interface{}) (*sql.Rows, error)
 	Exec(query string, args ...interface{}) (sql.Result, error)
+	Begin() (*sql.Tx, error)
 }
 
 // Ensure *sql.DB implements the interface
@@ -0,0 +1,74 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// KnownDevice is a device an adapter knew before it was paired through the broker, imported from the
+// BlueZ storage
+type KnownDevice struct {
+	Adapter    string     `json:"adapter" db:"adapter"`
+	Address    string     `json:"address" db:"address"`
+	Name       string     `json:"name" db:"name"`
+	Class      uint32     `json:"class,omitempty" db:"class"`
+	Trusted    bool       `json:"trusted" db:"trusted"`
+	Blocked    bool       `json:"blocked" db:"blocked"`
+	HasLinkKey bool       `json:"has_link_key" db:"has_link_key"`
+	LastSeen   *time.Time `json:"last_seen" db:"last_seen"`
+	ImportedAt time.Time  `json:"imported_at" db:"imported_at"`
+}
+
+// SaveKnownDevices stores known devices in a single transaction, replacing the ones already stored.
+// Their names are encrypted with the cipher when it is enabled.
+func SaveKnownDevices(db DatabaseInterface, cipher *secrets.Cipher, devices []KnownDevice) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT OR REPLACE INTO known_devices (adapter, address, name, class, trusted, blocked, has_link_key, last_seen, imported_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	for _, d := range devices {
+		name, err := cipher.Encrypt(d.Name)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt name of known device %s: %w", d.Address, err)
+		}
+		if _, err := tx.Exec(query, d.Adapter, d.Address, name, d.Class, d.Trusted, d.Blocked, d.HasLinkKey, d.LastSeen, d.ImportedAt); err != nil {
+			return fmt.Errorf("failed to save known device %s: %w", d.Address, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetKnownDevices returns the known devices, by adapter and address
+func GetKnownDevices(db DatabaseInterface, cipher *secrets.Cipher) ([]KnownDevice, error) {
+	rows, err := db.Query(`SELECT adapter, address, name, class, trusted, blocked, has_link_key, last_seen, imported_at
+		FROM known_devices ORDER BY adapter, address`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get known devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []KnownDevice{}
+	for rows.Next() {
+		var d KnownDevice
+		if err := rows.Scan(&d.Adapter, &d.Address, &d.Name, &d.Class, &d.Trusted, &d.Blocked, &d.HasLinkKey, &d.LastSeen, &d.ImportedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan known device: %w", err)
+		}
+		if d.Name, err = cipher.Decrypt(d.Name); err != nil {
+			return nil, fmt.Errorf("failed to decrypt name of known device %s: %w", d.Address, err)
+		}
+		devices = append(devices, d)
+	}
+
+	return devices, rows.Err()
+}
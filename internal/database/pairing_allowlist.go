@@ -0,0 +1,93 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+type PairingAllowlistEntry struct {
+	Address   string    `json:"address" db:"address"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AddPairingAllowlistEntry allows a device to pair, replacing any previous entry. Its name is
+// encrypted with the cipher when it is enabled.
+func AddPairingAllowlistEntry(db DatabaseInterface, cipher *secrets.Cipher, entry PairingAllowlistEntry) error {
+	query := `INSERT OR REPLACE INTO pairing_allowlist (address, name, created_at) VALUES (?, ?, ?)`
+
+	name, err := cipher.Encrypt(entry.Name)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt pairing allowlist entry name: %w", err)
+	}
+
+	_, err = db.Exec(query, entry.Address, name, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add pairing allowlist entry: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePairingAllowlistEntry removes a device from the pairing allowlist
+func DeletePairingAllowlistEntry(db DatabaseInterface, address string) error {
+	query := `DELETE FROM pairing_allowlist WHERE address = ?`
+
+	result, err := db.Exec(query, address)
+	if err != nil {
+		return fmt.Errorf("failed to delete pairing allowlist entry: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("device '%s' is not in the pairing allowlist", address)
+	}
+
+	return nil
+}
+
+// GetPairingAllowlist returns the devices allowed to pair
+func GetPairingAllowlist(db DatabaseInterface, cipher *secrets.Cipher) ([]PairingAllowlistEntry, error) {
+	rows, err := db.Query(`SELECT address, name, created_at FROM pairing_allowlist ORDER BY address`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pairing allowlist: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []PairingAllowlistEntry{}
+	for rows.Next() {
+		var entry PairingAllowlistEntry
+		if err := rows.Scan(&entry.Address, &entry.Name, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan pairing allowlist entry: %w", err)
+		}
+		if entry.Name, err = cipher.Decrypt(entry.Name); err != nil {
+			return nil, fmt.Errorf("failed to decrypt pairing allowlist entry name: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// IsPairingAllowed checks if a device is in the pairing allowlist
+func IsPairingAllowed(db DatabaseInterface, address string) (bool, error) {
+	query := `SELECT 1 FROM pairing_allowlist WHERE address = ?`
+
+	var exists int
+	err := db.QueryRow(query, address).Scan(&exists)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check pairing allowlist: %w", err)
+	}
+
+	return true, nil
+}
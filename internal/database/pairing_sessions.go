@@ -0,0 +1,47 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PairingSession lets a guest pair devices on one adapter until it expires, on behalf of the user
+// who created it. Only the SHA-256 hash of its token is stored.
+type PairingSession struct {
+	Username  string    `json:"username" db:"username"`
+	Adapter   string    `json:"adapter" db:"adapter"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// CreatePairingSession stores a pairing session and drops the expired ones
+func CreatePairingSession(db DatabaseInterface, tokenHash string, session PairingSession) error {
+	if _, err := db.Exec(`DELETE FROM pairing_sessions WHERE expires_at < ?`, session.CreatedAt); err != nil {
+		return fmt.Errorf("failed to purge pairing sessions: %w", err)
+	}
+
+	query := `INSERT INTO pairing_sessions (token_hash, username, adapter, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`
+	if _, err := db.Exec(query, tokenHash, session.Username, session.Adapter, session.CreatedAt, session.ExpiresAt); err != nil {
+		return fmt.Errorf("failed to create pairing session: %w", err)
+	}
+
+	return nil
+}
+
+// GetPairingSession returns the pairing session of a token hash, or nil when it does not exist, expired
+// or its user was revoked
+func GetPairingSession(db DatabaseInterface, tokenHash string, now time.Time) (*PairingSession, error) {
+	var session PairingSession
+	err := db.QueryRow(`SELECT s.username, s.adapter, s.created_at, s.expires_at FROM pairing_sessions s
+		JOIN user_tokens t ON t.username = s.username AND t.revoked_at IS NULL
+		WHERE s.token_hash = ? AND s.expires_at > ?`, tokenHash, now).
+		Scan(&session.Username, &session.Adapter, &session.CreatedAt, &session.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get pairing session: %w", err)
+	}
+
+	return &session, nil
+}
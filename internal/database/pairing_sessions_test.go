@@ -0,0 +1,37 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPairingSession(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "data.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, RunMigrations(db))
+
+	now := time.Now()
+	assert.NoError(t, CreateToken(db, nil, "alice", "secret", false))
+	assert.NoError(t, CreatePairingSession(db, "hash", PairingSession{Username: "alice", Adapter: "AA:BB:CC:DD:EE:00", CreatedAt: now, ExpiresAt: now.Add(10 * time.Minute)}))
+
+	session, err := GetPairingSession(db, "hash", now)
+	assert.NoError(t, err)
+	if assert.NotNil(t, session) {
+		assert.Equal(t, "AA:BB:CC:DD:EE:00", session.Adapter)
+	}
+
+	// Expired sessions are not returned
+	session, err = GetPairingSession(db, "hash", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Nil(t, session)
+
+	// Nor are the sessions of a revoked user
+	assert.NoError(t, RevokeToken(db, "alice", "admin"))
+	session, err = GetPairingSession(db, "hash", now)
+	assert.NoError(t, err)
+	assert.Nil(t, session)
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type PresenceDevice struct {
+	Address string `json:"address" db:"address"`
+	Name    string `json:"name" db:"name"`
+	// AwayTimeout overrides the default away timeout when set, in seconds
+	AwayTimeout *int      `json:"away_timeout,omitempty" db:"away_timeout"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// AddPresenceDevice registers a device whose home/away state is tracked, replacing any previous registration
+func AddPresenceDevice(db DatabaseInterface, device PresenceDevice) error {
+	query := `INSERT OR REPLACE INTO presence_devices (address, name, away_timeout, created_at) VALUES (?, ?, ?, ?)`
+
+	_, err := db.Exec(query, device.Address, device.Name, device.AwayTimeout, device.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add presence device: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePresenceDevice stops tracking the presence of a device
+func DeletePresenceDevice(db DatabaseInterface, address string) error {
+	query := `DELETE FROM presence_devices WHERE address = ?`
+
+	result, err := db.Exec(query, address)
+	if err != nil {
+		return fmt.Errorf("failed to delete presence device: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("presence device '%s' not found", address)
+	}
+
+	return nil
+}
+
+// GetPresenceDevices returns all registered presence devices
+func GetPresenceDevices(db DatabaseInterface) ([]PresenceDevice, error) {
+	rows, err := db.Query(`SELECT address, name, away_timeout, created_at FROM presence_devices ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get presence devices: %w", err)
+	}
+	defer rows.Close()
+
+	devices := []PresenceDevice{}
+	for rows.Next() {
+		var device PresenceDevice
+		var awayTimeout sql.NullInt64
+		if err := rows.Scan(&device.Address, &device.Name, &awayTimeout, &device.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan presence device: %w", err)
+		}
+		if awayTimeout.Valid {
+			timeout := int(awayTimeout.Int64)
+			device.AwayTimeout = &timeout
+		}
+		devices = append(devices, device)
+	}
+
+	return devices, rows.Err()
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ReconnectStep connects one profile of a device, after waiting DelayMs milliseconds
+type ReconnectStep struct {
+	// Profile is the UUID of the profile to connect
+	Profile string `json:"profile"`
+	DelayMs int    `json:"delay_ms"`
+}
+
+// DeviceReconnect is the ordered sequence of profiles connected when a device is reconnected.
+// Steps are stored as JSON.
+type DeviceReconnect struct {
+	Address   string          `json:"address" db:"address"`
+	Steps     []ReconnectStep `json:"steps" db:"steps"`
+	UpdatedAt time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// SetDeviceReconnect stores the reconnect sequence of a device, replacing any previous one
+func SetDeviceReconnect(db DatabaseInterface, reconnect DeviceReconnect) error {
+	steps, err := json.Marshal(reconnect.Steps)
+	if err != nil {
+		return fmt.Errorf("failed to encode reconnect steps: %w", err)
+	}
+
+	query := `INSERT INTO device_reconnect (address, steps, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(address) DO UPDATE SET steps = excluded.steps, updated_at = excluded.updated_at`
+	if _, err := db.Exec(query, reconnect.Address, string(steps), reconnect.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to set device reconnect: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeviceReconnect returns the reconnect sequence of a device, or nil if it has none
+func GetDeviceReconnect(db DatabaseInterface, address string) (*DeviceReconnect, error) {
+	row := db.QueryRow(`SELECT address, steps, updated_at FROM device_reconnect WHERE address = ?`, address)
+
+	reconnect, err := scanDeviceReconnect(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get device reconnect: %w", err)
+	}
+
+	return reconnect, nil
+}
+
+// GetDeviceReconnects returns the reconnect sequences of every device
+func GetDeviceReconnects(db DatabaseInterface) ([]DeviceReconnect, error) {
+	rows, err := db.Query(`SELECT address, steps, updated_at FROM device_reconnect ORDER BY address`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device reconnects: %w", err)
+	}
+	defer rows.Close()
+
+	all := []DeviceReconnect{}
+	for rows.Next() {
+		reconnect, err := scanDeviceReconnect(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device reconnect: %w", err)
+		}
+		all = append(all, *reconnect)
+	}
+
+	return all, rows.Err()
+}
+
+// DeleteDeviceReconnect removes the reconnect sequence of a device
+func DeleteDeviceReconnect(db DatabaseInterface, address string) error {
+	result, err := db.Exec(`DELETE FROM device_reconnect WHERE address = ?`, address)
+	if err != nil {
+		return fmt.Errorf("failed to delete device reconnect: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("reconnect sequence for device '%s' not found", address)
+	}
+
+	return nil
+}
+
+func scanDeviceReconnect(row interface{ Scan(...interface{}) error }) (*DeviceReconnect, error) {
+	var reconnect DeviceReconnect
+	var steps string
+	if err := row.Scan(&reconnect.Address, &steps, &reconnect.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	reconnect.Steps = []ReconnectStep{}
+	if err := json.Unmarshal([]byte(steps), &reconnect.Steps); err != nil {
+		return nil, fmt.Errorf("failed to decode reconnect steps: %w", err)
+	}
+	return &reconnect, nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// Tables pruned by the retention job
+const (
+	TableBatteryHistory  = "battery_history"
+	TableRSSIHistory     = "rssi_history"
+	TableSessions        = "sessions"
+	TablePairingSessions = "pairing_sessions"
+	TableIdempotencyKeys = "idempotency_keys"
+	TableAuditLog        = "audit_log"
+)
+
+// prunable are the tables whose rows can be pruned by age, with the column holding their time
+var prunable = map[string]string{
+	TableBatteryHistory:  "recorded_at",
+	TableRSSIHistory:     "recorded_at",
+	TableSessions:        "expires_at",
+	TablePairingSessions: "expires_at",
+	TableIdempotencyKeys: "created_at",
+	TableAuditLog:        "created_at",
+}
+
+// PruneTable deletes the rows of a table whose time is before a given time, and returns how many
+// were deleted. Only the tables known to the retention job can be pruned.
+func PruneTable(db DatabaseInterface, table string, before time.Time) (int64, error) {
+	column, ok := prunable[table]
+	if !ok {
+		return 0, fmt.Errorf("table %s cannot be pruned", table)
+	}
+
+	result, err := db.Exec(`DELETE FROM `+table+` WHERE `+column+` < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune %s: %w", table, err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check pruned rows of %s: %w", table, err)
+	}
+	return count, nil
+}
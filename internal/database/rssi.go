@@ -0,0 +1,109 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type RSSISample struct {
+	Adapter    string    `json:"adapter" db:"adapter"`
+	Address    string    `json:"address" db:"address"`
+	RSSI       int       `json:"rssi" db:"rssi"`
+	RecordedAt time.Time `json:"recorded_at" db:"recorded_at"`
+}
+
+// RSSITrackedDevice is a device whose RSSI is recorded as seen by an adapter
+type RSSITrackedDevice struct {
+	Adapter string
+	Address string
+}
+
+// TrackRSSI enables RSSI recording for a device seen by an adapter. Addresses are stored in upper
+// case, as BlueZ reports them.
+func TrackRSSI(db DatabaseInterface, adapter, address string) error {
+	query := `INSERT OR IGNORE INTO rssi_tracked_devices (adapter, address, created_at) VALUES (?, ?, ?)`
+
+	_, err := db.Exec(query, strings.ToUpper(adapter), strings.ToUpper(address), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to track device RSSI: %w", err)
+	}
+
+	return nil
+}
+
+// UntrackRSSI disables RSSI recording for a device seen by an adapter
+func UntrackRSSI(db DatabaseInterface, adapter, address string) error {
+	query := `DELETE FROM rssi_tracked_devices WHERE adapter = ? AND address = ?`
+
+	result, err := db.Exec(query, strings.ToUpper(adapter), strings.ToUpper(address))
+	if err != nil {
+		return fmt.Errorf("failed to untrack device RSSI: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("device '%s' RSSI is not tracked", address)
+	}
+
+	return nil
+}
+
+// GetTrackedRSSIDevices returns the devices whose RSSI is recorded, with the adapter recording them
+func GetTrackedRSSIDevices(db DatabaseInterface) (map[RSSITrackedDevice]bool, error) {
+	rows, err := db.Query(`SELECT adapter, address FROM rssi_tracked_devices`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracked devices: %w", err)
+	}
+	defer rows.Close()
+
+	tracked := map[RSSITrackedDevice]bool{}
+	for rows.Next() {
+		var device RSSITrackedDevice
+		if err := rows.Scan(&device.Adapter, &device.Address); err != nil {
+			return nil, fmt.Errorf("failed to scan tracked device: %w", err)
+		}
+		tracked[device] = true
+	}
+
+	return tracked, rows.Err()
+}
+
+// InsertRSSISample stores an RSSI sample for a device
+func InsertRSSISample(db DatabaseInterface, sample RSSISample) error {
+	query := `INSERT INTO rssi_history (adapter, address, rssi, recorded_at) VALUES (?, ?, ?, ?)`
+
+	_, err := db.Exec(query, sample.Adapter, sample.Address, sample.RSSI, sample.RecordedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert RSSI sample: %w", err)
+	}
+
+	return nil
+}
+
+// GetRSSIHistory returns the RSSI samples of a device recorded by an adapter since a given time, oldest first
+func GetRSSIHistory(db DatabaseInterface, adapter, address string, since time.Time, limit int) ([]RSSISample, error) {
+	query := `SELECT adapter, address, rssi, recorded_at FROM rssi_history
+		WHERE adapter = ? AND address = ? AND recorded_at >= ? ORDER BY recorded_at ASC LIMIT ?`
+
+	rows, err := db.Query(query, adapter, address, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get RSSI history: %w", err)
+	}
+	defer rows.Close()
+
+	samples := []RSSISample{}
+	for rows.Next() {
+		var sample RSSISample
+		if err := rows.Scan(&sample.Adapter, &sample.Address, &sample.RSSI, &sample.RecordedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan RSSI sample: %w", err)
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, rows.Err()
+}
@@ -0,0 +1,29 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRSSITracking(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "data.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, RunMigrations(db))
+
+	// Addresses are stored as BlueZ reports them, whatever their case in the request
+	assert.NoError(t, TrackRSSI(db, "aa:bb:cc:dd:ee:00", "11:22:33:44:55:ff"))
+	assert.NoError(t, TrackRSSI(db, "AA:BB:CC:DD:EE:00", "11:22:33:44:55:FF"))
+	tracked, err := GetTrackedRSSIDevices(db)
+	assert.NoError(t, err)
+	assert.Equal(t, map[RSSITrackedDevice]bool{{Adapter: "AA:BB:CC:DD:EE:00", Address: "11:22:33:44:55:FF"}: true}, tracked)
+
+	// Tracking is bound to the adapter
+	assert.Error(t, UntrackRSSI(db, "AA:BB:CC:DD:EE:01", "11:22:33:44:55:FF"))
+	assert.NoError(t, UntrackRSSI(db, "AA:BB:CC:DD:EE:00", "11:22:33:44:55:FF"))
+	tracked, err = GetTrackedRSSIDevices(db)
+	assert.NoError(t, err)
+	assert.Empty(t, tracked)
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// QuotaPeriodHour is the period of the hourly request quota of a token
+	QuotaPeriodHour = "hour"
+	// QuotaPeriodDay is the period of the daily request quota of a token
+	QuotaPeriodDay = "day"
+)
+
+// TokenQuota is the number of requests a token may make per hour and per day, 0 meaning unlimited
+type TokenQuota struct {
+	Hourly int `json:"hourly" db:"hourly_quota"`
+	Daily  int `json:"daily" db:"daily_quota"`
+}
+
+// GetTokenQuota returns the request quota of an active token
+func GetTokenQuota(db DatabaseInterface, username string) (TokenQuota, error) {
+	var quota TokenQuota
+	err := db.QueryRow(`SELECT COALESCE(hourly_quota, 0), COALESCE(daily_quota, 0) FROM user_tokens
+		WHERE username = ? AND revoked_at IS NULL`, username).Scan(&quota.Hourly, &quota.Daily)
+	if err == sql.ErrNoRows {
+		return quota, fmt.Errorf("token %s not found", username)
+	} else if err != nil {
+		return quota, fmt.Errorf("failed to get token quota: %w", err)
+	}
+
+	return quota, nil
+}
+
+// SetTokenQuota changes the request quota of an active token
+func SetTokenQuota(db DatabaseInterface, username string, quota TokenQuota) error {
+	result, err := db.Exec(`UPDATE user_tokens SET hourly_quota = NULLIF(?, 0), daily_quota = NULLIF(?, 0)
+		WHERE username = ? AND revoked_at IS NULL`, quota.Hourly, quota.Daily, username)
+	if err != nil {
+		return fmt.Errorf("failed to set token quota: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("token %s not found", username)
+	}
+
+	return nil
+}
+
+// ConsumeTokenQuota counts a request of a token in the window of a quota period starting at
+// windowStart, unless the token already made limit requests in it. It returns the requests made
+// in the window and whether the request was counted.
+func ConsumeTokenQuota(db DatabaseInterface, username, period string, windowStart time.Time, limit int) (int, bool, error) {
+	// The counter restarts when the window changed, and is left alone once it reached the limit
+	query := `INSERT INTO token_quota_usage (username, period, window_start, requests) VALUES (?, ?, ?, 1)
+		ON CONFLICT(username, period) DO UPDATE SET
+			requests = CASE WHEN window_start = excluded.window_start THEN requests + 1 ELSE 1 END,
+			window_start = excluded.window_start
+		WHERE window_start != excluded.window_start OR requests < ?
+		RETURNING requests`
+
+	var requests int
+	err := db.QueryRow(query, username, period, windowStart, limit).Scan(&requests)
+	if err == sql.ErrNoRows {
+		return limit, false, nil
+	} else if err != nil {
+		return 0, false, fmt.Errorf("failed to consume token quota: %w", err)
+	}
+
+	return requests, true, nil
+}
+
+// GetTokenQuotaUsage returns the requests a token made in the window of a quota period starting at windowStart
+func GetTokenQuotaUsage(db DatabaseInterface, username, period string, windowStart time.Time) (int, error) {
+	var requests int
+	err := db.QueryRow(`SELECT requests FROM token_quota_usage WHERE username = ? AND period = ? AND window_start = ?`,
+		username, period, windowStart).Scan(&requests)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get token quota usage: %w", err)
+	}
+
+	return requests, nil
+}
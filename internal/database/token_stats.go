@@ -0,0 +1,52 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// TokenRouteStats counts the requests a token made to a route, such as "GET /api/v1/bluetooth/adapters"
+type TokenRouteStats struct {
+	Route      string    `json:"route" db:"route"`
+	Requests   int64     `json:"requests" db:"requests"`
+	Errors     int64     `json:"errors" db:"errors"`
+	LastUsedAt time.Time `json:"last_used_at" db:"last_used_at"`
+}
+
+// RecordTokenRequest counts a request of a token to a route, failed requests being counted as errors
+func RecordTokenRequest(db DatabaseInterface, username, route string, failed bool, at time.Time) error {
+	var errors int
+	if failed {
+		errors = 1
+	}
+
+	query := `INSERT INTO token_route_stats (username, route, requests, errors, last_used_at) VALUES (?, ?, 1, ?, ?)
+		ON CONFLICT(username, route) DO UPDATE SET requests = requests + 1, errors = errors + excluded.errors, last_used_at = excluded.last_used_at`
+
+	if _, err := db.Exec(query, username, route, errors, at); err != nil {
+		return fmt.Errorf("failed to record token request: %w", err)
+	}
+
+	return nil
+}
+
+// GetTokenRouteStats returns the request counts of a token by route, the most requested route first
+func GetTokenRouteStats(db DatabaseInterface, username string) ([]TokenRouteStats, error) {
+	rows, err := db.Query(`SELECT route, requests, errors, last_used_at FROM token_route_stats
+		WHERE username = ? ORDER BY requests DESC, route`, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []TokenRouteStats{}
+	for rows.Next() {
+		var route TokenRouteStats
+		if err := rows.Scan(&route.Route, &route.Requests, &route.Errors, &route.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan token stats: %w", err)
+		}
+		stats = append(stats, route)
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// GenerateToken returns a random hex-encoded token
+func GenerateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// EnsureBootstrapToken creates an admin token when no token exists yet.
+// If token is empty, a random one is generated. It returns the created token,
+// or an empty string when the database already contains tokens.
+func EnsureBootstrapToken(db *sql.DB, username, token string) (string, error) {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM user_tokens`).Scan(&count); err != nil {
+		return "", fmt.Errorf("failed to count tokens: %w", err)
+	}
+
+	if count > 0 {
+		return "", nil
+	}
+
+	if token == "" {
+		var err error
+		token, err = GenerateToken()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	query := `INSERT INTO user_tokens (username, token, created_at, is_admin) VALUES (?, ?, ?, 1)`
+	if _, err := db.Exec(query, username, token, time.Now()); err != nil {
+		return "", fmt.Errorf("failed to create bootstrap token: %w", err)
+	}
+
+	return token, nil
+}
+
+var (
+	// ErrUsernameExists is returned when creating a token for a username which has one, even revoked
+	ErrUsernameExists = errors.New("username already exists")
+	// ErrTokenNotFound is returned when revoking the token of a username which has none, or a revoked one
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// TokenSummary describes a token without its secret
+type TokenSummary struct {
+	Username   string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	LastIP     *string
+	IsAdmin    bool
+}
+
+// CreateToken stores a new token, encrypted with the cipher when it is enabled. Revoked tokens
+// keep their username until they are restored.
+func CreateToken(db DatabaseInterface, cipher *secrets.Cipher, username, token string, isAdmin bool) error {
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM user_tokens WHERE username = ?`, username).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check username: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s", ErrUsernameExists, username)
+	}
+
+	storedToken, err := cipher.Encrypt(token)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	query := `INSERT INTO user_tokens (username, token, created_at, is_admin) VALUES (?, ?, ?, ?)`
+	if _, err := db.Exec(query, username, storedToken, time.Now(), isAdmin); err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	return nil
+}
+
+// ListTokens returns the tokens which are not revoked, most recent first
+func ListTokens(db DatabaseInterface) ([]TokenSummary, error) {
+	rows, err := db.Query(`SELECT username, created_at, last_used_at, last_ip, is_admin FROM user_tokens
+		WHERE revoked_at IS NULL ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := []TokenSummary{}
+	for rows.Next() {
+		var token TokenSummary
+		if err := rows.Scan(&token.Username, &token.CreatedAt, &token.LastUsedAt, &token.LastIP, &token.IsAdmin); err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeToken revokes the token of a username, it can be restored through the token API
+func RevokeToken(db DatabaseInterface, username, revokedBy string) error {
+	result, err := db.Exec(`UPDATE user_tokens SET revoked_at = ?, revoked_by = ? WHERE username = ? AND revoked_at IS NULL`,
+		time.Now(), revokedBy, username)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s", ErrTokenNotFound, username)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM user_tokens WHERE username = \\?").WithArgs("kitchen").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO user_tokens \\(username, token, created_at, is_admin\\) VALUES \\(\\?, \\?, \\?, \\?\\)").
+		WithArgs("kitchen", "secret", sqlmock.AnyArg(), true).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.NoError(t, CreateToken(db, nil, "kitchen", "secret", true))
+
+	// The username of a token, even revoked, cannot be reused
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM user_tokens WHERE username = \\?").WithArgs("kitchen").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	err = CreateToken(db, nil, "kitchen", "other", false)
+	assert.ErrorIs(t, err, ErrUsernameExists)
+	assert.EqualError(t, err, "username already exists: kitchen")
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM user_tokens WHERE username = \\?").WithArgs("bedroom").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("INSERT INTO user_tokens").WillReturnError(errors.New("disk full"))
+	assert.EqualError(t, CreateToken(db, nil, "bedroom", "secret", false), "failed to create token: disk full")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListTokens(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	createdAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT username, created_at, last_used_at, last_ip, is_admin FROM user_tokens\\s+WHERE revoked_at IS NULL ORDER BY created_at DESC").
+		WillReturnRows(sqlmock.NewRows([]string{"username", "created_at", "last_used_at", "last_ip", "is_admin"}).
+			AddRow("kitchen", createdAt, createdAt.Add(time.Hour), "192.0.2.1", false).
+			AddRow("admin", createdAt, nil, nil, true))
+
+	tokens, err := ListTokens(db)
+	assert.NoError(t, err)
+	if assert.Len(t, tokens, 2) {
+		assert.Equal(t, "kitchen", tokens[0].Username)
+		assert.Equal(t, createdAt.Add(time.Hour), *tokens[0].LastUsedAt)
+		assert.Equal(t, "192.0.2.1", *tokens[0].LastIP)
+		assert.Nil(t, tokens[1].LastUsedAt)
+		assert.True(t, tokens[1].IsAdmin)
+	}
+
+	mock.ExpectQuery("SELECT (.+) FROM user_tokens").WillReturnError(errors.New("database is locked"))
+	_, err = ListTokens(db)
+	assert.EqualError(t, err, "failed to list tokens: database is locked")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE user_tokens SET revoked_at = \\?, revoked_by = \\? WHERE username = \\? AND revoked_at IS NULL").
+		WithArgs(sqlmock.AnyArg(), "admin", "kitchen").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, RevokeToken(db, "kitchen", "admin"))
+
+	// Unknown and already revoked tokens are not found
+	mock.ExpectExec("UPDATE user_tokens SET revoked_at").
+		WithArgs(sqlmock.AnyArg(), "admin", "kitchen").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, RevokeToken(db, "kitchen", "admin"), ErrTokenNotFound)
+
+	mock.ExpectExec("UPDATE user_tokens SET revoked_at").WillReturnError(errors.New("database is locked"))
+	assert.EqualError(t, RevokeToken(db, "kitchen", "admin"), "failed to revoke token: database is locked")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEnsureBootstrapToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing bool
+		token    string
+	}{
+		{name: "empty database"},
+		{name: "explicit token", token: "bootstrap-secret"},
+		{name: "existing admin", existing: true, token: "bootstrap-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := InitDB(filepath.Join(t.TempDir(), "data.db"))
+			assert.NoError(t, err)
+			defer db.Close()
+			assert.NoError(t, RunMigrations(db))
+			if tt.existing {
+				assert.NoError(t, CreateToken(db, nil, "alice", "secret", true))
+			}
+
+			token, err := EnsureBootstrapToken(db, "admin", tt.token)
+			assert.NoError(t, err)
+
+			var count int
+			assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM user_tokens WHERE username = 'admin'`).Scan(&count))
+			if tt.existing {
+				// The database already has a token, no admin is added
+				assert.Empty(t, token)
+				assert.Equal(t, 0, count)
+				return
+			}
+
+			assert.Equal(t, 1, count)
+			if tt.token != "" {
+				assert.Equal(t, tt.token, token)
+			} else {
+				assert.Len(t, token, 64)
+			}
+			var stored string
+			var isAdmin bool
+			assert.NoError(t, db.QueryRow(`SELECT token, is_admin FROM user_tokens WHERE username = 'admin'`).Scan(&stored, &isAdmin))
+			assert.Equal(t, token, stored)
+			assert.True(t, isAdmin)
+
+			// Once created, the bootstrap token is not created again
+			again, err := EnsureBootstrapToken(db, "admin", tt.token)
+			assert.NoError(t, err)
+			assert.Empty(t, again)
+		})
+	}
+}
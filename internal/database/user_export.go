@@ -0,0 +1,129 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// UserExport gathers what the broker stores about a user. Secrets are left out: the token value,
+// the session IDs and the hashes of the Home Assistant and pairing tokens.
+type UserExport struct {
+	Username            string                `json:"username"`
+	ExportedAt          time.Time             `json:"exported_at"`
+	Token               UserTokenRecord       `json:"token"`
+	RouteStats          []TokenRouteStats     `json:"route_stats"`
+	HomeAssistantTokens []HATokenMapping      `json:"home_assistant_tokens"`
+	Sessions            []UserSession         `json:"sessions"`
+	PairingSessions     []PairingSession      `json:"pairing_sessions"`
+	AuditEntries        []AuditEntry          `json:"audit_entries"`
+	OwnedDevices        []DeviceOwner         `json:"owned_devices"`
+	PushSubscriptions   []WebPushSubscription `json:"push_subscriptions"`
+}
+
+// UserTokenRecord is the metadata of the token of a user, revoked or not
+type UserTokenRecord struct {
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at" db:"last_used_at"`
+	LastIP      *string    `json:"last_ip" db:"last_ip"`
+	IsAdmin     bool       `json:"is_admin" db:"is_admin"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	RevokedBy   *string    `json:"revoked_by,omitempty" db:"revoked_by"`
+	HourlyQuota int        `json:"hourly_quota" db:"hourly_quota"`
+	DailyQuota  int        `json:"daily_quota" db:"daily_quota"`
+}
+
+// UserSession is a web UI session of a user
+type UserSession struct {
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// ExportUser returns what the broker stores about a user, or nil when the user has no token
+func ExportUser(db DatabaseInterface, cipher *secrets.Cipher, username string, now time.Time) (*UserExport, error) {
+	export := &UserExport{Username: username, ExportedAt: now}
+	err := db.QueryRow(`SELECT created_at, last_used_at, last_ip, is_admin, revoked_at, revoked_by,
+		COALESCE(hourly_quota, 0), COALESCE(daily_quota, 0) FROM user_tokens WHERE username = ?`, username).
+		Scan(&export.Token.CreatedAt, &export.Token.LastUsedAt, &export.Token.LastIP, &export.Token.IsAdmin,
+			&export.Token.RevokedAt, &export.Token.RevokedBy, &export.Token.HourlyQuota, &export.Token.DailyQuota)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get token of %s: %w", username, err)
+	}
+
+	if export.RouteStats, err = GetTokenRouteStats(db, username); err != nil {
+		return nil, err
+	}
+	if export.AuditEntries, err = GetAuditEntries(db, AuditFilter{Actor: username}); err != nil {
+		return nil, err
+	}
+	if export.OwnedDevices, err = GetOwnedDevices(db, cipher, username); err != nil {
+		return nil, err
+	}
+	if export.PushSubscriptions, err = GetWebPushSubscriptions(db, cipher, username); err != nil {
+		return nil, err
+	}
+
+	export.HomeAssistantTokens = []HATokenMapping{}
+	err = queryRows(db, `SELECT id, username, name, created_at FROM ha_tokens WHERE username = ? ORDER BY id`,
+		[]interface{}{username}, func(rows *sql.Rows) error {
+			var mapping HATokenMapping
+			if err := rows.Scan(&mapping.ID, &mapping.Username, &mapping.Name, &mapping.CreatedAt); err != nil {
+				return err
+			}
+			export.HomeAssistantTokens = append(export.HomeAssistantTokens, mapping)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Home Assistant tokens of %s: %w", username, err)
+	}
+
+	export.Sessions = []UserSession{}
+	err = queryRows(db, `SELECT created_at, expires_at FROM sessions WHERE username = ? ORDER BY created_at`,
+		[]interface{}{username}, func(rows *sql.Rows) error {
+			var session UserSession
+			if err := rows.Scan(&session.CreatedAt, &session.ExpiresAt); err != nil {
+				return err
+			}
+			export.Sessions = append(export.Sessions, session)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions of %s: %w", username, err)
+	}
+
+	export.PairingSessions = []PairingSession{}
+	err = queryRows(db, `SELECT username, adapter, created_at, expires_at FROM pairing_sessions WHERE username = ? ORDER BY created_at`,
+		[]interface{}{username}, func(rows *sql.Rows) error {
+			var session PairingSession
+			if err := rows.Scan(&session.Username, &session.Adapter, &session.CreatedAt, &session.ExpiresAt); err != nil {
+				return err
+			}
+			export.PairingSessions = append(export.PairingSessions, session)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pairing sessions of %s: %w", username, err)
+	}
+
+	return export, nil
+}
+
+// queryRows runs a query and calls scan on each of its rows
+func queryRows(db DatabaseInterface, query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
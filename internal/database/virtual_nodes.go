@@ -0,0 +1,68 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// VirtualNode is a PipeWire node owned by the broker, such as a null sink receiving announcements
+type VirtualNode struct {
+	Name        string `json:"name" db:"name"`
+	Type        string `json:"type" db:"type"`
+	Description string `json:"description" db:"description"`
+	// Target is the node a loopback plays to, the default sink when empty
+	Target    string    `json:"target" db:"target"`
+	Channels  int       `json:"channels" db:"channels"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AddVirtualNode stores a virtual node
+func AddVirtualNode(db DatabaseInterface, node VirtualNode) error {
+	query := `INSERT INTO virtual_nodes (name, type, description, target, channels, created_at) VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err := db.Exec(query, node.Name, node.Type, node.Description, node.Target, node.Channels, node.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add virtual node: %w", err)
+	}
+
+	return nil
+}
+
+// GetVirtualNodes returns the virtual nodes
+func GetVirtualNodes(db DatabaseInterface) ([]VirtualNode, error) {
+	rows, err := db.Query(`SELECT name, type, description, target, channels, created_at FROM virtual_nodes ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get virtual nodes: %w", err)
+	}
+	defer rows.Close()
+
+	nodes := []VirtualNode{}
+	for rows.Next() {
+		var node VirtualNode
+		if err := rows.Scan(&node.Name, &node.Type, &node.Description, &node.Target, &node.Channels, &node.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan virtual node: %w", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, rows.Err()
+}
+
+// DeleteVirtualNode removes a virtual node
+func DeleteVirtualNode(db DatabaseInterface, name string) error {
+	result, err := db.Exec(`DELETE FROM virtual_nodes WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete virtual node: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("virtual node '%s' not found", name)
+	}
+
+	return nil
+}
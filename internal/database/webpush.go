@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// ErrWebPushEndpointTaken is returned when subscribing with the endpoint of a subscription of
+// another user
+var ErrWebPushEndpointTaken = errors.New("push endpoint is subscribed by another user")
+
+// WebPushSubscription is the push subscription of a browser of a user. The keys are base64url encoded,
+// as sent by the browser.
+type WebPushSubscription struct {
+	ID        int64     `json:"id" db:"id"`
+	Username  string    `json:"username" db:"username"`
+	Endpoint  string    `json:"endpoint" db:"endpoint"`
+	P256dh    string    `json:"-" db:"p256dh"`
+	Auth      string    `json:"-" db:"auth"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AddWebPushSubscription stores a push subscription and returns its ID. Subscribing again with the same
+// endpoint replaces the keys of the subscription, unless it belongs to another user. The keys are
+// encrypted with the cipher when it is enabled.
+func AddWebPushSubscription(db DatabaseInterface, cipher *secrets.Cipher, sub WebPushSubscription) (int64, error) {
+	query := `INSERT INTO webpush_subscriptions (username, endpoint, p256dh, auth, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(endpoint) DO UPDATE SET p256dh = excluded.p256dh, auth = excluded.auth,
+		created_at = excluded.created_at
+		WHERE webpush_subscriptions.username = excluded.username
+		RETURNING id`
+
+	p256dh, err := cipher.Encrypt(sub.P256dh)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encrypt push subscription key: %w", err)
+	}
+	auth, err := cipher.Encrypt(sub.Auth)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encrypt push subscription secret: %w", err)
+	}
+
+	var id int64
+	err = db.QueryRow(query, sub.Username, sub.Endpoint, p256dh, auth, sub.CreatedAt).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrWebPushEndpointTaken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to add push subscription: %w", err)
+	}
+
+	return id, nil
+}
+
+// GetWebPushSubscriptions returns the push subscriptions of a user, or of every user when username is empty
+func GetWebPushSubscriptions(db DatabaseInterface, cipher *secrets.Cipher, username string) ([]WebPushSubscription, error) {
+	query := `SELECT id, username, endpoint, p256dh, auth, created_at FROM webpush_subscriptions`
+	var args []interface{}
+	if username != "" {
+		query += ` WHERE username = ?`
+		args = append(args, username)
+	}
+	query += ` ORDER BY id`
+
+	return queryWebPushSubscriptions(db, cipher, query, args...)
+}
+
+// GetActiveWebPushSubscriptions returns the push subscriptions of the users whose token is not revoked
+func GetActiveWebPushSubscriptions(db DatabaseInterface, cipher *secrets.Cipher) ([]WebPushSubscription, error) {
+	query := `SELECT s.id, s.username, s.endpoint, s.p256dh, s.auth, s.created_at FROM webpush_subscriptions s
+		JOIN user_tokens t ON t.username = s.username AND t.revoked_at IS NULL
+		ORDER BY s.id`
+
+	return queryWebPushSubscriptions(db, cipher, query)
+}
+
+// queryWebPushSubscriptions returns the push subscriptions selected by a query
+func queryWebPushSubscriptions(db DatabaseInterface, cipher *secrets.Cipher, query string, args ...interface{}) ([]WebPushSubscription, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get push subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []WebPushSubscription{}
+	for rows.Next() {
+		var sub WebPushSubscription
+		if err := rows.Scan(&sub.ID, &sub.Username, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan push subscription: %w", err)
+		}
+		if sub.P256dh, err = cipher.Decrypt(sub.P256dh); err != nil {
+			return nil, fmt.Errorf("failed to decrypt key of push subscription %d: %w", sub.ID, err)
+		}
+		if sub.Auth, err = cipher.Decrypt(sub.Auth); err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret of push subscription %d: %w", sub.ID, err)
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, rows.Err()
+}
+
+// DeleteWebPushSubscription deletes a push subscription. When username is not empty, only a
+// subscription of this user is deleted. It returns false when no subscription was deleted.
+func DeleteWebPushSubscription(db DatabaseInterface, id int64, username string) (bool, error) {
+	query := `DELETE FROM webpush_subscriptions WHERE id = ?`
+	args := []interface{}{id}
+	if username != "" {
+		query += ` AND username = ?`
+		args = append(args, username)
+	}
+
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete push subscription: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
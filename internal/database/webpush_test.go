@@ -0,0 +1,51 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebPushSubscriptions(t *testing.T) {
+	db, err := InitDB(filepath.Join(t.TempDir(), "data.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, RunMigrations(db))
+
+	assert.NoError(t, CreateToken(db, nil, "alice", "secret", false))
+	assert.NoError(t, CreateToken(db, nil, "bob", "secret", false))
+	sub := WebPushSubscription{Username: "alice", Endpoint: "https://push.example.com/abc", P256dh: "key", Auth: "auth", CreatedAt: time.Now()}
+	id, err := AddWebPushSubscription(db, nil, sub)
+	assert.NoError(t, err)
+
+	// Subscribing again replaces the keys
+	sub.P256dh = "new-key"
+	again, err := AddWebPushSubscription(db, nil, sub)
+	assert.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	// Another user cannot take the endpoint over
+	_, err = AddWebPushSubscription(db, nil, WebPushSubscription{Username: "bob", Endpoint: sub.Endpoint, P256dh: "bob-key", Auth: "auth", CreatedAt: time.Now()})
+	assert.ErrorIs(t, err, ErrWebPushEndpointTaken)
+	subs, err := GetWebPushSubscriptions(db, nil, "")
+	assert.NoError(t, err)
+	if assert.Len(t, subs, 1) {
+		assert.Equal(t, "alice", subs[0].Username)
+		assert.Equal(t, "new-key", subs[0].P256dh)
+	}
+
+	active, err := GetActiveWebPushSubscriptions(db, nil)
+	assert.NoError(t, err)
+	assert.Len(t, active, 1)
+
+	// The subscriptions of a revoked user are kept but not notified
+	assert.NoError(t, RevokeToken(db, "alice", "admin"))
+	active, err = GetActiveWebPushSubscriptions(db, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, active)
+	subs, err = GetWebPushSubscriptions(db, nil, "alice")
+	assert.NoError(t, err)
+	assert.Len(t, subs, 1)
+}
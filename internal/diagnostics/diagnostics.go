@@ -0,0 +1,150 @@
+// Package diagnostics builds the support bundle attached to bug reports: the adapters and devices,
+// the recent events and logs, the configuration with its secrets redacted, and the versions of the
+// software the broker relies on
+package diagnostics
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/config"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/logging"
+)
+
+// versionTimeout bounds each of the commands reporting a version
+const versionTimeout = 5 * time.Second
+
+// Bundle collects the diagnostics of the broker
+type Bundle struct {
+	btManager bluetooth.BluetoothManagerInterface
+	cfg       *config.Config
+	recorder  *events.Recorder
+	logs      *logging.Ring
+	// run runs a command and returns its output
+	run func(ctx context.Context, name string, args ...string) (string, error)
+	now func() time.Time
+}
+
+// NewBundle creates a bundle of the diagnostics of the broker
+func NewBundle(btManager bluetooth.BluetoothManagerInterface, cfg *config.Config, recorder *events.Recorder, logs *logging.Ring) *Bundle {
+	return &Bundle{
+		btManager: btManager,
+		cfg:       cfg,
+		recorder:  recorder,
+		logs:      logs,
+		run:       runCommand,
+		now:       time.Now,
+	}
+}
+
+// Write writes the bundle as a gzipped tarball. A part which cannot be collected holds the error
+// instead, so that the rest of the bundle is still useful.
+func (b *Bundle) Write(ctx context.Context, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := b.now()
+
+	adapters, err := b.btManager.GetAdapters()
+	if err != nil {
+		err = addJSON(tw, "adapters.json", failure(err), now)
+	} else {
+		err = addJSON(tw, "adapters.json", adapters, now)
+	}
+	if err != nil {
+		return err
+	}
+
+	devices := make(map[string]interface{})
+	for _, adapter := range adapters {
+		list, err := b.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			devices[adapter.Address] = failure(err)
+		} else {
+			devices[adapter.Address] = list
+		}
+	}
+	if err := addJSON(tw, "devices.json", devices, now); err != nil {
+		return err
+	}
+	if err := addJSON(tw, "events.json", b.recorder.Events(), now); err != nil {
+		return err
+	}
+	if err := addJSON(tw, "config.json", b.cfg.Redacted(), now); err != nil {
+		return err
+	}
+	if err := addJSON(tw, "versions.json", b.Versions(ctx), now); err != nil {
+		return err
+	}
+	logs := strings.Join(b.logs.Lines(), "\n") + "\n"
+	if err := addFile(tw, "broker.log", []byte(logs), now); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Versions returns the versions of the broker runtime, BlueZ, PipeWire and the kernel. A version
+// which cannot be found holds the reason instead.
+func (b *Bundle) Versions(ctx context.Context) map[string]string {
+	versions := map[string]string{"go": runtime.Version()}
+	version := func(name string, args ...string) string {
+		ctx, cancel := context.WithTimeout(ctx, versionTimeout)
+		defer cancel()
+		out, err := b.run(ctx, name, args...)
+		if err != nil {
+			return "unknown: " + err.Error()
+		}
+		return strings.TrimSpace(out)
+	}
+	versions["bluez"] = version("bluetoothd", "--version")
+	versions["pipewire"] = version("pipewire", "--version")
+	if release, err := os.ReadFile("/proc/sys/kernel/osrelease"); err == nil {
+		versions["kernel"] = strings.TrimSpace(string(release))
+	} else {
+		versions["kernel"] = version("uname", "-r")
+	}
+	return versions
+}
+
+// failure is the content of a part which cannot be collected
+func failure(err error) map[string]string {
+	return map[string]string{"error": err.Error()}
+}
+
+func addJSON(tw *tar.Writer, name string, v interface{}, modTime time.Time) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+	return addFile(tw, name, append(data, '\n'), modTime)
+}
+
+func addFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), ModTime: modTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	return nil
+}
+
+func runCommand(ctx context.Context, name string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	return string(out), err
+}
@@ -0,0 +1,69 @@
+package diagnostics
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/config"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundle_Write(t *testing.T) {
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true},
+		{Path: "/org/bluez/hci1", Address: "00:1A:7D:DA:71:02"},
+	}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Name: "Speaker"}}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci1").Return(nil, errors.New("adapter is powered off"))
+
+	recorder := events.NewRecorder(10)
+	recorder.Record(events.Event{Type: "device_connected", Data: "AA:BB:CC:DD:EE:FF"})
+	logs := logging.NewRing(10)
+	_, _ = logs.Write([]byte("Starting server on port 8080\n"))
+
+	b := NewBundle(btManager, &config.Config{Port: "8080", BootstrapToken: "secret"}, recorder, logs)
+	b.run = func(_ context.Context, name string, _ ...string) (string, error) {
+		if name == "bluetoothd" {
+			return "5.72\n", nil
+		}
+		return "", errors.New("executable file not found in $PATH")
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, b.Write(context.Background(), &buf))
+
+	gz, err := gzip.NewReader(&buf)
+	assert.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		assert.NoError(t, err)
+		files[header.Name] = string(data)
+	}
+
+	assert.Len(t, files, 6)
+	assert.Contains(t, files["adapters.json"], `"address": "00:1A:7D:DA:71:01"`)
+	assert.Contains(t, files["devices.json"], `"name": "Speaker"`)
+	assert.Contains(t, files["devices.json"], `"error": "adapter is powered off"`)
+	assert.Contains(t, files["events.json"], `"type": "device_connected"`)
+	assert.Contains(t, files["config.json"], `"BOOTSTRAP_TOKEN": "REDACTED"`)
+	assert.NotContains(t, files["config.json"], "secret")
+	assert.Contains(t, files["versions.json"], `"bluez": "5.72"`)
+	assert.Contains(t, files["versions.json"], `"pipewire": "unknown: executable file not found in $PATH"`)
+	assert.Equal(t, "Starting server on port 8080\n", files["broker.log"])
+}
@@ -0,0 +1,98 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// subscriberBuffer is the number of events buffered per subscriber before events are dropped
+	subscriberBuffer = 64
+)
+
+// Event is a notification emitted by the broker
+type Event struct {
+	Type      string      `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+	// Internal events are only delivered to the subscribers asking for their type
+	Internal bool `json:"-"`
+}
+
+// Hub is the event bus of the broker: subsystems publish what happens on it, and the event
+// streams, the MQTT bridge, the webhook, the notifiers and the audit logger consume it, without
+// knowing about each other
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[chan Event]map[string]bool
+}
+
+// NewHub creates a new event hub
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[chan Event]map[string]bool),
+	}
+}
+
+// Publish sends an event to every subscriber. Slow subscribers whose buffer is full miss the event.
+func (h *Hub) Publish(eventType string, data interface{}) {
+	h.publish(Event{Type: eventType, Timestamp: time.Now(), Data: data})
+}
+
+// PublishInternal sends an event to the subscribers of its type only. It suits the frequent events
+// consumed inside the broker, such as every authenticated request, which are not forwarded to the
+// event streams, MQTT and the webhook.
+func (h *Hub) PublishInternal(eventType string, data interface{}) {
+	h.publish(Event{Type: eventType, Timestamp: time.Now(), Data: data, Internal: true})
+}
+
+func (h *Hub) publish(event Event) {
+	if h == nil {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch, types := range h.subscribers {
+		if (types == nil && event.Internal) || (types != nil && !types[event.Type]) {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe registers a subscriber to every event but the internal ones. The returned function must
+// be called to unsubscribe.
+func (h *Hub) Subscribe() (<-chan Event, func()) {
+	return h.subscribe(nil)
+}
+
+// SubscribeTypes registers a subscriber to the events of the given types, internal or not, so that
+// the other events do not fill its buffer. The returned function must be called to unsubscribe.
+func (h *Hub) SubscribeTypes(eventTypes ...string) (<-chan Event, func()) {
+	types := make(map[string]bool, len(eventTypes))
+	for _, eventType := range eventTypes {
+		types[eventType] = true
+	}
+	return h.subscribe(types)
+}
+
+func (h *Hub) subscribe(types map[string]bool) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	h.subscribers[ch] = types
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subscribers[ch]; ok {
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub_SubscribeTypes(t *testing.T) {
+	hub := NewHub()
+	all, unsubscribeAll := hub.Subscribe()
+	defer unsubscribeAll()
+	connected, unsubscribeConnected := hub.SubscribeTypes("device_connected", "token_used")
+	defer unsubscribeConnected()
+
+	hub.Publish("device_found", "AA:BB:CC:DD:EE:FF")
+	hub.Publish("device_connected", "AA:BB:CC:DD:EE:FF")
+	hub.PublishInternal("token_used", "kitchen")
+
+	// Internal events only reach the subscribers of their type
+	assert.Equal(t, "device_found", (<-all).Type)
+	assert.Equal(t, "device_connected", (<-all).Type)
+	assert.Empty(t, all)
+
+	assert.Equal(t, "device_connected", (<-connected).Type)
+	event := <-connected
+	assert.Equal(t, "token_used", event.Type)
+	assert.True(t, event.Internal)
+	assert.Empty(t, connected)
+}
+
+func TestRecorder_Record(t *testing.T) {
+	r := NewRecorder(2)
+	r.Record(Event{Type: "device_found"})
+	r.Record(Event{Type: "device_connected"})
+	r.Record(Event{Type: "device_disconnected"})
+
+	recorded := r.Events()
+	assert.Len(t, recorded, 2)
+	assert.Equal(t, "device_connected", recorded[0].Type)
+	assert.Equal(t, "device_disconnected", recorded[1].Type)
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"context"
+	"sync"
+)
+
+// Recorder keeps the most recent events published on a hub, for the diagnostics
+type Recorder struct {
+	mu     sync.Mutex
+	size   int
+	events []Event
+}
+
+// NewRecorder creates a recorder keeping the last size events
+func NewRecorder(size int) *Recorder {
+	return &Recorder{size: size}
+}
+
+// Run records the events published on the hub until the context is cancelled. Internal events are
+// not recorded.
+func (r *Recorder) Run(ctx context.Context, hub *Hub) {
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			r.Record(event)
+		}
+	}
+}
+
+// Record adds an event, dropping the oldest one once the recorder is full
+func (r *Recorder) Record(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.events) == r.size {
+		r.events = append(r.events[:0], r.events[1:]...)
+	}
+	r.events = append(r.events, event)
+}
+
+// Events returns the recorded events, oldest first
+func (r *Recorder) Events() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event{}, r.events...)
+}
@@ -0,0 +1,70 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Webhook posts every event published on a hub to an HTTP endpoint
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook creates a new webhook sender
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run forwards events from the hub until the context is cancelled
+func (w *Webhook) Run(ctx context.Context, hub *Hub) {
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := w.Send(ctx, event); err != nil {
+				log.Printf("Webhook: failed to send %s event: %v", event.Type, err)
+			}
+		}
+	}
+}
+
+// Send posts a single event as JSON
+func (w *Webhook) Send(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post event: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+// Package guest opens time-boxed pairing windows, so that visitors can pair their phone without an
+// account: the adapter is discoverable and pairable until the window ends, and the devices paired
+// meanwhile are trusted, optionally for a limited time
+package guest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+const (
+	// EventGuestModeStarted is published when a guest pairing window opens
+	EventGuestModeStarted = "guest_mode_started"
+	// EventGuestModeEnded is published when a guest pairing window closes and the adapter is restored
+	EventGuestModeEnded = "guest_mode_ended"
+	// EventGuestDeviceTrusted is published when a device paired during the window is trusted
+	EventGuestDeviceTrusted = "guest_device_trusted"
+	// EventGuestTrustExpired is published when the trust of a guest device is revoked
+	EventGuestTrustExpired = "guest_trust_expired"
+)
+
+var (
+	// ErrActive is returned when a window is opened while another one is running
+	ErrActive = errors.New("guest mode is already active")
+	// ErrInactive is returned when no window is running
+	ErrInactive = errors.New("guest mode is not active")
+	// ErrNoAdapter is returned when the adapter of a window cannot be found
+	ErrNoAdapter = errors.New("adapter not found")
+)
+
+// Status describes the running window
+type Status struct {
+	Active    bool       `json:"active"`
+	Adapter   string     `json:"adapter,omitempty"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	EndsAt    *time.Time `json:"ends_at,omitempty"`
+	// TrustMinutes is how long the devices paired during the window stay trusted, 0 meaning forever
+	TrustMinutes int `json:"trust_minutes"`
+	// Devices are the addresses of the devices paired during the window
+	Devices []string `json:"devices"`
+}
+
+// GuestDevice is the payload of the guest device events
+type GuestDevice struct {
+	Address   string     `json:"address"`
+	Adapter   string     `json:"adapter"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// window is a running guest pairing window
+type window struct {
+	adapterPath string
+	adapter     string
+	startedAt   time.Time
+	endsAt      time.Time
+	trustFor    time.Duration
+	// known are the devices paired before the window, by address
+	known   map[string]bool
+	devices []string
+}
+
+// Mode runs the guest pairing windows and revokes the guest trusts once they expire. The states of
+// the adapter go through the visibility arbiter, shared with the discoverable schedules, which
+// restores them once the windows of both closed.
+type Mode struct {
+	btManager  bluetooth.BluetoothManagerInterface
+	db         database.DatabaseInterface
+	cipher     *secrets.Cipher
+	visibility *bluetooth.Visibility
+	interval   time.Duration
+	now        func() time.Time
+
+	mu     sync.Mutex
+	window *window
+}
+
+// NewMode creates a new guest mode, checking the paired devices and the expired trusts at every
+// interval. The guest trusts are encrypted with the cipher when it is enabled.
+func NewMode(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, cipher *secrets.Cipher, visibility *bluetooth.Visibility, interval time.Duration) *Mode {
+	return &Mode{
+		btManager:  btManager,
+		db:         db,
+		cipher:     cipher,
+		visibility: visibility,
+		interval:   interval,
+		now:        time.Now,
+	}
+}
+
+// Start makes an adapter, by default the first powered one, discoverable and pairable for a
+// duration. The devices paired meanwhile are trusted for trustFor, or forever when it is zero.
+func (m *Mode) Start(adapterAddress string, duration, trustFor time.Duration, hub *events.Hub) (Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.window != nil {
+		return Status{}, ErrActive
+	}
+
+	adapter, err := m.findAdapter(adapterAddress)
+	if err != nil {
+		return Status{}, err
+	}
+	devices, err := m.btManager.GetDevices(adapter.Path)
+	if err != nil {
+		return Status{}, err
+	}
+
+	w := &window{
+		adapterPath: adapter.Path,
+		adapter:     adapter.Address,
+		startedAt:   m.now(),
+		trustFor:    trustFor,
+		known:       make(map[string]bool),
+		devices:     []string{},
+	}
+	w.endsAt = w.startedAt.Add(duration)
+	for _, device := range devices {
+		if device.Paired {
+			w.known[device.Address] = true
+		}
+	}
+
+	if err := m.visibility.Open(bluetooth.VisibilityGuest, *adapter, true); err != nil {
+		m.restore(w)
+		return Status{}, err
+	}
+
+	m.window = w
+	log.Printf("Guest mode: adapter %s discoverable and pairable until %s", w.adapter, w.endsAt.Format(time.RFC3339))
+	status := w.status()
+	hub.Publish(EventGuestModeStarted, status)
+	return status, nil
+}
+
+// Stop closes the running window before its end
+func (m *Mode) Stop(hub *events.Hub) (Status, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.window == nil {
+		return Status{}, ErrInactive
+	}
+	return m.end(hub), nil
+}
+
+// Status returns the state of the running window
+func (m *Mode) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.window == nil {
+		return Status{Devices: []string{}}
+	}
+	return m.window.status()
+}
+
+// Active reports whether a window is running
+func (m *Mode) Active() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.window != nil
+}
+
+// Run checks the window and the guest trusts at every interval until the context is cancelled,
+// then closes the running window
+func (m *Mode) Run(ctx context.Context, hub *events.Hub) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.Stop(hub)
+			return
+		case <-ticker.C:
+			m.Check(hub)
+		}
+	}
+}
+
+// Check trusts the devices paired since the last check, closes the window once it ended and
+// revokes the expired guest trusts
+func (m *Mode) Check(hub *events.Hub) {
+	m.mu.Lock()
+	if m.window != nil {
+		m.trustNewDevices(hub)
+		if !m.now().Before(m.window.endsAt) {
+			m.end(hub)
+		} else {
+			m.keepOpen()
+		}
+	}
+	m.mu.Unlock()
+
+	m.revokeExpired(hub)
+}
+
+// trustNewDevices trusts the devices of the window adapter paired since it opened
+func (m *Mode) trustNewDevices(hub *events.Hub) {
+	w := m.window
+	devices, err := m.btManager.GetDevices(w.adapterPath)
+	if err != nil {
+		log.Printf("Guest mode: failed to get devices of adapter %s: %v", w.adapter, err)
+		return
+	}
+
+	for _, device := range devices {
+		if !device.Paired || w.known[device.Address] {
+			continue
+		}
+		if !device.Trusted {
+			if err := m.btManager.TrustDevice(w.adapterPath, device.Address); err != nil {
+				log.Printf("Guest mode: failed to trust %s: %v", device.Address, err)
+				continue
+			}
+		}
+
+		event := GuestDevice{Address: device.Address, Adapter: w.adapter}
+		if w.trustFor > 0 {
+			expiresAt := m.now().Add(w.trustFor)
+			trust := database.GuestTrust{Address: device.Address, Adapter: w.adapter, ExpiresAt: expiresAt}
+			if err := database.AddGuestTrust(m.db, m.cipher, trust); err != nil {
+				// Trying again on the next check keeps the trust from outliving its expiry
+				log.Printf("Guest mode: %v", err)
+				continue
+			}
+			event.ExpiresAt = &expiresAt
+		}
+
+		w.known[device.Address] = true
+		w.devices = append(w.devices, device.Address)
+		log.Printf("Guest mode: trusted %s paired on adapter %s", device.Address, w.adapter)
+		hub.Publish(EventGuestDeviceTrusted, event)
+	}
+}
+
+// keepOpen makes the adapter discoverable and pairable again when bluetoothd turned them off
+// during the window, e.g. once its DiscoverableTimeout elapsed
+func (m *Mode) keepOpen() {
+	w := m.window
+	adapters, err := m.btManager.GetAdapters()
+	if err != nil {
+		return
+	}
+	for _, adapter := range adapters {
+		if adapter.Path != w.adapterPath {
+			continue
+		}
+		if err := m.visibility.Open(bluetooth.VisibilityGuest, adapter, true); err != nil {
+			log.Printf("Guest mode: %v", err)
+		}
+	}
+}
+
+// end closes the running window and restores the adapter
+func (m *Mode) end(hub *events.Hub) Status {
+	w := m.window
+	m.window = nil
+	m.restore(w)
+
+	log.Printf("Guest mode: ended on adapter %s, %d device(s) paired", w.adapter, len(w.devices))
+	status := w.status()
+	status.Active = false
+	hub.Publish(EventGuestModeEnded, status)
+	return status
+}
+
+// restore puts the discoverable and pairable states of the adapter back as they were before the
+// window, unless a discoverable schedule keeps it open
+func (m *Mode) restore(w *window) {
+	if err := m.visibility.Close(bluetooth.VisibilityGuest, w.adapterPath); err != nil {
+		log.Printf("Guest mode: failed to restore adapter %s: %v", w.adapter, err)
+	}
+}
+
+// revokeExpired untrusts the guest devices whose trust expired. A trust failing to be revoked is
+// kept and tried again on the next check.
+func (m *Mode) revokeExpired(hub *events.Hub) {
+	trusts, err := database.GetExpiredGuestTrusts(m.db, m.cipher, m.now())
+	if err != nil {
+		log.Printf("Guest mode: %v", err)
+		return
+	}
+
+	for _, trust := range trusts {
+		adapterPath, err := m.btManager.GetAdapterPathByMAC(trust.Adapter)
+		if err != nil {
+			log.Printf("Guest mode: failed to untrust %s: %v", trust.Address, err)
+			continue
+		}
+		if err := m.btManager.UntrustDevice(adapterPath, trust.Address); err != nil {
+			log.Printf("Guest mode: %v", err)
+			continue
+		}
+		if err := database.DeleteGuestTrust(m.db, trust.Address); err != nil {
+			log.Printf("Guest mode: %v", err)
+		}
+		log.Printf("Guest mode: trust of %s expired", trust.Address)
+		hub.Publish(EventGuestTrustExpired, GuestDevice{Address: trust.Address, Adapter: trust.Adapter})
+	}
+}
+
+// findAdapter returns the adapter of an address, or the first powered adapter when it is empty
+func (m *Mode) findAdapter(address string) (*bluetooth.Adapter, error) {
+	adapters, err := m.btManager.GetAdapters()
+	if err != nil {
+		return nil, err
+	}
+	for i, adapter := range adapters {
+		if address != "" && strings.EqualFold(adapter.Address, address) {
+			return &adapters[i], nil
+		}
+		if address == "" && adapter.Powered {
+			return &adapters[i], nil
+		}
+	}
+	if address != "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoAdapter, address)
+	}
+	return nil, fmt.Errorf("%w: no powered adapter", ErrNoAdapter)
+}
+
+func (w *window) status() Status {
+	startedAt, endsAt := w.startedAt, w.endsAt
+	return Status{
+		Active:       true,
+		Adapter:      w.adapter,
+		StartedAt:    &startedAt,
+		EndsAt:       &endsAt,
+		TrustMinutes: int(w.trustFor / time.Minute),
+		Devices:      append([]string{}, w.devices...),
+	}
+}
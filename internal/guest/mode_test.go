@@ -0,0 +1,130 @@
+package guest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMode_Window(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	adapter := bluetooth.Adapter{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true}
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{adapter}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true},
+	}, nil).Once()
+	btManager.On("SetPairable", "/org/bluez/hci0", true).Return(nil)
+	btManager.On("SetDiscoverable", "/org/bluez/hci0", true).Return(nil)
+
+	m := NewMode(btManager, db, nil, bluetooth.NewVisibility(btManager), time.Second)
+	m.now = func() time.Time { return now }
+
+	hub := events.NewHub()
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	status, err := m.Start("", 10*time.Minute, time.Hour, hub)
+	assert.NoError(t, err)
+	assert.Equal(t, "00:1A:7D:DA:71:01", status.Adapter)
+	assert.Equal(t, now.Add(10*time.Minute), *status.EndsAt)
+	assert.Equal(t, EventGuestModeStarted, (<-ch).Type)
+	assert.True(t, m.Active())
+
+	_, err = m.Start("", time.Minute, 0, hub)
+	assert.ErrorIs(t, err, ErrActive)
+
+	// A guest phone pairs during the window
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true},
+		{Address: "11:22:33:44:55:66", Paired: true},
+		{Address: "99:88:77:66:55:44"},
+	}, nil)
+	btManager.On("TrustDevice", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil).Once()
+	dbMock.ExpectExec("INSERT INTO guest_trusts").
+		WithArgs("11:22:33:44:55:66", "00:1A:7D:DA:71:01", now.Add(time.Hour)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectQuery("FROM guest_trusts WHERE expires_at <= ?").
+		WillReturnRows(sqlmock.NewRows([]string{"address", "adapter", "expires_at"}))
+
+	m.Check(hub)
+	event := <-ch
+	assert.Equal(t, EventGuestDeviceTrusted, event.Type)
+	assert.Equal(t, "11:22:33:44:55:66", event.Data.(GuestDevice).Address)
+	assert.Equal(t, []string{"11:22:33:44:55:66"}, m.Status().Devices)
+
+	// The window ends and the adapter is restored
+	now = now.Add(10 * time.Minute)
+	btManager.On("SetDiscoverable", "/org/bluez/hci0", false).Return(nil).Once()
+	btManager.On("SetPairable", "/org/bluez/hci0", false).Return(nil).Once()
+	dbMock.ExpectQuery("FROM guest_trusts WHERE expires_at <= ?").
+		WillReturnRows(sqlmock.NewRows([]string{"address", "adapter", "expires_at"}))
+
+	m.Check(hub)
+	assert.Equal(t, EventGuestModeEnded, (<-ch).Type)
+	assert.False(t, m.Active())
+	btManager.AssertNumberOfCalls(t, "TrustDevice", 1)
+
+	_, err = m.Stop(hub)
+	assert.ErrorIs(t, err, ErrInactive)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestMode_RevokeExpired(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	dbMock.ExpectQuery("FROM guest_trusts WHERE expires_at <= ?").WithArgs(now).
+		WillReturnRows(sqlmock.NewRows([]string{"address", "adapter", "expires_at"}).
+			AddRow("11:22:33:44:55:66", "00:1A:7D:DA:71:01", now.Add(-time.Minute)).
+			AddRow("99:88:77:66:55:44", "00:1A:7D:DA:71:01", now.Add(-time.Minute)))
+	dbMock.ExpectExec("DELETE FROM guest_trusts").WithArgs("11:22:33:44:55:66").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapterPathByMAC", "00:1A:7D:DA:71:01").Return("/org/bluez/hci0", nil)
+	btManager.On("UntrustDevice", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil)
+	// A trust failing to be revoked is kept for the next check
+	btManager.On("UntrustDevice", "/org/bluez/hci0", "99:88:77:66:55:44").Return(assert.AnError)
+
+	hub := events.NewHub()
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	m := NewMode(btManager, db, nil, bluetooth.NewVisibility(btManager), time.Second)
+	m.now = func() time.Time { return now }
+	m.Check(hub)
+
+	event := <-ch
+	assert.Equal(t, EventGuestTrustExpired, event.Type)
+	assert.Equal(t, GuestDevice{Address: "11:22:33:44:55:66", Adapter: "00:1A:7D:DA:71:01"}, event.Data)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestMode_StartRestoresOnFailure(t *testing.T) {
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true, Pairable: true},
+	}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{}, nil)
+	btManager.On("SetPairable", "/org/bluez/hci0", true).Return(nil)
+	btManager.On("SetDiscoverable", "/org/bluez/hci0", true).Return(assert.AnError)
+	btManager.On("SetDiscoverable", "/org/bluez/hci0", false).Return(nil)
+
+	m := NewMode(btManager, nil, nil, bluetooth.NewVisibility(btManager), time.Second)
+	_, err := m.Start("00:1a:7d:da:71:01", time.Minute, 0, nil)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.False(t, m.Active())
+
+	_, err = m.Start("11:22:33:44:55:66", time.Minute, 0, nil)
+	assert.ErrorIs(t, err, ErrNoAdapter)
+}
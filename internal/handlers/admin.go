@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+type RotateKeyRequest struct {
+	Key string `json:"key"`
+}
+
+// RotateEncryptionKey switches to a new encryption key and re-encrypts every stored secret and the
+// encrypted device metadata with it
+func (h *Handler) RotateEncryptionKey(c echo.Context) error {
+	if !h.cipher.Enabled() {
+		return jsonError(c, http.StatusConflict, "encryption at rest is not enabled")
+	}
+
+	var req RotateKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	var newKey []byte
+	var err error
+	if req.Key != "" {
+		newKey, err = secrets.ParseKey(req.Key)
+		if err != nil {
+			return jsonError(c, http.StatusBadRequest, err.Error())
+		}
+	} else {
+		newKey, err = secrets.GenerateKey()
+		if err != nil {
+			return jsonError(c, http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	h.rotateMu.Lock()
+	defer h.rotateMu.Unlock()
+
+	oldKey := h.cipher.Key()
+	keyFile := h.cipher.KeyFile()
+
+	// Stage the new key next to the current one so it survives a crash after the database commit
+	pendingFile := ""
+	if keyFile != "" {
+		pendingFile = keyFile + ".new"
+		if err := secrets.WriteKeyFile(pendingFile, newKey); err != nil {
+			return jsonError(c, http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	if err := h.cipher.Rotate(newKey); err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	count, err := database.ReencryptSecrets(h.db, h.cipher, false)
+	if err != nil {
+		h.cipher.Rotate(oldKey)
+		if pendingFile != "" {
+			os.Remove(pendingFile)
+		}
+		return jsonError(c, http.StatusInternalServerError, "failed to re-encrypt secrets: "+err.Error())
+	}
+
+	if keyFile == "" {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message":     "encryption key rotated, update ENCRYPTION_KEY before restarting",
+			"reencrypted": count,
+			"key":         secrets.EncodeKey(newKey),
+		})
+	}
+
+	if err := os.Rename(pendingFile, keyFile); err != nil {
+		log.Printf("request_id=%s secrets were re-encrypted but the new key could not replace %s, it is stored in %s: %v",
+			RequestID(c), keyFile, pendingFile, err)
+		return jsonError(c, http.StatusInternalServerError, "secrets re-encrypted but failed to replace key file, new key stored in "+pendingFile)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":     "encryption key rotated",
+		"reencrypted": count,
+	})
+}
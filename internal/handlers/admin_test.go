@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_RotateEncryptionKey(t *testing.T) {
+	oldKey, _ := secrets.GenerateKey()
+	newKey, _ := secrets.GenerateKey()
+
+	t.Run("success - secrets and device metadata re-encrypted with the new key", func(t *testing.T) {
+		// Setup
+		db, err := database.InitDB(filepath.Join(t.TempDir(), "data.db"))
+		assert.NoError(t, err)
+		defer db.Close()
+		assert.NoError(t, database.RunMigrations(db))
+
+		cipher, err := secrets.NewCipher(oldKey)
+		assert.NoError(t, err)
+		now := time.Now()
+		assert.NoError(t, database.CreateToken(db, cipher, "testuser", "testtoken", false))
+		assert.NoError(t, database.SetDeviceOwner(db, cipher, database.DeviceOwner{Address: "AA:BB:CC:DD:EE:FF", Owner: "testuser", Adapter: "00:1A:7D:DA:71:01", PairedAt: now}))
+		assert.NoError(t, database.AddPairingAllowlistEntry(db, cipher, database.PairingAllowlistEntry{Address: "AA:BB:CC:DD:EE:FF", Name: "Headphones", CreatedAt: now}))
+		_, err = database.AddWebPushSubscription(db, cipher, database.WebPushSubscription{Username: "testuser", Endpoint: "https://push.example.com/abc", P256dh: "key", Auth: "auth", CreatedAt: now})
+		assert.NoError(t, err)
+
+		e := echo.New()
+		body := `{"key":"` + secrets.EncodeKey(newKey) + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/encryption/rotate", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := &Handler{db: db, cipher: cipher}
+
+		// Test
+		err = h.RotateEncryptionKey(c)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, newKey, cipher.Key())
+
+		var response map[string]interface{}
+		err = json.Unmarshal(rec.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		// The token, the owner, the allowlist name and both keys of the push subscription
+		assert.Equal(t, float64(5), response["reencrypted"])
+		assert.Equal(t, secrets.EncodeKey(newKey), response["key"])
+
+		// Everything is readable without the old key
+		newCipher, err := secrets.NewCipher(newKey)
+		assert.NoError(t, err)
+		owner, err := database.GetDeviceOwner(db, newCipher, "AA:BB:CC:DD:EE:FF")
+		assert.NoError(t, err)
+		assert.Equal(t, "testuser", owner.Owner)
+		entries, err := database.GetPairingAllowlist(db, newCipher)
+		assert.NoError(t, err)
+		assert.Equal(t, "Headphones", entries[0].Name)
+		subs, err := database.GetWebPushSubscriptions(db, newCipher, "testuser")
+		assert.NoError(t, err)
+		assert.Equal(t, "key", subs[0].P256dh)
+		assert.Equal(t, "auth", subs[0].Auth)
+	})
+
+	t.Run("failure - encryption disabled", func(t *testing.T) {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/encryption/rotate", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := &Handler{}
+
+		err := h.RotateEncryptionKey(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("failure - invalid key", func(t *testing.T) {
+		cipher, _ := secrets.NewCipher(oldKey)
+
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/encryption/rotate", strings.NewReader(`{"key":"short"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+
+		h := &Handler{cipher: cipher}
+
+		err := h.RotateEncryptionKey(c)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, oldKey, cipher.Key())
+	})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// IPAllowlistMiddleware rejects requests whose client IP is not part of one of the allowed CIDRs.
+// A bare IP address is accepted as a single-host network. An empty list allows every client.
+func IPAllowlistMiddleware(cidrs []string) (echo.MiddlewareFunc, error) {
+	networks, err := parseCIDRs(cidrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if len(networks) == 0 {
+				return next(c)
+			}
+
+			ip := net.ParseIP(c.RealIP())
+			if ip != nil {
+				for _, network := range networks {
+					if network.Contains(ip) {
+						return next(c)
+					}
+				}
+			}
+
+			return jsonError(c, http.StatusForbidden, "client address not allowed")
+		}
+	}, nil
+}
+
+// parseCIDRs parses a list of CIDRs or IP addresses into networks
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid allowed CIDR %q", cidr)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed CIDR %q: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPAllowlistMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		cidrs          []string
+		remoteAddr     string
+		expectedStatus int
+	}{
+		{
+			name:           "success - no allowlist configured",
+			cidrs:          nil,
+			remoteAddr:     "203.0.113.10:4242",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "success - client in LAN subnet",
+			cidrs:          []string{"192.168.1.0/24", "10.8.0.0/24"},
+			remoteAddr:     "192.168.1.42:4242",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "success - client matches single IP",
+			cidrs:          []string{"127.0.0.1"},
+			remoteAddr:     "127.0.0.1:4242",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "success - IPv6 client in subnet",
+			cidrs:          []string{"fd00::/8"},
+			remoteAddr:     "[fd00::1]:4242",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - client outside allowed subnets",
+			cidrs:          []string{"192.168.1.0/24"},
+			remoteAddr:     "203.0.113.10:4242",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			e := echo.New()
+			e.IPExtractor = echo.ExtractIPDirect()
+			req := httptest.NewRequest(http.MethodGet, "/livez", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			mw, err := IPAllowlistMiddleware(tt.cidrs)
+			assert.NoError(t, err)
+
+			// Test
+			err = mw(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestIPAllowlistMiddleware_InvalidCIDR(t *testing.T) {
+	_, err := IPAllowlistMiddleware([]string{"192.168.1.0/33"})
+	assert.Error(t, err)
+
+	_, err = IPAllowlistMiddleware([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
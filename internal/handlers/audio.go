@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/audio"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/wireplumber"
+)
+
+// AudioHandler manages the audio settings of devices
+type AudioHandler struct {
+	btManager bluetooth.BluetoothManagerInterface
+	db        database.DatabaseInterface
+	wpConfig  *wireplumber.ConfigManager
+	router    *audio.Router
+}
+
+type SetAudioSettingsRequest struct {
+	// Codecs are ordered by preference
+	Codecs                []string `json:"codecs"`
+	SampleRate            int      `json:"sample_rate"`
+	Channels              string   `json:"channels"`
+	AutoSwitchDefaultSink bool     `json:"auto_switch_default_sink"`
+	// AutoConnect defaults to true
+	AutoConnect *bool  `json:"auto_connect"`
+	Profile     string `json:"profile"`
+}
+
+// SetAudioLatencyRequest updates the latency overrides of a device, omitted fields are kept
+type SetAudioLatencyRequest struct {
+	NodeLatency *string `json:"node_latency"`
+	Quantum     *int    `json:"quantum"`
+	OffsetMs    *int    `json:"offset_ms"`
+}
+
+// NewAudioHandler creates a new audio handler. The WirePlumber device fragments are reconciled on every
+// change when wpConfig is not nil.
+func NewAudioHandler(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, wpConfig *wireplumber.ConfigManager, router *audio.Router) *AudioHandler {
+	return &AudioHandler{btManager: btManager, db: db, wpConfig: wpConfig, router: router}
+}
+
+// GetAllSettings returns the audio settings of every device
+func (ah *AudioHandler) GetAllSettings(c echo.Context) error {
+	all, err := database.GetAllDeviceAudioSettings(ah.db)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"devices": all,
+	})
+}
+
+// GetSettings returns the audio settings of a device
+func (ah *AudioHandler) GetSettings(c echo.Context) error {
+	if _, err := ah.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	settings, err := database.GetDeviceAudioSettings(ah.db, strings.ToUpper(c.Param("mac")))
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	if settings == nil {
+		return jsonError(c, http.StatusNotFound, "device has no audio settings")
+	}
+
+	return c.JSON(http.StatusOK, settings)
+}
+
+// SetSettings stores the audio settings of a device, they are applied the next time it connects
+func (ah *AudioHandler) SetSettings(c echo.Context) error {
+	if _, err := ah.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	var req SetAudioSettingsRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	settings := database.DeviceAudioSettings{
+		Address:               strings.ToUpper(c.Param("mac")),
+		Codecs:                req.Codecs,
+		SampleRate:            req.SampleRate,
+		Channels:              req.Channels,
+		AutoSwitchDefaultSink: req.AutoSwitchDefaultSink,
+		AutoConnect:           req.AutoConnect == nil || *req.AutoConnect,
+		Profile:               req.Profile,
+		UpdatedAt:             time.Now(),
+	}
+	if settings.Codecs == nil {
+		settings.Codecs = []string{}
+	}
+	if err := audio.ValidateSettings(settings); err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := database.SetDeviceAudioSettings(ah.db, settings); err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	ah.syncWirePlumber(c)
+
+	// The latency overrides are kept, return them along with the new settings
+	stored, err := database.GetDeviceAudioSettings(ah.db, settings.Address)
+	if err != nil || stored == nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to read back the device audio settings")
+	}
+
+	return c.JSON(http.StatusOK, stored)
+}
+
+// SetLatency overrides the latency of the audio nodes of a device, e.g. to fix the lip sync of one soundbar
+func (ah *AudioHandler) SetLatency(c echo.Context) error {
+	if _, err := ah.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	var req SetAudioLatencyRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	address := strings.ToUpper(c.Param("mac"))
+	settings, err := database.GetDeviceAudioSettings(ah.db, address)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	var latency database.AudioLatency
+	if settings != nil {
+		latency = settings.Latency
+	}
+	if req.NodeLatency != nil {
+		latency.NodeLatency = *req.NodeLatency
+	}
+	if req.Quantum != nil {
+		latency.Quantum = *req.Quantum
+	}
+	if req.OffsetMs != nil {
+		latency.OffsetMs = *req.OffsetMs
+	}
+	if err := audio.ValidateLatency(latency); err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	if err := database.SetDeviceAudioLatency(ah.db, address, latency); err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	ah.syncWirePlumber(c)
+
+	return c.JSON(http.StatusOK, latency)
+}
+
+// GetCodec returns the codec negotiated with a connected device, along with the codecs it supports
+func (ah *AudioHandler) GetCodec(c echo.Context) error {
+	if _, err := ah.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	status, err := ah.router.CodecStatus(c.Request().Context(), strings.ToUpper(c.Param("mac")))
+	if errors.Is(err, audio.ErrNodeNotFound) {
+		return jsonError(c, http.StatusNotFound, "the device has no PipeWire device, is it connected?")
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
+
+// RenegotiateCodec switches a connected device to its most preferred supported codec
+func (ah *AudioHandler) RenegotiateCodec(c echo.Context) error {
+	if _, err := ah.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	codec, err := ah.router.Renegotiate(c.Request().Context(), strings.ToUpper(c.Param("mac")))
+	switch {
+	case errors.Is(err, audio.ErrNoCodecPreference):
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, audio.ErrNodeNotFound):
+		return jsonError(c, http.StatusNotFound, "the device has no PipeWire device, is it connected?")
+	case errors.Is(err, audio.ErrCodecUnsupported):
+		return jsonError(c, http.StatusConflict, err.Error())
+	case err != nil:
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "codec renegotiated",
+		"codec":   codec,
+	})
+}
+
+// DeleteSettings removes the audio settings of a device
+func (ah *AudioHandler) DeleteSettings(c echo.Context) error {
+	if _, err := ah.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	if err := database.DeleteDeviceAudioSettings(ah.db, strings.ToUpper(c.Param("mac"))); err != nil {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	}
+	ah.syncWirePlumber(c)
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "device audio settings removed",
+	})
+}
+
+// GetConfigDiff returns the changes the broker would make to the configuration of the audio stack
+// from the stored settings, without applying them
+func (ah *AudioHandler) GetConfigDiff(c echo.Context) error {
+	if ah.wpConfig == nil {
+		return jsonError(c, http.StatusServiceUnavailable, "the audio configuration is not managed")
+	}
+
+	all, err := database.GetAllDeviceAudioSettings(ah.db)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	changes, err := ah.wpConfig.Diff(all)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	if changes == nil {
+		changes = []wireplumber.Change{}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"stack":   ah.wpConfig.Stack(),
+		"changes": changes,
+	})
+}
+
+// syncWirePlumber reconciles the WirePlumber device fragments; the settings are stored anyway so a
+// failure is only logged and retried on the next change or at startup
+func (ah *AudioHandler) syncWirePlumber(c echo.Context) {
+	if ah.wpConfig == nil {
+		return
+	}
+	if err := audio.SyncWirePlumber(ah.db, ah.wpConfig); err != nil {
+		log.Printf("request_id=%s failed to update the WirePlumber device fragments: %v", RequestID(c), err)
+	}
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/wireplumber"
+	"github.com/stretchr/testify/assert"
+)
+
+var audioSettingsColumns = []string{"address", "codecs", "sample_rate", "channels", "auto_switch_default_sink", "auto_connect", "profile", "node_latency", "quantum", "latency_offset_ms", "updated_at"}
+
+func TestAudioHandler_SetSettings(t *testing.T) {
+	tests := []struct {
+		name           string
+		adapter        string
+		requestBody    string
+		setupMock      func(sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:        "success - settings stored with an upper case address",
+			adapter:     "AA:BB:CC:DD:EE:00",
+			requestBody: `{"codecs": ["ldac", "aptx_hd"], "sample_rate": 96000, "channels": "stereo", "auto_switch_default_sink": true}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO device_audio_settings").
+					WithArgs("11:22:33:44:55:66", "ldac,aptx_hd", 96000, "stereo", true, true, "", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery("FROM device_audio_settings WHERE address = ?").
+					WithArgs("11:22:33:44:55:66").
+					WillReturnRows(sqlmock.NewRows(audioSettingsColumns).AddRow("11:22:33:44:55:66", "ldac,aptx_hd", 96000, "stereo", true, true, "", "", 0, -150, time.Now()))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "success - auto-connect disabled and headset profile forced",
+			adapter:     "AA:BB:CC:DD:EE:00",
+			requestBody: `{"auto_connect": false, "profile": "headset-head-unit"}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO device_audio_settings").
+					WithArgs("11:22:33:44:55:66", "", 0, "", false, false, "headset-head-unit", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectQuery("FROM device_audio_settings WHERE address = ?").
+					WithArgs("11:22:33:44:55:66").
+					WillReturnRows(sqlmock.NewRows(audioSettingsColumns).AddRow("11:22:33:44:55:66", "", 0, "", false, false, "headset-head-unit", "", 0, 0, time.Now()))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - unknown codec",
+			adapter:        "AA:BB:CC:DD:EE:00",
+			requestBody:    `{"codecs": ["mp3"]}`,
+			setupMock:      func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - unknown adapter",
+			adapter:        "FF:FF:FF:FF:FF:FF",
+			requestBody:    `{"codecs": ["sbc"]}`,
+			setupMock:      func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			btMock := bluetooth.NewMockBluetoothManager(t)
+			if tt.adapter == "AA:BB:CC:DD:EE:00" {
+				btMock.On("GetAdapterPathByMAC", tt.adapter).Return("/org/bluez/hci0", nil)
+			} else {
+				btMock.On("GetAdapterPathByMAC", tt.adapter).Return("", errors.New("adapter not found"))
+			}
+
+			db, dbMock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			tt.setupMock(dbMock)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/bluetooth/adapters/"+tt.adapter+"/devices/11:22:33:44:55:66/audio", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues(tt.adapter, "11:22:33:44:55:66")
+
+			assert.NoError(t, NewAudioHandler(btMock, db, nil, nil).SetSettings(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAudioHandler_GetSettings(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dbMock.ExpectQuery("FROM device_audio_settings WHERE address = ?").
+		WithArgs("11:22:33:44:55:66").
+		WillReturnRows(sqlmock.NewRows(audioSettingsColumns).AddRow("11:22:33:44:55:66", "aac", 48000, "", false, true, "", "", 0, 0, time.Now()))
+	dbMock.ExpectQuery("FROM device_audio_settings WHERE address = ?").
+		WithArgs("22:33:44:55:66:77").
+		WillReturnRows(sqlmock.NewRows(audioSettingsColumns))
+
+	h := NewAudioHandler(btMock, db, nil, nil)
+	for _, tt := range []struct {
+		mac            string
+		expectedStatus int
+	}{
+		{"11:22:33:44:55:66", http.StatusOK},
+		{"22:33:44:55:66:77", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+		c.SetParamNames("adapter", "mac")
+		c.SetParamValues("AA:BB:CC:DD:EE:00", tt.mac)
+		assert.NoError(t, h.GetSettings(c))
+		assert.Equal(t, tt.expectedStatus, rec.Code)
+	}
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestAudioHandler_SetLatency(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Test - omitted fields keep their stored value
+	dbMock.ExpectQuery("FROM device_audio_settings WHERE address = ?").
+		WithArgs("11:22:33:44:55:66").
+		WillReturnRows(sqlmock.NewRows(audioSettingsColumns).AddRow("11:22:33:44:55:66", "", 0, "", false, true, "", "1024/48000", 0, 0, time.Now()))
+	dbMock.ExpectExec("INSERT INTO device_audio_settings").
+		WithArgs("11:22:33:44:55:66", "1024/48000", 0, -150, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	h := NewAudioHandler(btMock, db, nil, nil)
+	patch := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("adapter", "mac")
+		c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+		assert.NoError(t, h.SetLatency(c))
+		return rec
+	}
+
+	rec := patch(`{"offset_ms": -150}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"node_latency": "1024/48000", "quantum": 0, "offset_ms": -150}`, rec.Body.String())
+
+	// Test - invalid quantum
+	dbMock.ExpectQuery("FROM device_audio_settings WHERE address = ?").
+		WithArgs("11:22:33:44:55:66").
+		WillReturnRows(sqlmock.NewRows(audioSettingsColumns))
+
+	rec = patch(`{"quantum": 300}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestAudioHandler_GetConfigDiff(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	wpConfig, err := wireplumber.NewConfigManager()
+	assert.NoError(t, err)
+
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	dbMock.ExpectQuery("FROM device_audio_settings ORDER BY address").
+		WillReturnRows(sqlmock.NewRows(audioSettingsColumns).AddRow("11:22:33:44:55:66", "", 0, "", false, true, "", "", 0, 0, time.Now()))
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/audio/config/diff", nil), rec)
+	assert.NoError(t, NewAudioHandler(bluetooth.NewMockBluetoothManager(t), db, wpConfig, nil).GetConfigDiff(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"stack":"wireplumber"`)
+	assert.Contains(t, rec.Body.String(), `"action":"create"`)
+	assert.NoFileExists(t, wpConfig.GetConfigPath())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+
+	rec = httptest.NewRecorder()
+	c = echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/audio/config/diff", nil), rec)
+	assert.NoError(t, NewAudioHandler(bluetooth.NewMockBluetoothManager(t), db, nil, nil).GetConfigDiff(c))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
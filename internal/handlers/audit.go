@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/audit"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+const (
+	// defaultAuditLimit is the number of audit entries returned when the request sets no limit
+	defaultAuditLimit = 100
+	// maxAuditLimit is the largest number of audit entries returned at once, the default of the
+	// CSV export
+	maxAuditLimit = 10000
+)
+
+// AuditLogResponse is a page of the audit trail
+type AuditLogResponse struct {
+	Entries []database.AuditEntry `json:"entries"`
+	// NextBefore is the before parameter fetching the next page, unset on the last page
+	NextBefore int64 `json:"next_before,omitempty"`
+}
+
+// AuditMiddleware records the requests changing something and the requests refused to a client
+// which sent credentials, with the principal, the route and the outcome, in the audit trail. They
+// are also published on the hub for the other consumers, which may miss some. Like
+// TokenStatsMiddleware it must run before AuthMiddleware.
+func AuditMiddleware(auditLogger *audit.Logger, hub *events.Hub) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if err != nil {
+				// Let the error handler write the response so its status is the one recorded
+				c.Error(err)
+			}
+
+			req := c.Request()
+			status := c.Response().Status
+			outcome := auditOutcome(status)
+			actor, _ := c.Get("username").(string)
+			if _, _, ok := req.BasicAuth(); ok && actor == "" && outcome == database.AuditOutcomeDenied {
+				actor = database.AuditActorAnonymous
+			}
+			mutating := req.Method != http.MethodGet && req.Method != http.MethodHead && req.Method != http.MethodOptions
+			if actor == "" || (!mutating && outcome != database.AuditOutcomeDenied) {
+				return nil
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = req.URL.Path
+			}
+			entry := database.AuditEntry{
+				CreatedAt: time.Now(),
+				Actor:     actor,
+				IP:        c.RealIP(),
+				Action:    req.Method + " " + route,
+				Device:    c.Param("mac"),
+				Outcome:   outcome,
+				Status:    status,
+				RequestID: RequestID(c),
+			}
+			auditLogger.Record(entry)
+			hub.PublishInternal(audit.EventRequestAudited, entry)
+			return nil
+		}
+	}
+}
+
+// auditOutcome classifies the status of a response
+func auditOutcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		return database.AuditOutcomeDenied
+	case status >= http.StatusBadRequest:
+		return database.AuditOutcomeFailure
+	default:
+		return database.AuditOutcomeSuccess
+	}
+}
+
+// GetAuditLog returns the audit trail, most recent first, filtered by actor, device, action,
+// outcome and time range, as JSON pages or as a CSV export with format=csv
+func (h *Handler) GetAuditLog(c echo.Context) error {
+	csvFormat := c.QueryParam("format") == "csv"
+	filter := database.AuditFilter{
+		Actor:   c.QueryParam("actor"),
+		Device:  c.QueryParam("device"),
+		Action:  c.QueryParam("action"),
+		Outcome: c.QueryParam("outcome"),
+		Limit:   defaultAuditLimit,
+	}
+	if csvFormat {
+		filter.Limit = maxAuditLimit
+	}
+
+	switch filter.Outcome {
+	case "", database.AuditOutcomeSuccess, database.AuditOutcomeFailure, database.AuditOutcomeDenied:
+	default:
+		return jsonError(c, http.StatusBadRequest, "outcome must be success, failure or denied")
+	}
+
+	var err error
+	if filter.Since, err = parseAuditTime(c.QueryParam("since")); err != nil {
+		return jsonError(c, http.StatusBadRequest, errInvalidSince.Error())
+	}
+	if filter.Until, err = parseAuditTime(c.QueryParam("until")); err != nil {
+		return jsonError(c, http.StatusBadRequest, "until must be a duration such as 1h or an RFC3339 time")
+	}
+	if value := c.QueryParam("before"); value != "" {
+		if filter.Before, err = strconv.ParseInt(value, 10, 64); err != nil || filter.Before <= 0 {
+			return jsonError(c, http.StatusBadRequest, "before must be the ID of an audit entry")
+		}
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit <= 0 {
+			return jsonError(c, http.StatusBadRequest, errInvalidLimit.Error())
+		}
+		filter.Limit = min(filter.Limit, maxAuditLimit)
+	}
+
+	entries, err := database.GetAuditEntries(h.db, filter)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	response := AuditLogResponse{Entries: entries}
+	if len(entries) == filter.Limit {
+		response.NextBefore = entries[len(entries)-1].ID
+	}
+	if csvFormat {
+		return writeAuditCSV(c, response)
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// parseAuditTime parses an RFC3339 time or a duration back from now, the zero time when empty
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// writeAuditCSV writes a page of the audit trail as a CSV attachment. The before parameter of the
+// next page is given in the X-Next-Before header.
+func writeAuditCSV(c echo.Context, page AuditLogResponse) error {
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	header.Set(echo.HeaderContentDisposition, `attachment; filename="audit.csv"`)
+	if page.NextBefore > 0 {
+		header.Set("X-Next-Before", strconv.FormatInt(page.NextBefore, 10))
+	}
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response())
+	w.Write([]string{"id", "created_at", "actor", "ip", "action", "device", "outcome", "status", "request_id"})
+	for _, entry := range page.Entries {
+		w.Write([]string{
+			strconv.FormatInt(entry.ID, 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			entry.Actor,
+			entry.IP,
+			entry.Action,
+			entry.Device,
+			entry.Outcome,
+			strconv.Itoa(entry.Status),
+			entry.RequestID,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed to write audit CSV: %w", err)
+	}
+	return nil
+}
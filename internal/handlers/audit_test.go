@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/audit"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditMiddleware(t *testing.T) {
+	hub := events.NewHub()
+	audited, unsubscribe := hub.SubscribeTypes(audit.EventRequestAudited)
+	defer unsubscribe()
+	entry := func() database.AuditEntry {
+		event := <-audited
+		entry := event.Data.(database.AuditEntry)
+		entry.CreatedAt = time.Time{}
+		return entry
+	}
+
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	auditLogger := audit.NewLogger(db)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go auditLogger.Run(ctx)
+
+	e := echo.New()
+	e.Use(AuditMiddleware(auditLogger, hub))
+	authenticated := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			username, password, _ := c.Request().BasicAuth()
+			if password != "secret" {
+				return jsonError(c, http.StatusUnauthorized, "invalid credentials")
+			}
+			c.Set("username", username)
+			return next(c)
+		}
+	}
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/api/v1/bluetooth/adapters", ok, authenticated)
+	e.POST("/api/v1/bluetooth/adapters/:adapter/devices/:mac/connect", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusConflict, "device is not paired")
+	}, authenticated)
+
+	request := func(method, path, password string) {
+		req := httptest.NewRequest(method, path, nil)
+		req.SetBasicAuth("kitchen", password)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Reading is not audited
+	request(http.MethodGet, "/api/v1/bluetooth/adapters", "secret")
+	assert.Empty(t, audited)
+
+	// The audited requests are stored in the audit trail
+	dbMock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(sqlmock.AnyArg(), "kitchen", "192.0.2.1", "POST /api/v1/bluetooth/adapters/:adapter/devices/:mac/connect", "AA:BB:CC:DD:EE:FF", "failure", http.StatusConflict, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	request(http.MethodPost, "/api/v1/bluetooth/adapters/00:1A:7D:DA:71:01/devices/aa:bb:cc:dd:ee:ff/connect", "secret")
+	assert.Equal(t, database.AuditEntry{
+		Actor:   "kitchen",
+		IP:      "192.0.2.1",
+		Action:  "POST /api/v1/bluetooth/adapters/:adapter/devices/:mac/connect",
+		Device:  "aa:bb:cc:dd:ee:ff",
+		Outcome: database.AuditOutcomeFailure,
+		Status:  http.StatusConflict,
+	}, entry())
+
+	// A refused client is audited as anonymous, the username it tried being whatever it typed
+	dbMock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(sqlmock.AnyArg(), "anonymous", "192.0.2.1", "GET /api/v1/bluetooth/adapters", "", "denied", http.StatusUnauthorized, "").
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	request(http.MethodGet, "/api/v1/bluetooth/adapters", "guess")
+	assert.Equal(t, database.AuditEntry{
+		Actor:   database.AuditActorAnonymous,
+		IP:      "192.0.2.1",
+		Action:  "GET /api/v1/bluetooth/adapters",
+		Outcome: database.AuditOutcomeDenied,
+		Status:  http.StatusUnauthorized,
+	}, entry())
+	assert.Eventually(t, func() bool { return dbMock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+}
+
+func TestHandler_GetAuditLog(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	columns := []string{"id", "created_at", "actor", "ip", "action", "device", "outcome", "status", "request_id"}
+	mock.ExpectQuery("SELECT (.+) FROM audit_log WHERE actor = \\? AND device = \\? AND created_at >= \\? AND id < \\? ORDER BY id DESC LIMIT \\?").
+		WithArgs("kitchen", "AA:BB:CC:DD:EE:FF", at, int64(10), 2).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(9, at.Add(2*time.Minute), "kitchen", "192.0.2.1", "POST /api/v1/bluetooth/adapters/:adapter/devices/:mac/connect", "AA:BB:CC:DD:EE:FF", "success", 200, "abc").
+			AddRow(7, at.Add(time.Minute), "kitchen", "192.0.2.1", "POST /api/v1/bluetooth/adapters/:adapter/devices/:mac/pair", "AA:BB:CC:DD:EE:FF", "failure", 500, "def"))
+
+	e := echo.New()
+	h := NewHandlerWithDB(db)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/audit?actor=kitchen&device=aa:bb:cc:dd:ee:ff&since=2026-01-01T12:00:00Z&before=10&limit=2", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, h.GetAuditLog(e.NewContext(req, rec)))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response AuditLogResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response.Entries, 2)
+	assert.Equal(t, "failure", response.Entries[1].Outcome)
+	assert.Equal(t, int64(7), response.NextBefore)
+
+	// The CSV export holds the same entries
+	mock.ExpectQuery("SELECT (.+) FROM audit_log WHERE outcome = \\? ORDER BY id DESC LIMIT \\?").
+		WithArgs("denied", maxAuditLimit).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(3, at, "admin", "192.0.2.1", "GET /api/v1/tokens", "", "denied", 401, "ghi"))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/audit?outcome=denied&format=csv", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, h.GetAuditLog(e.NewContext(req, rec)))
+
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get(echo.HeaderContentType))
+	assert.Empty(t, rec.Header().Get("X-Next-Before"))
+	assert.Equal(t, "id,created_at,actor,ip,action,device,outcome,status,request_id\n"+
+		"3,2026-01-01T12:00:00Z,admin,192.0.2.1,GET /api/v1/tokens,,denied,401,ghi\n", rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/audit?outcome=maybe", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, h.GetAuditLog(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
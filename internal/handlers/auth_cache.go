@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"sync"
+	"time"
+)
+
+// AuthCache remembers the Basic credentials verified recently, so that clients sending many
+// requests, such as the event stream reconnecting, do not look their token up in the database
+// every time. Only valid credentials are cached, as a hash, and a nil cache caches nothing.
+type AuthCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]authCacheEntry
+}
+
+type authCacheEntry struct {
+	hash      [sha256.Size]byte
+	isAdmin   bool
+	expiresAt time.Time
+}
+
+// NewAuthCache creates a cache keeping verified credentials for ttl
+func NewAuthCache(ttl time.Duration) *AuthCache {
+	return &AuthCache{ttl: ttl, now: time.Now, entries: make(map[string]authCacheEntry)}
+}
+
+// lookup returns whether the credentials of a username were verified less than ttl ago, and
+// whether its token has admin privileges
+func (ac *AuthCache) lookup(username, password string) (isAdmin, found bool) {
+	if ac == nil {
+		return false, false
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	entry, ok := ac.entries[username]
+	if !ok {
+		return false, false
+	}
+	if !ac.now().Before(entry.expiresAt) {
+		delete(ac.entries, username)
+		return false, false
+	}
+	hash := sha256.Sum256([]byte(password))
+	if subtle.ConstantTimeCompare(hash[:], entry.hash[:]) != 1 {
+		return false, false
+	}
+	return entry.isAdmin, true
+}
+
+// store caches credentials verified against the database
+func (ac *AuthCache) store(username, password string, isAdmin bool) {
+	if ac == nil {
+		return
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	ac.entries[username] = authCacheEntry{
+		hash:      sha256.Sum256([]byte(password)),
+		isAdmin:   isAdmin,
+		expiresAt: ac.now().Add(ac.ttl),
+	}
+}
+
+// Invalidate forgets the credentials of a username, when its token changes
+func (ac *AuthCache) Invalidate(username string) {
+	if ac == nil {
+		return
+	}
+
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	delete(ac.entries, username)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthCache(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewAuthCache(30 * time.Second)
+	cache.now = func() time.Time { return now }
+
+	_, found := cache.lookup("admin", "secret")
+	assert.False(t, found)
+
+	cache.store("admin", "secret", true)
+	isAdmin, found := cache.lookup("admin", "secret")
+	assert.True(t, found)
+	assert.True(t, isAdmin)
+
+	_, found = cache.lookup("admin", "wrong")
+	assert.False(t, found, "another password must be verified against the database")
+
+	now = now.Add(30 * time.Second)
+	_, found = cache.lookup("admin", "secret")
+	assert.False(t, found, "expired credentials must be verified again")
+	assert.Empty(t, cache.entries)
+
+	cache.store("admin", "secret", true)
+	cache.Invalidate("admin")
+	_, found = cache.lookup("admin", "secret")
+	assert.False(t, found)
+
+	var disabled *AuthCache
+	disabled.store("admin", "secret", true)
+	_, found = disabled.lookup("admin", "secret")
+	assert.False(t, found)
+}
+
+func TestAuthMiddlewareWithCache(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// The credentials are looked up once, then served from the cache until they are invalidated
+	for range 2 {
+		mock.ExpectQuery("SELECT token, is_admin FROM user_tokens WHERE username = ?").
+			WithArgs("speaker").
+			WillReturnRows(sqlmock.NewRows([]string{"token", "is_admin"}).AddRow("secret", false))
+		mock.ExpectExec("UPDATE user_tokens SET last_used_at = \\?, last_ip = \\? WHERE username = \\?").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	cache := NewAuthCache(time.Minute)
+	hub := events.NewHub()
+	used, unsubscribe := hub.SubscribeTypes(EventTokenUsed)
+	defer unsubscribe()
+	e := echo.New()
+	e.GET("/api/v1/whoami", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Get("username").(string))
+	}, AuthMiddlewareWithOptions(db, nil, AuthOptions{Cache: cache, Events: hub}))
+
+	request := func(password string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/whoami", nil)
+		req.SetBasicAuth("speaker", password)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("secret"))
+	assert.Equal(t, http.StatusOK, request("secret"))
+	assert.Equal(t, http.StatusOK, request("secret"))
+
+	cache.Invalidate("speaker")
+	assert.Equal(t, http.StatusOK, request("secret"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// Every request publishes a token use, cached credentials included
+	assert.Len(t, used, 4)
+	assert.Equal(t, TokenUse{Username: "speaker", IP: "192.0.2.1", Route: "GET /api/v1/whoami"}, (<-used).Data)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/automation"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// AutomationsHandler manages the automation rules, the Starlark scripts run on the broker events
+type AutomationsHandler struct {
+	db     database.DatabaseInterface
+	engine *automation.Engine
+}
+
+// AutomationRuleRequest is the body creating or replacing a rule. The name of a rule cannot change.
+type AutomationRuleRequest struct {
+	Name string `json:"name"`
+	// Trigger is the type of the events running the script, such as device_connected
+	Trigger string `json:"trigger"`
+	Script  string `json:"script"`
+	// Enabled defaults to true
+	Enabled *bool `json:"enabled"`
+}
+
+// NewAutomationsHandler creates a new automation rules handler, invalidating the rules cached by the
+// engine when they change
+func NewAutomationsHandler(db database.DatabaseInterface, engine *automation.Engine) *AutomationsHandler {
+	return &AutomationsHandler{db: db, engine: engine}
+}
+
+// GetRules returns the automation rules
+func (ah *AutomationsHandler) GetRules(c echo.Context) error {
+	rules, err := database.GetAutomationRules(ah.db)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"rules": rules,
+	})
+}
+
+// GetRule returns an automation rule
+func (ah *AutomationsHandler) GetRule(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid rule id")
+	}
+
+	rule, err := database.GetAutomationRule(ah.db, id)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	if rule == nil {
+		return jsonError(c, http.StatusNotFound, "rule not found")
+	}
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// CreateRule adds an automation rule, after checking its script compiles
+func (ah *AutomationsHandler) CreateRule(c echo.Context) error {
+	var req AutomationRuleRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	if req.Name == "" {
+		return jsonError(c, http.StatusBadRequest, "name is required")
+	}
+	rule, msg := ruleFromRequest(req)
+	if msg != "" {
+		return jsonError(c, http.StatusBadRequest, msg)
+	}
+
+	rule.CreatedAt = rule.UpdatedAt
+	id, err := database.AddAutomationRule(ah.db, rule)
+	if errors.Is(err, database.ErrAutomationRuleExists) {
+		return jsonError(c, http.StatusConflict, err.Error())
+	} else if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	rule.ID = id
+	ah.engine.Invalidate()
+
+	return c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule replaces the trigger, the script and the enabled flag of an automation rule
+func (ah *AutomationsHandler) UpdateRule(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid rule id")
+	}
+
+	var req AutomationRuleRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	rule, msg := ruleFromRequest(req)
+	if msg != "" {
+		return jsonError(c, http.StatusBadRequest, msg)
+	}
+
+	existing, err := database.GetAutomationRule(ah.db, id)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	if existing == nil {
+		return jsonError(c, http.StatusNotFound, "rule not found")
+	}
+	if req.Name != "" && req.Name != existing.Name {
+		return jsonError(c, http.StatusBadRequest, "the name of a rule cannot change")
+	}
+
+	rule.ID = id
+	rule.Name = existing.Name
+	rule.CreatedAt = existing.CreatedAt
+	updated, err := database.UpdateAutomationRule(ah.db, rule)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	if !updated {
+		return jsonError(c, http.StatusNotFound, "rule not found")
+	}
+	ah.engine.Invalidate()
+
+	return c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule deletes an automation rule
+func (ah *AutomationsHandler) DeleteRule(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid rule id")
+	}
+
+	deleted, err := database.DeleteAutomationRule(ah.db, id)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	if !deleted {
+		return jsonError(c, http.StatusNotFound, "rule not found")
+	}
+	ah.engine.Invalidate()
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "automation rule deleted",
+	})
+}
+
+// ruleFromRequest validates a rule request, returning the error message of an invalid one
+func ruleFromRequest(req AutomationRuleRequest) (database.AutomationRule, string) {
+	if req.Trigger == "" {
+		return database.AutomationRule{}, "trigger is required"
+	}
+	if err := automation.Check(req.Script); err != nil {
+		return database.AutomationRule{}, "invalid script: " + err.Error()
+	}
+
+	rule := database.AutomationRule{
+		Name:      req.Name,
+		Trigger:   req.Trigger,
+		Script:    req.Script,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+		UpdatedAt: time.Now(),
+	}
+	return rule, ""
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/automation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutomationsHandler_CreateRule(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	e := echo.New()
+	ah := NewAutomationsHandler(db, automation.NewEngine(nil, db, nil, false))
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/automations", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, ah.CreateRule(e.NewContext(req, rec)))
+		return rec
+	}
+
+	script := `if presence(event["data"]["address"]) == "home":\n    action("connect", "11:22:33:44:55:66")\n`
+	mock.ExpectQuery("INSERT INTO automation_rules").
+		WithArgs("speaker", "presence_changed", "if presence(event[\"data\"][\"address\"]) == \"home\":\n    action(\"connect\", \"11:22:33:44:55:66\")\n", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	rec := create(`{"name": "speaker", "trigger": "presence_changed", "script": "` + strings.ReplaceAll(script, `"`, `\"`) + `"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"enabled":true`)
+
+	// The existing names conflict
+	mock.ExpectQuery("INSERT INTO automation_rules").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.Equal(t, http.StatusConflict, create(`{"name": "speaker", "trigger": "presence_changed", "script": "log(1)"}`).Code)
+
+	// Scripts are compiled before being stored
+	rec = create(`{"name": "broken", "trigger": "presence_changed", "script": "if True\n    pass"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid script")
+	assert.Equal(t, http.StatusBadRequest, create(`{"name": "undefined", "trigger": "presence_changed", "script": "shell(\"rm\")"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, create(`{"name": "untriggered", "script": "log(1)"}`).Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAutomationsHandler_UpdateRule(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	e := echo.New()
+	ah := NewAutomationsHandler(db, automation.NewEngine(nil, db, nil, false))
+	update := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/automations/"+id, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		assert.NoError(t, ah.UpdateRule(c))
+		return rec
+	}
+	existing := func() *sqlmock.Rows {
+		at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+		return sqlmock.NewRows([]string{"id", "name", "trigger", "script", "enabled", "created_at", "updated_at"}).
+			AddRow(1, "speaker", "presence_changed", "log(1)", true, at, at)
+	}
+
+	mock.ExpectQuery("FROM automation_rules WHERE id = ?").WithArgs(1).WillReturnRows(existing())
+	mock.ExpectExec("UPDATE automation_rules").WithArgs("device_connected", "log(2)", false, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	rec := update("1", `{"trigger": "device_connected", "script": "log(2)", "enabled": false}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"speaker"`)
+
+	mock.ExpectQuery("FROM automation_rules WHERE id = ?").WithArgs(1).WillReturnRows(existing())
+	assert.Equal(t, http.StatusBadRequest, update("1", `{"name": "renamed", "trigger": "device_connected", "script": "log(2)"}`).Code)
+
+	mock.ExpectQuery("FROM automation_rules WHERE id = ?").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "trigger", "script", "enabled", "created_at", "updated_at"}))
+	assert.Equal(t, http.StatusNotFound, update("2", `{"trigger": "device_connected", "script": "log(2)"}`).Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
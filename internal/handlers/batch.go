@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+const (
+	// MaxBatchOperations is the largest number of operations in a batch
+	MaxBatchOperations = 100
+	// BatchStopOnError stops a batch at its first failed operation
+	BatchStopOnError = "stop_on_error"
+	// BatchContinue runs every operation of a batch whatever their results
+	BatchContinue = "continue"
+	// BatchAtomic runs the operations of a batch in a database transaction, rolled back at the first
+	// failed operation
+	BatchAtomic = "atomic"
+	// batchPath is the route of the batch endpoint, which batches may not nest
+	batchPath = "/api/v1/batch"
+)
+
+// batchStreamingPaths are the routes streaming their response until the client leaves, which
+// would hold a batch forever
+var batchStreamingPaths = []string{
+	"/api/v1/events",
+	"/api/v1/admin/bluetoothd/journal",
+	"/api/v1/bluetooth/pairing/ws",
+}
+
+// batchForwardedHeaders are the request headers copied to the operations of a batch, so that they
+// run with the credentials and the client address of the batch
+var batchForwardedHeaders = append([]string{echo.HeaderAuthorization, echo.HeaderCookie, CSRFHeaderName, echo.HeaderXForwardedFor},
+	forwardedSchemeHeaders...)
+
+// BatchHandler runs lists of API operations in a single call, e.g. for provisioning scripts.
+// Batches run one operation after the other, and only atomic batches are rolled back on failure.
+type BatchHandler struct {
+	e *echo.Echo
+	// h provides the database, the cipher and the authentication cache of the atomic batches
+	h *Handler
+}
+
+type BatchOperation struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type BatchRequest struct {
+	// Mode is stop_on_error, the default, continue or atomic
+	Mode       string           `json:"mode"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchResult struct {
+	Index  int             `json:"index"`
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Status int             `json:"status,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	// Skipped is set on the operations not run after a failure in stop_on_error mode
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+type BatchResponse struct {
+	Success   bool `json:"success"`
+	Completed int  `json:"completed"`
+	Failed    int  `json:"failed"`
+	// RolledBack is set when the completed operations of an atomic batch were rolled back
+	RolledBack bool          `json:"rolled_back,omitempty"`
+	Results    []BatchResult `json:"results"`
+}
+
+// NewBatchHandler creates a new batch handler dispatching the operations to the routes of e, the
+// atomic batches running the handlers of h in a transaction
+func NewBatchHandler(e *echo.Echo, h *Handler) *BatchHandler {
+	return &BatchHandler{e: e, h: h}
+}
+
+// Batch runs the operations of a batch in order, each one through the router with the
+// credentials of the batch request, so that authentication, admin checks and quotas apply to
+// every operation. Operations are not rolled back: in stop_on_error mode, the operations
+// following a failed one are skipped. Atomic batches are restricted to admins and to the routes
+// changing only the database, which run in a transaction rolled back at the first failure.
+func (bh *BatchHandler) Batch(c echo.Context) error {
+	var req BatchRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	if req.Mode == "" {
+		req.Mode = BatchStopOnError
+	}
+	if req.Mode != BatchStopOnError && req.Mode != BatchContinue && req.Mode != BatchAtomic {
+		return jsonError(c, http.StatusBadRequest, "mode must be stop_on_error, continue or atomic")
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > MaxBatchOperations {
+		return jsonError(c, http.StatusBadRequest, fmt.Sprintf("a batch must have between 1 and %d operations", MaxBatchOperations))
+	}
+	for i, op := range req.Operations {
+		if err := validateBatchOperation(op); err != nil {
+			return jsonError(c, http.StatusBadRequest, fmt.Sprintf("operation %d: %v", i, err))
+		}
+	}
+	if req.Mode == BatchAtomic {
+		return bh.batchAtomic(c, req.Operations)
+	}
+
+	resp := BatchResponse{Success: true, Results: make([]BatchResult, 0, len(req.Operations))}
+	for i, op := range req.Operations {
+		result := BatchResult{Index: i, Method: strings.ToUpper(op.Method), Path: op.Path}
+		if !resp.Success && req.Mode == BatchStopOnError {
+			result.Skipped = true
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+
+		result.Status, result.Body = bh.run(c, i, op)
+		resp.Results = append(resp.Results, result)
+
+		resp.Completed++
+		if result.Status >= http.StatusBadRequest {
+			resp.Failed++
+			resp.Success = false
+		}
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// batchAtomic runs the operations of an atomic batch in a transaction, committed once they all
+// succeeded. The operations do not go through the router: the batch request was authenticated, and
+// the middlewares recording each request would wait for the transaction to write to the database.
+func (bh *BatchHandler) batchAtomic(c echo.Context, operations []BatchOperation) error {
+	if isAdmin, _ := c.Get("is_admin").(bool); !isAdmin {
+		return jsonError(c, http.StatusForbidden, "atomic batches are restricted to admins")
+	}
+
+	tx, err := bh.h.db.Begin()
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	defer tx.Rollback()
+
+	routeHandlers := bh.atomicHandlers(database.Tx{Tx: tx})
+	routes := make([]string, len(operations))
+	for i, op := range operations {
+		routes[i] = bh.route(op)
+		if _, ok := routeHandlers[routes[i]]; !ok {
+			return jsonError(c, http.StatusBadRequest, fmt.Sprintf("operation %d: %s %s cannot run in an atomic batch, only the token and pairing allowlist changes can", i, strings.ToUpper(op.Method), op.Path))
+		}
+	}
+
+	resp := BatchResponse{Success: true, Results: make([]BatchResult, 0, len(operations))}
+	for i, op := range operations {
+		result := BatchResult{Index: i, Method: strings.ToUpper(op.Method), Path: op.Path}
+		if !resp.Success {
+			result.Skipped = true
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+
+		result.Status, result.Body = bh.runInTx(c, i, op, routeHandlers[routes[i]])
+		resp.Results = append(resp.Results, result)
+
+		resp.Completed++
+		if result.Status >= http.StatusBadRequest {
+			resp.Failed++
+			resp.Success = false
+		}
+	}
+
+	if !resp.Success {
+		resp.RolledBack = true
+		return c.JSON(http.StatusOK, resp)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("request_id=%s failed to commit batch: %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "failed to commit the batch")
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// atomicHandlers returns the handlers of the routes an atomic batch may hold, bound to a transaction.
+// These routes only change the database, the other ones change the Bluetooth or audio state, which
+// cannot be rolled back.
+func (bh *BatchHandler) atomicHandlers(tx database.DatabaseInterface) map[string]echo.HandlerFunc {
+	// The handlers share the cache of the broker, so that the tokens they revoke stop authenticating
+	h := &Handler{db: tx, cipher: bh.h.cipher, authCache: bh.h.authCache}
+	ph := NewPairingAllowlistHandler(tx, bh.h.cipher)
+	return map[string]echo.HandlerFunc{
+		"POST /api/v1/tokens":                             h.CreateToken,
+		"DELETE /api/v1/tokens/:username":                 h.DeleteToken,
+		"PUT /api/v1/tokens/:username/quota":              h.SetTokenQuota,
+		"POST /api/v1/tokens/revoked/:username/restore":   h.RestoreToken,
+		"POST /api/v1/bluetooth/pairing-allowlist":        ph.AddEntry,
+		"DELETE /api/v1/bluetooth/pairing-allowlist/:mac": ph.DeleteEntry,
+	}
+}
+
+// route returns the method and the path of the route matching an operation, e.g.
+// "DELETE /api/v1/tokens/:username"
+func (bh *BatchHandler) route(op BatchOperation) string {
+	path, _, _ := strings.Cut(op.Path, "?")
+	ctx := bh.e.NewContext(nil, nil)
+	bh.e.Router().Find(strings.ToUpper(op.Method), path, ctx)
+	return strings.ToUpper(op.Method) + " " + ctx.Path()
+}
+
+// runInTx runs an operation of an atomic batch with its handler bound to the transaction and
+// returns its status and JSON body
+func (bh *BatchHandler) runInTx(c echo.Context, index int, op BatchOperation, handler echo.HandlerFunc) (int, json.RawMessage) {
+	req, err := bh.newRequest(c, index, op)
+	if err != nil {
+		errBody, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return http.StatusBadRequest, errBody
+	}
+
+	rec := httptest.NewRecorder()
+	ctx := bh.e.NewContext(req, rec)
+	path, _, _ := strings.Cut(op.Path, "?")
+	bh.e.Router().Find(req.Method, path, ctx)
+	ctx.Set("username", c.Get("username"))
+	ctx.Set("is_admin", true)
+	ctx.Response().Header().Set(echo.HeaderXRequestID, req.Header.Get(echo.HeaderXRequestID))
+	if err := handler(ctx); err != nil {
+		bh.e.HTTPErrorHandler(err, ctx)
+	}
+	if respBody := bytes.TrimSpace(rec.Body.Bytes()); json.Valid(respBody) {
+		return rec.Code, respBody
+	}
+	return rec.Code, nil
+}
+
+// run dispatches an operation of a batch to the router and returns its status and JSON body
+func (bh *BatchHandler) run(c echo.Context, index int, op BatchOperation) (int, json.RawMessage) {
+	req, err := bh.newRequest(c, index, op)
+	if err != nil {
+		errBody, _ := json.Marshal(map[string]string{"error": err.Error()})
+		return http.StatusBadRequest, errBody
+	}
+
+	rec := httptest.NewRecorder()
+	bh.e.ServeHTTP(rec, req)
+	if respBody := bytes.TrimSpace(rec.Body.Bytes()); json.Valid(respBody) {
+		return rec.Code, respBody
+	}
+	return rec.Code, nil
+}
+
+// newRequest returns the request of an operation of a batch, with the credentials and the client
+// address of the batch
+func (bh *BatchHandler) newRequest(c echo.Context, index int, op BatchOperation) (*http.Request, error) {
+	body := []byte(op.Body)
+	path := BasePath(c) + op.Path
+	req, err := http.NewRequestWithContext(c.Request().Context(), strings.ToUpper(op.Method), path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.RequestURI = path
+	req.RemoteAddr = c.Request().RemoteAddr
+	req.Header.Set(echo.HeaderAccept, echo.MIMEApplicationJSON)
+	if len(body) > 0 {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	for _, name := range batchForwardedHeaders {
+		if value := c.Request().Header.Get(name); value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+	if id := RequestID(c); id != "" {
+		req.Header.Set(echo.HeaderXRequestID, id+"-"+strconv.Itoa(index))
+	}
+	return req, nil
+}
+
+func validateBatchOperation(op BatchOperation) error {
+	switch strings.ToUpper(op.Method) {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return fmt.Errorf("unsupported method %q", op.Method)
+	}
+
+	if !strings.HasPrefix(op.Path, "/api/v1/") {
+		return fmt.Errorf("path must start with /api/v1/")
+	}
+	if _, err := url.ParseRequestURI(op.Path); err != nil {
+		return fmt.Errorf("invalid path %q", op.Path)
+	}
+	path, _, _ := strings.Cut(op.Path, "?")
+	path = strings.TrimSuffix(path, "/")
+	if path == batchPath {
+		return fmt.Errorf("batches cannot be nested")
+	}
+	for _, streaming := range batchStreamingPaths {
+		if path == streaming {
+			return fmt.Errorf("%s streams its response and cannot be batched", streaming)
+		}
+	}
+	return nil
+}
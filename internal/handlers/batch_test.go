@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBatchTestServer() *echo.Echo {
+	e := echo.New()
+	auth := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get(echo.HeaderAuthorization) != "Bearer admin" {
+				return jsonError(c, http.StatusUnauthorized, "invalid bearer token")
+			}
+			return next(c)
+		}
+	}
+	e.POST("/api/v1/tokens", func(c echo.Context) error {
+		var req CreateTokenRequest
+		if err := c.Bind(&req); err != nil || req.Username == "" {
+			return jsonError(c, http.StatusBadRequest, "username and token are required")
+		}
+		return c.JSON(http.StatusCreated, map[string]string{"username": req.Username})
+	}, auth)
+	e.GET("/api/v1/tokens/:username", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"username": c.Param("username")})
+	}, auth)
+	e.POST("/api/v1/batch", NewBatchHandler(e, nil).Batch, auth)
+	return e
+}
+
+func TestBatchHandler_Batch(t *testing.T) {
+	tests := []struct {
+		name              string
+		body              string
+		expectedStatus    int
+		expectedSuccess   bool
+		expectedStatuses  []int
+		expectedSkipped   []bool
+		expectedCompleted int
+	}{
+		{
+			name: "success - every operation",
+			body: `{"operations": [
+				{"method": "POST", "path": "/api/v1/tokens", "body": {"username": "kitchen", "token": "secret"}},
+				{"method": "get", "path": "/api/v1/tokens/kitchen"}
+			]}`,
+			expectedStatus:    http.StatusOK,
+			expectedSuccess:   true,
+			expectedStatuses:  []int{http.StatusCreated, http.StatusOK},
+			expectedSkipped:   []bool{false, false},
+			expectedCompleted: 2,
+		},
+		{
+			name: "failure - stop on error",
+			body: `{"operations": [
+				{"method": "POST", "path": "/api/v1/tokens", "body": {}},
+				{"method": "GET", "path": "/api/v1/tokens/kitchen"}
+			]}`,
+			expectedStatus:    http.StatusOK,
+			expectedStatuses:  []int{http.StatusBadRequest, 0},
+			expectedSkipped:   []bool{false, true},
+			expectedCompleted: 1,
+		},
+		{
+			name: "failure - continue",
+			body: `{"mode": "continue", "operations": [
+				{"method": "GET", "path": "/api/v1/unknown"},
+				{"method": "GET", "path": "/api/v1/tokens/kitchen"}
+			]}`,
+			expectedStatus:    http.StatusOK,
+			expectedStatuses:  []int{http.StatusNotFound, http.StatusOK},
+			expectedSkipped:   []bool{false, false},
+			expectedCompleted: 2,
+		},
+		{
+			name:           "failure - nested batch",
+			body:           `{"operations": [{"method": "POST", "path": "/api/v1/batch", "body": {}}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - event stream",
+			body:           `{"operations": [{"method": "GET", "path": "/api/v1/events?types=battery_low"}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - pairing WebSocket",
+			body:           `{"operations": [{"method": "GET", "path": "/api/v1/bluetooth/pairing/ws/"}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - path outside the API",
+			body:           `{"operations": [{"method": "GET", "path": "/livez"}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - unknown mode",
+			body:           `{"mode": "all", "operations": [{"method": "GET", "path": "/api/v1/tokens/kitchen"}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - no operation",
+			body:           `{"operations": []}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/batch", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer admin")
+			rec := httptest.NewRecorder()
+			newBatchTestServer().ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp BatchResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedSuccess, resp.Success)
+			assert.Equal(t, tt.expectedCompleted, resp.Completed)
+			if assert.Len(t, resp.Results, len(tt.expectedStatuses)) {
+				for i, result := range resp.Results {
+					assert.Equal(t, i, result.Index)
+					assert.Equal(t, tt.expectedStatuses[i], result.Status)
+					assert.Equal(t, tt.expectedSkipped[i], result.Skipped)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchHandler_Batch_Body(t *testing.T) {
+	body := `{"operations": [{"method": "POST", "path": "/api/v1/tokens", "body": {"username": "kitchen", "token": "secret"}}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/batch", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer admin")
+	rec := httptest.NewRecorder()
+	newBatchTestServer().ServeHTTP(rec, req)
+
+	var resp BatchResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	if assert.Len(t, resp.Results, 1) {
+		assert.JSONEq(t, `{"username": "kitchen"}`, string(resp.Results[0].Body))
+	}
+}
+
+func TestBatchHandler_Batch_Atomic(t *testing.T) {
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "data.db"))
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, database.RunMigrations(db))
+
+	h := NewHandler(db, nil)
+	ph := NewPairingAllowlistHandler(db, nil)
+	e := echo.New()
+	e.POST("/api/v1/tokens", h.CreateToken)
+	e.DELETE("/api/v1/tokens/:username", h.DeleteToken)
+	e.GET("/api/v1/tokens/:username", h.GetToken)
+	e.POST("/api/v1/bluetooth/pairing-allowlist", ph.AddEntry)
+	e.POST("/api/v1/batch", NewBatchHandler(e, h).Batch, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("username", "admin")
+			c.Set("is_admin", c.Request().Header.Get(echo.HeaderAuthorization) == "Bearer admin")
+			return next(c)
+		}
+	})
+	batch := func(authorization, body string) (*httptest.ResponseRecorder, BatchResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/batch", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, authorization)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		var resp BatchResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+	tokenExists := func(username string) bool {
+		var count int
+		assert.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM user_tokens WHERE username = ?`, username).Scan(&count))
+		return count > 0
+	}
+
+	// Every operation succeeds, the transaction is committed
+	rec, resp := batch("Bearer admin", `{"mode": "atomic", "operations": [
+		{"method": "POST", "path": "/api/v1/tokens", "body": {"username": "kitchen", "token": "secret"}},
+		{"method": "POST", "path": "/api/v1/bluetooth/pairing-allowlist", "body": {"address": "aa:bb:cc:dd:ee:ff", "name": "Speaker"}}
+	]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, resp.Success)
+	assert.False(t, resp.RolledBack)
+	assert.Equal(t, 2, resp.Completed)
+	assert.True(t, tokenExists("kitchen"))
+	allowed, err := database.IsPairingAllowed(db, "AA:BB:CC:DD:EE:FF")
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+
+	// The second token already exists, the first one is rolled back and the last one skipped
+	rec, resp = batch("Bearer admin", `{"mode": "atomic", "operations": [
+		{"method": "POST", "path": "/api/v1/tokens", "body": {"username": "garage", "token": "secret"}},
+		{"method": "POST", "path": "/api/v1/tokens", "body": {"username": "kitchen", "token": "secret"}},
+		{"method": "DELETE", "path": "/api/v1/tokens/kitchen"}
+	]}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, resp.Success)
+	assert.True(t, resp.RolledBack)
+	if assert.Len(t, resp.Results, 3) {
+		assert.Equal(t, http.StatusCreated, resp.Results[0].Status)
+		assert.Equal(t, http.StatusConflict, resp.Results[1].Status)
+		assert.True(t, resp.Results[2].Skipped)
+	}
+	assert.False(t, tokenExists("garage"))
+
+	// Only the routes changing the database can run in a transaction
+	rec, _ = batch("Bearer admin", `{"mode": "atomic", "operations": [{"method": "GET", "path": "/api/v1/tokens/kitchen"}]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Atomic batches are restricted to admins
+	rec, _ = batch("Bearer kitchen", `{"mode": "atomic", "operations": [{"method": "DELETE", "path": "/api/v1/tokens/kitchen"}]}`)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.True(t, tokenExists("kitchen"))
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/beacon"
+)
+
+// BeaconsHandler exposes the beacons decoded by the beacon scanner
+type BeaconsHandler struct {
+	scanner *beacon.Scanner
+}
+
+// NewBeaconsHandler creates a new beacons handler
+func NewBeaconsHandler(scanner *beacon.Scanner) *BeaconsHandler {
+	return &BeaconsHandler{scanner: scanner}
+}
+
+// GetBeacons returns the beacons currently in range, optionally filtered by type
+func (bh *BeaconsHandler) GetBeacons(c echo.Context) error {
+	beacons := bh.scanner.Beacons()
+
+	if beaconType := c.QueryParam("type"); beaconType != "" {
+		filtered := make([]beacon.Beacon, 0, len(beacons))
+		for _, b := range beacons {
+			if b.Type == beaconType {
+				filtered = append(filtered, b)
+			}
+		}
+		beacons = filtered
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"beacons": beacons,
+	})
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/beacon"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBeaconsHandler_GetBeacons(t *testing.T) {
+	// Setup
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00"}}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66", ManufacturerData: map[uint16][]byte{0x004c: {
+			0x02, 0x15,
+			0xf7, 0x82, 0x6d, 0xa6, 0x4f, 0xa2, 0x4e, 0x98, 0x80, 0x24, 0xbc, 0x5b, 0x71, 0xe0, 0x89, 0x3e,
+			0x00, 0x01, 0x00, 0x2a,
+			0xc5,
+		}}},
+		{Address: "22:33:44:55:66:77", ServiceData: map[string][]byte{beacon.EddystoneServiceUUID: {
+			0x10, 0xf4, 0x03, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 0x07,
+		}}},
+	}, nil)
+
+	scanner := beacon.NewScanner(btMock, events.NewHub(), time.Minute, time.Minute)
+	scanner.Scan()
+	h := NewBeaconsHandler(scanner)
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedTypes []string
+	}{
+		{name: "every beacon", expectedTypes: []string{beacon.TypeIBeacon, beacon.TypeEddystoneURL}},
+		{name: "filtered by type", query: "?type=eddystone_url", expectedTypes: []string{beacon.TypeEddystoneURL}},
+		{name: "no beacon of the type", query: "?type=eddystone_tlm", expectedTypes: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/beacons"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			// Test
+			err := h.GetBeacons(e.NewContext(req, rec))
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Code)
+
+			var response map[string][]beacon.Beacon
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			if assert.Contains(t, response, "beacons") {
+				types := []string{}
+				for _, b := range response["beacons"] {
+					types = append(types, b.Type)
+				}
+				assert.Equal(t, tt.expectedTypes, types)
+			}
+		})
+	}
+}
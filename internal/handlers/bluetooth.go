@@ -1,24 +1,39 @@
 package handlers
 import (
+	"context"
+	"errors"
+	"log"
 	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/mgmt"
+	"github.com/nerzhul/home-bt-broker/internal/rfkill"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
 )
 
 // BluetoothHandler handles Bluetooth-related endpoints
 type BluetoothHandler struct {
 	btManager bluetooth.BluetoothManagerInterface
+	db        database.DatabaseInterface
+	cipher    *secrets.Cipher
 }
 
-// NewBluetoothHandler creates a new Bluetooth handler
-func NewBluetoothHandler() (*BluetoothHandler, error) {
-	btManager, err := bluetooth.NewBluetoothManager()
+// NewBluetoothHandler creates a new Bluetooth handler on the backend registered under a name
+func NewBluetoothHandler(backend string, opts bluetooth.Options, db database.DatabaseInterface, cipher *secrets.Cipher) (*BluetoothHandler, error) {
+	btManager, err := bluetooth.NewBackend(backend, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	return &BluetoothHandler{btManager: btManager}, nil
+	return &BluetoothHandler{btManager: btManager, db: db, cipher: cipher}, nil
 }
 
 // NewBluetoothHandlerWithManager creates a new Bluetooth handler with a custom manager (for testing)
@@ -26,6 +41,12 @@ func NewBluetoothHandlerWithManager(btManager bluetooth.BluetoothManagerInterfac
 	return &BluetoothHandler{btManager: btManager}
 }
 
+// NewBluetoothHandlerWithDB creates a new Bluetooth handler with a custom manager and database, the
+// device owners being encrypted with the cipher when it is enabled
+func NewBluetoothHandlerWithDB(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, cipher *secrets.Cipher) *BluetoothHandler {
+	return &BluetoothHandler{btManager: btManager, db: db, cipher: cipher}
+}
+
 // Close closes the Bluetooth manager connection
 func (bh *BluetoothHandler) Close() {
 	if bh.btManager != nil {
@@ -37,9 +58,7 @@ func (bh *BluetoothHandler) Close() {
 func (bh *BluetoothHandler) GetAdapters(c echo.Context) error {
 	adapters, err := bh.btManager.GetAdapters()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to get adapters: " + err.Error(),
-		})
+		return jsonError(c, http.StatusInternalServerError, "failed to get adapters: "+err.Error())
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -47,6 +66,41 @@ func (bh *BluetoothHandler) GetAdapters(c echo.Context) error {
 	})
 }
 
+// GetAdapterUUIDs returns the services registered on an adapter with their profile, e.g. to check
+// that the audio profiles a phone needs to route audio to the broker are offered
+func (bh *BluetoothHandler) GetAdapterUUIDs(c echo.Context) error {
+	adapters, err := bh.btManager.GetAdapters()
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get adapters: "+err.Error())
+	}
+
+	for _, adapter := range adapters {
+		if strings.EqualFold(adapter.Address, c.Param("adapter")) {
+			return c.JSON(http.StatusOK, map[string]interface{}{
+				"services": bluetooth.DescribeServices(adapter.UUIDs),
+			})
+		}
+	}
+
+	return jsonError(c, http.StatusNotFound, "adapter not found")
+}
+
+// setOwners fills in the owner of the devices paired through the API. The devices are returned
+// without owner when they cannot be read.
+func (bh *BluetoothHandler) setOwners(c echo.Context, devices []bluetooth.Device) {
+	if bh.db == nil || len(devices) == 0 {
+		return
+	}
+	owners, err := database.GetDeviceOwners(bh.db, bh.cipher)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return
+	}
+	for i := range devices {
+		devices[i].Owner = owners[strings.ToUpper(devices[i].Address)]
+	}
+}
+
 // GetAdaptersRaw returns all Bluetooth adapters (raw, for internal use)
 func (bh *BluetoothHandler) GetAdaptersRaw() ([]bluetooth.Adapter, error) {
 	return bh.btManager.GetAdapters()
@@ -56,26 +110,24 @@ func (bh *BluetoothHandler) GetAdaptersRaw() ([]bluetooth.Adapter, error) {
 func (bh *BluetoothHandler) GetDevices(c echo.Context) error {
 	adapterMAC := c.Param("adapter")
 	if adapterMAC == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "adapter MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
 	}
 
 	// Resolve MAC address to adapter path
 	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "adapter not found: " + err.Error(),
-		})
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
 	}
 
 	devices, err := bh.btManager.GetDevices(adapterPath)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to get devices: " + err.Error(),
-		})
+		return jsonError(c, http.StatusInternalServerError, "failed to get devices: "+err.Error())
 	}
 
+	devices = filterDevicesByType(devices, c.QueryParam("type"))
+	devices = filterDevicesByUUIDs(devices, c.QueryParams()["uuid"])
+	bh.setOwners(c, devices)
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"devices": devices,
 	})
@@ -85,26 +137,24 @@ func (bh *BluetoothHandler) GetDevices(c echo.Context) error {
 func (bh *BluetoothHandler) GetTrustedDevices(c echo.Context) error {
 	adapterMAC := c.Param("adapter")
 	if adapterMAC == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "adapter MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
 	}
 
 	// Resolve MAC address to adapter path
 	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "adapter not found: " + err.Error(),
-		})
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
 	}
 
 	devices, err := bh.btManager.GetTrustedDevices(adapterPath)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to get trusted devices: " + err.Error(),
-		})
+		return jsonError(c, http.StatusInternalServerError, "failed to get trusted devices: "+err.Error())
 	}
 
+	devices = filterDevicesByType(devices, c.QueryParam("type"))
+	devices = filterDevicesByUUIDs(devices, c.QueryParams()["uuid"])
+	bh.setOwners(c, devices)
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"trusted_devices": devices,
 	})
@@ -114,60 +164,147 @@ func (bh *BluetoothHandler) GetTrustedDevices(c echo.Context) error {
 func (bh *BluetoothHandler) GetConnectedDevices(c echo.Context) error {
 	adapterMAC := c.Param("adapter")
 	if adapterMAC == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "adapter MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
 	}
 
 	// Resolve MAC address to adapter path
 	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "adapter not found: " + err.Error(),
-		})
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
 	}
 
 	devices, err := bh.btManager.GetConnectedDevices(adapterPath)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to get connected devices: " + err.Error(),
-		})
+		return jsonError(c, http.StatusInternalServerError, "failed to get connected devices: "+err.Error())
 	}
 
+	devices = filterDevicesByType(devices, c.QueryParam("type"))
+	devices = filterDevicesByUUIDs(devices, c.QueryParams()["uuid"])
+	bh.setOwners(c, devices)
+
 	return c.JSON(http.StatusOK, map[string]interface{}{
 		"connected_devices": devices,
 	})
 }
 
+// GetNearbyDevices scans for a short time and returns the unpaired devices seen during the scan,
+// closest first, for a pairing UI
+func (bh *BluetoothHandler) GetNearbyDevices(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	if adapterMAC == "" {
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
+	}
+
+	duration := 5 * time.Second
+	if value := c.QueryParam("duration"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Second || d > 30*time.Second {
+			return jsonError(c, http.StatusBadRequest, "duration must be between 1s and 30s")
+		}
+		duration = d
+	}
+
+	adapters, err := bh.btManager.GetAdapters()
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get adapters: "+err.Error())
+	}
+	var adapter *bluetooth.Adapter
+	for i := range adapters {
+		if adapters[i].Address == adapterMAC {
+			adapter = &adapters[i]
+		}
+	}
+	if adapter == nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+adapterMAC)
+	}
+
+	// A discovery already running is left untouched, BlueZ refuses to start a second one
+	if !adapter.Discovering {
+		if err := bh.btManager.SetDiscovering(adapter.Path, true); err != nil {
+			return jsonError(c, http.StatusInternalServerError, "failed to start discovery: "+err.Error())
+		}
+		defer bh.btManager.SetDiscovering(adapter.Path, false)
+	}
+
+	select {
+	case <-time.After(duration):
+	case <-c.Request().Context().Done():
+		return nil
+	}
+
+	// Devices are listed before discovery stops, BlueZ clears their RSSI afterwards
+	devices, err := bh.btManager.GetDevices(adapter.Path)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get devices: "+err.Error())
+	}
+
+	nearby := []bluetooth.Device{}
+	for _, device := range devices {
+		if !device.Paired && device.RSSI != nil {
+			nearby = append(nearby, device)
+		}
+	}
+	sort.SliceStable(nearby, func(i, j int) bool {
+		return *nearby[i].RSSI > *nearby[j].RSSI
+	})
+
+	nearby = filterDevicesByType(nearby, c.QueryParam("type"))
+	nearby = filterDevicesByUUIDs(nearby, c.QueryParams()["uuid"])
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"devices": nearby,
+	})
+}
+
 // ConnectDevice connects to a device by MAC address using adapter MAC
 func (bh *BluetoothHandler) ConnectDevice(c echo.Context) error {
 	adapterMAC := c.Param("adapter")
 	macAddress := c.Param("mac")
 	
 	if adapterMAC == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "adapter MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
 	}
 	
 	if macAddress == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "device MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "device MAC address parameter is required")
+	}
+
+	var req ConnectDeviceRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	timeout := DefaultResolveTimeout
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 || d > MaxResolveTimeout {
+			return jsonError(c, http.StatusBadRequest, "timeout must be a duration between 1s and "+MaxResolveTimeout.String())
+		}
+		timeout = d
 	}
 
 	// Resolve MAC address to adapter path
 	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "adapter not found: " + err.Error(),
-		})
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
 	}
 
 	err = bh.btManager.ConnectDevice(adapterPath, macAddress)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to connect device: " + err.Error(),
+		return jsonError(c, http.StatusInternalServerError, "failed to connect device: "+err.Error())
+	}
+
+	if req.WaitResolved {
+		err := bluetooth.WaitServicesResolved(c.Request().Context(), bh.btManager, adapterPath, macAddress, timeout)
+		switch {
+		case errors.Is(err, bluetooth.ErrServicesNotResolved):
+			return jsonError(c, http.StatusRequestTimeout, "device services not resolved within "+timeout.String())
+		case errors.Is(err, bluetooth.ErrDeviceDisconnected):
+			return jsonError(c, http.StatusConflict, err.Error())
+		case err != nil:
+			return jsonError(c, http.StatusInternalServerError, err.Error())
+		}
+		return c.JSON(http.StatusOK, map[string]string{
+			"message": "device connected and its services resolved",
 		})
 	}
 
@@ -176,36 +313,44 @@ func (bh *BluetoothHandler) ConnectDevice(c echo.Context) error {
 	})
 }
 
+// DisconnectDevice disconnects a device by MAC address using adapter MAC
+func (bh *BluetoothHandler) DisconnectDevice(c echo.Context) error {
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	if err := bh.btManager.DisconnectDevice(adapterPath, c.Param("mac")); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to disconnect device: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "device disconnected successfully",
+	})
+}
+
 // TrustDevice trusts a device by MAC address using adapter MAC
 func (bh *BluetoothHandler) TrustDevice(c echo.Context) error {
 	adapterMAC := c.Param("adapter")
 	macAddress := c.Param("mac")
 	
 	if adapterMAC == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "adapter MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
 	}
 	
 	if macAddress == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "device MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "device MAC address parameter is required")
 	}
 
 	// Resolve MAC address to adapter path
 	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "adapter not found: " + err.Error(),
-		})
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
 	}
 
 	err = bh.btManager.TrustDevice(adapterPath, macAddress)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to trust device: " + err.Error(),
-		})
+		return jsonError(c, http.StatusInternalServerError, "failed to trust device: "+err.Error())
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{
@@ -213,72 +358,416 @@ func (bh *BluetoothHandler) TrustDevice(c echo.Context) error {
 	})
 }
 
+// SetWakeAllowed allows or forbids a device, such as a keyboard, to wake the host from suspend
+func (bh *BluetoothHandler) SetWakeAllowed(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	macAddress := c.Param("mac")
+
+	if adapterMAC == "" {
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
+	}
+
+	if macAddress == "" {
+		return jsonError(c, http.StatusBadRequest, "device MAC address parameter is required")
+	}
+
+	var req struct {
+		Enable *bool `json:"enable"`
+	}
+	if err := c.Bind(&req); err != nil || req.Enable == nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body: enable is required")
+	}
+
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	if err := bh.btManager.SetWakeAllowed(adapterPath, macAddress, *req.Enable); errors.Is(err, bluetooth.ErrUnsupportedBlueZ) {
+		return jsonError(c, http.StatusNotImplemented, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to set wake allowed: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "wake allowed updated"})
+}
+
+// SetVolume sets the AVRCP absolute volume of a connected audio device, in percent
+func (bh *BluetoothHandler) SetVolume(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	macAddress := c.Param("mac")
+
+	var req struct {
+		Volume *int `json:"volume"`
+	}
+	if err := c.Bind(&req); err != nil || req.Volume == nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body: volume is required")
+	}
+	if *req.Volume < 0 || *req.Volume > 100 {
+		return jsonError(c, http.StatusBadRequest, "volume must be between 0 and 100")
+	}
+
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	err = bh.btManager.SetVolume(adapterPath, macAddress, uint8(*req.Volume))
+	if errors.Is(err, bluetooth.ErrNoVolumeControl) {
+		return jsonError(c, http.StatusConflict, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to set volume: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "volume updated"})
+}
+
+// GetTrack returns the track played by the media player of a device, such as a connected phone
+func (bh *BluetoothHandler) GetTrack(c echo.Context) error {
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	track, err := bh.btManager.GetTrack(adapterPath, c.Param("mac"))
+	if errors.Is(err, bluetooth.ErrNoMediaPlayer) {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get track: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, track)
+}
+
+// GetLinkInfo returns the RSSI, transmit power and link quality of a connected device, read from the kernel
+func (bh *BluetoothHandler) GetLinkInfo(c echo.Context) error {
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	info, err := bh.btManager.GetLinkInfo(adapterPath, c.Param("mac"))
+	if errors.Is(err, mgmt.ErrNotConnected) {
+		return jsonError(c, http.StatusConflict, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, info)
+}
+
 // RemoveDevice removes a device by MAC address using adapter MAC
 func (bh *BluetoothHandler) RemoveDevice(c echo.Context) error {
 	adapterMAC := c.Param("adapter")
 	macAddress := c.Param("mac")
 	
 	if adapterMAC == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "adapter MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
 	}
 	
 	if macAddress == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "device MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "device MAC address parameter is required")
 	}
 
 	// Resolve MAC address to adapter path
 	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "adapter not found: " + err.Error(),
-		})
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
 	}
 
 	err = bh.btManager.RemoveDevice(adapterPath, macAddress)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to remove device: " + err.Error(),
+		return jsonError(c, http.StatusInternalServerError, "failed to remove device: "+err.Error())
+	}
+
+	if bh.db == nil {
+		return c.JSON(http.StatusOK, map[string]string{
+			"message": "device removed successfully",
 		})
 	}
 
-	return c.JSON(http.StatusOK, map[string]string{
+	// The device is gone from BlueZ, its stored history and metadata would only be orphaned
+	summary, err := database.PurgeDeviceData(bh.db, macAddress)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "device removed but failed to purge its data: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
 		"message": "device removed successfully",
+		"purged":  summary,
+	})
+}
+
+// ResetDeviceResult describes a device removed by an adapter reset
+type ResetDeviceResult struct {
+	Address string                       `json:"address"`
+	Purged  *database.DevicePurgeSummary `json:"purged,omitempty"`
+}
+
+// ResetAdapter removes every device of an adapter with its stored data, then powers the adapter on
+// and makes it non-discoverable
+func (bh *BluetoothHandler) ResetAdapter(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	if adapterMAC == "" {
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
+	}
+
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	devices, err := bh.btManager.GetDevices(adapterPath)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get devices: "+err.Error())
+	}
+
+	removed := []ResetDeviceResult{}
+	for _, device := range devices {
+		if err := bh.btManager.RemoveDevice(adapterPath, device.Address); err != nil {
+			return jsonError(c, http.StatusInternalServerError, "failed to remove device "+device.Address+": "+err.Error())
+		}
+
+		result := ResetDeviceResult{Address: device.Address}
+		if bh.db != nil {
+			if result.Purged, err = database.PurgeDeviceData(bh.db, device.Address); err != nil {
+				return jsonError(c, http.StatusInternalServerError, "device removed but failed to purge its data: "+err.Error())
+			}
+		}
+		removed = append(removed, result)
+	}
+
+	if err := bh.btManager.SetPowered(adapterPath, true); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to power adapter: "+err.Error())
+	}
+	if err := bh.btManager.SetDiscoverable(adapterPath, false); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to set discoverable: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":         "adapter reset successfully",
+		"removed_devices": removed,
+	})
+}
+
+const (
+	// DefaultResolveTimeout is how long a connection waits for the services of the device by default
+	DefaultResolveTimeout = 10 * time.Second
+	// MaxResolveTimeout is the longest a connection may wait for the services of the device
+	MaxResolveTimeout = time.Minute
+)
+
+// ConnectDeviceRequest is the optional body of a connection
+type ConnectDeviceRequest struct {
+	// WaitResolved waits for BlueZ to resolve the services of the device before answering
+	WaitResolved bool `json:"wait_resolved"`
+	// Timeout bounds the wait, as a duration such as "10s"
+	Timeout string `json:"timeout"`
+}
+
+// PowerCycleRequest configures an adapter power cycle
+type PowerCycleRequest struct {
+	// Delay between powering off and on, as a duration such as "2s"
+	Delay string `json:"delay"`
+	// Rfkill also soft blocks the radio while the adapter is off, resetting the kernel driver
+	Rfkill bool `json:"rfkill"`
+}
+
+// PowerCycleAdapter powers an adapter off and on again, to recover a controller that stopped responding
+func (bh *BluetoothHandler) PowerCycleAdapter(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	if adapterMAC == "" {
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
+	}
+
+	var req PowerCycleRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	delay := 2 * time.Second
+	if req.Delay != "" {
+		d, err := time.ParseDuration(req.Delay)
+		if err != nil || d < 0 || d > 30*time.Second {
+			return jsonError(c, http.StatusBadRequest, "delay must be a duration between 0s and 30s")
+		}
+		delay = d
+	}
+
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	var rfkillIndex uint32
+	if req.Rfkill {
+		if rfkillIndex, err = rfkill.AdapterIndex(path.Base(adapterPath)); err != nil {
+			return jsonError(c, http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	if err := bh.btManager.SetPowered(adapterPath, false); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to power off adapter: "+err.Error())
+	}
+
+	// A failed cycle does not leave the adapter blocked or powered off
+	blocked, poweredOff := false, true
+	defer func() {
+		if blocked {
+			if err := rfkill.SetSoftBlock(rfkillIndex, false); err != nil {
+				log.Printf("request_id=%s failed to unblock adapter %s: %v", RequestID(c), adapterMAC, err)
+			}
+		}
+		if poweredOff {
+			if err := bh.btManager.SetPowered(adapterPath, true); err != nil {
+				log.Printf("request_id=%s failed to power on adapter %s: %v", RequestID(c), adapterMAC, err)
+			}
+		}
+	}()
+
+	if req.Rfkill {
+		if err := rfkill.SetSoftBlock(rfkillIndex, true); err != nil {
+			return jsonError(c, http.StatusInternalServerError, err.Error())
+		}
+		blocked = true
+		time.Sleep(delay)
+		if err := rfkill.SetSoftBlock(rfkillIndex, false); err != nil {
+			return jsonError(c, http.StatusInternalServerError, err.Error())
+		}
+		blocked = false
+	}
+
+	// With rfkill, the controller is registered again by BlueZ after being unblocked
+	time.Sleep(delay)
+
+	poweredOff = false
+	if err := bh.btManager.SetPowered(adapterPath, true); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to power on adapter: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "adapter power cycled successfully",
+	})
+}
+
+// UnblockAdapter clears the rfkill soft block of an adapter radio
+func (bh *BluetoothHandler) UnblockAdapter(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	if adapterMAC == "" {
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
+	}
+
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	index, err := rfkill.AdapterIndex(path.Base(adapterPath))
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	if err := rfkill.SetSoftBlock(index, false); err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	states, err := rfkill.States()
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	if state := states[index]; state.HardBlocked {
+		return jsonError(c, http.StatusConflict, "adapter is hard blocked by a hardware switch")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "adapter unblocked successfully",
 	})
 }
 
+// PairDeviceRequest optionally supplies the credentials returned to BlueZ during pairing
+type PairDeviceRequest struct {
+	// PIN is used by legacy devices with a fixed PIN such as 0000
+	PIN string `json:"pin"`
+	// Passkey is a 6 digits passkey
+	Passkey *uint32 `json:"passkey"`
+}
+
+func (r PairDeviceRequest) validate() error {
+	if r.PIN != "" && r.Passkey != nil {
+		return errors.New("pin and passkey are mutually exclusive")
+	}
+	if len(r.PIN) > 16 {
+		return errors.New("pin must be at most 16 characters")
+	}
+	if r.Passkey != nil && *r.Passkey > 999999 {
+		return errors.New("passkey must be between 0 and 999999")
+	}
+	return nil
+}
+
 // PairDevice pairs with a device by MAC address using adapter MAC
 func (bh *BluetoothHandler) PairDevice(c echo.Context) error {
 	adapterMAC := c.Param("adapter")
 	macAddress := c.Param("mac")
 	
 	if adapterMAC == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "adapter MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
 	}
 	
 	if macAddress == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "device MAC address parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "device MAC address parameter is required")
+	}
+
+	var req PairDeviceRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	if err := req.validate(); err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+	sync := c.QueryParam("sync") == "true"
+	timeout := DefaultPairTimeout
+	if value := c.QueryParam("timeout"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 || d > MaxDeviceWaitTimeout {
+			return jsonError(c, http.StatusBadRequest, "timeout must be a duration between 1s and "+MaxDeviceWaitTimeout.String())
+		}
+		timeout = d
 	}
 
 	// Resolve MAC address to adapter path
 	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "adapter not found: " + err.Error(),
-		})
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
 	}
 
-	err = bh.btManager.PairDevice(adapterPath, macAddress)
+	pair := func() error {
+		if req.PIN != "" || req.Passkey != nil {
+			return bh.btManager.PairDeviceWithOptions(adapterPath, macAddress, bluetooth.PairOptions{PIN: req.PIN, Passkey: req.Passkey})
+		}
+		return bh.btManager.PairDevice(adapterPath, macAddress)
+	}
+	var device *bluetooth.Device
+	if sync {
+		device, err = bh.pairAndWait(c.Request().Context(), adapterPath, macAddress, timeout, pair)
+	} else {
+		err = pair()
+	}
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to pair device: " + err.Error(),
+		return pairError(c, err, timeout)
+	}
+
+	// The user pairing the device owns it, a failure to record it does not undo the pairing
+	if username, _ := c.Get("username").(string); bh.db != nil && username != "" {
+		owner := database.DeviceOwner{Address: macAddress, Owner: username, Adapter: adapterMAC, PairedAt: time.Now()}
+		if err := database.SetDeviceOwner(bh.db, bh.cipher, owner); err != nil {
+			log.Printf("request_id=%s %v", RequestID(c), err)
+		}
+	}
+
+	if sync {
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"message": "device paired successfully",
+			"device":  device,
 		})
 	}
 
@@ -287,42 +776,376 @@ func (bh *BluetoothHandler) PairDevice(c echo.Context) error {
 	})
 }
 
+// DefaultPairTimeout is how long a synchronous pairing may take by default, leaving time to answer
+// the pairing requests in manual mode
+const DefaultPairTimeout = time.Minute
+
+// pairAndWait pairs with a device and waits for its Paired property, cancelling the pairing when
+// the timeout elapses first
+func (bh *BluetoothHandler) pairAndWait(ctx context.Context, adapterPath, macAddress string, timeout time.Duration, pair func() error) (*bluetooth.Device, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() { result <- pair() }()
+	select {
+	case err := <-result:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		if err := bh.btManager.CancelPairing(adapterPath, macAddress); err != nil {
+			log.Printf("Failed to cancel the pairing with %s: %v", macAddress, err)
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, bluetooth.ErrPairingTimeout
+		}
+		return nil, ctx.Err()
+	}
+
+	return bluetooth.WaitPaired(ctx, bh.btManager, adapterPath, macAddress, timeout)
+}
+
+// pairError answers a failed pairing with the BlueZ error behind it, when there is one
+func pairError(c echo.Context, err error, timeout time.Duration) error {
+	var details map[string]string
+	status := http.StatusInternalServerError
+	switch name := bluetooth.BluezError(err); {
+	case errors.Is(err, bluetooth.ErrPairingTimeout):
+		return jsonError(c, http.StatusRequestTimeout, "device not paired within "+timeout.String())
+	case errors.Is(err, bluetooth.ErrDeviceGone):
+		return jsonError(c, http.StatusNotFound, "failed to pair device: "+err.Error())
+	case name == "org.bluez.Error.AlreadyExists" || name == "org.bluez.Error.InProgress":
+		status = http.StatusConflict
+		fallthrough
+	case name != "":
+		details = map[string]string{"bluez_error": name}
+	}
+	return jsonErrorWith(c, status, "failed to pair device: "+err.Error(), details)
+}
+
+// CancelPairing aborts an ongoing pairing with a device
+func (bh *BluetoothHandler) CancelPairing(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	macAddress := c.Param("mac")
+
+	if adapterMAC == "" {
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
+	}
+
+	if macAddress == "" {
+		return jsonError(c, http.StatusBadRequest, "device MAC address parameter is required")
+	}
+
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	if err := bh.btManager.CancelPairing(adapterPath, macAddress); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to cancel pairing: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "device pairing cancelled successfully",
+	})
+}
+
+// GetPairingRequests returns the agent requests waiting for a decision in manual pairing mode
+func (bh *BluetoothHandler) GetPairingRequests(c echo.Context) error {
+	requests, err := sessionPairingRequests(c, bh.btManager, bh.btManager.GetPairingRequests())
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"requests": requests,
+	})
+}
+
+// AcceptPairingRequest accepts a pending pairing request
+func (bh *BluetoothHandler) AcceptPairingRequest(c echo.Context) error {
+	return bh.respondPairingRequest(c, true)
+}
+
+// RejectPairingRequest rejects a pending pairing request
+func (bh *BluetoothHandler) RejectPairingRequest(c echo.Context) error {
+	return bh.respondPairingRequest(c, false)
+}
+
+func (bh *BluetoothHandler) respondPairingRequest(c echo.Context, accept bool) error {
+	id := c.Param("id")
+	if id == "" {
+		return jsonError(c, http.StatusBadRequest, "pairing request ID parameter is required")
+	}
+
+	// A pairing session only answers the requests of its adapter
+	if _, ok := c.Get(pairingSessionAdapterKey).(string); ok {
+		requests, err := sessionPairingRequests(c, bh.btManager, bh.btManager.GetPairingRequests())
+		if err != nil {
+			return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+		}
+		if !slices.ContainsFunc(requests, func(req bluetooth.PairingRequest) bool { return req.ID == id }) {
+			return jsonError(c, http.StatusNotFound, bluetooth.ErrPairingRequestNotFound.Error())
+		}
+	}
+
+	err := bh.btManager.RespondPairingRequest(id, accept)
+	if errors.Is(err, bluetooth.ErrPairingRequestNotFound) {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to answer pairing request: "+err.Error())
+	}
+
+	message := "pairing request rejected"
+	if accept {
+		message = "pairing request accepted"
+	}
+	return c.JSON(http.StatusOK, map[string]string{"message": message})
+}
+
 // SetDiscoverable enables or disables discoverable mode on an adapter
 func (bh *BluetoothHandler) SetDiscoverable(c echo.Context) error {
        adapterMAC := c.Param("adapter")
        if adapterMAC == "" {
-	       return c.JSON(http.StatusBadRequest, map[string]string{"error": "adapter MAC address parameter is required"})
+	       return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
        }
        var req struct{ Enable bool `json:"enable"` }
        if err := c.Bind(&req); err != nil {
-	       return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	       return jsonError(c, http.StatusBadRequest, "invalid request body")
        }
        adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
        if err != nil {
-	       return c.JSON(http.StatusNotFound, map[string]string{"error": "adapter not found: " + err.Error()})
+	       return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
        }
        if err := bh.btManager.SetDiscoverable(adapterPath, req.Enable); err != nil {
-	       return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to set discoverable: " + err.Error()})
+	       return jsonError(c, http.StatusInternalServerError, "failed to set discoverable: "+err.Error())
        }
        return c.JSON(http.StatusOK, map[string]string{"message": "discoverable updated"})
 }
 
+// SetDiscoveringRequest enables or disables discovery, optionally restricted to one transport
+type SetDiscoveringRequest struct {
+	Enable bool `json:"enable"`
+	// Transport is "auto" (default), "le" or "bredr"
+	Transport string `json:"transport"`
+	// DuplicateData keeps reporting advertisements of already discovered devices
+	DuplicateData *bool `json:"duplicate_data"`
+}
+
 // SetDiscovering enables or disables device scanning (discovery) on an adapter
 func (bh *BluetoothHandler) SetDiscovering(c echo.Context) error {
        adapterMAC := c.Param("adapter")
        if adapterMAC == "" {
-	       return c.JSON(http.StatusBadRequest, map[string]string{"error": "adapter MAC address parameter is required"})
+	       return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
        }
-       var req struct{ Enable bool `json:"enable"` }
+       var req SetDiscoveringRequest
        if err := c.Bind(&req); err != nil {
-	       return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+	       return jsonError(c, http.StatusBadRequest, "invalid request body")
+       }
+       if req.Transport == "" {
+	       req.Transport = bluetooth.TransportAuto
+       } else if !bluetooth.ValidTransport(req.Transport) {
+	       return jsonError(c, http.StatusBadRequest, "transport must be one of auto, le or bredr")
        }
        adapterPath, err := bh.btManager.GetAdapterPathByMAC(adapterMAC)
        if err != nil {
-	       return c.JSON(http.StatusNotFound, map[string]string{"error": "adapter not found: " + err.Error()})
+	       return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+       }
+       // The filter is kept by BlueZ between sessions, so it is always set to drop a previous restriction
+       if req.Enable {
+	       filter := bluetooth.DiscoveryFilter{Transport: req.Transport, DuplicateData: req.DuplicateData}
+	       if err := bh.btManager.SetDiscoveryFilter(adapterPath, filter); err != nil {
+		       return jsonError(c, http.StatusInternalServerError, "failed to set discovery filter: "+err.Error())
+	       }
        }
        if err := bh.btManager.SetDiscovering(adapterPath, req.Enable); err != nil {
-	       return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to set discovering: " + err.Error()})
+	       return jsonError(c, http.StatusInternalServerError, "failed to set discovering: "+err.Error())
        }
        return c.JSON(http.StatusOK, map[string]string{"message": "discovering updated"})
-}
\ No newline at end of file
+}
+
+// GetBatteryHistory returns the recorded battery levels of a device
+func (bh *BluetoothHandler) GetBatteryHistory(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	macAddress := c.Param("mac")
+
+	if adapterMAC == "" {
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
+	}
+
+	if macAddress == "" {
+		return jsonError(c, http.StatusBadRequest, "device MAC address parameter is required")
+	}
+
+	since, limit, err := parseHistoryQuery(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := bh.btManager.GetAdapterPathByMAC(adapterMAC); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	samples, err := database.GetBatteryHistory(bh.db, strings.ToUpper(adapterMAC), strings.ToUpper(macAddress), since, limit)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get battery history: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"history": samples,
+	})
+}
+
+// parseHistoryQuery parses the since (RFC3339 time or duration back from now, default 24h) and
+// limit (default 1000) query parameters of history endpoints
+func parseHistoryQuery(c echo.Context) (time.Time, int, error) {
+	since := time.Now().Add(-24 * time.Hour)
+	if value := c.QueryParam("since"); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, value); err == nil {
+			since = t
+		} else {
+			return time.Time{}, 0, errInvalidSince
+		}
+	}
+
+	limit := 1000
+	if value := c.QueryParam("limit"); value != "" {
+		l, err := strconv.Atoi(value)
+		if err != nil || l <= 0 {
+			return time.Time{}, 0, errInvalidLimit
+		}
+		limit = l
+	}
+
+	return since, limit, nil
+}
+
+// TrackRSSI enables periodic RSSI recording for a device, as seen by an adapter
+func (bh *BluetoothHandler) TrackRSSI(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	macAddress := c.Param("mac")
+
+	if adapterMAC == "" {
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
+	}
+
+	if macAddress == "" {
+		return jsonError(c, http.StatusBadRequest, "device MAC address parameter is required")
+	}
+
+	if _, err := bh.btManager.GetAdapterPathByMAC(adapterMAC); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	if err := database.TrackRSSI(bh.db, adapterMAC, macAddress); err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "device RSSI tracking enabled",
+	})
+}
+
+// UntrackRSSI disables periodic RSSI recording for a device on an adapter, keeping its recorded history
+func (bh *BluetoothHandler) UntrackRSSI(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	macAddress := c.Param("mac")
+
+	if adapterMAC == "" {
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
+	}
+
+	if macAddress == "" {
+		return jsonError(c, http.StatusBadRequest, "device MAC address parameter is required")
+	}
+
+	if _, err := bh.btManager.GetAdapterPathByMAC(adapterMAC); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	if err := database.UntrackRSSI(bh.db, adapterMAC, macAddress); err != nil {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "device RSSI tracking disabled",
+	})
+}
+
+// GetRSSIHistory returns the recorded RSSI samples of a device
+func (bh *BluetoothHandler) GetRSSIHistory(c echo.Context) error {
+	adapterMAC := c.Param("adapter")
+	macAddress := c.Param("mac")
+
+	if adapterMAC == "" {
+		return jsonError(c, http.StatusBadRequest, "adapter MAC address parameter is required")
+	}
+
+	if macAddress == "" {
+		return jsonError(c, http.StatusBadRequest, "device MAC address parameter is required")
+	}
+
+	since, limit, err := parseHistoryQuery(c)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	if _, err := bh.btManager.GetAdapterPathByMAC(adapterMAC); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	samples, err := database.GetRSSIHistory(bh.db, strings.ToUpper(adapterMAC), strings.ToUpper(macAddress), since, limit)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get RSSI history: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"history": samples,
+	})
+}
+
+// filterDevicesByType keeps the devices whose decoded class type or subtype matches deviceType.
+// An empty deviceType keeps every device.
+func filterDevicesByType(devices []bluetooth.Device, deviceType string) []bluetooth.Device {
+	if deviceType == "" {
+		return devices
+	}
+
+	filtered := []bluetooth.Device{}
+	for _, device := range devices {
+		if device.Type == deviceType || device.Subtype == deviceType {
+			filtered = append(filtered, device)
+		}
+	}
+	return filtered
+}
+
+// filterDevicesByUUIDs keeps the devices advertising every given service UUID.
+// UUIDs may be given in their short 16 bits form, e.g. 110b for A2DP sinks.
+func filterDevicesByUUIDs(devices []bluetooth.Device, uuids []string) []bluetooth.Device {
+	if len(uuids) == 0 {
+		return devices
+	}
+
+	filtered := []bluetooth.Device{}
+	for _, device := range devices {
+		advertised := map[string]bool{}
+		for _, uuid := range device.UUIDs {
+			advertised[bluetooth.NormalizeUUID(uuid)] = true
+		}
+
+		matches := true
+		for _, uuid := range uuids {
+			if !advertised[bluetooth.NormalizeUUID(uuid)] {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			filtered = append(filtered, device)
+		}
+	}
+	return filtered
+}
@@ -3,13 +3,24 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/godbus/dbus/v5"
 	"github.com/labstack/echo/v4"
 	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/mgmt"
+	"github.com/nerzhul/home-bt-broker/internal/rfkill"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestBluetoothHandler_GetAdapters(t *testing.T) {
@@ -400,6 +411,139 @@ func TestBluetoothHandler_PairDevice(t *testing.T) {
 	}
 }
 
+func TestBluetoothHandler_PairDevice_WithCredentials(t *testing.T) {
+	passkey := uint32(123456)
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*bluetooth.MockBluetoothManager)
+		expectedStatus int
+		expectedBody   map[string]string
+	}{
+		{
+			name: "success - fixed PIN",
+			body: `{"pin": "0000"}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("PairDeviceWithOptions", "/org/bluez/hci0", "11:22:33:44:55:66", bluetooth.PairOptions{PIN: "0000"}).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]string{"message": "device pairing initiated successfully"},
+		},
+		{
+			name: "success - passkey",
+			body: `{"passkey": 123456}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("PairDeviceWithOptions", "/org/bluez/hci0", "11:22:33:44:55:66", bluetooth.PairOptions{Passkey: &passkey}).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]string{"message": "device pairing initiated successfully"},
+		},
+		{
+			name:           "failure - passkey out of range",
+			body:           `{"passkey": 1000000}`,
+			setupMock:      func(mock *bluetooth.MockBluetoothManager) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   map[string]string{"error": "passkey must be between 0 and 999999"},
+		},
+		{
+			name:           "failure - both PIN and passkey",
+			body:           `{"pin": "0000", "passkey": 1}`,
+			setupMock:      func(mock *bluetooth.MockBluetoothManager) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   map[string]string{"error": "pin and passkey are mutually exclusive"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mock := bluetooth.NewMockBluetoothManager(t)
+			tt.setupMock(mock)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/pair", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+
+			h := NewBluetoothHandlerWithManager(mock)
+
+			// Test
+			err := h.PairDevice(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+
+			var response map[string]string
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, response)
+		})
+	}
+}
+
+func TestBluetoothHandler_CancelPairing(t *testing.T) {
+	tests := []struct {
+		name           string
+		setupMock      func(*bluetooth.MockBluetoothManager)
+		expectedStatus int
+		expectedBody   map[string]string
+	}{
+		{
+			name: "success - pairing cancelled",
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("CancelPairing", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]string{"message": "device pairing cancelled successfully"},
+		},
+		{
+			name: "failure - no pairing in progress",
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("CancelPairing", "/org/bluez/hci0", "11:22:33:44:55:66").Return(errors.New("org.bluez.Error.DoesNotExist"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedBody:   map[string]string{"error": "failed to cancel pairing: org.bluez.Error.DoesNotExist"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mock := bluetooth.NewMockBluetoothManager(t)
+			tt.setupMock(mock)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/pair/cancel", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+
+			h := NewBluetoothHandlerWithManager(mock)
+
+			// Test
+			err := h.CancelPairing(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+
+			var response map[string]string
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, response)
+		})
+	}
+}
+
 func TestBluetoothHandler_TrustDevice(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -524,4 +668,960 @@ func TestBluetoothHandler_RemoveDevice(t *testing.T) {
 			assert.Equal(t, tt.expectedBody, response)
 		})
 	}
-}
\ No newline at end of file
+}
+func TestBluetoothHandler_RemoveDevice_PurgesData(t *testing.T) {
+	// Setup
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+	btMock.On("RemoveDevice", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil)
+
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("DELETE FROM battery_history").WithArgs("11:22:33:44:55:66").WillReturnResult(sqlmock.NewResult(0, 12))
+	dbMock.ExpectExec("DELETE FROM rssi_history").WithArgs("11:22:33:44:55:66").WillReturnResult(sqlmock.NewResult(0, 40))
+	dbMock.ExpectExec("DELETE FROM rssi_tracked_devices").WithArgs("11:22:33:44:55:66").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM presence_devices").WithArgs("11:22:33:44:55:66").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM device_audio_settings").WithArgs("11:22:33:44:55:66").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM device_reconnect").WithArgs("11:22:33:44:55:66").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM guest_trusts").WithArgs("11:22:33:44:55:66").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM device_owners").WithArgs("11:22:33:44:55:66").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM known_devices").WithArgs("11:22:33:44:55:66").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("adapter", "mac")
+	c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+
+	h := NewBluetoothHandlerWithDB(btMock, db, nil)
+
+	// Test
+	assert.NoError(t, h.RemoveDevice(c))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{
+		"message": "device removed successfully",
+		"purged": {"battery_samples": 12, "rssi_samples": 40, "rssi_tracking": 1, "presence_devices": 0, "audio_settings": 1, "reconnect": 0, "guest_trust": 0, "owner": 1, "known_device": 1}
+	}`, rec.Body.String())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestBluetoothHandler_ResetAdapter(t *testing.T) {
+	// Setup
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66"},
+		{Address: "22:33:44:55:66:77"},
+	}, nil)
+	btMock.On("RemoveDevice", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil)
+	btMock.On("RemoveDevice", "/org/bluez/hci0", "22:33:44:55:66:77").Return(nil)
+	btMock.On("SetPowered", "/org/bluez/hci0", true).Return(nil)
+	btMock.On("SetDiscoverable", "/org/bluez/hci0", false).Return(nil)
+
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	for _, address := range []string{"11:22:33:44:55:66", "22:33:44:55:66:77"} {
+		dbMock.ExpectBegin()
+		for _, table := range []string{"battery_history", "rssi_history", "rssi_tracked_devices", "presence_devices", "device_audio_settings", "device_reconnect", "guest_trusts", "device_owners", "known_devices"} {
+			dbMock.ExpectExec("DELETE FROM " + table).WithArgs(address).WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		dbMock.ExpectCommit()
+	}
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/reset", nil), rec)
+	c.SetParamNames("adapter")
+	c.SetParamValues("AA:BB:CC:DD:EE:00")
+
+	h := NewBluetoothHandlerWithDB(btMock, db, nil)
+
+	// Test
+	assert.NoError(t, h.ResetAdapter(c))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		RemovedDevices []ResetDeviceResult `json:"removed_devices"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response.RemovedDevices, 2)
+	assert.Equal(t, int64(1), response.RemovedDevices[0].Purged.BatterySamples)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestBluetoothHandler_PowerCycleAdapter(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*bluetooth.MockBluetoothManager)
+		expectedStatus int
+	}{
+		{
+			name: "success - power cycled",
+			body: `{"delay": "0s"}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetPowered", "/org/bluez/hci0", false).Return(nil).Once()
+				mock.On("SetPowered", "/org/bluez/hci0", true).Return(nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - delay too long",
+			body:           `{"delay": "5m"}`,
+			setupMock:      func(mock *bluetooth.MockBluetoothManager) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "failure - power off error",
+			body: `{"delay": "0s"}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetPowered", "/org/bluez/hci0", false).Return(errors.New("not ready"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "failure - rfkill error powers the adapter back on",
+			body: `{"delay": "0s", "rfkill": true}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetPowered", "/org/bluez/hci0", false).Return(nil).Once()
+				mock.On("SetPowered", "/org/bluez/hci0", true).Return(nil).Once()
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "failure - power on error",
+			body: `{"delay": "0s"}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetPowered", "/org/bluez/hci0", false).Return(nil).Once()
+				mock.On("SetPowered", "/org/bluez/hci0", true).Return(errors.New("not ready")).Once()
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	// hci0 has an rfkill switch, but the rfkill device cannot be opened
+	sysfsPath, devicePath := rfkill.SysfsPath, rfkill.DevicePath
+	defer func() { rfkill.SysfsPath, rfkill.DevicePath = sysfsPath, devicePath }()
+	rfkill.SysfsPath = t.TempDir()
+	rfkill.DevicePath = filepath.Join(t.TempDir(), "missing")
+	assert.NoError(t, os.MkdirAll(filepath.Join(rfkill.SysfsPath, "hci0", "rfkill3"), 0755))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mock := bluetooth.NewMockBluetoothManager(t)
+			tt.setupMock(mock)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/power-cycle", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter")
+			c.SetParamValues("AA:BB:CC:DD:EE:00")
+
+			h := NewBluetoothHandlerWithManager(mock)
+
+			// Test
+			err := h.PowerCycleAdapter(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestBluetoothHandler_GetBatteryHistory(t *testing.T) {
+	tests := []struct {
+		name           string
+		adapterMAC     string
+		deviceMAC      string
+		query          string
+		setupMock      func(*bluetooth.MockBluetoothManager, sqlmock.Sqlmock)
+		expectedStatus int
+		expectedCount  int
+	}{
+		{
+			name:       "success - returns history",
+			adapterMAC: "AA:BB:CC:DD:EE:00",
+			deviceMAC:  "11:22:33:44:55:66",
+			query:      "?since=1h&limit=10",
+			setupMock: func(btMock *bluetooth.MockBluetoothManager, dbMock sqlmock.Sqlmock) {
+				btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				rows := sqlmock.NewRows([]string{"adapter", "address", "percentage", "recorded_at"}).
+					AddRow("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66", 80, time.Now().Add(-30*time.Minute)).
+					AddRow("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66", 75, time.Now())
+				dbMock.ExpectQuery("SELECT adapter, address, percentage, recorded_at FROM battery_history").
+					WithArgs("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66", sqlmock.AnyArg(), 10).
+					WillReturnRows(rows)
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  2,
+		},
+		{
+			name:       "success - only the samples of the adapter, with lower case addresses",
+			adapterMAC: "aa:bb:cc:dd:ee:01",
+			deviceMAC:  "11:22:33:44:55:66",
+			setupMock: func(btMock *bluetooth.MockBluetoothManager, dbMock sqlmock.Sqlmock) {
+				btMock.On("GetAdapterPathByMAC", "aa:bb:cc:dd:ee:01").Return("/org/bluez/hci1", nil)
+				dbMock.ExpectQuery("SELECT adapter, address, percentage, recorded_at FROM battery_history\\s+WHERE adapter = \\? AND address = \\?").
+					WithArgs("AA:BB:CC:DD:EE:01", "11:22:33:44:55:66", sqlmock.AnyArg(), 1000).
+					WillReturnRows(sqlmock.NewRows([]string{"adapter", "address", "percentage", "recorded_at"}))
+			},
+			expectedStatus: http.StatusOK,
+			expectedCount:  0,
+		},
+		{
+			name:       "failure - invalid since",
+			adapterMAC: "AA:BB:CC:DD:EE:00",
+			deviceMAC:  "11:22:33:44:55:66",
+			query:      "?since=yesterday",
+			setupMock: func(btMock *bluetooth.MockBluetoothManager, dbMock sqlmock.Sqlmock) {
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "failure - adapter not found",
+			adapterMAC: "FF:FF:FF:FF:FF:FF",
+			deviceMAC:  "11:22:33:44:55:66",
+			setupMock: func(btMock *bluetooth.MockBluetoothManager, dbMock sqlmock.Sqlmock) {
+				btMock.On("GetAdapterPathByMAC", "FF:FF:FF:FF:FF:FF").Return("", errors.New("adapter with MAC address FF:FF:FF:FF:FF:FF not found"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			btMock := bluetooth.NewMockBluetoothManager(t)
+			db, dbMock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			tt.setupMock(btMock, dbMock)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/"+tt.adapterMAC+"/devices/"+tt.deviceMAC+"/battery/history"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues(tt.adapterMAC, tt.deviceMAC)
+
+			h := NewBluetoothHandlerWithDB(btMock, db, nil)
+
+			// Test
+			err = h.GetBatteryHistory(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+
+			if tt.expectedStatus == http.StatusOK {
+				var response map[string][]database.BatterySample
+				err = json.Unmarshal(rec.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.Len(t, response["history"], tt.expectedCount)
+			}
+
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestBluetoothHandler_RSSITracking(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		setupMock      func(*bluetooth.MockBluetoothManager, sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:   "success - tracking enabled, with the addresses in upper case",
+			method: http.MethodPost,
+			setupMock: func(btMock *bluetooth.MockBluetoothManager, dbMock sqlmock.Sqlmock) {
+				btMock.On("GetAdapterPathByMAC", "aa:bb:cc:dd:ee:00").Return("/org/bluez/hci0", nil)
+				dbMock.ExpectExec("INSERT OR IGNORE INTO rssi_tracked_devices").
+					WithArgs("AA:BB:CC:DD:EE:00", "11:22:33:44:55:FF", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "success - tracking disabled",
+			method: http.MethodDelete,
+			setupMock: func(btMock *bluetooth.MockBluetoothManager, dbMock sqlmock.Sqlmock) {
+				btMock.On("GetAdapterPathByMAC", "aa:bb:cc:dd:ee:00").Return("/org/bluez/hci0", nil)
+				dbMock.ExpectExec("DELETE FROM rssi_tracked_devices WHERE adapter = \\? AND address = \\?").
+					WithArgs("AA:BB:CC:DD:EE:00", "11:22:33:44:55:FF").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "failure - device not tracked",
+			method: http.MethodDelete,
+			setupMock: func(btMock *bluetooth.MockBluetoothManager, dbMock sqlmock.Sqlmock) {
+				btMock.On("GetAdapterPathByMAC", "aa:bb:cc:dd:ee:00").Return("/org/bluez/hci0", nil)
+				dbMock.ExpectExec("DELETE FROM rssi_tracked_devices WHERE adapter = \\? AND address = \\?").
+					WithArgs("AA:BB:CC:DD:EE:00", "11:22:33:44:55:FF").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			btMock := bluetooth.NewMockBluetoothManager(t)
+			db, dbMock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			tt.setupMock(btMock, dbMock)
+
+			e := echo.New()
+			req := httptest.NewRequest(tt.method, "/api/v1/bluetooth/adapters/aa:bb:cc:dd:ee:00/devices/11:22:33:44:55:ff/rssi/tracking", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues("aa:bb:cc:dd:ee:00", "11:22:33:44:55:ff")
+
+			h := NewBluetoothHandlerWithDB(btMock, db, nil)
+
+			// Test
+			if tt.method == http.MethodPost {
+				err = h.TrackRSSI(c)
+			} else {
+				err = h.UntrackRSSI(c)
+			}
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestBluetoothHandler_GetDevices_TypeFilter(t *testing.T) {
+	// Setup
+	mock := bluetooth.NewMockBluetoothManager(t)
+	mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+	mock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66", Type: "audio_video", Subtype: "headset"},
+		{Address: "22:33:44:55:66:77", Type: "peripheral", Subtype: "keyboard"},
+		{Address: "33:44:55:66:77:88", Type: "audio_video", Subtype: "loudspeaker"},
+	}, nil)
+
+	h := NewBluetoothHandlerWithManager(mock)
+
+	for query, expected := range map[string]int{"audio_video": 2, "keyboard": 1, "wearable": 0} {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices?type="+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("adapter")
+		c.SetParamValues("AA:BB:CC:DD:EE:00")
+
+		// Test
+		err := h.GetDevices(c)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response map[string][]bluetooth.Device
+		err = json.Unmarshal(rec.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Len(t, response["devices"], expected, query)
+	}
+}
+
+func TestBluetoothHandler_GetDevices_UUIDFilter(t *testing.T) {
+	// Setup
+	mock := bluetooth.NewMockBluetoothManager(t)
+	mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+	mock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66", UUIDs: []string{"0000110b-0000-1000-8000-00805f9b34fb", "0000110e-0000-1000-8000-00805f9b34fb"}},
+		{Address: "22:33:44:55:66:77", UUIDs: []string{"0000110b-0000-1000-8000-00805f9b34fb"}},
+		{Address: "33:44:55:66:77:88", UUIDs: []string{"00001124-0000-1000-8000-00805f9b34fb"}},
+	}, nil)
+
+	h := NewBluetoothHandlerWithManager(mock)
+
+	for query, expected := range map[string]int{
+		"uuid=110b":           2,
+		"uuid=110b&uuid=110e": 1,
+		"uuid=1108":           0,
+		"uuid=0000110B-0000-1000-8000-00805F9B34FB": 2,
+	} {
+		e := echo.New()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("adapter")
+		c.SetParamValues("AA:BB:CC:DD:EE:00")
+
+		// Test
+		err := h.GetDevices(c)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var response map[string][]bluetooth.Device
+		err = json.Unmarshal(rec.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		assert.Len(t, response["devices"], expected, query)
+	}
+}
+
+func TestBluetoothHandler_GetNearbyDevices(t *testing.T) {
+	// Setup
+	near, far := int16(-40), int16(-80)
+	mock := bluetooth.NewMockBluetoothManager(t)
+	mock.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00"},
+	}, nil)
+	mock.On("SetDiscovering", "/org/bluez/hci0", true).Return(nil).Once()
+	mock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66", RSSI: &far},
+		{Address: "22:33:44:55:66:77", RSSI: &near},
+		{Address: "33:44:55:66:77:88", RSSI: &near, Paired: true},
+		{Address: "44:55:66:77:88:99"},
+	}, nil)
+	mock.On("SetDiscovering", "/org/bluez/hci0", false).Return(nil).Once()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/nearby?duration=1s", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("adapter")
+	c.SetParamValues("AA:BB:CC:DD:EE:00")
+
+	h := NewBluetoothHandlerWithManager(mock)
+
+	// Test
+	err := h.GetNearbyDevices(c)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response map[string][]bluetooth.Device
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response["devices"], 2)
+	assert.Equal(t, "22:33:44:55:66:77", response["devices"][0].Address)
+	assert.Equal(t, "11:22:33:44:55:66", response["devices"][1].Address)
+}
+
+func TestBluetoothHandler_SetWakeAllowed(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*bluetooth.MockBluetoothManager)
+		expectedStatus int
+	}{
+		{
+			name: "success - wake allowed",
+			body: `{"enable": true}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetWakeAllowed", "/org/bluez/hci0", "11:22:33:44:55:66", true).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - missing enable",
+			body:           `{}`,
+			setupMock:      func(mock *bluetooth.MockBluetoothManager) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "failure - property not supported",
+			body: `{"enable": false}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetWakeAllowed", "/org/bluez/hci0", "11:22:33:44:55:66", false).Return(errors.New("not supported"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name: "failure - BlueZ too old",
+			body: `{"enable": true}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetWakeAllowed", "/org/bluez/hci0", "11:22:33:44:55:66", true).Return(fmt.Errorf("wake allowed requires BlueZ 5.51 or later: %w", bluetooth.ErrUnsupportedBlueZ))
+			},
+			expectedStatus: http.StatusNotImplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mock := bluetooth.NewMockBluetoothManager(t)
+			tt.setupMock(mock)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/wake-allowed", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+
+			h := NewBluetoothHandlerWithManager(mock)
+
+			// Test
+			err := h.SetWakeAllowed(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestBluetoothHandler_SetVolume(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*bluetooth.MockBluetoothManager)
+		expectedStatus int
+	}{
+		{
+			name: "success - volume set",
+			body: `{"volume": 40}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetVolume", "/org/bluez/hci0", "11:22:33:44:55:66", uint8(40)).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - volume out of range",
+			body:           `{"volume": 101}`,
+			setupMock:      func(mock *bluetooth.MockBluetoothManager) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - missing volume",
+			body:           `{}`,
+			setupMock:      func(mock *bluetooth.MockBluetoothManager) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "failure - no absolute volume",
+			body: `{"volume": 10}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetVolume", "/org/bluez/hci0", "11:22:33:44:55:66", uint8(10)).Return(bluetooth.ErrNoVolumeControl)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := bluetooth.NewMockBluetoothManager(t)
+			tt.setupMock(mock)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/volume", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+
+			h := NewBluetoothHandlerWithManager(mock)
+
+			err := h.SetVolume(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestBluetoothHandler_GetTrack(t *testing.T) {
+	tests := []struct {
+		name           string
+		setupMock      func(*bluetooth.MockBluetoothManager)
+		expectedStatus int
+		expectedTitle  string
+	}{
+		{
+			name: "success - track returned",
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("GetTrack", "/org/bluez/hci0", "11:22:33:44:55:66").Return(&bluetooth.Track{Title: "Song", Position: 1000}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedTitle:  "Song",
+		},
+		{
+			name: "failure - no media player",
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("GetTrack", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil, bluetooth.ErrNoMediaPlayer)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "failure - adapter not found",
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("", errors.New("adapter not found"))
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := bluetooth.NewMockBluetoothManager(t)
+			tt.setupMock(mock)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/media/track", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+
+			h := NewBluetoothHandlerWithManager(mock)
+
+			err := h.GetTrack(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedTitle != "" {
+				var track bluetooth.Track
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &track))
+				assert.Equal(t, tt.expectedTitle, track.Title)
+			}
+		})
+	}
+}
+
+func TestBluetoothHandler_GetAdapterUUIDs(t *testing.T) {
+	mock := bluetooth.NewMockBluetoothManager(t)
+	mock.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Address: "AA:BB:CC:DD:EE:00", UUIDs: []string{"0000110b-0000-1000-8000-00805f9b34fb"}},
+	}, nil)
+	h := NewBluetoothHandlerWithManager(mock)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/aa:bb:cc:dd:ee:00/uuids", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("adapter")
+	c.SetParamValues("aa:bb:cc:dd:ee:00")
+
+	assert.NoError(t, h.GetAdapterUUIDs(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"services":[{"uuid":"0000110b-0000-1000-8000-00805f9b34fb","name":"Audio Sink","capability":"a2dp_sink"}]}`, rec.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/11:22:33:44:55:66/uuids", nil)
+	rec = httptest.NewRecorder()
+	c = echo.New().NewContext(req, rec)
+	c.SetParamNames("adapter")
+	c.SetParamValues("11:22:33:44:55:66")
+
+	assert.NoError(t, h.GetAdapterUUIDs(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestBluetoothHandler_GetLinkInfo(t *testing.T) {
+	rssi, quality := int8(-52), uint8(230)
+	tests := []struct {
+		name           string
+		setupMock      func(*bluetooth.MockBluetoothManager)
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name: "success - link info returned",
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("GetLinkInfo", "/org/bluez/hci0", "11:22:33:44:55:66").Return(&mgmt.ConnInfo{RSSI: &rssi, LinkQuality: &quality}, nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"rssi":-52,"link_quality":230}`,
+		},
+		{
+			name: "failure - device not connected",
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("GetLinkInfo", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil, mgmt.ErrNotConnected)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := bluetooth.NewMockBluetoothManager(t)
+			tt.setupMock(mock)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/link", nil)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+
+			assert.NoError(t, NewBluetoothHandlerWithManager(mock).GetLinkInfo(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestBluetoothHandler_SetDiscovering(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		setupMock      func(*bluetooth.MockBluetoothManager)
+		expectedStatus int
+		expectedBody   map[string]string
+	}{
+		{
+			name: "success - LE only discovery",
+			body: `{"enable": true, "transport": "le"}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetDiscoveryFilter", "/org/bluez/hci0", bluetooth.DiscoveryFilter{Transport: "le"}).Return(nil)
+				mock.On("SetDiscovering", "/org/bluez/hci0", true).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]string{"message": "discovering updated"},
+		},
+		{
+			name: "success - duplicate data for continuous RSSI updates",
+			body: `{"enable": true, "transport": "le", "duplicate_data": true}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				duplicateData := true
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetDiscoveryFilter", "/org/bluez/hci0", bluetooth.DiscoveryFilter{Transport: "le", DuplicateData: &duplicateData}).Return(nil)
+				mock.On("SetDiscovering", "/org/bluez/hci0", true).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]string{"message": "discovering updated"},
+		},
+		{
+			name: "success - default transport resets the filter",
+			body: `{"enable": true}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetDiscoveryFilter", "/org/bluez/hci0", bluetooth.DiscoveryFilter{Transport: "auto"}).Return(nil)
+				mock.On("SetDiscovering", "/org/bluez/hci0", true).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]string{"message": "discovering updated"},
+		},
+		{
+			name: "success - stop discovery",
+			body: `{"enable": false}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("SetDiscovering", "/org/bluez/hci0", false).Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   map[string]string{"message": "discovering updated"},
+		},
+		{
+			name:           "failure - invalid transport",
+			body:           `{"enable": true, "transport": "usb"}`,
+			setupMock:      func(mock *bluetooth.MockBluetoothManager) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   map[string]string{"error": "transport must be one of auto, le or bredr"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			mock := bluetooth.NewMockBluetoothManager(t)
+			tt.setupMock(mock)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/discovering", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter")
+			c.SetParamValues("AA:BB:CC:DD:EE:00")
+
+			h := NewBluetoothHandlerWithManager(mock)
+
+			// Test
+			err := h.SetDiscovering(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+
+			var response map[string]string
+			err = json.Unmarshal(rec.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedBody, response)
+		})
+	}
+}
+
+func TestBluetoothHandler_PairingRequests(t *testing.T) {
+	// Setup
+	mock := bluetooth.NewMockBluetoothManager(t)
+	passkey := uint32(123456)
+	mock.On("GetPairingRequests").Return([]bluetooth.PairingRequest{
+		{ID: "abc", Type: bluetooth.PairingRequestConfirmation, Address: "11:22:33:44:55:66", Passkey: &passkey},
+	})
+	mock.On("RespondPairingRequest", "abc", true).Return(nil)
+	mock.On("RespondPairingRequest", "unknown", false).Return(bluetooth.ErrPairingRequestNotFound)
+
+	h := NewBluetoothHandlerWithManager(mock)
+	e := echo.New()
+
+	// Test - list
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/pairing-requests", nil), rec)
+	assert.NoError(t, h.GetPairingRequests(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var list map[string][]bluetooth.PairingRequest
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Len(t, list["requests"], 1)
+	assert.Equal(t, uint32(123456), *list["requests"][0].Passkey)
+
+	// Test - accept
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/pairing-requests/abc/accept", nil), rec)
+	c.SetParamNames("id")
+	c.SetParamValues("abc")
+	assert.NoError(t, h.AcceptPairingRequest(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"message": "pairing request accepted"}`, rec.Body.String())
+
+	// Test - reject an unknown request
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/pairing-requests/unknown/reject", nil), rec)
+	c.SetParamNames("id")
+	c.SetParamValues("unknown")
+	assert.NoError(t, h.RejectPairingRequest(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"error": "pairing request not found"}`, rec.Body.String())
+}
+
+func TestNewBluetoothHandler_MockBackend(t *testing.T) {
+	h, err := NewBluetoothHandler(bluetooth.BackendMock, bluetooth.Options{}, nil, nil)
+	assert.NoError(t, err)
+	defer h.Close()
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters", nil), rec)
+	assert.NoError(t, h.GetAdapters(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "demo-hci0")
+
+	_, err = NewBluetoothHandler("unknown", bluetooth.Options{}, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestBluetoothHandler_ConnectDeviceWaitResolved(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+	btMock.On("ConnectDevice", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil)
+	// The services are resolved on the second check
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "11:22:33:44:55:66", Connected: true}}, nil).Once()
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "11:22:33:44:55:66", Connected: true, ServicesResolved: true}}, nil).Once()
+	// The device never gets resolved
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "11:22:33:44:55:66", Connected: true}}, nil)
+
+	e := echo.New()
+	h := NewBluetoothHandlerWithManager(btMock)
+	connect := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/connect", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("adapter", "mac")
+		c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+		assert.NoError(t, h.ConnectDevice(c))
+		return rec
+	}
+
+	rec := connect(`{"wait_resolved": true}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "services resolved")
+
+	assert.Equal(t, http.StatusRequestTimeout, connect(`{"wait_resolved": true, "timeout": "300ms"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, connect(`{"wait_resolved": true, "timeout": "1h"}`).Code)
+}
+
+func TestBluetoothHandler_PairDeviceSync(t *testing.T) {
+	e := echo.New()
+	pair := func(h *BluetoothHandler, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/pair?"+query, nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("adapter", "mac")
+		c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+		assert.NoError(t, h.PairDevice(c))
+		return rec
+	}
+
+	t.Run("paired", func(t *testing.T) {
+		btMock := bluetooth.NewMockBluetoothManager(t)
+		btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+		btMock.On("PairDevice", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil).Once()
+		btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "11:22:33:44:55:66", Paired: true}}, nil).Once()
+
+		rec := pair(NewBluetoothHandlerWithManager(btMock), "sync=true")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"message":"device paired successfully"`)
+		assert.Contains(t, rec.Body.String(), `"paired":true`)
+	})
+
+	t.Run("bluez error", func(t *testing.T) {
+		btMock := bluetooth.NewMockBluetoothManager(t)
+		btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+		btMock.On("PairDevice", "/org/bluez/hci0", "11:22:33:44:55:66").
+			Return(fmt.Errorf("failed to pair with device 11:22:33:44:55:66: %w", dbus.Error{Name: "org.bluez.Error.AuthenticationFailed", Body: []interface{}{"Authentication Failed"}})).Once()
+		btMock.On("PairDevice", "/org/bluez/hci0", "11:22:33:44:55:66").Return(dbus.Error{Name: "org.bluez.Error.AlreadyExists", Body: []interface{}{"Already Exists"}}).Once()
+
+		h := NewBluetoothHandlerWithManager(btMock)
+		rec := pair(h, "sync=true")
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.JSONEq(t, `{"error": "failed to pair device: failed to pair with device 11:22:33:44:55:66: Authentication Failed", "bluez_error": "org.bluez.Error.AuthenticationFailed"}`, rec.Body.String())
+		assert.Equal(t, http.StatusConflict, pair(h, "sync=true").Code)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		cancelled := make(chan struct{})
+		btMock := bluetooth.NewMockBluetoothManager(t)
+		btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+		btMock.On("PairDevice", "/org/bluez/hci0", "11:22:33:44:55:66").Return(errors.New("canceled")).Once().Run(func(mock.Arguments) { <-cancelled })
+		btMock.On("CancelPairing", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil).Once().Run(func(mock.Arguments) { close(cancelled) })
+
+		assert.Equal(t, http.StatusRequestTimeout, pair(NewBluetoothHandlerWithManager(btMock), "sync=true&timeout=100ms").Code)
+	})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+)
+
+// GetBroadcasts returns the LE Audio broadcast (Auracast) sources seen by an adapter
+func (bh *BluetoothHandler) GetBroadcasts(c echo.Context) error {
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	devices, err := bh.btManager.GetDevices(adapterPath)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get devices: "+err.Error())
+	}
+
+	broadcasts := []bluetooth.Device{}
+	for _, device := range devices {
+		if device.Broadcast != nil {
+			broadcasts = append(broadcasts, device)
+		}
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"broadcasts": broadcasts,
+	})
+}
+
+// JoinBroadcast plays the broadcast of a source on the adapter
+func (bh *BluetoothHandler) JoinBroadcast(c echo.Context) error {
+	return bh.updateBroadcast(c, bh.btManager.JoinBroadcast, "broadcast joined")
+}
+
+// LeaveBroadcast stops playing the broadcast of a source
+func (bh *BluetoothHandler) LeaveBroadcast(c echo.Context) error {
+	return bh.updateBroadcast(c, bh.btManager.LeaveBroadcast, "broadcast left")
+}
+
+func (bh *BluetoothHandler) updateBroadcast(c echo.Context, update func(adapterPath, macAddress string) error, message string) error {
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	err = update(adapterPath, c.Param("mac"))
+	if errors.Is(err, bluetooth.ErrNoBroadcastTransport) {
+		return jsonError(c, http.StatusConflict, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": message})
+}
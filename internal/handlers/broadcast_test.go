@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBluetoothHandler_GetBroadcasts(t *testing.T) {
+	mock := bluetooth.NewMockBluetoothManager(t)
+	mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+	mock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66"},
+		{Address: "C8:7A:12:34:56:01", Broadcast: &bluetooth.Broadcast{ID: 0x123456, State: "idle"}},
+	}, nil)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/broadcasts", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("adapter")
+	c.SetParamValues("AA:BB:CC:DD:EE:00")
+
+	assert.NoError(t, NewBluetoothHandlerWithManager(mock).GetBroadcasts(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Broadcasts []bluetooth.Device `json:"broadcasts"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response.Broadcasts, 1)
+	assert.Equal(t, uint32(0x123456), response.Broadcasts[0].Broadcast.ID)
+}
+
+func TestBluetoothHandler_JoinBroadcast(t *testing.T) {
+	tests := []struct {
+		name           string
+		joinErr        error
+		expectedStatus int
+	}{
+		{name: "success", expectedStatus: http.StatusOK},
+		{name: "no stream exposed", joinErr: bluetooth.ErrNoBroadcastTransport, expectedStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := bluetooth.NewMockBluetoothManager(t)
+			mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+			mock.On("JoinBroadcast", "/org/bluez/hci0", "C8:7A:12:34:56:01").Return(tt.joinErr)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/broadcasts/C8:7A:12:34:56:01/join", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues("AA:BB:CC:DD:EE:00", "C8:7A:12:34:56:01")
+
+			assert.NoError(t, NewBluetoothHandlerWithManager(mock).JoinBroadcast(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
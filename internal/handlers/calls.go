@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/hfp"
+)
+
+// CallsHandler controls the calls of phones connected with the Hands-Free Profile
+type CallsHandler struct {
+	btManager bluetooth.BluetoothManagerInterface
+	calls     hfp.CallController
+}
+
+type DialRequest struct {
+	Number string `json:"number"`
+}
+
+// NewCallsHandler creates a new calls handler
+func NewCallsHandler(btManager bluetooth.BluetoothManagerInterface, calls hfp.CallController) *CallsHandler {
+	return &CallsHandler{btManager: btManager, calls: calls}
+}
+
+// GetCalls returns the calls of a phone
+func (ch *CallsHandler) GetCalls(c echo.Context) error {
+	if _, err := ch.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	calls, err := ch.calls.Calls(strings.ToUpper(c.Param("mac")))
+	if err != nil {
+		return callError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"calls": calls,
+	})
+}
+
+// Dial calls a number from a phone
+func (ch *CallsHandler) Dial(c echo.Context) error {
+	if _, err := ch.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	var req DialRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	if err := hfp.ValidateNumber(req.Number); err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	call, err := ch.calls.Dial(strings.ToUpper(c.Param("mac")), req.Number)
+	if err != nil {
+		return callError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, call)
+}
+
+// Answer answers the incoming call of a phone
+func (ch *CallsHandler) Answer(c echo.Context) error {
+	if _, err := ch.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	if err := ch.calls.Answer(strings.ToUpper(c.Param("mac"))); err != nil {
+		return callError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "call answered",
+	})
+}
+
+// HangUp ends every call of a phone
+func (ch *CallsHandler) HangUp(c echo.Context) error {
+	if _, err := ch.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	if err := ch.calls.HangUp(strings.ToUpper(c.Param("mac"))); err != nil {
+		return callError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "calls ended",
+	})
+}
+
+// callError maps the call control errors to HTTP statuses
+func callError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, hfp.ErrUnavailable):
+		return jsonError(c, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, hfp.ErrNoHandsFree):
+		return jsonError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, hfp.ErrNoIncomingCall):
+		return jsonError(c, http.StatusConflict, err.Error())
+	}
+	return jsonError(c, http.StatusInternalServerError, err.Error())
+}
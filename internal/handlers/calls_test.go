@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/hfp"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCalls records the calls made on a single phone
+type fakeCalls struct {
+	dialed  []string
+	ringing bool
+	err     error
+}
+
+func (f *fakeCalls) Calls(address string) ([]hfp.Call, error) {
+	return []hfp.Call{}, f.err
+}
+
+func (f *fakeCalls) Dial(address, number string) (*hfp.Call, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	f.dialed = append(f.dialed, number)
+	return &hfp.Call{Path: "/hfp/voicecall01", Number: number, State: hfp.CallDialing}, nil
+}
+
+func (f *fakeCalls) Answer(address string) error {
+	if !f.ringing {
+		return hfp.ErrNoIncomingCall
+	}
+	return f.err
+}
+
+func (f *fakeCalls) HangUp(address string) error {
+	return f.err
+}
+
+func TestCallsHandler(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+
+	request := func(handler echo.HandlerFunc, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.SetParamNames("adapter", "mac")
+		c.SetParamValues("AA:BB:CC:DD:EE:00", "5c:17:cf:11:22:33")
+		assert.NoError(t, handler(c))
+		return rec
+	}
+
+	// Test - dial
+	calls := &fakeCalls{}
+	h := NewCallsHandler(btMock, calls)
+	rec := request(h.Dial, `{"number": "+33612345678"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, []string{"+33612345678"}, calls.dialed)
+
+	// Test - invalid number
+	rec = request(h.Dial, `{"number": "call mom"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Test - answer without a ringing call
+	rec = request(h.Answer, "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	// Test - phone without hands-free connection
+	h = NewCallsHandler(btMock, &fakeCalls{err: hfp.ErrNoHandsFree})
+	rec = request(h.HangUp, "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Test - oFono not running
+	h = NewCallsHandler(btMock, &fakeCalls{err: hfp.ErrUnavailable})
+	rec = request(h.GetCalls, "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
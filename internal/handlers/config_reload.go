@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/config"
+)
+
+// ConfigReloadHandler reloads the configuration through the API, as a SIGHUP does
+type ConfigReloadHandler struct {
+	reloader *config.Reloader
+}
+
+// NewConfigReloadHandler creates a new configuration reload handler
+func NewConfigReloadHandler(reloader *config.Reloader) *ConfigReloadHandler {
+	return &ConfigReloadHandler{reloader: reloader}
+}
+
+// Reload loads the configuration again and applies the settings which can change at runtime. It
+// lists the applied settings and the changed ones which need a restart.
+func (ch *ConfigReloadHandler) Reload(c echo.Context) error {
+	result, err := ch.reloader.Reload()
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	log.Printf("request_id=%s configuration reloaded, applied: %v, restart required: %v", RequestID(c), result.Applied, result.RestartRequired)
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigReloadHandler_Reload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "broker.env")
+	assert.NoError(t, os.WriteFile(path, nil, 0600))
+	t.Setenv("DATABASE_PATH", filepath.Join(dir, "data.db"))
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := config.Load()
+	assert.NoError(t, err)
+	reloader := config.NewReloader(cfg)
+	origins := NewCORSOrigins(cfg.CORSAllowedOrigins)
+	reloader.OnReload(func(cfg *config.Config) { origins.Set(cfg.CORSAllowedOrigins) })
+	handler := NewConfigReloadHandler(reloader)
+
+	reload := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/config/reload", nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, handler.Reload(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	assert.NoError(t, os.WriteFile(path, []byte("CORS_ALLOWED_ORIGINS=https://dashboard.lan\nPAIRING_MODE=manual\n"), 0600))
+	rec := reload()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result config.ReloadResult
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, config.ReloadResult{Applied: []string{"CORS_ALLOWED_ORIGINS"}, RestartRequired: []string{"PAIRING_MODE"}}, result)
+	assert.Equal(t, []string{"https://dashboard.lan"}, origins.origins)
+
+	assert.NoError(t, os.WriteFile(path, []byte("CORS_ALLOWED_ORIGINS=dashboard\n"), 0600))
+	rec = reload()
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid CORS_ALLOWED_ORIGINS entry")
+	assert.Equal(t, []string{"https://dashboard.lan"}, origins.origins)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// CORSOrigins are the origins allowed to call the API from a browser, "*" allowing any. They can be
+// replaced while the server runs, when the configuration is reloaded.
+type CORSOrigins struct {
+	mu      sync.RWMutex
+	origins []string
+}
+
+// NewCORSOrigins creates the allowed CORS origins
+func NewCORSOrigins(origins []string) *CORSOrigins {
+	o := &CORSOrigins{}
+	o.Set(origins)
+	return o
+}
+
+// Set replaces the allowed origins
+func (o *CORSOrigins) Set(origins []string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.origins = slices.Clone(origins)
+}
+
+// Middleware answers the CORS preflight requests and sets the CORS headers of the allowed origins
+func (o *CORSOrigins) Middleware() echo.MiddlewareFunc {
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOriginFunc: func(origin string) (bool, error) {
+			o.mu.RLock()
+			defer o.mu.RUnlock()
+			return slices.Contains(o.origins, "*") || slices.Contains(o.origins, origin), nil
+		},
+	})
+}
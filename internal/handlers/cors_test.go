@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSOrigins_Middleware(t *testing.T) {
+	origins := NewCORSOrigins([]string{"*"})
+	e := echo.New()
+	e.Use(origins.Middleware())
+	e.GET("/api/v1/events", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	allowedOrigin := func(origin string) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/events", nil)
+		req.Header.Set(echo.HeaderOrigin, origin)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Header().Get(echo.HeaderAccessControlAllowOrigin)
+	}
+
+	assert.Equal(t, "https://other.lan", allowedOrigin("https://other.lan"))
+
+	origins.Set([]string{"https://dashboard.lan"})
+	assert.Equal(t, "https://dashboard.lan", allowedOrigin("https://dashboard.lan"))
+	assert.Empty(t, allowedOrigin("https://other.lan"))
+}
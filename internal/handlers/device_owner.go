@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// DeviceOwnerMiddleware restricts a device route to the user who paired the device and to the
+// admins. Devices paired outside of the API have no owner and stay open to every user. It must be
+// chained after AuthMiddleware.
+func DeviceOwnerMiddleware(db database.DatabaseInterface, cipher *secrets.Cipher) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if isAdmin, _ := c.Get("is_admin").(bool); isAdmin {
+				return next(c)
+			}
+
+			owner, err := database.GetDeviceOwner(db, cipher, c.Param("mac"))
+			if err != nil {
+				log.Printf("request_id=%s %v", RequestID(c), err)
+				return jsonError(c, http.StatusInternalServerError, "database error")
+			}
+			if username, _ := c.Get("username").(string); owner != nil && owner.Owner != username {
+				return jsonError(c, http.StatusForbidden, "device is owned by another user")
+			}
+			return next(c)
+		}
+	}
+}
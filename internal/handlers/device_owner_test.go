@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBluetoothHandler_PairDevice_RecordsOwner(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "00:1a:7d:da:71:01").Return("/org/bluez/hci0", nil)
+	btMock.On("PairDevice", "/org/bluez/hci0", "aa:bb:cc:dd:ee:ff").Return(nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "AA:BB:CC:DD:EE:FF", Paired: true},
+		{Address: "11:22:33:44:55:66", Paired: true},
+	}, nil)
+
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dbMock.ExpectExec("INSERT INTO device_owners").
+		WithArgs("AA:BB:CC:DD:EE:FF", "kitchen", "00:1A:7D:DA:71:01", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectQuery("SELECT address, owner FROM device_owners").
+		WillReturnRows(sqlmock.NewRows([]string{"address", "owner"}).AddRow("AA:BB:CC:DD:EE:FF", "kitchen"))
+
+	e := echo.New()
+	h := NewBluetoothHandlerWithDB(btMock, db, nil)
+
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/00:1a:7d:da:71:01/devices/aa:bb:cc:dd:ee:ff/pair", nil), rec)
+	c.SetParamNames("adapter", "mac")
+	c.SetParamValues("00:1a:7d:da:71:01", "aa:bb:cc:dd:ee:ff")
+	c.Set("username", "kitchen")
+	assert.NoError(t, h.PairDevice(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// The owner shows in the device list
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/00:1a:7d:da:71:01/devices", nil), rec)
+	c.SetParamNames("adapter")
+	c.SetParamValues("00:1a:7d:da:71:01")
+	assert.NoError(t, h.GetDevices(c))
+
+	var response struct {
+		Devices []bluetooth.Device `json:"devices"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "kitchen", response.Devices[0].Owner)
+	assert.Empty(t, response.Devices[1].Owner)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestDeviceOwnerMiddleware(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	e := echo.New()
+	route := DeviceOwnerMiddleware(db, nil)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	call := func(username string, isAdmin bool, mac string) int {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+		c.SetParamNames("mac")
+		c.SetParamValues(mac)
+		c.Set("username", username)
+		c.Set("is_admin", isAdmin)
+		assert.NoError(t, route(c))
+		return rec.Code
+	}
+	owned := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"address", "owner", "adapter", "paired_at"}).
+			AddRow("AA:BB:CC:DD:EE:FF", "kitchen", "00:1A:7D:DA:71:01", time.Now())
+	}
+
+	dbMock.ExpectQuery("FROM device_owners WHERE address = ?").WithArgs("AA:BB:CC:DD:EE:FF").WillReturnRows(owned())
+	assert.Equal(t, http.StatusOK, call("kitchen", false, "aa:bb:cc:dd:ee:ff"))
+
+	dbMock.ExpectQuery("FROM device_owners WHERE address = ?").WithArgs("AA:BB:CC:DD:EE:FF").WillReturnRows(owned())
+	assert.Equal(t, http.StatusForbidden, call("bedroom", false, "AA:BB:CC:DD:EE:FF"))
+
+	// Admins are not restricted and devices without owner are open to everyone
+	assert.Equal(t, http.StatusOK, call("admin", true, "AA:BB:CC:DD:EE:FF"))
+	dbMock.ExpectQuery("FROM device_owners WHERE address = ?").WithArgs("11:22:33:44:55:66").
+		WillReturnRows(sqlmock.NewRows([]string{"address", "owner", "adapter", "paired_at"}))
+	assert.Equal(t, http.StatusOK, call("bedroom", false, "11:22:33:44:55:66"))
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+const (
+	// DefaultDeviceWaitTimeout is how long a wait request blocks when it sets no timeout
+	DefaultDeviceWaitTimeout = 30 * time.Second
+	// MaxDeviceWaitTimeout is the longest a wait request may block
+	MaxDeviceWaitTimeout = 5 * time.Minute
+	// deviceWaitPollInterval is how often the device is checked besides the device events, which
+	// not every backend publishes
+	deviceWaitPollInterval = time.Second
+)
+
+// deviceStates are the states a wait request may wait for, a nil device being unknown to the adapter
+var deviceStates = map[string]func(device *bluetooth.Device) bool{
+	"connected":    func(device *bluetooth.Device) bool { return device != nil && device.Connected },
+	"resolved":     func(device *bluetooth.Device) bool { return device != nil && device.ServicesResolved },
+	"disconnected": func(device *bluetooth.Device) bool { return device == nil || !device.Connected },
+	"paired":       func(device *bluetooth.Device) bool { return device != nil && device.Paired },
+	"unpaired":     func(device *bluetooth.Device) bool { return device == nil || !device.Paired },
+	"trusted":      func(device *bluetooth.Device) bool { return device != nil && device.Trusted },
+	"untrusted":    func(device *bluetooth.Device) bool { return device == nil || !device.Trusted },
+	"present":      func(device *bluetooth.Device) bool { return device != nil },
+	"absent":       func(device *bluetooth.Device) bool { return device == nil },
+}
+
+// DeviceWaitHandler lets clients long-poll the state of a device, a simple alternative to the
+// event stream for scripts
+type DeviceWaitHandler struct {
+	btManager bluetooth.BluetoothManagerInterface
+	hub       *events.Hub
+}
+
+type DeviceWaitResponse struct {
+	State  string            `json:"state"`
+	Device *bluetooth.Device `json:"device"`
+}
+
+// NewDeviceWaitHandler creates a new device wait handler, checking the device again on the device events of hub
+func NewDeviceWaitHandler(btManager bluetooth.BluetoothManagerInterface, hub *events.Hub) *DeviceWaitHandler {
+	return &DeviceWaitHandler{btManager: btManager, hub: hub}
+}
+
+// WaitDevice blocks until a device reaches the requested state, then returns it. It answers
+// 408 Request Timeout when the timeout elapses first.
+func (wh *DeviceWaitHandler) WaitDevice(c echo.Context) error {
+	state := c.QueryParam("state")
+	reached, ok := deviceStates[state]
+	if !ok {
+		names := make([]string, 0, len(deviceStates))
+		for name := range deviceStates {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return jsonError(c, http.StatusBadRequest, "state must be one of "+strings.Join(names, ", "))
+	}
+
+	timeout := DefaultDeviceWaitTimeout
+	if value := c.QueryParam("timeout"); value != "" {
+		var err error
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 || timeout > MaxDeviceWaitTimeout {
+			return jsonError(c, http.StatusBadRequest, "timeout must be a duration between 1s and "+MaxDeviceWaitTimeout.String())
+		}
+	}
+
+	adapterPath, err := wh.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	// Subscribing before the first check keeps a change from slipping in between
+	var deviceEvents <-chan events.Event
+	if wh.hub != nil {
+		var unsubscribe func()
+		deviceEvents, unsubscribe = wh.hub.Subscribe()
+		defer unsubscribe()
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(deviceWaitPollInterval)
+	defer ticker.Stop()
+
+	for check := true; ; check = true {
+		if check {
+			device, err := wh.findDevice(adapterPath, c.Param("mac"))
+			if err != nil {
+				return jsonError(c, http.StatusInternalServerError, "failed to get devices: "+err.Error())
+			}
+			if reached(device) {
+				return c.JSON(http.StatusOK, DeviceWaitResponse{State: state, Device: device})
+			}
+		}
+
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-deadline.C:
+			return jsonError(c, http.StatusRequestTimeout, "device did not become "+state+" within "+timeout.String())
+		case <-ticker.C:
+		case event := <-deviceEvents:
+			check = strings.HasPrefix(event.Type, "device_") || strings.HasPrefix(event.Type, "pairing_")
+		}
+	}
+}
+
+// findDevice returns a device of an adapter, or nil when the adapter does not know it
+func (wh *DeviceWaitHandler) findDevice(adapterPath, address string) (*bluetooth.Device, error) {
+	devices, err := wh.btManager.GetDevices(adapterPath)
+	if err != nil {
+		return nil, err
+	}
+	for i, device := range devices {
+		if strings.EqualFold(device.Address, address) {
+			return &devices[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestDeviceWaitHandler_WaitDevice(t *testing.T) {
+	disconnected := []bluetooth.Device{{Address: "11:22:33:44:55:66", Paired: true}}
+	connected := []bluetooth.Device{{Address: "11:22:33:44:55:66", Paired: true, Connected: true}}
+
+	tests := []struct {
+		name           string
+		query          string
+		setup          func(*bluetooth.MockBluetoothManager, *events.Hub)
+		expectedStatus int
+	}{
+		{
+			name:  "success - already in state",
+			query: "state=paired",
+			setup: func(bt *bluetooth.MockBluetoothManager, hub *events.Hub) {
+				bt.On("GetDevices", "/org/bluez/hci0").Return(disconnected, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "success - connected on a device event",
+			query: "state=connected&timeout=1m",
+			setup: func(bt *bluetooth.MockBluetoothManager, hub *events.Hub) {
+				bt.On("GetDevices", "/org/bluez/hci0").Return(disconnected, nil).Once().Run(func(mock.Arguments) {
+					go hub.Publish("device_connected", nil)
+				})
+				bt.On("GetDevices", "/org/bluez/hci0").Return(connected, nil).Once()
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "success - absent device",
+			query: "state=absent",
+			setup: func(bt *bluetooth.MockBluetoothManager, hub *events.Hub) {
+				bt.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "failure - timeout",
+			query: "state=connected&timeout=10ms",
+			setup: func(bt *bluetooth.MockBluetoothManager, hub *events.Hub) {
+				bt.On("GetDevices", "/org/bluez/hci0").Return(disconnected, nil)
+			},
+			expectedStatus: http.StatusRequestTimeout,
+		},
+		{
+			name:           "failure - unknown state",
+			query:          "state=sleeping",
+			setup:          func(bt *bluetooth.MockBluetoothManager, hub *events.Hub) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - timeout too long",
+			query:          "state=connected&timeout=1h",
+			setup:          func(bt *bluetooth.MockBluetoothManager, hub *events.Hub) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			btMock := bluetooth.NewMockBluetoothManager(t)
+			hub := events.NewHub()
+			if tt.expectedStatus != http.StatusBadRequest {
+				btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+			}
+			tt.setup(btMock, hub)
+
+			req := httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+
+			start := time.Now()
+			assert.NoError(t, NewDeviceWaitHandler(btMock, hub).WaitDevice(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			// Device events wake the wait up before the next poll
+			assert.Less(t, time.Since(start), deviceWaitPollInterval)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/diagnostics"
+)
+
+// DiagnosticsHandler serves the support bundle attached to bug reports
+type DiagnosticsHandler struct {
+	bundle *diagnostics.Bundle
+}
+
+// NewDiagnosticsHandler creates a new diagnostics handler
+func NewDiagnosticsHandler(bundle *diagnostics.Bundle) *DiagnosticsHandler {
+	return &DiagnosticsHandler{bundle: bundle}
+}
+
+// GetDiagnostics downloads the support bundle as a gzipped tarball
+func (dh *DiagnosticsHandler) GetDiagnostics(c echo.Context) error {
+	// The bundle is built before answering, so that a failure is still reported as an error
+	var buf bytes.Buffer
+	if err := dh.bundle.Write(c.Request().Context(), &buf); err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "failed to build the diagnostics: "+err.Error())
+	}
+
+	filename := "home-bt-broker-diagnostics-" + time.Now().UTC().Format("20060102T150405Z") + ".tar.gz"
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.Blob(http.StatusOK, "application/gzip", buf.Bytes())
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/config"
+	"github.com/nerzhul/home-bt-broker/internal/diagnostics"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnosticsHandler_GetDiagnostics(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{}, nil)
+
+	bundle := diagnostics.NewBundle(btMock, &config.Config{}, events.NewRecorder(10), logging.NewRing(10))
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/diagnostics", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, NewDiagnosticsHandler(bundle).GetDiagnostics(e.NewContext(req, rec)))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/gzip", rec.Header().Get(echo.HeaderContentType))
+	assert.Regexp(t, `^attachment; filename="home-bt-broker-diagnostics-\d{8}T\d{6}Z\.tar\.gz"$`, rec.Header().Get(echo.HeaderContentDisposition))
+	_, err := gzip.NewReader(rec.Body)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerETag        = "ETag"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+// bufferingWriter holds a response back until it is complete, so that it can be hashed
+type bufferingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferingWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferingWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+// etagMatches reports whether an If-None-Match header lists an entity tag, compared weakly
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ETagMiddleware tags the successful responses of GET requests with a hash of their body, and
+// answers 304 Not Modified when the If-None-Match header of the request lists it, so that clients
+// polling a list stop downloading it when it did not change. The tag covers the negotiated format.
+func ETagMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Request().Method != http.MethodGet {
+			return next(c)
+		}
+
+		resp := c.Response()
+		writer := &bufferingWriter{ResponseWriter: resp.Writer, status: http.StatusOK}
+		resp.Writer = writer
+		err := next(c)
+		if err != nil {
+			// Let the error handler write the response before it is released
+			c.Error(err)
+		}
+		resp.Writer = writer.ResponseWriter
+
+		if writer.status == http.StatusOK {
+			sum := sha256.Sum256(writer.body.Bytes())
+			etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+			resp.Header().Set(headerETag, etag)
+
+			if etagMatches(c.Request().Header.Get(headerIfNoneMatch), etag) {
+				resp.Header().Del(echo.HeaderContentType)
+				resp.Header().Del(echo.HeaderContentLength)
+				resp.Status = http.StatusNotModified
+				resp.Writer.WriteHeader(http.StatusNotModified)
+				return nil
+			}
+		}
+
+		resp.Writer.WriteHeader(writer.status)
+		_, err = resp.Writer.Write(writer.body.Bytes())
+		return err
+	}
+}
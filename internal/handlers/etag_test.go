@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETagMiddleware(t *testing.T) {
+	devices := map[string]interface{}{"devices": []string{"11:22:33:44:55:66"}}
+	e := echo.New()
+	e.GET("/devices", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, devices)
+	}, ETagMiddleware)
+	e.GET("/missing", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "adapter not found")
+	}, ETagMiddleware)
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/devices", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"devices": ["11:22:33:44:55:66"]}`, rec.Body.String())
+	etag := rec.Header().Get("ETag")
+	assert.Len(t, etag, 34)
+
+	rec = get("/devices", `"other", W/`+etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, etag, rec.Header().Get("ETag"))
+
+	// A changed list gets a new tag
+	devices["devices"] = []string{}
+	rec = get("/devices", etag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+
+	rec = get("/missing", "*")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Header().Get("ETag"))
+	assert.Contains(t, rec.Body.String(), "adapter not found")
+}
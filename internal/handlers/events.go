@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+// EventsHandler streams broker events to clients
+type EventsHandler struct {
+	hub *events.Hub
+}
+
+// NewEventsHandler creates a new events handler
+func NewEventsHandler(hub *events.Hub) *EventsHandler {
+	return &EventsHandler{hub: hub}
+}
+
+// Stream sends events as Server-Sent Events until the client disconnects
+func (eh *EventsHandler) Stream(c echo.Context) error {
+	ch, unsubscribe := eh.hub.Subscribe()
+	defer unsubscribe()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(res, ": keepalive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case event, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
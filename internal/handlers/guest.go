@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/guest"
+)
+
+const (
+	// maxGuestMinutes is the longest guest pairing window, two hours
+	maxGuestMinutes = 2 * 60
+	// maxGuestTrustMinutes is the longest limited trust of a guest device, one week
+	maxGuestTrustMinutes = 7 * 24 * 60
+)
+
+// GuestHandler opens and closes the guest pairing windows
+type GuestHandler struct {
+	mode *guest.Mode
+	hub  *events.Hub
+}
+
+type StartGuestModeRequest struct {
+	// Adapter is the address of the adapter to open, the first powered adapter when empty
+	Adapter string `json:"adapter"`
+	Minutes int    `json:"minutes"`
+	// TrustMinutes limits the trust of the devices paired during the window, 0 trusts them forever
+	TrustMinutes int `json:"trust_minutes"`
+}
+
+// NewGuestHandler creates a new guest mode handler
+func NewGuestHandler(mode *guest.Mode, hub *events.Hub) *GuestHandler {
+	return &GuestHandler{mode: mode, hub: hub}
+}
+
+// GetGuestMode returns the state of the guest pairing window
+func (gh *GuestHandler) GetGuestMode(c echo.Context) error {
+	return c.JSON(http.StatusOK, gh.mode.Status())
+}
+
+// StartGuestMode opens a guest pairing window
+func (gh *GuestHandler) StartGuestMode(c echo.Context) error {
+	var req StartGuestModeRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	if req.Minutes < 1 || req.Minutes > maxGuestMinutes {
+		return jsonError(c, http.StatusBadRequest, "minutes must be between 1 and 120")
+	}
+	if req.TrustMinutes < 0 || req.TrustMinutes > maxGuestTrustMinutes {
+		return jsonError(c, http.StatusBadRequest, "trust_minutes must be between 0 and 10080")
+	}
+
+	status, err := gh.mode.Start(req.Adapter, time.Duration(req.Minutes)*time.Minute, time.Duration(req.TrustMinutes)*time.Minute, gh.hub)
+	if errors.Is(err, guest.ErrActive) {
+		return jsonError(c, http.StatusConflict, err.Error())
+	} else if errors.Is(err, guest.ErrNoAdapter) {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, status)
+}
+
+// StopGuestMode closes the guest pairing window before its end
+func (gh *GuestHandler) StopGuestMode(c echo.Context) error {
+	status, err := gh.mode.Stop(gh.hub)
+	if err != nil {
+		return jsonError(c, http.StatusConflict, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/guest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuestHandler_StartGuestMode(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      func(*bluetooth.MockBluetoothManager)
+		expectedStatus int
+	}{
+		{
+			name:        "success - first powered adapter",
+			requestBody: `{"minutes": 15, "trust_minutes": 1440}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00", Powered: true}}, nil)
+				mock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{}, nil)
+				mock.On("SetPairable", "/org/bluez/hci0", true).Return(nil)
+				mock.On("SetDiscoverable", "/org/bluez/hci0", true).Return(nil)
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:        "failure - unknown adapter",
+			requestBody: `{"adapter": "11:22:33:44:55:66", "minutes": 15}`,
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00", Powered: true}}, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "failure - window too long",
+			requestBody:    `{"minutes": 600}`,
+			setupMock:      func(mock *bluetooth.MockBluetoothManager) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - negative trust",
+			requestBody:    `{"minutes": 15, "trust_minutes": -1}`,
+			setupMock:      func(mock *bluetooth.MockBluetoothManager) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			btMock := bluetooth.NewMockBluetoothManager(t)
+			tt.setupMock(btMock)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/guest-mode", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			h := NewGuestHandler(guest.NewMode(btMock, nil, nil, bluetooth.NewVisibility(btMock), time.Second), events.NewHub())
+			assert.NoError(t, h.StartGuestMode(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestGuestHandler_StopGuestMode(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodDelete, "/api/v1/bluetooth/guest-mode", nil), rec)
+
+	h := NewGuestHandler(guest.NewMode(bluetooth.NewMockBluetoothManager(t), nil, nil, nil, time.Second), events.NewHub())
+	assert.NoError(t, h.StopGuestMode(c))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
@@ -2,61 +2,207 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"log"
 	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/health"
+	"github.com/nerzhul/home-bt-broker/internal/lockout"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
 )
 
-// AuthMiddleware vérifie l'authentification HTTP Basic (user/pass)
-func AuthMiddleware(db database.DatabaseInterface) echo.MiddlewareFunc {
-       return func(next echo.HandlerFunc) echo.HandlerFunc {
-	       return func(c echo.Context) error {
-		       username, password, ok := c.Request().BasicAuth()
-		       if !ok || username == "" || password == "" {
-			       c.Response().Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-			       return c.JSON(http.StatusUnauthorized, map[string]string{"error": "missing or invalid basic auth"})
-		       }
-
-		       var storedToken string
-		       err := db.QueryRow("SELECT token FROM user_tokens WHERE username = ?", username).Scan(&storedToken)
-		       if err != nil {
-			       if err == sql.ErrNoRows {
-				       c.Response().Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-				       return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
-			       }
-			       return c.JSON(http.StatusInternalServerError, map[string]string{"error": "database error"})
-		       }
-
-		       if password != storedToken {
-			       c.Response().Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-			       return c.JSON(http.StatusUnauthorized, map[string]string{"error": "invalid credentials"})
-		       }
-
-		       c.Set("username", username)
-		       return next(c)
-	       }
-       }
+// AuthMiddleware vérifie l'authentification HTTP Basic (user/pass), un jeton Bearer Home Assistant
+// ou la session du navigateur
+func AuthMiddleware(db database.DatabaseInterface, cipher *secrets.Cipher) echo.MiddlewareFunc {
+	return AuthMiddlewareWithOptions(db, cipher, AuthOptions{})
+}
+
+// AuthOptions are the optional protections of the Basic authentication
+type AuthOptions struct {
+	// Cache spares the database lookup of the credentials verified recently
+	Cache *AuthCache
+	// Lockout refuses the clients failing to authenticate too many times in a row
+	Lockout *lockout.Tracker
+	// Events receives the token use events
+	Events *events.Hub
+}
+
+// EventTokenUsed is published as an internal event for every request authenticated with Basic credentials
+const EventTokenUsed = "token_used"
+
+// TokenUse is the data of the token use events
+type TokenUse struct {
+	Username string `json:"username"`
+	IP       string `json:"ip"`
+	// Route is the method and route of the request, e.g. "GET /api/v1/bluetooth/adapters"
+	Route string `json:"route"`
+}
+
+// AuthMiddlewareWithOptions authenticates requests as AuthMiddleware does, with the Basic
+// authentication protected by the options
+func AuthMiddlewareWithOptions(db database.DatabaseInterface, cipher *secrets.Cipher, opts AuthOptions) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if token, found := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer "); found {
+				return bearerAuth(c, db, token, next)
+			}
+
+			username, password, ok := c.Request().BasicAuth()
+			if !ok {
+				if cookie, err := c.Cookie(SessionCookieName); err == nil && cookie.Value != "" {
+					return sessionAuth(c, db, cookie.Value, next)
+				}
+			}
+
+			if !ok || username == "" || password == "" {
+				requestBasicAuth(c)
+				return jsonError(c, http.StatusUnauthorized, "missing or invalid basic auth")
+			}
+
+			// A locked out client is refused even with the right token, or the lockout would
+			// not slow guessing down
+			ip := c.RealIP()
+			if retryAfter, locked := opts.Lockout.Locked(username, ip); locked {
+				return lockedOut(c, retryAfter)
+			}
+
+			isAdmin, cached := opts.Cache.lookup(username, password)
+			if !cached {
+				var err error
+				isAdmin, err = verifyCredentials(db, cipher, username, password)
+				if err == errInvalidCredentials {
+					if retryAfter, locked := opts.Lockout.Fail(username, ip); locked {
+						return lockedOut(c, retryAfter)
+					}
+					requestBasicAuth(c)
+					return jsonError(c, http.StatusUnauthorized, err.Error())
+				} else if err != nil {
+					return jsonError(c, http.StatusInternalServerError, err.Error())
+				}
+				opts.Lockout.Succeed(username, ip)
+				opts.Cache.store(username, password, isAdmin)
+				// The usage is recorded when the credentials are verified, so a cached token
+				// reports its last use with the precision of the cache lifetime
+				recordTokenUsage(c, db, username)
+			}
+
+			c.Set("username", username)
+			c.Set("is_admin", isAdmin)
+			opts.Events.PublishInternal(EventTokenUsed, TokenUse{Username: username, IP: ip, Route: c.Request().Method + " " + c.Path()})
+			return next(c)
+		}
+	}
+}
+
+var (
+	errInvalidCredentials = errors.New("invalid credentials")
+	errDatabase           = errors.New("database error")
+	errDecryptToken       = errors.New("failed to decrypt token")
+)
+
+// verifyCredentials checks a username/token pair and returns whether the token has admin privileges
+func verifyCredentials(db database.DatabaseInterface, cipher *secrets.Cipher, username, password string) (bool, error) {
+	var storedToken string
+	var isAdmin bool
+	err := db.QueryRow("SELECT token, is_admin FROM user_tokens WHERE username = ? AND revoked_at IS NULL", username).Scan(&storedToken, &isAdmin)
+	if err == sql.ErrNoRows {
+		return false, errInvalidCredentials
+	} else if err != nil {
+		log.Printf("failed to look up token of %s: %v", username, err)
+		return false, errDatabase
+	}
+
+	storedToken, err = cipher.Decrypt(storedToken)
+	if err != nil {
+		log.Printf("failed to decrypt token of %s: %v", username, err)
+		return false, errDecryptToken
+	}
+
+	if password != storedToken {
+		return false, errInvalidCredentials
+	}
+
+	return isAdmin, nil
+}
+
+// lockedOut refuses a request of a locked out client, telling it when to try again
+func lockedOut(c echo.Context, retryAfter time.Duration) error {
+	c.Response().Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	return jsonError(c, http.StatusTooManyRequests, "too many failed authentications, try again later")
+}
+
+// requestBasicAuth asks the client for Basic credentials, except for the web UI which uses sessions
+// and must not trigger the browser's native login prompt
+func requestBasicAuth(c echo.Context) {
+	if c.Request().Header.Get(echo.HeaderXRequestedWith) == "" {
+		c.Response().Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+	}
+}
+
+// recordTokenUsage stores when and from where a token was last used; a failure must not block the request
+func recordTokenUsage(c echo.Context, db database.DatabaseInterface, username string) {
+	if _, err := db.Exec("UPDATE user_tokens SET last_used_at = ?, last_ip = ? WHERE username = ?",
+		time.Now(), c.RealIP(), username); err != nil {
+		log.Printf("request_id=%s failed to record token usage for %s: %v", RequestID(c), username, err)
+	}
+}
+
+// AdminMiddleware restricts access to principals authenticated with an admin token.
+// It must be chained after AuthMiddleware.
+func AdminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if isAdmin, _ := c.Get("is_admin").(bool); !isAdmin {
+			return jsonError(c, http.StatusForbidden, "admin privileges required")
+		}
+		return next(c)
+	}
 }
 
 type Handler struct {
-	db database.DatabaseInterface
+	db        database.DatabaseInterface
+	cipher    *secrets.Cipher
+	rotateMu  sync.Mutex
+	monitor   *health.Monitor
+	authCache *AuthCache
+	lockout   *lockout.Tracker
 }
 
 type Token struct {
-	Username  string    `json:"username" db:"username"`
-	Token     string    `json:"token" db:"token"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	Username   string     `json:"username" db:"username"`
+	Token      string     `json:"token" db:"token"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	LastIP     *string    `json:"last_ip" db:"last_ip"`
+	IsAdmin    bool       `json:"is_admin" db:"is_admin"`
+}
+
+// RevokedToken is a token revoked through the token API, which can be restored
+type RevokedToken struct {
+	Username   string     `json:"username" db:"username"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	LastIP     *string    `json:"last_ip" db:"last_ip"`
+	IsAdmin    bool       `json:"is_admin" db:"is_admin"`
+	RevokedAt  time.Time  `json:"revoked_at" db:"revoked_at"`
+	RevokedBy  *string    `json:"revoked_by" db:"revoked_by"`
 }
 
 type CreateTokenRequest struct {
 	Username string `json:"username" validate:"required"`
 	Token    string `json:"token" validate:"required"`
+	IsAdmin  bool   `json:"is_admin"`
 }
 
-func NewHandler(db *sql.DB) *Handler {
-	return &Handler{db: db}
+func NewHandler(db *sql.DB, cipher *secrets.Cipher) *Handler {
+	return &Handler{db: db, cipher: cipher}
 }
 
 // NewHandlerWithDB creates a new handler with a custom database interface (for testing)
@@ -79,49 +225,78 @@ func (h *Handler) Readiness(c echo.Context) error {
 	})
 }
 
+// SetMonitor sets the loop monitor reported by the deep liveness check
+func (h *Handler) SetMonitor(monitor *health.Monitor) {
+	h.monitor = monitor
+}
+
+// SetAuthCache sets the credentials cache of the authentication middleware, invalidated when
+// tokens change
+func (h *Handler) SetAuthCache(cache *AuthCache) {
+	h.authCache = cache
+}
+
+// SetLockout sets the tracker of the failed authentications, shared with the authentication
+// middleware so that guessing tokens through the login form is slowed down too
+func (h *Handler) SetLockout(tracker *lockout.Tracker) {
+	h.lockout = tracker
+}
+
+// DeepLivenessResponse is the liveness report including the internal loops state
+type DeepLivenessResponse struct {
+	Status     string              `json:"status"`
+	Goroutines int                 `json:"goroutines"`
+	Loops      []health.LoopStatus `json:"loops"`
+}
+
 // Liveness endpoint - checks if the service is alive
+// With ?deep=true, it also reports the internal loops and fails when one of them stalled
 func (h *Handler) Liveness(c echo.Context) error {
-	return c.JSON(http.StatusOK, map[string]string{
-		"status": "alive",
-	})
+	if c.QueryParam("deep") != "true" {
+		return c.JSON(http.StatusOK, map[string]string{
+			"status": "alive",
+		})
+	}
+
+	resp := DeepLivenessResponse{
+		Status:     "alive",
+		Goroutines: runtime.NumGoroutine(),
+		Loops:      []health.LoopStatus{},
+	}
+	if h.monitor != nil {
+		resp.Loops = h.monitor.Statuses()
+	}
+
+	for _, loop := range resp.Loops {
+		if loop.Stalled {
+			resp.Status = "stalled"
+			return c.JSON(http.StatusServiceUnavailable, resp)
+		}
+	}
+
+	return c.JSON(http.StatusOK, resp)
 }
 
 // CreateToken creates a new username/token pair
 func (h *Handler) CreateToken(c echo.Context) error {
 	var req CreateTokenRequest
 	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "invalid request body",
-		})
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
 	}
 
 	if req.Username == "" || req.Token == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "username and token are required",
-		})
-	}
-
-	// Check if username already exists
-	var existingToken string
-	err := h.db.QueryRow("SELECT token FROM user_tokens WHERE username = ?", req.Username).Scan(&existingToken)
-	if err == nil {
-		return c.JSON(http.StatusConflict, map[string]string{
-			"error": "username already exists",
-		})
-	} else if err != sql.ErrNoRows {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "database error",
-		})
+		return jsonError(c, http.StatusBadRequest, "username and token are required")
 	}
 
-	// Insert new token
-	_, err = h.db.Exec("INSERT INTO user_tokens (username, token, created_at) VALUES (?, ?, ?)",
-		req.Username, req.Token, time.Now())
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to create token",
-		})
+	// Revoked tokens keep their username until they are restored
+	err := database.CreateToken(h.db, h.cipher, req.Username, req.Token, req.IsAdmin)
+	if errors.Is(err, database.ErrUsernameExists) {
+		return jsonError(c, http.StatusConflict, "username already exists")
+	} else if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "failed to create token")
 	}
+	h.authCache.Invalidate(req.Username)
 
 	return c.JSON(http.StatusCreated, map[string]string{
 		"message": "token created successfully",
@@ -130,21 +305,20 @@ func (h *Handler) CreateToken(c echo.Context) error {
 
 // GetTokens returns all username/token pairs
 func (h *Handler) GetTokens(c echo.Context) error {
-	rows, err := h.db.Query("SELECT username, token, created_at FROM user_tokens ORDER BY created_at DESC")
+	rows, err := h.db.Query("SELECT username, token, created_at, last_used_at, last_ip, is_admin FROM user_tokens WHERE revoked_at IS NULL ORDER BY created_at DESC")
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "database error",
-		})
+		return jsonError(c, http.StatusInternalServerError, "database error")
 	}
 	defer rows.Close()
 
 	var tokens []Token
 	for rows.Next() {
 		var token Token
-		if err := rows.Scan(&token.Username, &token.Token, &token.CreatedAt); err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{
-				"error": "failed to scan token",
-			})
+		if err := rows.Scan(&token.Username, &token.Token, &token.CreatedAt, &token.LastUsedAt, &token.LastIP, &token.IsAdmin); err != nil {
+			return jsonError(c, http.StatusInternalServerError, "failed to scan token")
+		}
+		if token.Token, err = h.cipher.Decrypt(token.Token); err != nil {
+			return jsonError(c, http.StatusInternalServerError, "failed to decrypt token")
 		}
 		tokens = append(tokens, token)
 	}
@@ -156,57 +330,92 @@ func (h *Handler) GetTokens(c echo.Context) error {
 func (h *Handler) GetToken(c echo.Context) error {
 	username := c.Param("username")
 	if username == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "username parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "username parameter is required")
 	}
 
 	var token Token
-	err := h.db.QueryRow("SELECT username, token, created_at FROM user_tokens WHERE username = ?", username).
-		Scan(&token.Username, &token.Token, &token.CreatedAt)
+	err := h.db.QueryRow("SELECT username, token, created_at, last_used_at, last_ip, is_admin FROM user_tokens WHERE username = ? AND revoked_at IS NULL", username).
+		Scan(&token.Username, &token.Token, &token.CreatedAt, &token.LastUsedAt, &token.LastIP, &token.IsAdmin)
 	if err == sql.ErrNoRows {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "token not found",
-		})
+		return jsonError(c, http.StatusNotFound, "token not found")
 	} else if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "database error",
-		})
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	if token.Token, err = h.cipher.Decrypt(token.Token); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to decrypt token")
 	}
 
 	return c.JSON(http.StatusOK, token)
 }
 
-// DeleteToken removes a token by username
+// DeleteToken revokes a token by username. The token is kept with its revocation time so that it
+// can be restored.
 func (h *Handler) DeleteToken(c echo.Context) error {
 	username := c.Param("username")
 	if username == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "username parameter is required",
-		})
+		return jsonError(c, http.StatusBadRequest, "username parameter is required")
+	}
+
+	revokedBy, _ := c.Get("username").(string)
+	err := database.RevokeToken(h.db, username, revokedBy)
+	if errors.Is(err, database.ErrTokenNotFound) {
+		return jsonError(c, http.StatusNotFound, "token not found")
+	} else if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
 	}
+	h.authCache.Invalidate(username)
 
-	result, err := h.db.Exec("DELETE FROM user_tokens WHERE username = ?", username)
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "token revoked successfully",
+	})
+}
+
+// GetRevokedTokens returns the revoked tokens, most recently revoked first
+func (h *Handler) GetRevokedTokens(c echo.Context) error {
+	rows, err := h.db.Query(`SELECT username, created_at, last_used_at, last_ip, is_admin, revoked_at, revoked_by FROM user_tokens
+		WHERE revoked_at IS NOT NULL ORDER BY revoked_at DESC`)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "database error",
-		})
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	defer rows.Close()
+
+	tokens := []RevokedToken{}
+	for rows.Next() {
+		var token RevokedToken
+		if err := rows.Scan(&token.Username, &token.CreatedAt, &token.LastUsedAt, &token.LastIP, &token.IsAdmin, &token.RevokedAt, &token.RevokedBy); err != nil {
+			return jsonError(c, http.StatusInternalServerError, "failed to scan token")
+		}
+		tokens = append(tokens, token)
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// RestoreToken restores a revoked token, which can authenticate again with its previous secret
+func (h *Handler) RestoreToken(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return jsonError(c, http.StatusBadRequest, "username parameter is required")
+	}
+
+	result, err := h.db.Exec("UPDATE user_tokens SET revoked_at = NULL, revoked_by = NULL WHERE username = ? AND revoked_at IS NOT NULL", username)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "database error")
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "failed to check affected rows",
-		})
+		return jsonError(c, http.StatusInternalServerError, "failed to check affected rows")
 	}
 
 	if rowsAffected == 0 {
-		return c.JSON(http.StatusNotFound, map[string]string{
-			"error": "token not found",
-		})
+		return jsonError(c, http.StatusNotFound, "revoked token not found")
 	}
+	h.authCache.Invalidate(username)
 
 	return c.JSON(http.StatusOK, map[string]string{
-		"message": "token deleted successfully",
+		"message": "token restored successfully",
 	})
-}
\ No newline at end of file
+}
@@ -12,6 +12,8 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/health"
+	"github.com/nerzhul/home-bt-broker/internal/lockout"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -37,6 +39,38 @@ func TestHandler_Liveness(t *testing.T) {
 	assert.Equal(t, "alive", response["status"])
 }
 
+func TestHandler_Liveness_Deep(t *testing.T) {
+	e := echo.New()
+	monitor := health.NewMonitor()
+	monitor.Register("dbus", time.Hour)
+	monitor.Beat("dbus", time.Millisecond)
+
+	h := &Handler{}
+	h.SetMonitor(monitor)
+
+	req := httptest.NewRequest(http.MethodGet, "/livez?deep=true", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, h.Liveness(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response DeepLivenessResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "alive", response.Status)
+	assert.Greater(t, response.Goroutines, 0)
+	assert.Len(t, response.Loops, 1)
+
+	// A loop which never beats stalls after a few intervals
+	monitor.Register("signals", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	req = httptest.NewRequest(http.MethodGet, "/livez?deep=true", nil)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, h.Liveness(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "stalled", response.Status)
+}
+
 func TestHandler_Readiness(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -108,13 +142,13 @@ func TestHandler_CreateToken(t *testing.T) {
 			requestBody: `{"username":"testuser","token":"testtoken"}`,
 			setupMock: func(mock sqlmock.Sqlmock) {
 				// First query to check if username exists
-				mock.ExpectQuery("SELECT token FROM user_tokens WHERE username = ?").
+				mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM user_tokens WHERE username = ?").
 					WithArgs("testuser").
-					WillReturnError(sql.ErrNoRows)
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 				
 				// Insert new token
-				mock.ExpectExec("INSERT INTO user_tokens \\(username, token, created_at\\) VALUES \\(\\?, \\?, \\?\\)").
-					WithArgs("testuser", "testtoken", sqlmock.AnyArg()).
+				mock.ExpectExec("INSERT INTO user_tokens \\(username, token, created_at, is_admin\\) VALUES \\(\\?, \\?, \\?, \\?\\)").
+					WithArgs("testuser", "testtoken", sqlmock.AnyArg(), false).
 					WillReturnResult(sqlmock.NewResult(1, 1))
 			},
 			expectedStatus: http.StatusCreated,
@@ -124,9 +158,9 @@ func TestHandler_CreateToken(t *testing.T) {
 			name:        "failure - username already exists",
 			requestBody: `{"username":"testuser","token":"testtoken"}`,
 			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT token FROM user_tokens WHERE username = ?").
+				mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM user_tokens WHERE username = ?").
 					WithArgs("testuser").
-					WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow("existingtoken"))
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 			},
 			expectedStatus: http.StatusConflict,
 			expectedBody:   map[string]string{"error": "username already exists"},
@@ -142,12 +176,12 @@ func TestHandler_CreateToken(t *testing.T) {
 			name:        "failure - database error on insert",
 			requestBody: `{"username":"testuser","token":"testtoken"}`,
 			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT token FROM user_tokens WHERE username = ?").
+				mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM user_tokens WHERE username = ?").
 					WithArgs("testuser").
-					WillReturnError(sql.ErrNoRows)
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
 				
-				mock.ExpectExec("INSERT INTO user_tokens \\(username, token, created_at\\) VALUES \\(\\?, \\?, \\?\\)").
-					WithArgs("testuser", "testtoken", sqlmock.AnyArg()).
+				mock.ExpectExec("INSERT INTO user_tokens \\(username, token, created_at, is_admin\\) VALUES \\(\\?, \\?, \\?, \\?\\)").
+					WithArgs("testuser", "testtoken", sqlmock.AnyArg(), false).
 					WillReturnError(errors.New("database error"))
 			},
 			expectedStatus: http.StatusInternalServerError,
@@ -199,11 +233,11 @@ func TestHandler_GetTokens(t *testing.T) {
 		{
 			name: "success - returns tokens",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"username", "token", "created_at"}).
-					AddRow("user1", "token1", time.Now()).
-					AddRow("user2", "token2", time.Now())
+				rows := sqlmock.NewRows([]string{"username", "token", "created_at", "last_used_at", "last_ip", "is_admin"}).
+					AddRow("user1", "token1", time.Now(), time.Now(), "192.168.1.10", true).
+					AddRow("user2", "token2", time.Now(), nil, nil, false)
 				
-				mock.ExpectQuery("SELECT username, token, created_at FROM user_tokens ORDER BY created_at DESC").
+				mock.ExpectQuery("SELECT username, token, created_at, last_used_at, last_ip, is_admin FROM user_tokens WHERE revoked_at IS NULL ORDER BY created_at DESC").
 					WillReturnRows(rows)
 			},
 			expectedStatus: http.StatusOK,
@@ -215,8 +249,8 @@ func TestHandler_GetTokens(t *testing.T) {
 		{
 			name: "success - empty result",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"username", "token", "created_at"})
-				mock.ExpectQuery("SELECT username, token, created_at FROM user_tokens ORDER BY created_at DESC").
+				rows := sqlmock.NewRows([]string{"username", "token", "created_at", "last_used_at", "last_ip", "is_admin"})
+				mock.ExpectQuery("SELECT username, token, created_at, last_used_at, last_ip, is_admin FROM user_tokens WHERE revoked_at IS NULL ORDER BY created_at DESC").
 					WillReturnRows(rows)
 			},
 			expectedStatus: http.StatusOK,
@@ -225,7 +259,7 @@ func TestHandler_GetTokens(t *testing.T) {
 		{
 			name: "failure - database error",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT username, token, created_at FROM user_tokens ORDER BY created_at DESC").
+				mock.ExpectQuery("SELECT username, token, created_at, last_used_at, last_ip, is_admin FROM user_tokens WHERE revoked_at IS NULL ORDER BY created_at DESC").
 					WillReturnError(errors.New("database error"))
 			},
 			expectedStatus: http.StatusInternalServerError,
@@ -284,10 +318,10 @@ func TestHandler_GetToken(t *testing.T) {
 			name:     "success - token found",
 			username: "testuser",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				rows := sqlmock.NewRows([]string{"username", "token", "created_at"}).
-					AddRow("testuser", "testtoken", time.Now())
+				rows := sqlmock.NewRows([]string{"username", "token", "created_at", "last_used_at", "last_ip", "is_admin"}).
+					AddRow("testuser", "testtoken", time.Now(), time.Now(), "192.168.1.10", false)
 				
-				mock.ExpectQuery("SELECT username, token, created_at FROM user_tokens WHERE username = ?").
+				mock.ExpectQuery("SELECT username, token, created_at, last_used_at, last_ip, is_admin FROM user_tokens WHERE username = ?").
 					WithArgs("testuser").
 					WillReturnRows(rows)
 			},
@@ -298,7 +332,7 @@ func TestHandler_GetToken(t *testing.T) {
 			name:     "failure - token not found",
 			username: "nonexistent",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT username, token, created_at FROM user_tokens WHERE username = ?").
+				mock.ExpectQuery("SELECT username, token, created_at, last_used_at, last_ip, is_admin FROM user_tokens WHERE username = ?").
 					WithArgs("nonexistent").
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -362,19 +396,19 @@ func TestHandler_DeleteToken(t *testing.T) {
 			name:     "success - token deleted",
 			username: "testuser",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM user_tokens WHERE username = ?").
-					WithArgs("testuser").
+				mock.ExpectExec("UPDATE user_tokens SET revoked_at = \\?, revoked_by = \\? WHERE username = \\? AND revoked_at IS NULL").
+					WithArgs(sqlmock.AnyArg(), "admin", "testuser").
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 			expectedStatus: http.StatusOK,
-			expectedBody:   map[string]string{"message": "token deleted successfully"},
+			expectedBody:   map[string]string{"message": "token revoked successfully"},
 		},
 		{
 			name:     "failure - token not found",
 			username: "nonexistent",
 			setupMock: func(mock sqlmock.Sqlmock) {
-				mock.ExpectExec("DELETE FROM user_tokens WHERE username = ?").
-					WithArgs("nonexistent").
+				mock.ExpectExec("UPDATE user_tokens SET revoked_at").
+					WithArgs(sqlmock.AnyArg(), "admin", "nonexistent").
 					WillReturnResult(sqlmock.NewResult(0, 0))
 			},
 			expectedStatus: http.StatusNotFound,
@@ -404,6 +438,7 @@ func TestHandler_DeleteToken(t *testing.T) {
 			c := e.NewContext(req, rec)
 			c.SetParamNames("username")
 			c.SetParamValues(tt.username)
+			c.Set("username", "admin")
 
 			h := NewHandlerWithDB(db)
 
@@ -422,4 +457,277 @@ func TestHandler_DeleteToken(t *testing.T) {
 			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
-}
\ No newline at end of file
+}
+func TestJSONError_IncludesRequestID(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tokens/unknown", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1234")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	err := jsonError(c, http.StatusNotFound, "token not found")
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	var response map[string]string
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"error": "token not found", "request_id": "req-1234"}, response)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		username       string
+		password       string
+		setupMock      func(sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:     "success - valid credentials record usage",
+			username: "testuser",
+			password: "testtoken",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT token, is_admin FROM user_tokens WHERE username = ?").
+					WithArgs("testuser").
+					WillReturnRows(sqlmock.NewRows([]string{"token", "is_admin"}).AddRow("testtoken", false))
+				mock.ExpectExec("UPDATE user_tokens SET last_used_at = \\?, last_ip = \\? WHERE username = \\?").
+					WithArgs(sqlmock.AnyArg(), "192.168.1.10", "testuser").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:     "success - usage update failure does not block the request",
+			username: "testuser",
+			password: "testtoken",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT token, is_admin FROM user_tokens WHERE username = ?").
+					WithArgs("testuser").
+					WillReturnRows(sqlmock.NewRows([]string{"token", "is_admin"}).AddRow("testtoken", false))
+				mock.ExpectExec("UPDATE user_tokens SET last_used_at = \\?, last_ip = \\? WHERE username = \\?").
+					WillReturnError(errors.New("database is locked"))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:     "failure - wrong password",
+			username: "testuser",
+			password: "wrong",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT token, is_admin FROM user_tokens WHERE username = ?").
+					WithArgs("testuser").
+					WillReturnRows(sqlmock.NewRows([]string{"token", "is_admin"}).AddRow("testtoken", false))
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "failure - missing credentials",
+			setupMock:      func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			tt.setupMock(mock)
+
+			e := echo.New()
+			e.IPExtractor = echo.ExtractIPDirect()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/tokens", nil)
+			req.RemoteAddr = "192.168.1.10:4242"
+			if tt.username != "" {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Test
+			err = AuthMiddleware(db, nil)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAdminMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		isAdmin        interface{}
+		expectedStatus int
+	}{
+		{
+			name:           "success - admin principal",
+			isAdmin:        true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - non-admin principal",
+			isAdmin:        false,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "failure - unauthenticated context",
+			isAdmin:        nil,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodDelete, "/api/v1/tokens/someone", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			if tt.isAdmin != nil {
+				c.Set("is_admin", tt.isAdmin)
+			}
+
+			// Test
+			err := AdminMiddleware(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestAuthMiddleware_NonAdminDeniedOnTokenRoutes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT token, is_admin FROM user_tokens WHERE username = ?").
+		WithArgs("speaker").
+		WillReturnRows(sqlmock.NewRows([]string{"token", "is_admin"}).AddRow("secret", false))
+	mock.ExpectExec("UPDATE user_tokens SET last_used_at = \\?, last_ip = \\? WHERE username = \\?").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	e := echo.New()
+	h := NewHandlerWithDB(db)
+	e.GET("/api/v1/tokens", h.GetTokens, AuthMiddleware(db, nil), AdminMiddleware)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/tokens", nil)
+	req.SetBasicAuth("speaker", "secret")
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	var response map[string]string
+	err = json.Unmarshal(rec.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin privileges required", response["error"])
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandler_GetRevokedTokens(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	revokedAt := time.Date(2026, 1, 2, 10, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("FROM user_tokens\\s+WHERE revoked_at IS NOT NULL ORDER BY revoked_at DESC").
+		WillReturnRows(sqlmock.NewRows([]string{"username", "created_at", "last_used_at", "last_ip", "is_admin", "revoked_at", "revoked_by"}).
+			AddRow("user1", time.Now(), nil, nil, false, revokedAt, "admin"))
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/tokens/revoked", nil), rec)
+
+	assert.NoError(t, NewHandlerWithDB(db).GetRevokedTokens(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response []RevokedToken
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response, 1)
+	assert.Equal(t, "user1", response[0].Username)
+	assert.Equal(t, revokedAt, response[0].RevokedAt)
+	assert.Equal(t, "admin", *response[0].RevokedBy)
+	assert.NotContains(t, rec.Body.String(), `"token"`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandler_RestoreToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		rowsAffected   int64
+		expectedStatus int
+	}{
+		{name: "success - token restored", rowsAffected: 1, expectedStatus: http.StatusOK},
+		{name: "failure - token not revoked", rowsAffected: 0, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectExec("UPDATE user_tokens SET revoked_at = NULL, revoked_by = NULL WHERE username = \\? AND revoked_at IS NOT NULL").
+				WithArgs("user1").
+				WillReturnResult(sqlmock.NewResult(0, tt.rowsAffected))
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/api/v1/tokens/revoked/user1/restore", nil), rec)
+			c.SetParamNames("username")
+			c.SetParamValues("user1")
+
+			assert.NoError(t, NewHandlerWithDB(db).RestoreToken(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAuthMiddleware_Lockout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Only the two failures reaching the threshold are verified, the locked out client is then
+	// refused without looking its credentials up, even the right ones
+	for range 2 {
+		mock.ExpectQuery("SELECT token, is_admin FROM user_tokens WHERE username = ?").
+			WithArgs("admin").
+			WillReturnRows(sqlmock.NewRows([]string{"token", "is_admin"}).AddRow("secret", true))
+	}
+
+	e := echo.New()
+	tracker := lockout.NewTracker(2, time.Minute, time.Hour, nil, nil)
+	e.GET("/api/v1/tokens", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, AuthMiddlewareWithOptions(db, nil, AuthOptions{Lockout: tracker}))
+
+	request := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tokens", nil)
+		req.SetBasicAuth("admin", password)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request("guess1").Code)
+	rec := request("guess2")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "61", rec.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusTooManyRequests, request("secret").Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/presence"
+)
+
+// HomeAssistantHandler exposes a REST surface suited to a Home Assistant custom component
+type HomeAssistantHandler struct {
+	btManager bluetooth.BluetoothManagerInterface
+	tracker   *presence.Tracker
+	db        database.DatabaseInterface
+}
+
+// HAState is a snapshot of every adapter, device and presence state, polled by the integration
+type HAState struct {
+	Timestamp time.Time           `json:"timestamp"`
+	Adapters  []bluetooth.Adapter `json:"adapters"`
+	Devices   []bluetooth.Device  `json:"devices"`
+	Presence  []presence.Status   `json:"presence"`
+}
+
+type CreateHATokenRequest struct {
+	// Token is the long-lived access token created in the Home Assistant user profile
+	Token    string `json:"token"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+// NewHomeAssistantHandler creates a new Home Assistant handler
+func NewHomeAssistantHandler(btManager bluetooth.BluetoothManagerInterface, tracker *presence.Tracker, db database.DatabaseInterface) *HomeAssistantHandler {
+	return &HomeAssistantHandler{btManager: btManager, tracker: tracker, db: db}
+}
+
+// GetState returns the state of all adapters and devices in a single response
+func (hh *HomeAssistantHandler) GetState(c echo.Context) error {
+	adapters, err := hh.btManager.GetAdapters()
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	state := HAState{
+		Timestamp: time.Now(),
+		Adapters:  adapters,
+		Devices:   []bluetooth.Device{},
+		Presence:  hh.tracker.Statuses(),
+	}
+	for _, adapter := range adapters {
+		devices, err := hh.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			return jsonError(c, http.StatusInternalServerError, err.Error())
+		}
+		state.Devices = append(state.Devices, devices...)
+	}
+
+	return c.JSON(http.StatusOK, state)
+}
+
+// GetTokens returns the Home Assistant tokens mapped to broker users
+func (hh *HomeAssistantHandler) GetTokens(c echo.Context) error {
+	mappings, err := database.GetHATokenMappings(hh.db)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"tokens": mappings,
+	})
+}
+
+// CreateToken maps a Home Assistant long-lived access token to a broker user, so the integration
+// can authenticate with the token it already sends as a Bearer token
+func (hh *HomeAssistantHandler) CreateToken(c echo.Context) error {
+	var req CreateHATokenRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	if req.Token == "" || req.Username == "" {
+		return jsonError(c, http.StatusBadRequest, "token and username are required")
+	}
+
+	var exists int
+	err := hh.db.QueryRow("SELECT 1 FROM user_tokens WHERE username = ? AND revoked_at IS NULL", req.Username).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return jsonError(c, http.StatusBadRequest, "unknown username")
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	mapping := database.HATokenMapping{
+		Username:  req.Username,
+		Name:      req.Name,
+		CreatedAt: time.Now(),
+	}
+	mapping.ID, err = database.AddHATokenMapping(hh.db, hashBearerToken(req.Token), mapping)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, mapping)
+}
+
+// DeleteToken revokes a Home Assistant token
+func (hh *HomeAssistantHandler) DeleteToken(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid token id")
+	}
+
+	if err := database.DeleteHATokenMapping(hh.db, id); err != nil {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "Home Assistant token revoked",
+	})
+}
+
+// bearerAuth authenticates a request with a Home Assistant token, as the user it is mapped to, or
+// with a pairing session token
+func bearerAuth(c echo.Context, db database.DatabaseInterface, token string, next echo.HandlerFunc) error {
+	var username string
+	var isAdmin bool
+	err := db.QueryRow(`SELECT h.username, t.is_admin FROM ha_tokens h
+		JOIN user_tokens t ON t.username = h.username AND t.revoked_at IS NULL
+		WHERE h.token_hash = ?`, hashBearerToken(token)).Scan(&username, &isAdmin)
+	if err == sql.ErrNoRows {
+		return pairingSessionAuth(c, db, token, next)
+	} else if err != nil {
+		log.Printf("request_id=%s failed to look up bearer token: %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	recordTokenUsage(c, db, username)
+
+	c.Set("username", username)
+	c.Set("is_admin", isAdmin)
+	return next(c)
+}
+
+func hashBearerToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/presence"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHomeAssistantHandler_GetState(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Name: "hci0", Address: "00:1A:7D:DA:71:01", Powered: true},
+	}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Path: "/org/bluez/hci0/dev_38_18_4C_12_34_56", Name: "Headset", Address: "38:18:4C:12:34:56", Connected: true, Adapter: "hci0"},
+		{Path: "/org/bluez/hci0/dev_DC_2C_26_AB_CD_EF", Name: "Keyboard", Address: "DC:2C:26:AB:CD:EF", Paired: true, Adapter: "hci0"},
+	}, nil)
+
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	tracker := presence.NewTracker(btMock, db, events.NewHub(), time.Minute, time.Minute)
+	h := NewHomeAssistantHandler(btMock, tracker, db)
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/ha/state", nil), rec)
+	assert.NoError(t, h.GetState(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var state HAState
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+	assert.Len(t, state.Adapters, 1)
+	assert.Len(t, state.Devices, 2)
+	assert.Equal(t, "Headset", state.Devices[0].Name)
+	assert.NotNil(t, state.Presence)
+}
+
+func TestHomeAssistantHandler_CreateToken(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	h := NewHomeAssistantHandler(nil, nil, db)
+	e := echo.New()
+
+	// Test - the token is stored hashed
+	dbMock.ExpectQuery("SELECT 1 FROM user_tokens WHERE username = ?").
+		WithArgs("homeassistant").
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	dbMock.ExpectExec("INSERT INTO ha_tokens").
+		WithArgs(hashBearerToken("ha-long-lived"), "homeassistant", "Home Assistant", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/ha/tokens", strings.NewReader(`{"token": "ha-long-lived", "username": "homeassistant", "name": "Home Assistant"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	assert.NoError(t, h.CreateToken(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "ha-long-lived")
+
+	var mapping map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &mapping))
+	assert.Equal(t, float64(3), mapping["id"])
+
+	// Test - unknown user
+	dbMock.ExpectQuery("SELECT 1 FROM user_tokens WHERE username = ?").
+		WithArgs("nobody").
+		WillReturnRows(sqlmock.NewRows([]string{"1"}))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/ha/tokens", strings.NewReader(`{"token": "ha-long-lived", "username": "nobody"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	assert.NoError(t, h.CreateToken(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Test - missing token
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/ha/tokens", strings.NewReader(`{"username": "homeassistant"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	assert.NoError(t, h.CreateToken(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestAuthMiddleware_BearerToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		token          string
+		setupMock      func(sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:  "success - mapped token authenticates as its user",
+			token: "ha-long-lived",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT h.username, t.is_admin FROM ha_tokens h").
+					WithArgs(hashBearerToken("ha-long-lived")).
+					WillReturnRows(sqlmock.NewRows([]string{"username", "is_admin"}).AddRow("homeassistant", false))
+				mock.ExpectExec("UPDATE user_tokens SET last_used_at = \\?, last_ip = \\? WHERE username = \\?").
+					WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "homeassistant").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "failure - unknown token",
+			token: "unknown",
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT h.username, t.is_admin FROM ha_tokens h").
+					WithArgs(hashBearerToken("unknown")).
+					WillReturnRows(sqlmock.NewRows([]string{"username", "is_admin"}))
+				mock.ExpectQuery("FROM pairing_sessions s JOIN user_tokens t").
+					WithArgs(hashBearerToken("unknown"), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"username", "adapter", "created_at", "expires_at"}))
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			tt.setupMock(mock)
+
+			e := echo.New()
+			e.GET("/api/v1/ha/state", func(c echo.Context) error {
+				assert.Equal(t, "homeassistant", c.Get("username"))
+				return c.NoContent(http.StatusOK)
+			}, AuthMiddleware(db, nil))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/ha/state", nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
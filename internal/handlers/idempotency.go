@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+const (
+	// HeaderIdempotencyKey identifies a request across its retries
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set on the responses replayed for a retried request
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+	// maxIdempotencyKeyLength is the longest idempotency key accepted, enough for a UUID or a hash
+	maxIdempotencyKeyLength = 255
+)
+
+// capturingWriter copies the body of a response while it is written
+type capturingWriter struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap gives access to the underlying writer, e.g. to flush it
+func (w *capturingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// requestFingerprint identifies a request by its method, URI and body
+func requestFingerprint(method, uri string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + uri + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// IdempotencyMiddleware replays the response of a POST or DELETE request retried with the same
+// Idempotency-Key header within window, so that a client retrying on a flaky network does not
+// run an operation, such as a pairing, twice. A retry arriving while the request is still running
+// gets 409 Conflict, and a key reused for another request 422 Unprocessable Entity. Server errors
+// and exhausted quotas are not stored, so that they can be retried. It must be chained after AuthMiddleware, keys
+// being scoped by user.
+func IdempotencyMiddleware(db database.DatabaseInterface, window time.Duration) echo.MiddlewareFunc {
+	var mu sync.Mutex
+	inFlight := make(map[string]bool)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			key := req.Header.Get(HeaderIdempotencyKey)
+			if key == "" || (req.Method != http.MethodPost && req.Method != http.MethodDelete) {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				return jsonError(c, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			}
+
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return jsonError(c, http.StatusBadRequest, "failed to read request body")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			fingerprint := requestFingerprint(req.Method, req.URL.RequestURI(), body)
+
+			username, _ := c.Get("username").(string)
+			id := username + "\x00" + key
+			mu.Lock()
+			if inFlight[id] {
+				mu.Unlock()
+				return jsonError(c, http.StatusConflict, "a request with this Idempotency-Key is in progress")
+			}
+			inFlight[id] = true
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				delete(inFlight, id)
+				mu.Unlock()
+			}()
+
+			now := time.Now()
+			stored, err := database.GetIdempotentResponse(db, username, key, now.Add(-window))
+			if err != nil {
+				log.Printf("request_id=%s %v", RequestID(c), err)
+				return jsonError(c, http.StatusInternalServerError, "database error")
+			}
+			if stored != nil {
+				if stored.Fingerprint != fingerprint {
+					return jsonError(c, http.StatusUnprocessableEntity, "Idempotency-Key was used for another request")
+				}
+				c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+				if stored.ContentType == "" {
+					return c.NoContent(stored.Status)
+				}
+				return c.Blob(stored.Status, stored.ContentType, stored.Body)
+			}
+
+			writer := &capturingWriter{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = writer
+			if err := next(c); err != nil {
+				// Let the error handler write the response so that it is captured
+				c.Error(err)
+			}
+			c.Response().Writer = writer.ResponseWriter
+
+			if status := c.Response().Status; status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+				return nil
+			}
+			resp := database.IdempotentResponse{
+				Fingerprint: fingerprint,
+				Status:      c.Response().Status,
+				ContentType: c.Response().Header().Get(echo.HeaderContentType),
+				Body:        writer.body.Bytes(),
+				CreatedAt:   now,
+			}
+			if err := database.SaveIdempotentResponse(db, username, key, resp, now.Add(-window)); err != nil {
+				log.Printf("request_id=%s %v", RequestID(c), err)
+			}
+			return nil
+		}
+	}
+}
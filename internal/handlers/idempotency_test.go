@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	const path = "/api/v1/bluetooth/adapters/hci0/devices/11:22:33:44:55:66/pair"
+	body := `{"pin":"0000"}`
+	fingerprint := requestFingerprint(http.MethodPost, path, []byte(body))
+
+	tests := []struct {
+		name           string
+		key            string
+		handlerStatus  int
+		setup          func(sqlmock.Sqlmock)
+		expectedStatus int
+		expectedCalls  int
+		expectedReplay bool
+	}{
+		{
+			name:          "success - first request stored",
+			key:           "retry-1",
+			handlerStatus: http.StatusOK,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT fingerprint, status, content_type, body, created_at FROM idempotency_keys").
+					WithArgs("alice", "retry-1", sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status", "content_type", "body", "created_at"}))
+				mock.ExpectExec("DELETE FROM idempotency_keys WHERE created_at < ?").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("INSERT INTO idempotency_keys").
+					WithArgs("alice", "retry-1", fingerprint, http.StatusOK, echo.MIMEApplicationJSON, []byte("{\"paired\":true}\n"), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  1,
+		},
+		{
+			name: "success - retry replayed",
+			key:  "retry-1",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT fingerprint, status, content_type, body, created_at FROM idempotency_keys").
+					WithArgs("alice", "retry-1", sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status", "content_type", "body", "created_at"}).
+						AddRow(fingerprint, http.StatusOK, echo.MIMEApplicationJSON, []byte("{\"paired\":true}\n"), time.Now()))
+			},
+			expectedStatus: http.StatusOK,
+			expectedReplay: true,
+		},
+		{
+			name: "failure - key used for another request",
+			key:  "retry-1",
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT fingerprint, status, content_type, body, created_at FROM idempotency_keys").
+					WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status", "content_type", "body", "created_at"}).
+						AddRow("other", http.StatusOK, echo.MIMEApplicationJSON, []byte("{}"), time.Now()))
+			},
+			expectedStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:          "success - server error not stored",
+			key:           "retry-2",
+			handlerStatus: http.StatusInternalServerError,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT fingerprint, status, content_type, body, created_at FROM idempotency_keys").
+					WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status", "content_type", "body", "created_at"}))
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCalls:  1,
+		},
+		{
+			name:           "success - no key",
+			handlerStatus:  http.StatusOK,
+			setup:          func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusOK,
+			expectedCalls:  1,
+		},
+		{
+			name:           "failure - key too long",
+			key:            strings.Repeat("k", 256),
+			setup:          func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			tt.setup(mock)
+
+			calls := 0
+			e := echo.New()
+			e.POST(path, func(c echo.Context) error {
+				calls++
+				if tt.handlerStatus == http.StatusInternalServerError {
+					return echo.NewHTTPError(http.StatusInternalServerError, "pairing failed")
+				}
+				return c.JSON(tt.handlerStatus, map[string]bool{"paired": true})
+			}, func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					c.Set("username", "alice")
+					return next(c)
+				}
+			}, IdempotencyMiddleware(db, time.Hour))
+
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			req.Header.Set(HeaderIdempotencyKey, tt.key)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, tt.expectedCalls, calls)
+			assert.Equal(t, tt.expectedReplay, rec.Header().Get(HeaderIdempotentReplayed) == "true")
+			if tt.expectedReplay {
+				assert.Equal(t, "{\"paired\":true}\n", rec.Body.String())
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestIdempotencyMiddleware_InFlight(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+	mock.ExpectQuery("SELECT fingerprint, status, content_type, body, created_at FROM idempotency_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"fingerprint", "status", "content_type", "body", "created_at"}))
+	mock.ExpectExec("DELETE FROM idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO idempotency_keys").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	e := echo.New()
+	e.POST("/pair", func(c echo.Context) error {
+		close(started)
+		<-release
+		return c.NoContent(http.StatusAccepted)
+	}, IdempotencyMiddleware(db, time.Hour))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/pair", nil)
+		req.Header.Set(HeaderIdempotencyKey, "retry-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- send() }()
+	<-started
+
+	assert.Equal(t, http.StatusConflict, send().Code)
+	close(release)
+	assert.Equal(t, http.StatusAccepted, (<-done).Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// maxIdleTimeoutMinutes is the longest idle timeout of a policy, one day
+const maxIdleTimeoutMinutes = 24 * 60
+
+// IdleHandler manages the idle-disconnect policies
+type IdleHandler struct {
+	db database.DatabaseInterface
+}
+
+type SetIdlePolicyRequest struct {
+	TimeoutMinutes int `json:"timeout_minutes"`
+}
+
+// NewIdleHandler creates a new idle policy handler
+func NewIdleHandler(db database.DatabaseInterface) *IdleHandler {
+	return &IdleHandler{db: db}
+}
+
+// GetIdlePolicies returns the idle-disconnect policies
+func (ih *IdleHandler) GetIdlePolicies(c echo.Context) error {
+	policies, err := database.GetIdlePolicies(ih.db)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, policies)
+}
+
+// SetIdlePolicy stores the idle-disconnect policy of a device address or device class
+func (ih *IdleHandler) SetIdlePolicy(c echo.Context) error {
+	target, ok := idlePolicyTarget(c.Param("target"))
+	if !ok {
+		return jsonError(c, http.StatusBadRequest, "target must be a device address or a device class name")
+	}
+
+	var req SetIdlePolicyRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	if req.TimeoutMinutes < 1 || req.TimeoutMinutes > maxIdleTimeoutMinutes {
+		return jsonError(c, http.StatusBadRequest, "timeout_minutes must be between 1 and 1440")
+	}
+
+	policy := database.IdlePolicy{
+		Target:         target,
+		TimeoutMinutes: req.TimeoutMinutes,
+		UpdatedAt:      time.Now(),
+	}
+	if err := database.SetIdlePolicy(ih.db, policy); err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, policy)
+}
+
+// DeleteIdlePolicy removes an idle-disconnect policy
+func (ih *IdleHandler) DeleteIdlePolicy(c echo.Context) error {
+	target, ok := idlePolicyTarget(c.Param("target"))
+	if !ok {
+		return jsonError(c, http.StatusBadRequest, "target must be a device address or a device class name")
+	}
+
+	if err := database.DeleteIdlePolicy(ih.db, target); err != nil {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "idle policy removed",
+	})
+}
+
+// idlePolicyTarget normalizes the target of a policy: an upper-case device address or a class name
+func idlePolicyTarget(target string) (string, bool) {
+	if hw, err := net.ParseMAC(target); err == nil && len(hw) == 6 && strings.Count(target, ":") == 5 {
+		return strings.ToUpper(target), true
+	}
+	target = strings.ToLower(target)
+	return target, bluetooth.IsClassName(target)
+}
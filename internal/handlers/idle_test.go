@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleHandler_SetIdlePolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		requestBody    string
+		setupMock      func(sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:        "success - device address",
+			target:      "aa:bb:cc:dd:ee:ff",
+			requestBody: `{"timeout_minutes": 30}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO idle_policies").
+					WithArgs("AA:BB:CC:DD:EE:FF", 30, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "success - device class",
+			target:      "Headphones",
+			requestBody: `{"timeout_minutes": 15}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO idle_policies").
+					WithArgs("headphones", 15, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - unknown class",
+			target:         "toaster",
+			requestBody:    `{"timeout_minutes": 15}`,
+			setupMock:      func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - timeout out of range",
+			target:         "headphones",
+			requestBody:    `{"timeout_minutes": 0}`,
+			setupMock:      func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			tt.setupMock(dbMock)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/bluetooth/idle-policies/"+tt.target, strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("target")
+			c.SetParamValues(tt.target)
+
+			assert.NoError(t, NewIdleHandler(db).SetIdlePolicy(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluez"
+)
+
+const (
+	// DefaultJournalLines is the number of past journal entries sent before following the new ones
+	DefaultJournalLines = 100
+	// MaxJournalLines bounds the number of past journal entries
+	MaxJournalLines = 1000
+)
+
+// JournalHandler streams the journal of bluetoothd, to debug pairing failures without a shell on
+// the host
+type JournalHandler struct {
+	reader bluez.JournalReader
+}
+
+// NewJournalHandler creates a new journal handler
+func NewJournalHandler(reader bluez.JournalReader) *JournalHandler {
+	return &JournalHandler{reader: reader}
+}
+
+// StreamBluetoothd sends the journal entries of bluetoothd as Server-Sent Events until the client
+// disconnects. The lines query parameter sets the number of past entries, and priority only keeps
+// the entries of a priority or more severe.
+func (jh *JournalHandler) StreamBluetoothd(c echo.Context) error {
+	lines := DefaultJournalLines
+	if value := c.QueryParam("lines"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > MaxJournalLines {
+			return jsonError(c, http.StatusBadRequest, "lines must be between 0 and "+strconv.Itoa(MaxJournalLines))
+		}
+		lines = n
+	}
+	priority := c.QueryParam("priority")
+	if priority != "" {
+		if _, err := bluez.ParseJournalPriority(priority); err != nil {
+			return jsonError(c, http.StatusBadRequest, err.Error())
+		}
+	}
+
+	entries, err := jh.reader.Follow(c.Request().Context(), bluez.JournalOptions{Lines: lines, Priority: priority})
+	if err != nil {
+		return jsonError(c, http.StatusServiceUnavailable, "failed to read the journal: "+err.Error())
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(res, ": keepalive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case entry, ok := <-entries:
+			if !ok {
+				return nil
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(res, "event: journal\ndata: %s\n\n", data); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluez"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeJournal struct {
+	entries []bluez.JournalEntry
+	err     error
+	opts    bluez.JournalOptions
+}
+
+func (f *fakeJournal) Follow(_ context.Context, opts bluez.JournalOptions) (<-chan bluez.JournalEntry, error) {
+	f.opts = opts
+	if f.err != nil {
+		return nil, f.err
+	}
+	ch := make(chan bluez.JournalEntry, len(f.entries))
+	for _, entry := range f.entries {
+		ch <- entry
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestJournalHandler_StreamBluetoothd(t *testing.T) {
+	journal := &fakeJournal{entries: []bluez.JournalEntry{{
+		Time:       time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC),
+		Priority:   3,
+		Identifier: "bluetoothd",
+		PID:        612,
+		Message:    "Authentication Failed (0x05)",
+	}}}
+	e := echo.New()
+	jh := NewJournalHandler(journal)
+	stream := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/bluetoothd/journal"+query, nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, jh.StreamBluetoothd(e.NewContext(req, rec)))
+		return rec
+	}
+
+	rec := stream("?lines=10&priority=err")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get(echo.HeaderContentType))
+	assert.Equal(t, bluez.JournalOptions{Lines: 10, Priority: "err"}, journal.opts)
+	assert.Equal(t, "event: journal\ndata: {\"time\":\"2026-10-16T10:00:00Z\",\"priority\":3,\"identifier\":\"bluetoothd\",\"pid\":612,\"message\":\"Authentication Failed (0x05)\"}\n\n", rec.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, stream("?lines=5000").Code)
+	assert.Equal(t, http.StatusBadRequest, stream("?priority=loud").Code)
+
+	journal.err = errors.New(`exec: "journalctl": executable file not found in $PATH`)
+	assert.Equal(t, http.StatusServiceUnavailable, stream("").Code)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluez"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// KnownDevicesHandler exposes the devices imported from the BlueZ storage
+type KnownDevicesHandler struct {
+	db         database.DatabaseInterface
+	cipher     *secrets.Cipher
+	storageDir string
+}
+
+// NewKnownDevicesHandler creates a new known devices handler, importing from a BlueZ storage directory.
+// The device names are encrypted with the cipher when it is enabled.
+func NewKnownDevicesHandler(db database.DatabaseInterface, cipher *secrets.Cipher, storageDir string) *KnownDevicesHandler {
+	return &KnownDevicesHandler{db: db, cipher: cipher, storageDir: storageDir}
+}
+
+// GetKnownDevices returns the devices imported from the BlueZ storage
+func (kh *KnownDevicesHandler) GetKnownDevices(c echo.Context) error {
+	devices, err := database.GetKnownDevices(kh.db, kh.cipher)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"devices": devices,
+	})
+}
+
+// ImportKnownDevices reads the BlueZ storage again, updating the known devices
+func (kh *KnownDevicesHandler) ImportKnownDevices(c echo.Context) error {
+	count, err := bluez.Import(kh.db, kh.cipher, kh.storageDir)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "failed to import the BlueZ storage")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":  "BlueZ storage imported",
+		"imported": count,
+	})
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKnownDevicesHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	storage := t.TempDir()
+	info := filepath.Join(storage, "00:1A:7D:DA:71:01", "AA:BB:CC:DD:EE:FF", "info")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(info), 0700))
+	assert.NoError(t, os.WriteFile(info, []byte("[General]\nName=Headphones\n\n[LinkKey]\nKey=00\n"), 0600))
+
+	e := echo.New()
+	kh := NewKnownDevicesHandler(db, nil, storage)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT OR REPLACE INTO known_devices").
+		WithArgs("00:1A:7D:DA:71:01", "AA:BB:CC:DD:EE:FF", "Headphones", 0, false, false, true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	rec := httptest.NewRecorder()
+	assert.NoError(t, kh.ImportKnownDevices(e.NewContext(httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/known-devices/import", nil), rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"imported":1`)
+
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("FROM known_devices").
+		WillReturnRows(sqlmock.NewRows([]string{"adapter", "address", "name", "class", "trusted", "blocked", "has_link_key", "last_seen", "imported_at"}).
+			AddRow("00:1A:7D:DA:71:01", "AA:BB:CC:DD:EE:FF", "Headphones", 0, false, false, true, at, at))
+	rec = httptest.NewRecorder()
+	assert.NoError(t, kh.GetKnownDevices(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/known-devices", nil), rec)))
+	var response struct {
+		Devices []database.KnownDevice `json:"devices"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, []database.KnownDevice{{Adapter: "00:1A:7D:DA:71:01", Address: "AA:BB:CC:DD:EE:FF", Name: "Headphones", HasLinkKey: true, LastSeen: &at, ImportedAt: at}}, response.Devices)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
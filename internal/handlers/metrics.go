@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/statsd"
+)
+
+// deviceActions names the device actions whose outcome is counted per adapter, by route
+var deviceActions = map[string]string{
+	"POST /api/v1/bluetooth/adapters/:adapter/devices/:mac/pair":       "pair",
+	"POST /api/v1/bluetooth/adapters/:adapter/devices/:mac/connect":    "connect",
+	"POST /api/v1/bluetooth/adapters/:adapter/devices/:mac/disconnect": "disconnect",
+	"POST /api/v1/bluetooth/adapters/:adapter/devices/:mac/trust":      "trust",
+	"DELETE /api/v1/bluetooth/adapters/:adapter/devices/:mac":          "remove",
+}
+
+// routeMetricName turns a route such as /api/v1/bluetooth/adapters/:adapter into a metric name
+// segment such as bluetooth_adapters_adapter. Requests matching no route share "unmatched".
+func routeMetricName(route string) string {
+	route = strings.Trim(strings.TrimPrefix(route, "/api/v1"), "/")
+	if route == "" || route == "*" {
+		return "unmatched"
+	}
+	route = strings.NewReplacer("/", "_", ":", "", "*", "any", "-", "_").Replace(route)
+	return statsd.SanitizeName(route)
+}
+
+// StatsDMiddleware counts requests and their response status codes, and times them, in total and
+// per route and method. The outcome of the device actions, such as pairings, is also counted per
+// adapter.
+func StatsDMiddleware(client *statsd.Client) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				// Let the error handler write the response so its status is the one recorded
+				c.Error(err)
+			}
+			duration := time.Since(start)
+			status := c.Response().Status
+
+			client.Count("http.requests", 1)
+			client.Count(fmt.Sprintf("http.responses.%d", status), 1)
+			client.Timing("http.duration", duration)
+
+			method := c.Request().Method
+			route := "http.routes." + routeMetricName(c.Path()) + "." + strings.ToLower(method)
+			client.Count(fmt.Sprintf("%s.responses.%d", route, status), 1)
+			client.Timing(route+".duration", duration)
+
+			if action, ok := deviceActions[method+" "+c.Path()]; ok && c.Param("adapter") != "" {
+				outcome := "success"
+				if status >= http.StatusBadRequest {
+					outcome = "failure"
+				}
+				client.Count("bluetooth.adapter."+statsd.SanitizeName(c.Param("adapter"))+".actions."+action+"."+outcome, 1)
+			}
+			return nil
+		}
+	}
+}
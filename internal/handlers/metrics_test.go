@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/statsd"
+	"github.com/stretchr/testify/assert"
+)
+
+// readPackets reads n StatsD packets, sorted
+func readPackets(t *testing.T, conn net.PacketConn, n int) []string {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var packets []string
+	buf := make([]byte, 512)
+	for i := 0; i < n; i++ {
+		n, _, err := conn.ReadFrom(buf)
+		if !assert.NoError(t, err) {
+			break
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+	sort.Strings(packets)
+	return packets
+}
+
+func TestStatsDMiddleware(t *testing.T) {
+	// Setup
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client, err := statsd.NewClient(conn.LocalAddr().String(), "broker")
+	assert.NoError(t, err)
+	defer client.Close()
+
+	e := echo.New()
+	e.Use(StatsDMiddleware(client))
+	e.GET("/missing", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound)
+	})
+
+	// Test
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	packets := readPackets(t, conn, 5)
+	if assert.Len(t, packets, 5) {
+		assert.Contains(t, packets[0], "broker.http.duration:")
+		assert.Equal(t, "broker.http.requests:1|c", packets[1])
+		assert.Equal(t, "broker.http.responses.404:1|c", packets[2])
+		assert.Contains(t, packets[3], "broker.http.routes.missing.get.duration:")
+		assert.Equal(t, "broker.http.routes.missing.get.responses.404:1|c", packets[4])
+	}
+}
+
+func TestStatsDMiddleware_DeviceActions(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	client, err := statsd.NewClient(conn.LocalAddr().String(), "broker")
+	assert.NoError(t, err)
+	defer client.Close()
+
+	e := echo.New()
+	e.Use(StatsDMiddleware(client))
+	e.POST("/api/v1/bluetooth/adapters/:adapter/devices/:mac/pair", func(c echo.Context) error {
+		return jsonError(c, http.StatusInternalServerError, "pairing failed")
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/00:1A:7D:DA:71:01/devices/11:22:33:44:55:66/pair", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	packets := readPackets(t, conn, 6)
+	assert.Contains(t, packets, "broker.bluetooth.adapter.00_1a_7d_da_71_01.actions.pair.failure:1|c")
+	assert.Contains(t, packets, "broker.http.routes.bluetooth_adapters_adapter_devices_mac_pair.post.responses.500:1|c")
+}
+
+func TestRouteMetricName(t *testing.T) {
+	assert.Equal(t, "bluetooth_adapters_adapter_devices", routeMetricName("/api/v1/bluetooth/adapters/:adapter/devices"))
+	assert.Equal(t, "bluetooth_guest_mode", routeMetricName("/api/v1/bluetooth/guest-mode"))
+	assert.Equal(t, "livez", routeMetricName("/livez"))
+	assert.Equal(t, "unmatched", routeMetricName(""))
+	assert.Equal(t, "unmatched", routeMetricName("/*"))
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+)
+
+// PairingAllowlistHandler manages the devices allowed to pair when the pairing allowlist is enabled
+type PairingAllowlistHandler struct {
+	db     database.DatabaseInterface
+	cipher *secrets.Cipher
+}
+
+type AddPairingAllowlistRequest struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+}
+
+// NewPairingAllowlistHandler creates a new pairing allowlist handler, the names being encrypted with
+// the cipher when it is enabled
+func NewPairingAllowlistHandler(db database.DatabaseInterface, cipher *secrets.Cipher) *PairingAllowlistHandler {
+	return &PairingAllowlistHandler{db: db, cipher: cipher}
+}
+
+// GetEntries returns the devices allowed to pair
+func (ph *PairingAllowlistHandler) GetEntries(c echo.Context) error {
+	entries, err := database.GetPairingAllowlist(ph.db, ph.cipher)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"devices": entries,
+	})
+}
+
+// AddEntry allows a device to pair
+func (ph *PairingAllowlistHandler) AddEntry(c echo.Context) error {
+	var req AddPairingAllowlistRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	if req.Address == "" {
+		return jsonError(c, http.StatusBadRequest, "address is required")
+	}
+
+	entry := database.PairingAllowlistEntry{
+		Address:   strings.ToUpper(req.Address),
+		Name:      req.Name,
+		CreatedAt: time.Now(),
+	}
+	if err := database.AddPairingAllowlistEntry(ph.db, ph.cipher, entry); err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, entry)
+}
+
+// DeleteEntry removes a device from the pairing allowlist
+func (ph *PairingAllowlistHandler) DeleteEntry(c echo.Context) error {
+	if err := database.DeletePairingAllowlistEntry(ph.db, strings.ToUpper(c.Param("mac"))); err != nil {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "device removed from the pairing allowlist",
+	})
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairingAllowlistHandler(t *testing.T) {
+	// Setup
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	h := NewPairingAllowlistHandler(db, nil)
+	e := echo.New()
+
+	// Test - add, the address is normalized to upper case
+	dbMock.ExpectExec("INSERT OR REPLACE INTO pairing_allowlist").
+		WithArgs("AA:BB:CC:DD:EE:FF", "Living room phone", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/pairing-allowlist", strings.NewReader(`{"address": "aa:bb:cc:dd:ee:ff", "name": "Living room phone"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	assert.NoError(t, h.AddEntry(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	// Test - missing address
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/pairing-allowlist", strings.NewReader(`{"name": "phone"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec = httptest.NewRecorder()
+	assert.NoError(t, h.AddEntry(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Test - list
+	dbMock.ExpectQuery("SELECT address, name, created_at FROM pairing_allowlist").
+		WillReturnRows(sqlmock.NewRows([]string{"address", "name", "created_at"}).
+			AddRow("AA:BB:CC:DD:EE:FF", "Living room phone", time.Now()))
+
+	rec = httptest.NewRecorder()
+	assert.NoError(t, h.GetEntries(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/pairing-allowlist", nil), rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var list map[string][]map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Len(t, list["devices"], 1)
+	assert.Equal(t, "AA:BB:CC:DD:EE:FF", list["devices"][0]["address"])
+
+	// Test - delete an unknown device
+	dbMock.ExpectExec("DELETE FROM pairing_allowlist WHERE address = ?").
+		WithArgs("11:22:33:44:55:66").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	rec = httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/api/v1/bluetooth/pairing-allowlist/11:22:33:44:55:66", nil), rec)
+	c.SetParamNames("mac")
+	c.SetParamValues("11:22:33:44:55:66")
+	assert.NoError(t, h.DeleteEntry(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/qr"
+)
+
+const (
+	// DefaultPairingSessionTTL is the lifetime of a pairing session when the request sets none
+	DefaultPairingSessionTTL = 10 * time.Minute
+	// MaxPairingSessionTTL is the longest lifetime of a pairing session
+	MaxPairingSessionTTL = time.Hour
+	// pairingQRScale is the size in pixels of a module of the QR code image
+	pairingQRScale = 8
+)
+
+// pairingSessionAdapterKey holds, in the context of a request authenticated by a pairing session,
+// the adapter of the session
+const pairingSessionAdapterKey = "pairing_session_adapter"
+
+// pairingSessionRoutes are the routes a pairing session may use: listing nearby devices, pairing
+// them and answering the agent prompts of its adapter
+var pairingSessionRoutes = map[string]bool{
+	"/api/v1/bluetooth/adapters/:adapter/devices/nearby":           true,
+	"/api/v1/bluetooth/adapters/:adapter/devices/:mac/pair":        true,
+	"/api/v1/bluetooth/adapters/:adapter/devices/:mac/pair/cancel": true,
+	"/api/v1/bluetooth/pairing-requests":                           true,
+	"/api/v1/bluetooth/pairing-requests/:id/accept":                true,
+	"/api/v1/bluetooth/pairing-requests/:id/reject":                true,
+}
+
+// PairingQRHandler hands out pairing sessions as QR codes, so a guest can pair a device from a phone
+type PairingQRHandler struct {
+	btManager bluetooth.BluetoothManagerInterface
+	db        database.DatabaseInterface
+	publicURL string
+}
+
+type PairingQRResponse struct {
+	URL       string    `json:"url"`
+	Adapter   string    `json:"adapter"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewPairingQRHandler creates a new pairing QR code handler. The links point to publicURL, or to
+// the host and base path of the request when it is empty.
+func NewPairingQRHandler(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, publicURL string) *PairingQRHandler {
+	return &PairingQRHandler{btManager: btManager, db: db, publicURL: strings.TrimSuffix(publicURL, "/")}
+}
+
+// GetPairingQR creates a pairing session on an adapter, the first powered one by default, and
+// returns the link opening it as a PNG QR code, or as JSON with format=json
+func (ph *PairingQRHandler) GetPairingQR(c echo.Context) error {
+	ttl := DefaultPairingSessionTTL
+	if value := c.QueryParam("ttl"); value != "" {
+		var err error
+		ttl, err = time.ParseDuration(value)
+		if err != nil || ttl <= 0 || ttl > MaxPairingSessionTTL {
+			return jsonError(c, http.StatusBadRequest, "ttl must be a duration between 1s and "+MaxPairingSessionTTL.String())
+		}
+	}
+
+	adapter, err := ph.pairingAdapter(c.QueryParam("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	}
+
+	token, err := database.GenerateToken()
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to create pairing session")
+	}
+
+	username, _ := c.Get("username").(string)
+	now := time.Now()
+	session := database.PairingSession{
+		Username:  username,
+		Adapter:   adapter,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if err := database.CreatePairingSession(ph.db, hashBearerToken(token), session); err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	base := ph.publicURL
+	if base == "" {
+		base = c.Scheme() + "://" + c.Request().Host + BasePath(c)
+	}
+	link := base + "/#pair?" + url.Values{"adapter": {adapter}, "token": {token}}.Encode()
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	if c.QueryParam("format") == "json" {
+		return c.JSON(http.StatusOK, PairingQRResponse{URL: link, Adapter: adapter, ExpiresAt: session.ExpiresAt})
+	}
+
+	code, err := qr.Encode(link)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code.Image(pairingQRScale)); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to encode QR code")
+	}
+	return c.Blob(http.StatusOK, "image/png", buf.Bytes())
+}
+
+// pairingAdapter returns the address of the requested adapter, or of the first powered adapter
+func (ph *PairingQRHandler) pairingAdapter(address string) (string, error) {
+	adapters, err := ph.btManager.GetAdapters()
+	if err != nil {
+		return "", err
+	}
+	for _, adapter := range adapters {
+		if address != "" && strings.EqualFold(adapter.Address, address) {
+			return adapter.Address, nil
+		}
+		if address == "" && adapter.Powered {
+			return adapter.Address, nil
+		}
+	}
+	if address != "" {
+		return "", fmt.Errorf("adapter with MAC address %s not found", address)
+	}
+	return "", errors.New("no powered adapter")
+}
+
+// pairingSessionAuth authenticates a request with a pairing session token. The session only grants
+// the pairing routes, on the adapter it was created for.
+func pairingSessionAuth(c echo.Context, db database.DatabaseInterface, token string, next echo.HandlerFunc) error {
+	session, err := database.GetPairingSession(db, hashBearerToken(token), time.Now())
+	if err != nil {
+		log.Printf("request_id=%s failed to look up pairing session: %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	if session == nil {
+		return jsonError(c, http.StatusUnauthorized, "invalid bearer token")
+	}
+
+	if !pairingSessionRoutes[c.Path()] {
+		return jsonError(c, http.StatusForbidden, "pairing sessions may only pair devices")
+	}
+	if adapter := c.Param("adapter"); adapter != "" && !strings.EqualFold(adapter, session.Adapter) {
+		return jsonError(c, http.StatusForbidden, "pairing session is not valid on this adapter")
+	}
+
+	c.Set("username", session.Username)
+	c.Set("is_admin", false)
+	c.Set(pairingSessionAdapterKey, session.Adapter)
+	return next(c)
+}
+
+// sessionPairingRequests keeps the pairing requests of the devices of the adapter of the pairing
+// session authenticating a request, the other requests being hidden from it
+func sessionPairingRequests(c echo.Context, btManager bluetooth.BluetoothManagerInterface, requests []bluetooth.PairingRequest) ([]bluetooth.PairingRequest, error) {
+	adapter, ok := c.Get(pairingSessionAdapterKey).(string)
+	if !ok {
+		return requests, nil
+	}
+	adapterPath, err := btManager.GetAdapterPathByMAC(adapter)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []bluetooth.PairingRequest{}
+	for _, req := range requests {
+		if strings.HasPrefix(req.Device, adapterPath+"/") {
+			filtered = append(filtered, req)
+		}
+	}
+	return filtered, nil
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"encoding/json"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPairingQRHandler_GetPairingQR(t *testing.T) {
+	adapters := []bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00", Powered: false},
+		{Path: "/org/bluez/hci1", Address: "AA:BB:CC:DD:EE:01", Powered: true},
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		publicURL       string
+		expectedStatus  int
+		expectedAdapter string
+		expectedPrefix  string
+	}{
+		{
+			name:            "success - first powered adapter",
+			query:           "format=json",
+			expectedStatus:  http.StatusOK,
+			expectedAdapter: "AA:BB:CC:DD:EE:01",
+			expectedPrefix:  "http://broker.lan:8080/#pair?adapter=AA%3ABB%3ACC%3ADD%3AEE%3A01&token=",
+		},
+		{
+			name:            "success - requested adapter and public URL",
+			query:           "format=json&adapter=aa:bb:cc:dd:ee:00&ttl=30m",
+			publicURL:       "https://bt.example.org/",
+			expectedStatus:  http.StatusOK,
+			expectedAdapter: "AA:BB:CC:DD:EE:00",
+			expectedPrefix:  "https://bt.example.org/#pair?adapter=AA%3ABB%3ACC%3ADD%3AEE%3A00&token=",
+		},
+		{
+			name:            "success - PNG image",
+			expectedStatus:  http.StatusOK,
+			expectedAdapter: "AA:BB:CC:DD:EE:01",
+		},
+		{
+			name:           "failure - unknown adapter",
+			query:          "adapter=11:22:33:44:55:66",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "failure - ttl too long",
+			query:          "ttl=2h",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			btMock := bluetooth.NewMockBluetoothManager(t)
+			if !strings.Contains(tt.query, "ttl=2h") {
+				btMock.On("GetAdapters").Return(adapters, nil)
+			}
+
+			db, dbMock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			if tt.expectedAdapter != "" {
+				dbMock.ExpectExec("DELETE FROM pairing_sessions WHERE expires_at < ?").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				dbMock.ExpectExec("INSERT INTO pairing_sessions").
+					WithArgs(sqlmock.AnyArg(), "alice", tt.expectedAdapter, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/pairing-qr?"+tt.query, nil)
+			req.Host = "broker.lan:8080"
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.Set("username", "alice")
+
+			assert.NoError(t, NewPairingQRHandler(btMock, db, tt.publicURL).GetPairingQR(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "no-store", rec.Header().Get(echo.HeaderCacheControl))
+			if tt.expectedPrefix == "" {
+				assert.Equal(t, "image/png", rec.Header().Get(echo.HeaderContentType))
+				_, err := png.Decode(rec.Body)
+				assert.NoError(t, err)
+				return
+			}
+
+			var resp PairingQRResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedAdapter, resp.Adapter)
+			assert.True(t, strings.HasPrefix(resp.URL, tt.expectedPrefix), resp.URL)
+			assert.Len(t, strings.TrimPrefix(resp.URL, tt.expectedPrefix), 64)
+		})
+	}
+}
+
+func TestAuthMiddleware_PairingSession(t *testing.T) {
+	tests := []struct {
+		name           string
+		route          string
+		path           string
+		revoked        bool
+		expectedStatus int
+	}{
+		{
+			name:           "success - pair on the session adapter",
+			route:          "/api/v1/bluetooth/adapters/:adapter/devices/:mac/pair",
+			path:           "/api/v1/bluetooth/adapters/aa:bb:cc:dd:ee:00/devices/11:22:33:44:55:66/pair",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "success - pairing requests",
+			route:          "/api/v1/bluetooth/pairing-requests",
+			path:           "/api/v1/bluetooth/pairing-requests",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - other adapter",
+			route:          "/api/v1/bluetooth/adapters/:adapter/devices/:mac/pair",
+			path:           "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:01/devices/11:22:33:44:55:66/pair",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "failure - creator revoked",
+			route:          "/api/v1/bluetooth/adapters/:adapter/devices/:mac/pair",
+			path:           "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/pair",
+			revoked:        true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "failure - route outside pairing",
+			route:          "/api/v1/bluetooth/adapters/:adapter/devices/:mac",
+			path:           "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			now := time.Now()
+			mock.ExpectQuery("SELECT h.username, t.is_admin FROM ha_tokens h").
+				WithArgs(hashBearerToken("guest")).
+				WillReturnRows(sqlmock.NewRows([]string{"username", "is_admin"}))
+			// The session of a revoked user is not joined to its token
+			rows := sqlmock.NewRows([]string{"username", "adapter", "created_at", "expires_at"})
+			if !tt.revoked {
+				rows.AddRow("alice", "AA:BB:CC:DD:EE:00", now, now.Add(10*time.Minute))
+			}
+			mock.ExpectQuery("FROM pairing_sessions s JOIN user_tokens t ON t.username = s.username AND t.revoked_at IS NULL").
+				WithArgs(hashBearerToken("guest"), sqlmock.AnyArg()).
+				WillReturnRows(rows)
+
+			e := echo.New()
+			e.Add(http.MethodGet, tt.route, func(c echo.Context) error {
+				assert.Equal(t, "alice", c.Get("username"))
+				assert.Equal(t, false, c.Get("is_admin"))
+				return c.NoContent(http.StatusOK)
+			}, AuthMiddleware(db, nil))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(echo.HeaderAuthorization, "Bearer guest")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestBluetoothHandler_PairingRequestsSession(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+	btMock.On("GetPairingRequests").Return([]bluetooth.PairingRequest{
+		{ID: "abc", Device: "/org/bluez/hci0/dev_11_22_33_44_55_66", Address: "11:22:33:44:55:66"},
+		{ID: "def", Device: "/org/bluez/hci1/dev_22_33_44_55_66_77", Address: "22:33:44:55:66:77"},
+	})
+	btMock.On("RespondPairingRequest", "abc", true).Return(nil).Once()
+
+	h := NewBluetoothHandlerWithManager(btMock)
+	e := echo.New()
+	session := func(method, path, id string) (echo.Context, *httptest.ResponseRecorder) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(method, path, nil), rec)
+		c.Set(pairingSessionAdapterKey, "AA:BB:CC:DD:EE:00")
+		if id != "" {
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+		}
+		return c, rec
+	}
+
+	// Test - only the requests of the session adapter are listed
+	c, rec := session(http.MethodGet, "/api/v1/bluetooth/pairing-requests", "")
+	assert.NoError(t, h.GetPairingRequests(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list map[string][]bluetooth.PairingRequest
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	if assert.Len(t, list["requests"], 1) {
+		assert.Equal(t, "abc", list["requests"][0].ID)
+	}
+
+	// Test - the requests of other adapters cannot be answered
+	c, rec = session(http.MethodPost, "/api/v1/bluetooth/pairing-requests/def/accept", "def")
+	assert.NoError(t, h.AcceptPairingRequest(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	c, rec = session(http.MethodPost, "/api/v1/bluetooth/pairing-requests/abc/accept", "abc")
+	assert.NoError(t, h.AcceptPairingRequest(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"golang.org/x/net/websocket"
+)
+
+// PairingSocketHandler pushes agent prompts to WebSocket clients and relays their answers,
+// so a user can be guided through an interactive pairing
+type PairingSocketHandler struct {
+	btManager bluetooth.BluetoothManagerInterface
+	hub       *events.Hub
+}
+
+// PairingSocketMessage is exchanged over the pairing WebSocket. The server sends pairing events
+// with their request, clients answer pending requests with a "respond" message.
+type PairingSocketMessage struct {
+	Type    string                    `json:"type"`
+	Request *bluetooth.PairingRequest `json:"request,omitempty"`
+	ID      string                    `json:"id,omitempty"`
+	Accept  bool                      `json:"accept,omitempty"`
+	Error   string                    `json:"error,omitempty"`
+}
+
+// NewPairingSocketHandler creates a new pairing WebSocket handler
+func NewPairingSocketHandler(btManager bluetooth.BluetoothManagerInterface, hub *events.Hub) *PairingSocketHandler {
+	return &PairingSocketHandler{btManager: btManager, hub: hub}
+}
+
+// Serve upgrades the request to a WebSocket streaming pairing prompts
+func (ph *PairingSocketHandler) Serve(c echo.Context) error {
+	server := websocket.Server{
+		Handshake: checkSameOrigin,
+		Handler:   ph.serve,
+	}
+	server.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// checkSameOrigin rejects cross-site browser connections, non-browser clients send no Origin
+func checkSameOrigin(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != req.Host {
+		return fmt.Errorf("cross-origin WebSocket connection from %q refused", origin)
+	}
+	config.Origin = u
+	return nil
+}
+
+func (ph *PairingSocketHandler) serve(ws *websocket.Conn) {
+	defer ws.Close()
+
+	ch, unsubscribe := ph.hub.SubscribeTypes(bluetooth.EventPairingRequested, bluetooth.EventPairingResolved, bluetooth.EventPairingDisplay)
+	defer unsubscribe()
+
+	var writeMu sync.Mutex
+	send := func(msg PairingSocketMessage) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return websocket.JSON.Send(ws, msg)
+	}
+
+	// Requests already waiting are sent first, so a client connecting late can still answer them
+	for _, req := range ph.btManager.GetPairingRequests() {
+		req := req
+		if err := send(PairingSocketMessage{Type: bluetooth.EventPairingRequested, Request: &req}); err != nil {
+			return
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			var msg PairingSocketMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+			if msg.Type != "respond" {
+				send(PairingSocketMessage{Type: "error", Error: "unknown message type"})
+				continue
+			}
+			if err := ph.btManager.RespondPairingRequest(msg.ID, msg.Accept); err != nil {
+				send(PairingSocketMessage{Type: "error", ID: msg.ID, Error: err.Error()})
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			req, ok := event.Data.(bluetooth.PairingRequest)
+			if !ok {
+				continue
+			}
+			if err := send(PairingSocketMessage{Type: event.Type, Request: &req}); err != nil {
+				return
+			}
+		}
+	}
+}
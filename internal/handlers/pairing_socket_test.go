@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+	testifymock "github.com/stretchr/testify/mock"
+	"golang.org/x/net/websocket"
+)
+
+func TestPairingSocketHandler(t *testing.T) {
+	// Setup
+	mock := bluetooth.NewMockBluetoothManager(t)
+	passkey := uint32(123456)
+	mock.On("GetPairingRequests").Return([]bluetooth.PairingRequest{
+		{ID: "pending", Type: bluetooth.PairingRequestConfirmation, Address: "11:22:33:44:55:66", Passkey: &passkey},
+	})
+	responded := make(chan struct{})
+	mock.On("RespondPairingRequest", "pending", true).Return(nil).Run(func(_ testifymock.Arguments) { close(responded) })
+	mock.On("RespondPairingRequest", "unknown", false).Return(bluetooth.ErrPairingRequestNotFound)
+
+	hub := events.NewHub()
+	e := echo.New()
+	e.GET("/ws", NewPairingSocketHandler(mock, hub).Serve)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	ws, err := websocket.Dial(wsURL, "", server.URL)
+	assert.NoError(t, err)
+	defer ws.Close()
+	ws.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Assert - pending requests are sent on connection
+	var msg PairingSocketMessage
+	assert.NoError(t, websocket.JSON.Receive(ws, &msg))
+	assert.Equal(t, bluetooth.EventPairingRequested, msg.Type)
+	assert.Equal(t, "pending", msg.Request.ID)
+
+	// Test - answers are relayed to the agent
+	assert.NoError(t, websocket.JSON.Send(ws, PairingSocketMessage{Type: "respond", ID: "pending", Accept: true}))
+	<-responded
+
+	assert.NoError(t, websocket.JSON.Send(ws, PairingSocketMessage{Type: "respond", ID: "unknown"}))
+	assert.NoError(t, websocket.JSON.Receive(ws, &msg))
+	assert.Equal(t, "error", msg.Type)
+	assert.Equal(t, "pairing request not found", msg.Error)
+
+	// Test - pairing events are pushed, other events are not
+	hub.Publish("battery_low", map[string]string{"address": "11:22:33:44:55:66"})
+	hub.Publish(bluetooth.EventPairingDisplay, bluetooth.PairingRequest{ID: "display", Type: bluetooth.PairingDisplayPasskey, Passkey: &passkey})
+	assert.NoError(t, websocket.JSON.Receive(ws, &msg))
+	assert.Equal(t, bluetooth.EventPairingDisplay, msg.Type)
+	assert.Equal(t, uint32(123456), *msg.Request.Passkey)
+}
+
+func TestPairingSocketHandler_RejectsCrossOrigin(t *testing.T) {
+	mock := bluetooth.NewMockBluetoothManager(t)
+
+	e := echo.New()
+	e.GET("/ws", NewPairingSocketHandler(mock, events.NewHub()).Serve)
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	_, err := websocket.Dial(wsURL, "", "http://evil.example.com")
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/presence"
+)
+
+// PresenceHandler manages presence devices and exposes their home/away state
+type PresenceHandler struct {
+	tracker *presence.Tracker
+	db      database.DatabaseInterface
+}
+
+type CreatePresenceDeviceRequest struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	// AwayTimeout overrides the default away timeout, as a duration such as "10m"
+	AwayTimeout string `json:"away_timeout"`
+}
+
+// NewPresenceHandler creates a new presence handler
+func NewPresenceHandler(tracker *presence.Tracker, db database.DatabaseInterface) *PresenceHandler {
+	return &PresenceHandler{tracker: tracker, db: db}
+}
+
+// GetPresence returns the home/away state of every presence device
+func (ph *PresenceHandler) GetPresence(c echo.Context) error {
+	return c.JSON(http.StatusOK, ph.tracker.Statuses())
+}
+
+// GetDevicePresence returns the home/away state of a presence device
+func (ph *PresenceHandler) GetDevicePresence(c echo.Context) error {
+	status, ok := ph.tracker.Status(c.Param("mac"))
+	if !ok {
+		return jsonError(c, http.StatusNotFound, "presence device not found")
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// CreateDevice registers a presence device and immediately evaluates its state
+func (ph *PresenceHandler) CreateDevice(c echo.Context) error {
+	var req CreatePresenceDeviceRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	if req.Address == "" || req.Name == "" {
+		return jsonError(c, http.StatusBadRequest, "address and name are required")
+	}
+
+	device := database.PresenceDevice{
+		Address:   strings.ToUpper(req.Address),
+		Name:      req.Name,
+		CreatedAt: time.Now(),
+	}
+	if req.AwayTimeout != "" {
+		timeout, err := time.ParseDuration(req.AwayTimeout)
+		if err != nil || timeout < time.Second {
+			return jsonError(c, http.StatusBadRequest, "away_timeout must be a duration of at least 1s")
+		}
+		seconds := int(timeout / time.Second)
+		device.AwayTimeout = &seconds
+	}
+
+	if err := database.AddPresenceDevice(ph.db, device); err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	ph.tracker.Check()
+
+	status, _ := ph.tracker.Status(device.Address)
+	return c.JSON(http.StatusCreated, status)
+}
+
+// DeleteDevice stops tracking the presence of a device
+func (ph *PresenceHandler) DeleteDevice(c echo.Context) error {
+	if err := database.DeletePresenceDevice(ph.db, strings.ToUpper(c.Param("mac"))); err != nil {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	}
+
+	ph.tracker.Check()
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "presence device deleted successfully",
+	})
+}
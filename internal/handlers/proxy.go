@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// forwardedSchemeHeaders are the headers a reverse proxy sets to pass the scheme of the client
+// request on, read by echo.Context.Scheme
+var forwardedSchemeHeaders = []string{
+	echo.HeaderXForwardedProto,
+	echo.HeaderXForwardedProtocol,
+	echo.HeaderXForwardedSsl,
+	echo.HeaderXUrlScheme,
+}
+
+// rootPaths are served outside the base path too, for the health probes of orchestrators which
+// reach the broker directly
+var rootPaths = map[string]bool{
+	"/readyz": true,
+	"/livez":  true,
+}
+
+// ClientIPExtractor returns how the client IP of a request is found: the TCP peer address, or
+// when it is one of the trusted proxies, the last address of X-Forwarded-For not added by a
+// trusted proxy. Other proxies, private networks included, are not trusted.
+func ClientIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	networks, err := parseCIDRs(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	if len(networks) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, network := range networks {
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// ForwardedHeadersMiddleware drops the forwarded scheme headers of the requests not coming from a
+// trusted proxy, so that clients cannot pass themselves off as using HTTPS. It must be registered
+// with Echo.Pre.
+func ForwardedHeadersMiddleware(trustedProxies []string) (echo.MiddlewareFunc, error) {
+	networks, err := parseCIDRs(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			host, _, err := net.SplitHostPort(c.Request().RemoteAddr)
+			if err != nil {
+				host = c.Request().RemoteAddr
+			}
+			peer := net.ParseIP(host)
+			for _, network := range networks {
+				if peer != nil && network.Contains(peer) {
+					return next(c)
+				}
+			}
+
+			for _, header := range forwardedSchemeHeaders {
+				c.Request().Header.Del(header)
+			}
+			return next(c)
+		}
+	}, nil
+}
+
+// BasePathMiddleware serves the application under a path prefix such as /bt, removing it from
+// the request path before routing. Requests outside the prefix get 404, except the health checks.
+// It must be registered with Echo.Pre.
+func BasePathMiddleware(basePath string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if basePath == "" {
+				return next(c)
+			}
+
+			req := c.Request()
+			switch {
+			case req.URL.Path == basePath:
+				// Relative links of the web UI resolve against the directory of the page
+				target := basePath + "/"
+				if req.URL.RawQuery != "" {
+					target += "?" + req.URL.RawQuery
+				}
+				return c.Redirect(http.StatusMovedPermanently, target)
+			case strings.HasPrefix(req.URL.Path, basePath+"/"):
+				req.URL.Path = strings.TrimPrefix(req.URL.Path, basePath)
+				if req.URL.RawPath != "" {
+					req.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, basePath)
+				}
+				c.Set("base_path", basePath)
+				return next(c)
+			case rootPaths[req.URL.Path]:
+				return next(c)
+			default:
+				return jsonError(c, http.StatusNotFound, "not found")
+			}
+		}
+	}
+}
+
+// BasePath returns the path prefix the application is served under, if any
+func BasePath(c echo.Context) string {
+	basePath, _ := c.Get("base_path").(string)
+	return basePath
+}
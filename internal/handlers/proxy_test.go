@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientIPExtractor(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		forwardedFor   string
+		expectedIP     string
+	}{
+		{
+			name:         "no trusted proxy",
+			remoteAddr:   "192.168.1.10:40000",
+			forwardedFor: "203.0.113.7",
+			expectedIP:   "192.168.1.10",
+		},
+		{
+			name:           "trusted proxy",
+			trustedProxies: []string{"192.168.1.10"},
+			remoteAddr:     "192.168.1.10:40000",
+			forwardedFor:   "198.51.100.1, 203.0.113.7",
+			expectedIP:     "203.0.113.7",
+		},
+		{
+			name:           "untrusted peer",
+			trustedProxies: []string{"192.168.1.10"},
+			remoteAddr:     "192.168.1.11:40000",
+			forwardedFor:   "203.0.113.7",
+			expectedIP:     "192.168.1.11",
+		},
+		{
+			name:           "private networks are not trusted by default",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:40000",
+			forwardedFor:   "192.168.1.12, 10.0.0.2",
+			expectedIP:     "192.168.1.12",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor, err := ClientIPExtractor(tt.trustedProxies)
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, tt.forwardedFor)
+			assert.Equal(t, tt.expectedIP, extractor(req))
+		})
+	}
+
+	_, err := ClientIPExtractor([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
+
+func TestForwardedHeadersMiddleware(t *testing.T) {
+	middleware, err := ForwardedHeadersMiddleware([]string{"192.168.1.0/24"})
+	assert.NoError(t, err)
+
+	e := echo.New()
+	e.Pre(middleware)
+	e.GET("/scheme", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Scheme())
+	})
+
+	for remoteAddr, expected := range map[string]string{
+		"192.168.1.10:40000": "https",
+		"10.0.0.1:40000":     "http",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/scheme", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set(echo.HeaderXForwardedProto, "https")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, expected, rec.Body.String(), remoteAddr)
+	}
+}
+
+func TestBasePathMiddleware(t *testing.T) {
+	tests := []struct {
+		name             string
+		basePath         string
+		path             string
+		expectedStatus   int
+		expectedBody     string
+		expectedLocation string
+	}{
+		{
+			name:           "no base path",
+			path:           "/api/v1/ping",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "/api/v1/ping ",
+		},
+		{
+			name:           "route under the base path",
+			basePath:       "/bt",
+			path:           "/bt/api/v1/ping",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "/api/v1/ping /bt",
+		},
+		{
+			name:             "base path without trailing slash",
+			basePath:         "/bt",
+			path:             "/bt?x=1",
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "/bt/?x=1",
+		},
+		{
+			name:           "health check at the root",
+			basePath:       "/bt",
+			path:           "/livez",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "/livez ",
+		},
+		{
+			name:           "route outside the base path",
+			basePath:       "/bt",
+			path:           "/api/v1/ping",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "prefix of another path",
+			basePath:       "/bt",
+			path:           "/btx/api/v1/ping",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.Pre(BasePathMiddleware(tt.basePath))
+			handler := func(c echo.Context) error {
+				return c.String(http.StatusOK, c.Path()+" "+BasePath(c))
+			}
+			e.GET("/api/v1/ping", handler)
+			e.GET("/livez", handler)
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rec.Body.String())
+			}
+			assert.Equal(t, tt.expectedLocation, rec.Header().Get(echo.HeaderLocation))
+		})
+	}
+}
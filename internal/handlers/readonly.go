@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// readOnlyExemptRoutes only manage the caller's own browser session and stay available in read-only mode
+var readOnlyExemptRoutes = map[string]bool{
+	"/api/v1/auth/login":  true,
+	"/api/v1/auth/logout": true,
+}
+
+// readOnlyActionRoutes are GET routes which act on Bluetooth devices, or store pairing credentials,
+// and are disabled in read-only mode
+var readOnlyActionRoutes = map[string]bool{
+	"/api/v1/bluetooth/pairing/ws":                       true,
+	"/api/v1/bluetooth/adapters/:adapter/devices/nearby": true,
+	"/api/v1/bluetooth/pairing-qr":                       true,
+}
+
+// ReadOnlyMiddleware rejects every request changing the broker or Bluetooth state with a 403 Forbidden,
+// to expose a monitoring-only instance of the API
+func ReadOnlyMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if !readOnlyActionRoutes[c.Path()] {
+				return next(c)
+			}
+		default:
+			if readOnlyExemptRoutes[c.Path()] {
+				return next(c)
+			}
+		}
+
+		return jsonError(c, http.StatusForbidden, "the broker is in read-only mode")
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnlyMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{
+			name:           "success - list devices",
+			method:         http.MethodGet,
+			path:           "/api/v1/bluetooth/adapters/:adapter/devices",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "success - login",
+			method:         http.MethodPost,
+			path:           "/api/v1/auth/login",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - pair device",
+			method:         http.MethodPost,
+			path:           "/api/v1/bluetooth/adapters/:adapter/devices/:mac/pair",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "failure - delete token",
+			method:         http.MethodDelete,
+			path:           "/api/v1/tokens/:username",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "failure - nearby scan",
+			method:         http.MethodGet,
+			path:           "/api/v1/bluetooth/adapters/:adapter/devices/nearby",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "failure - pairing QR code",
+			method:         http.MethodGet,
+			path:           "/api/v1/bluetooth/pairing-qr",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			req := httptest.NewRequest(tt.method, "/", nil)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetPath(tt.path)
+
+			err := ReadOnlyMiddleware(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
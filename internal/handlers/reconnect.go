@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/reconnect"
+)
+
+// ReconnectHandler manages the profile reconnect sequences of devices
+type ReconnectHandler struct {
+	btManager   bluetooth.BluetoothManagerInterface
+	db          database.DatabaseInterface
+	reconnector *reconnect.Reconnector
+}
+
+type SetReconnectRequest struct {
+	// Steps are run in order, profiles are UUIDs or names such as hid, avrcp or a2dp
+	Steps []database.ReconnectStep `json:"steps"`
+}
+
+// NewReconnectHandler creates a new reconnect handler
+func NewReconnectHandler(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, reconnector *reconnect.Reconnector) *ReconnectHandler {
+	return &ReconnectHandler{btManager: btManager, db: db, reconnector: reconnector}
+}
+
+// GetReconnect returns the reconnect sequence of a device
+func (rh *ReconnectHandler) GetReconnect(c echo.Context) error {
+	if _, err := rh.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	sequence, err := database.GetDeviceReconnect(rh.db, strings.ToUpper(c.Param("mac")))
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	if sequence == nil {
+		return jsonError(c, http.StatusNotFound, "device has no reconnect sequence")
+	}
+
+	return c.JSON(http.StatusOK, sequence)
+}
+
+// SetReconnect stores the reconnect sequence of a device, enabling its automatic reconnection
+func (rh *ReconnectHandler) SetReconnect(c echo.Context) error {
+	if _, err := rh.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	var req SetReconnectRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	steps, err := reconnect.NormalizeSteps(req.Steps)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	sequence := database.DeviceReconnect{
+		Address:   strings.ToUpper(c.Param("mac")),
+		Steps:     steps,
+		UpdatedAt: time.Now(),
+	}
+	if err := database.SetDeviceReconnect(rh.db, sequence); err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, sequence)
+}
+
+// DeleteReconnect removes the reconnect sequence of a device, which stops its automatic reconnection
+func (rh *ReconnectHandler) DeleteReconnect(c echo.Context) error {
+	if _, err := rh.btManager.GetAdapterPathByMAC(c.Param("adapter")); err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	if err := database.DeleteDeviceReconnect(rh.db, strings.ToUpper(c.Param("mac"))); err != nil {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "device reconnect sequence removed",
+	})
+}
+
+// RunReconnect connects a device now using its reconnect sequence
+func (rh *ReconnectHandler) RunReconnect(c echo.Context) error {
+	adapterPath, err := rh.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	address := strings.ToUpper(c.Param("mac"))
+	sequence, err := database.GetDeviceReconnect(rh.db, address)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	if sequence == nil {
+		return jsonError(c, http.StatusNotFound, "device has no reconnect sequence")
+	}
+
+	if err := rh.reconnector.Reconnect(c.Request().Context(), adapterPath, address, sequence.Steps); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to reconnect: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "device reconnected"})
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/reconnect"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconnectHandler_SetReconnect(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      func(sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:        "success - profile names stored as UUIDs",
+			requestBody: `{"steps": [{"profile": "hid"}, {"profile": "a2dp", "delay_ms": 1500}]}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("INSERT INTO device_reconnect").
+					WithArgs("11:22:33:44:55:66", `[{"profile":"00001124-0000-1000-8000-00805f9b34fb","delay_ms":0},{"profile":"0000110b-0000-1000-8000-00805f9b34fb","delay_ms":1500}]`, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - unknown profile",
+			requestBody:    `{"steps": [{"profile": "midi"}]}`,
+			setupMock:      func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "failure - delay out of range",
+			requestBody:    `{"steps": [{"profile": "hid", "delay_ms": 60000}]}`,
+			setupMock:      func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			btMock := bluetooth.NewMockBluetoothManager(t)
+			btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+
+			db, dbMock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			tt.setupMock(dbMock)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/reconnect", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+			c.SetParamNames("adapter", "mac")
+			c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+
+			assert.NoError(t, NewReconnectHandler(btMock, db, nil).SetReconnect(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestReconnectHandler_RunReconnect(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+	btMock.On("ConnectProfile", "/org/bluez/hci0", "11:22:33:44:55:66", "00001124-0000-1000-8000-00805f9b34fb").Return(nil).Once()
+
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	dbMock.ExpectQuery("FROM device_reconnect WHERE address = ?").
+		WithArgs("11:22:33:44:55:66").
+		WillReturnRows(sqlmock.NewRows([]string{"address", "steps", "updated_at"}).
+			AddRow("11:22:33:44:55:66", `[{"profile":"00001124-0000-1000-8000-00805f9b34fb","delay_ms":0}]`, time.Now()))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/devices/11:22:33:44:55:66/reconnect/run", nil)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.SetParamNames("adapter", "mac")
+	c.SetParamValues("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66")
+
+	reconnector := reconnect.NewReconnector(btMock, db, time.Minute, reconnect.FailoverOff, 0)
+	assert.NoError(t, NewReconnectHandler(btMock, db, reconnector).RunReconnect(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	errInvalidSince = errors.New("since must be a duration such as 24h or an RFC3339 time")
+	errInvalidLimit = errors.New("limit must be a positive integer")
+)
+
+// RequestID returns the request ID assigned to the current request, if any
+func RequestID(c echo.Context) string {
+	if id := c.Response().Header().Get(echo.HeaderXRequestID); id != "" {
+		return id
+	}
+	return c.Request().Header.Get(echo.HeaderXRequestID)
+}
+
+// jsonError logs the error with the request ID and writes a JSON error response
+func jsonError(c echo.Context, status int, message string) error {
+	return jsonErrorWith(c, status, message, nil)
+}
+
+// jsonErrorWith is jsonError adding details to the response, such as the name of a BlueZ error
+func jsonErrorWith(c echo.Context, status int, message string, details map[string]string) error {
+	body := map[string]string{"error": message}
+	for key, value := range details {
+		body[key] = value
+	}
+
+	id := RequestID(c)
+	if id != "" {
+		body["request_id"] = id
+	}
+
+	log.Printf("request_id=%s method=%s uri=%s status=%d error=%q", id, c.Request().Method, c.Request().RequestURI, status, message)
+	return c.JSON(status, body)
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/retention"
+)
+
+// PruneHandler runs the retention job on demand
+type PruneHandler struct {
+	pruner *retention.Pruner
+}
+
+// NewPruneHandler creates a new prune handler
+func NewPruneHandler(pruner *retention.Pruner) *PruneHandler {
+	return &PruneHandler{pruner: pruner}
+}
+
+// Prune deletes the rows past their retention and returns the number deleted from each table
+func (ph *PruneHandler) Prune(c echo.Context) error {
+	result, err := ph.pruner.Prune()
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "failed to prune database")
+	}
+	return c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/retention"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneHandler_Prune(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dbMock.ExpectExec("DELETE FROM sessions").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM pairing_sessions").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM rssi_history").WillReturnError(assert.AnError)
+
+	handler := NewPruneHandler(retention.NewPruner(db, retention.Policy{RSSIRetention: time.Hour}, time.Hour))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/prune", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, handler.Prune(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	dbMock.ExpectExec("DELETE FROM sessions").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM pairing_sessions").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM idempotency_keys").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM rssi_history").WillReturnResult(sqlmock.NewResult(0, 3))
+
+	rec = httptest.NewRecorder()
+	assert.NoError(t, handler.Prune(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"deleted":{"sessions":1,"pairing_sessions":0,"idempotency_keys":0,"rssi_history":3}}`, rec.Body.String())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/schedule"
+)
+
+// SchedulesHandler manages the recurring discoverable windows and the quiet hours of the adapters
+type SchedulesHandler struct {
+	db         database.DatabaseInterface
+	scheduler  *schedule.DiscoverableScheduler
+	quietHours *schedule.QuietHours
+	hub        *events.Hub
+}
+
+// DiscoverableScheduleRequest is the body creating or replacing a schedule. The name of a schedule
+// cannot change.
+type DiscoverableScheduleRequest struct {
+	Name string `json:"name"`
+	// Adapter is the MAC address of the adapter, the first powered one when empty
+	Adapter string `json:"adapter"`
+	// Days are English day names, such as saturday or sat
+	Days []string `json:"days"`
+	// Start and End are HH:MM times; a window ending before it starts ends on the next day
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Pairable bool   `json:"pairable"`
+	// Enabled defaults to true
+	Enabled *bool `json:"enabled"`
+}
+
+// QuietHoursOverrideRequest is the optional body of a quiet hours override
+type QuietHoursOverrideRequest struct {
+	// Minutes is the length of the override, until the end of the current quiet hours when omitted
+	Minutes int `json:"minutes"`
+}
+
+// MaxQuietHoursOverrideMinutes bounds the length of a quiet hours override
+const MaxQuietHoursOverrideMinutes = 1440
+
+// NewSchedulesHandler creates a new schedules handler, applying the changes to the scheduler at once
+func NewSchedulesHandler(db database.DatabaseInterface, scheduler *schedule.DiscoverableScheduler, quietHours *schedule.QuietHours, hub *events.Hub) *SchedulesHandler {
+	return &SchedulesHandler{db: db, scheduler: scheduler, quietHours: quietHours, hub: hub}
+}
+
+// GetDiscoverableSchedules returns the discoverable schedules and the open windows
+func (sh *SchedulesHandler) GetDiscoverableSchedules(c echo.Context) error {
+	schedules, err := database.GetDiscoverableSchedules(sh.db)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"schedules":    schedules,
+		"open_windows": sh.scheduler.Windows(),
+	})
+}
+
+// GetDiscoverableSchedule returns a discoverable schedule
+func (sh *SchedulesHandler) GetDiscoverableSchedule(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid schedule id")
+	}
+
+	schedule, err := database.GetDiscoverableSchedule(sh.db, id)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	if schedule == nil {
+		return jsonError(c, http.StatusNotFound, "schedule not found")
+	}
+
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// CreateDiscoverableSchedule adds a discoverable schedule
+func (sh *SchedulesHandler) CreateDiscoverableSchedule(c echo.Context) error {
+	var req DiscoverableScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	if req.Name == "" {
+		return jsonError(c, http.StatusBadRequest, "name is required")
+	}
+	sched, msg := scheduleFromRequest(req)
+	if msg != "" {
+		return jsonError(c, http.StatusBadRequest, msg)
+	}
+
+	sched.CreatedAt = sched.UpdatedAt
+	id, err := database.AddDiscoverableSchedule(sh.db, sched)
+	if errors.Is(err, database.ErrDiscoverableScheduleExists) {
+		return jsonError(c, http.StatusConflict, err.Error())
+	} else if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	sched.ID = id
+	sh.scheduler.Check(sh.hub)
+
+	return c.JSON(http.StatusCreated, sched)
+}
+
+// UpdateDiscoverableSchedule replaces a discoverable schedule, closing its window when it no longer
+// covers the current time
+func (sh *SchedulesHandler) UpdateDiscoverableSchedule(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid schedule id")
+	}
+
+	var req DiscoverableScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	sched, msg := scheduleFromRequest(req)
+	if msg != "" {
+		return jsonError(c, http.StatusBadRequest, msg)
+	}
+
+	existing, err := database.GetDiscoverableSchedule(sh.db, id)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	if existing == nil {
+		return jsonError(c, http.StatusNotFound, "schedule not found")
+	}
+	if req.Name != "" && req.Name != existing.Name {
+		return jsonError(c, http.StatusBadRequest, "the name of a schedule cannot change")
+	}
+
+	sched.ID = id
+	sched.Name = existing.Name
+	sched.CreatedAt = existing.CreatedAt
+	updated, err := database.UpdateDiscoverableSchedule(sh.db, sched)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	if !updated {
+		return jsonError(c, http.StatusNotFound, "schedule not found")
+	}
+	sh.scheduler.Check(sh.hub)
+
+	return c.JSON(http.StatusOK, sched)
+}
+
+// DeleteDiscoverableSchedule deletes a discoverable schedule, closing its open window
+func (sh *SchedulesHandler) DeleteDiscoverableSchedule(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid schedule id")
+	}
+
+	deleted, err := database.DeleteDiscoverableSchedule(sh.db, id)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	if !deleted {
+		return jsonError(c, http.StatusNotFound, "schedule not found")
+	}
+	sh.scheduler.Check(sh.hub)
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "discoverable schedule deleted",
+	})
+}
+
+// GetQuietHours returns the state of the quiet hours
+func (sh *SchedulesHandler) GetQuietHours(c echo.Context) error {
+	return c.JSON(http.StatusOK, sh.quietHours.State())
+}
+
+// OverrideQuietHours powers the adapters back on and suspends the quiet hours, for a number of
+// minutes or until their end
+func (sh *SchedulesHandler) OverrideQuietHours(c echo.Context) error {
+	var req QuietHoursOverrideRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	if req.Minutes < 0 || req.Minutes > MaxQuietHoursOverrideMinutes {
+		return jsonError(c, http.StatusBadRequest, "minutes must be between 1 and "+strconv.Itoa(MaxQuietHoursOverrideMinutes))
+	}
+
+	var until time.Time
+	if req.Minutes > 0 {
+		until = time.Now().Add(time.Duration(req.Minutes) * time.Minute)
+	}
+	if _, err := sh.quietHours.Override(sh.hub, until); errors.Is(err, schedule.ErrQuietHoursInactive) {
+		return jsonError(c, http.StatusConflict, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to override quiet hours: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, sh.quietHours.State())
+}
+
+// ClearQuietHoursOverride resumes the quiet hours
+func (sh *SchedulesHandler) ClearQuietHoursOverride(c echo.Context) error {
+	sh.quietHours.ClearOverride(sh.hub)
+	return c.JSON(http.StatusOK, sh.quietHours.State())
+}
+
+// scheduleFromRequest validates a schedule request, returning the error message of an invalid one
+func scheduleFromRequest(req DiscoverableScheduleRequest) (database.DiscoverableSchedule, string) {
+	if _, err := schedule.ParseWindow(req.Days, req.Start, req.End); err != nil {
+		return database.DiscoverableSchedule{}, "invalid window: " + err.Error()
+	}
+
+	days := make([]string, 0, len(req.Days))
+	for _, name := range req.Days {
+		day, _ := schedule.ParseDay(name)
+		days = append(days, strings.ToLower(day.String()))
+	}
+	sched := database.DiscoverableSchedule{
+		Name:      req.Name,
+		Adapter:   strings.ToUpper(req.Adapter),
+		Days:      days,
+		Start:     req.Start,
+		End:       req.End,
+		Pairable:  req.Pairable,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+		UpdatedAt: time.Now(),
+	}
+	return sched, ""
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/schedule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulesHandler_CreateDiscoverableSchedule(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true}}, nil)
+
+	e := echo.New()
+	sh := NewSchedulesHandler(db, schedule.NewDiscoverableScheduler(btMock, db, bluetooth.NewVisibility(btMock), time.Minute), schedule.NewQuietHours(btMock, nil, nil, time.Minute), events.NewHub())
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/schedules/discoverable", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, sh.CreateDiscoverableSchedule(e.NewContext(req, rec)))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusBadRequest, create(`{"days": ["sat"], "start": "10:00", "end": "12:00"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, create(`{"name": "guests", "days": ["someday"], "start": "10:00", "end": "12:00"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, create(`{"name": "guests", "days": ["sat"], "start": "10:00", "end": "25:00"}`).Code)
+
+	dbMock.ExpectQuery("INSERT INTO discoverable_schedules").
+		WithArgs("guests", "", "saturday,sunday", "10:00", "12:00", true, true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	dbMock.ExpectQuery("FROM discoverable_schedules WHERE enabled = 1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "adapter", "days", "start_time", "end_time", "pairable", "enabled", "created_at", "updated_at"}))
+	rec := create(`{"name": "guests", "days": ["Sat", "sunday"], "start": "10:00", "end": "12:00", "pairable": true}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"days":["saturday","sunday"]`)
+
+	dbMock.ExpectQuery("INSERT INTO discoverable_schedules").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.Equal(t, http.StatusConflict, create(`{"name": "guests", "days": ["sat"], "start": "10:00", "end": "12:00"}`).Code)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestSchedulesHandler_OverrideQuietHours(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	e := echo.New()
+	sh := NewSchedulesHandler(nil, nil, schedule.NewQuietHours(btMock, nil, nil, time.Minute), events.NewHub())
+	override := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/schedules/quiet-hours/override", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, sh.OverrideQuietHours(e.NewContext(req, rec)))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusBadRequest, override(`{"minutes": 2000}`).Code)
+	// Without QUIET_HOURS, there is nothing to override
+	assert.Equal(t, http.StatusConflict, override(`{"minutes": 30}`).Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/schedules/quiet-hours", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, sh.GetQuietHours(e.NewContext(req, rec)))
+	assert.JSONEq(t, `{"enabled": false, "adapters": [], "active": false, "powered_off": []}`, rec.Body.String())
+}
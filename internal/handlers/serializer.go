@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/msgpack"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	MIMEApplicationMsgpack = "application/msgpack"
+	MIMEApplicationYAML    = "application/yaml"
+)
+
+// responseFormats maps the media types accepted for responses to the format they select
+var responseFormats = map[string]string{
+	echo.MIMEApplicationJSON:  echo.MIMEApplicationJSON,
+	MIMEApplicationMsgpack:    MIMEApplicationMsgpack,
+	"application/x-msgpack":   MIMEApplicationMsgpack,
+	"application/vnd.msgpack": MIMEApplicationMsgpack,
+	MIMEApplicationYAML:       MIMEApplicationYAML,
+	"application/x-yaml":      MIMEApplicationYAML,
+	"text/yaml":               MIMEApplicationYAML,
+}
+
+// NegotiatingSerializer writes the JSON responses of GET requests as MessagePack or YAML when the
+// Accept header prefers them, and as JSON otherwise. Request bodies are always JSON.
+type NegotiatingSerializer struct {
+	echo.DefaultJSONSerializer
+}
+
+// Serialize writes a response in the format negotiated from the Accept header
+func (s NegotiatingSerializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	req := c.Request()
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return s.DefaultJSONSerializer.Serialize(c, i, indent)
+	}
+
+	c.Response().Header().Add(echo.HeaderVary, "Accept")
+	format := negotiateFormat(req.Header.Get(echo.HeaderAccept))
+	if format == echo.MIMEApplicationJSON {
+		return s.DefaultJSONSerializer.Serialize(c, i, indent)
+	}
+
+	// Going through JSON keeps the field names, omitempty and time formats of the JSON responses
+	value, err := toGeneric(i)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if format == MIMEApplicationMsgpack {
+		data, err = msgpack.Marshal(value)
+	} else {
+		data, err = yaml.Marshal(value)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, format)
+	_, err = c.Response().Write(data)
+	return err
+}
+
+// negotiateFormat returns the supported response format with the highest quality in an Accept
+// header, the first listed on ties, and JSON when none is supported
+func negotiateFormat(accept string) string {
+	best, bestQuality := echo.MIMEApplicationJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		format, ok := responseFormats[mediaType]
+		if !ok {
+			continue
+		}
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	return best
+}
+
+// toGeneric converts a value to the maps, slices and scalars of its JSON form, integers being
+// kept apart from floats
+func toGeneric(i interface{}) (interface{}, error) {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return convertNumbers(value), nil
+}
+
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i := range v {
+			v[i] = convertNumbers(v[i])
+		}
+	case map[string]interface{}:
+		for key := range v {
+			v[key] = convertNumbers(v[key])
+		}
+	}
+	return value
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", echo.MIMEApplicationJSON},
+		{"*/*", echo.MIMEApplicationJSON},
+		{"application/msgpack", MIMEApplicationMsgpack},
+		{"application/x-msgpack", MIMEApplicationMsgpack},
+		{"text/yaml", MIMEApplicationYAML},
+		{"application/yaml, application/json", MIMEApplicationYAML},
+		{"application/json;q=0.9, application/yaml", MIMEApplicationYAML},
+		{"application/msgpack;q=0.5, application/json", echo.MIMEApplicationJSON},
+		{"text/html, application/xml", echo.MIMEApplicationJSON},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, negotiateFormat(tt.accept), tt.accept)
+	}
+}
+
+func TestNegotiatingSerializer(t *testing.T) {
+	type adapter struct {
+		Address string     `json:"address"`
+		Powered bool       `json:"powered"`
+		Devices int        `json:"devices"`
+		SeenAt  *time.Time `json:"seen_at,omitempty"`
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		accept       string
+		expectedType string
+		expectedBody string
+	}{
+		{
+			name:         "json by default",
+			method:       http.MethodGet,
+			expectedType: echo.MIMEApplicationJSON,
+			expectedBody: "{\"address\":\"00:1A:7D:DA:71:01\",\"powered\":true,\"devices\":300}\n",
+		},
+		{
+			name:         "yaml",
+			method:       http.MethodGet,
+			accept:       "application/yaml",
+			expectedType: MIMEApplicationYAML,
+			expectedBody: "address: 00:1A:7D:DA:71:01\ndevices: 300\npowered: true\n",
+		},
+		{
+			name:         "msgpack",
+			method:       http.MethodGet,
+			accept:       "application/msgpack",
+			expectedType: MIMEApplicationMsgpack,
+			expectedBody: "\x83\xa7address\xb100:1A:7D:DA:71:01\xa7devices\xcd\x01\x2c\xa7powered\xc3",
+		},
+		{
+			name:         "json for other methods",
+			method:       http.MethodPost,
+			accept:       "application/msgpack",
+			expectedType: echo.MIMEApplicationJSON,
+			expectedBody: "{\"address\":\"00:1A:7D:DA:71:01\",\"powered\":true,\"devices\":300}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.JSONSerializer = NegotiatingSerializer{}
+			e.Add(tt.method, "/", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, adapter{Address: "00:1A:7D:DA:71:01", Powered: true, Devices: 300})
+			})
+
+			req := httptest.NewRequest(tt.method, "/", nil)
+			req.Header.Set(echo.HeaderAccept, tt.accept)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.expectedType, rec.Header().Get(echo.HeaderContentType))
+			assert.Equal(t, tt.expectedBody, rec.Body.String())
+		})
+	}
+}
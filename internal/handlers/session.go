@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+const (
+	// SessionCookieName is the name of the cookie holding the web UI session
+	SessionCookieName = "bt_broker_session"
+	// CSRFHeaderName is the header carrying the CSRF token on state-changing session requests
+	CSRFHeaderName = "X-CSRF-Token"
+	// SessionTTL is the lifetime of a web UI session
+	SessionTTL = 24 * time.Hour
+)
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+type SessionResponse struct {
+	Username  string    `json:"username"`
+	IsAdmin   bool      `json:"is_admin"`
+	CSRFToken string    `json:"csrf_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Login checks a username/token pair and opens a cookie session for the web UI
+func (h *Handler) Login(c echo.Context) error {
+	var req LoginRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	if req.Username == "" || req.Token == "" {
+		return jsonError(c, http.StatusBadRequest, "username and token are required")
+	}
+
+	ip := c.RealIP()
+	if retryAfter, locked := h.lockout.Locked(req.Username, ip); locked {
+		return lockedOut(c, retryAfter)
+	}
+
+	isAdmin, err := verifyCredentials(h.db, h.cipher, req.Username, req.Token)
+	if err == errInvalidCredentials {
+		if retryAfter, locked := h.lockout.Fail(req.Username, ip); locked {
+			return lockedOut(c, retryAfter)
+		}
+		return jsonError(c, http.StatusUnauthorized, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	h.lockout.Succeed(req.Username, ip)
+
+	sessionID, err := database.GenerateToken()
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to create session")
+	}
+	csrfToken, err := database.GenerateToken()
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to create session")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(SessionTTL)
+
+	// Drop expired sessions so the table does not grow forever
+	if _, err := h.db.Exec("DELETE FROM sessions WHERE expires_at < ?", now); err != nil {
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	_, err = h.db.Exec("INSERT INTO sessions (id, username, csrf_token, created_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		hashSessionID(sessionID), req.Username, csrfToken, now, expiresAt)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to create session")
+	}
+
+	recordTokenUsage(c, h.db, req.Username)
+
+	c.SetCookie(&http.Cookie{
+		Name:     SessionCookieName,
+		Value:    sessionID,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return c.JSON(http.StatusOK, SessionResponse{
+		Username:  req.Username,
+		IsAdmin:   isAdmin,
+		CSRFToken: csrfToken,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// Logout closes the current web UI session
+func (h *Handler) Logout(c echo.Context) error {
+	if cookie, err := c.Cookie(SessionCookieName); err == nil && cookie.Value != "" {
+		if _, err := h.db.Exec("DELETE FROM sessions WHERE id = ?", hashSessionID(cookie.Value)); err != nil {
+			return jsonError(c, http.StatusInternalServerError, "database error")
+		}
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "logged out successfully",
+	})
+}
+
+// Session returns the current web UI session, including its CSRF token
+func (h *Handler) Session(c echo.Context) error {
+	cookie, err := c.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return jsonError(c, http.StatusUnauthorized, "no active session")
+	}
+
+	session, err := lookupSession(h.db, cookie.Value)
+	if err == sql.ErrNoRows {
+		return jsonError(c, http.StatusUnauthorized, "invalid or expired session")
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	return c.JSON(http.StatusOK, session)
+}
+
+// sessionAuth authenticates a request with a session cookie and enforces the CSRF token
+// on state-changing methods
+func sessionAuth(c echo.Context, db database.DatabaseInterface, sessionID string, next echo.HandlerFunc) error {
+	session, err := lookupSession(db, sessionID)
+	if err == sql.ErrNoRows {
+		return jsonError(c, http.StatusUnauthorized, "invalid or expired session")
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		csrfToken := c.Request().Header.Get(CSRFHeaderName)
+		if subtle.ConstantTimeCompare([]byte(csrfToken), []byte(session.CSRFToken)) != 1 {
+			return jsonError(c, http.StatusForbidden, "invalid CSRF token")
+		}
+	}
+
+	recordTokenUsage(c, db, session.Username)
+
+	c.Set("username", session.Username)
+	c.Set("is_admin", session.IsAdmin)
+	return next(c)
+}
+
+// lookupSession returns an unexpired session whose token still exists and is not revoked
+func lookupSession(db database.DatabaseInterface, sessionID string) (*SessionResponse, error) {
+	var session SessionResponse
+	err := db.QueryRow(`SELECT s.username, t.is_admin, s.csrf_token, s.expires_at FROM sessions s
+		JOIN user_tokens t ON t.username = s.username AND t.revoked_at IS NULL
+		WHERE s.id = ? AND s.expires_at > ?`, hashSessionID(sessionID), time.Now()).
+		Scan(&session.Username, &session.IsAdmin, &session.CSRFToken, &session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// hashSessionID hashes session IDs so a leaked database cannot be used to hijack sessions
+func hashSessionID(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:])
+}
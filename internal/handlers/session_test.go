@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_Login(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      func(sqlmock.Sqlmock)
+		expectedStatus int
+		expectCookie   bool
+	}{
+		{
+			name:        "success - session created",
+			requestBody: `{"username":"testuser","token":"testtoken"}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT token, is_admin FROM user_tokens WHERE username = ?").
+					WithArgs("testuser").
+					WillReturnRows(sqlmock.NewRows([]string{"token", "is_admin"}).AddRow("testtoken", true))
+				mock.ExpectExec("DELETE FROM sessions WHERE expires_at < ?").
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("INSERT INTO sessions").
+					WithArgs(sqlmock.AnyArg(), "testuser", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("UPDATE user_tokens SET last_used_at").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			expectedStatus: http.StatusOK,
+			expectCookie:   true,
+		},
+		{
+			name:        "failure - invalid credentials",
+			requestBody: `{"username":"testuser","token":"wrong"}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT token, is_admin FROM user_tokens WHERE username = ?").
+					WithArgs("testuser").
+					WillReturnRows(sqlmock.NewRows([]string{"token", "is_admin"}).AddRow("testtoken", true))
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "failure - missing fields",
+			requestBody:    `{"username":"testuser"}`,
+			setupMock:      func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			tt.setupMock(mock)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(tt.requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			h := NewHandlerWithDB(db)
+
+			// Test
+			err = h.Login(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+
+			cookies := rec.Result().Cookies()
+			if tt.expectCookie {
+				assert.Len(t, cookies, 1)
+				assert.Equal(t, SessionCookieName, cookies[0].Name)
+				assert.True(t, cookies[0].HttpOnly)
+
+				var response SessionResponse
+				err = json.Unmarshal(rec.Body.Bytes(), &response)
+				assert.NoError(t, err)
+				assert.Equal(t, "testuser", response.Username)
+				assert.True(t, response.IsAdmin)
+				assert.NotEmpty(t, response.CSRFToken)
+			} else {
+				assert.Empty(t, cookies)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestAuthMiddleware_Session(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		csrfToken      string
+		sessionFound   bool
+		expectedStatus int
+	}{
+		{
+			name:           "success - read request without CSRF token",
+			method:         http.MethodGet,
+			sessionFound:   true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "success - write request with CSRF token",
+			method:         http.MethodPost,
+			csrfToken:      "csrf-1234",
+			sessionFound:   true,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "failure - write request without CSRF token",
+			method:         http.MethodPost,
+			sessionFound:   true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "failure - write request with wrong CSRF token",
+			method:         http.MethodDelete,
+			csrfToken:      "forged",
+			sessionFound:   true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "failure - expired or unknown session",
+			method:         http.MethodGet,
+			sessionFound:   false,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setup
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			rows := sqlmock.NewRows([]string{"username", "is_admin", "csrf_token", "expires_at"})
+			if tt.sessionFound {
+				rows.AddRow("testuser", false, "csrf-1234", time.Now().Add(time.Hour))
+			}
+			mock.ExpectQuery("SELECT s.username, t.is_admin, s.csrf_token, s.expires_at FROM sessions s").
+				WithArgs(hashSessionID("session-1234"), sqlmock.AnyArg()).
+				WillReturnRows(rows)
+			if tt.expectedStatus == http.StatusOK {
+				mock.ExpectExec("UPDATE user_tokens SET last_used_at").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			e := echo.New()
+			req := httptest.NewRequest(tt.method, "/api/v1/bluetooth/adapters", nil)
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "session-1234"})
+			if tt.csrfToken != "" {
+				req.Header.Set(CSRFHeaderName, tt.csrfToken)
+			}
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+
+			// Test
+			err = AuthMiddleware(db, nil)(func(c echo.Context) error {
+				assert.Equal(t, "testuser", c.Get("username"))
+				return c.NoContent(http.StatusOK)
+			})(c)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
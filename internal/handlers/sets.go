@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+)
+
+// LogicalDevice is a coordinated set presented as one device, such as a pair of LE Audio earbuds
+type LogicalDevice struct {
+	bluetooth.DeviceSet
+	Name string `json:"name"`
+	// Connected reports whether every member of the set is connected
+	Connected bool   `json:"connected"`
+	Volume    *uint8 `json:"volume,omitempty"`
+	// Battery is the lowest battery level of the members
+	Battery *uint8             `json:"battery,omitempty"`
+	Devices []bluetooth.Device `json:"devices"`
+}
+
+// GetDeviceSets returns the coordinated sets of an adapter as logical devices
+func (bh *BluetoothHandler) GetDeviceSets(c echo.Context) error {
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	sets, err := bh.btManager.GetDeviceSets(adapterPath)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get device sets: "+err.Error())
+	}
+	devices, err := bh.btManager.GetDevices(adapterPath)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get devices: "+err.Error())
+	}
+
+	logicalDevices := make([]LogicalDevice, 0, len(sets))
+	for _, set := range sets {
+		logicalDevices = append(logicalDevices, logicalDevice(set, devices))
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"sets": logicalDevices,
+	})
+}
+
+// ConnectDeviceSet connects every member of a coordinated set
+func (bh *BluetoothHandler) ConnectDeviceSet(c echo.Context) error {
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	err = bh.btManager.ConnectDeviceSet(adapterPath, c.Param("set"))
+	if errors.Is(err, bluetooth.ErrDeviceSetNotFound) {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "device set connected"})
+}
+
+// SetDeviceSetVolume sets the same absolute volume on every connected member of a coordinated set
+func (bh *BluetoothHandler) SetDeviceSetVolume(c echo.Context) error {
+	var req struct {
+		Volume *int `json:"volume"`
+	}
+	if err := c.Bind(&req); err != nil || req.Volume == nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body: volume is required")
+	}
+	if *req.Volume < 0 || *req.Volume > 100 {
+		return jsonError(c, http.StatusBadRequest, "volume must be between 0 and 100")
+	}
+
+	adapterPath, err := bh.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	sets, err := bh.btManager.GetDeviceSets(adapterPath)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "failed to get device sets: "+err.Error())
+	}
+	var set *bluetooth.DeviceSet
+	for i := range sets {
+		if sets[i].ID == c.Param("set") {
+			set = &sets[i]
+		}
+	}
+	if set == nil {
+		return jsonError(c, http.StatusNotFound, bluetooth.ErrDeviceSetNotFound.Error())
+	}
+
+	updated := 0
+	for _, address := range set.Members {
+		err := bh.btManager.SetVolume(adapterPath, address, uint8(*req.Volume))
+		if errors.Is(err, bluetooth.ErrNoVolumeControl) {
+			continue
+		} else if err != nil {
+			return jsonError(c, http.StatusInternalServerError, "failed to set volume: "+err.Error())
+		}
+		updated++
+	}
+	if updated == 0 {
+		return jsonError(c, http.StatusConflict, "no member of the set has an audio transport with absolute volume")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "volume updated"})
+}
+
+// logicalDevice merges the state of the members of a set
+func logicalDevice(set bluetooth.DeviceSet, devices []bluetooth.Device) LogicalDevice {
+	logical := LogicalDevice{DeviceSet: set, Devices: []bluetooth.Device{}}
+	for _, address := range set.Members {
+		for _, device := range devices {
+			if device.Address != address {
+				continue
+			}
+			logical.Devices = append(logical.Devices, device)
+			if logical.Name == "" {
+				logical.Name = device.Name
+			}
+			if logical.Volume == nil && device.Volume != nil {
+				logical.Volume = device.Volume
+			}
+			if device.Battery != nil && (logical.Battery == nil || *device.Battery < *logical.Battery) {
+				logical.Battery = device.Battery
+			}
+		}
+	}
+
+	logical.Connected = len(logical.Devices) > 0
+	for _, device := range logical.Devices {
+		logical.Connected = logical.Connected && device.Connected
+	}
+	return logical
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/stretchr/testify/assert"
+)
+
+var budsSet = bluetooth.DeviceSet{ID: "set_0", Size: 2, Members: []string{"E4:5F:01:AA:00:01", "E4:5F:01:AA:00:02"}}
+
+func uint8Ptr(v uint8) *uint8 { return &v }
+
+func TestBluetoothHandler_GetDeviceSets(t *testing.T) {
+	mock := bluetooth.NewMockBluetoothManager(t)
+	mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+	mock.On("GetDeviceSets", "/org/bluez/hci0").Return([]bluetooth.DeviceSet{budsSet}, nil)
+	mock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Name: "Buds", Address: "E4:5F:01:AA:00:01", Connected: true, Battery: uint8Ptr(70), Volume: uint8Ptr(30)},
+		{Name: "Buds", Address: "E4:5F:01:AA:00:02", Connected: false, Battery: uint8Ptr(40)},
+		{Name: "Headset", Address: "38:18:4C:12:34:56", Connected: true},
+	}, nil)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/sets", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("adapter")
+	c.SetParamValues("AA:BB:CC:DD:EE:00")
+
+	assert.NoError(t, NewBluetoothHandlerWithManager(mock).GetDeviceSets(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response struct {
+		Sets []LogicalDevice `json:"sets"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response.Sets, 1)
+	set := response.Sets[0]
+	assert.Equal(t, "Buds", set.Name)
+	assert.False(t, set.Connected)
+	assert.Equal(t, uint8(40), *set.Battery)
+	assert.Equal(t, uint8(30), *set.Volume)
+	assert.Len(t, set.Devices, 2)
+}
+
+func TestBluetoothHandler_SetDeviceSetVolume(t *testing.T) {
+	tests := []struct {
+		name           string
+		set            string
+		setupMock      func(*bluetooth.MockBluetoothManager)
+		expectedStatus int
+	}{
+		{
+			name: "success - connected members updated",
+			set:  "set_0",
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("GetDeviceSets", "/org/bluez/hci0").Return([]bluetooth.DeviceSet{budsSet}, nil)
+				mock.On("SetVolume", "/org/bluez/hci0", "E4:5F:01:AA:00:01", uint8(60)).Return(nil)
+				mock.On("SetVolume", "/org/bluez/hci0", "E4:5F:01:AA:00:02", uint8(60)).Return(bluetooth.ErrNoVolumeControl)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "failure - no member with volume",
+			set:  "set_0",
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("GetDeviceSets", "/org/bluez/hci0").Return([]bluetooth.DeviceSet{budsSet}, nil)
+				mock.On("SetVolume", "/org/bluez/hci0", "E4:5F:01:AA:00:01", uint8(60)).Return(bluetooth.ErrNoVolumeControl)
+				mock.On("SetVolume", "/org/bluez/hci0", "E4:5F:01:AA:00:02", uint8(60)).Return(bluetooth.ErrNoVolumeControl)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name: "failure - unknown set",
+			set:  "set_9",
+			setupMock: func(mock *bluetooth.MockBluetoothManager) {
+				mock.On("GetAdapterPathByMAC", "AA:BB:CC:DD:EE:00").Return("/org/bluez/hci0", nil)
+				mock.On("GetDeviceSets", "/org/bluez/hci0").Return([]bluetooth.DeviceSet{budsSet}, nil)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := bluetooth.NewMockBluetoothManager(t)
+			tt.setupMock(mock)
+
+			e := echo.New()
+			req := httptest.NewRequest(http.MethodPatch, "/api/v1/bluetooth/adapters/AA:BB:CC:DD:EE:00/sets/"+tt.set+"/volume", strings.NewReader(`{"volume": 60}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.SetParamNames("adapter", "set")
+			c.SetParamValues("AA:BB:CC:DD:EE:00", tt.set)
+
+			assert.NoError(t, NewBluetoothHandlerWithManager(mock).SetDeviceSetVolume(c))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
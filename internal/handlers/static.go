@@ -0,0 +1,8 @@
+package handlers
+
+import "embed"
+
+// StaticFiles holds the web UI, embedded in the binary so it is served from any working directory
+//
+//go:embed static
+var StaticFiles embed.FS
@@ -0,0 +1,24 @@
+// Service worker of the web UI, showing the push notifications of the broker
+self.addEventListener('push', (event) => {
+    let data = {};
+    try {
+        data = event.data ? event.data.json() : {};
+    } catch (e) {
+        data = { body: event.data.text() };
+    }
+    event.waitUntil(self.registration.showNotification(data.title || 'Bluetooth broker', {
+        body: data.body || '',
+        tag: data.title
+    }));
+});
+
+// Focus the web UI when a notification is clicked, opening it when it is not running
+self.addEventListener('notificationclick', (event) => {
+    event.notification.close();
+    event.waitUntil(clients.matchAll({ type: 'window', includeUncontrolled: true }).then((windows) => {
+        for (const client of windows) {
+            if (client.url.startsWith(self.registration.scope) && 'focus' in client) return client.focus();
+        }
+        return clients.openWindow(self.registration.scope);
+    }));
+});
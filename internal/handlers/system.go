@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+)
+
+// SystemHandler reports the BlueZ the broker talks to and gates the features it lacks
+type SystemHandler struct {
+	// info is nil when it could not be detected at startup, then no feature is gated
+	info *bluetooth.SystemInfo
+}
+
+// NewSystemHandler creates a new system handler from the BlueZ information detected at startup
+func NewSystemHandler(info *bluetooth.SystemInfo) *SystemHandler {
+	return &SystemHandler{info: info}
+}
+
+// GetInfo returns the version of BlueZ, the interfaces it exports and the available features
+func (sh *SystemHandler) GetInfo(c echo.Context) error {
+	if sh.info == nil {
+		return jsonError(c, http.StatusServiceUnavailable, "BlueZ information could not be detected at startup")
+	}
+	return c.JSON(http.StatusOK, sh.info)
+}
+
+// RequireFeature answers 501 Not Implemented, along with the BlueZ version the feature requires, on
+// the routes of a feature the running BlueZ lacks
+func (sh *SystemHandler) RequireFeature(name string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if sh.info == nil {
+				return next(c)
+			}
+			feature, ok := sh.info.Features[name]
+			if !ok || feature.Available {
+				return next(c)
+			}
+			return jsonErrorWith(c, http.StatusNotImplemented, name+" is not available: "+feature.Reason, map[string]string{
+				"feature":                name,
+				"required_bluez_version": feature.RequiredVersion,
+				"bluez_version":          sh.info.Version,
+			})
+		}
+	}
+}
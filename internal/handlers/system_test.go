@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemHandler_RequireFeature(t *testing.T) {
+	e := echo.New()
+	next := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	request := func(sh *SystemHandler, feature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/00:1A:7D:DA:71:01/broadcasts", nil)
+		rec := httptest.NewRecorder()
+		assert.NoError(t, sh.RequireFeature(feature)(next)(e.NewContext(req, rec)))
+		return rec
+	}
+
+	sh := NewSystemHandler(bluetooth.NewSystemInfo(bluetooth.BackendDBus, "5.72", nil, nil))
+	assert.Equal(t, http.StatusOK, request(sh, bluetooth.FeatureLEAudio).Code)
+	rec := request(sh, bluetooth.FeatureLEAudioBroadcast)
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+	assert.JSONEq(t, `{
+		"error": "le_audio_broadcast is not available: requires BlueZ 5.78 or later, found 5.72",
+		"feature": "le_audio_broadcast",
+		"required_bluez_version": "5.78",
+		"bluez_version": "5.72"
+	}`, rec.Body.String())
+
+	// Nothing is gated when BlueZ could not be detected
+	assert.Equal(t, http.StatusOK, request(NewSystemHandler(nil), bluetooth.FeatureLEAudioBroadcast).Code)
+}
+
+func TestSystemHandler_GetInfo(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/system/info", nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, NewSystemHandler(bluetooth.NewSystemInfo(bluetooth.BackendDBus, "5.72", []string{"org.bluez.Adapter1"}, nil)).GetInfo(e.NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"version":"5.72"`)
+	assert.Contains(t, rec.Body.String(), `"interfaces":["org.bluez.Adapter1"]`)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// Quota headers, set on the responses to tokens with a quota. They describe the quota closest to
+// be exhausted.
+const (
+	HeaderQuotaLimit     = "X-Quota-Limit"
+	HeaderQuotaRemaining = "X-Quota-Remaining"
+	HeaderQuotaReset     = "X-Quota-Reset"
+	HeaderQuotaPeriod    = "X-Quota-Period"
+)
+
+// QuotaUsage is the use of a quota of a token in its current window
+type QuotaUsage struct {
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining *int      `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+type TokenQuotaResponse struct {
+	Username string     `json:"username"`
+	Hourly   QuotaUsage `json:"hourly"`
+	Daily    QuotaUsage `json:"daily"`
+}
+
+// quotaWindow returns the bounds of the window of a quota period containing a time: the current
+// hour, or the current day in local time
+func quotaWindow(period string, now time.Time) (time.Time, time.Time) {
+	if period == database.QuotaPeriodHour {
+		start := now.Truncate(time.Hour)
+		return start.UTC(), start.Add(time.Hour).UTC()
+	}
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return start.UTC(), start.AddDate(0, 0, 1).UTC()
+}
+
+// QuotaMiddleware enforces the hourly and daily request quotas of tokens, answering 429 Too Many
+// Requests until the window of the exhausted quota ends. Unlike a burst rate limit, a quota
+// bounds the total requests of a token over a long period. It must be chained after AuthMiddleware.
+func QuotaMiddleware(db database.DatabaseInterface) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			username, _ := c.Get("username").(string)
+			if username == "" {
+				return next(c)
+			}
+
+			quota, err := database.GetTokenQuota(db, username)
+			if err != nil {
+				// A failure to read the quota must not lock the token out
+				log.Printf("request_id=%s %v", RequestID(c), err)
+				return next(c)
+			}
+
+			now := time.Now()
+			remaining := -1
+			for _, limit := range []struct {
+				period string
+				name   string
+				value  int
+			}{
+				{database.QuotaPeriodHour, "hourly", quota.Hourly},
+				{database.QuotaPeriodDay, "daily", quota.Daily},
+			} {
+				if limit.value <= 0 {
+					continue
+				}
+
+				start, end := quotaWindow(limit.period, now)
+				used, ok, err := database.ConsumeTokenQuota(db, username, limit.period, start, limit.value)
+				if err != nil {
+					log.Printf("request_id=%s %v", RequestID(c), err)
+					continue
+				}
+
+				if ok && remaining >= 0 && limit.value-used >= remaining {
+					continue
+				}
+				remaining = limit.value - used
+				header := c.Response().Header()
+				header.Set(HeaderQuotaLimit, strconv.Itoa(limit.value))
+				header.Set(HeaderQuotaRemaining, strconv.Itoa(remaining))
+				header.Set(HeaderQuotaReset, strconv.FormatInt(end.Unix(), 10))
+				header.Set(HeaderQuotaPeriod, limit.period)
+
+				if !ok {
+					retryAfter := int(end.Sub(now).Seconds()) + 1
+					header.Set("Retry-After", strconv.Itoa(retryAfter))
+					return jsonError(c, http.StatusTooManyRequests, limit.name+" request quota exceeded")
+				}
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// GetTokenQuota returns the request quotas of a token and their use in the current windows
+func (h *Handler) GetTokenQuota(c echo.Context) error {
+	username := c.Param("username")
+	quota, err := database.GetTokenQuota(h.db, username)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return jsonError(c, http.StatusNotFound, "token not found")
+		}
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	resp := TokenQuotaResponse{Username: username}
+	now := time.Now()
+	for _, usage := range []struct {
+		period string
+		limit  int
+		dest   *QuotaUsage
+	}{
+		{database.QuotaPeriodHour, quota.Hourly, &resp.Hourly},
+		{database.QuotaPeriodDay, quota.Daily, &resp.Daily},
+	} {
+		start, end := quotaWindow(usage.period, now)
+		used, err := database.GetTokenQuotaUsage(h.db, username, usage.period, start)
+		if err != nil {
+			return jsonError(c, http.StatusInternalServerError, err.Error())
+		}
+
+		*usage.dest = QuotaUsage{Limit: usage.limit, Used: used, ResetsAt: end}
+		if usage.limit > 0 {
+			remaining := max(usage.limit-used, 0)
+			usage.dest.Remaining = &remaining
+		}
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// SetTokenQuota changes the hourly and daily request quotas of a token, 0 removing a quota
+func (h *Handler) SetTokenQuota(c echo.Context) error {
+	var quota database.TokenQuota
+	if err := c.Bind(&quota); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	if quota.Hourly < 0 || quota.Daily < 0 {
+		return jsonError(c, http.StatusBadRequest, "quotas must be positive, or 0 for no quota")
+	}
+
+	if err := database.SetTokenQuota(h.db, c.Param("username"), quota); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return jsonError(c, http.StatusNotFound, "token not found")
+		}
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, quota)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaWindow(t *testing.T) {
+	now := time.Date(2026, 3, 1, 14, 25, 0, 0, time.FixedZone("CET", 3600))
+
+	start, end := quotaWindow("hour", now)
+	assert.Equal(t, time.Date(2026, 3, 1, 13, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC), end)
+
+	// Days follow the local time
+	start, end = quotaWindow("day", now)
+	assert.Equal(t, time.Date(2026, 2, 28, 23, 0, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC), end)
+}
+
+func TestQuotaMiddleware(t *testing.T) {
+	tests := []struct {
+		name              string
+		hourly            int
+		daily             int
+		hourlyUsed        int
+		dailyUsed         int
+		expectedStatus    int
+		expectedPeriod    string
+		expectedRemaining string
+	}{
+		{
+			name:           "success - no quota",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:              "success - closest quota in headers",
+			hourly:            100,
+			daily:             1000,
+			hourlyUsed:        10,
+			dailyUsed:         995,
+			expectedStatus:    http.StatusOK,
+			expectedPeriod:    "day",
+			expectedRemaining: "5",
+		},
+		{
+			name:              "failure - hourly quota exceeded",
+			hourly:            100,
+			daily:             1000,
+			hourlyUsed:        -1,
+			expectedStatus:    http.StatusTooManyRequests,
+			expectedPeriod:    "hour",
+			expectedRemaining: "0",
+		},
+		{
+			name:              "failure - daily quota exceeded on the last hourly request",
+			hourly:            100,
+			daily:             1000,
+			hourlyUsed:        100,
+			dailyUsed:         -1,
+			expectedStatus:    http.StatusTooManyRequests,
+			expectedPeriod:    "day",
+			expectedRemaining: "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+
+			mock.ExpectQuery("SELECT COALESCE\\(hourly_quota, 0\\), COALESCE\\(daily_quota, 0\\) FROM user_tokens").
+				WithArgs("alice").
+				WillReturnRows(sqlmock.NewRows([]string{"hourly_quota", "daily_quota"}).AddRow(tt.hourly, tt.daily))
+			for _, usage := range []struct {
+				period string
+				limit  int
+				used   int
+			}{{"hour", tt.hourly, tt.hourlyUsed}, {"day", tt.daily, tt.dailyUsed}} {
+				if usage.limit == 0 {
+					continue
+				}
+				rows := sqlmock.NewRows([]string{"requests"})
+				if usage.used >= 0 {
+					rows.AddRow(usage.used)
+				}
+				mock.ExpectQuery("INSERT INTO token_quota_usage").
+					WithArgs("alice", usage.period, sqlmock.AnyArg(), usage.limit).
+					WillReturnRows(rows)
+				if usage.used < 0 {
+					// The request is not counted in the next quotas
+					break
+				}
+			}
+
+			e := echo.New()
+			e.GET("/", func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			}, func(next echo.HandlerFunc) echo.HandlerFunc {
+				return func(c echo.Context) error {
+					c.Set("username", "alice")
+					return next(c)
+				}
+			}, QuotaMiddleware(db))
+
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, tt.expectedPeriod, rec.Header().Get(HeaderQuotaPeriod))
+			assert.Equal(t, tt.expectedRemaining, rec.Header().Get(HeaderQuotaRemaining))
+			assert.Equal(t, tt.expectedStatus == http.StatusTooManyRequests, rec.Header().Get("Retry-After") != "")
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestHandler_TokenQuota(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	h := NewHandlerWithDB(db)
+	e := echo.New()
+	newContext := func(method, body, username string) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/api/v1/tokens/"+username+"/quota", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("username")
+		c.SetParamValues(username)
+		return c, rec
+	}
+
+	mock.ExpectExec("UPDATE user_tokens SET hourly_quota = NULLIF\\(\\?, 0\\), daily_quota = NULLIF\\(\\?, 0\\)").
+		WithArgs(0, 500, "alice").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	c, rec := newContext(http.MethodPut, `{"daily": 500}`, "alice")
+	assert.NoError(t, h.SetTokenQuota(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	c, rec = newContext(http.MethodPut, `{"hourly": -1}`, "alice")
+	assert.NoError(t, h.SetTokenQuota(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	mock.ExpectExec("UPDATE user_tokens SET hourly_quota").
+		WithArgs(10, 0, "bob").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	c, rec = newContext(http.MethodPut, `{"hourly": 10}`, "bob")
+	assert.NoError(t, h.SetTokenQuota(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	mock.ExpectQuery("SELECT COALESCE\\(hourly_quota, 0\\)").WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"hourly_quota", "daily_quota"}).AddRow(0, 500))
+	mock.ExpectQuery("SELECT requests FROM token_quota_usage").WithArgs("alice", "hour", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"requests"}).AddRow(12))
+	mock.ExpectQuery("SELECT requests FROM token_quota_usage").WithArgs("alice", "day", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"requests"}).AddRow(120))
+	c, rec = newContext(http.MethodGet, "", "alice")
+	assert.NoError(t, h.GetTokenQuota(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp TokenQuotaResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, 12, resp.Hourly.Used)
+	assert.Nil(t, resp.Hourly.Remaining)
+	assert.Equal(t, 500, resp.Daily.Limit)
+	if assert.NotNil(t, resp.Daily.Remaining) {
+		assert.Equal(t, 380, *resp.Daily.Remaining)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// TokenStats aggregates the requests of a token over its routes
+type TokenStats struct {
+	Username   string                    `json:"username"`
+	Requests   int64                     `json:"requests"`
+	Errors     int64                     `json:"errors"`
+	ErrorRate  float64                   `json:"error_rate"`
+	LastUsedAt *time.Time                `json:"last_used_at"`
+	Routes     []TokenRouteStatsResponse `json:"routes"`
+}
+
+type TokenRouteStatsResponse struct {
+	database.TokenRouteStats
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// TokenStatsMiddleware counts the requests of each authenticated token by route, along with the
+// responses with an error status. It must run before AuthMiddleware so it sees the username it
+// sets; a failure to record does not fail the request.
+func TokenStatsMiddleware(db database.DatabaseInterface) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			if err != nil {
+				// Let the error handler write the response so its status is the one recorded
+				c.Error(err)
+			}
+
+			username, _ := c.Get("username").(string)
+			if username == "" {
+				return nil
+			}
+			route := c.Request().Method + " " + c.Path()
+			failed := c.Response().Status >= http.StatusBadRequest
+			if err := database.RecordTokenRequest(db, username, route, failed, time.Now()); err != nil {
+				log.Printf("request_id=%s %v", RequestID(c), err)
+			}
+			return nil
+		}
+	}
+}
+
+// GetTokenStats returns the request counts and error rates of a token, by route
+func (h *Handler) GetTokenStats(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return jsonError(c, http.StatusBadRequest, "username parameter is required")
+	}
+
+	// Revoked tokens keep their statistics
+	var exists int
+	err := h.db.QueryRow("SELECT 1 FROM user_tokens WHERE username = ?", username).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return jsonError(c, http.StatusNotFound, "token not found")
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	routes, err := database.GetTokenRouteStats(h.db, username)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	stats := TokenStats{Username: username, Routes: make([]TokenRouteStatsResponse, 0, len(routes))}
+	for _, route := range routes {
+		stats.Requests += route.Requests
+		stats.Errors += route.Errors
+		if stats.LastUsedAt == nil || route.LastUsedAt.After(*stats.LastUsedAt) {
+			lastUsedAt := route.LastUsedAt
+			stats.LastUsedAt = &lastUsedAt
+		}
+		stats.Routes = append(stats.Routes, TokenRouteStatsResponse{
+			TokenRouteStats: route,
+			ErrorRate:       errorRate(route.Errors, route.Requests),
+		})
+	}
+	stats.ErrorRate = errorRate(stats.Errors, stats.Requests)
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// errorRate is the share of failed requests, between 0 and 1
+func errorRate(errors, requests int64) float64 {
+	if requests == 0 {
+		return 0
+	}
+	return float64(errors) / float64(requests)
+}
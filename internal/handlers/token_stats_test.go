@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenStatsMiddleware(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO token_route_stats").
+		WithArgs("alice", "GET /api/v1/bluetooth/adapters/:adapter", 1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	e := echo.New()
+	e.Use(TokenStatsMiddleware(db))
+	setUser := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("username", "alice")
+			return next(c)
+		}
+	}
+	e.GET("/api/v1/bluetooth/adapters/:adapter", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, "adapter not found")
+	}, setUser)
+	e.GET("/api/v1/health", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/bluetooth/adapters/hci0", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Unauthenticated requests are not recorded
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestHandler_GetTokenStats(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	early := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	late := early.Add(time.Hour)
+	mock.ExpectQuery("SELECT 1 FROM user_tokens WHERE username = ?").WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	mock.ExpectQuery("SELECT route, requests, errors, last_used_at FROM token_route_stats").WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"route", "requests", "errors", "last_used_at"}).
+			AddRow("GET /api/v1/bluetooth/adapters", 6, 0, early).
+			AddRow("POST /api/v1/bluetooth/adapters/:adapter/devices/:mac/pair", 2, 2, late))
+	mock.ExpectQuery("SELECT 1 FROM user_tokens WHERE username = ?").WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"1"}))
+
+	h := NewHandler(db, nil)
+	e := echo.New()
+
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/tokens/alice/stats", nil), rec)
+	c.SetParamNames("username")
+	c.SetParamValues("alice")
+	assert.NoError(t, h.GetTokenStats(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var stats TokenStats
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+	assert.Equal(t, int64(8), stats.Requests)
+	assert.Equal(t, int64(2), stats.Errors)
+	assert.Equal(t, 0.25, stats.ErrorRate)
+	assert.True(t, late.Equal(*stats.LastUsedAt))
+	if assert.Len(t, stats.Routes, 2) {
+		assert.Equal(t, 0.0, stats.Routes[0].ErrorRate)
+		assert.Equal(t, 1.0, stats.Routes[1].ErrorRate)
+	}
+
+	rec = httptest.NewRecorder()
+	c = e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/tokens/bob/stats", nil), rec)
+	c.SetParamNames("username")
+	c.SetParamValues("bob")
+	assert.NoError(t, h.GetTokenStats(c))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
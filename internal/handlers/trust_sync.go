@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/trustsync"
+)
+
+// TrustSyncHandler replicates the trust of devices between the adapters of the host
+type TrustSyncHandler struct {
+	btManager bluetooth.BluetoothManagerInterface
+	syncer    *trustsync.Syncer
+}
+
+// TrustSyncRequest is the optional body of a sync
+type TrustSyncRequest struct {
+	// Pair pairs the device with the adapters it is not paired with, defaults to true
+	Pair *bool `json:"pair"`
+}
+
+// NewTrustSyncHandler creates a new trust sync handler
+func NewTrustSyncHandler(btManager bluetooth.BluetoothManagerInterface, syncer *trustsync.Syncer) *TrustSyncHandler {
+	return &TrustSyncHandler{btManager: btManager, syncer: syncer}
+}
+
+// Sync trusts, and pairs unless asked not to, a device trusted on an adapter on the other adapters
+func (th *TrustSyncHandler) Sync(c echo.Context) error {
+	var req TrustSyncRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	adapterPath, err := th.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+
+	results, err := th.syncer.Sync(adapterPath, c.Param("mac"), req.Pair == nil || *req.Pair)
+	switch {
+	case errors.Is(err, trustsync.ErrDeviceNotFound):
+		return jsonError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, trustsync.ErrNotTrusted):
+		return jsonError(c, http.StatusConflict, err.Error())
+	case err != nil:
+		return jsonError(c, http.StatusInternalServerError, "failed to sync device: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"adapters": results,
+	})
+}
+
+// MigrateDeviceRequest is the body of a device migration
+type MigrateDeviceRequest struct {
+	// TargetAdapter is the MAC address of the adapter the device moves to
+	TargetAdapter string `json:"target_adapter"`
+}
+
+// Migrate moves a device to another adapter, pairing it with the target before removing it from
+// its adapter. Pairing goes through the agent, so with PAIRING_MODE=manual the request waits for the
+// pairing requests to be answered.
+func (th *TrustSyncHandler) Migrate(c echo.Context) error {
+	var req MigrateDeviceRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+	if req.TargetAdapter == "" {
+		return jsonError(c, http.StatusBadRequest, "target_adapter is required")
+	}
+
+	sourcePath, err := th.btManager.GetAdapterPathByMAC(c.Param("adapter"))
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "adapter not found: "+err.Error())
+	}
+	targetPath, err := th.btManager.GetAdapterPathByMAC(req.TargetAdapter)
+	if err != nil {
+		return jsonError(c, http.StatusNotFound, "target adapter not found: "+err.Error())
+	}
+
+	migration, err := th.syncer.Migrate(c.Request().Context(), sourcePath, targetPath, c.Param("mac"))
+	switch {
+	case errors.Is(err, trustsync.ErrSameAdapter):
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, trustsync.ErrDeviceNotFound), errors.Is(err, trustsync.ErrNotDiscovered):
+		return jsonError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, trustsync.ErrAdapterPoweredOff):
+		return jsonError(c, http.StatusConflict, err.Error())
+	case err != nil:
+		return jsonError(c, http.StatusInternalServerError, "failed to migrate device: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, migration)
+}
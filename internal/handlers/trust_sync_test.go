@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/trustsync"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustSyncHandler_Sync(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "00:1A:7D:DA:71:01").Return("/org/bluez/hci0", nil)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true},
+		{Path: "/org/bluez/hci1", Address: "00:1A:7D:DA:71:02", Powered: true},
+	}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true},
+		{Address: "11:22:33:44:55:66", Paired: true},
+	}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF"}}, nil)
+	btMock.On("TrustDevice", "/org/bluez/hci1", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+
+	e := echo.New()
+	th := NewTrustSyncHandler(btMock, trustsync.NewSyncer(btMock, nil, trustsync.PolicyOff))
+	sync := func(mac, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/00:1A:7D:DA:71:01/devices/"+mac+"/sync", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("adapter", "mac")
+		c.SetParamValues("00:1A:7D:DA:71:01", mac)
+		assert.NoError(t, th.Sync(c))
+		return rec
+	}
+
+	rec := sync("AA:BB:CC:DD:EE:FF", `{"pair": false}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"adapters": [{"adapter": "00:1A:7D:DA:71:02", "paired": false, "trusted": true}]}`, rec.Body.String())
+
+	assert.Equal(t, http.StatusConflict, sync("11:22:33:44:55:66", "").Code)
+	assert.Equal(t, http.StatusNotFound, sync("22:33:44:55:66:77", "").Code)
+}
+
+func TestTrustSyncHandler_Migrate(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapterPathByMAC", "00:1A:7D:DA:71:01").Return("/org/bluez/hci0", nil)
+	btMock.On("GetAdapterPathByMAC", "00:1A:7D:DA:71:02").Return("/org/bluez/hci1", nil)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true},
+		{Path: "/org/bluez/hci1", Address: "00:1A:7D:DA:71:02", Powered: true},
+	}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true}}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true}}, nil)
+	btMock.On("TrustDevice", "/org/bluez/hci1", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+	btMock.On("RemoveDevice", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+
+	e := echo.New()
+	th := NewTrustSyncHandler(btMock, trustsync.NewSyncer(btMock, nil, trustsync.PolicyOff))
+	migrate := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/bluetooth/adapters/00:1A:7D:DA:71:01/devices/AA:BB:CC:DD:EE:FF/migrate", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("adapter", "mac")
+		c.SetParamValues("00:1A:7D:DA:71:01", "AA:BB:CC:DD:EE:FF")
+		assert.NoError(t, th.Migrate(c))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusBadRequest, migrate(`{}`).Code)
+	assert.Equal(t, http.StatusBadRequest, migrate(`{"target_adapter": "00:1A:7D:DA:71:01"}`).Code)
+
+	rec := migrate(`{"target_adapter": "00:1A:7D:DA:71:02"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"address": "AA:BB:CC:DD:EE:FF", "from": "00:1A:7D:DA:71:01", "to": "00:1A:7D:DA:71:02", "paired": false}`, rec.Body.String())
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// ExportUser returns what the broker stores about a user as a JSON attachment. Users may export
+// their own data, admins the data of anyone.
+func (h *Handler) ExportUser(c echo.Context) error {
+	username := c.Param("username")
+	if username == "" {
+		return jsonError(c, http.StatusBadRequest, "username parameter is required")
+	}
+
+	self, _ := c.Get("username").(string)
+	if isAdmin, _ := c.Get("is_admin").(bool); !isAdmin && self != username {
+		return jsonError(c, http.StatusForbidden, "only admins may export the data of another user")
+	}
+
+	export, err := database.ExportUser(h.db, h.cipher, username, time.Now())
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+	if export == nil {
+		return jsonError(c, http.StatusNotFound, "user not found")
+	}
+
+	c.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		mime.FormatMediaType("attachment", map[string]string{"filename": username + "-export.json"}))
+	return c.JSON(http.StatusOK, export)
+}
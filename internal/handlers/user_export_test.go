@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_ExportUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("FROM user_tokens WHERE username = ?").WithArgs("kitchen").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "last_used_at", "last_ip", "is_admin", "revoked_at", "revoked_by", "hourly_quota", "daily_quota"}).
+			AddRow(at, at.Add(time.Hour), "192.0.2.1", false, nil, nil, 600, 0))
+	mock.ExpectQuery("FROM token_route_stats WHERE username = ?").WithArgs("kitchen").
+		WillReturnRows(sqlmock.NewRows([]string{"route", "requests", "errors", "last_used_at"}).
+			AddRow("GET /api/v1/bluetooth/adapters", 12, 1, at.Add(time.Hour)))
+	mock.ExpectQuery("FROM audit_log WHERE actor = ?").WithArgs("kitchen").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "actor", "ip", "action", "device", "outcome", "status", "request_id"}).
+			AddRow(4, at, "kitchen", "192.0.2.1", "POST /api/v1/bluetooth/adapters/:adapter/devices/:mac/connect", "AA:BB:CC:DD:EE:FF", "success", 200, "abc"))
+	// The owners may be encrypted, the devices of other users are left out once decrypted
+	mock.ExpectQuery("FROM device_owners ORDER BY paired_at DESC").
+		WillReturnRows(sqlmock.NewRows([]string{"address", "owner", "adapter", "paired_at"}).
+			AddRow("AA:BB:CC:DD:EE:FF", "kitchen", "00:1A:7D:DA:71:01", at).
+			AddRow("11:22:33:44:55:66", "admin", "00:1A:7D:DA:71:01", at))
+	mock.ExpectQuery("FROM webpush_subscriptions WHERE username = ?").WithArgs("kitchen").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "endpoint", "p256dh", "auth", "created_at"}).
+			AddRow(1, "kitchen", "https://push.example.com/abc", "BPub", "c2VjcmV0", at))
+	mock.ExpectQuery("FROM ha_tokens WHERE username = ?").WithArgs("kitchen").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "name", "created_at"}))
+	mock.ExpectQuery("FROM sessions WHERE username = ?").WithArgs("kitchen").
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "expires_at"}).AddRow(at, at.Add(24*time.Hour)))
+	mock.ExpectQuery("FROM pairing_sessions WHERE username = ?").WithArgs("kitchen").
+		WillReturnRows(sqlmock.NewRows([]string{"username", "adapter", "created_at", "expires_at"}))
+
+	e := echo.New()
+	h := NewHandlerWithDB(db)
+	export := func(username string, isAdmin bool, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/"+target+"/export", nil)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("username")
+		c.SetParamValues(target)
+		c.Set("username", username)
+		c.Set("is_admin", isAdmin)
+		assert.NoError(t, h.ExportUser(c))
+		return rec
+	}
+
+	rec := export("kitchen", false, "kitchen")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response database.UserExport
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "kitchen", response.Username)
+	assert.Equal(t, 600, response.Token.HourlyQuota)
+	assert.Len(t, response.RouteStats, 1)
+	assert.Len(t, response.AuditEntries, 1)
+	assert.Len(t, response.Sessions, 1)
+	assert.Equal(t, []database.DeviceOwner{{Address: "AA:BB:CC:DD:EE:FF", Owner: "kitchen", Adapter: "00:1A:7D:DA:71:01", PairedAt: at}}, response.OwnedDevices)
+	assert.Empty(t, response.HomeAssistantTokens)
+	assert.Len(t, response.PushSubscriptions, 1)
+	assert.NotContains(t, rec.Body.String(), `"token":"`, "the token secret must not be exported")
+	assert.NotContains(t, rec.Body.String(), "c2VjcmV0", "the push auth secret must not be exported")
+
+	// Only admins may export another user
+	assert.Equal(t, http.StatusForbidden, export("kitchen", false, "admin").Code)
+
+	mock.ExpectQuery("FROM user_tokens WHERE username = ?").WithArgs("nobody").WillReturnError(sql.ErrNoRows)
+	assert.Equal(t, http.StatusNotFound, export("admin", true, "nobody").Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
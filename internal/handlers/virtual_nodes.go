@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/audio"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// VirtualNodesHandler manages the PipeWire virtual nodes owned by the broker
+type VirtualNodesHandler struct {
+	nodes *audio.VirtualNodes
+	db    database.DatabaseInterface
+}
+
+type CreateVirtualNodeRequest struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	Target      string `json:"target"`
+	// Channels defaults to 2
+	Channels int `json:"channels"`
+}
+
+// NewVirtualNodesHandler creates a new virtual nodes handler
+func NewVirtualNodesHandler(nodes *audio.VirtualNodes, db database.DatabaseInterface) *VirtualNodesHandler {
+	return &VirtualNodesHandler{nodes: nodes, db: db}
+}
+
+// GetNodes returns the virtual nodes
+func (vh *VirtualNodesHandler) GetNodes(c echo.Context) error {
+	nodes, err := database.GetVirtualNodes(vh.db)
+	if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"nodes": nodes,
+	})
+}
+
+// CreateNode adds a virtual node, it is created in PipeWire in the background
+func (vh *VirtualNodesHandler) CreateNode(c echo.Context) error {
+	var req CreateVirtualNodeRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	node := database.VirtualNode{
+		Name:        req.Name,
+		Type:        req.Type,
+		Description: req.Description,
+		Target:      req.Target,
+		Channels:    req.Channels,
+		CreatedAt:   time.Now(),
+	}
+	if node.Channels == 0 {
+		node.Channels = 2
+	}
+	if err := audio.ValidateVirtualNode(node); err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+
+	err := vh.nodes.Add(node)
+	if errors.Is(err, audio.ErrVirtualNodeExists) {
+		return jsonError(c, http.StatusConflict, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, node)
+}
+
+// DeleteNode removes a virtual node
+func (vh *VirtualNodesHandler) DeleteNode(c echo.Context) error {
+	err := vh.nodes.Delete(c.Request().Context(), c.Param("name"))
+	if errors.Is(err, audio.ErrVirtualNodeNotFound) {
+		return jsonError(c, http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return jsonError(c, http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "virtual node removed",
+	})
+}
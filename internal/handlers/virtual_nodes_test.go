@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/audio"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVirtualNodesHandler_CreateNode(t *testing.T) {
+	columns := []string{"name", "type", "description", "target", "channels", "created_at"}
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		setupMock      func(sqlmock.Sqlmock)
+		expectedStatus int
+	}{
+		{
+			name:        "success - channels default to stereo",
+			requestBody: `{"name": "announcements", "type": "null-sink"}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT name, type, description, target, channels, created_at FROM virtual_nodes").
+					WillReturnRows(sqlmock.NewRows(columns))
+				mock.ExpectExec("INSERT INTO virtual_nodes").
+					WithArgs("announcements", "null-sink", "", "", 2, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:        "failure - name already used",
+			requestBody: `{"name": "announcements", "type": "loopback"}`,
+			setupMock: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT name, type, description, target, channels, created_at FROM virtual_nodes").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("announcements", "null-sink", "", "", 2, time.Now()))
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "failure - invalid type",
+			requestBody:    `{"name": "announcements", "type": "source"}`,
+			setupMock:      func(mock sqlmock.Sqlmock) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, dbMock, err := sqlmock.New()
+			assert.NoError(t, err)
+			defer db.Close()
+			tt.setupMock(dbMock)
+
+			h := NewVirtualNodesHandler(audio.NewVirtualNodes(db, audio.CLI{}, time.Minute), db)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/audio/virtual-nodes", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+
+			assert.NoError(t, h.CreateNode(echo.New().NewContext(req, rec)))
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.NoError(t, dbMock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+	"github.com/nerzhul/home-bt-broker/internal/webpush"
+)
+
+// WebPushHandler manages the Web Push subscriptions of the browsers running the web UI
+type WebPushHandler struct {
+	db     database.DatabaseInterface
+	cipher *secrets.Cipher
+	client *webpush.Client
+}
+
+// PushSubscriptionRequest is the push subscription of a browser, as returned by PushSubscription.toJSON()
+type PushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// NewWebPushHandler creates a new Web Push handler, the client being nil when Web Push is not configured.
+// The subscription keys are encrypted with the cipher when it is enabled.
+func NewWebPushHandler(db database.DatabaseInterface, cipher *secrets.Cipher, client *webpush.Client) *WebPushHandler {
+	return &WebPushHandler{db: db, cipher: cipher, client: client}
+}
+
+// GetPublicKey returns the VAPID public key the browsers subscribe with
+func (wh *WebPushHandler) GetPublicKey(c echo.Context) error {
+	if wh.client == nil {
+		return jsonError(c, http.StatusNotFound, "web push is not configured")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"public_key": wh.client.PublicKey(),
+	})
+}
+
+// Subscribe stores the push subscription of a browser of the current user
+func (wh *WebPushHandler) Subscribe(c echo.Context) error {
+	if wh.client == nil {
+		return jsonError(c, http.StatusNotFound, "web push is not configured")
+	}
+
+	var req PushSubscriptionRequest
+	if err := c.Bind(&req); err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid request body")
+	}
+
+	if err := webpush.CheckEndpoint(req.Endpoint); err != nil {
+		return jsonError(c, http.StatusBadRequest, err.Error())
+	}
+	p256dh, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(req.Keys.P256dh, "="))
+	if err != nil || !webpush.ValidPoint(p256dh) {
+		return jsonError(c, http.StatusBadRequest, "keys.p256dh must be a base64url encoded P-256 public key")
+	}
+	auth, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(req.Keys.Auth, "="))
+	if err != nil || len(auth) != 16 {
+		return jsonError(c, http.StatusBadRequest, "keys.auth must be a base64url encoded 16 bytes secret")
+	}
+
+	username, _ := c.Get("username").(string)
+	sub := database.WebPushSubscription{
+		Username:  username,
+		Endpoint:  req.Endpoint,
+		P256dh:    base64.RawURLEncoding.EncodeToString(p256dh),
+		Auth:      base64.RawURLEncoding.EncodeToString(auth),
+		CreatedAt: time.Now(),
+	}
+	sub.ID, err = database.AddWebPushSubscription(wh.db, wh.cipher, sub)
+	if errors.Is(err, database.ErrWebPushEndpointTaken) {
+		return jsonError(c, http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	return c.JSON(http.StatusCreated, sub)
+}
+
+// GetSubscriptions returns the push subscriptions of the current user
+func (wh *WebPushHandler) GetSubscriptions(c echo.Context) error {
+	username, _ := c.Get("username").(string)
+	subs, err := database.GetWebPushSubscriptions(wh.db, wh.cipher, username)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"subscriptions": subs,
+	})
+}
+
+// Unsubscribe deletes a push subscription, of the current user unless it is an admin
+func (wh *WebPushHandler) Unsubscribe(c echo.Context) error {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		return jsonError(c, http.StatusBadRequest, "invalid subscription id")
+	}
+
+	username, _ := c.Get("username").(string)
+	if isAdmin, _ := c.Get("is_admin").(bool); isAdmin {
+		username = ""
+	}
+	deleted, err := database.DeleteWebPushSubscription(wh.db, id, username)
+	if err != nil {
+		log.Printf("request_id=%s %v", RequestID(c), err)
+		return jsonError(c, http.StatusInternalServerError, "database error")
+	}
+	if !deleted {
+		return jsonError(c, http.StatusNotFound, "subscription not found")
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{
+		"message": "push subscription deleted",
+	})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/nerzhul/home-bt-broker/internal/webpush"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebPushHandler_Subscribe(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	key, err := webpush.LoadOrCreateKey(filepath.Join(t.TempDir(), "webpush.key"))
+	assert.NoError(t, err)
+	browser, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	p256dh := base64.RawURLEncoding.EncodeToString(browser.PublicKey().Bytes())
+	auth := base64.RawURLEncoding.EncodeToString([]byte("0123456789abcdef"))
+
+	e := echo.New()
+	wh := NewWebPushHandler(db, nil, webpush.NewClient(key, "mailto:admin@example.com"))
+	subscribe := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/push/subscriptions", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("username", "kitchen")
+		assert.NoError(t, wh.Subscribe(c))
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	assert.NoError(t, wh.GetPublicKey(e.NewContext(httptest.NewRequest(http.MethodGet, "/api/v1/push/vapid-public-key", nil), rec)))
+	assert.Contains(t, rec.Body.String(), wh.client.PublicKey())
+
+	mock.ExpectQuery("INSERT INTO webpush_subscriptions").
+		WithArgs("kitchen", "https://push.example.com/abc", p256dh, auth, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	rec = subscribe(`{"endpoint": "https://push.example.com/abc", "keys": {"p256dh": "` + p256dh + `", "auth": "` + auth + `=="}}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, float64(3), response["id"])
+	assert.NotContains(t, rec.Body.String(), auth, "the auth secret is not returned")
+
+	// Another user cannot take the endpoint over
+	mock.ExpectQuery("INSERT INTO webpush_subscriptions").
+		WithArgs("kitchen", "https://push.example.com/def", p256dh, auth, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	assert.Equal(t, http.StatusConflict, subscribe(`{"endpoint": "https://push.example.com/def", "keys": {"p256dh": "`+p256dh+`", "auth": "`+auth+`"}}`).Code)
+
+	// Plain HTTP and local endpoints and invalid keys are refused
+	assert.Equal(t, http.StatusBadRequest, subscribe(`{"endpoint": "http://push.example.com/abc", "keys": {"p256dh": "`+p256dh+`", "auth": "`+auth+`"}}`).Code)
+	assert.Equal(t, http.StatusBadRequest, subscribe(`{"endpoint": "https://192.168.1.1/admin", "keys": {"p256dh": "`+p256dh+`", "auth": "`+auth+`"}}`).Code)
+	assert.Equal(t, http.StatusBadRequest, subscribe(`{"endpoint": "https://localhost:8080/api/v1/tokens", "keys": {"p256dh": "`+p256dh+`", "auth": "`+auth+`"}}`).Code)
+	assert.Equal(t, http.StatusBadRequest, subscribe(`{"endpoint": "https://push.example.com/abc", "keys": {"p256dh": "AAAA", "auth": "`+auth+`"}}`).Code)
+	assert.Equal(t, http.StatusBadRequest, subscribe(`{"endpoint": "https://push.example.com/abc", "keys": {"p256dh": "`+p256dh+`", "auth": "AAAA"}}`).Code)
+
+	// Users may only delete their own subscriptions
+	unsubscribe := func(username string, isAdmin bool) int {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodDelete, "/api/v1/push/subscriptions/3", nil), rec)
+		c.SetParamNames("id")
+		c.SetParamValues("3")
+		c.Set("username", username)
+		c.Set("is_admin", isAdmin)
+		assert.NoError(t, wh.Unsubscribe(c))
+		return rec.Code
+	}
+	mock.ExpectExec("DELETE FROM webpush_subscriptions WHERE id = \\? AND username = \\?").WithArgs(int64(3), "bedroom").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Equal(t, http.StatusNotFound, unsubscribe("bedroom", false))
+	mock.ExpectExec("DELETE FROM webpush_subscriptions WHERE id = \\?$").WithArgs(int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.Equal(t, http.StatusOK, unsubscribe("admin", true))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// The public key is not found when Web Push is not configured
+	rec = httptest.NewRecorder()
+	assert.NoError(t, NewWebPushHandler(db, nil, nil).GetPublicKey(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
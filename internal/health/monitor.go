@@ -0,0 +1,133 @@
+package health
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stallFactor is the number of missed intervals after which a loop is considered stalled
+const stallFactor = 3
+
+// Monitor tracks the heartbeats of the broker's internal loops, to detect a loop that stopped
+// running while the process is still alive
+type Monitor struct {
+	mu    sync.Mutex
+	loops map[string]*loop
+}
+
+type loop struct {
+	interval   time.Duration
+	registered time.Time
+	lastBeat   time.Time
+	latency    time.Duration
+}
+
+// LoopStatus is the heartbeat state of an internal loop
+type LoopStatus struct {
+	Name     string     `json:"name"`
+	Interval string     `json:"interval"`
+	LastBeat *time.Time `json:"last_beat,omitempty"`
+	// Lag is how late the loop is compared to its interval
+	Lag string `json:"lag"`
+	// Latency is the duration of the last iteration, when measured
+	Latency string `json:"latency,omitempty"`
+	Stalled bool   `json:"stalled"`
+}
+
+// NewMonitor creates a new loop monitor
+func NewMonitor() *Monitor {
+	return &Monitor{loops: make(map[string]*loop)}
+}
+
+// Register declares a loop expected to beat every interval
+func (m *Monitor) Register(name string, interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loops[name] = &loop{interval: interval, registered: time.Now()}
+}
+
+// Beat records an iteration of a loop, with its duration
+func (m *Monitor) Beat(name string, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.loops[name]; ok {
+		l.lastBeat = time.Now()
+		l.latency = latency
+	}
+}
+
+// Statuses returns the state of every registered loop, sorted by name
+func (m *Monitor) Statuses() []LoopStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]LoopStatus, 0, len(m.loops))
+	for name, l := range m.loops {
+		status := LoopStatus{Name: name, Interval: l.interval.String()}
+
+		// A loop that never beat is measured from its registration
+		since := l.registered
+		if !l.lastBeat.IsZero() {
+			lastBeat := l.lastBeat
+			status.LastBeat = &lastBeat
+			status.Latency = l.latency.String()
+			since = lastBeat
+		}
+
+		lag := now.Sub(since) - l.interval
+		if lag < 0 {
+			lag = 0
+		}
+		status.Lag = lag.Round(time.Millisecond).String()
+		status.Stalled = now.Sub(since) > stallFactor*l.interval
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Stalled reports whether any registered loop is stalled
+func (m *Monitor) Stalled() bool {
+	for _, status := range m.Statuses() {
+		if status.Stalled {
+			return true
+		}
+	}
+	return false
+}
+
+// Pinger is implemented by connections able to check a round trip, such as the D-Bus connection
+type Pinger interface {
+	Ping() error
+}
+
+// Watch pings every interval and beats the monitor after each successful ping, until the context is
+// cancelled. A connection that stops answering makes the loop stall.
+func (m *Monitor) Watch(ctx context.Context, name string, pinger Pinger, interval time.Duration) {
+	m.Register(name, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := pinger.Ping(); err != nil {
+			log.Printf("Health Monitor: %s ping failed: %v", name, err)
+		} else {
+			m.Beat(name, time.Since(start))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
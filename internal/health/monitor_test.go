@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pingerFunc func() error
+
+func (f pingerFunc) Ping() error { return f() }
+
+func TestMonitor(t *testing.T) {
+	m := NewMonitor()
+	m.Register("fast", 10*time.Millisecond)
+	m.Register("slow", time.Hour)
+
+	m.Beat("fast", time.Millisecond)
+	m.Beat("slow", time.Millisecond)
+	assert.False(t, m.Stalled())
+
+	time.Sleep(40 * time.Millisecond)
+
+	statuses := m.Statuses()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "fast", statuses[0].Name)
+	assert.True(t, statuses[0].Stalled)
+	assert.False(t, statuses[1].Stalled)
+	assert.True(t, m.Stalled())
+}
+
+func TestMonitor_Watch(t *testing.T) {
+	m := NewMonitor()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fail := make(chan bool, 1)
+	fail <- false
+	go m.Watch(ctx, "dbus", pingerFunc(func() error {
+		select {
+		case <-fail:
+			return nil
+		default:
+			return errors.New("no reply")
+		}
+	}), 10*time.Millisecond)
+
+	time.Sleep(5 * time.Millisecond)
+	assert.False(t, m.Stalled())
+	assert.NotNil(t, m.Statuses()[0].LastBeat)
+
+	// Pings keep failing so the loop stalls
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, m.Stalled())
+}
@@ -0,0 +1,204 @@
+// Package hfp controls the calls of phones connected with the Hands-Free Profile, through oFono
+package hfp
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	ofonoService          = "org.ofono"
+	ofonoManagerIface     = "org.ofono.Manager"
+	voiceCallManagerIface = "org.ofono.VoiceCallManager"
+	voiceCallIface        = "org.ofono.VoiceCall"
+)
+
+// Call states reported by oFono
+const (
+	CallActive   = "active"
+	CallHeld     = "held"
+	CallDialing  = "dialing"
+	CallAlerting = "alerting"
+	CallIncoming = "incoming"
+	CallWaiting  = "waiting"
+)
+
+var (
+	// ErrUnavailable is returned when oFono is not running
+	ErrUnavailable = errors.New("oFono is not available")
+	// ErrNoHandsFree is returned when oFono has no hands-free modem for the device, e.g. it is not connected
+	ErrNoHandsFree = errors.New("device has no hands-free connection")
+	// ErrNoIncomingCall is returned when answering while no call is ringing
+	ErrNoIncomingCall = errors.New("no incoming call")
+
+	phoneNumber = regexp.MustCompile(`^\+?[0-9*#]{1,32}$`)
+)
+
+// Call is a call of a phone
+type Call struct {
+	Path   string `json:"id"`
+	Number string `json:"number"`
+	Name   string `json:"name,omitempty"`
+	State  string `json:"state"`
+}
+
+// CallController controls the calls of phones
+type CallController interface {
+	Calls(address string) ([]Call, error)
+	Dial(address, number string) (*Call, error)
+	Answer(address string) error
+	HangUp(address string) error
+}
+
+// ValidateNumber checks a number before it is dialed
+func ValidateNumber(number string) error {
+	if !phoneNumber.MatchString(number) {
+		return fmt.Errorf("invalid number %q: use digits, *, # and an optional leading +", number)
+	}
+	return nil
+}
+
+// Ofono controls calls through the oFono hands-free modems, one per connected phone
+type Ofono struct{}
+
+// NewOfono creates a call controller using oFono on the system bus
+func NewOfono() *Ofono {
+	return &Ofono{}
+}
+
+// Calls returns the calls of a phone
+func (o *Ofono) Calls(address string) ([]Call, error) {
+	conn, modem, err := o.modem(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []struct {
+		Path       dbus.ObjectPath
+		Properties map[string]dbus.Variant
+	}
+	if err := conn.Object(ofonoService, modem).Call(voiceCallManagerIface+".GetCalls", 0).Store(&objects); err != nil {
+		return nil, fmt.Errorf("failed to get calls: %w", err)
+	}
+
+	calls := make([]Call, 0, len(objects))
+	for _, object := range objects {
+		call := Call{Path: string(object.Path)}
+		call.Number, _ = object.Properties["LineIdentification"].Value().(string)
+		if name, ok := object.Properties["Name"]; ok {
+			call.Name, _ = name.Value().(string)
+		}
+		call.State, _ = object.Properties["State"].Value().(string)
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+// Dial calls a number from a phone
+func (o *Ofono) Dial(address, number string) (*Call, error) {
+	conn, modem, err := o.modem(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var path dbus.ObjectPath
+	// An empty caller ID setting keeps the network default
+	if err := conn.Object(ofonoService, modem).Call(voiceCallManagerIface+".Dial", 0, number, "").Store(&path); err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+	return &Call{Path: string(path), Number: number, State: CallDialing}, nil
+}
+
+// Answer answers the incoming call of a phone
+func (o *Ofono) Answer(address string) error {
+	calls, err := o.Calls(address)
+	if err != nil {
+		return err
+	}
+
+	call, ok := incomingCall(calls)
+	if !ok {
+		return ErrNoIncomingCall
+	}
+
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return ErrUnavailable
+	}
+	if err := conn.Object(ofonoService, dbus.ObjectPath(call.Path)).Call(voiceCallIface+".Answer", 0).Err; err != nil {
+		return fmt.Errorf("failed to answer: %w", err)
+	}
+	return nil
+}
+
+// HangUp ends every call of a phone, including a ringing one
+func (o *Ofono) HangUp(address string) error {
+	conn, modem, err := o.modem(address)
+	if err != nil {
+		return err
+	}
+
+	if err := conn.Object(ofonoService, modem).Call(voiceCallManagerIface+".HangupAll", 0).Err; err != nil {
+		return fmt.Errorf("failed to hang up: %w", err)
+	}
+	return nil
+}
+
+// modem returns the hands-free modem of a phone
+func (o *Ofono) modem(address string) (*dbus.Conn, dbus.ObjectPath, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, "", ErrUnavailable
+	}
+
+	var modems []modem
+	err = conn.Object(ofonoService, "/").Call(ofonoManagerIface+".GetModems", 0).Store(&modems)
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) && dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown" {
+		return nil, "", ErrUnavailable
+	} else if err != nil {
+		return nil, "", fmt.Errorf("failed to get oFono modems: %w", err)
+	}
+
+	path, err := handsFreeModem(modems, address)
+	return conn, path, err
+}
+
+type modem struct {
+	Path       dbus.ObjectPath
+	Properties map[string]dbus.Variant
+}
+
+// handsFreeModem returns the modem oFono created for the hands-free connection of a phone, whose
+// Serial property is the Bluetooth address of the phone
+func handsFreeModem(modems []modem, address string) (dbus.ObjectPath, error) {
+	for _, m := range modems {
+		serial, _ := m.Properties["Serial"].Value().(string)
+		if !strings.EqualFold(serial, address) {
+			continue
+		}
+		interfaces, _ := m.Properties["Interfaces"].Value().([]string)
+		for _, iface := range interfaces {
+			if iface == voiceCallManagerIface {
+				return m.Path, nil
+			}
+		}
+	}
+	return "", ErrNoHandsFree
+}
+
+// incomingCall returns the ringing call, an incoming call first and then a waiting one
+func incomingCall(calls []Call) (Call, bool) {
+	for _, state := range []string{CallIncoming, CallWaiting} {
+		for _, call := range calls {
+			if call.State == state {
+				return call, true
+			}
+		}
+	}
+	return Call{}, false
+}
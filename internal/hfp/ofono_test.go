@@ -0,0 +1,56 @@
+package hfp
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandsFreeModem(t *testing.T) {
+	modems := []modem{
+		{Path: "/phonesim", Properties: map[string]dbus.Variant{
+			"Serial":     dbus.MakeVariant("1234"),
+			"Interfaces": dbus.MakeVariant([]string{voiceCallManagerIface}),
+		}},
+		{Path: "/hfp/org/bluez/hci0/dev_5C_17_CF_11_22_33", Properties: map[string]dbus.Variant{
+			"Serial":     dbus.MakeVariant("5C:17:CF:11:22:33"),
+			"Interfaces": dbus.MakeVariant([]string{"org.ofono.Handsfree", voiceCallManagerIface}),
+		}},
+		{Path: "/hfp/org/bluez/hci0/dev_38_18_4C_12_34_56", Properties: map[string]dbus.Variant{
+			"Serial":     dbus.MakeVariant("38:18:4C:12:34:56"),
+			"Interfaces": dbus.MakeVariant([]string{}),
+		}},
+	}
+
+	path, err := handsFreeModem(modems, "5c:17:cf:11:22:33")
+	assert.NoError(t, err)
+	assert.Equal(t, dbus.ObjectPath("/hfp/org/bluez/hci0/dev_5C_17_CF_11_22_33"), path)
+
+	// A modem still setting up has no voice call manager yet
+	_, err = handsFreeModem(modems, "38:18:4C:12:34:56")
+	assert.ErrorIs(t, err, ErrNoHandsFree)
+
+	_, err = handsFreeModem(modems, "11:22:33:44:55:66")
+	assert.ErrorIs(t, err, ErrNoHandsFree)
+}
+
+func TestIncomingCall(t *testing.T) {
+	call, ok := incomingCall([]Call{
+		{Path: "/voicecall01", State: CallActive},
+		{Path: "/voicecall02", State: CallWaiting},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, "/voicecall02", call.Path)
+
+	_, ok = incomingCall([]Call{{Path: "/voicecall01", State: CallActive}})
+	assert.False(t, ok)
+}
+
+func TestValidateNumber(t *testing.T) {
+	assert.NoError(t, ValidateNumber("+33612345678"))
+	assert.NoError(t, ValidateNumber("*#06#"))
+	assert.Error(t, ValidateNumber(""))
+	assert.Error(t, ValidateNumber("06 12 34 56 78"))
+	assert.Error(t, ValidateNumber("+33+6"))
+}
@@ -0,0 +1,162 @@
+// Package hooks runs the executables of a hook directory on broker events, with the event as JSON on
+// their standard input
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+// queueSize is the number of hook invocations waiting for a free worker before new ones are dropped
+const queueSize = 64
+
+// environment are the variables of the broker environment passed to the hooks. The others may hold
+// credentials, such as ENCRYPTION_KEY or BOOTSTRAP_TOKEN.
+var environment = []string{"PATH", "HOME", "LANG", "TZ"}
+
+// Runner invokes the hooks of each event published on a hub. The hooks of an event type are the
+// executables of the directory named after it, such as device_connected or device_connected.sh.
+type Runner struct {
+	dir         string
+	timeout     time.Duration
+	concurrency int
+	// queue holds the invocations waiting for one of the concurrency workers
+	queue chan invocation
+}
+
+type invocation struct {
+	hook      string
+	eventType string
+	input     []byte
+}
+
+// NewRunner creates a runner of the hooks of a directory, killing the hooks running longer than
+// timeout and running at most concurrency hooks at once
+func NewRunner(dir string, timeout time.Duration, concurrency int) *Runner {
+	return &Runner{
+		dir:         dir,
+		timeout:     timeout,
+		concurrency: concurrency,
+		queue:       make(chan invocation, queueSize),
+	}
+}
+
+// Run invokes the hooks of the published events until the context is cancelled
+func (r *Runner) Run(ctx context.Context, hub *events.Hub) {
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < r.concurrency; i++ {
+		go r.work(ctx)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			hooks := r.Hooks(event.Type)
+			if len(hooks) == 0 {
+				continue
+			}
+			input, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Hooks: failed to encode %s event: %v", event.Type, err)
+				continue
+			}
+			for _, hook := range hooks {
+				// The queue is bounded so that slow hooks cannot pile up events without limit
+				select {
+				case r.queue <- invocation{hook: hook, eventType: event.Type, input: input}:
+				default:
+					log.Printf("Hooks: dropped %s for %s event, %d hooks already waiting", filepath.Base(hook), event.Type, queueSize)
+				}
+			}
+		}
+	}
+}
+
+// work runs the queued hooks one at a time until the context is cancelled
+func (r *Runner) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case inv := <-r.queue:
+			r.invoke(ctx, inv.hook, inv.eventType, inv.input)
+		}
+	}
+}
+
+// Hooks returns the hooks of an event type, sorted by name. The directory is read on every event so
+// that hooks can be added and removed without restarting the broker. Only the executable regular
+// files of the directory itself are run, and not the ones anyone may write.
+func (r *Runner) Hooks(eventType string) []string {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		log.Printf("Hooks: %v", err)
+		return nil
+	}
+
+	var hooks []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if name != eventType && !strings.HasPrefix(name, eventType+".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		if info.Mode().Perm()&0002 != 0 {
+			log.Printf("Hooks: ignoring world-writable hook %s", name)
+			continue
+		}
+		hooks = append(hooks, filepath.Join(r.dir, name))
+	}
+	sort.Strings(hooks)
+	return hooks
+}
+
+// invoke runs a hook with the event on its standard input and logs its output
+func (r *Runner) invoke(ctx context.Context, hook, eventType string, input []byte) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = []string{"BROKER_EVENT_TYPE=" + eventType}
+	for _, name := range environment {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	// A hook leaving a child process behind must not keep the runner waiting for its output
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+
+	name := filepath.Base(hook)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line != "" {
+			log.Printf("Hooks: %s: %s", name, line)
+		}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Printf("Hooks: %s killed after %s on %s event", name, r.timeout, eventType)
+	} else if err != nil {
+		log.Printf("Hooks: %s failed on %s event: %v", name, eventType, err)
+	}
+}
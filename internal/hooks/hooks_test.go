@@ -0,0 +1,94 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunner_Hooks(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{
+		"device_connected":        0755,
+		"device_connected.lights": 0755,
+		"device_connected.txt":    0644,
+		"device_connected.open":   0777,
+		"device_connected_extra":  0755,
+		"battery_low.sh":          0755,
+	} {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"), mode))
+		assert.NoError(t, os.Chmod(path, mode))
+	}
+
+	r := NewRunner(dir, time.Second, 1)
+	assert.Equal(t, []string{filepath.Join(dir, "device_connected"), filepath.Join(dir, "device_connected.lights")}, r.Hooks("device_connected"))
+	assert.Equal(t, []string{filepath.Join(dir, "battery_low.sh")}, r.Hooks("battery_low"))
+	assert.Empty(t, r.Hooks("device_found"))
+}
+
+func TestRunner_Run(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output")
+	// The broker credentials are not passed to the hooks
+	t.Setenv("ENCRYPTION_KEY", "secret")
+	hook := "#!/bin/sh\necho \"$BROKER_EVENT_TYPE$ENCRYPTION_KEY\" > " + output + ".tmp\ncat >> " + output + ".tmp\nmv " + output + ".tmp " + output + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "battery_low.sh"), []byte(hook), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "device_found"), []byte("#!/bin/sh\nexec sleep 10\n"), 0755))
+
+	hub := events.NewHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewRunner(dir, 100*time.Millisecond, 2)
+	go r.Run(ctx, hub)
+	time.Sleep(10 * time.Millisecond)
+
+	// A hook running too long is killed and frees its slot
+	hub.Publish("device_found", nil)
+	hub.Publish("battery_low", map[string]int{"percentage": 10})
+
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(output)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	data, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	eventType, input, _ := bytes.Cut(data, []byte("\n"))
+	assert.Equal(t, "battery_low", string(eventType))
+	var event events.Event
+	assert.NoError(t, json.Unmarshal(input, &event))
+	assert.Equal(t, map[string]interface{}{"percentage": float64(10)}, event.Data)
+
+	assert.Eventually(t, func() bool { return len(r.queue) == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRunner_Queue(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output")
+	hook := "#!/bin/sh\nsleep 0.05\necho \"$BROKER_EVENT_TYPE\" >> " + output + "\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "device_connected"), []byte(hook), 0755))
+
+	hub := events.NewHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewRunner(dir, time.Second, 1)
+	go r.Run(ctx, hub)
+	time.Sleep(10 * time.Millisecond)
+
+	// The events arriving while the hook runs wait for it instead of being skipped
+	for i := 0; i < 3; i++ {
+		hub.Publish("device_connected", nil)
+	}
+
+	assert.Eventually(t, func() bool {
+		data, _ := os.ReadFile(output)
+		return string(data) == "device_connected\ndevice_connected\ndevice_connected\n"
+	}, 5*time.Second, 10*time.Millisecond)
+}
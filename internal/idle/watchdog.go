@@ -0,0 +1,162 @@
+// Package idle disconnects the audio devices staying connected without playing anything, so that
+// headsets left on the desk do not drain their battery or keep the adapter busy
+package idle
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+// EventIdleDisconnected is published when the watchdog disconnects an idle device
+const EventIdleDisconnected = "device_idle_disconnected"
+
+// IdleDisconnect is the payload of an idle disconnection event
+type IdleDisconnect struct {
+	Address        string `json:"address"`
+	Adapter        string `json:"adapter"`
+	TimeoutMinutes int    `json:"timeout_minutes"`
+}
+
+// audioCapabilities are the capabilities of the devices whose activity is the state of their audio stream
+var audioCapabilities = []string{"a2dp_sink", "hfp", "hsp", "le_audio"}
+
+// Watchdog disconnects the connected audio devices whose stream stayed idle longer than their policy
+type Watchdog struct {
+	btManager bluetooth.BluetoothManagerInterface
+	db        database.DatabaseInterface
+	interval  time.Duration
+	now       func() time.Time
+
+	// idleSince is the time each connected device was first seen idle, by address
+	idleSince map[string]time.Time
+}
+
+// NewWatchdog creates a new idle-disconnect watchdog
+func NewWatchdog(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, interval time.Duration) *Watchdog {
+	return &Watchdog{
+		btManager: btManager,
+		db:        db,
+		interval:  interval,
+		now:       time.Now,
+		idleSince: make(map[string]time.Time),
+	}
+}
+
+// Run checks the devices at every interval until the context is cancelled
+func (w *Watchdog) Run(ctx context.Context, hub *events.Hub) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check(hub)
+		}
+	}
+}
+
+// Check disconnects the devices idle for longer than the timeout of their policy. A device whose
+// stream is pending or active restarts its idle time.
+func (w *Watchdog) Check(hub *events.Hub) {
+	policies, err := database.GetIdlePolicies(w.db)
+	if err != nil {
+		log.Printf("Idle watchdog: %v", err)
+		return
+	}
+	if len(policies) == 0 {
+		w.idleSince = make(map[string]time.Time)
+		return
+	}
+
+	adapters, err := w.btManager.GetAdapters()
+	if err != nil {
+		log.Printf("Idle watchdog: failed to get adapters: %v", err)
+		return
+	}
+
+	now := w.now()
+	seen := make(map[string]bool)
+	for _, adapter := range adapters {
+		devices, err := w.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			log.Printf("Idle watchdog: failed to get devices of adapter %s: %v", adapter.Address, err)
+			continue
+		}
+		for _, device := range devices {
+			if !device.Connected || !isAudioDevice(device) {
+				continue
+			}
+			policy := FindPolicy(policies, device)
+			if policy == nil {
+				continue
+			}
+			seen[device.Address] = true
+
+			if device.AudioState == "active" || device.AudioState == "pending" {
+				delete(w.idleSince, device.Address)
+				continue
+			}
+			since, ok := w.idleSince[device.Address]
+			if !ok {
+				w.idleSince[device.Address] = now
+				continue
+			}
+			if now.Sub(since) < time.Duration(policy.TimeoutMinutes)*time.Minute {
+				continue
+			}
+
+			if err := w.btManager.DisconnectDevice(adapter.Path, device.Address); err != nil {
+				log.Printf("Idle watchdog: failed to disconnect %s: %v", device.Address, err)
+				continue
+			}
+			log.Printf("Idle watchdog: disconnected %s, idle for %s", device.Address, now.Sub(since).Round(time.Second))
+			delete(w.idleSince, device.Address)
+			hub.Publish(EventIdleDisconnected, IdleDisconnect{
+				Address:        device.Address,
+				Adapter:        adapter.Address,
+				TimeoutMinutes: policy.TimeoutMinutes,
+			})
+		}
+	}
+
+	for address := range w.idleSince {
+		if !seen[address] {
+			delete(w.idleSince, address)
+		}
+	}
+}
+
+// FindPolicy returns the policy applying to a device: the one of its address, else the one of its
+// class subtype, else the one of its class type
+func FindPolicy(policies []database.IdlePolicy, device bluetooth.Device) *database.IdlePolicy {
+	for _, target := range []string{device.Address, device.Subtype, device.Type} {
+		if target == "" {
+			continue
+		}
+		for i := range policies {
+			if strings.EqualFold(policies[i].Target, target) {
+				return &policies[i]
+			}
+		}
+	}
+	return nil
+}
+
+func isAudioDevice(device bluetooth.Device) bool {
+	for _, capability := range device.Capabilities {
+		for _, audio := range audioCapabilities {
+			if capability == audio {
+				return true
+			}
+		}
+	}
+	return false
+}
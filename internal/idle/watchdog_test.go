@@ -0,0 +1,70 @@
+package idle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindPolicy(t *testing.T) {
+	policies := []database.IdlePolicy{
+		{Target: "audio_video", TimeoutMinutes: 60},
+		{Target: "headphones", TimeoutMinutes: 30},
+		{Target: "AA:BB:CC:DD:EE:FF", TimeoutMinutes: 5},
+	}
+
+	policy := FindPolicy(policies, bluetooth.Device{Address: "aa:bb:cc:dd:ee:ff", Type: "audio_video", Subtype: "headphones"})
+	assert.Equal(t, 5, policy.TimeoutMinutes)
+	policy = FindPolicy(policies, bluetooth.Device{Address: "11:22:33:44:55:66", Type: "audio_video", Subtype: "headphones"})
+	assert.Equal(t, 30, policy.TimeoutMinutes)
+	policy = FindPolicy(policies, bluetooth.Device{Address: "11:22:33:44:55:66", Type: "audio_video", Subtype: "loudspeaker"})
+	assert.Equal(t, 60, policy.TimeoutMinutes)
+	assert.Nil(t, FindPolicy(policies, bluetooth.Device{Address: "11:22:33:44:55:66", Type: "phone"}))
+}
+
+func TestWatchdog_Check(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	for i := 0; i < 3; i++ {
+		dbMock.ExpectQuery("FROM idle_policies").WillReturnRows(sqlmock.NewRows([]string{"target", "timeout_minutes", "updated_at"}).
+			AddRow("headphones", 10, time.Now()))
+	}
+
+	devices := []bluetooth.Device{
+		{Address: "AA:BB:CC:DD:EE:FF", Connected: true, Subtype: "headphones", Capabilities: []string{"a2dp_sink"}, AudioState: "idle"},
+		{Address: "11:22:33:44:55:66", Connected: true, Subtype: "headphones", Capabilities: []string{"a2dp_sink"}, AudioState: "active"},
+		// Input devices report no activity and are never disconnected
+		{Address: "99:88:77:66:55:44", Connected: true, Subtype: "headphones", Capabilities: []string{"hid"}},
+	}
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01"}}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return(devices, nil)
+	btManager.On("DisconnectDevice", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+
+	hub := events.NewHub()
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	w := NewWatchdog(btManager, db, time.Minute)
+	w.now = func() time.Time { return now }
+
+	w.Check(hub)
+	now = now.Add(9 * time.Minute)
+	w.Check(hub)
+	btManager.AssertNotCalled(t, "DisconnectDevice", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF")
+
+	now = now.Add(time.Minute)
+	w.Check(hub)
+	event := <-ch
+	assert.Equal(t, EventIdleDisconnected, event.Type)
+	assert.Equal(t, IdleDisconnect{Address: "AA:BB:CC:DD:EE:FF", Adapter: "00:1A:7D:DA:71:01", TimeoutMinutes: 10}, event.Data)
+	assert.NotContains(t, w.idleSince, "11:22:33:44:55:66")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
@@ -0,0 +1,179 @@
+// Package lockout protects the tokens from being guessed: a client failing to authenticate too
+// many times in a row is refused for a cool-down, doubled at every new lockout
+package lockout
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/audit"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+// EventAuthLockout is published when a client is locked out
+const EventAuthLockout = "auth_lockout"
+
+// LockedOut is the payload of the lockout event
+type LockedOut struct {
+	Username string    `json:"username"`
+	IP       string    `json:"ip"`
+	Failures int       `json:"failures"`
+	Lockouts int       `json:"lockouts"`
+	Until    time.Time `json:"until"`
+}
+
+// key identifies a client: the failures of a username from an address do not lock the same
+// username out from the other addresses
+type key struct {
+	username string
+	ip       string
+}
+
+type entry struct {
+	failures    int
+	lockouts    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// Tracker counts the failed authentications of every client. A nil tracker, or one with a threshold
+// of 0, locks nobody out.
+type Tracker struct {
+	threshold   int
+	duration    time.Duration
+	maxDuration time.Duration
+	hub         *events.Hub
+	auditLogger *audit.Logger
+	now         func() time.Time
+
+	mu      sync.Mutex
+	entries map[key]*entry
+}
+
+// NewTracker creates a tracker locking a client out for duration after threshold failures in a
+// row. Each lockout following the previous one doubles the cool-down, up to maxDuration, until the
+// client authenticates or stays quiet for maxDuration. The lockouts are recorded in the audit trail
+// of auditLogger, when set.
+func NewTracker(threshold int, duration, maxDuration time.Duration, hub *events.Hub, auditLogger *audit.Logger) *Tracker {
+	return &Tracker{
+		threshold:   threshold,
+		duration:    duration,
+		maxDuration: maxDuration,
+		hub:         hub,
+		auditLogger: auditLogger,
+		now:         time.Now,
+		entries:     make(map[key]*entry),
+	}
+}
+
+// Configure changes the threshold and the cool-downs of the next lockouts. A threshold of 0
+// disables the lockouts, releasing the clients locked out.
+func (t *Tracker) Configure(threshold int, duration, maxDuration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.threshold = threshold
+	t.duration = duration
+	t.maxDuration = maxDuration
+	if threshold <= 0 {
+		clear(t.entries)
+	}
+}
+
+// Locked returns how long a client stays locked out, and whether it is
+func (t *Tracker) Locked(username, ip string) (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[key{username, ip}]
+	if !ok {
+		return 0, false
+	}
+	remaining := e.lockedUntil.Sub(t.now())
+	return remaining, remaining > 0
+}
+
+// Fail records a failed authentication and returns how long the client is locked out, when this
+// failure reached the threshold
+func (t *Tracker) Fail(username, ip string) (time.Duration, bool) {
+	if t == nil {
+		return 0, false
+	}
+
+	t.mu.Lock()
+	if t.threshold <= 0 {
+		t.mu.Unlock()
+		return 0, false
+	}
+	now := t.now()
+	t.forget(now)
+	k := key{username, ip}
+	e, ok := t.entries[k]
+	if !ok {
+		e = &entry{}
+		t.entries[k] = e
+	}
+	e.failures++
+	e.lastFailure = now
+	if e.failures < t.threshold {
+		t.mu.Unlock()
+		return 0, false
+	}
+
+	e.lockouts++
+	cooldown := t.cooldown(e.lockouts)
+	e.lockedUntil = now.Add(cooldown)
+	event := LockedOut{Username: username, IP: ip, Failures: e.failures, Lockouts: e.lockouts, Until: e.lockedUntil}
+	e.failures = 0
+	t.mu.Unlock()
+
+	log.Printf("Lockout: %s from %s locked out for %s after %d failed authentications", username, ip, cooldown, event.Failures)
+	t.hub.Publish(EventAuthLockout, event)
+	if t.auditLogger != nil {
+		// Like the refused requests, the lockout is not attributed to the username the client sent
+		t.auditLogger.Record(database.AuditEntry{
+			CreatedAt: now,
+			Actor:     database.AuditActorAnonymous,
+			IP:        ip,
+			Action:    EventAuthLockout,
+			Outcome:   database.AuditOutcomeDenied,
+			Status:    http.StatusTooManyRequests,
+		})
+	}
+	return cooldown, true
+}
+
+// Succeed forgets the failures of a client which authenticated
+func (t *Tracker) Succeed(username, ip string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key{username, ip})
+}
+
+// cooldown returns the duration of the nth lockout in a row
+func (t *Tracker) cooldown(lockouts int) time.Duration {
+	cooldown := t.duration
+	for i := 1; i < lockouts && cooldown < t.maxDuration; i++ {
+		cooldown *= 2
+	}
+	return min(cooldown, t.maxDuration)
+}
+
+// forget drops the clients which stayed quiet for maxDuration since their last failure or lockout,
+// so that the entries of one-off typos do not pile up
+func (t *Tracker) forget(now time.Time) {
+	for k, e := range t.entries {
+		if now.Sub(e.lastFailure) >= t.maxDuration && now.Sub(e.lockedUntil) >= t.maxDuration {
+			delete(t.entries, k)
+		}
+	}
+}
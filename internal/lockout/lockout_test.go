@@ -0,0 +1,129 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/audit"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker_Lockout(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	hub := events.NewHub()
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	tracker := NewTracker(3, time.Minute, 5*time.Minute, hub, nil)
+	tracker.now = func() time.Time { return now }
+
+	for range 2 {
+		_, locked := tracker.Fail("admin", "192.168.1.10")
+		assert.False(t, locked)
+	}
+	cooldown, locked := tracker.Fail("admin", "192.168.1.10")
+	assert.True(t, locked)
+	assert.Equal(t, time.Minute, cooldown)
+
+	event := <-ch
+	assert.Equal(t, EventAuthLockout, event.Type)
+	assert.Equal(t, LockedOut{Username: "admin", IP: "192.168.1.10", Failures: 3, Lockouts: 1, Until: now.Add(time.Minute)}, event.Data)
+
+	remaining, locked := tracker.Locked("admin", "192.168.1.10")
+	assert.True(t, locked)
+	assert.Equal(t, time.Minute, remaining)
+	_, locked = tracker.Locked("admin", "192.168.1.11")
+	assert.False(t, locked, "other addresses must not be locked out")
+
+	// Each lockout in a row doubles the cool-down, up to the maximum
+	for _, expected := range []time.Duration{2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		now = now.Add(cooldown)
+		_, locked = tracker.Locked("admin", "192.168.1.10")
+		assert.False(t, locked)
+		for range 3 {
+			cooldown, locked = tracker.Fail("admin", "192.168.1.10")
+		}
+		assert.True(t, locked)
+		assert.Equal(t, expected, cooldown)
+		<-ch
+	}
+
+	// Authenticating resets the cool-down
+	now = now.Add(cooldown)
+	tracker.Succeed("admin", "192.168.1.10")
+	for range 3 {
+		cooldown, _ = tracker.Fail("admin", "192.168.1.10")
+	}
+	assert.Equal(t, time.Minute, cooldown)
+}
+
+func TestTracker_Audit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	auditLogger := audit.NewLogger(db)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go auditLogger.Run(ctx)
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(2, time.Minute, 5*time.Minute, nil, auditLogger)
+	tracker.now = func() time.Time { return now }
+
+	// Only the lockout is recorded, as an anonymous actor
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(now, "anonymous", "192.168.1.10", "auth_lockout", "", "denied", 429, "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	tracker.Fail("admin", "192.168.1.10")
+	_, locked := tracker.Fail("admin", "192.168.1.10")
+	assert.True(t, locked)
+
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+}
+
+func TestTracker_Forget(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(3, time.Minute, 5*time.Minute, nil, nil)
+	tracker.now = func() time.Time { return now }
+
+	tracker.Fail("admin", "192.168.1.10")
+	tracker.Fail("admin", "192.168.1.10")
+
+	now = now.Add(5 * time.Minute)
+	tracker.Fail("kitchen", "192.168.1.11")
+	assert.Len(t, tracker.entries, 1)
+
+	_, locked := tracker.Fail("admin", "192.168.1.10")
+	assert.False(t, locked, "failures older than the maximum cool-down must be forgotten")
+}
+
+func TestTracker_Configure(t *testing.T) {
+	tracker := NewTracker(0, time.Minute, 5*time.Minute, nil, nil)
+	for range 10 {
+		_, locked := tracker.Fail("admin", "192.168.1.10")
+		assert.False(t, locked, "a threshold of 0 locks nobody out")
+	}
+
+	tracker.Configure(2, 2*time.Minute, 5*time.Minute)
+	tracker.Fail("admin", "192.168.1.10")
+	cooldown, locked := tracker.Fail("admin", "192.168.1.10")
+	assert.True(t, locked)
+	assert.Equal(t, 2*time.Minute, cooldown)
+
+	// Disabling the lockouts releases the clients locked out
+	tracker.Configure(0, time.Minute, 5*time.Minute)
+	_, locked = tracker.Locked("admin", "192.168.1.10")
+	assert.False(t, locked)
+}
+
+func TestTracker_Nil(t *testing.T) {
+	var tracker *Tracker
+	_, locked := tracker.Fail("admin", "192.168.1.10")
+	assert.False(t, locked)
+	_, locked = tracker.Locked("admin", "192.168.1.10")
+	assert.False(t, locked)
+	tracker.Succeed("admin", "192.168.1.10")
+}
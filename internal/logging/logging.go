@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Log outputs
+const (
+	OutputStderr   = "stderr"
+	OutputJournald = "journald"
+	OutputSyslog   = "syslog"
+)
+
+// JournalSocket is the native protocol socket of systemd-journald
+var JournalSocket = "/run/systemd/journal/socket"
+
+// Priority guesses the syslog priority of a log line from its wording, since the broker logs
+// through the standard logger without levels
+func Priority(message string) syslog.Priority {
+	lower := strings.ToLower(message)
+	switch {
+	case strings.Contains(lower, "warning"):
+		return syslog.LOG_WARNING
+	case strings.Contains(lower, "failed"), strings.Contains(lower, "error"), strings.Contains(lower, "invalid"):
+		return syslog.LOG_ERR
+	}
+	return syslog.LOG_INFO
+}
+
+// NewWriter returns the writer of a log output. For syslog, address is empty for the local daemon
+// or a URL such as udp://host:514 or tcp://host:601 for a remote one.
+func NewWriter(output, address, tag string) (io.Writer, error) {
+	switch output {
+	case "", OutputStderr:
+		return os.Stderr, nil
+	case OutputJournald:
+		conn, err := net.Dial("unixgram", JournalSocket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to journald: %w", err)
+		}
+		return &journaldWriter{conn: conn, tag: tag}, nil
+	case OutputSyslog:
+		var network, raddr string
+		if address != "" {
+			u, err := url.Parse(address)
+			if err != nil || u.Host == "" || (u.Scheme != "udp" && u.Scheme != "tcp") {
+				return nil, fmt.Errorf("invalid syslog address %q: must be udp://host:port or tcp://host:port", address)
+			}
+			network, raddr = u.Scheme, u.Host
+		}
+		w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		return &syslogWriter{w: w}, nil
+	}
+	return nil, fmt.Errorf("unknown log output %q: must be stderr, journald or syslog", output)
+}
+
+// journaldWriter sends each log line as a journal entry with its priority
+type journaldWriter struct {
+	conn net.Conn
+	tag  string
+}
+
+func (w *journaldWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+	entry := encodeJournalEntry(map[string]string{
+		"MESSAGE":           message,
+		"PRIORITY":          fmt.Sprintf("%d", Priority(message)),
+		"SYSLOG_IDENTIFIER": w.tag,
+	})
+	if _, err := w.conn.Write(entry); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// encodeJournalEntry encodes fields with the journald native protocol. Values containing
+// a newline are length-prefixed.
+func encodeJournalEntry(fields map[string]string) []byte {
+	var buf bytes.Buffer
+	for _, name := range []string{"PRIORITY", "SYSLOG_IDENTIFIER", "MESSAGE"} {
+		value, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if !strings.Contains(value, "\n") {
+			fmt.Fprintf(&buf, "%s=%s\n", name, value)
+			continue
+		}
+		buf.WriteString(name + "\n")
+		binary.Write(&buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value + "\n")
+	}
+	return buf.Bytes()
+}
+
+// syslogWriter sends each log line with its priority
+type syslogWriter struct {
+	w *syslog.Writer
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+
+	var err error
+	switch Priority(message) {
+	case syslog.LOG_ERR:
+		err = w.w.Err(message)
+	case syslog.LOG_WARNING:
+		err = w.w.Warning(message)
+	default:
+		err = w.w.Info(message)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
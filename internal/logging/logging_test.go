@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"log/syslog"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriority(t *testing.T) {
+	assert.Equal(t, syslog.LOG_WARNING, Priority("Warning: Failed to setup WirePlumber configuration"))
+	assert.Equal(t, syslog.LOG_ERR, Priority("RSSI Recorder: failed to list adapters"))
+	assert.Equal(t, syslog.LOG_INFO, Priority("Starting server on port 8080"))
+}
+
+func TestJournaldWriter(t *testing.T) {
+	JournalSocket = filepath.Join(t.TempDir(), "journal.socket")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: JournalSocket, Net: "unixgram"})
+	assert.NoError(t, err)
+	defer server.Close()
+
+	w, err := NewWriter(OutputJournald, "", "home-bt-broker")
+	assert.NoError(t, err)
+
+	_, err = w.Write([]byte("Failed to list adapters\n"))
+	assert.NoError(t, err)
+
+	buf := make([]byte, 1024)
+	n, err := server.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "PRIORITY=3\nSYSLOG_IDENTIFIER=home-bt-broker\nMESSAGE=Failed to list adapters\n", string(buf[:n]))
+}
+
+func TestEncodeJournalEntry_Multiline(t *testing.T) {
+	entry := encodeJournalEntry(map[string]string{"MESSAGE": "a\nb"})
+	assert.Equal(t, "MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n", string(entry))
+}
+
+func TestNewWriter_Invalid(t *testing.T) {
+	_, err := NewWriter("file", "", "home-bt-broker")
+	assert.Error(t, err)
+
+	_, err = NewWriter(OutputSyslog, "host:514", "home-bt-broker")
+	assert.Error(t, err)
+}
+
+func TestRing(t *testing.T) {
+	r := NewRing(2)
+	_, _ = r.Write([]byte("first\nsecond\nthi"))
+	assert.Equal(t, []string{"first", "second"}, r.Lines())
+	_, _ = r.Write([]byte("rd\n"))
+	assert.Equal(t, []string{"second", "third"}, r.Lines())
+}
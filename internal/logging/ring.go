@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ring is a writer keeping the last lines written to it, so that the recent logs can be attached to
+// the diagnostics whatever the log output
+type Ring struct {
+	// Timestamps prefixes the lines with the time they were written at, for the log outputs
+	// timestamping entries themselves, whose lines have no time
+	Timestamps bool
+
+	mu    sync.Mutex
+	size  int
+	lines []string
+	// partial is the end of the last write, waiting for its newline
+	partial string
+}
+
+// NewRing creates a writer keeping the last size lines
+func NewRing(size int) *Ring {
+	return &Ring{size: size}
+}
+
+// Write adds the complete lines of p
+func (r *Ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	text := r.partial + string(p)
+	lines := strings.Split(text, "\n")
+	r.partial = lines[len(lines)-1]
+	for _, line := range lines[:len(lines)-1] {
+		if r.Timestamps {
+			line = time.Now().Format(time.RFC3339) + " " + line
+		}
+		if len(r.lines) == r.size {
+			r.lines = append(r.lines[:0], r.lines[1:]...)
+		}
+		r.lines = append(r.lines, line)
+	}
+	return len(p), nil
+}
+
+// Lines returns the kept lines, oldest first
+func (r *Ring) Lines() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string{}, r.lines...)
+}
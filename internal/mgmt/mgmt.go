@@ -0,0 +1,417 @@
+// Package mgmt talks to the kernel Bluetooth stack through the management socket and the raw HCI
+// socket of a controller. BlueZ only reports the RSSI of devices while discovering, the kernel
+// reports it for connected devices along with their transmit power and link quality. The management
+// socket also lists and powers the controllers when bluetoothd is not running. Both sockets require
+// the CAP_NET_ADMIN and CAP_NET_RAW capabilities.
+package mgmt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Address types of the management interface
+const (
+	AddressBREDR    = 0
+	AddressLEPublic = 1
+	AddressLERandom = 2
+)
+
+// Management commands, events and statuses, see doc/mgmt-api.txt in the BlueZ sources
+const (
+	hciDevNone = 0xffff
+
+	opReadIndexList      = 0x0003
+	opReadControllerInfo = 0x0004
+	opSetPowered         = 0x0005
+	opGetConnInfo        = 0x0031
+
+	evCmdComplete = 0x0001
+	evCmdStatus   = 0x0002
+
+	statusNotConnected = 0x02
+
+	settingPowered      = 1 << 0
+	settingDiscoverable = 1 << 3
+	settingBondable     = 1 << 4
+	settingBREDR        = 1 << 7
+	settingLE           = 1 << 9
+
+	// invalidValue is returned for the RSSI and transmit powers the controller could not read
+	invalidValue = 127
+
+	headerSize = 6
+)
+
+// HCI packets and commands used to read the link quality, see the Bluetooth Core specification
+const (
+	hciCommandPkt = 0x01
+	hciEventPkt   = 0x04
+
+	hciEvCmdComplete = 0x0e
+	hciEvCmdStatus   = 0x0f
+
+	// opReadLinkQuality is the Read Link Quality command, OGF 0x05 (status parameters) and OCF 0x0003
+	opReadLinkQuality = 0x05<<10 | 0x0003
+
+	hciFilter = 2
+	aclLink   = 1
+
+	// hciGetConnInfo is the HCIGETCONNINFO ioctl, _IOR('H', 213, int)
+	hciGetConnInfo = 2<<30 | 4<<16 | 'H'<<8 | 213
+)
+
+// timeout bounds the wait for the answer of the kernel or the controller
+const timeout = 2 * time.Second
+
+// ErrNotConnected is returned when the kernel has no connection to the device
+var ErrNotConnected = errors.New("device is not connected")
+
+// ConnInfo is the state of the connection to a device. Values the controller cannot read are omitted.
+type ConnInfo struct {
+	// RSSI is the received signal strength, in dBm
+	RSSI *int8 `json:"rssi,omitempty"`
+	// TxPower and MaxTxPower are the current and maximum transmit power of the controller, in dBm
+	TxPower    *int8 `json:"tx_power,omitempty"`
+	MaxTxPower *int8 `json:"max_tx_power,omitempty"`
+	// LinkQuality is the vendor-specific quality of a BR/EDR link, from 0 to 255
+	LinkQuality *uint8 `json:"link_quality,omitempty"`
+}
+
+// Controller is a Bluetooth controller known to the kernel
+type Controller struct {
+	Index        uint16
+	Address      string
+	Name         string
+	Powered      bool
+	Discoverable bool
+	// Bondable is set when new devices may pair
+	Bondable bool
+	// BREDR and LE report the transports the controller supports
+	BREDR bool
+	LE    bool
+}
+
+// GetConnInfo reads the RSSI and transmit powers of the connection between a controller, by index,
+// and a device
+func GetConnInfo(index uint16, address string, addressType uint8) (*ConnInfo, error) {
+	bdaddr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	status, data, err := command(opGetConnInfo, index, append(bdaddr[:], addressType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection info: %w", err)
+	}
+	return decodeConnInfo(status, data)
+}
+
+// Controllers returns the controllers registered in the kernel
+func Controllers() ([]Controller, error) {
+	status, data, err := command(opReadIndexList, hciDevNone, nil)
+	if err == nil && status != 0 {
+		err = statusError(status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list controllers: %w", err)
+	}
+
+	controllers := []Controller{}
+	for _, index := range decodeIndexList(data) {
+		controller, err := ReadController(index)
+		if err != nil {
+			return nil, err
+		}
+		controllers = append(controllers, *controller)
+	}
+	return controllers, nil
+}
+
+// ReadController returns the address, name and state of a controller
+func ReadController(index uint16) (*Controller, error) {
+	status, data, err := command(opReadControllerInfo, index, nil)
+	if err == nil && status != 0 {
+		err = statusError(status)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read controller %d: %w", index, err)
+	}
+	return decodeController(index, data)
+}
+
+// SetPowered powers a controller on or off
+func SetPowered(index uint16, powered bool) error {
+	var param byte
+	if powered {
+		param = 1
+	}
+	status, _, err := command(opSetPowered, index, []byte{param})
+	if err == nil && status != 0 {
+		err = statusError(status)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set controller %d power: %w", index, err)
+	}
+	return nil
+}
+
+// command sends a management command and waits for its reply
+func command(opcode, index uint16, params []byte) (status uint8, data []byte, err error) {
+	fd, err := openSocket(hciDevNone, unix.HCI_CHANNEL_CONTROL)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open management socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if _, err := unix.Write(fd, encodeCommand(opcode, index, params)); err != nil {
+		return 0, nil, fmt.Errorf("failed to send command: %w", err)
+	}
+
+	buf := make([]byte, 1024)
+	for {
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read reply: %w", err)
+		}
+		status, data, ok := parseCommandReply(buf[:n], opcode, index)
+		if !ok {
+			// Other management events are broadcast to every socket
+			continue
+		}
+		return status, data, nil
+	}
+}
+
+func statusError(status uint8) error {
+	return fmt.Errorf("management status 0x%02x", status)
+}
+
+// ReadLinkQuality reads the quality of the BR/EDR link between a controller, by index, and a device
+func ReadLinkQuality(index uint16, address string) (uint8, error) {
+	bdaddr, err := parseAddress(address)
+	if err != nil {
+		return 0, err
+	}
+
+	fd, err := openSocket(index, unix.HCI_CHANNEL_RAW)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open HCI socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	handle, err := connectionHandle(fd, bdaddr)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := unix.SetsockoptString(fd, unix.SOL_HCI, hciFilter, string(eventFilter(opReadLinkQuality))); err != nil {
+		return 0, fmt.Errorf("failed to set HCI filter: %w", err)
+	}
+
+	cmd := []byte{hciCommandPkt, 0, 0, 2, 0, 0}
+	binary.LittleEndian.PutUint16(cmd[1:3], opReadLinkQuality)
+	binary.LittleEndian.PutUint16(cmd[4:6], handle)
+	if _, err := unix.Write(fd, cmd); err != nil {
+		return 0, fmt.Errorf("failed to send link quality command: %w", err)
+	}
+
+	buf := make([]byte, 260)
+	for {
+		n, err := unix.Read(fd, buf)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read link quality: %w", err)
+		}
+		quality, done, err := parseLinkQuality(buf[:n])
+		if done {
+			return quality, err
+		}
+	}
+}
+
+// openSocket opens a Bluetooth socket bound to a channel of a controller, with a read timeout
+func openSocket(index uint16, channel uint16) (int, error) {
+	fd, err := unix.Socket(unix.AF_BLUETOOTH, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.BTPROTO_HCI)
+	if err != nil {
+		return -1, err
+	}
+	if err := unix.Bind(fd, &unix.SockaddrHCI{Dev: index, Channel: channel}); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	tv := unix.NsecToTimeval(timeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		unix.Close(fd)
+		return -1, err
+	}
+	return fd, nil
+}
+
+// connectionHandle returns the handle of the ACL connection to a device
+func connectionHandle(fd int, bdaddr [6]byte) (uint16, error) {
+	// struct hci_conn_info_req followed by its struct hci_conn_info, aligned on 4 bytes
+	var req [24]byte
+	copy(req[0:6], bdaddr[:])
+	req[6] = aclLink
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), hciGetConnInfo, uintptr(unsafe.Pointer(&req[0]))); errno != 0 {
+		if errno == unix.ENOENT {
+			return 0, ErrNotConnected
+		}
+		return 0, fmt.Errorf("failed to get connection handle: %w", errno)
+	}
+	return binary.NativeEndian.Uint16(req[8:10]), nil
+}
+
+// parseAddress converts a device address to its little-endian wire format
+func parseAddress(address string) ([6]byte, error) {
+	var bdaddr [6]byte
+	hw, err := net.ParseMAC(address)
+	if err != nil || len(hw) != 6 {
+		return bdaddr, fmt.Errorf("invalid device address %q", address)
+	}
+	for i := range bdaddr {
+		bdaddr[i] = hw[5-i]
+	}
+	return bdaddr, nil
+}
+
+// encodeCommand builds a management command packet
+func encodeCommand(opcode, index uint16, params []byte) []byte {
+	buf := make([]byte, headerSize+len(params))
+	binary.LittleEndian.PutUint16(buf[0:2], opcode)
+	binary.LittleEndian.PutUint16(buf[2:4], index)
+	binary.LittleEndian.PutUint16(buf[4:6], uint16(len(params)))
+	copy(buf[headerSize:], params)
+	return buf
+}
+
+// parseCommandReply returns the status and return parameters of the reply to a command, ok is false
+// for the events answering something else
+func parseCommandReply(packet []byte, opcode, index uint16) (status uint8, data []byte, ok bool) {
+	if len(packet) < headerSize+3 {
+		return 0, nil, false
+	}
+	event := binary.LittleEndian.Uint16(packet[0:2])
+	if (event != evCmdComplete && event != evCmdStatus) || binary.LittleEndian.Uint16(packet[2:4]) != index {
+		return 0, nil, false
+	}
+	if binary.LittleEndian.Uint16(packet[headerSize:headerSize+2]) != opcode {
+		return 0, nil, false
+	}
+	return packet[headerSize+2], packet[headerSize+3:], true
+}
+
+// decodeConnInfo decodes the return parameters of Get Connection Information: the device address and
+// type, then the RSSI, transmit power and maximum transmit power
+func decodeConnInfo(status uint8, data []byte) (*ConnInfo, error) {
+	switch {
+	case status == statusNotConnected:
+		return nil, ErrNotConnected
+	case status != 0:
+		return nil, fmt.Errorf("failed to get connection info: management status 0x%02x", status)
+	case len(data) < 10:
+		return nil, fmt.Errorf("failed to get connection info: truncated reply")
+	}
+
+	info := &ConnInfo{}
+	info.RSSI = validValue(data[7])
+	info.TxPower = validValue(data[8])
+	info.MaxTxPower = validValue(data[9])
+	return info, nil
+}
+
+// decodeIndexList decodes the reply to Read Controller Index List: a count followed by the indexes
+func decodeIndexList(data []byte) []uint16 {
+	if len(data) < 2 {
+		return nil
+	}
+	count := int(binary.LittleEndian.Uint16(data[0:2]))
+	indexes := make([]uint16, 0, count)
+	for i := 0; i < count && 4+2*i <= len(data); i++ {
+		indexes = append(indexes, binary.LittleEndian.Uint16(data[2+2*i:4+2*i]))
+	}
+	return indexes
+}
+
+// decodeController decodes the reply to Read Controller Information: the address, version,
+// manufacturer, supported and current settings, class of device, then the NUL-terminated name
+func decodeController(index uint16, data []byte) (*Controller, error) {
+	if len(data) < 20 {
+		return nil, fmt.Errorf("failed to read controller %d: truncated reply", index)
+	}
+
+	var hw net.HardwareAddr = make([]byte, 6)
+	for i := range hw {
+		hw[i] = data[5-i]
+	}
+	supported := binary.LittleEndian.Uint32(data[9:13])
+	settings := binary.LittleEndian.Uint32(data[13:17])
+	name := data[20:]
+	if end := bytes.IndexByte(name, 0); end >= 0 {
+		name = name[:end]
+	}
+
+	return &Controller{
+		Index:        index,
+		Address:      strings.ToUpper(hw.String()),
+		Name:         string(name),
+		Powered:      settings&settingPowered != 0,
+		Discoverable: settings&settingDiscoverable != 0,
+		Bondable:     settings&settingBondable != 0,
+		BREDR:        supported&settingBREDR != 0,
+		LE:           supported&settingLE != 0,
+	}, nil
+}
+
+func validValue(b byte) *int8 {
+	if b == invalidValue {
+		return nil
+	}
+	v := int8(b)
+	return &v
+}
+
+// eventFilter builds the struct hci_filter letting only the replies to a command through
+func eventFilter(opcode uint16) []byte {
+	filter := make([]byte, 16)
+	binary.NativeEndian.PutUint32(filter[0:4], 1<<hciEventPkt)
+	binary.NativeEndian.PutUint32(filter[4:8], 1<<hciEvCmdComplete|1<<hciEvCmdStatus)
+	binary.NativeEndian.PutUint16(filter[12:14], opcode)
+	return filter
+}
+
+// parseLinkQuality decodes the reply to Read Link Quality, done is false for other packets
+func parseLinkQuality(packet []byte) (quality uint8, done bool, err error) {
+	if len(packet) < 3 || packet[0] != hciEventPkt {
+		return 0, false, nil
+	}
+	params := packet[3:]
+	switch packet[1] {
+	case hciEvCmdStatus:
+		// A status event only answers a command which failed, or completes later
+		if len(params) < 4 || binary.LittleEndian.Uint16(params[2:4]) != opReadLinkQuality || params[0] == 0 {
+			return 0, false, nil
+		}
+		return 0, true, fmt.Errorf("failed to read link quality: HCI status 0x%02x", params[0])
+	case hciEvCmdComplete:
+		if len(params) < 3 || binary.LittleEndian.Uint16(params[1:3]) != opReadLinkQuality {
+			return 0, false, nil
+		}
+		if len(params) < 7 {
+			return 0, true, fmt.Errorf("failed to read link quality: truncated reply")
+		}
+		if params[3] != 0 {
+			return 0, true, fmt.Errorf("failed to read link quality: HCI status 0x%02x", params[3])
+		}
+		return params[6], true, nil
+	}
+	return 0, false, nil
+}
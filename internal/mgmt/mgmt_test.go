@@ -0,0 +1,85 @@
+package mgmt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAddress(t *testing.T) {
+	bdaddr, err := parseAddress("AA:BB:CC:DD:EE:01")
+	assert.NoError(t, err)
+	assert.Equal(t, [6]byte{0x01, 0xee, 0xdd, 0xcc, 0xbb, 0xaa}, bdaddr)
+
+	_, err = parseAddress("AA:BB:CC")
+	assert.Error(t, err)
+}
+
+func TestEncodeCommand(t *testing.T) {
+	assert.Equal(t, []byte{0x31, 0x00, 0x01, 0x00, 0x02, 0x00, 0xaa, 0x01}, encodeCommand(opGetConnInfo, 1, []byte{0xaa, 0x01}))
+}
+
+func TestParseCommandReply(t *testing.T) {
+	reply := []byte{
+		0x01, 0x00, 0x00, 0x00, 0x0d, 0x00, // command complete on hci0
+		0x31, 0x00, 0x00, // opcode and status
+		0x01, 0xee, 0xdd, 0xcc, 0xbb, 0xaa, 0x00, // address and type
+		0xc4, 0x04, 0x7f, // RSSI -60, TX power 4, unknown max TX power
+	}
+	status, data, ok := parseCommandReply(reply, opGetConnInfo, 0)
+	assert.True(t, ok)
+
+	info, err := decodeConnInfo(status, data)
+	assert.NoError(t, err)
+	assert.Equal(t, int8(-60), *info.RSSI)
+	assert.Equal(t, int8(4), *info.TxPower)
+	assert.Nil(t, info.MaxTxPower)
+
+	// Replies to other controllers or commands are skipped
+	_, _, ok = parseCommandReply(reply, opGetConnInfo, 1)
+	assert.False(t, ok)
+	_, _, ok = parseCommandReply(reply, 0x0004, 0)
+	assert.False(t, ok)
+
+	_, err = decodeConnInfo(statusNotConnected, data)
+	assert.ErrorIs(t, err, ErrNotConnected)
+}
+
+func TestParseLinkQuality(t *testing.T) {
+	quality, done, err := parseLinkQuality([]byte{hciEventPkt, hciEvCmdComplete, 0x07, 0x01, 0x03, 0x14, 0x00, 0x2a, 0x00, 0xe6})
+	assert.True(t, done)
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(230), quality)
+
+	_, done, err = parseLinkQuality([]byte{hciEventPkt, hciEvCmdStatus, 0x04, 0x02, 0x01, 0x03, 0x14})
+	assert.True(t, done)
+	assert.Error(t, err)
+
+	_, done, _ = parseLinkQuality([]byte{hciEventPkt, hciEvCmdComplete, 0x04, 0x01, 0x05, 0x14, 0x00})
+	assert.False(t, done)
+}
+
+func TestDecodeIndexList(t *testing.T) {
+	assert.Equal(t, []uint16{0, 2}, decodeIndexList([]byte{0x02, 0x00, 0x00, 0x00, 0x02, 0x00}))
+	// A truncated list keeps the complete indexes
+	assert.Equal(t, []uint16{0}, decodeIndexList([]byte{0x02, 0x00, 0x00, 0x00, 0x02}))
+	assert.Nil(t, decodeIndexList(nil))
+}
+
+func TestDecodeController(t *testing.T) {
+	data := []byte{
+		0x01, 0x71, 0xda, 0x7d, 0x1a, 0x00, // address
+		0x0b, 0x02, 0x00, // version and manufacturer
+		0xff, 0x00, 0x00, 0x00, // supported settings: BR/EDR without LE
+		0x19, 0x00, 0x00, 0x00, // current settings: powered, discoverable and bondable
+		0x0c, 0x01, 0x1c, // class of device
+	}
+	data = append(data, []byte("broker\x00\x00")...)
+
+	controller, err := decodeController(1, data)
+	assert.NoError(t, err)
+	assert.Equal(t, &Controller{Index: 1, Address: "00:1A:7D:DA:71:01", Name: "broker", Powered: true, Discoverable: true, Bondable: true, BREDR: true}, controller)
+
+	_, err = decodeController(1, data[:10])
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+const (
+	keepAlive      = 60 * time.Second
+	maxRetryDelay  = time.Minute
+	startRetryWait = time.Second
+)
+
+// RetainedState is implemented by event payloads that also update a retained state topic,
+// such as the home/away state of a presence device
+type RetainedState interface {
+	RetainedTopic() string
+	RetainedPayload() []byte
+}
+
+// Bridge publishes every event of a hub to an MQTT broker under <prefix>/events/<type>
+type Bridge struct {
+	url    string
+	prefix string
+
+	// retained holds the last retained payload of each topic, republished after a reconnection
+	retained map[string][]byte
+}
+
+// NewBridge creates a new MQTT bridge
+func NewBridge(url, prefix string) *Bridge {
+	return &Bridge{
+		url:      url,
+		prefix:   strings.TrimSuffix(prefix, "/"),
+		retained: make(map[string][]byte),
+	}
+}
+
+// Run forwards events from the hub until the context is cancelled, reconnecting with backoff
+func (b *Bridge) Run(ctx context.Context, hub *events.Hub) {
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	hostname, _ := os.Hostname()
+	clientID := "home-bt-broker-" + hostname
+
+	delay := startRetryWait
+	for {
+		client, err := Dial(ctx, b.url, clientID, keepAlive)
+		if err != nil {
+			log.Printf("MQTT Bridge: %v, retrying in %s", err, delay)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			delay = min(delay*2, maxRetryDelay)
+			continue
+		}
+
+		log.Printf("MQTT Bridge: connected")
+		delay = startRetryWait
+
+		err = b.forward(ctx, client, ch)
+		client.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("MQTT Bridge: connection lost: %v", err)
+	}
+}
+
+// forward publishes events on a connected client until the connection or the context ends
+func (b *Bridge) forward(ctx context.Context, client *Client, ch <-chan events.Event) error {
+	for topic, payload := range b.retained {
+		if err := client.Publish(topic, payload, true); err != nil {
+			return err
+		}
+	}
+
+	ping := time.NewTicker(keepAlive / 2)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-client.Done():
+			return client.Err()
+		case <-ping.C:
+			if err := client.Ping(); err != nil {
+				return err
+			}
+		case event, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			if err := b.publish(client, event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// publish sends an event and, if it carries a retained state, updates its state topic
+func (b *Bridge) publish(client *Client, event events.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("MQTT Bridge: failed to encode %s event: %v", event.Type, err)
+		return nil
+	}
+	if err := client.Publish(b.prefix+"/events/"+event.Type, payload, false); err != nil {
+		return err
+	}
+
+	if state, ok := event.Data.(RetainedState); ok {
+		topic := b.prefix + "/" + state.RetainedTopic()
+		b.retained[topic] = state.RetainedPayload()
+		if err := client.Publish(topic, b.retained[topic], true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// Package msgpack encodes the values decoded from JSON into MessagePack, a compact binary format
+// suited to constrained clients such as microcontrollers. Only encoding is supported.
+package msgpack
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Marshal encodes a value made of nil, booleans, numbers, strings, []interface{} and
+// map[string]interface{}, as produced by encoding/json. Map keys are sorted so that the output
+// is stable.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf []byte
+	return appendValue(buf, v)
+}
+
+func appendValue(buf []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if v {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendInt(buf, i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("msgpack: invalid number %q", v)
+		}
+		return appendFloat(buf, f), nil
+	case int:
+		return appendInt(buf, int64(v)), nil
+	case int64:
+		return appendInt(buf, v), nil
+	case float64:
+		return appendFloat(buf, v), nil
+	case string:
+		return appendString(buf, v), nil
+	case []interface{}:
+		buf = appendHeader(buf, len(v), 0x90, 0xdc, 0xdd)
+		for _, item := range v {
+			var err error
+			if buf, err = appendValue(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf = appendHeader(buf, len(v), 0x80, 0xde, 0xdf)
+		for _, key := range keys {
+			buf = appendString(buf, key)
+			var err error
+			if buf, err = appendValue(buf, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+}
+
+// appendInt encodes an integer in its smallest form
+func appendInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(buf, byte(i))
+	case i >= -32 && i < 0:
+		return append(buf, byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		return append(buf, 0xcc, byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(i))
+	case i >= 0 && i <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(i))
+	case i >= 0:
+		return binary.BigEndian.AppendUint64(append(buf, 0xcf), uint64(i))
+	case i >= math.MinInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(i))
+	case i >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(i))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(i))
+	}
+}
+
+func appendFloat(buf []byte, f float64) []byte {
+	return binary.BigEndian.AppendUint64(append(buf, 0xcb), math.Float64bits(f))
+}
+
+func appendString(buf []byte, s string) []byte {
+	if len(s) <= math.MaxUint8 && len(s) > 31 {
+		buf = append(buf, 0xd9, byte(len(s)))
+	} else {
+		buf = appendHeader(buf, len(s), 0xa0, 0xda, 0xdb)
+	}
+	return append(buf, s...)
+}
+
+// appendHeader encodes the length of a string, array or map: in the fix prefix up to 15 items
+// (31 bytes for strings), then in 16 or 32 bits
+func appendHeader(buf []byte, n int, fix, b16, b32 byte) []byte {
+	fixMax := 15
+	if fix == 0xa0 {
+		fixMax = 31
+	}
+	switch {
+	case n <= fixMax:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, b16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(buf, b32), uint32(n))
+	}
+}
@@ -0,0 +1,55 @@
+package msgpack
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected []byte
+	}{
+		{"nil", nil, []byte{0xc0}},
+		{"true", true, []byte{0xc3}},
+		{"positive fixint", json.Number("7"), []byte{0x07}},
+		{"negative fixint", json.Number("-1"), []byte{0xff}},
+		{"uint8", json.Number("200"), []byte{0xcc, 0xc8}},
+		{"uint16", json.Number("1000"), []byte{0xcd, 0x03, 0xe8}},
+		{"int8", json.Number("-100"), []byte{0xd0, 0x9c}},
+		{"int32", json.Number("-100000"), []byte{0xd2, 0xff, 0xfe, 0x79, 0x60}},
+		{"float", json.Number("0.5"), []byte{0xcb, 0x3f, 0xe0, 0, 0, 0, 0, 0, 0}},
+		{"fixstr", "abc", []byte{0xa3, 'a', 'b', 'c'}},
+		{"array", []interface{}{json.Number("1"), "a"}, []byte{0x92, 0x01, 0xa1, 'a'}},
+		{"sorted map", map[string]interface{}{"b": false, "a": nil}, []byte{0x82, 0xa1, 'a', 0xc0, 0xa1, 'b', 0xc2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Marshal(tt.value)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, data)
+		})
+	}
+}
+
+func TestMarshal_Lengths(t *testing.T) {
+	data, err := Marshal(strings.Repeat("x", 40))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xd9, 40}, data[:2])
+
+	data, err = Marshal(strings.Repeat("x", 300))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xda, 0x01, 0x2c}, data[:3])
+
+	data, err = Marshal(make([]interface{}, 16))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xdc, 0x00, 0x10}, data[:3])
+
+	_, err = Marshal(struct{}{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,149 @@
+// Package notify sends push notifications for broker events through ntfy, Pushover or Web Push
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/battery"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth/signals"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/lockout"
+)
+
+// Notification priorities, mapped to the scale of each provider
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// DefaultEvents are the events notified when none are configured
+var DefaultEvents = []string{bluetooth.EventPairingRequested, battery.EventBatteryLow}
+
+// Notification is a message pushed to a phone
+type Notification struct {
+	Title    string
+	Message  string
+	Priority int
+}
+
+// Notifier delivers notifications through a push provider
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Alerter notifies a selection of the events published on a hub
+type Alerter struct {
+	mu        sync.RWMutex
+	notifiers []Notifier
+	events    map[string]bool
+}
+
+// NewAlerter creates an alerter sending the given event types to every notifier
+func NewAlerter(notifiers []Notifier, eventTypes []string) *Alerter {
+	a := &Alerter{}
+	a.Update(notifiers, eventTypes)
+	return a
+}
+
+// Update replaces the notifiers and the notified event types, e.g. when the configuration is reloaded
+func (a *Alerter) Update(notifiers []Notifier, eventTypes []string) {
+	events := make(map[string]bool)
+	for _, eventType := range eventTypes {
+		events[eventType] = true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.notifiers = notifiers
+	a.events = events
+}
+
+// selection returns the notifiers of an event type, none when it is not notified
+func (a *Alerter) selection(eventType string) []Notifier {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if !a.events[eventType] {
+		return nil
+	}
+	return a.notifiers
+}
+
+// Run notifies the selected events until the context is cancelled
+func (a *Alerter) Run(ctx context.Context, hub *events.Hub) {
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			notifiers := a.selection(event.Type)
+			if len(notifiers) == 0 {
+				continue
+			}
+
+			n := Format(event)
+			for _, notifier := range notifiers {
+				sendCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				if err := notifier.Notify(sendCtx, n); err != nil {
+					log.Printf("Notify: failed to send %s notification: %v", event.Type, err)
+				}
+				cancel()
+			}
+		}
+	}
+}
+
+// Format builds the notification of an event
+func Format(event events.Event) Notification {
+	switch data := event.Data.(type) {
+	case bluetooth.PairingRequest:
+		n := Notification{
+			Title:    "Pairing request",
+			Message:  fmt.Sprintf("%s asks for %s", data.Address, data.Type),
+			Priority: PriorityHigh,
+		}
+		if data.Passkey != nil {
+			n.Message += fmt.Sprintf(", passkey %06d", *data.Passkey)
+		}
+		return n
+	case battery.LowBatteryEvent:
+		return Notification{
+			Title:    "Low battery",
+			Message:  fmt.Sprintf("%s (%s) battery is at %d%%", data.Name, data.Address, data.Percentage),
+			Priority: PriorityNormal,
+		}
+	case lockout.LockedOut:
+		return Notification{
+			Title:    "Authentication lockout",
+			Message:  fmt.Sprintf("%s from %s locked out until %s after %d failed attempts", data.Username, data.IP, data.Until.Format("15:04:05"), data.Failures),
+			Priority: PriorityHigh,
+		}
+	case signals.DeviceEvent:
+		if event.Type == signals.EventDeviceFound {
+			name := data.Name
+			if name == "" {
+				name = "Unknown device"
+			}
+			return Notification{
+				Title:    "New device nearby",
+				Message:  fmt.Sprintf("%s (%s) was seen by %s", name, data.Address, data.Adapter),
+				Priority: PriorityLow,
+			}
+		}
+	}
+
+	message, _ := json.Marshal(event.Data)
+	return Notification{Title: event.Type, Message: string(message), Priority: PriorityNormal}
+}
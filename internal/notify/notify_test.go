@@ -0,0 +1,129 @@
+package notify
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/battery"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/nerzhul/home-bt-broker/internal/webpush"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	passkey := uint32(42)
+	n := Format(events.Event{Type: bluetooth.EventPairingRequested, Data: bluetooth.PairingRequest{
+		Type:    bluetooth.PairingRequestConfirmation,
+		Address: "AA:BB:CC:DD:EE:FF",
+		Passkey: &passkey,
+	}})
+	assert.Equal(t, Notification{
+		Title:    "Pairing request",
+		Message:  "AA:BB:CC:DD:EE:FF asks for confirmation, passkey 000042",
+		Priority: PriorityHigh,
+	}, n)
+
+	n = Format(events.Event{Type: "custom", Data: map[string]int{"value": 1}})
+	assert.Equal(t, "custom", n.Title)
+	assert.Equal(t, `{"value":1}`, n.Message)
+}
+
+func TestNtfy_Notify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "/living-room", r.URL.Path)
+		assert.Equal(t, "Low battery", r.Header.Get("Title"))
+		assert.Equal(t, "3", r.Header.Get("Priority"))
+		assert.Equal(t, "Bearer tk_secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "Keyboard battery is at 10%", string(body))
+	}))
+	defer server.Close()
+
+	err := NewNtfy(server.URL+"/living-room", "tk_secret").Notify(context.Background(), Notification{
+		Title:   "Low battery",
+		Message: "Keyboard battery is at 10%",
+	})
+	assert.NoError(t, err)
+}
+
+func TestPushover_Notify(t *testing.T) {
+	received := make(chan url.Values, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		received <- r.PostForm
+	}))
+	defer server.Close()
+	defer func(original string) { PushoverURL = original }(PushoverURL)
+	PushoverURL = server.URL
+
+	hub := events.NewHub()
+	alerter := NewAlerter([]Notifier{NewPushover("app-token", "user-key")}, DefaultEvents)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go alerter.Run(ctx, hub)
+	time.Sleep(10 * time.Millisecond)
+
+	// Only the selected events are notified
+	hub.Publish("beacon_found", nil)
+	hub.Publish(battery.EventBatteryLow, battery.LowBatteryEvent{Name: "Keyboard", Address: "AA:BB:CC:DD:EE:FF", Percentage: 10})
+
+	form := <-received
+	assert.Equal(t, "app-token", form.Get("token"))
+	assert.Equal(t, "user-key", form.Get("user"))
+	assert.Equal(t, "Low battery", form.Get("title"))
+	assert.Equal(t, "Keyboard (AA:BB:CC:DD:EE:FF) battery is at 10%", form.Get("message"))
+	assert.Equal(t, "0", form.Get("priority"))
+}
+
+func TestWebPush_Notify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "high", r.Header.Get("Urgency"))
+		if r.URL.Path == "/expired" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	key, err := webpush.LoadOrCreateKey(filepath.Join(t.TempDir(), "webpush.key"))
+	assert.NoError(t, err)
+	browser, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	p256dh := base64.RawURLEncoding.EncodeToString(browser.PublicKey().Bytes())
+	auth := base64.RawURLEncoding.EncodeToString([]byte("0123456789abcdef"))
+
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	mock.ExpectQuery("SELECT (.+) FROM webpush_subscriptions s JOIN user_tokens t ON t.username = s.username AND t.revoked_at IS NULL ORDER BY s.id").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "endpoint", "p256dh", "auth", "created_at"}).
+			AddRow(1, "admin", server.URL+"/active", p256dh, auth, time.Now()).
+			AddRow(2, "kitchen", server.URL+"/expired", p256dh, auth, time.Now()))
+
+	// The subscriptions dropped by the push service are deleted
+	mock.ExpectExec("DELETE FROM webpush_subscriptions WHERE id = ?").WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// The push service runs on the loopback, refused by the default HTTP client
+	client := webpush.NewClient(key, "mailto:admin@example.com")
+	client.SetHTTPClient(server.Client())
+	err = NewWebPush(client, db, nil).Notify(context.Background(), Notification{
+		Title:    "Pairing request",
+		Message:  "AA:BB:CC:DD:EE:FF asks for confirmation",
+		Priority: PriorityHigh,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
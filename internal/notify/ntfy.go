@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Ntfy publishes notifications to a ntfy topic
+type Ntfy struct {
+	// url is the topic URL, e.g. https://ntfy.sh/my-topic
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewNtfy creates a ntfy notifier publishing to a topic URL, with an optional access token
+func NewNtfy(url, token string) *Ntfy {
+	return &Ntfy{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// ntfyPriorities maps the notification priorities to the ntfy scale, from 1 (min) to 5 (max)
+var ntfyPriorities = map[int]int{PriorityLow: 2, PriorityNormal: 3, PriorityHigh: 4}
+
+// Notify publishes a notification
+func (n *Ntfy) Notify(ctx context.Context, notification Notification) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, strings.NewReader(notification.Message))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Title", notification.Title)
+	req.Header.Set("Priority", strconv.Itoa(ntfyPriorities[notification.Priority]))
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to publish to ntfy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("ntfy returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PushoverURL is the Pushover message API endpoint
+var PushoverURL = "https://api.pushover.net/1/messages.json"
+
+// Pushover sends notifications through the Pushover API
+type Pushover struct {
+	token  string
+	user   string
+	client *http.Client
+}
+
+// NewPushover creates a Pushover notifier from an application token and a user or group key
+func NewPushover(token, user string) *Pushover {
+	return &Pushover{
+		token:  token,
+		user:   user,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify sends a notification, Pushover priorities match ours from -1 (quiet) to 1 (high)
+func (p *Pushover) Notify(ctx context.Context, notification Notification) error {
+	form := url.Values{
+		"token":    {p.token},
+		"user":     {p.user},
+		"title":    {notification.Title},
+		"message":  {notification.Message},
+		"priority": {strconv.Itoa(notification.Priority)},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, PushoverURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send to Pushover: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("pushover returned status %d", resp.StatusCode)
+	}
+	return nil
+}
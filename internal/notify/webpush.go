@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/secrets"
+	"github.com/nerzhul/home-bt-broker/internal/webpush"
+)
+
+// WebPush sends notifications to the browsers subscribed through the web UI
+type WebPush struct {
+	client *webpush.Client
+	db     database.DatabaseInterface
+	cipher *secrets.Cipher
+}
+
+// NewWebPush creates a Web Push notifier sending to the subscriptions stored in the database, whose
+// keys are decrypted with the cipher
+func NewWebPush(client *webpush.Client, db database.DatabaseInterface, cipher *secrets.Cipher) *WebPush {
+	return &WebPush{client: client, db: db, cipher: cipher}
+}
+
+// webPushUrgencies maps the notification priorities to the Web Push urgencies
+var webPushUrgencies = map[int]string{
+	PriorityLow:    webpush.UrgencyLow,
+	PriorityNormal: webpush.UrgencyNormal,
+	PriorityHigh:   webpush.UrgencyHigh,
+}
+
+// Notify sends a notification to the subscriptions of every user whose token is not revoked, deleting
+// the ones the push services dropped
+func (w *WebPush) Notify(ctx context.Context, notification Notification) error {
+	subs, err := database.GetActiveWebPushSubscriptions(w.db, w.cipher)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]string{"title": notification.Title, "body": notification.Message})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sub := range subs {
+		p256dh, err := base64.RawURLEncoding.DecodeString(sub.P256dh)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid key of push subscription %d: %w", sub.ID, err))
+			continue
+		}
+		auth, err := base64.RawURLEncoding.DecodeString(sub.Auth)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid auth secret of push subscription %d: %w", sub.ID, err))
+			continue
+		}
+
+		err = w.client.Send(ctx, webpush.Subscription{Endpoint: sub.Endpoint, P256dh: p256dh, Auth: auth},
+			payload, webPushUrgencies[notification.Priority])
+		if errors.Is(err, webpush.ErrGone) {
+			log.Printf("Notify: push subscription %d of %s expired, deleting it", sub.ID, sub.Username)
+			if _, err := database.DeleteWebPushSubscription(w.db, sub.ID, ""); err != nil {
+				errs = append(errs, err)
+			}
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("push subscription %d: %w", sub.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,310 @@
+// Package plugin runs out-of-tree integrations, such as KNX or Zigbee gateways, as child processes
+// of the broker. A plugin is an executable exchanging JSON messages, one per line, on its standard
+// input and output: it receives the broker events and may call a limited action API.
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+// ProtocolVersion is sent to the plugins in the hello message, it changes when the protocol breaks
+const ProtocolVersion = 1
+
+// EventPluginEvent is published for the events a plugin sends to the broker
+const EventPluginEvent = "plugin_event"
+
+const (
+	startRetryWait = time.Second
+	maxRetryDelay  = time.Minute
+	// maxMessageSize is the longest line a plugin may send
+	maxMessageSize = 1 << 20
+)
+
+// environment are the variables of the broker environment passed to the plugins. The others may
+// hold credentials, such as ENCRYPTION_KEY or BOOTSTRAP_TOKEN.
+var environment = []string{"PATH", "HOME", "LANG", "TZ"}
+
+// Message is a line sent to a plugin: the hello message when it starts, then the broker events
+// and the responses to its requests
+type Message struct {
+	Type string `json:"type"`
+	// Version is the protocol version of a hello message
+	Version int `json:"version,omitempty"`
+	// Event is the broker event of an event message
+	Event *events.Event `json:"event,omitempty"`
+	// ID is the ID of the request a response answers
+	ID     int64       `json:"id,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// Request is a line sent by a plugin to call an action of the broker
+type Request struct {
+	ID     int64  `json:"id"`
+	Action string `json:"action"`
+	// Adapter and Device are the MAC addresses targeted by the device actions
+	Adapter string `json:"adapter,omitempty"`
+	Device  string `json:"device,omitempty"`
+	// Type and Data are the event published by publish_event
+	Type string          `json:"type,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// PluginEvent is the data of the events published by plugins
+type PluginEvent struct {
+	Plugin string          `json:"plugin"`
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// Host starts the plugins, restarts them when they exit and serves their requests
+type Host struct {
+	btManager bluetooth.BluetoothManagerInterface
+	hub       *events.Hub
+	paths     []string
+	readOnly  bool
+}
+
+// NewHost creates a host running the given plugin executables. In read-only mode, the actions
+// changing the Bluetooth state are refused.
+func NewHost(btManager bluetooth.BluetoothManagerInterface, hub *events.Hub, paths []string, readOnly bool) *Host {
+	return &Host{btManager: btManager, hub: hub, paths: paths, readOnly: readOnly}
+}
+
+// Discover returns the executables of a plugin directory, sorted by name
+func Discover(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+			continue
+		}
+		// Anyone on the host could make the broker run their code
+		if info.Mode().Perm()&0002 != 0 {
+			log.Printf("Plugin: ignoring world-writable plugin %s", entry.Name())
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, entry.Name()))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Run runs every plugin until the context is cancelled
+func (h *Host) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, path := range h.paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.supervise(ctx, path)
+		}()
+	}
+	wg.Wait()
+}
+
+// supervise runs a plugin, restarting it with backoff when it exits
+func (h *Host) supervise(ctx context.Context, path string) {
+	name := filepath.Base(path)
+	delay := startRetryWait
+	for {
+		started := time.Now()
+		err := h.run(ctx, path)
+		if ctx.Err() != nil {
+			return
+		}
+		// A plugin which ran for a while is restarted at once, a crashing one is slowed down
+		if time.Since(started) > maxRetryDelay {
+			delay = startRetryWait
+		}
+		log.Printf("Plugin %s: exited: %v, restarting in %s", name, err, delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// run starts a plugin and exchanges messages with it until it exits
+func (h *Host) run(ctx context.Context, path string) error {
+	name := filepath.Base(path)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Env = []string{}
+	for _, variable := range environment {
+		if value, ok := os.LookupEnv(variable); ok {
+			cmd.Env = append(cmd.Env, variable+"="+value)
+		}
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	// Subscribing before starting the plugin keeps it from missing the first events
+	ch, unsubscribe := h.hub.Subscribe()
+	defer unsubscribe()
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	log.Printf("Plugin %s: started", name)
+
+	var writeMu sync.Mutex
+	encoder := json.NewEncoder(stdin)
+	send := func(msg Message) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return encoder.Encode(msg)
+	}
+
+	go logLines(name, stderr)
+	var serveErr error
+	stopped := make(chan struct{})
+	go func() {
+		serveErr = h.serve(name, stdout, send)
+		close(stopped)
+	}()
+
+	err = h.forward(ctx, name, ch, send, stopped)
+	// The output must be read to its end before waiting for the plugin
+	cancel()
+	stdin.Close()
+	<-stopped
+	if waitErr := cmd.Wait(); waitErr != nil {
+		return waitErr
+	}
+	if err != nil {
+		return err
+	}
+	return serveErr
+}
+
+// forward sends the hello message then the broker events to a plugin, until it stops reading
+func (h *Host) forward(ctx context.Context, name string, ch <-chan events.Event, send func(Message) error, stopped <-chan struct{}) error {
+	if err := send(Message{Type: "hello", Version: ProtocolVersion}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-stopped:
+			return nil
+		case event, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			// A plugin is not sent back its own events
+			if data, ok := event.Data.(PluginEvent); ok && data.Plugin == name {
+				continue
+			}
+			if err := send(Message{Type: "event", Event: &event}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// serve answers the requests of a plugin until it closes its output
+func (h *Host) serve(name string, stdout io.Reader, send func(Message) error) error {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var req Request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			if err := send(Message{Type: "response", Error: "invalid request: " + err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		result, err := h.handle(name, req)
+		msg := Message{Type: "response", ID: req.ID, Result: result}
+		if err != nil {
+			msg.Error = err.Error()
+		}
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("plugin closed its output")
+}
+
+// handle runs an action requested by a plugin
+func (h *Host) handle(name string, req Request) (interface{}, error) {
+	switch req.Action {
+	case "get_adapters":
+		return h.btManager.GetAdapters()
+	case "get_devices":
+		adapterPath, err := h.btManager.GetAdapterPathByMAC(req.Adapter)
+		if err != nil {
+			return nil, err
+		}
+		return h.btManager.GetDevices(adapterPath)
+	case "connect_device", "disconnect_device":
+		if h.readOnly {
+			return nil, errors.New("the broker is read-only")
+		}
+		adapterPath, err := h.btManager.GetAdapterPathByMAC(req.Adapter)
+		if err != nil {
+			return nil, err
+		}
+		if req.Action == "connect_device" {
+			return nil, h.btManager.ConnectDevice(adapterPath, req.Device)
+		}
+		return nil, h.btManager.DisconnectDevice(adapterPath, req.Device)
+	case "publish_event":
+		if req.Type == "" {
+			return nil, errors.New("type is required")
+		}
+		h.hub.Publish(EventPluginEvent, PluginEvent{Plugin: name, Type: req.Type, Data: req.Data})
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown action %q", req.Action)
+	}
+}
+
+// logLines logs the lines a plugin writes on its standard error
+func logLines(name string, r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		log.Printf("Plugin %s: %s", name, scanner.Text())
+	}
+}
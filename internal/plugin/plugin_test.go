@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHost_Run(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "output")
+	environment := filepath.Join(dir, "environment")
+	t.Setenv("ENCRYPTION_KEY", "secret")
+	// The plugin publishes an event, lists the adapters, then records what the broker sends it
+	script := `#!/bin/sh
+echo "$PATH$ENCRYPTION_KEY" > ` + environment + `
+read hello
+echo "$hello" > ` + output + `
+echo '{"id": 1, "action": "publish_event", "type": "knx_ready", "data": {"line": 1}}'
+echo '{"id": 2, "action": "get_adapters"}'
+echo '{"id": 3, "action": "connect_device", "adapter": "00:1A:7D:DA:71:01", "device": "AA:BB:CC:DD:EE:FF"}'
+while read line; do echo "$line" >> ` + output + `; done
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "knx"), []byte(script), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "zigbee"), []byte(script), 0755))
+	// The permissions are forced, the umask may have removed the write bit of others
+	assert.NoError(t, os.Chmod(filepath.Join(dir, "zigbee"), 0757))
+
+	paths, err := Discover(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "knx")}, paths)
+
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{{Address: "00:1A:7D:DA:71:01"}}, nil)
+
+	hub := events.NewHub()
+	published, unsubscribe := hub.SubscribeTypes(EventPluginEvent)
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go NewHost(btMock, hub, paths, true).Run(ctx)
+
+	event := <-published
+	assert.Equal(t, PluginEvent{Plugin: "knx", Type: "knx_ready", Data: json.RawMessage(`{"line": 1}`)}, event.Data)
+
+	// messages returns what the plugin received
+	messages := func() []Message {
+		data, _ := os.ReadFile(output)
+		var msgs []Message
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var msg Message
+			if json.Unmarshal([]byte(line), &msg) == nil {
+				msgs = append(msgs, msg)
+			}
+		}
+		return msgs
+	}
+	assert.Eventually(t, func() bool { return len(messages()) == 4 }, 5*time.Second, 10*time.Millisecond)
+
+	// The plugin does not inherit the broker secrets
+	env, err := os.ReadFile(environment)
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getenv("PATH")+"\n", string(env))
+
+	msgs := messages()
+	assert.Equal(t, Message{Type: "hello", Version: ProtocolVersion}, msgs[0])
+	assert.Equal(t, Message{Type: "response", ID: 1}, msgs[1])
+	adapters := msgs[2].Result.([]interface{})
+	assert.Equal(t, "00:1A:7D:DA:71:01", adapters[0].(map[string]interface{})["address"])
+	// The broker is read-only
+	assert.Equal(t, Message{Type: "response", ID: 3, Error: "the broker is read-only"}, msgs[3])
+
+	// The broker events are forwarded to the plugin
+	hub.Publish("device_connected", map[string]string{"address": "AA:BB:CC:DD:EE:FF"})
+	assert.Eventually(t, func() bool { return len(messages()) == 5 }, 5*time.Second, 10*time.Millisecond)
+	msgs = messages()
+	assert.Equal(t, "event", msgs[4].Type)
+	assert.Equal(t, "device_connected", msgs[4].Event.Type)
+}
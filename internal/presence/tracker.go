@@ -0,0 +1,217 @@
+package presence
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth/signals"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+const (
+	StateHome    = "home"
+	StateAway    = "away"
+	StateUnknown = "unknown"
+
+	// EventPresenceChanged is published when a presence device goes home or away
+	EventPresenceChanged = "presence_changed"
+)
+
+// Status is the home/away state of a presence device
+type Status struct {
+	Address  string     `json:"address"`
+	Name     string     `json:"name"`
+	State    string     `json:"state"`
+	Since    time.Time  `json:"since"`
+	LastSeen *time.Time `json:"last_seen"`
+	Adapter  string     `json:"adapter,omitempty"`
+}
+
+// RetainedTopic is the MQTT topic holding the current state of the device
+func (s Status) RetainedTopic() string {
+	return "presence/" + s.Address
+}
+
+// RetainedPayload is the MQTT payload holding the current state of the device
+func (s Status) RetainedPayload() []byte {
+	return []byte(s.State)
+}
+
+// Tracker maintains the home/away state of registered presence devices. A device is home while it is
+// connected or seen during discovery, and away once it has not been seen for its away timeout.
+type Tracker struct {
+	btManager   bluetooth.BluetoothManagerInterface
+	db          database.DatabaseInterface
+	hub         *events.Hub
+	interval    time.Duration
+	awayTimeout time.Duration
+	started     time.Time
+
+	mu       sync.RWMutex
+	statuses map[string]*Status
+}
+
+// NewTracker creates a new presence tracker
+func NewTracker(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, hub *events.Hub, interval, awayTimeout time.Duration) *Tracker {
+	return &Tracker{
+		btManager:   btManager,
+		db:          db,
+		hub:         hub,
+		interval:    interval,
+		awayTimeout: awayTimeout,
+		started:     time.Now(),
+		statuses:    make(map[string]*Status),
+	}
+}
+
+// Run checks presence every interval until the context is cancelled
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		t.Check()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Watch runs a check as soon as a device connects or disconnects, instead of waiting for the next interval,
+// until the context is cancelled
+func (t *Tracker) Watch(ctx context.Context, changes <-chan signals.PropertiesChanged) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change, ok := <-changes:
+			if !ok {
+				return
+			}
+			if _, connected := change.Changed["Connected"]; connected && change.Interface == bluetooth.DeviceInterface {
+				t.Check()
+			}
+		}
+	}
+}
+
+// Check updates the state of every presence device from the devices currently seen by the adapters
+func (t *Tracker) Check() {
+	devices, err := database.GetPresenceDevices(t.db)
+	if err != nil {
+		log.Printf("Presence Tracker: %v", err)
+		return
+	}
+
+	adapters, err := t.btManager.GetAdapters()
+	if err != nil {
+		log.Printf("Presence Tracker: failed to list adapters: %v", err)
+		return
+	}
+
+	seen := map[string]string{}
+	for _, adapter := range adapters {
+		btDevices, err := t.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			log.Printf("Presence Tracker: failed to list devices of %s: %v", adapter.Address, err)
+			continue
+		}
+		for _, device := range btDevices {
+			if device.Connected || device.RSSI != nil {
+				seen[strings.ToUpper(device.Address)] = adapter.Address
+			}
+		}
+	}
+
+	now := time.Now()
+	var changed []Status
+
+	t.mu.Lock()
+	registered := map[string]bool{}
+	for _, device := range devices {
+		address := strings.ToUpper(device.Address)
+		registered[address] = true
+
+		status, ok := t.statuses[address]
+		if !ok {
+			status = &Status{Address: address, State: StateUnknown, Since: now}
+			t.statuses[address] = status
+		}
+		status.Name = device.Name
+
+		timeout := t.awayTimeout
+		if device.AwayTimeout != nil {
+			timeout = time.Duration(*device.AwayTimeout) * time.Second
+		}
+
+		state := status.State
+		if adapter, ok := seen[address]; ok {
+			lastSeen := now
+			status.LastSeen = &lastSeen
+			status.Adapter = adapter
+			state = StateHome
+		} else {
+			reference := t.started
+			if status.LastSeen != nil {
+				reference = *status.LastSeen
+			}
+			if now.Sub(reference) >= timeout {
+				state = StateAway
+			}
+		}
+
+		if state != status.State {
+			status.State = state
+			status.Since = now
+			changed = append(changed, *status)
+		}
+	}
+
+	for address := range t.statuses {
+		if !registered[address] {
+			delete(t.statuses, address)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, status := range changed {
+		log.Printf("Presence Tracker: %s (%s) is %s", status.Name, status.Address, status.State)
+		t.hub.Publish(EventPresenceChanged, status)
+	}
+}
+
+// Statuses returns the state of every presence device known to the tracker
+func (t *Tracker) Statuses() []Status {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(t.statuses))
+	for _, status := range t.statuses {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Status returns the state of a presence device
+func (t *Tracker) Status(address string) (Status, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	status, ok := t.statuses[strings.ToUpper(address)]
+	if !ok {
+		return Status{}, false
+	}
+	return *status, true
+}
@@ -0,0 +1,87 @@
+package presence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracker_Check(t *testing.T) {
+	// Setup
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rssi := int16(-60)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00"}}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66", Name: "Phone", RSSI: &rssi},
+		{Address: "33:44:55:66:77:88", Name: "Headset", Connected: true},
+	}, nil)
+
+	for i := 0; i < 2; i++ {
+		dbMock.ExpectQuery("SELECT address, name, away_timeout, created_at FROM presence_devices").
+			WillReturnRows(sqlmock.NewRows([]string{"address", "name", "away_timeout", "created_at"}).
+				AddRow("11:22:33:44:55:66", "Alice phone", nil, time.Now()).
+				AddRow("22:33:44:55:66:77", "Bob watch", 60, time.Now()))
+	}
+
+	hub := events.NewHub()
+	ch, unsubscribe := hub.Subscribe()
+	defer unsubscribe()
+
+	tracker := NewTracker(btMock, db, hub, time.Minute, 5*time.Minute)
+	// Pretend the tracker has been running long enough for the watch to be considered away
+	tracker.started = time.Now().Add(-2 * time.Minute)
+
+	// Test - a second check does not report unchanged states
+	tracker.Check()
+	tracker.Check()
+
+	// Assert
+	statuses := tracker.Statuses()
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "Alice phone", statuses[0].Name)
+	assert.Equal(t, StateHome, statuses[0].State)
+	assert.Equal(t, "AA:BB:CC:DD:EE:00", statuses[0].Adapter)
+	assert.NotNil(t, statuses[0].LastSeen)
+	assert.Equal(t, StateAway, statuses[1].State)
+	assert.Nil(t, statuses[1].LastSeen)
+
+	assert.Len(t, ch, 2)
+	event := <-ch
+	assert.Equal(t, EventPresenceChanged, event.Type)
+	assert.Equal(t, "presence/11:22:33:44:55:66", event.Data.(Status).RetainedTopic())
+	assert.Equal(t, []byte("home"), event.Data.(Status).RetainedPayload())
+
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestTracker_GoesAwayAfterTimeout(t *testing.T) {
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00"}}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{}, nil)
+
+	dbMock.ExpectQuery("SELECT address, name, away_timeout, created_at FROM presence_devices").
+		WillReturnRows(sqlmock.NewRows([]string{"address", "name", "away_timeout", "created_at"}).
+			AddRow("11:22:33:44:55:66", "Alice phone", nil, time.Now()))
+
+	tracker := NewTracker(btMock, db, events.NewHub(), time.Minute, 5*time.Minute)
+	lastSeen := time.Now().Add(-10 * time.Minute)
+	tracker.statuses["11:22:33:44:55:66"] = &Status{Address: "11:22:33:44:55:66", State: StateHome, LastSeen: &lastSeen}
+
+	tracker.Check()
+
+	status, ok := tracker.Status("11:22:33:44:55:66")
+	assert.True(t, ok)
+	assert.Equal(t, StateAway, status.State)
+}
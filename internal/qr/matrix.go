@@ -0,0 +1,241 @@
+package qr
+
+// matrix holds the modules of a code being built, with the function modules that data skips
+type matrix struct {
+	size     int
+	version  int
+	modules  [][]bool
+	function [][]bool
+}
+
+func newMatrix(version int) *matrix {
+	size := version*4 + 17
+	m := &matrix{size: size, version: version, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range m.modules {
+		m.modules[i] = make([]bool, size)
+		m.function[i] = make([]bool, size)
+	}
+	m.drawFunctionPatterns()
+	return m
+}
+
+func (m *matrix) set(x, y int, dark bool) {
+	m.modules[y][x] = dark
+	m.function[y][x] = true
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// drawFunctionPatterns draws the timing, finder, alignment and version patterns and reserves the
+// format areas
+func (m *matrix) drawFunctionPatterns() {
+	for i := 0; i < m.size; i++ {
+		m.set(6, i, i%2 == 0)
+		m.set(i, 6, i%2 == 0)
+	}
+
+	for _, center := range [][2]int{{3, 3}, {m.size - 4, 3}, {3, m.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := center[0]+dx, center[1]+dy
+				if x < 0 || x >= m.size || y < 0 || y >= m.size {
+					continue
+				}
+				dist := max(abs(dx), abs(dy))
+				m.set(x, y, dist != 2 && dist != 4)
+			}
+		}
+	}
+
+	positions := versions[m.version-1].alignment
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			// The corners overlap the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					m.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	m.drawFormat(0)
+	m.drawVersion()
+}
+
+// drawFormat draws both copies of the error correction level and mask, and the dark module
+func (m *matrix) drawFormat(mask int) {
+	// Level M is encoded as 00
+	data := mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		m.set(8, i, bit(i))
+	}
+	m.set(8, 7, bit(6))
+	m.set(8, 8, bit(7))
+	m.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		m.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		m.set(m.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.set(8, m.size-15+i, bit(i))
+	}
+	m.set(8, m.size-8, true)
+}
+
+// drawVersion draws both copies of the version information of versions 7 and above
+func (m *matrix) drawVersion() {
+	if m.version < 7 {
+		return
+	}
+	rem := m.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1f25)
+	}
+	bits := m.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 != 0
+		a, b := m.size-11+i%3, i/3
+		m.set(a, b, dark)
+		m.set(b, a, dark)
+	}
+}
+
+// drawCodewords places the codewords in the zigzag order, two columns at a time from the right
+func (m *matrix) drawCodewords(data []byte) {
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// The vertical timing pattern is skipped
+			right = 5
+		}
+		for vert := 0; vert < m.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = m.size - 1 - vert
+				}
+				if m.function[y][x] || i >= len(data)*8 {
+					continue
+				}
+				m.modules[y][x] = (data[i/8]>>(7-i%8))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by a mask pattern
+func (m *matrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !m.function[y][x] {
+				m.modules[y][x] = !m.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to read, the mask with the lowest score is kept
+func (m *matrix) penalty() int {
+	penalty := 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+
+	for _, vertical := range []bool{false, true} {
+		at := func(line, i int) bool {
+			if vertical {
+				return m.modules[i][line]
+			}
+			return m.modules[line][i]
+		}
+		for line := 0; line < m.size; line++ {
+			run := 1
+			for i := 1; i <= m.size; i++ {
+				if i < m.size && at(line, i) == at(line, i-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					penalty += run - 2
+				}
+				run = 1
+			}
+
+			for i := 0; i+11 <= m.size; i++ {
+				for _, pattern := range finderLike {
+					matches := true
+					for k, dark := range pattern {
+						if at(line, i+k) != dark {
+							matches = false
+							break
+						}
+					}
+					if matches {
+						penalty += 40
+					}
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.modules[y][x] {
+				dark++
+			}
+			if x+1 < m.size && y+1 < m.size {
+				c := m.modules[y][x]
+				if c == m.modules[y][x+1] && c == m.modules[y+1][x] && c == m.modules[y+1][x+1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	total := m.size * m.size
+	penalty += abs(dark*20-total*10) / total * 10
+	return penalty
+}
@@ -0,0 +1,181 @@
+// Package qr encodes short texts such as URLs into QR codes, in byte mode with the medium (M) error
+// correction level. Versions 1 to 10 are supported, up to 213 bytes, which covers links carrying a token.
+package qr
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// versions describes the codewords of versions 1 to 10 at error correction level M
+var versions = []struct {
+	total       int
+	blocks      int
+	eccPerBlock int
+	alignment   []int
+}{
+	{26, 1, 10, nil},
+	{44, 1, 16, []int{6, 18}},
+	{70, 1, 26, []int{6, 22}},
+	{100, 2, 18, []int{6, 26}},
+	{134, 2, 24, []int{6, 30}},
+	{172, 4, 16, []int{6, 34}},
+	{196, 4, 18, []int{6, 22, 38}},
+	{242, 4, 22, []int{6, 24, 42}},
+	{292, 5, 22, []int{6, 26, 46}},
+	{346, 5, 26, []int{6, 28, 50}},
+}
+
+// ErrTooLong is returned when the text does not fit in the largest supported version
+var ErrTooLong = errors.New("text too long for a QR code")
+
+// Code is an encoded QR code, a square of dark and light modules
+type Code struct {
+	Size    int
+	modules [][]bool
+}
+
+// Dark reports whether the module at a column and row is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// Encode encodes a text in the smallest version it fits in
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	for v := 1; v <= len(versions); v++ {
+		if len(data) <= capacity(v) {
+			return encode(v, data), nil
+		}
+	}
+	return nil, ErrTooLong
+}
+
+// Image renders the code with a quiet zone of 4 modules, each module being scale pixels wide
+func (c *Code) Image(scale int) image.Image {
+	const quiet = 4
+	size := (c.Size + 2*quiet) * scale
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+quiet)*scale+dx, (y+quiet)*scale+dy, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+func dataCodewords(version int) int {
+	v := versions[version-1]
+	return v.total - v.blocks*v.eccPerBlock
+}
+
+// countBits is the size of the byte mode character count
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+func capacity(version int) int {
+	return (dataCodewords(version)*8 - 4 - countBits(version)) / 8
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 != 0)
+	}
+}
+
+// codewords builds the data codewords: mode, count, data, terminator and padding
+func codewords(version int, data []byte) []byte {
+	var bits bitBuffer
+	bits.append(0x4, 4)
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+
+	capacityBits := dataCodewords(version) * 8
+	terminator := capacityBits - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xec; len(bits) < capacityBits; pad ^= 0xec ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	result := make([]byte, len(bits)/8)
+	for i, bit := range bits {
+		if bit {
+			result[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return result
+}
+
+// interleave splits the data in blocks, appends their error correction codewords and interleaves them
+func interleave(version int, data []byte) []byte {
+	v := versions[version-1]
+	shortBlocks := v.blocks - v.total%v.blocks
+	shortLen := v.total / v.blocks
+	divisor := rsDivisor(v.eccPerBlock)
+
+	blocks := make([][]byte, 0, v.blocks)
+	for i, k := 0, 0; i < v.blocks; i++ {
+		n := shortLen - v.eccPerBlock
+		if i >= shortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		if i < shortBlocks {
+			block = append(block, 0)
+		}
+		blocks = append(blocks, append(block, ecc...))
+	}
+
+	result := make([]byte, 0, v.total)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			// Skip the padding of the short blocks
+			if i != shortLen-v.eccPerBlock || j >= shortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+func encode(version int, data []byte) *Code {
+	q := newMatrix(version)
+	q.drawCodewords(interleave(version, codewords(version, data)))
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormat(mask)
+		if penalty := q.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		// Masks are their own inverse
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormat(best)
+
+	return &Code{Size: q.size, modules: q.modules}
+}
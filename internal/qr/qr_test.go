@@ -0,0 +1,174 @@
+package qr
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRSRemainder(t *testing.T) {
+	// "HELLO WORLD" in version 1-M, from the ISO/IEC 18004 worked example
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	assert.Equal(t, []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}, rsRemainder(data, rsDivisor(10)))
+}
+
+func TestDrawFormat(t *testing.T) {
+	m := newMatrix(1)
+	m.drawFormat(5)
+
+	var bits int
+	for i := 0; i <= 5; i++ {
+		if m.modules[i][8] {
+			bits |= 1 << i
+		}
+	}
+	// Level M with mask 5: 100000011001110, read from its lowest bit
+	assert.Equal(t, 0b001110, bits)
+	assert.True(t, m.modules[m.size-8][8], "dark module")
+}
+
+func TestDrawVersion(t *testing.T) {
+	m := newMatrix(7)
+	var bits int
+	for i := 0; i < 18; i++ {
+		if m.modules[i/3][m.size-11+i%3] {
+			bits |= 1 << i
+		}
+	}
+	assert.Equal(t, 0b000111110010010100, bits)
+}
+
+func TestCodewords(t *testing.T) {
+	assert.Equal(t, []byte{0x40, 0x36, 0x16, 0x26, 0x30, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec, 0x11, 0xec}, codewords(1, []byte("abc")))
+}
+
+// decode reads back the text of a code: it finds the mask from the format bits, unmasks the data
+// modules, de-interleaves the blocks and checks their error correction codewords
+func decode(t *testing.T, code *Code) string {
+	version := (code.Size - 17) / 4
+	m := newMatrix(version)
+	for y := range m.modules {
+		copy(m.modules[y], code.modules[y])
+	}
+
+	mask := -1
+	for candidate := 0; candidate < 8; candidate++ {
+		format := newMatrix(version)
+		format.drawFormat(candidate)
+		matches := true
+		for i := 0; i <= 5; i++ {
+			matches = matches && format.modules[i][8] == m.modules[i][8]
+		}
+		if matches {
+			mask = candidate
+		}
+	}
+	if !assert.NotEqual(t, -1, mask) {
+		return ""
+	}
+	m.applyMask(mask)
+
+	v := versions[version-1]
+	raw := make([]byte, v.total)
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < m.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = m.size - 1 - vert
+				}
+				if m.function[y][x] || i >= len(raw)*8 {
+					continue
+				}
+				if m.modules[y][x] {
+					raw[i/8] |= 1 << (7 - i%8)
+				}
+				i++
+			}
+		}
+	}
+
+	shortBlocks := v.blocks - v.total%v.blocks
+	shortLen := v.total / v.blocks
+	blocks := make([][]byte, v.blocks)
+	k := 0
+	for col := 0; col < shortLen+1; col++ {
+		for j := range blocks {
+			if col == shortLen-v.eccPerBlock && j < shortBlocks {
+				continue
+			}
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for _, block := range blocks {
+		n := len(block) - v.eccPerBlock
+		assert.Equal(t, block[n:], rsRemainder(block[:n], rsDivisor(v.eccPerBlock)))
+		data = append(data, block[:n]...)
+	}
+
+	assert.Equal(t, byte(0x4), data[0]>>4, "byte mode")
+	var bits bitBuffer
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	read := func(offset, n int) int {
+		value := 0
+		for _, bit := range bits[offset : offset+n] {
+			value <<= 1
+			if bit {
+				value |= 1
+			}
+		}
+		return value
+	}
+	count := read(4, countBits(version))
+	text := make([]byte, count)
+	for c := range text {
+		text[c] = byte(read(4+countBits(version)+8*c, 8))
+	}
+	return string(text)
+}
+
+func TestEncode(t *testing.T) {
+	for _, text := range []string{
+		"a",
+		"https://broker.lan:8080/#pair",
+		"https://broker.lan:8080/#pair?adapter=00:1A:7D:DA:71:01&token=" + strings.Repeat("0123456789abcdef", 4),
+		strings.Repeat("x", 213),
+	} {
+		code, err := Encode(text)
+		if assert.NoError(t, err) {
+			assert.Equal(t, text, decode(t, code))
+		}
+	}
+
+	code, err := Encode(strings.Repeat("x", 100))
+	assert.NoError(t, err)
+	// 100 bytes need version 6 with 41x41 modules
+	assert.Equal(t, 41, code.Size)
+
+	_, err = Encode(strings.Repeat("x", 214))
+	assert.ErrorIs(t, err, ErrTooLong)
+}
+
+func TestImage(t *testing.T) {
+	code, err := Encode("a")
+	assert.NoError(t, err)
+
+	img := code.Image(2)
+	assert.Equal(t, image.Rect(0, 0, (21+8)*2, (21+8)*2), img.Bounds())
+	// The quiet zone is light and the finder corner dark
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+	r, _, _, _ = img.At(8, 8).RGBA()
+	assert.Equal(t, uint32(0), r)
+}
@@ -0,0 +1,316 @@
+// Package reconnect reconnects the paired devices having a reconnect sequence, connecting their
+// profiles one by one in the configured order for devices which only work when, e.g., HID
+// connects before A2DP. A device is reconnected through the adapter owning it, and may fail over
+// to another adapter when that one is unplugged or powered off.
+package reconnect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+// Failover policies, applied when the adapter owning a device is gone
+const (
+	// FailoverOff waits for the adapter owning the device to come back
+	FailoverOff = "off"
+	// FailoverTrusted reconnects the device through another adapter it is paired with and trusted by
+	FailoverTrusted = "trusted"
+	// FailoverPaired reconnects the device through another adapter it is paired with
+	FailoverPaired = "paired"
+)
+
+// FailoverPolicies are the valid failover policies
+var FailoverPolicies = []string{FailoverOff, FailoverTrusted, FailoverPaired}
+
+const (
+	// EventAdapterFailover is published when a device is reconnected through another adapter than
+	// the one owning it
+	EventAdapterFailover = "adapter_failover"
+	// EventAdapterFailback is published when a device failed over is back on the adapter owning it
+	EventAdapterFailback = "adapter_failback"
+)
+
+// Failover is the data of the failover events
+type Failover struct {
+	Address string `json:"address"`
+	// From and To are the MAC addresses of the adapters the device leaves and joins
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+const (
+	maxSteps   = 10
+	maxDelayMs = 30000
+)
+
+// profileAliases are the profile names accepted in place of their UUID
+var profileAliases = map[string]string{
+	"a2dp":        "110b",
+	"a2dp_sink":   "110b",
+	"a2dp_source": "110a",
+	"avrcp":       "110e",
+	"hfp":         "111e",
+	"hid":         "1124",
+	"hsp":         "1108",
+}
+
+var uuidPattern = regexp.MustCompile(`^([0-9a-f]{4}|[0-9a-f]{8}|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})$`)
+
+// NormalizeSteps checks a reconnect sequence and replaces the profile names by their full UUID
+func NormalizeSteps(steps []database.ReconnectStep) ([]database.ReconnectStep, error) {
+	if len(steps) > maxSteps {
+		return nil, fmt.Errorf("too many steps: %d, at most %d are allowed", len(steps), maxSteps)
+	}
+
+	normalized := make([]database.ReconnectStep, 0, len(steps))
+	for i, step := range steps {
+		profile := strings.ToLower(step.Profile)
+		if uuid, ok := profileAliases[profile]; ok {
+			profile = uuid
+		}
+		if !uuidPattern.MatchString(profile) {
+			return nil, fmt.Errorf("step %d: unknown profile %q, expected a UUID or one of a2dp, a2dp_source, avrcp, hfp, hid, hsp", i+1, step.Profile)
+		}
+		if step.DelayMs < 0 || step.DelayMs > maxDelayMs {
+			return nil, fmt.Errorf("step %d: invalid delay %dms, must be between 0 and %d", i+1, step.DelayMs, maxDelayMs)
+		}
+		normalized = append(normalized, database.ReconnectStep{Profile: bluetooth.NormalizeUUID(profile), DelayMs: step.DelayMs})
+	}
+	return normalized, nil
+}
+
+// Reconnector reconnects the disconnected paired devices having a reconnect sequence
+type Reconnector struct {
+	btManager bluetooth.BluetoothManagerInterface
+	db        database.DatabaseInterface
+	interval  time.Duration
+	failover  string
+	hub       *events.Hub
+	// resolveTimeout bounds the wait for the services of a reconnected device, 0 not waiting
+	resolveTimeout time.Duration
+
+	// owners are the MAC addresses of the adapters owning the devices, the ones they were last
+	// connected through outside of a failover, by device address
+	owners map[string]string
+	// failedOver are the MAC addresses of the adapters the devices failed over to
+	failedOver map[string]string
+}
+
+// NewReconnector creates a new reconnector applying a failover policy. With a resolve timeout, a
+// reconnection only succeeds once the services of the device are resolved.
+func NewReconnector(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, interval time.Duration, failover string, resolveTimeout time.Duration) *Reconnector {
+	return &Reconnector{
+		btManager:      btManager,
+		db:             db,
+		interval:       interval,
+		failover:       failover,
+		resolveTimeout: resolveTimeout,
+		owners:         make(map[string]string),
+		failedOver:     make(map[string]string),
+	}
+}
+
+// Run tries to reconnect the devices at every interval until the context is cancelled, publishing
+// the failover events to the hub
+func (r *Reconnector) Run(ctx context.Context, hub *events.Hub) {
+	r.hub = hub
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reconnectAll(ctx)
+		}
+	}
+}
+
+// candidate is a powered adapter a device is paired with
+type candidate struct {
+	adapter bluetooth.Adapter
+	device  bluetooth.Device
+}
+
+// reconnectAll runs the sequence of every paired device which is not connected
+func (r *Reconnector) reconnectAll(ctx context.Context) {
+	sequences, err := database.GetDeviceReconnects(r.db)
+	if err != nil {
+		log.Printf("Reconnect: %v", err)
+		return
+	}
+	if len(sequences) == 0 {
+		return
+	}
+
+	adapters, err := r.btManager.GetAdapters()
+	if err != nil {
+		log.Printf("Reconnect: failed to get adapters: %v", err)
+		return
+	}
+	powered := make(map[string]bool)
+	candidates := make(map[string][]candidate)
+	for _, adapter := range adapters {
+		if !adapter.Powered {
+			continue
+		}
+		powered[adapter.Address] = true
+		devices, err := r.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			log.Printf("Reconnect: failed to get devices of adapter %s: %v", adapter.Address, err)
+			continue
+		}
+		for _, device := range devices {
+			if device.Paired {
+				address := strings.ToUpper(device.Address)
+				candidates[address] = append(candidates[address], candidate{adapter: adapter, device: device})
+			}
+		}
+	}
+
+	for _, sequence := range sequences {
+		address := strings.ToUpper(sequence.Address)
+		r.reconnectDevice(ctx, address, sequence.Steps, candidates[address], powered)
+	}
+}
+
+// reconnectDevice reconnects a device through the adapter owning it, or through another adapter it
+// is paired with when the policy allows it and the owning adapter is unplugged or powered off
+func (r *Reconnector) reconnectDevice(ctx context.Context, address string, steps []database.ReconnectStep, candidates []candidate, powered map[string]bool) {
+	if len(candidates) == 0 {
+		return
+	}
+	for _, c := range candidates {
+		if c.device.Connected {
+			r.connected(address, c.adapter.Address)
+			return
+		}
+	}
+
+	// The first adapter the device is paired with owns it until it connects through another one. A
+	// device no longer paired with the powered adapter owning it gets a new owner.
+	owner, ok := r.owners[address]
+	if !ok || (powered[owner] && !pairedWith(candidates, owner)) {
+		owner = candidates[0].adapter.Address
+		r.owners[address] = owner
+	}
+	for _, c := range candidates {
+		if c.adapter.Address != owner {
+			continue
+		}
+		if err := r.Reconnect(ctx, c.adapter.Path, c.device.Address, steps); err != nil {
+			log.Printf("Reconnect: %v", err)
+			return
+		}
+		r.connected(address, owner)
+		return
+	}
+
+	if r.failover == FailoverOff {
+		return
+	}
+	for _, c := range candidates {
+		if r.failover == FailoverTrusted && !c.device.Trusted {
+			continue
+		}
+		if err := r.Reconnect(ctx, c.adapter.Path, c.device.Address, steps); err != nil {
+			log.Printf("Reconnect: failover of %s to %s: %v", address, c.adapter.Address, err)
+			continue
+		}
+		if r.failedOver[address] != c.adapter.Address {
+			log.Printf("Reconnect: %s failed over from %s to %s", address, owner, c.adapter.Address)
+			r.failedOver[address] = c.adapter.Address
+			r.publish(EventAdapterFailover, Failover{Address: address, From: owner, To: c.adapter.Address})
+		}
+		return
+	}
+}
+
+// connected records the adapter a device is connected through. Outside of a failover, it becomes
+// the adapter owning the device; a failover ends once the device is back on its owner, the device
+// staying on the other adapter until it disconnects.
+func (r *Reconnector) connected(address, adapter string) {
+	to, ok := r.failedOver[address]
+	if !ok {
+		r.owners[address] = adapter
+		return
+	}
+	if adapter != r.owners[address] {
+		return
+	}
+	delete(r.failedOver, address)
+	log.Printf("Reconnect: %s is back on %s", address, adapter)
+	r.publish(EventAdapterFailback, Failover{Address: address, From: to, To: adapter})
+}
+
+func (r *Reconnector) publish(eventType string, failover Failover) {
+	if r.hub != nil {
+		r.hub.Publish(eventType, failover)
+	}
+}
+
+// pairedWith reports whether an adapter is among the candidates of a device
+func pairedWith(candidates []candidate, adapter string) bool {
+	for _, c := range candidates {
+		if c.adapter.Address == adapter {
+			return true
+		}
+	}
+	return false
+}
+
+// Reconnect connects the profiles of a device in order, waiting the delay of each step before
+// connecting its profile. Without steps, every profile is connected at once. The profiles following
+// the first one are connected once the services of the device are resolved, when waiting for them.
+func (r *Reconnector) Reconnect(ctx context.Context, adapterPath, address string, steps []database.ReconnectStep) error {
+	if len(steps) == 0 {
+		if err := r.btManager.ConnectDevice(adapterPath, address); err != nil {
+			return err
+		}
+		return r.waitResolved(ctx, adapterPath, address)
+	}
+
+	for i, step := range steps {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(step.DelayMs) * time.Millisecond):
+		}
+
+		if err := r.btManager.ConnectProfile(adapterPath, address, step.Profile); err != nil && !alreadyConnected(err) {
+			return fmt.Errorf("step %d of %s: %w", i+1, address, err)
+		}
+		if i == 0 {
+			if err := r.waitResolved(ctx, adapterPath, address); err != nil {
+				return fmt.Errorf("step %d of %s: %w", i+1, address, err)
+			}
+		}
+	}
+	return nil
+}
+
+// waitResolved waits for the services of a connected device to be resolved, if configured to
+func (r *Reconnector) waitResolved(ctx context.Context, adapterPath, address string) error {
+	if r.resolveTimeout <= 0 {
+		return nil
+	}
+	return bluetooth.WaitServicesResolved(ctx, r.btManager, adapterPath, address, r.resolveTimeout)
+}
+
+// alreadyConnected reports whether BlueZ refused to connect a profile which is already connected,
+// e.g. because the device connected it by itself
+func alreadyConnected(err error) bool {
+	var dbusErr dbus.Error
+	return errors.As(err, &dbusErr) && dbusErr.Name == "org.bluez.Error.AlreadyConnected"
+}
@@ -0,0 +1,169 @@
+package reconnect
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/godbus/dbus/v5"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNormalizeSteps(t *testing.T) {
+	steps, err := NormalizeSteps([]database.ReconnectStep{
+		{Profile: "HID"},
+		{Profile: "0000110e-0000-1000-8000-00805f9b34fb", DelayMs: 500},
+		{Profile: "110b", DelayMs: 1500},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []database.ReconnectStep{
+		{Profile: "00001124-0000-1000-8000-00805f9b34fb"},
+		{Profile: "0000110e-0000-1000-8000-00805f9b34fb", DelayMs: 500},
+		{Profile: "0000110b-0000-1000-8000-00805f9b34fb", DelayMs: 1500},
+	}, steps)
+
+	_, err = NormalizeSteps([]database.ReconnectStep{{Profile: "bogus"}})
+	assert.Error(t, err)
+	_, err = NormalizeSteps([]database.ReconnectStep{{Profile: "hid", DelayMs: -1}})
+	assert.Error(t, err)
+	_, err = NormalizeSteps(make([]database.ReconnectStep, maxSteps+1))
+	assert.Error(t, err)
+}
+
+func TestReconnector_Reconnect(t *testing.T) {
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	mock.InOrder(
+		btManager.On("ConnectProfile", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", "hid").Return(nil).Once(),
+		btManager.On("ConnectProfile", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", "avrcp").Return(nil).Once(),
+		btManager.On("ConnectProfile", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", "a2dp").Return(nil).Once(),
+		// BlueZ refuses profiles the device connected by itself
+		btManager.On("ConnectProfile", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", "hfp").Return(dbus.Error{Name: "org.bluez.Error.AlreadyConnected"}).Once(),
+	)
+
+	r := NewReconnector(btManager, nil, time.Minute, FailoverOff, 0)
+	err := r.Reconnect(context.Background(), "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", []database.ReconnectStep{
+		{Profile: "hid"}, {Profile: "avrcp", DelayMs: 1}, {Profile: "a2dp", DelayMs: 1}, {Profile: "hfp"},
+	})
+	assert.NoError(t, err)
+}
+
+func TestReconnector_ReconnectAll(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	dbMock.ExpectQuery("FROM device_reconnect").WillReturnRows(sqlmock.NewRows([]string{"address", "steps", "updated_at"}).
+		AddRow("AA:BB:CC:DD:EE:FF", `[{"profile":"hid","delay_ms":0}]`, time.Now()).
+		AddRow("11:22:33:44:55:66", `[]`, time.Now()))
+
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Powered: true}}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "AA:BB:CC:DD:EE:FF", Paired: true},
+		{Address: "11:22:33:44:55:66", Paired: true, Connected: true},
+		{Address: "99:88:77:66:55:44", Paired: true},
+	}, nil)
+	btManager.On("ConnectProfile", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", "hid").Return(nil).Once()
+
+	NewReconnector(btManager, db, time.Minute, FailoverOff, 0).reconnectAll(context.Background())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestReconnector_Failover(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	sequences := func() {
+		dbMock.ExpectQuery("FROM device_reconnect").WillReturnRows(sqlmock.NewRows([]string{"address", "steps", "updated_at"}).
+			AddRow("AA:BB:CC:DD:EE:FF", `[]`, time.Now()))
+	}
+	hci0 := bluetooth.Adapter{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true}
+	hci1 := bluetooth.Adapter{Path: "/org/bluez/hci1", Address: "00:1A:7D:DA:71:02", Powered: true}
+
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	hub := events.NewHub()
+	ch, unsubscribe := hub.SubscribeTypes(EventAdapterFailover, EventAdapterFailback)
+	defer unsubscribe()
+	r := NewReconnector(btManager, db, time.Minute, FailoverTrusted, 0)
+	r.hub = hub
+
+	// The device connected through hci0, which owns it
+	sequences()
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{hci0, hci1}, nil).Once()
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Connected: true}}, nil).Once()
+	btManager.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true}}, nil).Once()
+	r.reconnectAll(context.Background())
+
+	// hci0 is unplugged, the device fails over to hci1
+	sequences()
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{hci1}, nil).Once()
+	btManager.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true}}, nil).Once()
+	btManager.On("ConnectDevice", "/org/bluez/hci1", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+	r.reconnectAll(context.Background())
+	event := <-ch
+	assert.Equal(t, EventAdapterFailover, event.Type)
+	assert.Equal(t, Failover{Address: "AA:BB:CC:DD:EE:FF", From: "00:1A:7D:DA:71:01", To: "00:1A:7D:DA:71:02"}, event.Data)
+
+	// hci0 is back, the device returns to it once disconnected
+	sequences()
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{hci0, hci1}, nil).Once()
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true}}, nil).Once()
+	btManager.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true}}, nil).Once()
+	btManager.On("ConnectDevice", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+	r.reconnectAll(context.Background())
+	event = <-ch
+	assert.Equal(t, EventAdapterFailback, event.Type)
+	assert.Equal(t, Failover{Address: "AA:BB:CC:DD:EE:FF", From: "00:1A:7D:DA:71:02", To: "00:1A:7D:DA:71:01"}, event.Data)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestReconnector_FailoverOff(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	for range 2 {
+		dbMock.ExpectQuery("FROM device_reconnect").WillReturnRows(sqlmock.NewRows([]string{"address", "steps", "updated_at"}).
+			AddRow("AA:BB:CC:DD:EE:FF", `[]`, time.Now()))
+	}
+
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true},
+		{Path: "/org/bluez/hci1", Address: "00:1A:7D:DA:71:02", Powered: true},
+	}, nil).Once()
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Connected: true}}, nil).Once()
+	btManager.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true}}, nil)
+	// hci0 is powered off, the device waits for it
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01"},
+		{Path: "/org/bluez/hci1", Address: "00:1A:7D:DA:71:02", Powered: true},
+	}, nil).Once()
+
+	r := NewReconnector(btManager, db, time.Minute, FailoverOff, 0)
+	r.reconnectAll(context.Background())
+	r.reconnectAll(context.Background())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestReconnector_ReconnectWaitResolved(t *testing.T) {
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	mock.InOrder(
+		btManager.On("ConnectProfile", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", "hid").Return(nil).Once(),
+		btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Connected: true, ServicesResolved: true}}, nil).Once(),
+		btManager.On("ConnectProfile", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", "a2dp").Return(nil).Once(),
+	)
+
+	r := NewReconnector(btManager, nil, time.Minute, FailoverOff, time.Second)
+	err := r.Reconnect(context.Background(), "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", []database.ReconnectStep{{Profile: "hid"}, {Profile: "a2dp"}})
+	assert.NoError(t, err)
+
+	// The device dropped the link while its services were resolved
+	btManager.On("ConnectDevice", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF"}}, nil).Once()
+	err = r.Reconnect(context.Background(), "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", nil)
+	assert.ErrorIs(t, err, bluetooth.ErrDeviceDisconnected)
+}
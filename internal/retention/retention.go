@@ -0,0 +1,108 @@
+// Package retention prunes the history kept in the database once it is older than its retention,
+// along with the expired sessions and idempotency keys, so that the SQLite file does not grow
+// without bounds
+package retention
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// Policy is how long each kind of row is kept, a zero retention keeping the history forever
+type Policy struct {
+	BatteryRetention time.Duration
+	RSSIRetention    time.Duration
+	AuditRetention   time.Duration
+	// IdempotencyWindow is how long the responses to requests with an idempotency key are replayed
+	IdempotencyWindow time.Duration
+}
+
+// Result is the number of rows deleted from each table by a pruning
+type Result struct {
+	Deleted map[string]int64 `json:"deleted"`
+}
+
+// Pruner deletes the rows past their retention at every interval
+type Pruner struct {
+	db       database.DatabaseInterface
+	policy   Policy
+	interval time.Duration
+	now      func() time.Time
+
+	// mu keeps the periodic and manual prunings from running at the same time
+	mu sync.Mutex
+}
+
+// NewPruner creates a new pruner enforcing a retention policy
+func NewPruner(db database.DatabaseInterface, policy Policy, interval time.Duration) *Pruner {
+	return &Pruner{db: db, policy: policy, interval: interval, now: time.Now}
+}
+
+// Run prunes the database at startup, then at every interval until the context is cancelled
+func (p *Pruner) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if result, err := p.Prune(); err != nil {
+			log.Printf("Retention: %v", err)
+		} else if total := result.Total(); total > 0 {
+			log.Printf("Retention: pruned %d row(s): %v", total, result.Deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prune deletes the rows past their retention. It stops at the first table failing to be pruned.
+func (p *Pruner) Prune() (Result, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	type cutoff struct {
+		table  string
+		before time.Time
+	}
+	cutoffs := []cutoff{
+		{database.TableSessions, now},
+		{database.TablePairingSessions, now},
+		{database.TableIdempotencyKeys, now.Add(-p.policy.IdempotencyWindow)},
+	}
+	if p.policy.BatteryRetention > 0 {
+		cutoffs = append(cutoffs, cutoff{database.TableBatteryHistory, now.Add(-p.policy.BatteryRetention)})
+	}
+	if p.policy.RSSIRetention > 0 {
+		cutoffs = append(cutoffs, cutoff{database.TableRSSIHistory, now.Add(-p.policy.RSSIRetention)})
+	}
+	if p.policy.AuditRetention > 0 {
+		cutoffs = append(cutoffs, cutoff{database.TableAuditLog, now.Add(-p.policy.AuditRetention)})
+	}
+
+	result := Result{Deleted: make(map[string]int64)}
+	for _, c := range cutoffs {
+		count, err := database.PruneTable(p.db, c.table, c.before)
+		if err != nil {
+			return result, err
+		}
+		result.Deleted[c.table] = count
+	}
+	return result, nil
+}
+
+// Total returns the number of rows deleted from every table
+func (r Result) Total() int64 {
+	var total int64
+	for _, count := range r.Deleted {
+		total += count
+	}
+	return total
+}
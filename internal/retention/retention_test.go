@@ -0,0 +1,58 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruner_Prune(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	dbMock.ExpectExec("DELETE FROM sessions WHERE expires_at < ?").WithArgs(now).WillReturnResult(sqlmock.NewResult(0, 2))
+	dbMock.ExpectExec("DELETE FROM pairing_sessions WHERE expires_at < ?").WithArgs(now).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM idempotency_keys WHERE created_at < ?").WithArgs(now.Add(-24 * time.Hour)).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("DELETE FROM battery_history WHERE recorded_at < ?").WithArgs(now.Add(-30 * 24 * time.Hour)).WillReturnResult(sqlmock.NewResult(0, 40))
+
+	// RSSI samples are kept forever
+	p := NewPruner(db, Policy{BatteryRetention: 30 * 24 * time.Hour, IdempotencyWindow: 24 * time.Hour}, time.Hour)
+	p.now = func() time.Time { return now }
+
+	result, err := p.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{"sessions": 2, "pairing_sessions": 0, "idempotency_keys": 1, "battery_history": 40}, result.Deleted)
+	assert.Equal(t, int64(43), result.Total())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+
+	dbMock.ExpectExec("DELETE FROM sessions").WillReturnError(assert.AnError)
+	_, err = p.Prune()
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "failed to prune sessions")
+}
+
+func TestPruner_PruneRSSI(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	now := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	dbMock.ExpectExec("DELETE FROM sessions WHERE expires_at < ?").WithArgs(now).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM pairing_sessions WHERE expires_at < ?").WithArgs(now).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM idempotency_keys WHERE created_at < ?").WithArgs(now).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("DELETE FROM rssi_history WHERE recorded_at < ?").WithArgs(now.Add(-7 * 24 * time.Hour)).WillReturnResult(sqlmock.NewResult(0, 1200))
+
+	// Battery levels are kept forever
+	p := NewPruner(db, Policy{RSSIRetention: 7 * 24 * time.Hour}, time.Hour)
+	p.now = func() time.Time { return now }
+
+	result, err := p.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1200), result.Deleted["rssi_history"])
+	assert.NotContains(t, result.Deleted, "battery_history")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
@@ -0,0 +1,140 @@
+package rfkill
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Operations and radio types of the kernel rfkill interface, see linux/rfkill.h
+const (
+	opAdd    = 0
+	opChange = 2
+
+	typeBluetooth = 2
+
+	// eventSize is the size of the original struct rfkill_event, accepted by every kernel
+	eventSize = 8
+)
+
+var (
+	// DevicePath is the rfkill control device
+	DevicePath = "/dev/rfkill"
+	// SysfsPath lists the Bluetooth controllers with their rfkill switch
+	SysfsPath = "/sys/class/bluetooth"
+)
+
+// State is the block state of an rfkill switch. A soft block is set by software and can be
+// cleared, a hard block comes from a hardware switch.
+type State struct {
+	Index       uint32 `json:"index"`
+	SoftBlocked bool   `json:"soft_blocked"`
+	HardBlocked bool   `json:"hard_blocked"`
+}
+
+// event mirrors struct rfkill_event
+type event struct {
+	Index uint32
+	Type  uint8
+	Op    uint8
+	Soft  bool
+	Hard  bool
+}
+
+func (e event) marshal() []byte {
+	buf := make([]byte, eventSize)
+	binary.NativeEndian.PutUint32(buf[0:4], e.Index)
+	buf[4] = e.Type
+	buf[5] = e.Op
+	if e.Soft {
+		buf[6] = 1
+	}
+	if e.Hard {
+		buf[7] = 1
+	}
+	return buf
+}
+
+func unmarshalEvent(buf []byte) event {
+	return event{
+		Index: binary.NativeEndian.Uint32(buf[0:4]),
+		Type:  buf[4],
+		Op:    buf[5],
+		Soft:  buf[6] != 0,
+		Hard:  buf[7] != 0,
+	}
+}
+
+// States returns the state of every Bluetooth rfkill switch, by index. Opening /dev/rfkill
+// replays an add event per switch, read without blocking until none is left.
+func States() (map[uint32]State, error) {
+	// The raw syscalls keep the descriptor away from the runtime poller, which would wait for new events
+	fd, err := syscall.Open(DevicePath, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", DevicePath, err)
+	}
+	defer syscall.Close(fd)
+
+	// The kernel returns one event per read, truncated to the buffer size
+	states := map[uint32]State{}
+	buf := make([]byte, eventSize)
+	for {
+		n, err := syscall.Read(fd, buf)
+		if errors.Is(err, syscall.EAGAIN) || n == 0 {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", DevicePath, err)
+		}
+		if n < eventSize {
+			break
+		}
+
+		e := unmarshalEvent(buf)
+		if e.Op == opAdd && e.Type == typeBluetooth {
+			states[e.Index] = State{Index: e.Index, SoftBlocked: e.Soft, HardBlocked: e.Hard}
+		}
+	}
+
+	return states, nil
+}
+
+// AdapterIndex returns the rfkill index of a Bluetooth controller such as hci0
+func AdapterIndex(adapter string) (uint32, error) {
+	entries, err := os.ReadDir(filepath.Join(SysfsPath, adapter))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s sysfs entry: %w", adapter, err)
+	}
+
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "rfkill") {
+			continue
+		}
+		if index, err := strconv.ParseUint(strings.TrimPrefix(entry.Name(), "rfkill"), 10, 32); err == nil {
+			return uint32(index), nil
+		}
+	}
+
+	return 0, fmt.Errorf("no rfkill switch found for %s", adapter)
+}
+
+// SetSoftBlock soft blocks or unblocks the radio of an rfkill switch
+func SetSoftBlock(index uint32, block bool) error {
+	f, err := os.OpenFile(DevicePath, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", DevicePath, err)
+	}
+	defer f.Close()
+
+	e := event{Index: index, Type: typeBluetooth, Op: opChange, Soft: block}
+	if _, err := f.Write(e.marshal()); err != nil {
+		return fmt.Errorf("failed to change rfkill %d state: %w", index, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package rfkill
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdapterIndex(t *testing.T) {
+	SysfsPath = t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(SysfsPath, "hci0", "rfkill3"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(SysfsPath, "hci1"), 0755))
+
+	index, err := AdapterIndex("hci0")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), index)
+
+	_, err = AdapterIndex("hci1")
+	assert.Error(t, err)
+}
+
+func TestSetSoftBlock(t *testing.T) {
+	DevicePath = filepath.Join(t.TempDir(), "rfkill")
+	assert.NoError(t, os.WriteFile(DevicePath, nil, 0600))
+
+	assert.NoError(t, SetSoftBlock(3, true))
+
+	data, err := os.ReadFile(DevicePath)
+	assert.NoError(t, err)
+	assert.Len(t, data, eventSize)
+	assert.Equal(t, []byte{typeBluetooth, opChange, 1, 0}, data[4:])
+}
+
+func TestStates(t *testing.T) {
+	DevicePath = filepath.Join(t.TempDir(), "rfkill")
+	var data []byte
+	data = append(data, event{Index: 0, Type: 1, Op: opAdd, Soft: true}.marshal()...)
+	data = append(data, event{Index: 1, Type: typeBluetooth, Op: opAdd, Soft: true}.marshal()...)
+	data = append(data, event{Index: 2, Type: typeBluetooth, Op: opAdd, Hard: true}.marshal()...)
+	assert.NoError(t, os.WriteFile(DevicePath, data, 0600))
+
+	states, err := States()
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint32]State{
+		1: {Index: 1, SoftBlocked: true},
+		2: {Index: 2, HardBlocked: true},
+	}, states)
+}
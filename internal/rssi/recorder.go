@@ -0,0 +1,85 @@
+package rssi
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// Recorder periodically samples the RSSI of tracked devices
+type Recorder struct {
+	btManager bluetooth.BluetoothManagerInterface
+	db        database.DatabaseInterface
+	interval  time.Duration
+}
+
+// NewRecorder creates a new RSSI recorder
+func NewRecorder(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, interval time.Duration) *Recorder {
+	return &Recorder{
+		btManager: btManager,
+		db:        db,
+		interval:  interval,
+	}
+}
+
+// Run samples RSSI values every interval until the context is cancelled
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.Sample()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample records the current RSSI of every tracked device for which BlueZ reports one
+func (r *Recorder) Sample() {
+	tracked, err := database.GetTrackedRSSIDevices(r.db)
+	if err != nil {
+		log.Printf("RSSI Recorder: %v", err)
+		return
+	}
+	if len(tracked) == 0 {
+		return
+	}
+
+	adapters, err := r.btManager.GetAdapters()
+	if err != nil {
+		log.Printf("RSSI Recorder: failed to list adapters: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, adapter := range adapters {
+		devices, err := r.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			log.Printf("RSSI Recorder: failed to list devices of %s: %v", adapter.Address, err)
+			continue
+		}
+
+		for _, device := range devices {
+			if !tracked[database.RSSITrackedDevice{Adapter: adapter.Address, Address: device.Address}] || device.RSSI == nil {
+				continue
+			}
+
+			err := database.InsertRSSISample(r.db, database.RSSISample{
+				Adapter:    adapter.Address,
+				Address:    device.Address,
+				RSSI:       int(*device.RSSI),
+				RecordedAt: now,
+			})
+			if err != nil {
+				log.Printf("RSSI Recorder: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package rssi
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder_Sample(t *testing.T) {
+	// Setup
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rssi := int16(-62)
+	btMock.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00"},
+		{Path: "/org/bluez/hci1", Address: "AA:BB:CC:DD:EE:01"},
+	}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66", Name: "Tag", RSSI: &rssi},
+		{Address: "22:33:44:55:66:77", Name: "Untracked", RSSI: &rssi},
+		{Address: "33:44:55:66:77:88", Name: "Out of range"},
+	}, nil)
+	btMock.On("GetDevices", "/org/bluez/hci1").Return(nil, errors.New("adapter removed"))
+
+	dbMock.ExpectQuery("SELECT adapter, address FROM rssi_tracked_devices").
+		WillReturnRows(sqlmock.NewRows([]string{"adapter", "address"}).
+			AddRow("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66").
+			AddRow("AA:BB:CC:DD:EE:00", "33:44:55:66:77:88").
+			AddRow("AA:BB:CC:DD:EE:01", "22:33:44:55:66:77"))
+	dbMock.ExpectExec("INSERT INTO rssi_history").
+		WithArgs("AA:BB:CC:DD:EE:00", "11:22:33:44:55:66", -62, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	r := NewRecorder(btMock, db, time.Minute)
+
+	// Test - only the device tracked on the adapter and reporting an RSSI is recorded, a failing
+	// adapter is skipped
+	r.Sample()
+
+	// Assert
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestRecorder_SampleWithoutTrackedDevices(t *testing.T) {
+	// Setup
+	btMock := bluetooth.NewMockBluetoothManager(t)
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	dbMock.ExpectQuery("SELECT adapter, address FROM rssi_tracked_devices").
+		WillReturnRows(sqlmock.NewRows([]string{"adapter", "address"}))
+
+	r := NewRecorder(btMock, db, time.Minute)
+
+	// Test - the adapters are not listed when no device is tracked
+	r.Sample()
+
+	// Assert
+	btMock.AssertNotCalled(t, "GetAdapters")
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
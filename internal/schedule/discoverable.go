@@ -0,0 +1,244 @@
+package schedule
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+const (
+	// EventDiscoverableWindowOpened is published when a schedule makes an adapter discoverable
+	EventDiscoverableWindowOpened = "discoverable_window_opened"
+	// EventDiscoverableWindowClosed is published when a schedule window closes
+	EventDiscoverableWindowClosed = "discoverable_window_closed"
+)
+
+// WindowEvent is the payload of the discoverable window events
+type WindowEvent struct {
+	ScheduleID int64  `json:"schedule_id"`
+	Name       string `json:"name"`
+	Adapter    string `json:"adapter"`
+	// EndsAt is only set when the window opens
+	EndsAt *time.Time `json:"ends_at,omitempty"`
+}
+
+// OpenWindow describes an adapter kept discoverable by schedules
+type OpenWindow struct {
+	Adapter string `json:"adapter"`
+	// Schedules are the IDs of the schedules whose window is open on the adapter
+	Schedules []int64   `json:"schedules"`
+	EndsAt    time.Time `json:"ends_at"`
+}
+
+// discoverableWindow is an adapter kept discoverable by the open windows of one or more schedules
+type discoverableWindow struct {
+	adapterPath string
+	adapter     string
+	// schedules are the open schedules by ID, along with the end of their window
+	schedules map[int64]openSchedule
+}
+
+type openSchedule struct {
+	name     string
+	pairable bool
+	endsAt   time.Time
+}
+
+// DiscoverableScheduler opens and closes the discoverable windows of the schedules. The states of
+// the adapters go through the visibility arbiter, shared with guest mode, which restores them once
+// the windows of both closed.
+type DiscoverableScheduler struct {
+	btManager  bluetooth.BluetoothManagerInterface
+	db         database.DatabaseInterface
+	visibility *bluetooth.Visibility
+	interval   time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	windows map[string]*discoverableWindow
+}
+
+// NewDiscoverableScheduler creates a scheduler checking the schedules at every interval
+func NewDiscoverableScheduler(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, visibility *bluetooth.Visibility, interval time.Duration) *DiscoverableScheduler {
+	return &DiscoverableScheduler{
+		btManager:  btManager,
+		db:         db,
+		visibility: visibility,
+		interval:   interval,
+		now:        time.Now,
+		windows:    make(map[string]*discoverableWindow),
+	}
+}
+
+// Run checks the schedules at every interval until the context is cancelled, then reverts the
+// adapters of the open windows
+func (s *DiscoverableScheduler) Run(ctx context.Context, hub *events.Hub) {
+	s.Check(hub)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.closeAll(hub)
+			return
+		case <-ticker.C:
+			s.Check(hub)
+		}
+	}
+}
+
+// Check opens the windows of the schedules due now and closes the others, which also applies the
+// changes made to the schedules
+func (s *DiscoverableScheduler) Check(hub *events.Hub) {
+	schedules, err := database.GetEnabledDiscoverableSchedules(s.db)
+	if err != nil {
+		log.Printf("Discoverable schedules: %v", err)
+		return
+	}
+	adapters, err := s.btManager.GetAdapters()
+	if err != nil {
+		log.Printf("Discoverable schedules: failed to get adapters: %v", err)
+		return
+	}
+
+	// The schedules due now, by adapter
+	now := s.now()
+	due := make(map[string]map[int64]openSchedule)
+	for _, schedule := range schedules {
+		w, err := ParseWindow(schedule.Days, schedule.Start, schedule.End)
+		if err != nil {
+			log.Printf("Discoverable schedules: schedule %q: %v", schedule.Name, err)
+			continue
+		}
+		endsAt, ok := w.EndAfter(now)
+		if !ok {
+			continue
+		}
+		adapter := findAdapter(adapters, schedule.Adapter)
+		if adapter == nil {
+			continue
+		}
+		if due[adapter.Address] == nil {
+			due[adapter.Address] = make(map[int64]openSchedule)
+		}
+		due[adapter.Address][schedule.ID] = openSchedule{name: schedule.Name, pairable: schedule.Pairable, endsAt: endsAt}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for address, w := range s.windows {
+		for id, open := range w.schedules {
+			if _, ok := due[address][id]; !ok {
+				delete(w.schedules, id)
+				log.Printf("Discoverable schedules: window of %q closed on adapter %s", open.name, address)
+				hub.Publish(EventDiscoverableWindowClosed, WindowEvent{ScheduleID: id, Name: open.name, Adapter: address})
+			}
+		}
+		if len(w.schedules) == 0 {
+			s.revert(w)
+			delete(s.windows, address)
+		}
+	}
+
+	for _, adapter := range adapters {
+		opening, ok := due[adapter.Address]
+		if !ok {
+			continue
+		}
+		w := s.windows[adapter.Address]
+		if w == nil {
+			w = &discoverableWindow{
+				adapterPath: adapter.Path,
+				adapter:     adapter.Address,
+				schedules:   make(map[int64]openSchedule),
+			}
+			s.windows[adapter.Address] = w
+		}
+		for id, open := range opening {
+			if _, ok := w.schedules[id]; !ok {
+				endsAt := open.endsAt
+				log.Printf("Discoverable schedules: window of %q open on adapter %s until %s", open.name, adapter.Address, endsAt.Format(time.RFC3339))
+				hub.Publish(EventDiscoverableWindowOpened, WindowEvent{ScheduleID: id, Name: open.name, Adapter: adapter.Address, EndsAt: &endsAt})
+			}
+			w.schedules[id] = open
+		}
+		s.keepOpen(w, adapter)
+	}
+}
+
+// Windows returns the open windows
+func (s *DiscoverableScheduler) Windows() []OpenWindow {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	windows := []OpenWindow{}
+	for _, w := range s.windows {
+		open := OpenWindow{Adapter: w.adapter, Schedules: []int64{}}
+		for id, schedule := range w.schedules {
+			open.Schedules = append(open.Schedules, id)
+			if schedule.endsAt.After(open.EndsAt) {
+				open.EndsAt = schedule.endsAt
+			}
+		}
+		sort.Slice(open.Schedules, func(i, j int) bool { return open.Schedules[i] < open.Schedules[j] })
+		windows = append(windows, open)
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].Adapter < windows[j].Adapter })
+	return windows
+}
+
+// keepOpen makes the adapter discoverable, and pairable when a schedule asks for it, again when
+// bluetoothd turned it off during the window, e.g. once its DiscoverableTimeout elapsed
+func (s *DiscoverableScheduler) keepOpen(w *discoverableWindow, adapter bluetooth.Adapter) {
+	pairable := false
+	for _, schedule := range w.schedules {
+		pairable = pairable || schedule.pairable
+	}
+	if err := s.visibility.Open(bluetooth.VisibilitySchedule, adapter, pairable); err != nil {
+		log.Printf("Discoverable schedules: %v", err)
+	}
+}
+
+// revert puts the discoverable and pairable states of the adapter back as they were before the
+// window, unless a guest window keeps it open
+func (s *DiscoverableScheduler) revert(w *discoverableWindow) {
+	if err := s.visibility.Close(bluetooth.VisibilitySchedule, w.adapterPath); err != nil {
+		log.Printf("Discoverable schedules: failed to revert adapter %s: %v", w.adapter, err)
+	}
+}
+
+// closeAll closes the open windows
+func (s *DiscoverableScheduler) closeAll(hub *events.Hub) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for address, w := range s.windows {
+		for id, open := range w.schedules {
+			hub.Publish(EventDiscoverableWindowClosed, WindowEvent{ScheduleID: id, Name: open.name, Adapter: address})
+		}
+		s.revert(w)
+		delete(s.windows, address)
+	}
+}
+
+// findAdapter returns the powered adapter of an address, or the first powered adapter when it is empty
+func findAdapter(adapters []bluetooth.Adapter, address string) *bluetooth.Adapter {
+	for i, adapter := range adapters {
+		if !adapter.Powered {
+			continue
+		}
+		if address == "" || strings.EqualFold(adapter.Address, address) {
+			return &adapters[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverableScheduler_Check(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	columns := []string{"id", "name", "adapter", "days", "start_time", "end_time", "pairable", "enabled", "created_at", "updated_at"}
+	schedules := func() {
+		dbMock.ExpectQuery("FROM discoverable_schedules WHERE enabled = 1").WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, "guests", "", "saturday", "10:00", "12:00", true, true, time.Now(), time.Now()).
+			AddRow(2, "sunday", "00:1A:7D:DA:71:01", "sunday", "10:00", "12:00", false, true, time.Now(), time.Now()))
+	}
+
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true}}, nil).Once()
+	btManager.On("SetPairable", "/org/bluez/hci0", true).Return(nil).Once()
+	btManager.On("SetDiscoverable", "/org/bluez/hci0", true).Return(nil).Once()
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true, Discoverable: true, Pairable: true}}, nil)
+	btManager.On("SetDiscoverable", "/org/bluez/hci0", false).Return(nil).Once()
+	btManager.On("SetPairable", "/org/bluez/hci0", false).Return(nil).Once()
+
+	hub := events.NewHub()
+	ch, unsubscribe := hub.SubscribeTypes(EventDiscoverableWindowOpened, EventDiscoverableWindowClosed)
+	defer unsubscribe()
+	s := NewDiscoverableScheduler(btManager, db, bluetooth.NewVisibility(btManager), time.Minute)
+	saturday := time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local)
+
+	// Saturday 11:00, the guests window opens
+	s.now = func() time.Time { return saturday.Add(11 * time.Hour) }
+	schedules()
+	s.Check(hub)
+	event := <-ch
+	assert.Equal(t, EventDiscoverableWindowOpened, event.Type)
+	endsAt := saturday.Add(12 * time.Hour)
+	assert.Equal(t, WindowEvent{ScheduleID: 1, Name: "guests", Adapter: "00:1A:7D:DA:71:01", EndsAt: &endsAt}, event.Data)
+	assert.Equal(t, []OpenWindow{{Adapter: "00:1A:7D:DA:71:01", Schedules: []int64{1}, EndsAt: endsAt}}, s.Windows())
+
+	// Still open, nothing changes
+	s.now = func() time.Time { return saturday.Add(11*time.Hour + 30*time.Minute) }
+	schedules()
+	s.Check(hub)
+
+	// Saturday 12:00, the adapter reverts
+	s.now = func() time.Time { return saturday.Add(12 * time.Hour) }
+	schedules()
+	s.Check(hub)
+	event = <-ch
+	assert.Equal(t, EventDiscoverableWindowClosed, event.Type)
+	assert.Equal(t, WindowEvent{ScheduleID: 1, Name: "guests", Adapter: "00:1A:7D:DA:71:01"}, event.Data)
+	assert.Empty(t, s.Windows())
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
@@ -0,0 +1,263 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+const (
+	// EventQuietHoursStarted is published when the quiet hours power the adapters off
+	EventQuietHoursStarted = "quiet_hours_started"
+	// EventQuietHoursEnded is published when the adapters are powered back on
+	EventQuietHoursEnded = "quiet_hours_ended"
+)
+
+// ErrQuietHoursInactive is returned when overriding the quiet hours outside of them without an end
+var ErrQuietHoursInactive = errors.New("quiet hours are not active")
+
+// QuietHoursEvent is the payload of the quiet hours events
+type QuietHoursEvent struct {
+	// Adapters are the addresses of the adapters powered off or back on
+	Adapters []string `json:"adapters"`
+	// EndsAt is only set when the quiet hours start
+	EndsAt *time.Time `json:"ends_at,omitempty"`
+}
+
+// QuietHoursState describes the quiet hours policy
+type QuietHoursState struct {
+	Enabled bool     `json:"enabled"`
+	Start   string   `json:"start,omitempty"`
+	End     string   `json:"end,omitempty"`
+	Days    []string `json:"days,omitempty"`
+	// Adapters are the adapters the policy applies to, every adapter when empty
+	Adapters []string `json:"adapters"`
+	Active   bool     `json:"active"`
+	// PoweredOff are the adapters powered off by the policy, which get powered back on
+	PoweredOff    []string   `json:"powered_off"`
+	EndsAt        *time.Time `json:"ends_at,omitempty"`
+	OverrideUntil *time.Time `json:"override_until,omitempty"`
+}
+
+// ParseQuietHours parses quiet hours such as 23:00-07:00 on days of the week, every day when none
+// are given
+func ParseQuietHours(hours string, days []string) (Window, error) {
+	start, end, ok := strings.Cut(hours, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("%q is not an HH:MM-HH:MM range", hours)
+	}
+	if len(days) == 0 {
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			days = append(days, day.String())
+		}
+	}
+	return ParseWindow(days, strings.TrimSpace(start), strings.TrimSpace(end))
+}
+
+// QuietHours powers off adapters during the quiet hours, such as at night to reduce RF noise and
+// power draw, and powers them back on afterwards. Only the adapters powered when the quiet hours
+// start are powered off, and only those are powered back on.
+type QuietHours struct {
+	btManager bluetooth.BluetoothManagerInterface
+	window    *Window
+	adapters  []string
+	interval  time.Duration
+	now       func() time.Time
+
+	mu            sync.Mutex
+	active        bool
+	endsAt        time.Time
+	overrideUntil time.Time
+	// poweredOff are the paths of the adapters powered off, by address
+	poweredOff map[string]string
+}
+
+// NewQuietHours creates a policy powering off the adapters of the given addresses, or every adapter
+// when none are given, during a window. A nil window disables the policy.
+func NewQuietHours(btManager bluetooth.BluetoothManagerInterface, window *Window, adapters []string, interval time.Duration) *QuietHours {
+	return &QuietHours{
+		btManager:  btManager,
+		window:     window,
+		adapters:   adapters,
+		interval:   interval,
+		now:        time.Now,
+		poweredOff: make(map[string]string),
+	}
+}
+
+// Run applies the policy at every interval until the context is cancelled, then powers the adapters
+// back on
+func (q *QuietHours) Run(ctx context.Context, hub *events.Hub) {
+	if q.window == nil {
+		return
+	}
+	q.Check(hub)
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			q.mu.Lock()
+			q.end(hub)
+			q.mu.Unlock()
+			return
+		case <-ticker.C:
+			q.Check(hub)
+		}
+	}
+}
+
+// Check starts or ends the quiet hours when due
+func (q *QuietHours) Check(hub *events.Hub) {
+	if q.window == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	endsAt, due := q.window.EndAfter(now)
+	if due && now.Before(q.overrideUntil) {
+		due = false
+	}
+	switch {
+	case due && !q.active:
+		q.start(hub, endsAt)
+	case !due && q.active:
+		q.end(hub)
+	}
+}
+
+// Override suspends the quiet hours until a time, powering the adapters back on at once. A zero
+// time suspends them until the end of the current quiet hours.
+func (q *QuietHours) Override(hub *events.Hub, until time.Time) (time.Time, error) {
+	if q.window == nil {
+		return time.Time{}, ErrQuietHoursInactive
+	}
+	if until.IsZero() {
+		endsAt, ok := q.window.EndAfter(q.now())
+		if !ok {
+			return time.Time{}, ErrQuietHoursInactive
+		}
+		until = endsAt
+	}
+
+	q.mu.Lock()
+	q.overrideUntil = until
+	q.mu.Unlock()
+	log.Printf("Quiet hours: overridden until %s", until.Format(time.RFC3339))
+	q.Check(hub)
+	return until, nil
+}
+
+// ClearOverride resumes the quiet hours
+func (q *QuietHours) ClearOverride(hub *events.Hub) {
+	q.mu.Lock()
+	q.overrideUntil = time.Time{}
+	q.mu.Unlock()
+	q.Check(hub)
+}
+
+// State returns the state of the policy
+func (q *QuietHours) State() QuietHoursState {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	state := QuietHoursState{Adapters: q.adapters, PoweredOff: []string{}}
+	if state.Adapters == nil {
+		state.Adapters = []string{}
+	}
+	if q.window == nil {
+		return state
+	}
+	state.Enabled = true
+	state.Start = formatClock(q.window.Start)
+	state.End = formatClock(q.window.End)
+	for _, day := range q.window.Days {
+		state.Days = append(state.Days, strings.ToLower(day.String()))
+	}
+	state.Active = q.active
+	if q.active {
+		endsAt := q.endsAt
+		state.EndsAt = &endsAt
+	}
+	for address := range q.poweredOff {
+		state.PoweredOff = append(state.PoweredOff, address)
+	}
+	sort.Strings(state.PoweredOff)
+	if q.now().Before(q.overrideUntil) {
+		until := q.overrideUntil
+		state.OverrideUntil = &until
+	}
+	return state
+}
+
+// start powers off the selected adapters which are powered
+func (q *QuietHours) start(hub *events.Hub, endsAt time.Time) {
+	adapters, err := q.btManager.GetAdapters()
+	if err != nil {
+		log.Printf("Quiet hours: failed to get adapters: %v", err)
+		return
+	}
+	q.active, q.endsAt = true, endsAt
+
+	off := []string{}
+	for _, adapter := range adapters {
+		if !adapter.Powered || !q.selected(adapter.Address) {
+			continue
+		}
+		if err := q.btManager.SetPowered(adapter.Path, false); err != nil {
+			log.Printf("Quiet hours: failed to power off adapter %s: %v", adapter.Address, err)
+			continue
+		}
+		q.poweredOff[adapter.Address] = adapter.Path
+		off = append(off, adapter.Address)
+	}
+
+	log.Printf("Quiet hours: powered off %d adapter(s) until %s", len(off), endsAt.Format(time.RFC3339))
+	hub.Publish(EventQuietHoursStarted, QuietHoursEvent{Adapters: off, EndsAt: &endsAt})
+}
+
+// end powers the adapters powered off back on
+func (q *QuietHours) end(hub *events.Hub) {
+	if !q.active {
+		return
+	}
+	q.active = false
+
+	on := []string{}
+	for address, path := range q.poweredOff {
+		if err := q.btManager.SetPowered(path, true); err != nil {
+			log.Printf("Quiet hours: failed to power on adapter %s: %v", address, err)
+		} else {
+			on = append(on, address)
+		}
+		delete(q.poweredOff, address)
+	}
+	sort.Strings(on)
+
+	log.Printf("Quiet hours: powered %d adapter(s) back on", len(on))
+	hub.Publish(EventQuietHoursEnded, QuietHoursEvent{Adapters: on})
+}
+
+// selected reports whether the policy applies to an adapter
+func (q *QuietHours) selected(address string) bool {
+	return len(q.adapters) == 0 || slices.ContainsFunc(q.adapters, func(a string) bool {
+		return strings.EqualFold(a, address)
+	})
+}
+
+// formatClock formats an offset from midnight as an HH:MM time
+func formatClock(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset.Hours()), int(offset.Minutes())%60)
+}
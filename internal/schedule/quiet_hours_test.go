@@ -0,0 +1,84 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	w, err := ParseQuietHours("23:00-07:00", nil)
+	assert.NoError(t, err)
+	assert.Len(t, w.Days, 7)
+	assert.Equal(t, 23*time.Hour, w.Start)
+	assert.Equal(t, 7*time.Hour, w.End)
+
+	w, err = ParseQuietHours("22:30 - 06:00", []string{"fri", "sat"})
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Weekday{time.Friday, time.Saturday}, w.Days)
+
+	_, err = ParseQuietHours("23:00", nil)
+	assert.Error(t, err)
+	_, err = ParseQuietHours("23:00-07:00", []string{"someday"})
+	assert.Error(t, err)
+}
+
+func TestQuietHours_Check(t *testing.T) {
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true},
+		{Path: "/org/bluez/hci1", Address: "00:1A:7D:DA:71:02", Powered: true},
+		{Path: "/org/bluez/hci2", Address: "00:1A:7D:DA:71:03"},
+	}, nil)
+	btManager.On("SetPowered", "/org/bluez/hci0", false).Return(nil).Twice()
+	btManager.On("SetPowered", "/org/bluez/hci0", true).Return(nil).Twice()
+
+	w, err := ParseQuietHours("23:00-07:00", nil)
+	assert.NoError(t, err)
+	hub := events.NewHub()
+	ch, unsubscribe := hub.SubscribeTypes(EventQuietHoursStarted, EventQuietHoursEnded)
+	defer unsubscribe()
+	q := NewQuietHours(btManager, &w, []string{"00:1a:7d:da:71:01", "00:1A:7D:DA:71:03"}, time.Minute)
+	midnight := time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local)
+
+	// 22:00, nothing happens
+	q.now = func() time.Time { return midnight.Add(-2 * time.Hour) }
+	q.Check(hub)
+	assert.False(t, q.State().Active)
+
+	// 23:00, the selected powered adapter is powered off
+	q.now = func() time.Time { return midnight.Add(-time.Hour) }
+	q.Check(hub)
+	event := <-ch
+	assert.Equal(t, EventQuietHoursStarted, event.Type)
+	endsAt := midnight.Add(7 * time.Hour)
+	assert.Equal(t, QuietHoursEvent{Adapters: []string{"00:1A:7D:DA:71:01"}, EndsAt: &endsAt}, event.Data)
+	state := q.State()
+	assert.True(t, state.Active)
+	assert.Equal(t, []string{"00:1A:7D:DA:71:01"}, state.PoweredOff)
+
+	// The override powers it back on until its end
+	q.now = func() time.Time { return midnight.Add(time.Hour) }
+	until, err := q.Override(hub, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, endsAt, until)
+	event = <-ch
+	assert.Equal(t, EventQuietHoursEnded, event.Type)
+	assert.Equal(t, QuietHoursEvent{Adapters: []string{"00:1A:7D:DA:71:01"}}, event.Data)
+	assert.Equal(t, &endsAt, q.State().OverrideUntil)
+
+	// Clearing the override resumes the quiet hours, which end at 07:00
+	q.ClearOverride(hub)
+	assert.Equal(t, EventQuietHoursStarted, (<-ch).Type)
+	q.now = func() time.Time { return midnight.Add(7 * time.Hour) }
+	q.Check(hub)
+	assert.Equal(t, EventQuietHoursEnded, (<-ch).Type)
+	assert.Empty(t, q.State().PoweredOff)
+
+	// Outside of the quiet hours, an override needs an end
+	_, err = q.Override(hub, time.Time{})
+	assert.ErrorIs(t, err, ErrQuietHoursInactive)
+}
@@ -0,0 +1,97 @@
+// Package schedule opens recurring windows, such as discoverable windows for guests on Saturday
+// mornings, and reverts the adapters once they close
+package schedule
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Window is a recurring time range of the days of the week, in the local time of the host. A window
+// ending before it starts runs past midnight, until its end on the next day.
+type Window struct {
+	Days []time.Weekday
+	// Start and End are offsets from midnight
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseWindow parses a window from day names, such as saturday or sat, and HH:MM start and end times
+func ParseWindow(days []string, start, end string) (Window, error) {
+	var w Window
+	if len(days) == 0 {
+		return w, fmt.Errorf("at least one day is required")
+	}
+	for _, name := range days {
+		day, err := ParseDay(name)
+		if err != nil {
+			return w, err
+		}
+		if !slices.Contains(w.Days, day) {
+			w.Days = append(w.Days, day)
+		}
+	}
+
+	var err error
+	if w.Start, err = ParseClock(start); err != nil {
+		return w, fmt.Errorf("invalid start: %w", err)
+	}
+	if w.End, err = ParseClock(end); err != nil {
+		return w, fmt.Errorf("invalid end: %w", err)
+	}
+	if w.Start == w.End {
+		return w, fmt.Errorf("start and end must differ")
+	}
+	return w, nil
+}
+
+// ParseDay parses the English name of a day of the week, in full or abbreviated to three letters
+func ParseDay(name string) (time.Weekday, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", name)
+}
+
+// ParseClock parses an HH:MM time of day into an offset from midnight
+func ParseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an HH:MM time", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether a time falls within the window
+func (w Window) Contains(t time.Time) bool {
+	_, ok := w.EndAfter(t)
+	return ok
+}
+
+// EndAfter returns the end of the occurrence of the window containing a time, if any
+func (w Window) EndAfter(t time.Time) (time.Time, bool) {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	if w.Start < w.End {
+		if slices.Contains(w.Days, t.Weekday()) && offset >= w.Start && offset < w.End {
+			return midnight.Add(w.End), true
+		}
+		return time.Time{}, false
+	}
+
+	// Past midnight, the window started on the day before
+	if slices.Contains(w.Days, t.Weekday()) && offset >= w.Start {
+		return midnight.AddDate(0, 0, 1).Add(w.End), true
+	}
+	if slices.Contains(w.Days, t.AddDate(0, 0, -1).Weekday()) && offset < w.End {
+		return midnight.Add(w.End), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,46 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWindow(t *testing.T) {
+	w, err := ParseWindow([]string{"Saturday", "sun", "sat"}, "10:00", "12:30")
+	assert.NoError(t, err)
+	assert.Equal(t, Window{Days: []time.Weekday{time.Saturday, time.Sunday}, Start: 10 * time.Hour, End: 12*time.Hour + 30*time.Minute}, w)
+
+	_, err = ParseWindow(nil, "10:00", "12:00")
+	assert.Error(t, err)
+	_, err = ParseWindow([]string{"caturday"}, "10:00", "12:00")
+	assert.Error(t, err)
+	_, err = ParseWindow([]string{"saturday"}, "25:00", "12:00")
+	assert.Error(t, err)
+	_, err = ParseWindow([]string{"saturday"}, "10:00", "10:00")
+	assert.Error(t, err)
+}
+
+func TestWindow_EndAfter(t *testing.T) {
+	// Saturday 10:00 to 12:00
+	morning := Window{Days: []time.Weekday{time.Saturday}, Start: 10 * time.Hour, End: 12 * time.Hour}
+	saturday := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+
+	end, ok := morning.EndAfter(saturday.Add(10 * time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, saturday.Add(12*time.Hour), end)
+	assert.False(t, morning.Contains(saturday.Add(12*time.Hour)))
+	assert.False(t, morning.Contains(saturday.AddDate(0, 0, 1).Add(11*time.Hour)))
+
+	// Friday 22:00 to Saturday 07:00
+	night := Window{Days: []time.Weekday{time.Friday}, Start: 22 * time.Hour, End: 7 * time.Hour}
+	end, ok = night.EndAfter(saturday.Add(-time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, saturday.Add(7*time.Hour), end)
+	end, ok = night.EndAfter(saturday.Add(6 * time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, saturday.Add(7*time.Hour), end)
+	assert.False(t, night.Contains(saturday.Add(22*time.Hour)))
+	assert.False(t, night.Contains(saturday.Add(-3*time.Hour)))
+}
@@ -0,0 +1,213 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	// KeySize is the size in bytes of AES-256 keys
+	KeySize = 32
+	// encryptedPrefix marks values encrypted by a Cipher
+	encryptedPrefix = "enc:v1:"
+)
+
+// ErrNoKey is returned when decrypting an encrypted value without a configured key
+var ErrNoKey = errors.New("value is encrypted but no encryption key is configured")
+
+// Cipher encrypts and decrypts values stored at rest using AES-GCM.
+// A nil Cipher passes values through unchanged, which keeps encryption optional.
+type Cipher struct {
+	mu       sync.RWMutex
+	key      []byte
+	keyFile  string
+	current  cipher.AEAD
+	previous cipher.AEAD
+}
+
+// NewCipher creates a new cipher from a 32 bytes key
+func NewCipher(key []byte) (*Cipher, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{key: key, current: aead}, nil
+}
+
+// Load creates a cipher from a key value or, if empty, from a key file.
+// It returns a nil cipher when neither is set.
+func Load(value, file string) (*Cipher, error) {
+	if value == "" && file != "" {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read encryption key file: %w", err)
+		}
+		value = string(content)
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	key, err := ParseKey(value)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if file != "" {
+		c.keyFile = file
+	}
+	return c, nil
+}
+
+// ParseKey decodes a hex or base64 encoded 32 bytes key
+func ParseKey(value string) ([]byte, error) {
+	if key, err := hex.DecodeString(value); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(value); err == nil && len(key) == KeySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key must be %d bytes encoded as hex or base64", KeySize)
+}
+
+// GenerateKey returns a new random key
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	return key, nil
+}
+
+// EncodeKey encodes a key as base64, the format accepted by ParseKey
+func EncodeKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// IsEncrypted reports whether a value was produced by Encrypt
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// Enabled reports whether values are encrypted
+func (c *Cipher) Enabled() bool {
+	return c != nil
+}
+
+// Encrypt encrypts a value, or returns it unchanged when encryption is disabled
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if c == nil {
+		return plaintext, nil
+	}
+
+	c.mu.RLock()
+	aead := c.current
+	c.mu.RUnlock()
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt. Plaintext values are returned unchanged
+// so that data written before encryption was enabled stays readable.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if c == nil {
+		return "", ErrNoKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted value: %w", err)
+	}
+
+	c.mu.RLock()
+	candidates := []cipher.AEAD{c.current, c.previous}
+	c.mu.RUnlock()
+
+	for _, aead := range candidates {
+		if aead == nil || len(sealed) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if plaintext, err := aead.Open(nil, nonce, ciphertext, nil); err == nil {
+			return string(plaintext), nil
+		}
+	}
+
+	return "", errors.New("failed to decrypt value: wrong key or corrupted data")
+}
+
+// Rotate switches to a new key. The previous key is kept to decrypt values
+// that have not been re-encrypted yet.
+func (c *Cipher) Rotate(key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.previous = c.current
+	c.current = aead
+	c.key = key
+	return nil
+}
+
+// Key returns the current key
+func (c *Cipher) Key() []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.key
+}
+
+// KeyFile returns the file the key was loaded from, if any
+func (c *Cipher) KeyFile() string {
+	return c.keyFile
+}
+
+// WriteKeyFile writes a key to path with owner-only permissions
+func WriteKeyFile(path string, key []byte) error {
+	if err := os.WriteFile(path, []byte(EncodeKey(key)+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write encryption key file: %w", err)
+	}
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
@@ -0,0 +1,75 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCipher_RoundTrip(t *testing.T) {
+	key, err := GenerateKey()
+	assert.NoError(t, err)
+
+	c, err := NewCipher(key)
+	assert.NoError(t, err)
+
+	encrypted, err := c.Encrypt("secret123")
+	assert.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.NotContains(t, encrypted, "secret123")
+
+	plaintext, err := c.Decrypt(encrypted)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret123", plaintext)
+}
+
+func TestCipher_PlaintextPassthrough(t *testing.T) {
+	var disabled *Cipher
+
+	value, err := disabled.Encrypt("secret123")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret123", value)
+
+	value, err = disabled.Decrypt("secret123")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret123", value)
+
+	key, _ := GenerateKey()
+	c, _ := NewCipher(key)
+	encrypted, _ := c.Encrypt("secret123")
+
+	_, err = disabled.Decrypt(encrypted)
+	assert.ErrorIs(t, err, ErrNoKey)
+}
+
+func TestCipher_Rotate(t *testing.T) {
+	oldKey, _ := GenerateKey()
+	newKey, _ := GenerateKey()
+
+	c, err := NewCipher(oldKey)
+	assert.NoError(t, err)
+	oldValue, _ := c.Encrypt("secret123")
+
+	assert.NoError(t, c.Rotate(newKey))
+	assert.Equal(t, newKey, c.Key())
+
+	// Values encrypted with the previous key stay readable until re-encrypted
+	plaintext, err := c.Decrypt(oldValue)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret123", plaintext)
+
+	other, _ := NewCipher(newKey)
+	_, err = other.Decrypt(oldValue)
+	assert.Error(t, err)
+}
+
+func TestParseKey(t *testing.T) {
+	key, _ := GenerateKey()
+
+	parsed, err := ParseKey(EncodeKey(key))
+	assert.NoError(t, err)
+	assert.Equal(t, key, parsed)
+
+	_, err = ParseKey("too-short")
+	assert.Error(t, err)
+}
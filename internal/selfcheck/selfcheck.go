@@ -0,0 +1,120 @@
+// Package selfcheck verifies the broker can start: its configuration, database, Bluetooth backend
+// and WirePlumber configuration directory. It is meant to run before the server, e.g. as the
+// ExecStartPre of its systemd unit, so that a broken setup is reported before the service starts.
+package selfcheck
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/config"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/wireplumber"
+)
+
+// Check is a named verification, returning a short description of what it found
+type Check struct {
+	Name string
+	Run  func() (string, error)
+}
+
+// Checks returns the checks of a configuration. When it failed to load, only its errors are
+// reported since the other checks depend on it.
+func Checks(cfg *config.Config, cfgErr error) []Check {
+	if cfgErr != nil {
+		return []Check{{Name: "config", Run: func() (string, error) { return "", cfgErr }}}
+	}
+
+	return []Check{
+		{Name: "config", Run: func() (string, error) { return "environment variables are valid", nil }},
+		{Name: "database", Run: func() (string, error) { return checkDatabase(cfg.DatabasePath, cfg.DatabaseOptions()) }},
+		{Name: "bluetooth", Run: func() (string, error) { return checkBluetooth(cfg.BluetoothBackend) }},
+		{Name: "wireplumber", Run: checkWirePlumber},
+	}
+}
+
+// Run runs every check and writes a line per check, it returns false when one of them failed
+func Run(w io.Writer, checks []Check) bool {
+	ok := true
+	for _, check := range checks {
+		detail, err := check.Run()
+		if err != nil {
+			ok = false
+			fmt.Fprintf(w, "FAIL %s: %v\n", check.Name, err)
+			continue
+		}
+		fmt.Fprintf(w, "OK   %s: %s\n", check.Name, detail)
+	}
+	return ok
+}
+
+// checkDatabase opens the database and checks its schema can be migrated by this binary
+func checkDatabase(path string, opts database.Options) (string, error) {
+	db, err := database.InitDBWithOptions(path, opts)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+
+	var journalMode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		return "", fmt.Errorf("failed to read journal mode: %w", err)
+	}
+
+	version, dirty, err := database.SchemaVersion(db)
+	if err != nil {
+		return "", err
+	}
+	latest, err := database.LatestSchemaVersion()
+	if err != nil {
+		return "", err
+	}
+	if dirty {
+		return "", fmt.Errorf("migration %d of %s failed halfway and must be fixed by hand", version, path)
+	}
+	if version > latest {
+		return "", fmt.Errorf("schema version %d of %s is newer than the latest known version %d, the broker was downgraded", version, path, latest)
+	}
+	if version < latest {
+		return fmt.Sprintf("%s opened in %s journal mode, schema version %d will be migrated to %d", path, journalMode, version, latest), nil
+	}
+	return fmt.Sprintf("%s opened in %s journal mode, schema version %d", path, journalMode, version), nil
+}
+
+// checkBluetooth creates the Bluetooth backend and lists its adapters. The dbus backend must not
+// fall back to the kernel one, as that means BlueZ is not running.
+func checkBluetooth(backend string) (string, error) {
+	btManager, err := bluetooth.NewBackend(backend, bluetooth.Options{})
+	if err != nil {
+		return "", err
+	}
+	defer btManager.Close()
+
+	if _, fallback := btManager.(*bluetooth.KernelManager); fallback && backend == bluetooth.BackendDBus {
+		return "", errors.New("org.bluez is not on the system bus, is bluetoothd running?")
+	}
+	if err := btManager.Ping(); err != nil {
+		return "", fmt.Errorf("%s backend does not answer: %w", backend, err)
+	}
+	adapters, err := btManager.GetAdapters()
+	if err != nil {
+		return "", fmt.Errorf("failed to list adapters: %w", err)
+	}
+	return fmt.Sprintf("%s backend answers, %d adapter(s) found", backend, len(adapters)), nil
+}
+
+// checkWirePlumber checks the broker can write its configuration fragments for the audio stack of
+// the host, WirePlumber or PulseAudio
+func checkWirePlumber() (string, error) {
+	cm, err := wireplumber.Detect()
+	if err != nil {
+		return "", err
+	}
+	if err := cm.CheckWritable(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s is writable (%s)", filepath.Dir(cm.GetConfigPath()), cm.Stack()), nil
+}
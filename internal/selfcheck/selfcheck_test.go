@@ -0,0 +1,68 @@
+package selfcheck
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/config"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	ok := Run(&out, []Check{
+		{Name: "first", Run: func() (string, error) { return "fine", nil }},
+		{Name: "second", Run: func() (string, error) { return "", errors.New("broken") }},
+	})
+	assert.False(t, ok)
+	assert.Equal(t, "OK   first: fine\nFAIL second: broken\n", out.String())
+
+	out.Reset()
+	assert.False(t, Run(&out, Checks(nil, errors.New("invalid PORT"))))
+	assert.Equal(t, "FAIL config: invalid PORT\n", out.String())
+}
+
+func TestChecks(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfg := &config.Config{
+		DatabasePath:     filepath.Join(t.TempDir(), "data.db"),
+		BluetoothBackend: bluetooth.BackendMock,
+	}
+
+	var out bytes.Buffer
+	assert.True(t, Run(&out, Checks(cfg, nil)), out.String())
+	assert.Contains(t, out.String(), "OK   database: "+cfg.DatabasePath+" opened in wal journal mode, schema version 0 will be migrated to")
+	assert.Contains(t, out.String(), "OK   bluetooth: mock backend answers, 2 adapter(s) found")
+	assert.Contains(t, out.String(), "OK   wireplumber: "+filepath.Join(home, ".config", "wireplumber", "wireplumber.conf.d")+" is writable")
+}
+
+func TestCheckDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	db, err := database.InitDB(path)
+	assert.NoError(t, err)
+	defer db.Close()
+	assert.NoError(t, database.RunMigrations(db))
+
+	latest, err := database.LatestSchemaVersion()
+	assert.NoError(t, err)
+	detail, err := checkDatabase(path, database.Options{})
+	assert.NoError(t, err)
+	assert.Contains(t, detail, "opened in wal journal mode, schema version")
+	assert.NotContains(t, detail, "will be migrated")
+
+	_, err = db.Exec("UPDATE schema_migrations SET version = ?, dirty = 1", latest)
+	assert.NoError(t, err)
+	_, err = checkDatabase(path, database.Options{})
+	assert.ErrorContains(t, err, "failed halfway")
+
+	_, err = db.Exec("UPDATE schema_migrations SET version = ?, dirty = 0", latest+1)
+	assert.NoError(t, err)
+	_, err = checkDatabase(path, database.Options{})
+	assert.ErrorContains(t, err, "the broker was downgraded")
+}
@@ -0,0 +1,62 @@
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Client sends metrics to a StatsD server over UDP. Metrics are fire-and-forget:
+// send errors are ignored so an unreachable server never slows the broker down.
+type Client struct {
+	conn   net.Conn
+	prefix string
+}
+
+// NewClient creates a client sending metrics to address (host:port), with names prefixed by prefix
+func NewClient(address, prefix string) (*Client, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open StatsD connection: %w", err)
+	}
+
+	prefix = strings.TrimSuffix(prefix, ".")
+	if prefix != "" {
+		prefix += "."
+	}
+
+	return &Client{conn: conn, prefix: prefix}, nil
+}
+
+// Close closes the UDP connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Count increments a counter
+func (c *Client) Count(name string, value int64) {
+	c.send(name, fmt.Sprintf("%d|c", value))
+}
+
+// Gauge sets a gauge to an absolute value
+func (c *Client) Gauge(name string, value int64) {
+	c.send(name, fmt.Sprintf("%d|g", value))
+}
+
+// Timing records a duration in milliseconds
+func (c *Client) Timing(name string, d time.Duration) {
+	c.send(name, fmt.Sprintf("%d|ms", d.Milliseconds()))
+}
+
+func (c *Client) send(name, value string) {
+	if c == nil {
+		return
+	}
+	c.conn.Write([]byte(c.prefix + name + ":" + value))
+}
+
+// SanitizeName makes a value such as a MAC address usable as a metric name segment
+func SanitizeName(value string) string {
+	return strings.NewReplacer(":", "_", ".", "_", "|", "_", "@", "_", "#", "_", " ", "_").Replace(strings.ToLower(value))
+}
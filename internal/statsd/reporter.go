@@ -0,0 +1,85 @@
+package statsd
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+)
+
+// Reporter periodically sends Bluetooth gauges: adapters, and per adapter its power state
+// and its known, paired and connected devices
+type Reporter struct {
+	btManager bluetooth.BluetoothManagerInterface
+	client    *Client
+	interval  time.Duration
+}
+
+// NewReporter creates a new Bluetooth gauges reporter
+func NewReporter(btManager bluetooth.BluetoothManagerInterface, client *Client, interval time.Duration) *Reporter {
+	return &Reporter{
+		btManager: btManager,
+		client:    client,
+		interval:  interval,
+	}
+}
+
+// Run reports the gauges every interval until the context is cancelled
+func (r *Reporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.Report()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Report sends the current Bluetooth gauges
+func (r *Reporter) Report() {
+	adapters, err := r.btManager.GetAdapters()
+	if err != nil {
+		log.Printf("StatsD Reporter: failed to list adapters: %v", err)
+		return
+	}
+
+	r.client.Gauge("bluetooth.adapters", int64(len(adapters)))
+
+	for _, adapter := range adapters {
+		prefix := "bluetooth.adapter." + SanitizeName(adapter.Address) + "."
+		r.client.Gauge(prefix+"powered", boolGauge(adapter.Powered))
+		r.client.Gauge(prefix+"discovering", boolGauge(adapter.Discovering))
+
+		devices, err := r.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			log.Printf("StatsD Reporter: failed to list devices of %s: %v", adapter.Address, err)
+			continue
+		}
+
+		var paired, connected int64
+		for _, device := range devices {
+			if device.Paired {
+				paired++
+			}
+			if device.Connected {
+				connected++
+			}
+		}
+		r.client.Gauge(prefix+"devices", int64(len(devices)))
+		r.client.Gauge(prefix+"devices.paired", paired)
+		r.client.Gauge(prefix+"devices.connected", connected)
+	}
+}
+
+func boolGauge(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
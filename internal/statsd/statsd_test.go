@@ -0,0 +1,77 @@
+package statsd
+
+import (
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/stretchr/testify/assert"
+)
+
+// listen starts a UDP server and returns a client sending to it with a function reading n packets
+func listen(t *testing.T) (*Client, func(n int) []string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	client, err := NewClient(conn.LocalAddr().String(), "home_bt_broker")
+	assert.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+
+	return client, func(n int) []string {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		packets := []string{}
+		buf := make([]byte, 512)
+		for i := 0; i < n; i++ {
+			size, _, err := conn.ReadFrom(buf)
+			if !assert.NoError(t, err) {
+				break
+			}
+			packets = append(packets, string(buf[:size]))
+		}
+		return packets
+	}
+}
+
+func TestClient(t *testing.T) {
+	client, read := listen(t)
+
+	client.Count("http.requests", 1)
+	client.Gauge("bluetooth.adapters", 2)
+	client.Timing("http.duration", 1500*time.Millisecond)
+
+	assert.Equal(t, []string{
+		"home_bt_broker.http.requests:1|c",
+		"home_bt_broker.bluetooth.adapters:2|g",
+		"home_bt_broker.http.duration:1500|ms",
+	}, read(3))
+}
+
+func TestReporter(t *testing.T) {
+	client, read := listen(t)
+
+	mock := bluetooth.NewMockBluetoothManager(t)
+	mock.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "AA:BB:CC:DD:EE:00", Powered: true},
+	}, nil)
+	mock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Address: "11:22:33:44:55:66", Paired: true, Connected: true},
+		{Address: "22:33:44:55:66:77", Paired: true},
+		{Address: "33:44:55:66:77:88"},
+	}, nil)
+
+	NewReporter(mock, client, time.Minute).Report()
+
+	packets := read(6)
+	sort.Strings(packets)
+	assert.Equal(t, []string{
+		"home_bt_broker.bluetooth.adapter.aa_bb_cc_dd_ee_00.devices.connected:1|g",
+		"home_bt_broker.bluetooth.adapter.aa_bb_cc_dd_ee_00.devices.paired:2|g",
+		"home_bt_broker.bluetooth.adapter.aa_bb_cc_dd_ee_00.devices:3|g",
+		"home_bt_broker.bluetooth.adapter.aa_bb_cc_dd_ee_00.discovering:0|g",
+		"home_bt_broker.bluetooth.adapter.aa_bb_cc_dd_ee_00.powered:1|g",
+		"home_bt_broker.bluetooth.adapters:1|g",
+	}, packets)
+}
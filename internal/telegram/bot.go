@@ -0,0 +1,259 @@
+package telegram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+const helpText = `Commands:
+/devices - list the devices of every adapter
+/connect <name or address> - connect a paired device
+/pairing - list the pairing requests waiting for a decision
+/approve <id> - accept a pairing request
+/reject <id> - reject a pairing request`
+
+// Bot answers commands from the allowed chats and forwards pairing requests to them
+type Bot struct {
+	client    *Client
+	btManager bluetooth.BluetoothManagerInterface
+	chats     []int64
+	allowed   map[int64]bool
+	readOnly  bool
+}
+
+// NewBot creates a bot answering the given chats only. In read-only mode, commands changing
+// the Bluetooth state are refused.
+func NewBot(client *Client, btManager bluetooth.BluetoothManagerInterface, chatIDs []int64, readOnly bool) *Bot {
+	b := &Bot{
+		client:    client,
+		btManager: btManager,
+		chats:     chatIDs,
+		allowed:   make(map[int64]bool),
+		readOnly:  readOnly,
+	}
+	for _, id := range chatIDs {
+		b.allowed[id] = true
+	}
+	return b
+}
+
+// Run polls the updates and forwards pairing requests from the hub until the context is cancelled
+func (b *Bot) Run(ctx context.Context, hub *events.Hub) {
+	pairingEvents, unsubscribe := hub.SubscribeTypes(bluetooth.EventPairingRequested)
+	defer unsubscribe()
+	go b.forwardPairingRequests(ctx, pairingEvents)
+
+	var offset int64
+	for {
+		updates, err := b.client.GetUpdates(ctx, offset)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("Telegram: %v", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.ID + 1
+			b.handleUpdate(ctx, update)
+		}
+	}
+}
+
+// forwardPairingRequests sends every new pairing request to the allowed chats, with buttons to answer it
+func (b *Bot) forwardPairingRequests(ctx context.Context, ch <-chan events.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			req, isRequest := event.Data.(bluetooth.PairingRequest)
+			if event.Type != bluetooth.EventPairingRequested || !isRequest {
+				continue
+			}
+
+			var buttons []InlineKeyboardButton
+			if !b.readOnly {
+				buttons = []InlineKeyboardButton{
+					{Text: "Approve", CallbackData: "approve " + req.ID},
+					{Text: "Reject", CallbackData: "reject " + req.ID},
+				}
+			}
+			for _, chatID := range b.chats {
+				if err := b.client.SendMessage(ctx, chatID, formatPairingRequest(req), buttons...); err != nil {
+					log.Printf("Telegram: failed to forward pairing request %s: %v", req.ID, err)
+				}
+			}
+		}
+	}
+}
+
+// handleUpdate answers a command or a button press from an allowed chat
+func (b *Bot) handleUpdate(ctx context.Context, update Update) {
+	switch {
+	case update.Message != nil:
+		chatID := update.Message.Chat.ID
+		if !b.allowed[chatID] {
+			log.Printf("Telegram: ignoring message from chat %d, which is not in TELEGRAM_CHAT_IDS", chatID)
+			return
+		}
+		if err := b.client.SendMessage(ctx, chatID, b.Command(update.Message.Text)); err != nil {
+			log.Printf("Telegram: failed to reply to chat %d: %v", chatID, err)
+		}
+	case update.CallbackQuery != nil:
+		query := update.CallbackQuery
+		if query.Message == nil || !b.allowed[query.Message.Chat.ID] {
+			return
+		}
+		if err := b.client.AnswerCallbackQuery(ctx, query.ID, b.Command("/"+query.Data)); err != nil {
+			log.Printf("Telegram: failed to answer button press: %v", err)
+		}
+	}
+}
+
+// Command runs a bot command and returns the reply
+func (b *Bot) Command(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return helpText
+	}
+	// Commands sent in groups are suffixed with the bot name, e.g. /devices@home_bt_bot
+	command, _, _ := strings.Cut(fields[0], "@")
+	args := strings.Join(fields[1:], " ")
+
+	switch command {
+	case "/devices":
+		return b.listDevices()
+	case "/connect":
+		if b.readOnly {
+			return "The broker is in read-only mode"
+		}
+		return b.connect(args)
+	case "/pairing":
+		return b.listPairingRequests()
+	case "/approve", "/reject":
+		if b.readOnly {
+			return "The broker is in read-only mode"
+		}
+		return b.respond(args, command == "/approve")
+	}
+	return helpText
+}
+
+func (b *Bot) listDevices() string {
+	adapters, err := b.btManager.GetAdapters()
+	if err != nil {
+		return "Failed to get adapters: " + err.Error()
+	}
+
+	var lines []string
+	for _, adapter := range adapters {
+		lines = append(lines, fmt.Sprintf("%s (%s)", adapter.Name, adapter.Address))
+		devices, err := b.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			lines = append(lines, "  failed to get devices: "+err.Error())
+			continue
+		}
+		for _, device := range devices {
+			if !device.Paired && !device.Connected {
+				continue
+			}
+			state := "paired"
+			if device.Connected {
+				state = "connected"
+			}
+			lines = append(lines, fmt.Sprintf("  • %s (%s) - %s", device.Name, device.Address, state))
+		}
+	}
+
+	if len(lines) == 0 {
+		return "No Bluetooth adapter found"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// connect connects the paired device matching a name or an address
+func (b *Bot) connect(target string) string {
+	if target == "" {
+		return "Usage: /connect <name or address>"
+	}
+
+	adapters, err := b.btManager.GetAdapters()
+	if err != nil {
+		return "Failed to get adapters: " + err.Error()
+	}
+	for _, adapter := range adapters {
+		devices, err := b.btManager.GetDevices(adapter.Path)
+		if err != nil {
+			continue
+		}
+		for _, device := range devices {
+			if !device.Paired || (!strings.EqualFold(device.Name, target) && !strings.EqualFold(device.Address, target)) {
+				continue
+			}
+			if err := b.btManager.ConnectDevice(adapter.Path, device.Address); err != nil {
+				return "Failed to connect: " + err.Error()
+			}
+			return fmt.Sprintf("Connected to %s", device.Name)
+		}
+	}
+	return fmt.Sprintf("No paired device named %q", target)
+}
+
+func (b *Bot) listPairingRequests() string {
+	requests := b.btManager.GetPairingRequests()
+	if len(requests) == 0 {
+		return "No pairing request waiting"
+	}
+
+	lines := make([]string, 0, len(requests))
+	for _, req := range requests {
+		lines = append(lines, formatPairingRequest(req))
+	}
+	return strings.Join(lines, "\n\n")
+}
+
+func (b *Bot) respond(id string, accept bool) string {
+	if id == "" {
+		return "Usage: /approve <id> or /reject <id>"
+	}
+
+	err := b.btManager.RespondPairingRequest(id, accept)
+	if errors.Is(err, bluetooth.ErrPairingRequestNotFound) {
+		return "Pairing request not found, it may have expired"
+	} else if err != nil {
+		return "Failed to answer the pairing request: " + err.Error()
+	}
+
+	if accept {
+		return "Pairing request approved"
+	}
+	return "Pairing request rejected"
+}
+
+func formatPairingRequest(req bluetooth.PairingRequest) string {
+	text := fmt.Sprintf("%s asks for %s", req.Address, req.Type)
+	if req.Passkey != nil {
+		text += fmt.Sprintf(", passkey %06d", *req.Passkey)
+	}
+	if req.UUID != "" {
+		text += " of service " + req.UUID
+	}
+	return text + "\nid: " + req.ID
+}
@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBot_Command(t *testing.T) {
+	mock := bluetooth.NewMockBluetoothManager(t)
+	mock.On("GetAdapters").Return([]bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Name: "living-room", Address: "AA:BB:CC:DD:EE:00"},
+	}, nil)
+	mock.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{
+		{Name: "Speaker", Address: "11:22:33:44:55:66", Paired: true},
+		{Name: "Headset", Address: "22:33:44:55:66:77", Paired: true, Connected: true},
+		{Name: "Phone", Address: "33:44:55:66:77:88"},
+	}, nil)
+	mock.On("ConnectDevice", "/org/bluez/hci0", "11:22:33:44:55:66").Return(nil)
+	mock.On("RespondPairingRequest", "abcd", true).Return(nil)
+	mock.On("RespondPairingRequest", "gone", false).Return(bluetooth.ErrPairingRequestNotFound)
+
+	bot := NewBot(nil, mock, []int64{42}, false)
+
+	assert.Equal(t, "living-room (AA:BB:CC:DD:EE:00)\n"+
+		"  • Speaker (11:22:33:44:55:66) - paired\n"+
+		"  • Headset (22:33:44:55:66:77) - connected", bot.Command("/devices@home_bt_bot"))
+	assert.Equal(t, "Connected to Speaker", bot.Command("/connect speaker"))
+	assert.Equal(t, `No paired device named "Phone"`, bot.Command("/connect Phone"))
+	assert.Equal(t, "Pairing request approved", bot.Command("/approve abcd"))
+	assert.Equal(t, "Pairing request not found, it may have expired", bot.Command("/reject gone"))
+	assert.Equal(t, helpText, bot.Command("/start"))
+
+	readOnly := NewBot(nil, mock, []int64{42}, true)
+	assert.Equal(t, "The broker is in read-only mode", readOnly.Command("/connect Speaker"))
+}
+
+func TestBot_Run(t *testing.T) {
+	sent := make(chan map[string]interface{}, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bottoken/getUpdates":
+			var params map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&params)
+			if params["offset"].(float64) == 0 {
+				w.Write([]byte(`{"ok":true,"result":[
+					{"update_id":1,"message":{"chat":{"id":7},"text":"/pairing"}},
+					{"update_id":2,"message":{"chat":{"id":42},"text":"/pairing"}}
+				]}`))
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+			w.Write([]byte(`{"ok":true,"result":[]}`))
+		case "/bottoken/sendMessage":
+			var params map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&params)
+			sent <- params
+			w.Write([]byte(`{"ok":true,"result":{}}`))
+		}
+	}))
+	defer server.Close()
+	defer func(original string) { APIURL = original }(APIURL)
+	APIURL = server.URL
+
+	mock := bluetooth.NewMockBluetoothManager(t)
+	mock.On("GetPairingRequests").Return([]bluetooth.PairingRequest{})
+
+	hub := events.NewHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewBot(NewClient("token"), mock, []int64{42}, false).Run(ctx, hub)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Only the allowed chat gets a reply
+	reply := <-sent
+	assert.Equal(t, float64(42), reply["chat_id"])
+	assert.Equal(t, "No pairing request waiting", reply["text"])
+
+	// Pairing requests are forwarded with buttons to answer them
+	hub.Publish(bluetooth.EventPairingRequested, bluetooth.PairingRequest{
+		ID:      "abcd",
+		Type:    bluetooth.PairingRequestAuthorization,
+		Address: "11:22:33:44:55:66",
+	})
+	forwarded := <-sent
+	assert.Equal(t, "11:22:33:44:55:66 asks for authorization\nid: abcd", forwarded["text"])
+	assert.NotNil(t, forwarded["reply_markup"])
+}
@@ -0,0 +1,138 @@
+// Package telegram exposes the broker through a Telegram bot
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// APIURL is the Telegram Bot API endpoint
+var APIURL = "https://api.telegram.org"
+
+// pollTimeout is how long getUpdates waits for an update before returning an empty list
+const pollTimeout = 30 * time.Second
+
+// Update is an incoming message or button press
+type Update struct {
+	ID            int64          `json:"update_id"`
+	Message       *Message       `json:"message,omitempty"`
+	CallbackQuery *CallbackQuery `json:"callback_query,omitempty"`
+}
+
+// Message is a chat message
+type Message struct {
+	Chat Chat   `json:"chat"`
+	Text string `json:"text"`
+}
+
+// Chat identifies a conversation with the bot
+type Chat struct {
+	ID int64 `json:"id"`
+}
+
+// CallbackQuery is sent when an inline keyboard button is pressed
+type CallbackQuery struct {
+	ID      string   `json:"id"`
+	Message *Message `json:"message,omitempty"`
+	Data    string   `json:"data"`
+}
+
+// InlineKeyboardButton is a button attached to a message
+type InlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data"`
+}
+
+// Client calls the Telegram Bot API
+type Client struct {
+	token  string
+	client *http.Client
+}
+
+// NewClient creates a Bot API client from a bot token
+func NewClient(token string) *Client {
+	return &Client{
+		token:  token,
+		client: &http.Client{Timeout: pollTimeout + 10*time.Second},
+	}
+}
+
+// call invokes a Bot API method and decodes its result
+func (c *Client) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s parameters: %w", method, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, APIURL+"/bot"+c.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		// The token is part of the URL, it must not end up in the logs
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	if !response.OK {
+		return fmt.Errorf("%s failed: %s", method, response.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(response.Result, result)
+	}
+	return nil
+}
+
+// GetUpdates waits for the updates following an offset
+func (c *Client) GetUpdates(ctx context.Context, offset int64) ([]Update, error) {
+	var updates []Update
+	err := c.call(ctx, "getUpdates", map[string]interface{}{
+		"offset":          offset,
+		"timeout":         int(pollTimeout.Seconds()),
+		"allowed_updates": []string{"message", "callback_query"},
+	}, &updates)
+	return updates, err
+}
+
+// SendMessage sends a text message, with optional inline keyboard buttons on a single row
+func (c *Client) SendMessage(ctx context.Context, chatID int64, text string, buttons ...InlineKeyboardButton) error {
+	params := map[string]interface{}{
+		"chat_id": chatID,
+		"text":    text,
+	}
+	if len(buttons) > 0 {
+		params["reply_markup"] = map[string]interface{}{
+			"inline_keyboard": [][]InlineKeyboardButton{buttons},
+		}
+	}
+	return c.call(ctx, "sendMessage", params, nil)
+}
+
+// AnswerCallbackQuery acknowledges a button press with a short notice
+func (c *Client) AnswerCallbackQuery(ctx context.Context, id, text string) error {
+	return c.call(ctx, "answerCallbackQuery", map[string]interface{}{
+		"callback_query_id": id,
+		"text":              text,
+	}, nil)
+}
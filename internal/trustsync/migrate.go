@@ -0,0 +1,156 @@
+package trustsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+var (
+	// ErrSameAdapter is returned when a device is migrated to the adapter it is on
+	ErrSameAdapter = errors.New("target adapter is the source adapter")
+	// ErrAdapterPoweredOff is returned when the target adapter of a migration is powered off
+	ErrAdapterPoweredOff = errors.New("target adapter is powered off")
+	// ErrNotDiscovered is returned when the target adapter does not find the device
+	ErrNotDiscovered = errors.New("device not found by the target adapter, make sure it is in pairing mode")
+)
+
+const (
+	// discoveryTimeout bounds the discovery of a migrated device by the target adapter
+	discoveryTimeout = 30 * time.Second
+	discoveryPoll    = time.Second
+)
+
+// Migration is the outcome of a device migration
+type Migration struct {
+	Address string `json:"address"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	// Paired is false when the device was already paired with the target adapter
+	Paired bool `json:"paired"`
+}
+
+// Migrate moves a device from an adapter to another, such as when swapping USB dongles: the device
+// is paired with and trusted by the target adapter, through the pairing agent, then removed from the
+// source adapter, and the metadata bound to the adapter follows it. The device is only removed once
+// paired with the target, so that a failed migration leaves it usable.
+func (s *Syncer) Migrate(ctx context.Context, sourcePath, targetPath, address string) (*Migration, error) {
+	if sourcePath == targetPath {
+		return nil, ErrSameAdapter
+	}
+	source, target, err := s.adapters(sourcePath, targetPath)
+	if err != nil {
+		return nil, err
+	}
+	if !target.Powered {
+		return nil, ErrAdapterPoweredOff
+	}
+
+	device, err := s.findDevice(sourcePath, address)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, ErrDeviceNotFound
+	}
+	migration := &Migration{Address: device.Address, From: source.Address, To: target.Address}
+
+	targetDevice, err := s.findDevice(targetPath, device.Address)
+	if err != nil {
+		return nil, err
+	}
+	if targetDevice == nil {
+		// A connected device does not advertise, it is released for the target to find it
+		if device.Connected {
+			if err := s.btManager.DisconnectDevice(sourcePath, device.Address); err != nil {
+				return nil, fmt.Errorf("failed to disconnect from the source adapter: %w", err)
+			}
+		}
+		if targetDevice, err = s.discover(ctx, targetPath, device.Address); err != nil {
+			return nil, err
+		}
+	}
+
+	if !targetDevice.Paired {
+		if err := s.btManager.PairDevice(targetPath, device.Address); err != nil {
+			return nil, fmt.Errorf("failed to pair with the target adapter: %w", err)
+		}
+		migration.Paired = true
+	}
+	if !targetDevice.Trusted {
+		if err := s.btManager.TrustDevice(targetPath, device.Address); err != nil {
+			return nil, fmt.Errorf("failed to trust on the target adapter: %w", err)
+		}
+	}
+	if err := s.btManager.RemoveDevice(sourcePath, device.Address); err != nil {
+		return nil, fmt.Errorf("failed to remove from the source adapter: %w", err)
+	}
+	if s.db != nil {
+		if err := database.MoveDeviceData(s.db, device.Address, target.Address); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Trust sync: migrated %s from %s to %s", device.Address, source.Address, target.Address)
+	return migration, nil
+}
+
+// adapters returns the source and target adapters of a migration
+func (s *Syncer) adapters(sourcePath, targetPath string) (source, target bluetooth.Adapter, err error) {
+	adapters, err := s.btManager.GetAdapters()
+	if err != nil {
+		return source, target, err
+	}
+	var foundSource, foundTarget bool
+	for _, adapter := range adapters {
+		switch adapter.Path {
+		case sourcePath:
+			source, foundSource = adapter, true
+		case targetPath:
+			target, foundTarget = adapter, true
+		}
+	}
+	if !foundSource || !foundTarget {
+		return source, target, errors.New("adapter not found")
+	}
+	return source, target, nil
+}
+
+// discover runs a discovery on an adapter until it finds a device
+func (s *Syncer) discover(ctx context.Context, adapterPath, address string) (*bluetooth.Device, error) {
+	if err := s.btManager.SetDiscovering(adapterPath, true); err != nil {
+		return nil, fmt.Errorf("failed to start discovery on the target adapter: %w", err)
+	}
+	defer func() {
+		if err := s.btManager.SetDiscovering(adapterPath, false); err != nil {
+			log.Printf("Trust sync: failed to stop discovery: %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, s.discoveryTimeout)
+	defer cancel()
+	ticker := time.NewTicker(discoveryPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ErrNotDiscovered
+		case <-ticker.C:
+		}
+		devices, err := s.btManager.GetDevices(adapterPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, device := range devices {
+			if strings.EqualFold(device.Address, address) {
+				return &device, nil
+			}
+		}
+	}
+}
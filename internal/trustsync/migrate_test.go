@@ -0,0 +1,63 @@
+package trustsync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncer_Migrate(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return(adapters(), nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true, Connected: true}}, nil)
+	// The target adapter finds the device once discovering
+	btManager.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{}, nil).Once()
+	btManager.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF"}}, nil)
+	btManager.On("DisconnectDevice", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+	btManager.On("SetDiscovering", "/org/bluez/hci1", true).Return(nil).Once()
+	btManager.On("SetDiscovering", "/org/bluez/hci1", false).Return(nil).Once()
+	btManager.On("PairDevice", "/org/bluez/hci1", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+	btManager.On("TrustDevice", "/org/bluez/hci1", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+	btManager.On("RemoveDevice", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+
+	dbMock.ExpectBegin()
+	for _, table := range []string{"device_owners", "guest_trusts", "known_devices", "rssi_tracked_devices"} {
+		dbMock.ExpectExec("UPDATE OR REPLACE "+table).WithArgs("00:1A:7D:DA:71:02", "AA:BB:CC:DD:EE:FF").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	dbMock.ExpectCommit()
+
+	s := NewSyncer(btManager, db, PolicyOff)
+	migration, err := s.Migrate(context.Background(), "/org/bluez/hci0", "/org/bluez/hci1", "aa:bb:cc:dd:ee:ff")
+	assert.NoError(t, err)
+	assert.Equal(t, &Migration{Address: "AA:BB:CC:DD:EE:FF", From: "00:1A:7D:DA:71:01", To: "00:1A:7D:DA:71:02", Paired: true}, migration)
+	assert.NoError(t, dbMock.ExpectationsWereMet())
+}
+
+func TestSyncer_MigrateErrors(t *testing.T) {
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return(adapters(), nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true}}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{}, nil)
+	btManager.On("SetDiscovering", "/org/bluez/hci1", true).Return(nil).Once()
+	btManager.On("SetDiscovering", "/org/bluez/hci1", false).Return(nil).Once()
+
+	s := NewSyncer(btManager, nil, PolicyOff)
+	s.discoveryTimeout = 10 * time.Millisecond
+	_, err := s.Migrate(context.Background(), "/org/bluez/hci0", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF")
+	assert.ErrorIs(t, err, ErrSameAdapter)
+	_, err = s.Migrate(context.Background(), "/org/bluez/hci0", "/org/bluez/hci3", "AA:BB:CC:DD:EE:FF")
+	assert.ErrorIs(t, err, ErrAdapterPoweredOff)
+	_, err = s.Migrate(context.Background(), "/org/bluez/hci1", "/org/bluez/hci0", "AA:BB:CC:DD:EE:FF")
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+	// The device is left on its adapter when the target does not find it
+	_, err = s.Migrate(context.Background(), "/org/bluez/hci0", "/org/bluez/hci1", "AA:BB:CC:DD:EE:FF")
+	assert.ErrorIs(t, err, ErrNotDiscovered)
+}
@@ -0,0 +1,198 @@
+// Package trustsync replicates the trust of a device, and optionally its pairing, to the other
+// adapters of the host, so that any of the dongles can serve it, and migrates devices between them
+package trustsync
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth/signals"
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+)
+
+// Sync policies, applied when a device becomes trusted on an adapter
+const (
+	// PolicyOff leaves the other adapters alone
+	PolicyOff = "off"
+	// PolicyTrust trusts the device on the other adapters knowing it
+	PolicyTrust = "trust"
+	// PolicyPair also pairs the device with the other adapters knowing it
+	PolicyPair = "pair"
+)
+
+// Policies are the valid sync policies
+var Policies = []string{PolicyOff, PolicyTrust, PolicyPair}
+
+var (
+	// ErrDeviceNotFound is returned when the source adapter does not know the device
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrNotTrusted is returned when the device is not trusted on the source adapter
+	ErrNotTrusted = errors.New("device is not trusted on the source adapter")
+)
+
+// settleDelay lets the bonding complete, and guest mode record its trust, before a trusted device
+// is synced
+const settleDelay = 5 * time.Second
+
+// Result is the outcome of a sync on an adapter
+type Result struct {
+	Adapter string `json:"adapter"`
+	Paired  bool   `json:"paired"`
+	Trusted bool   `json:"trusted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Syncer replicates the trust of devices between adapters
+type Syncer struct {
+	btManager bluetooth.BluetoothManagerInterface
+	db        database.DatabaseInterface
+	policy    string
+	delay     time.Duration
+	// discoveryTimeout bounds the discovery of a migrated device
+	discoveryTimeout time.Duration
+}
+
+// NewSyncer creates a syncer applying a policy to the devices becoming trusted
+func NewSyncer(btManager bluetooth.BluetoothManagerInterface, db database.DatabaseInterface, policy string) *Syncer {
+	return &Syncer{btManager: btManager, db: db, policy: policy, delay: settleDelay, discoveryTimeout: discoveryTimeout}
+}
+
+// Run syncs the devices becoming trusted until the context is cancelled. The devices trusted in
+// guest mode are left alone, their trust expiring on a single adapter.
+func (s *Syncer) Run(ctx context.Context, hub *events.Hub) {
+	if s.policy == PolicyOff {
+		return
+	}
+	ch, unsubscribe := hub.SubscribeTypes(signals.EventDeviceTrusted)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, ok := event.Data.(signals.DeviceEvent)
+			if !ok {
+				continue
+			}
+			go func() {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(s.delay):
+				}
+				s.syncTrusted(data.Adapter, data.Address)
+			}()
+		}
+	}
+}
+
+// syncTrusted applies the policy to a device trusted on an adapter
+func (s *Syncer) syncTrusted(adapterPath, address string) {
+	guest, err := database.HasGuestTrust(s.db, address)
+	if err != nil {
+		log.Printf("Trust sync: %v", err)
+		return
+	}
+	if guest {
+		return
+	}
+
+	results, err := s.Sync(adapterPath, address, s.policy == PolicyPair)
+	if err != nil {
+		log.Printf("Trust sync: failed to sync %s: %v", address, err)
+		return
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			log.Printf("Trust sync: %s on %s: %s", address, result.Adapter, result.Error)
+		}
+	}
+}
+
+// Sync trusts a device trusted on an adapter, given by its path, on the other adapters, pairing it
+// first when pair is set. It returns the outcome on each of the other adapters.
+func (s *Syncer) Sync(adapterPath, address string, pair bool) ([]Result, error) {
+	source, err := s.findDevice(adapterPath, address)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, ErrDeviceNotFound
+	}
+	if !source.Trusted {
+		return nil, ErrNotTrusted
+	}
+
+	adapters, err := s.btManager.GetAdapters()
+	if err != nil {
+		return nil, err
+	}
+	results := []Result{}
+	for _, adapter := range adapters {
+		if adapter.Path == adapterPath {
+			continue
+		}
+		results = append(results, s.syncAdapter(adapter, source.Address, pair))
+	}
+	return results, nil
+}
+
+// syncAdapter trusts, and pairs when asked to, a device on an adapter
+func (s *Syncer) syncAdapter(adapter bluetooth.Adapter, address string, pair bool) Result {
+	result := Result{Adapter: adapter.Address}
+	if !adapter.Powered {
+		result.Error = "adapter is powered off"
+		return result
+	}
+	// BlueZ only acts on the devices an adapter has discovered or paired
+	device, err := s.findDevice(adapter.Path, address)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	} else if device == nil {
+		result.Error = "device not known to the adapter, it must be discovered by it first"
+		return result
+	}
+
+	result.Paired, result.Trusted = device.Paired, device.Trusted
+	if pair && !device.Paired {
+		if err := s.btManager.PairDevice(adapter.Path, device.Address); err != nil {
+			result.Error = "failed to pair: " + err.Error()
+			return result
+		}
+		result.Paired = true
+		log.Printf("Trust sync: paired %s with %s", device.Address, adapter.Address)
+	}
+	if !device.Trusted {
+		if err := s.btManager.TrustDevice(adapter.Path, device.Address); err != nil {
+			result.Error = "failed to trust: " + err.Error()
+			return result
+		}
+		result.Trusted = true
+		log.Printf("Trust sync: trusted %s on %s", device.Address, adapter.Address)
+	}
+	return result
+}
+
+// findDevice returns a device of an adapter, or nil when the adapter does not know it
+func (s *Syncer) findDevice(adapterPath, address string) (*bluetooth.Device, error) {
+	devices, err := s.btManager.GetDevices(adapterPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		if strings.EqualFold(device.Address, address) {
+			return &device, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,95 @@
+package trustsync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth"
+	"github.com/nerzhul/home-bt-broker/internal/bluetooth/signals"
+	"github.com/nerzhul/home-bt-broker/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func adapters() []bluetooth.Adapter {
+	return []bluetooth.Adapter{
+		{Path: "/org/bluez/hci0", Address: "00:1A:7D:DA:71:01", Powered: true},
+		{Path: "/org/bluez/hci1", Address: "00:1A:7D:DA:71:02", Powered: true},
+		{Path: "/org/bluez/hci2", Address: "00:1A:7D:DA:71:03", Powered: true},
+		{Path: "/org/bluez/hci3", Address: "00:1A:7D:DA:71:04"},
+	}
+}
+
+func TestSyncer_Sync(t *testing.T) {
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return(adapters(), nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true}}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF"}}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci2").Return([]bluetooth.Device{}, nil)
+	btManager.On("PairDevice", "/org/bluez/hci1", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+	btManager.On("TrustDevice", "/org/bluez/hci1", "AA:BB:CC:DD:EE:FF").Return(nil).Once()
+
+	s := NewSyncer(btManager, nil, PolicyOff)
+	results, err := s.Sync("/org/bluez/hci0", "aa:bb:cc:dd:ee:ff", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []Result{
+		{Adapter: "00:1A:7D:DA:71:02", Paired: true, Trusted: true},
+		{Adapter: "00:1A:7D:DA:71:03", Error: "device not known to the adapter, it must be discovered by it first"},
+		{Adapter: "00:1A:7D:DA:71:04", Error: "adapter is powered off"},
+	}, results)
+
+	// Only trusted devices are synced
+	_, err = s.Sync("/org/bluez/hci1", "AA:BB:CC:DD:EE:FF", true)
+	assert.ErrorIs(t, err, ErrNotTrusted)
+	_, err = s.Sync("/org/bluez/hci2", "AA:BB:CC:DD:EE:FF", true)
+	assert.ErrorIs(t, err, ErrDeviceNotFound)
+}
+
+func TestSyncer_SyncTrustOnly(t *testing.T) {
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return(adapters()[:2], nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true}}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF"}}, nil)
+	btManager.On("TrustDevice", "/org/bluez/hci1", "AA:BB:CC:DD:EE:FF").Return(errors.New("device busy")).Once()
+
+	results, err := NewSyncer(btManager, nil, PolicyOff).Sync("/org/bluez/hci0", "AA:BB:CC:DD:EE:FF", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []Result{{Adapter: "00:1A:7D:DA:71:02", Error: "failed to trust: device busy"}}, results)
+}
+
+func TestSyncer_Run(t *testing.T) {
+	db, dbMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	btManager := bluetooth.NewMockBluetoothManager(t)
+	btManager.On("GetAdapters").Return(adapters()[:2], nil)
+	btManager.On("GetDevices", "/org/bluez/hci0").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true, Trusted: true}}, nil)
+	btManager.On("GetDevices", "/org/bluez/hci1").Return([]bluetooth.Device{{Address: "AA:BB:CC:DD:EE:FF", Paired: true}}, nil)
+	trusted := make(chan struct{})
+	btManager.On("TrustDevice", "/org/bluez/hci1", "AA:BB:CC:DD:EE:FF").Return(nil).Once().Run(func(mock.Arguments) { close(trusted) })
+
+	hub := events.NewHub()
+	s := NewSyncer(btManager, db, PolicyTrust)
+	s.delay = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx, hub)
+	time.Sleep(10 * time.Millisecond)
+
+	// Guest devices are not synced
+	dbMock.ExpectQuery("FROM guest_trusts").WithArgs("11:22:33:44:55:66").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	hub.Publish(signals.EventDeviceTrusted, signals.DeviceEvent{Address: "11:22:33:44:55:66", Adapter: "/org/bluez/hci0"})
+	assert.Eventually(t, func() bool { return dbMock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+
+	dbMock.ExpectQuery("FROM guest_trusts").WithArgs("AA:BB:CC:DD:EE:FF").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	hub.Publish(signals.EventDeviceTrusted, signals.DeviceEvent{Address: "AA:BB:CC:DD:EE:FF", Adapter: "/org/bluez/hci0"})
+	select {
+	case <-trusted:
+	case <-time.After(time.Second):
+		t.Fatal("the device was not trusted on the other adapter")
+	}
+}
@@ -0,0 +1,316 @@
+// Package webpush sends Web Push messages to browsers (RFC 8030), encrypted with aes128gcm (RFC 8291)
+// and authenticated with VAPID (RFC 8292)
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrGone is returned when the push service no longer knows a subscription, which should be deleted
+var ErrGone = errors.New("push subscription is gone")
+
+// ErrInvalidEndpoint is returned for an endpoint which cannot be the one of a push service
+var ErrInvalidEndpoint = errors.New("endpoint must be the https URL of a public push service")
+
+// Urgencies of a push message, telling the push service how soon to wake the device
+const (
+	UrgencyLow    = "low"
+	UrgencyNormal = "normal"
+	UrgencyHigh   = "high"
+)
+
+// recordSize is the record size announced in the encrypted content header. Messages are sent in a
+// single record, push services accepting up to 4096 bytes.
+const recordSize = 4096
+
+// maxPayload is the largest payload fitting in a record, after the header, the padding delimiter
+// and the authentication tag
+const maxPayload = recordSize - 86 - 1 - 16
+
+// Subscription is the push subscription of a browser, as returned by PushSubscription.toJSON()
+type Subscription struct {
+	Endpoint string
+	// P256dh is the public key of the browser, an uncompressed P-256 point
+	P256dh []byte
+	// Auth is the 16 bytes authentication secret of the browser
+	Auth []byte
+}
+
+// Client signs and encrypts push messages with a VAPID key
+type Client struct {
+	key     *ecdsa.PrivateKey
+	subject string
+	ttl     time.Duration
+	http    *http.Client
+}
+
+// NewClient creates a client sending push messages with a VAPID key. The subject is a mailto: or
+// https: URL the push services may use to contact the operator.
+func NewClient(key *ecdsa.PrivateKey, subject string) *Client {
+	return &Client{
+		key:     key,
+		subject: subject,
+		ttl:     12 * time.Hour,
+		http:    &http.Client{Timeout: 10 * time.Second, Transport: publicTransport()},
+	}
+}
+
+// SetHTTPClient replaces the HTTP client sending the push messages, which refuses the local
+// addresses, such as for tests running a push service on the loopback
+func (c *Client) SetHTTPClient(client *http.Client) {
+	c.http = client
+}
+
+// publicTransport returns a transport connecting only to public addresses. CheckEndpoint only sees
+// the host name of an endpoint, which may resolve to a local address, or to another one once the
+// subscription is stored, so the address is checked again when connecting. The proxy of the
+// environment is not used, the checked address being the proxy one otherwise.
+func publicTransport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: checkAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// checkAddress refuses to connect to a local address, once the host name is resolved
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isLocal(ip) {
+		return fmt.Errorf("push endpoint resolves to %s: %w", host, ErrInvalidEndpoint)
+	}
+	return nil
+}
+
+// isLocal reports whether an address is not reachable on the internet
+func isLocal(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// CheckEndpoint checks that an endpoint is the https URL of a push service. The push services are
+// on the internet, so that the endpoints on the loopback, private or link-local addresses and the
+// local host names are refused, as the broker would otherwise send requests into the local network
+// for the subscribers. The host names resolving to such addresses are refused when sending.
+func CheckEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return ErrInvalidEndpoint
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil {
+		if isLocal(ip) {
+			return ErrInvalidEndpoint
+		}
+		return nil
+	}
+	if !strings.Contains(host, ".") || host == "localhost" ||
+		strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") {
+		return ErrInvalidEndpoint
+	}
+	return nil
+}
+
+// PublicKey returns the VAPID public key, base64url encoded, used by browsers as applicationServerKey
+func (c *Client) PublicKey() string {
+	public, _ := c.key.PublicKey.ECDH()
+	return base64.RawURLEncoding.EncodeToString(public.Bytes())
+}
+
+// Send encrypts a payload and posts it to the push service of a subscription
+func (c *Client) Send(ctx context.Context, sub Subscription, payload []byte, urgency string) error {
+	if len(payload) > maxPayload {
+		return fmt.Errorf("push payload of %d bytes exceeds %d bytes", len(payload), maxPayload)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	private, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	body, err := encrypt(payload, sub.P256dh, sub.Auth, private, salt)
+	if err != nil {
+		return err
+	}
+
+	token, err := c.vapidToken(sub.Endpoint, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "vapid t="+token+", k="+c.PublicKey())
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(c.ttl.Seconds())))
+	if urgency != "" {
+		req.Header.Set("Urgency", urgency)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send push message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("push service returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// vapidToken returns the ES256 JWT authenticating a request to the push service of an endpoint
+func (c *Client) vapidToken(endpoint string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid push endpoint: %w", err)
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(c.ttl).Unix(),
+		"sub": c.subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// encrypt encrypts a payload for a browser in a single aes128gcm record (RFC 8291)
+func encrypt(payload, uaPublic, authSecret []byte, asPrivate *ecdh.PrivateKey, salt []byte) ([]byte, error) {
+	if len(authSecret) != 16 {
+		return nil, fmt.Errorf("auth secret must be 16 bytes, got %d", len(authSecret))
+	}
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid subscription public key: %w", err)
+	}
+	secret, err := asPrivate.ECDH(uaKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive shared secret: %w", err)
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm, err := hkdf.Key(sha256.New, secret, authSecret, string(keyInfo), 32)
+	if err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	// The header holds the salt, the record size and the public key of the sender
+	body := make([]byte, 0, 86+len(payload)+1+aead.Overhead())
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+
+	// 0x02 marks the last record, without further padding
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	return aead.Seal(body, nonce, plaintext, nil), nil
+}
+
+// LoadOrCreateKey reads the VAPID key from a PEM file, generating and saving one when it does not exist
+func LoadOrCreateKey(path string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate VAPID key: %w", err)
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode VAPID key: %w", err)
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write VAPID key file: %w", err)
+		}
+		return key, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read VAPID key file: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("VAPID key file %s is not PEM encoded", path)
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse VAPID key: %w", err)
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("VAPID key must be a P-256 key")
+	}
+	return key, nil
+}
+
+// ValidPoint reports whether a key is an uncompressed P-256 point, as sent by browsers in p256dh
+func ValidPoint(key []byte) bool {
+	_, err := ecdh.P256().NewPublicKey(key)
+	return err == nil
+}
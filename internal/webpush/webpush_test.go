@@ -0,0 +1,121 @@
+package webpush
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(t *testing.T, s string) []byte {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	assert.NoError(t, err)
+	return data
+}
+
+// TestEncrypt checks the encryption against the example of RFC 8291 section 5
+func TestEncrypt(t *testing.T) {
+	asPrivate, err := ecdh.P256().NewPrivateKey(decode(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	assert.NoError(t, err)
+
+	body, err := encrypt([]byte("When I grow up, I want to be a watermelon"),
+		decode(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4"),
+		decode(t, "BTBZMqHH6r4Tts7J_aSIgg"), asPrivate, decode(t, "DGv6ra1nlYgDCS1FRnbzlw"))
+	assert.NoError(t, err)
+	assert.Equal(t, "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN",
+		base64.RawURLEncoding.EncodeToString(body))
+}
+
+func TestClient_Send(t *testing.T) {
+	key, err := LoadOrCreateKey(filepath.Join(t.TempDir(), "webpush.key"))
+	assert.NoError(t, err)
+	client := NewClient(key, "mailto:admin@example.com")
+
+	browser, err := ecdh.P256().GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	status := http.StatusCreated
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "aes128gcm", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "high", r.Header.Get("Urgency"))
+
+		// The VAPID token is signed by the key announced next to it
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "vapid t=")
+		token, public, _ := strings.Cut(auth, ", k=")
+		assert.Equal(t, client.PublicKey(), public)
+		parts := strings.Split(token, ".")
+		assert.Len(t, parts, 3)
+		var claims map[string]interface{}
+		assert.NoError(t, json.Unmarshal(decode(t, parts[1]), &claims))
+		assert.Equal(t, "http://"+r.Host, claims["aud"])
+		assert.Equal(t, "mailto:admin@example.com", claims["sub"])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		signature := decode(t, parts[2])
+		assert.True(t, ecdsa.Verify(&key.PublicKey, digest[:],
+			new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	// The client refuses the local addresses, including the host names resolving to one
+	sub := Subscription{Endpoint: strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/push/abc",
+		P256dh: browser.PublicKey().Bytes(), Auth: []byte("0123456789abcdef")}
+	assert.ErrorIs(t, client.Send(context.Background(), sub, []byte(`{}`), UrgencyHigh), ErrInvalidEndpoint)
+
+	client.SetHTTPClient(server.Client())
+	sub.Endpoint = server.URL + "/push/abc"
+	assert.NoError(t, client.Send(context.Background(), sub, []byte(`{"title":"Pairing"}`), UrgencyHigh))
+
+	status = http.StatusGone
+	assert.ErrorIs(t, client.Send(context.Background(), sub, []byte(`{}`), UrgencyHigh), ErrGone)
+}
+
+func TestCheckEndpoint(t *testing.T) {
+	for _, endpoint := range []string{
+		"https://fcm.googleapis.com/fcm/send/abc",
+		"https://updates.push.services.mozilla.com/wpush/v2/abc",
+		"https://203.0.113.10/push",
+	} {
+		assert.NoError(t, CheckEndpoint(endpoint), endpoint)
+	}
+	for _, endpoint := range []string{
+		"http://fcm.googleapis.com/fcm/send/abc",
+		"https:///push",
+		"https://127.0.0.1/push",
+		"https://192.168.1.1:8443/push",
+		"https://10.0.0.2/push",
+		"https://169.254.169.254/latest",
+		"https://[::1]/push",
+		"https://[fd00::1]/push",
+		"https://0.0.0.0/push",
+		"https://localhost/push",
+		"https://LOCALHOST./push",
+		"https://router/push",
+		"https://nas.local/push",
+		"https://broker.localhost/push",
+	} {
+		assert.ErrorIs(t, CheckEndpoint(endpoint), ErrInvalidEndpoint, endpoint)
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webpush.key")
+	key, err := LoadOrCreateKey(path)
+	assert.NoError(t, err)
+
+	// The key is reused on the next start
+	again, err := LoadOrCreateKey(path)
+	assert.NoError(t, err)
+	assert.True(t, key.Equal(again))
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const (
@@ -16,9 +17,17 @@ const (
 `
 )
 
+// ConfigManager writes the Bluetooth policy of the broker into the configuration of the audio stack
 type ConfigManager struct {
+	stack      string
 	configDir  string
 	configFile string
+	content    string
+	// pipewireDir holds the PipeWire fragments, reconciled along with the WirePlumber ones
+	pipewireDir string
+	// shared is set when the configuration file may have been written by the user, it is then only
+	// replaced when generated by the broker
+	shared bool
 }
 
 // NewConfigManager creates a new WirePlumber configuration manager
@@ -32,18 +41,21 @@ func NewConfigManager() (*ConfigManager, error) {
 	configFile := filepath.Join(configDir, "99-home-bt-broker.conf")
 
 	return &ConfigManager{
-		configDir:  configDir,
-		configFile: configFile,
+		stack:       StackWirePlumber,
+		configDir:   configDir,
+		configFile:  configFile,
+		content:     WirePlumberConfigContent,
+		pipewireDir: filepath.Join(homeDir, ".config", "pipewire", "pipewire.conf.d"),
 	}, nil
 }
 
-// EnsureConfig ensures that the WirePlumber configuration file exists
+// EnsureConfig ensures that the configuration file exists
 func (cm *ConfigManager) EnsureConfig() error {
-	log.Printf("WirePlumber Config: Ensuring configuration exists at %s", cm.configFile)
+	log.Printf("%s Config: Ensuring configuration exists at %s", cm.name(), cm.configFile)
 
 	// Check if the config file already exists
 	if _, err := os.Stat(cm.configFile); err == nil {
-		log.Printf("WirePlumber Config: Configuration file already exists")
+		log.Printf("%s Config: Configuration file already exists", cm.name())
 		return cm.validateConfigContent()
 	}
 
@@ -57,11 +69,11 @@ func (cm *ConfigManager) EnsureConfig() error {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
-	log.Printf("WirePlumber Config: Configuration file created successfully")
+	log.Printf("%s Config: Configuration file created successfully", cm.name())
 	return nil
 }
 
-// writeConfigFile writes the WirePlumber configuration content to the file
+// writeConfigFile writes the configuration content to the file
 func (cm *ConfigManager) writeConfigFile() error {
 	file, err := os.Create(cm.configFile)
 	if err != nil {
@@ -69,7 +81,7 @@ func (cm *ConfigManager) writeConfigFile() error {
 	}
 	defer file.Close()
 
-	_, err = file.WriteString(WirePlumberConfigContent)
+	_, err = file.WriteString(cm.content)
 	if err != nil {
 		return fmt.Errorf("failed to write config content: %w", err)
 	}
@@ -84,19 +96,22 @@ func (cm *ConfigManager) validateConfigContent() error {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	if string(content) != WirePlumberConfigContent {
-		log.Printf("WirePlumber Config: Content differs, updating config file")
+	if string(content) != cm.content {
+		if !cm.owns(content) {
+			return fmt.Errorf("%s was not generated by home-bt-broker, it is left untouched", cm.configFile)
+		}
+		log.Printf("%s Config: Content differs, updating config file", cm.name())
 		return cm.writeConfigFile()
 	}
 
-	log.Printf("WirePlumber Config: Configuration file content is correct")
+	log.Printf("%s Config: Configuration file content is correct", cm.name())
 	return nil
 }
 
-// RemoveConfig removes the WirePlumber configuration file
+// RemoveConfig removes the configuration file
 func (cm *ConfigManager) RemoveConfig() error {
 	if _, err := os.Stat(cm.configFile); os.IsNotExist(err) {
-		log.Printf("WirePlumber Config: Configuration file does not exist, nothing to remove")
+		log.Printf("%s Config: Configuration file does not exist, nothing to remove", cm.name())
 		return nil
 	}
 
@@ -104,10 +119,15 @@ func (cm *ConfigManager) RemoveConfig() error {
 		return fmt.Errorf("failed to remove config file: %w", err)
 	}
 
-	log.Printf("WirePlumber Config: Configuration file removed successfully")
+	log.Printf("%s Config: Configuration file removed successfully", cm.name())
 	return nil
 }
 
+// Stack returns the audio stack the configuration is written for
+func (cm *ConfigManager) Stack() string {
+	return cm.stack
+}
+
 // GetConfigPath returns the path to the configuration file
 func (cm *ConfigManager) GetConfigPath() string {
 	return cm.configFile
@@ -117,4 +137,39 @@ func (cm *ConfigManager) GetConfigPath() string {
 func (cm *ConfigManager) ConfigExists() bool {
 	_, err := os.Stat(cm.configFile)
 	return err == nil
-}
\ No newline at end of file
+}
+
+// owns reports whether the broker may replace the content of the configuration file
+func (cm *ConfigManager) owns(content []byte) bool {
+	return !cm.shared || strings.HasPrefix(string(content), generatedHeader)
+}
+
+// name returns the name of the audio stack in the logs
+func (cm *ConfigManager) name() string {
+	if cm.stack == StackPulseAudio {
+		return "PulseAudio"
+	}
+	return "WirePlumber"
+}
+
+// CheckWritable checks the configuration directories can be created and written to
+func (cm *ConfigManager) CheckWritable() error {
+	for _, dir := range []string{cm.configDir, cm.pipewireDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create config directory: %w", err)
+		}
+
+		file, err := os.CreateTemp(dir, ".home-bt-broker-check-*")
+		if err != nil {
+			return fmt.Errorf("config directory %s is not writable: %w", dir, err)
+		}
+		file.Close()
+		if err := os.Remove(file.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package wireplumber
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// deviceFragmentPrefix numbers the device fragments before the main configuration file,
+// which keeps the last word on the global BlueZ monitor settings
+const deviceFragmentPrefix = "60-home-bt-broker-device-"
+
+// SyncDevices renders a fragment for every device whose settings change the WirePlumber policy and
+// removes the fragments of other devices, then reconciles the PipeWire fragment of the properties
+// shared by the devices. It returns whether a fragment changed; PipeWire and WirePlumber read their
+// configuration at startup, so they must be restarted to apply the change. PulseAudio has no
+// counterpart to the device rules, the devices keep its default policy.
+func (cm *ConfigManager) SyncDevices(settings []database.DeviceAudioSettings) (bool, error) {
+	if cm.stack == StackPulseAudio {
+		for _, device := range settings {
+			if renderDeviceFragment(device) != "" {
+				log.Printf("PulseAudio Config: The audio policy of %s requires WirePlumber, it is not applied", device.Address)
+			}
+		}
+		return false, nil
+	}
+
+	if err := os.MkdirAll(cm.configDir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	wanted := make(map[string]string)
+	for _, device := range settings {
+		if content := renderDeviceFragment(device); content != "" {
+			wanted[filepath.Join(cm.configDir, deviceFragmentName(device.Address))] = content
+		}
+	}
+
+	changed := false
+	existing, err := filepath.Glob(filepath.Join(cm.configDir, deviceFragmentPrefix+"*.conf"))
+	if err != nil {
+		return false, fmt.Errorf("failed to list device fragments: %w", err)
+	}
+	for _, path := range existing {
+		if _, ok := wanted[path]; ok {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return changed, fmt.Errorf("failed to remove device fragment: %w", err)
+		}
+		log.Printf("WirePlumber Config: Removed device fragment %s", filepath.Base(path))
+		changed = true
+	}
+
+	for path, content := range wanted {
+		current, err := os.ReadFile(path)
+		if err == nil && string(current) == content {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return changed, fmt.Errorf("failed to write device fragment: %w", err)
+		}
+		log.Printf("WirePlumber Config: Wrote device fragment %s", filepath.Base(path))
+		changed = true
+	}
+
+	pipewireChanged, err := cm.syncPipeWire(settings)
+	return changed || pipewireChanged, err
+}
+
+// deviceFragmentName returns the fragment file name of a device
+func deviceFragmentName(address string) string {
+	return deviceFragmentPrefix + strings.ReplaceAll(strings.ToUpper(address), ":", "_") + ".conf"
+}
+
+// renderDeviceFragment renders the WirePlumber rules of a device, or an empty string when its settings
+// keep the default policy
+func renderDeviceFragment(settings database.DeviceAudioSettings) string {
+	name := strings.ReplaceAll(strings.ToUpper(settings.Address), ":", "_")
+
+	var deviceProps, nodeProps []string
+	if !settings.AutoConnect {
+		deviceProps = append(deviceProps, "bluez5.auto-connect = [ ]")
+	}
+	if settings.Profile != "" {
+		deviceProps = append(deviceProps, fmt.Sprintf("device.profile = %q", settings.Profile))
+	}
+	if settings.SampleRate != 0 {
+		nodeProps = append(nodeProps, fmt.Sprintf("audio.rate = %d", settings.SampleRate))
+	}
+	switch settings.Channels {
+	case "mono":
+		nodeProps = append(nodeProps, "audio.channels = 1", "audio.position = [ MONO ]")
+	case "stereo":
+		nodeProps = append(nodeProps, "audio.channels = 2", "audio.position = [ FL FR ]")
+	}
+
+	if settings.Latency.NodeLatency != "" {
+		nodeProps = append(nodeProps, fmt.Sprintf("node.latency = %q", settings.Latency.NodeLatency))
+	}
+	if settings.Latency.Quantum != 0 {
+		nodeProps = append(nodeProps, fmt.Sprintf("node.force-quantum = %d", settings.Latency.Quantum))
+	}
+	if settings.Latency.OffsetMs != 0 {
+		nodeProps = append(nodeProps, fmt.Sprintf("node.latency-offset-msec = %d", settings.Latency.OffsetMs))
+	}
+
+	if len(deviceProps) == 0 && len(nodeProps) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by home-bt-broker from the audio settings of %s, do not edit\n", strings.ToUpper(settings.Address))
+	b.WriteString("monitor.bluez.rules = [\n")
+	if len(deviceProps) > 0 {
+		writeRule(&b, fmt.Sprintf("device.name = \"bluez_card.%s\"", name), deviceProps)
+	}
+	if len(nodeProps) > 0 {
+		writeRule(&b, fmt.Sprintf("node.name = \"~bluez_(input|output).%s.*\"", name), nodeProps)
+	}
+	b.WriteString("]\n")
+	return b.String()
+}
+
+func writeRule(b *strings.Builder, match string, props []string) {
+	fmt.Fprintf(b, "  {\n    matches = [\n      { %s }\n    ]\n    actions = {\n      update-props = {\n", match)
+	for _, prop := range props {
+		fmt.Fprintf(b, "        %s\n", prop)
+	}
+	b.WriteString("      }\n    }\n  }\n")
+}
@@ -0,0 +1,85 @@
+package wireplumber
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderDeviceFragment(t *testing.T) {
+	assert.Empty(t, renderDeviceFragment(database.DeviceAudioSettings{Address: "AA:BB:CC:DD:EE:FF", AutoConnect: true, Codecs: []string{"aac"}}))
+
+	content := renderDeviceFragment(database.DeviceAudioSettings{
+		Address:     "aa:bb:cc:dd:ee:ff",
+		AutoConnect: false,
+		Profile:     "headset-head-unit",
+		SampleRate:  16000,
+		Channels:    "mono",
+		Latency:     database.AudioLatency{NodeLatency: "256/48000", Quantum: 256, OffsetMs: -120},
+	})
+	assert.Equal(t, `# Generated by home-bt-broker from the audio settings of AA:BB:CC:DD:EE:FF, do not edit
+monitor.bluez.rules = [
+  {
+    matches = [
+      { device.name = "bluez_card.AA_BB_CC_DD_EE_FF" }
+    ]
+    actions = {
+      update-props = {
+        bluez5.auto-connect = [ ]
+        device.profile = "headset-head-unit"
+      }
+    }
+  }
+  {
+    matches = [
+      { node.name = "~bluez_(input|output).AA_BB_CC_DD_EE_FF.*" }
+    ]
+    actions = {
+      update-props = {
+        audio.rate = 16000
+        audio.channels = 1
+        audio.position = [ MONO ]
+        node.latency = "256/48000"
+        node.force-quantum = 256
+        node.latency-offset-msec = -120
+      }
+    }
+  }
+]
+`, content)
+}
+
+func TestConfigManager_SyncDevices(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cm, err := NewConfigManager()
+	assert.NoError(t, err)
+
+	headset := database.DeviceAudioSettings{Address: "AA:BB:CC:DD:EE:FF", Profile: "headset-head-unit", AutoConnect: true}
+	speaker := database.DeviceAudioSettings{Address: "11:22:33:44:55:66", AutoConnect: false}
+	headsetFragment := filepath.Join(cm.configDir, "60-home-bt-broker-device-AA_BB_CC_DD_EE_FF.conf")
+	speakerFragment := filepath.Join(cm.configDir, "60-home-bt-broker-device-11_22_33_44_55_66.conf")
+
+	// Test - fragments are written for both devices
+	changed, err := cm.SyncDevices([]database.DeviceAudioSettings{headset, speaker})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.FileExists(t, headsetFragment)
+	assert.FileExists(t, speakerFragment)
+
+	// Test - nothing changes when the settings are the same
+	changed, err = cm.SyncDevices([]database.DeviceAudioSettings{headset, speaker})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// Test - fragments of devices back to the default policy are removed, other files are kept
+	assert.NoError(t, cm.EnsureConfig())
+	speaker.AutoConnect = true
+	changed, err = cm.SyncDevices([]database.DeviceAudioSettings{headset, speaker})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.FileExists(t, headsetFragment)
+	assert.NoFileExists(t, speakerFragment)
+	assert.FileExists(t, cm.GetConfigPath())
+}
@@ -0,0 +1,140 @@
+package wireplumber
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Actions of a configuration change
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionRemove = "remove"
+	// ActionConflict marks a file written by the user, which the broker leaves untouched
+	ActionConflict = "conflict"
+)
+
+// Change is a change the broker would make to a configuration file
+type Change struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	// Diff is the unified diff of the file content
+	Diff string `json:"diff,omitempty"`
+}
+
+// Diff returns the changes EnsureConfig and SyncDevices would make to the configuration files from
+// the settings of the devices, without applying them
+func (cm *ConfigManager) Diff(settings []database.DeviceAudioSettings) ([]Change, error) {
+	wanted := map[string]string{cm.configFile: cm.content}
+	if cm.stack != StackPulseAudio {
+		for _, device := range settings {
+			if content := renderDeviceFragment(device); content != "" {
+				wanted[filepath.Join(cm.configDir, deviceFragmentName(device.Address))] = content
+			}
+		}
+		if content := renderPipeWireFragment(settings); content != "" {
+			wanted[filepath.Join(cm.pipewireDir, pipewireFragmentName)] = content
+		}
+	}
+
+	var changes []Change
+	for path, content := range wanted {
+		current, err := os.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+			changes = append(changes, Change{Path: path, Action: ActionCreate, Diff: unifiedDiff(path, "", content)})
+		case err != nil:
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		case string(current) == content:
+		case path == cm.configFile && !cm.owns(current):
+			changes = append(changes, Change{Path: path, Action: ActionConflict})
+		default:
+			changes = append(changes, Change{Path: path, Action: ActionUpdate, Diff: unifiedDiff(path, string(current), content)})
+		}
+	}
+
+	generated, err := cm.generatedFragments()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range generated {
+		if _, ok := wanted[path]; ok {
+			continue
+		}
+		current, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		changes = append(changes, Change{Path: path, Action: ActionRemove, Diff: unifiedDiff(path, string(current), "")})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+// Cleanup removes the configuration files generated by the broker, leaving the audio stack with
+// its own policy
+func (cm *ConfigManager) Cleanup() error {
+	var errs []error
+	if content, err := os.ReadFile(cm.configFile); err == nil && cm.owns(content) {
+		errs = append(errs, cm.RemoveConfig())
+	}
+
+	generated, err := cm.generatedFragments()
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, path := range generated {
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", path, err))
+			continue
+		}
+		log.Printf("%s Config: Removed %s", cm.name(), path)
+	}
+	return errors.Join(errs...)
+}
+
+// generatedFragments returns the existing device and PipeWire fragments
+func (cm *ConfigManager) generatedFragments() ([]string, error) {
+	if cm.stack == StackPulseAudio {
+		return nil, nil
+	}
+	fragments, err := filepath.Glob(filepath.Join(cm.configDir, deviceFragmentPrefix+"*.conf"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device fragments: %w", err)
+	}
+	pipewireFragment := filepath.Join(cm.pipewireDir, pipewireFragmentName)
+	if _, err := os.Stat(pipewireFragment); err == nil {
+		fragments = append(fragments, pipewireFragment)
+	}
+	return fragments, nil
+}
+
+// unifiedDiff returns the unified diff between two contents of a file
+func unifiedDiff(path, from, to string) string {
+	diff, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(from),
+		B:        splitLines(to),
+		FromFile: path,
+		ToFile:   path,
+		Context:  3,
+	})
+	return diff
+}
+
+// splitLines splits a file content into lines, an empty file having none
+func splitLines(content string) []string {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,78 @@
+package wireplumber
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigManager_Diff(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cm, err := NewConfigManager()
+	assert.NoError(t, err)
+	headset := database.DeviceAudioSettings{Address: "AA:BB:CC:DD:EE:FF", Codecs: []string{"aac"}, AutoConnect: false}
+	headsetFragment := filepath.Join(cm.configDir, "60-home-bt-broker-device-AA_BB_CC_DD_EE_FF.conf")
+	pipewireFragment := filepath.Join(cm.pipewireDir, pipewireFragmentName)
+
+	// Test - every file is created, nothing is written
+	changes, err := cm.Diff([]database.DeviceAudioSettings{headset})
+	assert.NoError(t, err)
+	if !assert.Len(t, changes, 3) {
+		return
+	}
+	for _, change := range changes {
+		assert.Equal(t, ActionCreate, change.Action)
+		assert.NoFileExists(t, change.Path)
+	}
+	assert.Equal(t, headsetFragment, changes[1].Path)
+	assert.Contains(t, changes[1].Diff, "+        bluez5.auto-connect = [ ]\n")
+	assert.NotContains(t, changes[1].Diff, "\n+\n")
+
+	// Test - nothing changes once applied
+	assert.NoError(t, cm.EnsureConfig())
+	_, err = cm.SyncDevices([]database.DeviceAudioSettings{headset})
+	assert.NoError(t, err)
+	changes, err = cm.Diff([]database.DeviceAudioSettings{headset})
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	// Test - updated and removed files
+	assert.NoError(t, os.WriteFile(cm.GetConfigPath(), []byte("wireplumber.profiles = {}\n"), 0644))
+	headset.AutoConnect = true
+	changes, err = cm.Diff([]database.DeviceAudioSettings{headset})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ActionRemove, ActionUpdate}, []string{changes[0].Action, changes[1].Action})
+	assert.Equal(t, headsetFragment, changes[0].Path)
+	assert.Equal(t, cm.GetConfigPath(), changes[1].Path)
+	assert.Contains(t, changes[1].Diff, "-wireplumber.profiles = {}\n")
+	assert.FileExists(t, pipewireFragment)
+}
+
+func TestConfigManager_Cleanup(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cm, err := NewConfigManager()
+	assert.NoError(t, err)
+	assert.NoError(t, cm.EnsureConfig())
+	_, err = cm.SyncDevices([]database.DeviceAudioSettings{{Address: "AA:BB:CC:DD:EE:FF", Codecs: []string{"aac"}, AutoConnect: false}})
+	assert.NoError(t, err)
+	other := filepath.Join(cm.configDir, "50-user.conf")
+	assert.NoError(t, os.WriteFile(other, []byte("{}\n"), 0644))
+
+	assert.NoError(t, cm.Cleanup())
+	assert.NoFileExists(t, cm.GetConfigPath())
+	assert.NoFileExists(t, filepath.Join(cm.pipewireDir, pipewireFragmentName))
+	fragments, _ := filepath.Glob(filepath.Join(cm.configDir, deviceFragmentPrefix+"*"))
+	assert.Empty(t, fragments)
+	assert.FileExists(t, other)
+
+	// The script of the user is kept
+	home := t.TempDir()
+	pulse := newPulseAudioConfigManager(filepath.Join(home, "missing"), home)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(pulse.GetConfigPath()), 0755))
+	assert.NoError(t, os.WriteFile(pulse.GetConfigPath(), []byte("load-module module-null-sink\n"), 0644))
+	assert.NoError(t, pulse.Cleanup())
+	assert.FileExists(t, pulse.GetConfigPath())
+}
@@ -0,0 +1,88 @@
+package wireplumber
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+)
+
+// pipewireFragmentName is the PipeWire fragment of the broker, numbered like the device fragments
+const pipewireFragmentName = "60-home-bt-broker-bluez.conf"
+
+// defaultAllowedRates are the rates PipeWire always switches to, the other rates are allowed when
+// a device asks for them
+var defaultAllowedRates = []int{44100, 48000}
+
+// syncPipeWire renders the PipeWire fragment from the settings of every device, or removes it when
+// they keep the default policy. It returns whether the fragment changed.
+func (cm *ConfigManager) syncPipeWire(settings []database.DeviceAudioSettings) (bool, error) {
+	path := filepath.Join(cm.pipewireDir, pipewireFragmentName)
+	content := renderPipeWireFragment(settings)
+	if content == "" {
+		if err := os.Remove(path); os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, fmt.Errorf("failed to remove PipeWire fragment: %w", err)
+		}
+		log.Printf("PipeWire Config: Removed fragment %s", pipewireFragmentName)
+		return true, nil
+	}
+
+	if current, err := os.ReadFile(path); err == nil && string(current) == content {
+		return false, nil
+	}
+	if err := os.MkdirAll(cm.pipewireDir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create PipeWire config directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, fmt.Errorf("failed to write PipeWire fragment: %w", err)
+	}
+	log.Printf("PipeWire Config: Wrote fragment %s", pipewireFragmentName)
+	return true, nil
+}
+
+// renderPipeWireFragment renders the bluez5 properties shared by the devices: the codecs enabled,
+// those preferred by a device along with SBC which every A2DP device supports, and the sample
+// rates the graph may switch to. It returns an empty string when no device changes them.
+func renderPipeWireFragment(settings []database.DeviceAudioSettings) string {
+	var codecs []string
+	rates := slices.Clone(defaultAllowedRates)
+	for _, device := range settings {
+		for _, codec := range device.Codecs {
+			if !slices.Contains(codecs, codec) {
+				codecs = append(codecs, codec)
+			}
+		}
+		if device.SampleRate != 0 && !slices.Contains(rates, device.SampleRate) {
+			rates = append(rates, device.SampleRate)
+		}
+	}
+	if len(codecs) == 0 && len(rates) == len(defaultAllowedRates) {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by home-bt-broker from the audio settings of the devices, do not edit\n")
+	if len(rates) > len(defaultAllowedRates) {
+		slices.Sort(rates)
+		values := make([]string, len(rates))
+		for i, rate := range rates {
+			values[i] = strconv.Itoa(rate)
+		}
+		fmt.Fprintf(&b, "context.properties = {\n  default.clock.allowed-rates = [ %s ]\n}\n", strings.Join(values, " "))
+	}
+	if len(codecs) > 0 {
+		if !slices.Contains(codecs, "sbc") {
+			codecs = append(codecs, "sbc")
+		}
+		slices.Sort(codecs)
+		fmt.Fprintf(&b, "monitor.bluez.properties = {\n  bluez5.codecs = [ %s ]\n}\n", strings.Join(codecs, " "))
+	}
+	return b.String()
+}
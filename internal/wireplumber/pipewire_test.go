@@ -0,0 +1,63 @@
+package wireplumber
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPipeWireFragment(t *testing.T) {
+	assert.Empty(t, renderPipeWireFragment(nil))
+	assert.Empty(t, renderPipeWireFragment([]database.DeviceAudioSettings{{Address: "AA:BB:CC:DD:EE:FF", SampleRate: 48000, AutoConnect: false}}))
+
+	content := renderPipeWireFragment([]database.DeviceAudioSettings{
+		{Address: "AA:BB:CC:DD:EE:FF", Codecs: []string{"ldac", "aptx_hd"}, SampleRate: 96000},
+		{Address: "11:22:33:44:55:66", Codecs: []string{"aac", "ldac"}, SampleRate: 16000},
+	})
+	assert.Equal(t, `# Generated by home-bt-broker from the audio settings of the devices, do not edit
+context.properties = {
+  default.clock.allowed-rates = [ 16000 44100 48000 96000 ]
+}
+monitor.bluez.properties = {
+  bluez5.codecs = [ aac aptx_hd ldac sbc ]
+}
+`, content)
+}
+
+func TestConfigManager_SyncPipeWire(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cm, err := NewConfigManager()
+	assert.NoError(t, err)
+	fragment := filepath.Join(cm.pipewireDir, pipewireFragmentName)
+
+	// Test - both directories are reconciled
+	headset := database.DeviceAudioSettings{Address: "AA:BB:CC:DD:EE:FF", Codecs: []string{"aac"}, Profile: "a2dp-sink", AutoConnect: true}
+	changed, err := cm.SyncDevices([]database.DeviceAudioSettings{headset})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.FileExists(t, fragment)
+	assert.FileExists(t, filepath.Join(cm.configDir, "60-home-bt-broker-device-AA_BB_CC_DD_EE_FF.conf"))
+
+	changed, err = cm.SyncDevices([]database.DeviceAudioSettings{headset})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	// Test - the PipeWire fragment alone changes
+	headset.Codecs = []string{"aac", "ldac"}
+	changed, err = cm.SyncDevices([]database.DeviceAudioSettings{headset})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	content, err := os.ReadFile(fragment)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "bluez5.codecs = [ aac ldac sbc ]")
+
+	// Test - the fragment is removed along with the last codec preference
+	headset.Codecs = nil
+	changed, err = cm.SyncDevices([]database.DeviceAudioSettings{headset})
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.NoFileExists(t, fragment)
+}
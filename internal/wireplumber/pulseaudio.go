@@ -0,0 +1,115 @@
+package wireplumber
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Audio stacks the Bluetooth policy is written for
+const (
+	StackWirePlumber = "wireplumber"
+	StackPulseAudio  = "pulseaudio"
+)
+
+const (
+	// generatedHeader starts the PulseAudio scripts written by the broker
+	generatedHeader = "# Generated by home-bt-broker, do not edit\n"
+
+	// PulseAudioConfigContent is the PulseAudio counterpart of WirePlumberConfigContent: the Bluetooth
+	// modules are loaded whether or not a local seat is active, which a headless host never has.
+	// Loading a module twice fails, hence .nofail.
+	PulseAudioConfigContent = generatedHeader + `.nofail
+.ifexists module-bluetooth-policy.so
+load-module module-bluetooth-policy
+.endif
+.ifexists module-bluetooth-discover.so
+load-module module-bluetooth-discover
+.endif
+.fail
+`
+
+	// pulseSystemDropInDir is read by PulseAudio 15 and later after /etc/pulse/default.pa
+	pulseSystemDropInDir = "/etc/pulse/default.pa.d"
+	pulseSystemScript    = "/etc/pulse/default.pa"
+)
+
+// Detect returns the configuration manager of the audio stack of the host
+func Detect() (*ConfigManager, error) {
+	if DetectStack() == StackPulseAudio {
+		return NewPulseAudioConfigManager()
+	}
+	return NewConfigManager()
+}
+
+// DetectStack returns the audio stack of the host: PulseAudio when it runs, or is installed, without
+// WirePlumber, and WirePlumber otherwise. PipeWire serving the PulseAudio clients runs as
+// pipewire-pulse, so it is not mistaken for PulseAudio.
+func DetectStack() string {
+	return detectStack("/proc", exec.LookPath)
+}
+
+func detectStack(procDir string, lookPath func(string) (string, error)) string {
+	running := runningProcesses(procDir)
+	switch {
+	case running[StackWirePlumber]:
+		return StackWirePlumber
+	case running[StackPulseAudio]:
+		return StackPulseAudio
+	}
+	if _, err := lookPath(StackWirePlumber); err == nil {
+		return StackWirePlumber
+	}
+	if _, err := lookPath(StackPulseAudio); err == nil {
+		return StackPulseAudio
+	}
+	return StackWirePlumber
+}
+
+// runningProcesses returns the command names of the running processes
+func runningProcesses(procDir string) map[string]bool {
+	names := make(map[string]bool)
+	comms, _ := filepath.Glob(filepath.Join(procDir, "[0-9]*", "comm"))
+	for _, comm := range comms {
+		if name, err := os.ReadFile(comm); err == nil {
+			names[strings.TrimSpace(string(name))] = true
+		}
+	}
+	return names
+}
+
+// NewPulseAudioConfigManager creates a configuration manager writing the Bluetooth policy for
+// PulseAudio: a drop-in of /etc/pulse/default.pa.d when the broker can write there, or else a
+// ~/.config/pulse/default.pa including the system script
+func NewPulseAudioConfigManager() (*ConfigManager, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return newPulseAudioConfigManager(pulseSystemDropInDir, homeDir), nil
+}
+
+func newPulseAudioConfigManager(systemDropInDir, homeDir string) *ConfigManager {
+	system := &ConfigManager{
+		stack:      StackPulseAudio,
+		configDir:  systemDropInDir,
+		configFile: filepath.Join(systemDropInDir, "99-home-bt-broker.pa"),
+		content:    PulseAudioConfigContent,
+	}
+	// The drop-in directory is only created by a PulseAudio reading it
+	if info, err := os.Stat(systemDropInDir); err == nil && info.IsDir() && system.CheckWritable() == nil {
+		return system
+	}
+
+	// The user script replaces the system one, which it includes first
+	configDir := filepath.Join(homeDir, ".config", "pulse")
+	return &ConfigManager{
+		stack:      StackPulseAudio,
+		configDir:  configDir,
+		configFile: filepath.Join(configDir, "default.pa"),
+		content:    strings.Replace(PulseAudioConfigContent, generatedHeader, generatedHeader+".include "+pulseSystemScript+"\n", 1),
+		shared:     true,
+	}
+}
@@ -0,0 +1,87 @@
+package wireplumber
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nerzhul/home-bt-broker/internal/database"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectStack(t *testing.T) {
+	procDir := t.TempDir()
+	process := func(pid, comm string) {
+		assert.NoError(t, os.MkdirAll(filepath.Join(procDir, pid), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(procDir, pid, "comm"), []byte(comm+"\n"), 0644))
+	}
+	installed := func(names ...string) func(string) (string, error) {
+		return func(name string) (string, error) {
+			for _, n := range names {
+				if n == name {
+					return "/usr/bin/" + name, nil
+				}
+			}
+			return "", errors.New("not found")
+		}
+	}
+
+	// Nothing running nor installed keeps WirePlumber
+	assert.Equal(t, StackWirePlumber, detectStack(procDir, installed()))
+	assert.Equal(t, StackPulseAudio, detectStack(procDir, installed("pulseaudio")))
+	assert.Equal(t, StackWirePlumber, detectStack(procDir, installed("pulseaudio", "wireplumber")))
+
+	// A running stack wins over the installed ones
+	process("42", "pipewire-pulse")
+	process("43", "pulseaudio")
+	assert.Equal(t, StackPulseAudio, detectStack(procDir, installed("wireplumber")))
+	process("44", "wireplumber")
+	assert.Equal(t, StackWirePlumber, detectStack(procDir, installed("pulseaudio")))
+}
+
+func TestPulseAudioConfigManager_SystemDropIn(t *testing.T) {
+	systemDir := t.TempDir()
+	cm := newPulseAudioConfigManager(systemDir, t.TempDir())
+	assert.Equal(t, StackPulseAudio, cm.Stack())
+	assert.Equal(t, filepath.Join(systemDir, "99-home-bt-broker.pa"), cm.GetConfigPath())
+
+	assert.NoError(t, cm.EnsureConfig())
+	content, err := os.ReadFile(cm.GetConfigPath())
+	assert.NoError(t, err)
+	assert.Equal(t, PulseAudioConfigContent, string(content))
+
+	// PulseAudio has no device rules, nothing is written for the devices
+	changed, err := cm.SyncDevices([]database.DeviceAudioSettings{{Address: "AA:BB:CC:DD:EE:FF", Profile: "headset-head-unit"}})
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	fragments, _ := filepath.Glob(filepath.Join(systemDir, deviceFragmentPrefix+"*"))
+	assert.Empty(t, fragments)
+}
+
+func TestPulseAudioConfigManager_UserScript(t *testing.T) {
+	home := t.TempDir()
+	cm := newPulseAudioConfigManager(filepath.Join(t.TempDir(), "missing"), home)
+	path := filepath.Join(home, ".config", "pulse", "default.pa")
+	assert.Equal(t, path, cm.GetConfigPath())
+
+	assert.NoError(t, cm.EnsureConfig())
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), generatedHeader+".include /etc/pulse/default.pa\n")
+	assert.Contains(t, string(content), "load-module module-bluetooth-discover\n")
+
+	// An outdated generated script is updated
+	assert.NoError(t, os.WriteFile(path, []byte(generatedHeader+"load-module module-null-sink\n"), 0644))
+	assert.NoError(t, cm.EnsureConfig())
+	content, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, cm.content, string(content))
+
+	// The script of the user is left untouched
+	assert.NoError(t, os.WriteFile(path, []byte(".include /etc/pulse/default.pa\n"), 0644))
+	assert.Error(t, cm.EnsureConfig())
+	content, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, ".include /etc/pulse/default.pa\n", string(content))
+}
@@ -0,0 +1,2 @@
+ALTER TABLE user_tokens DROP COLUMN last_ip;
+ALTER TABLE user_tokens DROP COLUMN last_used_at;
@@ -0,0 +1,2 @@
+ALTER TABLE user_tokens ADD COLUMN last_used_at DATETIME;
+ALTER TABLE user_tokens ADD COLUMN last_ip TEXT;
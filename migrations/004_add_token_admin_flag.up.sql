@@ -0,0 +1,4 @@
+ALTER TABLE user_tokens ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT 0;
+
+-- Tokens created before roles existed could already manage tokens, keep them admins
+UPDATE user_tokens SET is_admin = 1;
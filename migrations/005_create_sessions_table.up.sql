@@ -0,0 +1,10 @@
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY NOT NULL,
+    username TEXT NOT NULL,
+    csrf_token TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_sessions_username ON sessions(username);
+CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
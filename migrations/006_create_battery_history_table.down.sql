@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_battery_history_address_recorded_at;
+DROP TABLE IF EXISTS battery_history;
@@ -0,0 +1,9 @@
+CREATE TABLE battery_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    adapter TEXT NOT NULL,
+    address TEXT NOT NULL,
+    percentage INTEGER NOT NULL,
+    recorded_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_battery_history_address_recorded_at ON battery_history(address, recorded_at);
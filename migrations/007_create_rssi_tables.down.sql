@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_rssi_history_address_recorded_at;
+DROP TABLE IF EXISTS rssi_history;
+DROP TABLE IF EXISTS rssi_tracked_devices;
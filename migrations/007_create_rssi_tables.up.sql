@@ -0,0 +1,14 @@
+CREATE TABLE rssi_tracked_devices (
+    address TEXT PRIMARY KEY NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE rssi_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    adapter TEXT NOT NULL,
+    address TEXT NOT NULL,
+    rssi INTEGER NOT NULL,
+    recorded_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_rssi_history_address_recorded_at ON rssi_history(address, recorded_at);
@@ -0,0 +1,6 @@
+CREATE TABLE presence_devices (
+    address TEXT PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL,
+    away_timeout INTEGER,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,5 @@
+CREATE TABLE pairing_allowlist (
+    address TEXT PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,8 @@
+CREATE TABLE device_audio_settings (
+    address TEXT PRIMARY KEY NOT NULL COLLATE NOCASE,
+    codec TEXT NOT NULL DEFAULT '',
+    sample_rate INTEGER NOT NULL DEFAULT 0,
+    channels TEXT NOT NULL DEFAULT '',
+    auto_switch_default_sink BOOLEAN NOT NULL DEFAULT 0,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
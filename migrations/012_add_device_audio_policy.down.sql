@@ -0,0 +1,2 @@
+ALTER TABLE device_audio_settings DROP COLUMN profile;
+ALTER TABLE device_audio_settings DROP COLUMN auto_connect;
@@ -0,0 +1,2 @@
+ALTER TABLE device_audio_settings ADD COLUMN auto_connect BOOLEAN NOT NULL DEFAULT 1;
+ALTER TABLE device_audio_settings ADD COLUMN profile TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+CREATE TABLE virtual_nodes (
+    name TEXT PRIMARY KEY NOT NULL,
+    type TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    channels INTEGER NOT NULL DEFAULT 2,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
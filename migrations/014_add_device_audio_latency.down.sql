@@ -0,0 +1,3 @@
+ALTER TABLE device_audio_settings DROP COLUMN latency_offset_ms;
+ALTER TABLE device_audio_settings DROP COLUMN quantum;
+ALTER TABLE device_audio_settings DROP COLUMN node_latency;
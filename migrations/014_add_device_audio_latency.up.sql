@@ -0,0 +1,3 @@
+ALTER TABLE device_audio_settings ADD COLUMN node_latency TEXT NOT NULL DEFAULT '';
+ALTER TABLE device_audio_settings ADD COLUMN quantum INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE device_audio_settings ADD COLUMN latency_offset_ms INTEGER NOT NULL DEFAULT 0;
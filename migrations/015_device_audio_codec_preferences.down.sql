@@ -0,0 +1,3 @@
+ALTER TABLE device_audio_settings ADD COLUMN codec TEXT NOT NULL DEFAULT '';
+UPDATE device_audio_settings SET codec = CASE WHEN instr(codecs, ',') > 0 THEN substr(codecs, 1, instr(codecs, ',') - 1) ELSE codecs END;
+ALTER TABLE device_audio_settings DROP COLUMN codecs;
@@ -0,0 +1,3 @@
+ALTER TABLE device_audio_settings ADD COLUMN codecs TEXT NOT NULL DEFAULT '';
+UPDATE device_audio_settings SET codecs = codec;
+ALTER TABLE device_audio_settings DROP COLUMN codec;
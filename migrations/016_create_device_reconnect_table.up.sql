@@ -0,0 +1,5 @@
+CREATE TABLE device_reconnect (
+    address TEXT PRIMARY KEY NOT NULL COLLATE NOCASE,
+    steps TEXT NOT NULL DEFAULT '[]',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS idle_policies;
@@ -0,0 +1,5 @@
+CREATE TABLE idle_policies (
+    target TEXT PRIMARY KEY NOT NULL COLLATE NOCASE,
+    timeout_minutes INTEGER NOT NULL,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
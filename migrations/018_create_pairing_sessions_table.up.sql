@@ -0,0 +1,9 @@
+CREATE TABLE pairing_sessions (
+    token_hash TEXT PRIMARY KEY NOT NULL,
+    username TEXT NOT NULL,
+    adapter TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_pairing_sessions_expires_at ON pairing_sessions(expires_at);
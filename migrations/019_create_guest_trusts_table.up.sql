@@ -0,0 +1,7 @@
+CREATE TABLE guest_trusts (
+    address TEXT PRIMARY KEY NOT NULL COLLATE NOCASE,
+    adapter TEXT NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_guest_trusts_expires_at ON guest_trusts(expires_at);
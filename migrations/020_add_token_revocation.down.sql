@@ -0,0 +1,3 @@
+DELETE FROM user_tokens WHERE revoked_at IS NOT NULL;
+ALTER TABLE user_tokens DROP COLUMN revoked_by;
+ALTER TABLE user_tokens DROP COLUMN revoked_at;
@@ -0,0 +1,2 @@
+ALTER TABLE user_tokens ADD COLUMN revoked_at DATETIME;
+ALTER TABLE user_tokens ADD COLUMN revoked_by TEXT;
@@ -0,0 +1,8 @@
+CREATE TABLE token_route_stats (
+    username TEXT NOT NULL,
+    route TEXT NOT NULL,
+    requests INTEGER NOT NULL DEFAULT 0,
+    errors INTEGER NOT NULL DEFAULT 0,
+    last_used_at DATETIME NOT NULL,
+    PRIMARY KEY (username, route)
+);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS token_quota_usage;
+ALTER TABLE user_tokens DROP COLUMN daily_quota;
+ALTER TABLE user_tokens DROP COLUMN hourly_quota;
@@ -0,0 +1,9 @@
+ALTER TABLE user_tokens ADD COLUMN hourly_quota INTEGER;
+ALTER TABLE user_tokens ADD COLUMN daily_quota INTEGER;
+CREATE TABLE token_quota_usage (
+    username TEXT NOT NULL,
+    period TEXT NOT NULL,
+    window_start DATETIME NOT NULL,
+    requests INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (username, period)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE idempotency_keys (
+    username TEXT NOT NULL,
+    key TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    status INTEGER NOT NULL,
+    content_type TEXT NOT NULL,
+    body BLOB NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (username, key)
+);
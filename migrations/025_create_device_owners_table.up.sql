@@ -0,0 +1,8 @@
+CREATE TABLE device_owners (
+    address TEXT PRIMARY KEY NOT NULL,
+    owner TEXT NOT NULL,
+    adapter TEXT NOT NULL,
+    paired_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_device_owners_owner ON device_owners(owner);
@@ -0,0 +1,11 @@
+CREATE TABLE automation_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    trigger TEXT NOT NULL,
+    script TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_automation_rules_trigger ON automation_rules(trigger);
@@ -0,0 +1,14 @@
+CREATE TABLE known_devices (
+    adapter TEXT NOT NULL,
+    address TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    class INTEGER NOT NULL DEFAULT 0,
+    trusted BOOLEAN NOT NULL DEFAULT 0,
+    blocked BOOLEAN NOT NULL DEFAULT 0,
+    has_link_key BOOLEAN NOT NULL DEFAULT 0,
+    last_seen DATETIME,
+    imported_at DATETIME NOT NULL,
+    PRIMARY KEY (adapter, address)
+);
+
+CREATE INDEX idx_known_devices_address ON known_devices(address);
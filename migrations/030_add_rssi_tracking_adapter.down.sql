@@ -0,0 +1,10 @@
+CREATE TABLE rssi_tracked_devices_old (
+    address TEXT PRIMARY KEY NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT OR IGNORE INTO rssi_tracked_devices_old (address, created_at)
+SELECT address, MIN(created_at) FROM rssi_tracked_devices GROUP BY address;
+
+DROP TABLE rssi_tracked_devices;
+ALTER TABLE rssi_tracked_devices_old RENAME TO rssi_tracked_devices;
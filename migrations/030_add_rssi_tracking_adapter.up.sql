@@ -0,0 +1,20 @@
+CREATE TABLE rssi_tracked_devices_new (
+    adapter TEXT NOT NULL,
+    address TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (adapter, address)
+);
+
+-- Tracked devices get the adapter of their last sample, or the one they are known on. The others
+-- were never seen and are dropped.
+INSERT OR IGNORE INTO rssi_tracked_devices_new (adapter, address, created_at)
+SELECT adapter, address, created_at FROM (
+    SELECT COALESCE(
+        (SELECT h.adapter FROM rssi_history h WHERE h.address = upper(t.address) ORDER BY h.recorded_at DESC LIMIT 1),
+        (SELECT k.adapter FROM known_devices k WHERE k.address = upper(t.address) LIMIT 1)
+    ) AS adapter, upper(t.address) AS address, t.created_at
+    FROM rssi_tracked_devices t
+) WHERE adapter IS NOT NULL;
+
+DROP TABLE rssi_tracked_devices;
+ALTER TABLE rssi_tracked_devices_new RENAME TO rssi_tracked_devices;
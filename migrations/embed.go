@@ -0,0 +1,10 @@
+// Package migrations embeds the SQL migrations of the broker database, so the binary does not
+// depend on its working directory
+package migrations
+
+import "embed"
+
+// FS holds the NNN_name.up.sql and NNN_name.down.sql migration files
+//
+//go:embed *.sql
+var FS embed.FS